@@ -0,0 +1,36 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import "errors"
+
+// The transport adapters, NATSCodec, MQTTCodec, KafkaSerde, RedisCodec and
+// EncryptedWebSocket, seal messages into envelopes and open them with the
+// decrypter a Router finds for the envelope's algorithm and KID, so senders
+// can rotate keys without coordinating with receivers.  Each binds where a
+// message was sent, like its topic or key, as associated data, so a message
+// moved somewhere else can't be decrypted.  The encrypter must support
+// associated data.
+
+var errNoTransportCipher = errors.New("no cipher configured")
+
+// transportAD is the associated data of a message sent to the destination
+// over the transport.
+func transportAD(transport string, destination string) []byte {
+	return []byte("voynicrypto-" + transport + ":" + destination)
+}
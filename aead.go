@@ -0,0 +1,146 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// AEADEncrypt is an Encrypt that can bind associated data, like a device id
+// or message type, to the ciphertext without encrypting it.
+type AEADEncrypt interface {
+	Encrypt
+
+	// EncryptMessageWithAD encrypts the message and binds the associated data
+	// to it.  The associated data isn't part of the result and has to be
+	// sent alongside it.
+	EncryptMessageWithAD(message []byte, ad []byte) (crypt []byte, nonce []byte, err error)
+}
+
+// AEADDecrypt is a Decrypt that can check associated data bound to the
+// ciphertext by an AEADEncrypt.
+type AEADDecrypt interface {
+	Decrypt
+
+	// DecryptMessageWithAD decrypts the message and fails if the associated
+	// data isn't what it was encrypted with.
+	DecryptMessageWithAD(cipher []byte, nonce []byte, ad []byte) (message []byte, err error)
+}
+
+var errAADNotSupported = errors.New("cipher does not support associated data")
+
+// EncryptMessageWithAD encrypts the message with associated data, failing if
+// the encrypter can't bind associated data.
+func EncryptMessageWithAD(encrypter Encrypt, message []byte, ad []byte) ([]byte, []byte, error) {
+	if e, ok := encrypter.(AEADEncrypt); ok {
+		return e.EncryptMessageWithAD(message, ad)
+	}
+	return nil, nil, errAADNotSupported
+}
+
+// DecryptMessageWithAD decrypts the message and checks its associated data,
+// failing if the decrypter can't check associated data.
+func DecryptMessageWithAD(decrypter Decrypt, cipher []byte, nonce []byte, ad []byte) ([]byte, error) {
+	if d, ok := decrypter.(AEADDecrypt); ok {
+		return d.DecryptMessageWithAD(cipher, nonce, ad)
+	}
+	return nil, errAADNotSupported
+}
+
+// adLabel appends the associated data to the OAEP label, which OAEP binds to
+// the ciphertext.
+func (c *rsaEncrypterDecrypter) adLabel(ad []byte) []byte {
+	label := make([]byte, 0, len(c.label)+len(ad))
+	return append(append(label, c.label...), ad...)
+}
+
+// EncryptMessageWithAD encrypts the message using RSA, binding the associated
+// data through the OAEP label.
+func (c *rsaEncrypterDecrypter) EncryptMessageWithAD(message []byte, ad []byte) ([]byte, []byte, error) {
+	return c.encrypt(message, c.adLabel(ad))
+}
+
+// DecryptMessageWithAD decrypts the message using RSA, checking the
+// associated data through the OAEP label.
+func (c *rsaEncrypterDecrypter) DecryptMessageWithAD(cipher []byte, nonce []byte, ad []byte) ([]byte, error) {
+	return c.decrypt(cipher, nonce, c.adLabel(ad))
+}
+
+// boxADLabel separates the keys of box messages sealed with associated data
+// from the shared key plain messages are sealed with.
+const boxADLabel = "voynicrypto box associated data"
+
+// boxADKey derives the key a box message with associated data is sealed
+// with from the shared key and the associated data.  A message sealed with
+// it doesn't open with the shared key, so DecryptMessage rejects it, nor
+// under any other associated data.
+func boxADKey(sharedKey *[32]byte, ad []byte) *[32]byte {
+	mac := hmac.New(sha256.New, sharedKey[:])
+	mac.Write([]byte(boxADLabel))
+	mac.Write(ad)
+	key := new([32]byte)
+	mac.Sum(key[:0])
+	return key
+}
+
+// EncryptMessageWithAD encrypts the message using the box algorithm.  Box has
+// no associated data of its own, so the message is sealed under a key
+// derived from the shared key and the associated data.
+func (enBox *encryptBox) EncryptMessageWithAD(message []byte, ad []byte) ([]byte, []byte, error) {
+	enBox.lock.RLock()
+	defer enBox.lock.RUnlock()
+	if enBox.sharedEncryptKey == nil {
+		return []byte(""), []byte{}, errCipherClosed
+	}
+	var nonce [24]byte
+	if err := enBox.nonceSource().NextNonce(nonce[:]); err != nil {
+		return []byte(""), []byte{}, err
+	}
+	key := boxADKey(enBox.sharedEncryptKey, ad)
+	defer wipe(key[:])
+	return box.SealAfterPrecomputation(nil, message, &nonce, key), nonce[:], nil
+}
+
+// DecryptMessageWithAD decrypts the message using the box algorithm with the
+// key derived from the associated data, so it fails if the associated data
+// isn't what the message was sealed with.
+func (deBox *decryptBox) DecryptMessageWithAD(cipher []byte, nonce []byte, ad []byte) ([]byte, error) {
+	deBox.lock.RLock()
+	defer deBox.lock.RUnlock()
+	if deBox.sharedDecryptKey == nil {
+		return []byte(""), errCipherClosed
+	}
+	var decryptNonce [24]byte
+	if err := checkNonceSize(nonce, len(decryptNonce)); err != nil {
+		return []byte(""), err
+	}
+	copy(decryptNonce[:], nonce)
+
+	key := boxADKey(deBox.sharedDecryptKey, ad)
+	defer wipe(key[:])
+	decrypted, ok := box.OpenAfterPrecomputation(nil, cipher, &decryptNonce, key)
+	if !ok {
+		return []byte(""), fmt.Errorf("%w: associated data does not match", ErrDecryptFailed)
+	}
+	return decrypted, nil
+}
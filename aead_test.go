@@ -0,0 +1,81 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssociatedData(t *testing.T) {
+	boxEncrypter, boxDecrypter := loadBoxPair(t)
+
+	privateKey := GeneratePrivateKey(2048)
+	signingKey := GeneratePrivateKey(2048)
+	rsaSymEncrypter := NewRSAEncrypter(DefaultRSAHash, nil, &privateKey.PublicKey, "")
+	rsaSymDecrypter := NewRSADecrypter(DefaultRSAHash, privateKey, nil, "")
+	rsaAsyEncrypter := NewRSAEncrypter(DefaultRSAHash, signingKey, &privateKey.PublicKey, "")
+	rsaAsyDecrypter := NewRSADecrypter(DefaultRSAHash, privateKey, &signingKey.PublicKey, "")
+
+	testData := []struct {
+		description string
+		encrypter   Encrypt
+		decrypter   Decrypt
+	}{
+		{"box", boxEncrypter, boxDecrypter},
+		{"rsa symmetric", rsaSymEncrypter, rsaSymDecrypter},
+		{"rsa asymmetric", rsaAsyEncrypter, rsaAsyDecrypter},
+		{"fallback", boxEncrypter, &fallbackDecrypter{decrypters: []Decrypt{rsaSymDecrypter, boxDecrypter}}},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			ad := []byte("device=mac:112233445566;type=event")
+			cipher, nonce, err := EncryptMessageWithAD(tc.encrypter, []byte("hello"), ad)
+			require.Nil(err)
+
+			message, err := DecryptMessageWithAD(tc.decrypter, cipher, nonce, ad)
+			require.Nil(err)
+			assert.Equal([]byte("hello"), message)
+
+			_, err = DecryptMessageWithAD(tc.decrypter, cipher, nonce, []byte("device=mac:665544332211;type=event"))
+			assert.NotNil(err)
+
+			_, err = DecryptMessageWithAD(tc.decrypter, cipher, nonce, nil)
+			assert.NotNil(err)
+
+			_, err = tc.decrypter.DecryptMessage(cipher, nonce)
+			assert.NotNil(err, "sealed with associated data but opened without")
+		})
+	}
+}
+
+func TestAssociatedDataNotSupported(t *testing.T) {
+	assert := assert.New(t)
+
+	_, _, err := EncryptMessageWithAD(DefaultCipherEncrypter(), []byte("hello"), []byte("ad"))
+	assert.Equal(errAADNotSupported, err)
+
+	_, err = DecryptMessageWithAD(DefaultCipherDecrypter(), []byte("hello"), nil, []byte("ad"))
+	assert.Equal(errAADNotSupported, err)
+}
@@ -0,0 +1,178 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+)
+
+// aesGCMNonceSize is the standard GCM nonce size.
+const aesGCMNonceSize = 12
+
+type aesGCMCipher struct {
+	kid      string
+	key      []byte
+	aead     cipher.AEAD
+	nonces   NonceSource
+	nonceKey []byte
+	lock     sync.RWMutex
+}
+
+// WithDeterministicNonces makes an AES-GCM encrypter derive each nonce from
+// the key, the message and the associated data instead of taking it from a
+// NonceSource, so the same message always encrypts to the same ciphertext.
+// That lets an encrypted column be searched by equality, at the cost of
+// revealing which messages are equal; use it only where that is acceptable.
+// Different messages still get different nonces.  Any AES-GCM decrypter can
+// decrypt the messages.
+func WithDeterministicNonces() CipherOption {
+	return func(o *cipherOptions) error {
+		o.deterministic = true
+		return nil
+	}
+}
+
+// NewAESGCMEncrypt returns an AES-GCM encrypter for a 16, 24 or 32 byte key,
+// like one from KeyAgreement.DeriveKey.  The nonces are random unless
+// WithNonceSource or WithDeterministicNonces is given; with random nonces a
+// key shouldn't encrypt more than 2^32 messages.  The key is copied, and
+// CloseCipher wipes the copy.
+func NewAESGCMEncrypt(key []byte, options ...CipherOption) (Encrypt, error) {
+	return newAESGCMCipher(key, options)
+}
+
+// NewAESGCMDecrypt returns an AES-GCM decrypter for the key.
+func NewAESGCMDecrypt(key []byte, options ...CipherOption) (Decrypt, error) {
+	return newAESGCMCipher(key, options)
+}
+
+func newAESGCMCipher(key []byte, options []CipherOption) (*aesGCMCipher, error) {
+	if err := checkFIPSAlgorithm(AESGCM); err != nil {
+		return nil, err
+	}
+	o, err := newCipherOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	c := &aesGCMCipher{
+		kid:    o.kid,
+		key:    append([]byte{}, key...),
+		nonces: boxNonceSource(o.nonces, o.random),
+	}
+	if c.aead, err = newAESGCM(c.key); err != nil {
+		return nil, err
+	}
+	if c.nonces == nil {
+		c.nonces = defaultNonceSource
+	}
+	if o.deterministic {
+		if c.nonceKey, err = DeriveKey(c.key, nil, []byte("voynicrypto-aes-gcm-nonce"), sha256.Size); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// GetAlgorithm returns the algorithm type.
+func (c *aesGCMCipher) GetAlgorithm() AlgorithmType {
+	return AESGCM
+}
+
+// GetKID returns the KID.
+func (c *aesGCMCipher) GetKID() string {
+	return c.kid
+}
+
+// EncryptMessage seals the message, returning the nonce used.
+func (c *aesGCMCipher) EncryptMessage(message []byte) ([]byte, []byte, error) {
+	return c.EncryptMessageWithAD(message, nil)
+}
+
+// EncryptMessageWithAD seals the message, authenticating ad along with it.
+func (c *aesGCMCipher) EncryptMessageWithAD(message []byte, ad []byte) ([]byte, []byte, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.aead == nil {
+		return nil, nil, errCipherClosed
+	}
+	// the nonce and the cipher share one allocation
+	buffer := make([]byte, aesGCMNonceSize, aesGCMNonceSize+len(message)+c.aead.Overhead())
+	nonce := buffer[:aesGCMNonceSize:aesGCMNonceSize]
+	if c.nonceKey != nil {
+		copy(nonce, c.syntheticNonce(message, ad))
+	} else if err := c.nonces.NextNonce(nonce); err != nil {
+		return nil, nil, err
+	}
+	return c.aead.Seal(buffer[aesGCMNonceSize:], nonce, message, ad), nonce, nil
+}
+
+// syntheticNonce is an HMAC of the associated data and the message, which
+// only repeats when both do.
+func (c *aesGCMCipher) syntheticNonce(message []byte, ad []byte) []byte {
+	mac := hmac.New(sha256.New, c.nonceKey)
+	mac.Write(binary.BigEndian.AppendUint64(nil, uint64(len(ad))))
+	mac.Write(ad)
+	mac.Write(message)
+	return mac.Sum(nil)[:aesGCMNonceSize]
+}
+
+// DecryptMessage opens the message.
+func (c *aesGCMCipher) DecryptMessage(cipher []byte, nonce []byte) ([]byte, error) {
+	return c.DecryptMessageWithAD(cipher, nonce, nil)
+}
+
+// DecryptMessageWithAD opens the message, which must have been sealed with
+// the same ad.
+func (c *aesGCMCipher) DecryptMessageWithAD(cipher []byte, nonce []byte, ad []byte) ([]byte, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.aead == nil {
+		return nil, errCipherClosed
+	}
+	if err := checkNonceSize(nonce, aesGCMNonceSize); err != nil {
+		return nil, err
+	}
+	message, err := c.aead.Open(nil, nonce, cipher, ad)
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+	return message, nil
+}
+
+// Metadata reports the nonce size and tag of GCM.
+func (c *aesGCMCipher) Metadata() Metadata {
+	return Metadata{
+		NonceSize:     aesGCMNonceSize,
+		Overhead:      16, // the GCM tag
+		Authenticated: true,
+	}
+}
+
+// Close wipes the key.
+func (c *aesGCMCipher) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	wipe(c.key)
+	wipe(c.nonceKey)
+	c.aead = nil
+	return nil
+}
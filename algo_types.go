@@ -17,6 +17,12 @@
 
 package voynicrypto
 
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
 // AlgorithmType is an enum used to specify which algorithm is being used.
 type AlgorithmType string
 
@@ -25,17 +31,171 @@ const (
 	Box           AlgorithmType = "box"
 	RSASymmetric  AlgorithmType = "rsa-sym"
 	RSAAsymmetric AlgorithmType = "rsa-asy"
+
+	// BoxEphemeral is box with a new sender key for every message, for
+	// forward secrecy.  It only needs the recipient's keys.
+	BoxEphemeral AlgorithmType = "box-ephemeral"
+
+	// Ed25519Sign, RSAPSS and ECDSA sign messages instead of encrypting
+	// them, and are loaded with Config.LoadSign and Config.LoadVerify.
+	Ed25519Sign AlgorithmType = "ed25519-sign"
+	RSAPSS      AlgorithmType = "rsa-pss"
+	ECDSA       AlgorithmType = "ecdsa"
+
+	// AESGCM is a symmetric cipher built with NewAESGCMEncrypt and
+	// NewAESGCMDecrypt from a shared key, usually one from a KeyAgreement.
+	// It isn't loaded from a Config.
+	AESGCM AlgorithmType = "aes-gcm"
+
+	// Ratchet is a RatchetSession, which moves its AES-GCM key forward with
+	// every message.  It isn't loaded from a Config either.
+	Ratchet AlgorithmType = "ratchet"
 )
 
 // ParseAlgorithmType takes a string and returns an enum if one matches,
-// otherwise returns the None AlgorithmType enum.
+// otherwise returns the None AlgorithmType enum.  Matching ignores case and
+// surrounding whitespace.
 func ParseAlgorithmType(algo string) AlgorithmType {
-	if algo == string(Box) {
+	switch normalizeName(algo) {
+	case normalizeName(string(Box)):
 		return Box
-	} else if algo == string(RSASymmetric) {
+	case normalizeName(string(BoxEphemeral)):
+		return BoxEphemeral
+	case normalizeName(string(RSASymmetric)):
 		return RSASymmetric
-	} else if algo == string(RSAAsymmetric) {
+	case normalizeName(string(RSAAsymmetric)):
 		return RSAAsymmetric
+	case normalizeName(string(Ed25519Sign)):
+		return Ed25519Sign
+	case normalizeName(string(RSAPSS)):
+		return RSAPSS
+	case normalizeName(string(ECDSA)):
+		return ECDSA
+	}
+	if alg, ok := algorithmAliases[normalizeName(algo)]; ok {
+		return alg
 	}
 	return None
 }
+
+// algorithmAliases are the longer names the RSA algorithms are also known
+// by, keyed by their normalized name.
+var algorithmAliases = map[string]AlgorithmType{
+	normalizeName("rsa-symmetric"):  RSASymmetric,
+	normalizeName("rsa-asymmetric"): RSAAsymmetric,
+}
+
+// ParseAlgorithm returns the built in or registered algorithm matching algo,
+// ignoring case, whitespace, dashes and underscores.  rsa-symmetric and
+// rsa-asymmetric are accepted for the RSA algorithms.  Unlike
+// ParseAlgorithmType it fails with ErrUnknownAlgorithm instead of falling
+// back to None, so a typo doesn't quietly turn encryption off.
+func ParseAlgorithm(algo string) (AlgorithmType, error) {
+	if alg, ok := lookupAlgorithmType(algo); ok {
+		return alg, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownAlgorithm, algo)
+}
+
+// canonicalAlgorithmType returns the built in or registered algorithm
+// matching algo regardless of case, or algo unchanged if there isn't one.
+func canonicalAlgorithmType(algo string) AlgorithmType {
+	if alg, ok := lookupAlgorithmType(algo); ok {
+		return alg
+	}
+	return AlgorithmType(strings.TrimSpace(algo))
+}
+
+// lookupAlgorithmType returns the built in or registered algorithm matching
+// algo regardless of case, and whether there is one.
+func lookupAlgorithmType(algo string) (AlgorithmType, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	return findAlgorithm(AlgorithmType(algo))
+}
+
+// findAlgorithm is lookupAlgorithmType for callers that hold registryLock.
+func findAlgorithm(alg AlgorithmType) (AlgorithmType, bool) {
+	name := normalizeName(string(alg))
+	if name == "" {
+		return "", false
+	}
+	if alias, ok := algorithmAliases[name]; ok {
+		return alias, true
+	}
+	for _, signer := range []AlgorithmType{Ed25519Sign, RSAPSS, ECDSA} {
+		if normalizeName(string(signer)) == name {
+			return signer, true
+		}
+	}
+	for registered := range encrypterFactories {
+		if normalizeName(string(registered)) == name {
+			return registered, true
+		}
+	}
+	for registered := range decrypterFactories {
+		if normalizeName(string(registered)) == name {
+			return registered, true
+		}
+	}
+	return "", false
+}
+
+// String returns the algorithm name, as used in configuration files.
+func (a AlgorithmType) String() string {
+	return string(a)
+}
+
+// MarshalText returns the algorithm name.
+func (a AlgorithmType) MarshalText() ([]byte, error) {
+	return []byte(a), nil
+}
+
+// UnmarshalText sets the algorithm, matching the built in and registered
+// algorithms regardless of case so configuration files can be written either
+// way.  Other names are kept as written and resolved through the registry
+// when the config is loaded, so a custom algorithm may be registered after
+// its config is decoded; names that could never be registered are an error.
+// An empty value leaves the algorithm unset for Config.Validate to report.
+func (a *AlgorithmType) UnmarshalText(text []byte) error {
+	name := strings.TrimSpace(string(text))
+	if name == "" {
+		*a = ""
+		return nil
+	}
+	if !validName(name) {
+		return fmt.Errorf("%w: invalid name %q", ErrUnknownAlgorithm, name)
+	}
+	*a = canonicalAlgorithmType(name)
+	return nil
+}
+
+// normalizeName lowercases a name and drops whitespace, dashes and
+// underscores so rsa-sym, RSA_SYM and "Rsa Sym" all compare equal.
+func normalizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', '_', ' ', '\t':
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, strings.TrimSpace(name))
+}
+
+// validName reports whether name can be used for a custom algorithm or key
+// type: letters, digits, dashes, underscores and dots.
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
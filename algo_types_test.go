@@ -0,0 +1,124 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAlgorithm(t *testing.T) {
+	require.Nil(t, RegisterEncrypterLoader("test-parse-algorithm", func(ctx context.Context, config *Config) (Encrypt, error) {
+		return &reverser{kid: config.KID}, nil
+	}))
+
+	testData := []struct {
+		input    string
+		expected AlgorithmType
+		err      bool
+	}{
+		{"none", None, false},
+		{" BOX ", Box, false},
+		{"rsa_sym", RSASymmetric, false},
+		{"RSA-Asymmetric", RSAAsymmetric, false},
+		{"rsa symmetric", RSASymmetric, false},
+		{"Ed25519-Sign", Ed25519Sign, false},
+		{"ecdsa", ECDSA, false},
+		{"Test_Parse_Algorithm", "test-parse-algorithm", false},
+		{"rot13", "", true},
+		{"", "", true},
+		{"  ", "", true},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.input, func(t *testing.T) {
+			assert := assert.New(t)
+
+			alg, err := ParseAlgorithm(tc.input)
+			if tc.err {
+				assert.True(errors.Is(err, ErrUnknownAlgorithm))
+				return
+			}
+			assert.Nil(err)
+			assert.Equal(tc.expected, alg)
+		})
+	}
+}
+
+func TestAlgorithmTypeText(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	assert.Equal("rsa-asy", RSAAsymmetric.String())
+	assert.Equal(RSAAsymmetric, ParseAlgorithmType("rsa-asymmetric"))
+
+	var config struct {
+		Type AlgorithmType `json:"type"`
+	}
+	require.Nil(json.Unmarshal([]byte(`{"type": "RSA-Asymmetric"}`), &config))
+	assert.Equal(RSAAsymmetric, config.Type)
+
+	require.Nil(json.Unmarshal([]byte(`{"type": ""}`), &config))
+	assert.Equal(AlgorithmType(""), config.Type)
+
+	err := json.Unmarshal([]byte(`{"type": "rsa/asy"}`), &config)
+	assert.True(errors.Is(err, ErrUnknownAlgorithm))
+
+	data, err := json.Marshal(map[string]AlgorithmType{"type": Ed25519Sign})
+	require.Nil(err)
+	assert.Equal(`{"type":"ed25519-sign"}`, string(data))
+}
+
+func TestKeyTypeText(t *testing.T) {
+	testData := []struct {
+		input    string
+		expected KeyType
+		err      bool
+	}{
+		{"senderPrivateKey", SenderPrivateKey, false},
+		{"RECIPIENT_PUBLIC_KEY", RecipientPublicKey, false},
+		{"custom.key-1", KeyType("custom.key-1"), false},
+		{"", "", true},
+		{"bad key", "", true},
+		{"key/../path", "", true},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.input, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var keyType KeyType
+			err := keyType.UnmarshalText([]byte(tc.input))
+			if tc.err {
+				assert.NotNil(err)
+				return
+			}
+			assert.Nil(err)
+			assert.Equal(tc.expected, keyType)
+			assert.Equal(string(tc.expected), keyType.String())
+		})
+	}
+
+	var keys map[KeyType]string
+	assert.NotNil(t, json.Unmarshal([]byte(`{"sender private key!": "a.pem"}`), &keys))
+}
@@ -0,0 +1,146 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import "golang.org/x/crypto/nacl/box"
+
+// AppendEncrypt is an Encrypt that can append the ciphertext to a buffer the
+// caller provides, so a hot path can reuse buffers instead of allocating one
+// per message.
+type AppendEncrypt interface {
+	Encrypt
+
+	// EncryptMessageTo appends the encrypted message to dst and returns the
+	// updated slice.  dst and message must not overlap.
+	EncryptMessageTo(dst []byte, message []byte) (crypt []byte, nonce []byte, err error)
+}
+
+// AppendDecrypt is a Decrypt that can append the message to a buffer the
+// caller provides.
+type AppendDecrypt interface {
+	Decrypt
+
+	// DecryptMessageTo appends the decrypted message to dst and returns the
+	// updated slice.  dst and cipher must not overlap.
+	DecryptMessageTo(dst []byte, cipher []byte, nonce []byte) (message []byte, err error)
+}
+
+// EncryptMessageTo appends the encrypted message to dst, without an extra
+// allocation when the encrypter is an AppendEncrypt.
+func EncryptMessageTo(encrypter Encrypt, dst []byte, message []byte) ([]byte, []byte, error) {
+	if e, ok := encrypter.(AppendEncrypt); ok {
+		return e.EncryptMessageTo(dst, message)
+	}
+	crypt, nonce, err := encrypter.EncryptMessage(message)
+	if err != nil {
+		return dst, nil, err
+	}
+	return append(dst, crypt...), nonce, nil
+}
+
+// DecryptMessageTo appends the decrypted message to dst, without an extra
+// allocation when the decrypter is an AppendDecrypt.
+func DecryptMessageTo(decrypter Decrypt, dst []byte, cipher []byte, nonce []byte) ([]byte, error) {
+	if d, ok := decrypter.(AppendDecrypt); ok {
+		return d.DecryptMessageTo(dst, cipher, nonce)
+	}
+	message, err := decrypter.DecryptMessage(cipher, nonce)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, message...), nil
+}
+
+// EncryptMessageTo appends the message to dst.
+func (*NOOP) EncryptMessageTo(dst []byte, message []byte) ([]byte, []byte, error) {
+	return append(dst, message...), []byte{}, nil
+}
+
+// DecryptMessageTo appends the cipher to dst.
+func (*NOOP) DecryptMessageTo(dst []byte, cipher []byte, nonce []byte) ([]byte, error) {
+	return append(dst, cipher...), nil
+}
+
+// EncryptMessageTo seals the message with the box algorithm, appending it to
+// dst.
+func (enBox *encryptBox) EncryptMessageTo(dst []byte, message []byte) ([]byte, []byte, error) {
+	enBox.lock.RLock()
+	defer enBox.lock.RUnlock()
+	if enBox.sharedEncryptKey == nil {
+		return dst, nil, errCipherClosed
+	}
+	nonce := new([24]byte)
+	if err := enBox.nonceSource().NextNonce(nonce[:]); err != nil {
+		return dst, nil, err
+	}
+	return box.SealAfterPrecomputation(dst, message, nonce, enBox.sharedEncryptKey), nonce[:], nil
+}
+
+// DecryptMessageTo opens the message with the box algorithm, appending it to
+// dst.
+func (deBox *decryptBox) DecryptMessageTo(dst []byte, cipher []byte, nonce []byte) ([]byte, error) {
+	deBox.lock.RLock()
+	defer deBox.lock.RUnlock()
+	if deBox.sharedDecryptKey == nil {
+		return dst, errCipherClosed
+	}
+	var decryptNonce [24]byte
+	if err := checkNonceSize(nonce, len(decryptNonce)); err != nil {
+		return dst, err
+	}
+	copy(decryptNonce[:], nonce)
+
+	decrypted, ok := box.OpenAfterPrecomputation(dst, cipher, &decryptNonce, deBox.sharedDecryptKey)
+	if !ok {
+		return dst, ErrDecryptFailed
+	}
+	return decrypted, nil
+}
+
+// EncryptMessageTo seals the message with AES-GCM, appending it to dst.
+func (c *aesGCMCipher) EncryptMessageTo(dst []byte, message []byte) ([]byte, []byte, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.aead == nil {
+		return dst, nil, errCipherClosed
+	}
+	nonce := make([]byte, aesGCMNonceSize)
+	if c.nonceKey != nil {
+		copy(nonce, c.syntheticNonce(message, nil))
+	} else if err := c.nonces.NextNonce(nonce); err != nil {
+		return dst, nil, err
+	}
+	return c.aead.Seal(dst, nonce, message, nil), nonce, nil
+}
+
+// DecryptMessageTo opens the message with AES-GCM, appending it to dst.
+func (c *aesGCMCipher) DecryptMessageTo(dst []byte, cipher []byte, nonce []byte) ([]byte, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.aead == nil {
+		return dst, errCipherClosed
+	}
+	if err := checkNonceSize(nonce, aesGCMNonceSize); err != nil {
+		return dst, err
+	}
+	message, err := c.aead.Open(dst, nonce, cipher, nil)
+	if err != nil {
+		return dst, ErrDecryptFailed
+	}
+	return message, nil
+}
@@ -0,0 +1,105 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendCipher(t *testing.T) {
+	boxEncrypter, boxDecrypter := loadBoxPair(t)
+	aesEncrypter, aesDecrypter := aesGCMPair(t)
+	privateKey := GeneratePrivateKey(2048)
+
+	testData := []struct {
+		description string
+		encrypter   Encrypt
+		decrypter   Decrypt
+	}{
+		{"none", DefaultCipherEncrypter(), DefaultCipherDecrypter()},
+		{"box", boxEncrypter, boxDecrypter},
+		{"aes-gcm", aesEncrypter, aesDecrypter},
+		{"rsa", NewRSAEncrypter(DefaultRSAHash, nil, &privateKey.PublicKey, ""), NewRSADecrypter(DefaultRSAHash, privateKey, nil, "")},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			prefix := []byte("prefix:")
+			crypt, nonce, err := EncryptMessageTo(tc.encrypter, append([]byte{}, prefix...), []byte("hello"))
+			require.Nil(err)
+			require.True(bytes.HasPrefix(crypt, prefix))
+
+			message, err := DecryptMessageTo(tc.decrypter, append([]byte{}, prefix...), crypt[len(prefix):], nonce)
+			require.Nil(err)
+			assert.Equal([]byte("prefix:hello"), message)
+
+			// the results of the append and plain forms are interchangeable
+			message, err = tc.decrypter.DecryptMessage(crypt[len(prefix):], nonce)
+			require.Nil(err)
+			assert.Equal([]byte("hello"), message)
+		})
+	}
+}
+
+func TestAppendCipherErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, decrypter := loadBoxPair(t)
+	dst := []byte("dst")
+	result, err := DecryptMessageTo(decrypter, dst, []byte("garbage"), make([]byte, 24))
+	assert.NotNil(err)
+	assert.Equal(dst, result)
+
+	result, err = DecryptMessageTo(decrypter, dst, []byte("garbage"), []byte("short"))
+	assert.NotNil(err)
+	assert.Equal(dst, result)
+}
+
+func TestAppendCipherAllocations(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := loadBoxPair(t)
+	message := bytes.Repeat([]byte("m"), 512)
+	crypt := make([]byte, 0, 1024)
+	plain := make([]byte, 0, 1024)
+
+	var nonce []byte
+	encryptAllocs := testing.AllocsPerRun(100, func() {
+		var err error
+		crypt, nonce, err = EncryptMessageTo(encrypter, crypt[:0], message)
+		require.Nil(err)
+	})
+	decryptAllocs := testing.AllocsPerRun(100, func() {
+		var err error
+		plain, err = DecryptMessageTo(decrypter, plain[:0], crypt, nonce)
+		require.Nil(err)
+	})
+
+	// only the nonce is allocated
+	assert.Equal(float64(1), encryptAllocs)
+	assert.Equal(float64(0), decryptAllocs)
+	assert.Equal(message, plain)
+}
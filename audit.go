@@ -0,0 +1,185 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// AuditEvent records one use of a key.  It never holds the message, only
+// who used which key and whether it worked.
+type AuditEvent struct {
+	// Time is when the operation finished.
+	Time time.Time
+
+	// Operation is what was done, like "decrypt".
+	Operation string
+
+	// Algorithm and KID identify the key used.
+	Algorithm AlgorithmType
+	KID       string
+
+	// Principal is who asked for the operation, as set on the context with
+	// WithAuditPrincipal.  It's empty when the caller didn't pass a context
+	// or the context has no principal.
+	Principal string
+
+	// Size is the size in bytes of the cipher.
+	Size int
+
+	// Success is whether the operation worked.
+	Success bool
+
+	// Reason is why the operation failed, one of the Reason constants of
+	// CipherMetrics.Failures.
+	Reason string
+}
+
+// AuditSink receives the events of audited ciphers.  Audit is called
+// synchronously on the goroutine of the operation, so a slow sink should
+// queue events itself.
+type AuditSink interface {
+	Audit(AuditEvent)
+}
+
+// AuditSinkFunc is a function that is an AuditSink.
+type AuditSinkFunc func(AuditEvent)
+
+// Audit calls the function.
+func (f AuditSinkFunc) Audit(event AuditEvent) {
+	f(event)
+}
+
+// NewLoggerAuditSink returns an AuditSink that writes every event to the
+// Logger as a structured info log line, and failures as errors.
+func NewLoggerAuditSink(logger Logger) AuditSink {
+	if logger == nil {
+		logger = DefaultLogger()
+	}
+	return AuditSinkFunc(func(event AuditEvent) {
+		keyvals := []interface{}{
+			"time", event.Time.UTC().Format(time.RFC3339Nano),
+			"operation", event.Operation,
+			"algorithm", string(event.Algorithm),
+			"kid", event.KID,
+			"principal", event.Principal,
+			"size", event.Size,
+			"success", event.Success,
+		}
+		if event.Success {
+			logInfo(logger, "key used", keyvals...)
+			return
+		}
+		logError(logger, "key used", append(keyvals, "reason", event.Reason)...)
+	})
+}
+
+type auditPrincipalKey struct{}
+
+// WithAuditPrincipal returns a context that names who is asking for the
+// operations done with it, for the events of audited ciphers.
+func WithAuditPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, auditPrincipalKey{}, principal)
+}
+
+// AuditPrincipal returns the principal set on the context with
+// WithAuditPrincipal, or an empty string if none was.
+func AuditPrincipal(ctx context.Context) string {
+	principal, _ := ctx.Value(auditPrincipalKey{}).(string)
+	return principal
+}
+
+// AuditedDecrypt returns a Decrypt that sends an AuditEvent to the sink for
+// every message the decrypter decrypts, whether it succeeds or not.  Pass the
+// principal with WithAuditPrincipal and DecryptMessageContext; the other
+// methods audit an empty principal.  Associated data, contexts, metadata and
+// CloseCipher are passed through.
+func AuditedDecrypt(decrypter Decrypt, sink AuditSink) (Decrypt, error) {
+	if decrypter == nil {
+		return nil, errors.New("no decrypter")
+	}
+	if sink == nil {
+		return nil, errors.New("no audit sink")
+	}
+	return &auditedDecrypter{decrypter: decrypter, sink: sink}, nil
+}
+
+type auditedDecrypter struct {
+	decrypter Decrypt
+	sink      AuditSink
+}
+
+func (d *auditedDecrypter) audit(ctx context.Context, cipher []byte, err error) {
+	event := AuditEvent{
+		Time:      time.Now(),
+		Operation: decryptOperation,
+		Algorithm: d.decrypter.GetAlgorithm(),
+		KID:       d.decrypter.GetKID(),
+		Principal: AuditPrincipal(ctx),
+		Size:      len(cipher),
+		Success:   err == nil,
+	}
+	if err != nil {
+		event.Reason = errorReason(err)
+	}
+	d.sink.Audit(event)
+}
+
+// GetAlgorithm returns the algorithm of the decrypter.
+func (d *auditedDecrypter) GetAlgorithm() AlgorithmType {
+	return d.decrypter.GetAlgorithm()
+}
+
+// GetKID returns the KID of the decrypter.
+func (d *auditedDecrypter) GetKID() string {
+	return d.decrypter.GetKID()
+}
+
+// DecryptMessage decrypts the message and audits it without a principal.
+func (d *auditedDecrypter) DecryptMessage(cipher []byte, nonce []byte) ([]byte, error) {
+	return d.DecryptMessageContext(context.Background(), cipher, nonce)
+}
+
+// DecryptMessageContext decrypts the message and audits it with the
+// principal of the context.
+func (d *auditedDecrypter) DecryptMessageContext(ctx context.Context, cipher []byte, nonce []byte) ([]byte, error) {
+	message, err := DecryptMessageContext(ctx, d.decrypter, cipher, nonce)
+	d.audit(ctx, cipher, err)
+	return message, err
+}
+
+// DecryptMessageWithAD decrypts the message with associated data and audits
+// it without a principal.
+func (d *auditedDecrypter) DecryptMessageWithAD(cipher []byte, nonce []byte, ad []byte) ([]byte, error) {
+	message, err := DecryptMessageWithAD(d.decrypter, cipher, nonce, ad)
+	d.audit(context.Background(), cipher, err)
+	return message, err
+}
+
+// Metadata returns the metadata of the decrypter, if it has any.
+func (d *auditedDecrypter) Metadata() Metadata {
+	m, _ := GetMetadata(d.decrypter)
+	return m
+}
+
+// Close closes the decrypter.
+func (d *auditedDecrypter) Close() error {
+	return CloseCipher(d.decrypter)
+}
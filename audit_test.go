@@ -0,0 +1,108 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditedDecrypt(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var events []AuditEvent
+	sink := AuditSinkFunc(func(event AuditEvent) {
+		events = append(events, event)
+	})
+
+	encrypter, aesDecrypter := aesGCMPair(t)
+	decrypter, err := AuditedDecrypt(aesDecrypter, sink)
+	require.Nil(err)
+	assert.Equal(AESGCM, decrypter.GetAlgorithm())
+	assert.Equal("k1", decrypter.GetKID())
+
+	cipher, nonce, err := encrypter.EncryptMessage([]byte("secret"))
+	require.Nil(err)
+
+	ctx := WithAuditPrincipal(context.Background(), "svc-a")
+	assert.Equal("svc-a", AuditPrincipal(ctx))
+	_, err = DecryptMessageContext(ctx, decrypter, cipher, nonce)
+	require.Nil(err)
+	_, err = DecryptMessageWithAD(decrypter, cipher, nonce, []byte("ad"))
+	assert.NotNil(err)
+
+	require.Len(events, 2)
+	assert.Equal(decryptOperation, events[0].Operation)
+	assert.Equal(AESGCM, events[0].Algorithm)
+	assert.Equal("k1", events[0].KID)
+	assert.Equal("svc-a", events[0].Principal)
+	assert.Equal(len(cipher), events[0].Size)
+	assert.True(events[0].Success)
+	assert.Empty(events[0].Reason)
+	assert.False(events[0].Time.IsZero())
+	assert.Equal("", events[1].Principal)
+	assert.False(events[1].Success)
+	assert.Equal(ReasonDecryptFailed, events[1].Reason)
+
+	_, err = AuditedDecrypt(nil, sink)
+	assert.NotNil(err)
+	_, err = AuditedDecrypt(aesDecrypter, nil)
+	assert.NotNil(err)
+}
+
+func TestLoggerAuditSink(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var buffer bytes.Buffer
+	encrypter, aesDecrypter := aesGCMPair(t)
+	decrypter, err := AuditedDecrypt(aesDecrypter, NewLoggerAuditSink(log.NewLogfmtLogger(&buffer)))
+	require.Nil(err)
+
+	cipher, nonce, err := encrypter.EncryptMessage([]byte("secret"))
+	require.Nil(err)
+	_, err = DecryptMessageContext(WithAuditPrincipal(context.Background(), "svc-a"), decrypter, cipher, nonce)
+	require.Nil(err)
+	_, err = decrypter.DecryptMessage(cipher, nonce[1:])
+	assert.NotNil(err)
+
+	assert.Contains(buffer.String(), "principal=svc-a")
+	assert.Contains(buffer.String(), "kid=k1")
+	assert.Contains(buffer.String(), "success=true")
+	assert.Contains(buffer.String(), "success=false")
+	assert.NotContains(buffer.String(), "secret")
+
+	assert.NotNil(NewLoggerAuditSink(nil))
+}
+
+// aesGCMPair returns an AES-GCM encrypter and decrypter with the KID
+// k1.
+func aesGCMPair(t testing.TB) (Encrypt, Decrypt) {
+	key := make([]byte, 32)
+	encrypter, err := NewAESGCMEncrypt(key, WithKID("k1"))
+	require.Nil(t, err)
+	decrypter, err := NewAESGCMDecrypt(key, WithKID("k1"))
+	require.Nil(t, err)
+	return encrypter, decrypter
+}
@@ -0,0 +1,153 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// EncryptedMessage is a ciphertext and the nonce needed to decrypt it.
+type EncryptedMessage struct {
+	Cipher []byte
+	Nonce  []byte
+}
+
+// EncryptResult is the outcome of encrypting one message of a batch.
+type EncryptResult struct {
+	EncryptedMessage
+	Err error
+}
+
+// DecryptResult is the outcome of decrypting one message of a batch.
+type DecryptResult struct {
+	Message []byte
+	Err     error
+}
+
+// EncryptBatch encrypts the messages using up to workers goroutines and
+// returns a result for each, in the same order.  A failed message doesn't
+// stop the others.  Messages not started before the context is done fail
+// with its error.  If workers isn't positive runtime.GOMAXPROCS(0) is used.
+func EncryptBatch(ctx context.Context, encrypter Encrypt, messages [][]byte, workers int) []EncryptResult {
+	results := make([]EncryptResult, len(messages))
+	runBatch(ctx, len(messages), workers, func(i int) {
+		results[i].Cipher, results[i].Nonce, results[i].Err = EncryptMessageContext(ctx, encrypter, messages[i])
+	})
+	return results
+}
+
+// DecryptBatch decrypts the messages using up to workers goroutines and
+// returns a result for each, in the same order.  A failed message doesn't
+// stop the others.  Messages not started before the context is done fail
+// with its error.  If workers isn't positive runtime.GOMAXPROCS(0) is used.
+func DecryptBatch(ctx context.Context, decrypter Decrypt, messages []EncryptedMessage, workers int) []DecryptResult {
+	results := make([]DecryptResult, len(messages))
+	runBatch(ctx, len(messages), workers, func(i int) {
+		results[i].Message, results[i].Err = DecryptMessageContext(ctx, decrypter, messages[i].Cipher, messages[i].Nonce)
+	})
+	return results
+}
+
+// TaggedMessage is an encrypted message tagged with the algorithm and KID of
+// the cipher that encrypted it, the way codex stores its records.
+type TaggedMessage struct {
+	Algorithm AlgorithmType
+	KID       string
+	EncryptedMessage
+}
+
+// DecryptBatch decrypts messages encrypted by many ciphers using up to
+// workers goroutines, routing each to the decrypter of its algorithm and KID,
+// and returns a result for each, in the same order.  Each algorithm and KID
+// is routed once per batch, so a KID the router doesn't know is only passed
+// to its UnknownKIDFunc once however many messages use it.  A failed message
+// doesn't stop the others.  Messages not started before the context is done
+// fail with its error.  If workers isn't positive runtime.GOMAXPROCS(0) is
+// used.
+func (r *Router) DecryptBatch(ctx context.Context, messages []TaggedMessage, workers int) []DecryptResult {
+	type route struct {
+		once      sync.Once
+		decrypter Decrypt
+		err       error
+	}
+	var (
+		lock   sync.Mutex
+		routes = map[[2]string]*route{}
+	)
+	getRoute := func(alg AlgorithmType, kid string) (Decrypt, error) {
+		key := [2]string{string(alg), kid}
+		lock.Lock()
+		rt, ok := routes[key]
+		if !ok {
+			rt = new(route)
+			routes[key] = rt
+		}
+		lock.Unlock()
+
+		rt.once.Do(func() {
+			rt.decrypter, rt.err = r.Route(alg, kid)
+		})
+		return rt.decrypter, rt.err
+	}
+
+	results := make([]DecryptResult, len(messages))
+	runBatch(ctx, len(messages), workers, func(i int) {
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			return
+		}
+		message := messages[i]
+		decrypter, err := getRoute(message.Algorithm, message.KID)
+		if err != nil {
+			results[i].Err = err
+			return
+		}
+		results[i].Message, results[i].Err = DecryptMessageContext(ctx, decrypter, message.Cipher, message.Nonce)
+	})
+	return results
+}
+
+// runBatch calls process for every index from 0 to n on a pool of workers.
+// process is responsible for checking the context.
+func runBatch(ctx context.Context, n int, workers int, process func(int)) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > n {
+		workers = n
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				process(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
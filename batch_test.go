@@ -0,0 +1,144 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch(t *testing.T) {
+	encrypter, decrypter := loadBoxPair(t)
+
+	for _, workers := range []int{0, 1, 4, 1000} {
+		t.Run(fmt.Sprintf("workers %d", workers), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			messages := make([][]byte, 200)
+			for i := range messages {
+				messages[i] = []byte(fmt.Sprintf("message %d", i))
+			}
+
+			encrypted := EncryptBatch(context.Background(), encrypter, messages, workers)
+			require.Len(encrypted, len(messages))
+
+			batch := make([]EncryptedMessage, len(encrypted))
+			for i, result := range encrypted {
+				require.Nil(result.Err)
+				batch[i] = result.EncryptedMessage
+			}
+			// one bad message doesn't spoil the batch
+			batch[7].Cipher = []byte("corrupt")
+
+			decrypted := DecryptBatch(context.Background(), decrypter, batch, workers)
+			require.Len(decrypted, len(messages))
+			for i, result := range decrypted {
+				if i == 7 {
+					assert.NotNil(result.Err)
+					continue
+				}
+				assert.Nil(result.Err)
+				assert.Equal(messages[i], result.Message)
+			}
+		})
+	}
+}
+
+func TestBatchCanceled(t *testing.T) {
+	assert := assert.New(t)
+
+	encrypter, decrypter := loadBoxPair(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, result := range EncryptBatch(ctx, encrypter, [][]byte{[]byte("a"), []byte("b")}, 2) {
+		assert.Equal(context.Canceled, result.Err)
+	}
+	for _, result := range DecryptBatch(ctx, decrypter, []EncryptedMessage{{}, {}}, 2) {
+		assert.Equal(context.Canceled, result.Err)
+	}
+
+	assert.Empty(EncryptBatch(context.Background(), encrypter, nil, 0))
+	assert.Empty(DecryptBatch(context.Background(), decrypter, nil, 0))
+}
+
+func TestRouterDecryptBatch(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	boxEncrypter, boxDecrypter := loadBoxPair(t)
+	gcmEncrypter, gcmDecrypter := aesGCMPair(t)
+
+	var unknown int32
+	router := NewRouter(func(alg AlgorithmType, kid string) (Decrypt, error) {
+		atomic.AddInt32(&unknown, 1)
+		if alg == AESGCM {
+			return gcmDecrypter, nil
+		}
+		return nil, nil
+	})
+	require.Nil(router.Register(boxDecrypter))
+
+	messages := make([]TaggedMessage, 100)
+	for i := range messages {
+		encrypter := boxEncrypter
+		if i%2 == 1 {
+			encrypter = gcmEncrypter
+		}
+		cipher, nonce, err := encrypter.EncryptMessage([]byte(fmt.Sprintf("record %d", i)))
+		require.Nil(err)
+		messages[i] = TaggedMessage{
+			Algorithm:        encrypter.GetAlgorithm(),
+			KID:              encrypter.GetKID(),
+			EncryptedMessage: EncryptedMessage{Cipher: cipher, Nonce: nonce},
+		}
+	}
+	messages[10].KID = "missing"
+	messages[12].KID = "missing"
+	messages[20].Cipher = []byte("corrupt")
+
+	results := router.DecryptBatch(context.Background(), messages, 8)
+	require.Len(results, len(messages))
+	for i, result := range results {
+		switch i {
+		case 10, 12:
+			assert.ErrorIs(result.Err, ErrKeyNotFound)
+		case 20:
+			assert.NotNil(result.Err)
+		default:
+			if assert.Nil(result.Err, i) {
+				assert.Equal(fmt.Sprintf("record %d", i), string(result.Message))
+			}
+		}
+	}
+	// once for the aes-gcm kid and once for the missing kid
+	assert.Equal(int32(2), atomic.LoadInt32(&unknown))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, result := range router.DecryptBatch(ctx, messages[:2], 2) {
+		assert.Equal(context.Canceled, result.Err)
+	}
+	assert.Empty(router.DecryptBatch(context.Background(), nil, 0))
+}
@@ -0,0 +1,149 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// benchmarkSizes are the payload sizes every algorithm is benchmarked with.
+var benchmarkSizes = []int{64, 1024, 16 * 1024, 256 * 1024}
+
+type benchmarkCipher struct {
+	name      string
+	encrypter Encrypt
+	decrypter Decrypt
+}
+
+// benchmarkCiphers returns a cipher pair of every algorithm.  RSA is hybrid
+// so it can encrypt every size.
+func benchmarkCiphers(tb testing.TB) []benchmarkCipher {
+	require := require.New(tb)
+
+	boxEncrypter, boxDecrypter := loadBoxPair(tb)
+	gcmEncrypter, gcmDecrypter := aesGCMPair(tb)
+
+	publicKey, privateKey, err := GenerateBoxKeyPair()
+	require.Nil(err)
+	ephemeralEncrypter, err := NewBoxEphemeralEncrypt(*publicKey)
+	require.Nil(err)
+	ephemeralDecrypter, err := NewBoxEphemeralDecrypt(*privateKey)
+	require.Nil(err)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(err)
+	rsaEncrypter, err := NewRSAEncrypt(&rsaKey.PublicKey, WithHybrid())
+	require.Nil(err)
+	rsaDecrypter, err := NewRSADecrypt(rsaKey)
+	require.Nil(err)
+	signedEncrypter, err := NewRSAEncrypt(&rsaKey.PublicKey, WithHybrid(), WithSigningKey(rsaKey))
+	require.Nil(err)
+	signedDecrypter, err := NewRSADecrypt(rsaKey, WithVerifyKey(&rsaKey.PublicKey))
+	require.Nil(err)
+
+	return []benchmarkCipher{
+		{string(None), DefaultCipherEncrypter(), DefaultCipherDecrypter()},
+		{string(Box), boxEncrypter, boxDecrypter},
+		{string(BoxEphemeral), ephemeralEncrypter, ephemeralDecrypter},
+		{string(AESGCM), gcmEncrypter, gcmDecrypter},
+		{string(RSASymmetric), rsaEncrypter, rsaDecrypter},
+		{string(RSAAsymmetric), signedEncrypter, signedDecrypter},
+	}
+}
+
+func BenchmarkEncryptMessage(b *testing.B) {
+	for _, c := range benchmarkCiphers(b) {
+		for _, size := range benchmarkSizes {
+			b.Run(fmt.Sprintf("%s/%d", c.name, size), func(b *testing.B) {
+				message := make([]byte, size)
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, _, err := c.encrypter.EncryptMessage(message); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkDecryptMessage(b *testing.B) {
+	for _, c := range benchmarkCiphers(b) {
+		for _, size := range benchmarkSizes {
+			b.Run(fmt.Sprintf("%s/%d", c.name, size), func(b *testing.B) {
+				cipher, nonce, err := c.encrypter.EncryptMessage(make([]byte, size))
+				require.Nil(b, err)
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := c.decrypter.DecryptMessage(cipher, nonce); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// allocationBudget is the most EncryptMessage and DecryptMessage of each
+// algorithm may allocate for one message of any size, as documented in the
+// README.  The RSA and ephemeral box budgets leave room for the allocations
+// of crypto/rsa and curve25519, which change between Go releases.
+var allocationBudget = map[string][2]float64{
+	string(None):          {0, 0},
+	string(Box):           {1, 1},
+	string(BoxEphemeral):  {16, 12},
+	string(AESGCM):        {1, 1},
+	string(RSASymmetric):  {24, 12},
+	string(RSAAsymmetric): {32, 28},
+}
+
+func TestAllocationBudget(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector changes what is allocated")
+	}
+
+	for _, c := range benchmarkCiphers(t) {
+		for _, size := range benchmarkSizes {
+			t.Run(fmt.Sprintf("%s/%d", c.name, size), func(t *testing.T) {
+				message := make([]byte, size)
+				cipher, nonce, err := c.encrypter.EncryptMessage(message)
+				require.Nil(t, err)
+
+				budget := allocationBudget[c.name]
+				encryptAllocs := testing.AllocsPerRun(20, func() {
+					c.encrypter.EncryptMessage(message)
+				})
+				decryptAllocs := testing.AllocsPerRun(20, func() {
+					c.decrypter.DecryptMessage(cipher, nonce)
+				})
+				assert.LessOrEqual(t, encryptAllocs, budget[0], "EncryptMessage")
+				assert.LessOrEqual(t, decryptAllocs, budget[1], "DecryptMessage")
+			})
+		}
+	}
+}
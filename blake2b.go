@@ -0,0 +1,55 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto"
+	"hash"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// LegacyBLAKE2bKey is the key BLAKE2b-512 used to be registered with.  Pass
+// it to RegisterBLAKE2b to keep working with data hashed or signed by older
+// versions.
+const LegacyBLAKE2bKey = "73 is the best number"
+
+// RegisterBLAKE2b registers crypto.BLAKE2b_512 as BLAKE2b-512 keyed with the
+// key, which can be at most 64 bytes.  An empty key registers standard
+// unkeyed BLAKE2b-512, which is what is used until RegisterBLAKE2b is called.
+// The registration is global, so call it at startup before any cipher is
+// used; every side must use the same key.
+func RegisterBLAKE2b(key []byte) error {
+	if len(key) == 0 {
+		key = nil
+	}
+	if _, err := blake2b.New512(key); err != nil {
+		return err
+	}
+	key = append([]byte(nil), key...)
+	crypto.RegisterHash(crypto.BLAKE2b_512, func() hash.Hash {
+		// the key was checked above, so this can't fail
+		h, _ := blake2b.New512(key)
+		return h
+	})
+
+	// drop the hashers made with the previous key
+	for hashPools[crypto.BLAKE2b_512].Get() != nil {
+	}
+	return nil
+}
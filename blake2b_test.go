@@ -0,0 +1,83 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"crypto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestRegisterBLAKE2b(t *testing.T) {
+	message := []byte("hello world")
+	unkeyed := blake2b.Sum512(message)
+	keyed, err := blake2b.New512([]byte(LegacyBLAKE2bKey))
+	require.Nil(t, err)
+	keyed.Write(message)
+
+	testData := []struct {
+		description string
+		key         []byte
+		expected    []byte
+		expectedErr bool
+	}{
+		{"unkeyed", nil, unkeyed[:], false},
+		{"legacy key", []byte(LegacyBLAKE2bKey), keyed.Sum(nil), false},
+		{"empty key", []byte{}, unkeyed[:], false},
+		{"key too long", bytes.Repeat([]byte{1}, 65), nil, true},
+	}
+
+	defer RegisterBLAKE2b(nil)
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			// make sure a hasher of the previous key is pooled
+			digest := hashMessage(crypto.BLAKE2b_512, message)
+			putDigest(digest)
+
+			err := RegisterBLAKE2b(tc.key)
+			if tc.expectedErr {
+				assert.NotNil(err)
+				return
+			}
+			assert.Nil(err)
+
+			h := crypto.BLAKE2b_512.New()
+			h.Write(message)
+			assert.Equal(tc.expected, h.Sum(nil))
+
+			digest = hashMessage(crypto.BLAKE2b_512, message)
+			assert.Equal(tc.expected, *digest)
+			putDigest(digest)
+		})
+	}
+}
+
+func TestBLAKE2bDefaultIsUnkeyed(t *testing.T) {
+	message := []byte("hello world")
+	expected := blake2b.Sum512(message)
+
+	h := crypto.BLAKE2b_512.New()
+	h.Write(message)
+	assert.Equal(t, expected[:], h.Sum(nil))
+}
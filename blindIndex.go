@@ -0,0 +1,181 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MinBlindIndexKeySize is the smallest key a BlindIndex accepts.
+const MinBlindIndexKeySize = 16
+
+// BlindIndex computes keyed hashes of values that are stored encrypted, so
+// a column can be searched by equality without storing the plaintext: store
+// the index next to the ciphertext, and look rows up by the index of the
+// value searched for.
+//
+// The index is an HMAC-SHA256 under a key derived from the BlindIndex key
+// and a name, usually the column, so the same value has unrelated indexes in
+// different columns.  Equal values always have equal indexes, which leaks
+// which rows are equal and how often each value occurs.  Truncating the
+// index with WithIndexBits makes different values share an index, so a
+// lookup returns a bucket of candidate rows to decrypt and filter, which
+// hides the exact frequencies at the cost of extra rows.  It is safe for
+// concurrent use.
+type BlindIndex struct {
+	name      string
+	key       []byte
+	bits      int
+	normalize func([]byte) []byte
+	lock      sync.RWMutex
+}
+
+// BlindIndexOption configures a BlindIndex.
+type BlindIndexOption func(*BlindIndex) error
+
+// WithIndexBits truncates the index to the given number of bits, between 1
+// and 256.  The index is the bits rounded up to whole bytes, with the unused
+// low bits of the last byte zeroed.
+func WithIndexBits(bits int) BlindIndexOption {
+	return func(b *BlindIndex) error {
+		if bits < 1 || bits > sha256.Size*8 {
+			return fmt.Errorf("index bits must be between 1 and %d", sha256.Size*8)
+		}
+		b.bits = bits
+		return nil
+	}
+}
+
+// WithNormalizer transforms values before they are indexed, for example to
+// lowercase email addresses so a lookup doesn't depend on case.
+func WithNormalizer(normalize func([]byte) []byte) BlindIndexOption {
+	return func(b *BlindIndex) error {
+		if normalize == nil {
+			return errors.New("no normalizer")
+		}
+		b.normalize = normalize
+		return nil
+	}
+}
+
+// NewBlindIndex returns a BlindIndex for the named column.  The key must be
+// at least MinBlindIndexKeySize bytes and should not be used for anything
+// else; it is copied, and Close wipes the copy.
+func NewBlindIndex(key []byte, name string, options ...BlindIndexOption) (*BlindIndex, error) {
+	if len(key) < MinBlindIndexKeySize {
+		return nil, fmt.Errorf("blind index key must be at least %d bytes", MinBlindIndexKeySize)
+	}
+
+	// the name is hashed into the key so columns can share one key
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("voynicrypto-blind-index:"))
+	mac.Write([]byte(name))
+
+	b := &BlindIndex{
+		name: name,
+		key:  mac.Sum(nil),
+		bits: sha256.Size * 8,
+	}
+	for _, option := range options {
+		if option == nil {
+			continue
+		}
+		if err := option(b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Name returns the name the index was created with.
+func (b *BlindIndex) Name() string {
+	return b.name
+}
+
+// Bits returns the size of the index in bits.
+func (b *BlindIndex) Bits() int {
+	return b.bits
+}
+
+// Index returns the blind index of the value.
+func (b *BlindIndex) Index(value []byte) ([]byte, error) {
+	if b.normalize != nil {
+		value = b.normalize(value)
+	}
+
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.key == nil {
+		return nil, errCipherClosed
+	}
+	mac := hmac.New(sha256.New, b.key)
+	mac.Write(value)
+	index := mac.Sum(nil)[:(b.bits+7)/8]
+	if extra := len(index)*8 - b.bits; extra > 0 {
+		index[len(index)-1] &^= byte(1<<uint(extra)) - 1
+	}
+	return index, nil
+}
+
+// Match reports whether index is the blind index of the value.  The indexes
+// are compared in constant time.
+func (b *BlindIndex) Match(value []byte, index []byte) (bool, error) {
+	expected, err := b.Index(value)
+	if err != nil {
+		return false, err
+	}
+	return secretEqual(expected, index), nil
+}
+
+// IndexString returns the blind index of the value as unpadded base64url,
+// for text columns.
+func (b *BlindIndex) IndexString(value string) (string, error) {
+	index, err := b.Index([]byte(value))
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(index), nil
+}
+
+// Seal seals the message into an envelope with the encrypter and returns the
+// blind index of the message to store alongside it.
+func (b *BlindIndex) Seal(encrypter Encrypt, message []byte, options ...SealOption) (*Envelope, []byte, error) {
+	index, err := b.Index(message)
+	if err != nil {
+		return nil, nil, err
+	}
+	envelope, err := SealEnvelope(encrypter, message, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return envelope, index, nil
+}
+
+// Close wipes the key.
+func (b *BlindIndex) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	wipe(b.key)
+	b.key = nil
+	return nil
+}
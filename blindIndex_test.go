@@ -0,0 +1,127 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlindIndex(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	key := bytes.Repeat([]byte{7}, 32)
+	email, err := NewBlindIndex(key, "users.email", WithNormalizer(bytes.ToLower))
+	require.Nil(err)
+	assert.Equal("users.email", email.Name())
+	assert.Equal(256, email.Bits())
+
+	index, err := email.Index([]byte("Alice@Example.com"))
+	require.Nil(err)
+	assert.Len(index, 32)
+	same, err := email.Index([]byte("alice@example.com"))
+	require.Nil(err)
+	assert.Equal(index, same)
+	other, err := email.Index([]byte("bob@example.com"))
+	require.Nil(err)
+	assert.NotEqual(index, other)
+
+	match, err := email.Match([]byte("ALICE@example.com"), index)
+	require.Nil(err)
+	assert.True(match)
+	match, err = email.Match([]byte("alice@example.com"), other)
+	require.Nil(err)
+	assert.False(match)
+
+	// the same value has a different index in another column
+	name, err := NewBlindIndex(key, "users.name")
+	require.Nil(err)
+	nameIndex, err := name.Index([]byte("alice@example.com"))
+	require.Nil(err)
+	assert.NotEqual(index, nameIndex)
+
+	text, err := email.IndexString("alice@example.com")
+	require.Nil(err)
+	assert.Len(text, 43)
+
+	encrypter, decrypter := loadBoxPair(t)
+	envelope, sealedIndex, err := email.Seal(encrypter, []byte("alice@example.com"))
+	require.Nil(err)
+	assert.Equal(index, sealedIndex)
+	message, err := envelope.Open(decrypter)
+	require.Nil(err)
+	assert.Equal("alice@example.com", string(message))
+
+	require.Nil(email.Close())
+	_, err = email.Index([]byte("alice@example.com"))
+	assert.Equal(errCipherClosed, err)
+}
+
+func TestBlindIndexBits(t *testing.T) {
+	testData := []struct {
+		bits   int
+		length int
+		err    bool
+	}{
+		{1, 1, false},
+		{12, 2, false},
+		{16, 2, false},
+		{256, 32, false},
+		{0, 0, true},
+		{257, 0, true},
+	}
+
+	for _, tc := range testData {
+		t.Run("", func(t *testing.T) {
+			assert := assert.New(t)
+
+			b, err := NewBlindIndex(make([]byte, 16), "bits", WithIndexBits(tc.bits))
+			if tc.err {
+				assert.NotNil(err)
+				return
+			}
+			if !assert.Nil(err) {
+				return
+			}
+
+			// with few bits, many values share a bucket
+			buckets := map[string]bool{}
+			for i := 0; i < 256; i++ {
+				index, err := b.Index([]byte{byte(i)})
+				assert.Nil(err)
+				assert.Len(index, tc.length)
+				if extra := tc.length*8 - tc.bits; extra > 0 {
+					assert.Zero(index[len(index)-1] & (byte(1<<uint(extra)) - 1))
+				}
+				buckets[string(index)] = true
+			}
+			if tc.bits < 8 {
+				assert.True(len(buckets) <= 1<<uint(tc.bits))
+			}
+		})
+	}
+
+	_, err := NewBlindIndex(make([]byte, 8), "short")
+	assert.NotNil(t, err)
+	_, err = NewBlindIndex(make([]byte, 16), "nil", WithNormalizer(nil))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,257 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// encryptEphemeralBox seals every message with a new sender key pair and
+// puts the sender's public key in front of the box.  The sender's private key
+// is wiped as soon as the message is sealed, so a leaked key can't open
+// messages sent before it.
+type encryptEphemeralBox struct {
+	kid                string
+	recipientPublicKey [32]byte
+	nonces             NonceSource
+	random             io.Reader
+}
+
+// NewBoxEphemeralEncrypt returns a box encrypter that generates a new sender
+// key pair for every message, so there is no long term sending key to
+// compromise.  The recipient can't tell who sent a message, so the messages
+// are only authenticated when the channel itself is.
+func NewBoxEphemeralEncrypt(recipientPublicKey [32]byte, options ...CipherOption) (Encrypt, error) {
+	if err := checkFIPSAlgorithm(BoxEphemeral); err != nil {
+		return nil, err
+	}
+	o, err := newCipherOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptEphemeralBox{
+		kid:                o.kid,
+		recipientPublicKey: recipientPublicKey,
+		nonces:             boxNonceSource(o.nonces, o.random),
+		random:             o.random,
+	}, nil
+}
+
+// GetAlgorithm returns the algorithm type.
+func (e *encryptEphemeralBox) GetAlgorithm() AlgorithmType {
+	return BoxEphemeral
+}
+
+// GetKID returns the KID.
+func (e *encryptEphemeralBox) GetKID() string {
+	return e.kid
+}
+
+// EncryptMessage seals the message with a new sender key.  The cipher is
+// the sender's public key followed by the box.
+func (e *encryptEphemeralBox) EncryptMessage(message []byte) ([]byte, []byte, error) {
+	return e.seal(message, nil, false)
+}
+
+// EncryptMessageWithAD seals the message like EncryptMessage, under a key
+// derived from the shared key and the associated data as box does.
+func (e *encryptEphemeralBox) EncryptMessageWithAD(message []byte, ad []byte) ([]byte, []byte, error) {
+	return e.seal(message, ad, true)
+}
+
+func (e *encryptEphemeralBox) seal(message []byte, ad []byte, withAD bool) ([]byte, []byte, error) {
+	// the nonce, the sender's public key and the box share one allocation.
+	// The private key is read where the public key goes, so it's overwritten
+	// straight away, and otherwise only kept on the stack.
+	buffer := make([]byte, 24+BoxKeySize, 24+BoxKeySize+len(message)+box.Overhead)
+	var senderPublicKey, senderPrivateKey, sharedKey [32]byte
+	defer wipe(senderPrivateKey[:])
+	defer wipe(sharedKey[:])
+	if _, err := io.ReadFull(randomOrDefault(e.random), buffer[24:]); err != nil {
+		return []byte(""), []byte{}, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	copy(senderPrivateKey[:], buffer[24:])
+	curve25519.ScalarBaseMult(&senderPublicKey, &senderPrivateKey)
+	copy(buffer[24:], senderPublicKey[:])
+
+	nonces := e.nonces
+	if nonces == nil {
+		nonces = defaultNonceSource
+	}
+	if err := nonces.NextNonce(buffer[:24]); err != nil {
+		return []byte(""), []byte{}, err
+	}
+	var nonce [24]byte
+	copy(nonce[:], buffer)
+
+	box.Precompute(&sharedKey, &e.recipientPublicKey, &senderPrivateKey)
+	key := &sharedKey
+	if withAD {
+		key = boxADKey(&sharedKey, ad)
+		defer wipe(key[:])
+	}
+	encrypted := box.SealAfterPrecomputation(buffer[24:], message, &nonce, key)
+	return encrypted, buffer[:24:24], nil
+}
+
+type decryptEphemeralBox struct {
+	kid                 string
+	recipientPrivateKey [32]byte
+	recipientPublicKey  [32]byte
+	closed              bool
+	lock                sync.RWMutex
+}
+
+// NewBoxEphemeralDecrypt returns a decrypter for the messages of
+// NewBoxEphemeralEncrypt, which only needs the recipient's private key.  The
+// key is copied, and CloseCipher wipes the copy.
+func NewBoxEphemeralDecrypt(recipientPrivateKey [32]byte, options ...CipherOption) (Decrypt, error) {
+	if err := checkFIPSAlgorithm(BoxEphemeral); err != nil {
+		return nil, err
+	}
+	o, err := newCipherOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	decrypter := &decryptEphemeralBox{
+		kid:                 o.kid,
+		recipientPrivateKey: recipientPrivateKey,
+	}
+	curve25519.ScalarBaseMult(&decrypter.recipientPublicKey, &decrypter.recipientPrivateKey)
+	return decrypter, nil
+}
+
+// GetAlgorithm returns the algorithm type.
+func (d *decryptEphemeralBox) GetAlgorithm() AlgorithmType {
+	return BoxEphemeral
+}
+
+// GetKID returns the KID.
+func (d *decryptEphemeralBox) GetKID() string {
+	return d.kid
+}
+
+// DecryptMessage opens the box with the sender's public key in front of it.
+func (d *decryptEphemeralBox) DecryptMessage(cipher []byte, nonce []byte) ([]byte, error) {
+	return d.open(cipher, nonce, nil, false)
+}
+
+// DecryptMessageWithAD opens the message with the key derived from the
+// associated data, so it fails if the associated data isn't what the
+// message was sealed with.
+func (d *decryptEphemeralBox) DecryptMessageWithAD(cipher []byte, nonce []byte, ad []byte) ([]byte, error) {
+	return d.open(cipher, nonce, ad, true)
+}
+
+func (d *decryptEphemeralBox) open(cipher []byte, nonce []byte, ad []byte, withAD bool) ([]byte, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	if d.closed {
+		return []byte(""), errCipherClosed
+	}
+	var decryptNonce [24]byte
+	if err := checkNonceSize(nonce, len(decryptNonce)); err != nil {
+		return []byte(""), err
+	}
+	copy(decryptNonce[:], nonce)
+	if len(cipher) < BoxKeySize+box.Overhead {
+		return []byte(""), ErrDecryptFailed
+	}
+
+	var senderPublicKey, sharedKey [32]byte
+	defer wipe(sharedKey[:])
+	copy(senderPublicKey[:], cipher)
+	box.Precompute(&sharedKey, &senderPublicKey, &d.recipientPrivateKey)
+	key := &sharedKey
+	if withAD {
+		key = boxADKey(&sharedKey, ad)
+		defer wipe(key[:])
+	}
+	decrypted, ok := box.OpenAfterPrecomputation(nil, cipher[BoxKeySize:], &decryptNonce, key)
+	if !ok {
+		return []byte(""), ErrDecryptFailed
+	}
+	return decrypted, nil
+}
+
+// Close wipes the private key.
+func (d *decryptEphemeralBox) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.closed = true
+	wipe(d.recipientPrivateKey[:])
+	return nil
+}
+
+func boxEphemeralMetadata() Metadata {
+	return Metadata{
+		NonceSize: 24,
+		Overhead:  BoxKeySize + box.Overhead,
+	}
+}
+
+// Metadata reports the nonce size of box, and an overhead that includes the
+// sender's public key.  The messages are not authenticated, as anyone can
+// send them.
+func (e *encryptEphemeralBox) Metadata() Metadata {
+	return boxEphemeralMetadata()
+}
+
+// Metadata reports the nonce size of box, and an overhead that includes the
+// sender's public key.
+func (d *decryptEphemeralBox) Metadata() Metadata {
+	return boxEphemeralMetadata()
+}
+
+func loadBoxEphemeralEncrypt(ctx context.Context, config *Config) (Encrypt, error) {
+	if !config.hasKey(RecipientPublicKey) {
+		return nil, errIncorrectKeys
+	}
+	boxLoader := BoxLoader{PublicKey: config.keyLoader(RecipientPublicKey)}
+	publicKey, err := boxLoader.getBoxPublicKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	options := []CipherOption{WithKID(config.KID)}
+	if config.NonceSource != nil {
+		options = append(options, WithNonceSource(config.NonceSource))
+	}
+	if config.Random != nil {
+		options = append(options, WithRandom(config.Random))
+	}
+	return NewBoxEphemeralEncrypt(publicKey, options...)
+}
+
+func loadBoxEphemeralDecrypt(ctx context.Context, config *Config) (Decrypt, error) {
+	if !config.hasKey(RecipientPrivateKey) {
+		return nil, errIncorrectKeys
+	}
+	boxLoader := BoxLoader{PrivateKey: config.keyLoader(RecipientPrivateKey)}
+	privateKey, err := boxLoader.getBoxPrivateKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(privateKey[:])
+	return NewBoxEphemeralDecrypt(privateKey, WithKID(config.KID))
+}
@@ -0,0 +1,118 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoxEphemeral(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	publicKey, privateKey, err := GenerateBoxKeyPair()
+	require.Nil(err)
+
+	encrypter, err := NewBoxEphemeralEncrypt(*publicKey, WithKID("ephemeral"))
+	require.Nil(err)
+	decrypter, err := NewBoxEphemeralDecrypt(*privateKey, WithKID("ephemeral"))
+	require.Nil(err)
+	assert.Equal(BoxEphemeral, encrypter.GetAlgorithm())
+	assert.Equal("ephemeral", decrypter.GetKID())
+	testCryptoPair(t, encrypter, decrypter, false)
+
+	// every message has its own sender key
+	first, _, err := encrypter.EncryptMessage([]byte("message"))
+	require.Nil(err)
+	second, nonce, err := encrypter.EncryptMessage([]byte("message"))
+	require.Nil(err)
+	assert.NotEqual(first[:BoxKeySize], second[:BoxKeySize])
+
+	m, ok := GetMetadata(encrypter)
+	assert.True(ok)
+	assert.False(m.Authenticated)
+	assert.Len(second, m.CiphertextSize(len("message")))
+
+	// only the recipient can open the message
+	_, otherPrivateKey, err := GenerateBoxKeyPair()
+	require.Nil(err)
+	other, err := NewBoxEphemeralDecrypt(*otherPrivateKey)
+	require.Nil(err)
+	_, err = other.DecryptMessage(second, nonce)
+	assert.True(errors.Is(err, ErrDecryptFailed))
+
+	tampered := append([]byte{}, second...)
+	tampered[0] ^= 1
+	_, err = decrypter.DecryptMessage(tampered, nonce)
+	assert.True(errors.Is(err, ErrDecryptFailed))
+
+	_, err = decrypter.DecryptMessage(second[:BoxKeySize], nonce)
+	assert.True(errors.Is(err, ErrDecryptFailed))
+
+	_, err = decrypter.DecryptMessage(second, nonce[1:])
+	assert.NotNil(err)
+
+	cipher, nonce, err := EncryptMessageWithAD(encrypter, []byte("message"), []byte("header"))
+	require.Nil(err)
+	message, err := DecryptMessageWithAD(decrypter, cipher, nonce, []byte("header"))
+	require.Nil(err)
+	assert.Equal("message", string(message))
+	_, err = DecryptMessageWithAD(decrypter, cipher, nonce, []byte("other"))
+	assert.True(errors.Is(err, ErrDecryptFailed))
+	_, err = decrypter.DecryptMessage(cipher, nonce)
+	assert.True(errors.Is(err, ErrDecryptFailed), "sealed with associated data but opened without")
+
+	require.Nil(CloseCipher(decrypter))
+	_, err = decrypter.DecryptMessage(cipher, nonce)
+	assert.Equal(errCipherClosed, err)
+}
+
+func TestBoxEphemeralConfig(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	publicKey, privateKey, err := GenerateBoxKeyPair()
+	require.Nil(err)
+
+	config := Config{
+		Type:      BoxEphemeral,
+		DeriveKID: JWKThumbprintKID,
+		Loaders: map[KeyType]KeyLoader{
+			RecipientPublicKey:  &BytesLoader{Data: EncodeBoxPublicKeyPEM(*publicKey)},
+			RecipientPrivateKey: &BytesLoader{Data: EncodeBoxPrivateKeyPEM(*privateKey)},
+		},
+	}
+	require.Nil(config.Validate())
+
+	encrypter, err := config.LoadEncrypt()
+	require.Nil(err)
+	decrypter, err := config.LoadDecrypt()
+	require.Nil(err)
+	assert.NotEmpty(encrypter.GetKID())
+	assert.Equal(encrypter.GetKID(), decrypter.GetKID())
+	testCryptoPair(t, encrypter, decrypter, false)
+
+	config.Loaders[SenderPrivateKey] = &BytesLoader{}
+	assert.NotNil(config.Validate())
+
+	assert.Equal(BoxEphemeral, ParseAlgorithmType("Box_Ephemeral"))
+}
@@ -18,67 +18,198 @@
 package voynicrypto
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/pem"
-	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+const (
+	// BoxKeySize is the size in bytes of a box (Curve25519) key.
+	BoxKeySize = 32
+
+	// BoxPrivateKeyPEMType is the pem block type of a box private key.
+	BoxPrivateKeyPEMType = "BOX PRIVATE KEY"
+
+	// BoxPublicKeyPEMType is the pem block type of a box public key.
+	BoxPublicKeyPEMType = "BOX PUBLIC KEY"
 )
 
 // BoxLoader loads the box encryption/decryption.
+//
+// The keys may be stored as a pem block (BOX PRIVATE KEY or BOX PUBLIC KEY),
+// as hex, as standard or url safe base64, or as the raw 32 bytes.
 type BoxLoader struct {
 	KID        string
 	PrivateKey KeyLoader
 	PublicKey  KeyLoader
+
+	// NonceSource is where the encrypter gets its nonces.  If not supplied,
+	// they are read from Random.
+	NonceSource NonceSource
+
+	// Random is the source of random nonces.  If not supplied, crypto/rand is
+	// used.
+	Random io.Reader
+
+	// Cache keeps the keys once they're parsed.  If not supplied, they're
+	// read and parsed on every load.
+	Cache *KeyCache
 }
 
-func (boxLoader *BoxLoader) getBoxPrivateKey() ([32]byte, error) {
-	var privateKey [32]byte
-	data, err := boxLoader.PrivateKey.GetBytes()
+func (boxLoader *BoxLoader) keyCache() *KeyCache {
+	return boxLoader.Cache
+}
+
+// GenerateBoxKeyPair creates a new random box key pair.
+func GenerateBoxKeyPair() (publicKey, privateKey *[BoxKeySize]byte, err error) {
+	return box.GenerateKey(rand.Reader)
+}
+
+// EncodeBoxPrivateKeyPEM encodes a box private key as a pem block.
+func EncodeBoxPrivateKeyPEM(key [BoxKeySize]byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: BoxPrivateKeyPEMType, Bytes: key[:]})
+}
+
+// EncodeBoxPublicKeyPEM encodes a box public key as a pem block.
+func EncodeBoxPublicKeyPEM(key [BoxKeySize]byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: BoxPublicKeyPEMType, Bytes: key[:]})
+}
+
+// ParseBoxPrivateKey parses a box private key in any of the formats BoxLoader supports.
+func ParseBoxPrivateKey(data []byte) ([BoxKeySize]byte, error) {
+	return parseBoxKey(data, BoxPrivateKeyPEMType)
+}
+
+// ParseBoxPublicKey parses a box public key in any of the formats BoxLoader supports.
+func ParseBoxPublicKey(data []byte) ([BoxKeySize]byte, error) {
+	return parseBoxKey(data, BoxPublicKeyPEMType)
+}
+
+func parseBoxKey(data []byte, pemType string) ([BoxKeySize]byte, error) {
+	var key [BoxKeySize]byte
+
+	decoded, err := decodeBoxKey(data, pemType)
 	if err != nil {
-		return privateKey, nil
+		return key, err
 	}
-	privatePem, _ := pem.Decode(data)
-	if privatePem.Type != "BOX PRIVATE KEY" {
-		return privateKey, errors.New("incorrect pem type: " + privatePem.Type)
+	if len(decoded) != BoxKeySize {
+		return key, invalidKey("box key must be %d bytes, got %d", BoxKeySize, len(decoded))
 	}
-	copy(privateKey[0:32], privatePem.Bytes[:])
-	return privateKey, nil
+	copy(key[:], decoded)
+	return key, nil
 }
 
-func (boxLoader *BoxLoader) getBoxPublicKey() ([32]byte, error) {
-	var publicKey [32]byte
-	data, err := boxLoader.PublicKey.GetBytes()
-	if err != nil {
-		return publicKey, nil
+// decodeBoxKey finds the key bytes without checking their length, so the
+// caller can report a wrong-length key rather than an unknown format.
+func decodeBoxKey(data []byte, pemType string) ([]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, invalidKey("empty box key")
+	}
+
+	if bytes.HasPrefix(trimmed, []byte("-----BEGIN")) {
+		block, err := decodePEMBlock(trimmed, pemType)
+		if err != nil {
+			return nil, err
+		}
+		return block.Bytes, nil
 	}
-	publicPem, _ := pem.Decode(data)
-	if publicPem.Type != "BOX PUBLIC KEY" {
-		return publicKey, errors.New("incorrect pem type: " + publicPem.Type)
+
+	// raw keys are only considered when the data is not valid hex or base64,
+	// which random key bytes practically never are.
+	if decoded, ok := decodeTextKey(trimmed); ok {
+		return decoded, nil
+	}
+	if len(data) == BoxKeySize {
+		return data, nil
 	}
-	copy(publicKey[0:32], publicPem.Bytes[:])
-	return publicKey, nil
+	return nil, invalidKey("unrecognized box key format (%d bytes)", len(data))
+}
+
+// decodeTextKey decodes a key written as hex or base64.
+func decodeTextKey(data []byte) ([]byte, bool) {
+	text := string(bytes.TrimSpace(data))
+	if decoded, err := hex.DecodeString(text); err == nil {
+		return decoded, true
+	}
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if decoded, err := encoding.DecodeString(text); err == nil {
+			return decoded, true
+		}
+	}
+	return nil, false
+}
+
+func (boxLoader *BoxLoader) getBoxPrivateKey(ctx context.Context) ([BoxKeySize]byte, error) {
+	return boxLoader.getBoxKey(ctx, boxLoader.PrivateKey, "private", ParseBoxPrivateKey)
+}
+
+func (boxLoader *BoxLoader) getBoxPublicKey(ctx context.Context) ([BoxKeySize]byte, error) {
+	return boxLoader.getBoxKey(ctx, boxLoader.PublicKey, "public", ParseBoxPublicKey)
+}
+
+// getBoxKey loads and parses a key through the cache.
+func (boxLoader *BoxLoader) getBoxKey(ctx context.Context, loader KeyLoader, kind string, parse func([]byte) ([BoxKeySize]byte, error)) ([BoxKeySize]byte, error) {
+	key, err := boxLoader.Cache.get("box "+kind, func() (interface{}, error) {
+		data, err := GetKeyBytes(ctx, loader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load box %s key: %w", kind, err)
+		}
+		key, err := parse(data)
+		if err != nil {
+			return nil, keyError(loader, fmt.Errorf("failed to parse box %s key: %w", kind, err))
+		}
+		return &key, nil
+	})
+	if err != nil {
+		return [BoxKeySize]byte{}, err
+	}
+	return *key.(*[BoxKeySize]byte), nil
 }
 
 // LoadEncrypt loads an encrypter for the box algorithm.
 func (boxLoader *BoxLoader) LoadEncrypt() (Encrypt, error) {
-	publicKey, err := boxLoader.getBoxPublicKey()
+	return boxLoader.LoadEncryptContext(context.Background())
+}
+
+// LoadEncryptContext loads an encrypter for the box algorithm, passing the
+// context to the key loaders.
+func (boxLoader *BoxLoader) LoadEncryptContext(ctx context.Context) (Encrypt, error) {
+	publicKey, err := boxLoader.getBoxPublicKey(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	privateKey, err := boxLoader.getBoxPrivateKey()
+	privateKey, err := boxLoader.getBoxPrivateKey(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return NewBoxEncrypter(privateKey, publicKey, boxLoader.KID), nil
+	encrypter := NewBoxEncrypter(privateKey, publicKey, boxLoader.KID)
+	encrypter.(*encryptBox).nonces = boxNonceSource(boxLoader.NonceSource, boxLoader.Random)
+	return encrypter, nil
 }
 
 // LoadDecrypt loads a decrypter for the box algorithm.
 func (boxLoader *BoxLoader) LoadDecrypt() (Decrypt, error) {
-	publicKey, err := boxLoader.getBoxPublicKey()
+	return boxLoader.LoadDecryptContext(context.Background())
+}
+
+// LoadDecryptContext loads a decrypter for the box algorithm, passing the
+// context to the key loaders.
+func (boxLoader *BoxLoader) LoadDecryptContext(ctx context.Context) (Decrypt, error) {
+	publicKey, err := boxLoader.getBoxPublicKey(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	privateKey, err := boxLoader.getBoxPrivateKey()
+	privateKey, err := boxLoader.getBoxPrivateKey(ctx)
 	if err != nil {
 		return nil, err
 	}
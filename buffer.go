@@ -0,0 +1,104 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import "sync"
+
+// MaxPooledBufferSize is the largest capacity a released Buffer keeps, so
+// one large message doesn't hold on to its memory in the pool.
+const MaxPooledBufferSize = 1 << 20
+
+// Buffer is a pooled byte slice holding a ciphertext or a message, returned
+// by EncryptMessagePooled and DecryptMessagePooled.  Release gives it back
+// for reuse, so a busy service doesn't allocate a slice for every message.
+// A Buffer is owned by one goroutine at a time.
+type Buffer struct {
+	data   []byte
+	secret bool
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(Buffer)
+	},
+}
+
+// getBuffer returns an empty Buffer.
+func getBuffer() *Buffer {
+	return bufferPool.Get().(*Buffer)
+}
+
+// Bytes returns the contents of the buffer.  They must not be used after
+// Release.
+func (b *Buffer) Bytes() []byte {
+	return b.data
+}
+
+// Len returns the length of the contents of the buffer.
+func (b *Buffer) Len() int {
+	return len(b.data)
+}
+
+// Release gives the buffer back to the pool, wiping it first if it holds a
+// decrypted message.  Neither the buffer nor its bytes may be used after
+// Release, and it must be released only once.  Releasing nil does nothing.
+func (b *Buffer) Release() {
+	if b == nil {
+		return
+	}
+	if b.secret {
+		wipe(b.data)
+	}
+	if cap(b.data) > MaxPooledBufferSize {
+		b.data = nil
+	}
+	b.data = b.data[:0]
+	b.secret = false
+	bufferPool.Put(b)
+}
+
+// EncryptMessagePooled encrypts the message into a pooled Buffer, which the
+// caller releases once the ciphertext has been sent.  With an AppendEncrypt,
+// like box and aes-gcm, encrypting costs no allocation for the ciphertext
+// once the pool is warm.
+func EncryptMessagePooled(encrypter Encrypt, message []byte) (*Buffer, []byte, error) {
+	b := getBuffer()
+	crypt, nonce, err := EncryptMessageTo(encrypter, b.data[:0], message)
+	if err != nil {
+		b.Release()
+		return nil, nil, err
+	}
+	b.data = crypt
+	return b, nonce, nil
+}
+
+// DecryptMessagePooled decrypts the message into a pooled Buffer, which the
+// caller releases once done with the message, wiping it.  With an
+// AppendDecrypt, like box and aes-gcm, decrypting costs no allocation once
+// the pool is warm.
+func DecryptMessagePooled(decrypter Decrypt, cipher []byte, nonce []byte) (*Buffer, error) {
+	b := getBuffer()
+	b.secret = true
+	message, err := DecryptMessageTo(decrypter, b.data[:0], cipher, nonce)
+	if err != nil {
+		b.Release()
+		return nil, err
+	}
+	b.data = message
+	return b, nil
+}
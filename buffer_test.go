@@ -0,0 +1,121 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPooledBuffers(t *testing.T) {
+	boxEncrypter, boxDecrypter := loadBoxPair(t)
+	aesEncrypter, aesDecrypter := aesGCMPair(t)
+	rsaEncrypter, rsaDecrypter := rsaPair(t)
+
+	testData := []struct {
+		description string
+		encrypter   Encrypt
+		decrypter   Decrypt
+	}{
+		{"none", DefaultCipherEncrypter(), DefaultCipherDecrypter()},
+		{"box", boxEncrypter, boxDecrypter},
+		{"aes-gcm", aesEncrypter, aesDecrypter},
+		{"rsa", rsaEncrypter, rsaDecrypter},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			for i := 0; i < 3; i++ {
+				crypt, nonce, err := EncryptMessagePooled(tc.encrypter, []byte("message"))
+				require.Nil(err)
+
+				message, err := DecryptMessagePooled(tc.decrypter, crypt.Bytes(), nonce)
+				require.Nil(err)
+				assert.Equal("message", string(message.Bytes()))
+				assert.Equal(7, message.Len())
+
+				crypt.Release()
+				message.Release()
+			}
+		})
+	}
+}
+
+func TestPooledBufferRelease(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := aesGCMPair(t)
+	crypt, nonce, err := EncryptMessagePooled(encrypter, []byte("secret"))
+	require.Nil(err)
+
+	// the message is wiped when it's released
+	message, err := DecryptMessagePooled(decrypter, crypt.Bytes(), nonce)
+	require.Nil(err)
+	plain := message.Bytes()
+	message.Release()
+	assert.Equal(make([]byte, len(plain)), plain)
+
+	_, err = DecryptMessagePooled(decrypter, []byte("garbage"), nonce)
+	assert.Equal(ErrDecryptFailed, err)
+
+	// large buffers aren't kept
+	large := &Buffer{data: make([]byte, MaxPooledBufferSize+1)}
+	large.Release()
+	assert.Nil(large.data)
+
+	var none *Buffer
+	none.Release()
+}
+
+func TestPooledBufferAllocations(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector changes what is allocated")
+	}
+
+	encrypter, decrypter := aesGCMPair(t)
+	message := bytes.Repeat([]byte("m"), 512)
+
+	var (
+		crypt *Buffer
+		nonce []byte
+	)
+	encryptAllocs := testing.AllocsPerRun(100, func() {
+		var err error
+		crypt, nonce, err = EncryptMessagePooled(encrypter, message)
+		require.Nil(t, err)
+		crypt.Release()
+	})
+	crypt, nonce, err := EncryptMessagePooled(encrypter, message)
+	require.Nil(t, err)
+	decryptAllocs := testing.AllocsPerRun(100, func() {
+		plain, err := DecryptMessagePooled(decrypter, crypt.Bytes(), nonce)
+		require.Nil(t, err)
+		plain.Release()
+	})
+
+	// only the nonce is allocated
+	assert.Equal(t, float64(1), encryptAllocs)
+	assert.Equal(t, float64(0), decryptAllocs)
+}
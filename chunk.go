@@ -0,0 +1,183 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultChunkSize is the amount of the message put in each chunk by
+// EncryptChunks when no size is given.
+const DefaultChunkSize = 64 * 1024
+
+const (
+	chunkVersion    = 1
+	chunkIDSize     = 16
+	chunkHeaderSize = 1 + chunkIDSize + 4 + 1
+	chunkFinal      = 1
+)
+
+// Chunk is one encrypted piece of a message split by EncryptChunks.  Each
+// chunk can be sent on its own, but DecryptChunks only accepts them all, in
+// order.
+type Chunk struct {
+	Cipher []byte
+	Nonce  []byte
+}
+
+// EncryptChunks splits a message that is too large for one EncryptMessage
+// call into chunks of at most chunkSize bytes and encrypts each.  Every chunk
+// carries an id shared by the whole message, its index, and whether it is the
+// final chunk, so DecryptChunks can detect chunks that are missing, reordered
+// or taken from another message.  If chunkSize isn't positive
+// DefaultChunkSize is used.  The id is read from the source set with
+// WithRandom, or crypto/rand, and the plaintext copied into each chunk is
+// wiped once it's sealed.
+func EncryptChunks(encrypter Encrypt, message []byte, chunkSize int, options ...CipherOption) ([]Chunk, error) {
+	s, err := newChunkSealer(encrypter, message, chunkSize, options)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make([]Chunk, s.count)
+	for i := range chunks {
+		if chunks[i], err = s.seal(i); err != nil {
+			return nil, err
+		}
+	}
+	return chunks, nil
+}
+
+// chunkSealer encrypts the chunks of one message, each independently of the
+// others.
+type chunkSealer struct {
+	encrypter Encrypt
+	message   []byte
+	chunkSize int
+	count     int
+	id        []byte
+}
+
+func newChunkSealer(encrypter Encrypt, message []byte, chunkSize int, options []CipherOption) (*chunkSealer, error) {
+	o, err := newCipherOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	id := make([]byte, chunkIDSize)
+	if _, err := io.ReadFull(randomOrDefault(o.random), id); err != nil {
+		return nil, fmt.Errorf("failed to generate chunk id: %w", err)
+	}
+
+	count := (len(message) + chunkSize - 1) / chunkSize
+	if count == 0 {
+		// an empty message is still sent as one final chunk
+		count = 1
+	}
+	return &chunkSealer{
+		encrypter: encrypter,
+		message:   message,
+		chunkSize: chunkSize,
+		count:     count,
+		id:        id,
+	}, nil
+}
+
+// seal encrypts chunk i.
+func (s *chunkSealer) seal(i int) (Chunk, error) {
+	end := (i + 1) * s.chunkSize
+	if end > len(s.message) {
+		end = len(s.message)
+	}
+	plain := make([]byte, 0, chunkHeaderSize+end-i*s.chunkSize)
+	plain = append(plain, chunkHeader(s.id, uint32(i), i == s.count-1)...)
+	plain = append(plain, s.message[i*s.chunkSize:end]...)
+
+	cipher, nonce, err := s.encrypter.EncryptMessage(plain)
+	// the none cipher hands the plaintext back as the ciphertext
+	if len(cipher) == 0 || &cipher[0] != &plain[0] {
+		wipe(plain)
+	}
+	if err != nil {
+		return Chunk{}, fmt.Errorf("failed to encrypt chunk %d: %w", i, err)
+	}
+	return Chunk{Cipher: cipher, Nonce: nonce}, nil
+}
+
+// DecryptChunks decrypts the chunks made by EncryptChunks and joins them back
+// into the message.  It fails unless the chunks all belong to one message,
+// are in order, and end with the final chunk.
+func DecryptChunks(decrypter Decrypt, chunks []Chunk) ([]byte, error) {
+	if len(chunks) == 0 {
+		return nil, errors.New("no chunks")
+	}
+
+	var (
+		id      []byte
+		message []byte
+	)
+	for i, chunk := range chunks {
+		plain, err := decrypter.DecryptMessage(chunk.Cipher, chunk.Nonce)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt chunk %d: %w", i, err)
+		}
+		if len(plain) < chunkHeaderSize || plain[0] != chunkVersion {
+			return nil, fmt.Errorf("chunk %d is not a valid chunk", i)
+		}
+
+		chunkID := plain[1 : 1+chunkIDSize]
+		index := binary.BigEndian.Uint32(plain[1+chunkIDSize:])
+		final := plain[chunkHeaderSize-1]&chunkFinal != 0
+
+		switch {
+		case id == nil:
+			id = chunkID
+		case !secretEqual(id, chunkID):
+			return nil, fmt.Errorf("chunk %d belongs to another message", i)
+		}
+		if index != uint32(i) {
+			return nil, fmt.Errorf("chunk %d is out of order, found index %d", i, index)
+		}
+		if final != (i == len(chunks)-1) {
+			if final {
+				return nil, fmt.Errorf("chunk %d is final but more chunks follow", i)
+			}
+			return nil, errors.New("message is truncated, the final chunk is missing")
+		}
+
+		message = append(message, plain[chunkHeaderSize:]...)
+	}
+	return message, nil
+}
+
+func chunkHeader(id []byte, index uint32, final bool) []byte {
+	header := make([]byte, chunkHeaderSize)
+	header[0] = chunkVersion
+	copy(header[1:], id)
+	binary.BigEndian.PutUint32(header[1+chunkIDSize:], index)
+	if final {
+		header[chunkHeaderSize-1] = chunkFinal
+	}
+	return header
+}
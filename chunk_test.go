@@ -0,0 +1,137 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunks(t *testing.T) {
+	encrypter, decrypter := loadBoxPair(t)
+
+	testData := []struct {
+		description string
+		size        int
+		chunkSize   int
+		chunks      int
+	}{
+		{"empty", 0, 10, 1},
+		{"one chunk", 10, 10, 1},
+		{"partial last chunk", 25, 10, 3},
+		{"default size", DefaultChunkSize + 1, 0, 2},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			message := bytes.Repeat([]byte("x"), tc.size)
+			chunks, err := EncryptChunks(encrypter, message, tc.chunkSize)
+			require.Nil(err)
+			assert.Len(chunks, tc.chunks)
+
+			result, err := DecryptChunks(decrypter, chunks)
+			require.Nil(err)
+			assert.Equal(len(message), len(result))
+			assert.True(bytes.Equal(message, result))
+		})
+	}
+}
+
+func TestChunksTampered(t *testing.T) {
+	require := require.New(t)
+
+	encrypter, decrypter := loadBoxPair(t)
+	chunks, err := EncryptChunks(encrypter, []byte("0123456789abcdefghij"), 5)
+	require.Nil(err)
+	require.Len(chunks, 4)
+	other, err := EncryptChunks(encrypter, []byte("0123456789abcdefghij"), 5)
+	require.Nil(err)
+
+	testData := []struct {
+		description string
+		chunks      []Chunk
+	}{
+		{"none", nil},
+		{"truncated", chunks[:3]},
+		{"reordered", []Chunk{chunks[0], chunks[2], chunks[1], chunks[3]}},
+		{"extra after final", append(append([]Chunk{}, chunks...), chunks[3])},
+		{"mixed messages", []Chunk{chunks[0], other[1], chunks[2], chunks[3]}},
+		{"corrupt", []Chunk{chunks[0], {Cipher: chunks[1].Cipher[1:], Nonce: chunks[1].Nonce}}},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := DecryptChunks(decrypter, tc.chunks)
+			assert.NotNil(t, err)
+		})
+	}
+
+	// a message that isn't a chunk is refused
+	_, err = DecryptChunks(DefaultCipherDecrypter(), []Chunk{{Cipher: []byte("short")}})
+	assert.NotNil(t, err)
+}
+
+// keepingEncrypter keeps the plaintexts it's given.
+type keepingEncrypter struct {
+	Encrypt
+	plains [][]byte
+}
+
+func (e *keepingEncrypter) EncryptMessage(message []byte) ([]byte, []byte, error) {
+	e.plains = append(e.plains, message)
+	return e.Encrypt.EncryptMessage(message)
+}
+
+func TestChunksRandom(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	id := bytes.Repeat([]byte{7}, chunkIDSize)
+	encrypter, decrypter := loadBoxPair(t)
+	keeping := &keepingEncrypter{Encrypt: encrypter}
+
+	chunks, err := EncryptChunks(keeping, []byte("0123456789"), 5, WithRandom(bytes.NewReader(id)))
+	require.Nil(err)
+	require.Len(keeping.plains, 2)
+	for _, plain := range keeping.plains {
+		assert.Equal(make([]byte, len(plain)), plain, "the plaintext should be wiped")
+	}
+
+	plain, err := decrypter.DecryptMessage(chunks[0].Cipher, chunks[0].Nonce)
+	require.Nil(err)
+	assert.Equal(id, plain[1:1+chunkIDSize])
+	message, err := DecryptChunks(decrypter, chunks)
+	assert.Nil(err)
+	assert.Equal("0123456789", string(message))
+
+	// the none cipher's ciphertext is its plaintext, which is left alone
+	chunks, err = EncryptChunksParallel(DefaultCipherEncrypter(), []byte("0123456789"), 5, 2, WithRandom(bytes.NewReader(id)))
+	require.Nil(err)
+	message, err = DecryptChunks(DefaultCipherDecrypter(), chunks)
+	assert.Nil(err)
+	assert.Equal("0123456789", string(message))
+
+	_, err = EncryptChunks(encrypter, []byte("0123456789"), 5, WithRandom(bytes.NewReader(nil)))
+	assert.NotNil(err)
+}
@@ -19,32 +19,18 @@
 package voynicrypto
 
 import (
+	"context"
 	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"fmt"
-	"hash"
 	"io"
-	"os"
+	"sync"
 
-	"github.com/goph/emperror"
-	"github.com/pkg/errors"
-	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/curve25519"
 	"golang.org/x/crypto/nacl/box"
 )
 
-func init() {
-	// register crypto.BLAKE2b_512 hash
-	crypto.RegisterHash(crypto.BLAKE2b_512, func() hash.Hash {
-		b2b, err := blake2b.New512([]byte("73 is the best number"))
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error from blake2b.New512: %s\n", err)
-			return nil
-		}
-		return b2b
-	})
-}
-
 type Identification interface {
 	// GetAlgorithm will return the algorithm Encrypt and Decrypt uses
 	GetAlgorithm() AlgorithmType
@@ -53,7 +39,8 @@ type Identification interface {
 	GetKID() string
 }
 
-// Encrypt represents the ability to encrypt messages
+// Encrypt represents the ability to encrypt messages.  Implementations must be
+// safe for concurrent use.
 type Encrypt interface {
 	Identification
 
@@ -62,7 +49,8 @@ type Encrypt interface {
 	EncryptMessage(message []byte) (crypt []byte, nonce []byte, err error)
 }
 
-// Decrypt represents the ability to decrypt messages
+// Decrypt represents the ability to decrypt messages.  Implementations must be
+// safe for concurrent use.
 type Decrypt interface {
 	Identification
 
@@ -75,6 +63,9 @@ type Decrypt interface {
 // size must be greater than 64 or else it will default to 64.
 //
 // Careful with the size, if its too large it won't encrypt the message or take forever
+//
+// Deprecated: GeneratePrivateKey ignores errors and allows insecure sizes.
+// Use GenerateRSAKey instead.
 func GeneratePrivateKey(size int) *rsa.PrivateKey {
 	if size < 64 {
 		// size is to small and it will be hard to find prime numbers
@@ -118,7 +109,10 @@ func (*NOOP) DecryptMessage(cipher []byte, nonce []byte) (message []byte, err er
 	return cipher, nil
 }
 
-// GetAlgorithm returns the algorithm type.
+// GetAlgorithm returns the algorithm type.  An encrypter never holds the
+// sender's public key and a decrypter never holds the recipient's, so the
+// ciphers loaded from rsa-asy configs report rsa-sym too, and their
+// envelopes carry rsa-sym.
 func (c *rsaEncrypterDecrypter) GetAlgorithm() AlgorithmType {
 	if c.recipientPublicKey == nil || c.senderPublicKey == nil {
 		return RSASymmetric
@@ -139,56 +133,103 @@ type rsaEncrypterDecrypter struct {
 	senderPublicKey     *rsa.PublicKey
 	senderPrivateKey    *rsa.PrivateKey
 	label               []byte
+	random              io.Reader
+	hybrid              bool
+	encryptThenSign     bool
+	pool                *RSAPool
+
+	// lock keeps Close from wiping the keys under a call in progress.
+	lock   sync.RWMutex
+	closed bool
 }
 
-// NewRSAEncrypter returns an RSA encrypter.
+// rsaPSSOptions are the options of the signatures of the RSA ciphers, which
+// are shared rather than made for every message.
+var rsaPSSOptions = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}
+
+// precomputeRSAKey makes crypto/rsa precompute the CRT values of the key
+// once, if they aren't already, rather than on every message, which it does
+// for keys that weren't precomputed.  Nil keys are ignored.
+func precomputeRSAKey(key *rsa.PrivateKey) {
+	if key != nil {
+		key.Precompute()
+	}
+}
+
+// NewRSAEncrypter returns an RSA encrypter.  It takes ownership of the keys, which
+// CloseCipher wipes.
 func NewRSAEncrypter(hash crypto.Hash, senderPrivateKey *rsa.PrivateKey, recipientPublicKey *rsa.PublicKey, kid string) Encrypt {
+	precomputeRSAKey(senderPrivateKey)
 	return &rsaEncrypterDecrypter{
 		kid:                kid,
 		hasher:             hash,
 		senderPrivateKey:   senderPrivateKey,
 		recipientPublicKey: recipientPublicKey,
-		label:              []byte("voynicrypto-rsa-cipher"),
+		label:              defaultRSALabel,
 	}
 }
 
-// NewRSADecrypter returns an RSA decrypter.
+// NewRSADecrypter returns an RSA decrypter.  It takes ownership of the keys, which
+// CloseCipher wipes.
 func NewRSADecrypter(hash crypto.Hash, recipientPrivateKey *rsa.PrivateKey, senderPublicKey *rsa.PublicKey, kid string) Decrypt {
+	precomputeRSAKey(recipientPrivateKey)
 	return &rsaEncrypterDecrypter{
 		kid:                 kid,
 		hasher:              hash,
 		recipientPrivateKey: recipientPrivateKey,
 		senderPublicKey:     senderPublicKey,
-		label:               []byte("voynicrypto-rsa-cipher"),
+		label:               defaultRSALabel,
 	}
 }
 
 // EncryptMessage encrypts the message using RSA.
 func (c *rsaEncrypterDecrypter) EncryptMessage(message []byte) ([]byte, []byte, error) {
-	cipherdata, err := rsa.EncryptOAEP(
-		c.hasher.New(),
-		rand.Reader,
-		c.recipientPublicKey,
-		message,
-		c.label,
+	return c.encrypt(message, c.label)
+}
+
+func (c *rsaEncrypterDecrypter) encrypt(message []byte, label []byte) ([]byte, []byte, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.closed {
+		return []byte(""), []byte{}, errCipherClosed
+	}
+	var (
+		cipherdata []byte
+		err        error
 	)
+	if c.hybrid && len(message) > c.maxOAEPSize() {
+		cipherdata, err = c.sealHybrid(message, label)
+	} else {
+		hasher := getHash(c.hasher)
+		cipherdata, err = rsa.EncryptOAEP(
+			hasher,
+			randomOrDefault(c.random),
+			c.recipientPublicKey,
+			message,
+			label,
+		)
+		putHash(c.hasher, hasher)
+	}
 	if err != nil {
-		return []byte(""), []byte{}, emperror.Wrap(err, "failed to encrypt message")
+		return []byte(""), []byte{}, fmt.Errorf("failed to encrypt message: %w", err)
 	}
 
 	signature := []byte{}
 
 	if c.senderPrivateKey != nil {
-		var opts rsa.PSSOptions
-		opts.SaltLength = rsa.PSSSaltLengthAuto // for simple example
-
-		pssh := c.hasher.New()
-		pssh.Write(message)
-		hashed := pssh.Sum(nil)
-
-		signature, err = rsa.SignPSS(rand.Reader, c.senderPrivateKey, c.hasher, hashed, &opts)
+		var hashed *[]byte
+		if c.encryptThenSign {
+			hashed = c.ciphertextDigest(cipherdata, label)
+		} else {
+			hashed = hashMessage(c.hasher, message)
+		}
+		signature, err = c.sign(*hashed)
+		putDigest(hashed)
 		if err != nil {
-			return []byte(""), []byte{}, emperror.Wrap(err, "failed to sign message")
+			return []byte(""), []byte{}, fmt.Errorf("failed to sign message: %w", err)
+		}
+		if c.encryptThenSign {
+			signature = append([]byte{rsaEncryptThenSignMode}, signature...)
 		}
 	}
 
@@ -197,28 +238,76 @@ func (c *rsaEncrypterDecrypter) EncryptMessage(message []byte) ([]byte, []byte,
 
 // DecryptMessage decrypts the message using RSA.
 func (c *rsaEncrypterDecrypter) DecryptMessage(cipher []byte, nonce []byte) ([]byte, error) {
+	return c.decrypt(cipher, nonce, c.label)
+}
+
+func (c *rsaEncrypterDecrypter) decrypt(cipher []byte, nonce []byte, label []byte) ([]byte, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.closed {
+		return []byte{}, errCipherClosed
+	}
+	encryptedThenSigned := false
+	if c.senderPublicKey != nil {
+		// check the signature before the costly decryption
+		var err error
+		if encryptedThenSigned, err = c.encryptedThenSigned(nonce); err != nil {
+			return []byte{}, err
+		}
+		if encryptedThenSigned {
+			if err := c.verifyCiphertext(cipher, nonce, label); err != nil {
+				return []byte{}, err
+			}
+		}
+	}
+	var (
+		decrypted []byte
+		err       error
+	)
+	if poolErr := c.pool.run(context.Background(), RSAPoolDecrypt, c, func() {
+		decrypted, err = c.decryptOAEP(cipher, label)
+	}); poolErr != nil {
+		return []byte{}, poolErr
+	}
+	if err != nil {
+		return []byte{}, err
+	}
+	if encryptedThenSigned {
+		return decrypted, nil
+	}
+	return c.verify(decrypted, nonce)
+}
+
+// decryptOAEP decrypts the message with the private key, which is the costly
+// part of decryption.
+func (c *rsaEncrypterDecrypter) decryptOAEP(cipher []byte, label []byte) ([]byte, error) {
+	if c.recipientPrivateKey != nil && len(cipher) > c.recipientPrivateKey.Size() {
+		return c.openHybrid(cipher, label)
+	}
+	hasher := getHash(c.hasher)
 	decrypted, err := rsa.DecryptOAEP(
-		c.hasher.New(),
-		rand.Reader,
+		hasher,
+		randomOrDefault(c.random),
 		c.recipientPrivateKey,
 		cipher,
-		c.label,
+		label,
 	)
+	putHash(c.hasher, hasher)
 	if err != nil {
-		return []byte{}, emperror.Wrap(err, "failed to decrypt message")
+		return nil, fmt.Errorf("%w: %w", ErrDecryptFailed, err)
 	}
+	return decrypted, nil
+}
 
+// verify checks the signature of the decrypted message when the sender's
+// public key is known.
+func (c *rsaEncrypterDecrypter) verify(decrypted []byte, nonce []byte) ([]byte, error) {
 	if c.senderPublicKey != nil {
-		var opts rsa.PSSOptions
-		opts.SaltLength = rsa.PSSSaltLengthAuto // for simple example
-
-		pssh := c.hasher.New()
-		pssh.Write(decrypted)
-		hashed := pssh.Sum(nil)
-
-		err = rsa.VerifyPSS(c.senderPublicKey, c.hasher, hashed, nonce, &opts)
+		hashed := hashMessage(c.hasher, decrypted)
+		err := rsa.VerifyPSS(c.senderPublicKey, c.hasher, *hashed, nonce, rsaPSSOptions)
+		putDigest(hashed)
 		if err != nil {
-			return []byte{}, emperror.Wrap(err, "failed to validate signature")
+			return []byte{}, fmt.Errorf("%w: %w", ErrSignatureInvalid, err)
 		}
 	}
 
@@ -230,6 +319,15 @@ type encryptBox struct {
 	senderPrivateKey   [32]byte
 	recipientPublicKey [32]byte
 	sharedEncryptKey   *[32]byte
+	nonces             NonceSource
+	lock               sync.RWMutex
+}
+
+func (enBox *encryptBox) nonceSource() NonceSource {
+	if enBox.nonces == nil {
+		return defaultNonceSource
+	}
+	return enBox.nonces
 }
 
 // GetAlgorithm returns the algorithm type.
@@ -242,7 +340,8 @@ func (enBox *encryptBox) GetKID() string {
 	return enBox.kid
 }
 
-// NewBoxEncrypter returns a new box encrypter.
+// NewBoxEncrypter returns a new box encrypter.  The keys are copied, and CloseCipher
+// wipes the copies.
 func NewBoxEncrypter(senderPrivateKey [32]byte, recipientPublicKey [32]byte, kid string) Encrypt {
 
 	encrypter := encryptBox{
@@ -257,23 +356,31 @@ func NewBoxEncrypter(senderPrivateKey [32]byte, recipientPublicKey [32]byte, kid
 	return &encrypter
 }
 
-// Encrypt message encrypts the message using the box algorithm.
+// Encrypt message encrypts the message using the box algorithm.  The nonce
+// and the cipher share one allocation.
 func (enBox *encryptBox) EncryptMessage(message []byte) ([]byte, []byte, error) {
-	var nonce [24]byte
-	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
-		return []byte(""), []byte{}, emperror.Wrap(err, "failed to generate nonce")
+	enBox.lock.RLock()
+	defer enBox.lock.RUnlock()
+	if enBox.sharedEncryptKey == nil {
+		return []byte(""), []byte{}, errCipherClosed
 	}
-
-	encrypted := box.SealAfterPrecomputation(nil, message, &nonce, enBox.sharedEncryptKey)
-
-	return encrypted, nonce[:], nil
+	buffer := make([]byte, 24, 24+len(message)+box.Overhead)
+	if err := enBox.nonceSource().NextNonce(buffer); err != nil {
+		return []byte(""), []byte{}, err
+	}
+	var nonce [24]byte
+	copy(nonce[:], buffer)
+	encrypted := box.SealAfterPrecomputation(buffer[24:], message, &nonce, enBox.sharedEncryptKey)
+	return encrypted, buffer[:24:24], nil
 }
 
 type decryptBox struct {
 	kid                 string
 	recipientPrivateKey [32]byte
+	recipientPublicKey  [32]byte
 	senderPublicKey     [32]byte
 	sharedDecryptKey    *[32]byte
+	lock                sync.RWMutex
 }
 
 // GetAlgorithm returns the algorithm type.
@@ -286,7 +393,8 @@ func (deBox *decryptBox) GetKID() string {
 	return deBox.kid
 }
 
-// NewBoxDecrypter returns a new box decrypter.
+// NewBoxDecrypter returns a new box decrypter.  The keys are copied, and CloseCipher
+// wipes the copies.
 func NewBoxDecrypter(recipientPrivateKey [32]byte, senderPublicKey [32]byte, kid string) Decrypt {
 
 	decrypter := decryptBox{
@@ -297,19 +405,16 @@ func NewBoxDecrypter(recipientPrivateKey [32]byte, senderPublicKey [32]byte, kid
 	}
 
 	box.Precompute(decrypter.sharedDecryptKey, &decrypter.senderPublicKey, &decrypter.recipientPrivateKey)
+	curve25519.ScalarBaseMult(&decrypter.recipientPublicKey, &decrypter.recipientPrivateKey)
 
 	return &decrypter
 }
 
 // DecryptMessage decrypts the message using the box algorithm.
 func (deBox *decryptBox) DecryptMessage(cipher []byte, nonce []byte) ([]byte, error) {
-	var decryptNonce [24]byte
-	copy(decryptNonce[:], nonce[:24])
-
-	decrypted, ok := box.OpenAfterPrecomputation(nil, cipher, &decryptNonce, deBox.sharedDecryptKey)
-	if !ok {
-		return []byte(""), errors.New("failed to decrypt message")
+	decrypted, err := deBox.DecryptMessageTo(nil, cipher, nonce)
+	if err != nil {
+		return []byte(""), err
 	}
-
 	return decrypted, nil
 }
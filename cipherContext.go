@@ -0,0 +1,94 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+)
+
+// ContextEncrypt is an Encrypt that takes a context, so a cipher backed by a
+// remote service can respect deadlines and carry trace metadata.
+type ContextEncrypt interface {
+	Encrypt
+
+	// EncryptMessageContext is EncryptMessage with a context.
+	EncryptMessageContext(ctx context.Context, message []byte) (crypt []byte, nonce []byte, err error)
+}
+
+// ContextDecrypt is a Decrypt that takes a context, so a cipher backed by a
+// remote service can respect deadlines and carry trace metadata.
+type ContextDecrypt interface {
+	Decrypt
+
+	// DecryptMessageContext is DecryptMessage with a context.
+	DecryptMessageContext(ctx context.Context, cipher []byte, nonce []byte) (message []byte, err error)
+}
+
+// WithEncryptContext returns the encrypter as a ContextEncrypt.  Encrypters
+// that don't take a context are adapted to check that the context isn't done
+// before encrypting.
+func WithEncryptContext(encrypter Encrypt) ContextEncrypt {
+	if e, ok := encrypter.(ContextEncrypt); ok {
+		return e
+	}
+	return contextEncrypter{encrypter}
+}
+
+// WithDecryptContext returns the decrypter as a ContextDecrypt.  Decrypters
+// that don't take a context are adapted to check that the context isn't done
+// before decrypting.
+func WithDecryptContext(decrypter Decrypt) ContextDecrypt {
+	if d, ok := decrypter.(ContextDecrypt); ok {
+		return d
+	}
+	return contextDecrypter{decrypter}
+}
+
+// EncryptMessageContext encrypts the message, passing the context along if
+// the encrypter takes one.
+func EncryptMessageContext(ctx context.Context, encrypter Encrypt, message []byte) ([]byte, []byte, error) {
+	return WithEncryptContext(encrypter).EncryptMessageContext(ctx, message)
+}
+
+// DecryptMessageContext decrypts the message, passing the context along if
+// the decrypter takes one.
+func DecryptMessageContext(ctx context.Context, decrypter Decrypt, cipher []byte, nonce []byte) ([]byte, error) {
+	return WithDecryptContext(decrypter).DecryptMessageContext(ctx, cipher, nonce)
+}
+
+type contextEncrypter struct {
+	Encrypt
+}
+
+func (e contextEncrypter) EncryptMessageContext(ctx context.Context, message []byte) ([]byte, []byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	return e.EncryptMessage(message)
+}
+
+type contextDecrypter struct {
+	Decrypt
+}
+
+func (d contextDecrypter) DecryptMessageContext(ctx context.Context, cipher []byte, nonce []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return d.DecryptMessage(cipher, nonce)
+}
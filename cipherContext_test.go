@@ -0,0 +1,97 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// deadlineCipher is a ContextEncrypt and ContextDecrypt that records whether
+// the context it was given had a deadline.
+type deadlineCipher struct {
+	reverser
+	hadDeadline bool
+}
+
+func (d *deadlineCipher) EncryptMessageContext(ctx context.Context, message []byte) ([]byte, []byte, error) {
+	_, d.hadDeadline = ctx.Deadline()
+	return d.EncryptMessage(message)
+}
+
+func (d *deadlineCipher) DecryptMessageContext(ctx context.Context, cipher []byte, nonce []byte) ([]byte, error) {
+	_, d.hadDeadline = ctx.Deadline()
+	return d.DecryptMessage(cipher, nonce)
+}
+
+func TestContextAdapters(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	encrypter := WithEncryptContext(DefaultCipherEncrypter())
+	decrypter := WithDecryptContext(DefaultCipherDecrypter())
+	assert.Equal(None, encrypter.GetAlgorithm())
+	assert.Equal(None, decrypter.GetAlgorithm())
+
+	cipher, nonce, err := encrypter.EncryptMessageContext(context.Background(), []byte("hello"))
+	require.Nil(err)
+	message, err := decrypter.DecryptMessageContext(context.Background(), cipher, nonce)
+	require.Nil(err)
+	assert.Equal([]byte("hello"), message)
+
+	_, _, err = encrypter.EncryptMessageContext(canceled, []byte("hello"))
+	assert.Equal(context.Canceled, err)
+	_, err = decrypter.DecryptMessageContext(canceled, cipher, nonce)
+	assert.Equal(context.Canceled, err)
+}
+
+func TestContextPassedThrough(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c := &deadlineCipher{}
+	assert.Equal(c, WithEncryptContext(c))
+	assert.Equal(c, WithDecryptContext(c))
+
+	cipher, nonce, err := EncryptMessageContext(ctx, c, []byte("hello"))
+	require.Nil(err)
+	assert.True(c.hadDeadline)
+
+	// composites hand the context to the ciphers they wrap
+	c.hadDeadline = false
+	fallback := &fallbackDecrypter{decrypters: []Decrypt{DefaultCipherDecrypter(), c}}
+	_, err = DecryptMessageContext(ctx, fallback, cipher, nonce)
+	require.Nil(err)
+	assert.False(c.hadDeadline, "the first decrypter should have succeeded")
+
+	fallback.decrypters = []Decrypt{c}
+	message, err := DecryptMessageContext(ctx, fallback, cipher, nonce)
+	require.Nil(err)
+	assert.Equal([]byte("hello"), message)
+	assert.True(c.hadDeadline)
+}
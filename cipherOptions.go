@@ -0,0 +1,254 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"io"
+)
+
+// DefaultRSAHash is the hash used by NewRSAEncrypt and NewRSADecrypt when
+// WithHash isn't given.
+const DefaultRSAHash = crypto.SHA512
+
+// defaultRSALabel is the OAEP label the RSA ciphers have always used.
+var defaultRSALabel = []byte("voynicrypto-rsa-cipher")
+
+// cipherOptions are the settings CipherOptions change.
+type cipherOptions struct {
+	kid        string
+	hash       crypto.Hash
+	label      []byte
+	signingKey *rsa.PrivateKey
+	verifyKey  *rsa.PublicKey
+	nonces     NonceSource
+	random     io.Reader
+	hybrid     bool
+	rsaPool    *RSAPool
+
+	encryptThenSign bool
+
+	deterministic bool
+}
+
+// CipherOption configures a cipher built by NewRSAEncrypt, NewRSADecrypt,
+// NewBoxEncrypt or NewBoxDecrypt.
+type CipherOption func(*cipherOptions) error
+
+// WithKID sets the KID of the cipher.
+func WithKID(kid string) CipherOption {
+	return func(o *cipherOptions) error {
+		o.kid = kid
+		return nil
+	}
+}
+
+// WithHash sets the hash used for OAEP and for signatures.  The hash must be
+// linked into the binary.
+func WithHash(hash crypto.Hash) CipherOption {
+	return func(o *cipherOptions) error {
+		if !hash.Available() {
+			return errors.New("hash " + hash.String() + " is not available")
+		}
+		o.hash = hash
+		return nil
+	}
+}
+
+// WithLabel sets the OAEP label.  Both sides must use the same label.
+func WithLabel(label []byte) CipherOption {
+	return func(o *cipherOptions) error {
+		o.label = append([]byte{}, label...)
+		return nil
+	}
+}
+
+// WithSigningKey makes an RSA encrypter sign messages with the sender's
+// private key.
+func WithSigningKey(senderPrivateKey *rsa.PrivateKey) CipherOption {
+	return func(o *cipherOptions) error {
+		if senderPrivateKey == nil {
+			return errors.New("no signing key")
+		}
+		o.signingKey = senderPrivateKey
+		return nil
+	}
+}
+
+// WithVerifyKey makes an RSA decrypter verify message signatures with the
+// sender's public key.
+func WithVerifyKey(senderPublicKey *rsa.PublicKey) CipherOption {
+	return func(o *cipherOptions) error {
+		if senderPublicKey == nil {
+			return errors.New("no verify key")
+		}
+		o.verifyKey = senderPublicKey
+		return nil
+	}
+}
+
+// WithNonceSource sets where a box encrypter gets its nonces.  By default
+// they are random.
+func WithNonceSource(source NonceSource) CipherOption {
+	return func(o *cipherOptions) error {
+		if source == nil {
+			return errors.New("no nonce source")
+		}
+		o.nonces = source
+		return nil
+	}
+}
+
+// WithRandom sets the source of randomness used for RSA padding and
+// signatures and for the random nonces of box, in place of crypto/rand.  It
+// lets tests be deterministic, and lets platforms with a hardware RNG or DRBG
+// requirements supply their own source.
+func WithRandom(random io.Reader) CipherOption {
+	return func(o *cipherOptions) error {
+		if random == nil {
+			return errors.New("no random source")
+		}
+		o.random = random
+		return nil
+	}
+}
+
+// WithRSAPool makes an RSA cipher run its decryptions and signatures on the
+// workers of the pool.
+func WithRSAPool(pool *RSAPool) CipherOption {
+	return func(o *cipherOptions) error {
+		if pool == nil {
+			return errors.New("no rsa pool")
+		}
+		o.rsaPool = pool
+		return nil
+	}
+}
+
+// randomOrDefault returns random, or crypto/rand if it's nil.
+func randomOrDefault(random io.Reader) io.Reader {
+	if random == nil {
+		return rand.Reader
+	}
+	return random
+}
+
+func newCipherOptions(options []CipherOption) (*cipherOptions, error) {
+	o := &cipherOptions{
+		hash:  DefaultRSAHash,
+		label: defaultRSALabel,
+	}
+	for _, option := range options {
+		if option == nil {
+			continue
+		}
+		if err := option(o); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// NewRSAEncrypt returns an RSA encrypter for the recipient's public key.
+func NewRSAEncrypt(recipientPublicKey *rsa.PublicKey, options ...CipherOption) (Encrypt, error) {
+	if recipientPublicKey == nil {
+		return nil, errors.New("no recipient public key")
+	}
+	o, err := newCipherOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if StrictMode() {
+		if err := checkStrictRSA(o.hash, o.signingKey, recipientPublicKey); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkFIPSRSA(o.hash, o.signingKey, recipientPublicKey); err != nil {
+		return nil, err
+	}
+	precomputeRSAKey(o.signingKey)
+	return &rsaEncrypterDecrypter{
+		kid:                o.kid,
+		hasher:             o.hash,
+		senderPrivateKey:   o.signingKey,
+		recipientPublicKey: recipientPublicKey,
+		label:              o.label,
+		random:             o.random,
+		hybrid:             o.hybrid,
+		encryptThenSign:    o.encryptThenSign,
+		pool:               o.rsaPool,
+	}, nil
+}
+
+// NewRSADecrypt returns an RSA decrypter for the recipient's private key.
+func NewRSADecrypt(recipientPrivateKey *rsa.PrivateKey, options ...CipherOption) (Decrypt, error) {
+	if recipientPrivateKey == nil {
+		return nil, errors.New("no recipient private key")
+	}
+	o, err := newCipherOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if StrictMode() {
+		if err := checkStrictRSA(o.hash, recipientPrivateKey, o.verifyKey); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkFIPSRSA(o.hash, recipientPrivateKey, o.verifyKey); err != nil {
+		return nil, err
+	}
+	precomputeRSAKey(recipientPrivateKey)
+	return &rsaEncrypterDecrypter{
+		kid:                 o.kid,
+		hasher:              o.hash,
+		recipientPrivateKey: recipientPrivateKey,
+		senderPublicKey:     o.verifyKey,
+		label:               o.label,
+		random:              o.random,
+		pool:                o.rsaPool,
+	}, nil
+}
+
+// NewBoxEncrypt returns a box encrypter.
+func NewBoxEncrypt(senderPrivateKey [32]byte, recipientPublicKey [32]byte, options ...CipherOption) (Encrypt, error) {
+	if err := checkFIPSAlgorithm(Box); err != nil {
+		return nil, err
+	}
+	o, err := newCipherOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	encrypter := NewBoxEncrypter(senderPrivateKey, recipientPublicKey, o.kid)
+	encrypter.(*encryptBox).nonces = boxNonceSource(o.nonces, o.random)
+	return encrypter, nil
+}
+
+// NewBoxDecrypt returns a box decrypter.
+func NewBoxDecrypt(recipientPrivateKey [32]byte, senderPublicKey [32]byte, options ...CipherOption) (Decrypt, error) {
+	if err := checkFIPSAlgorithm(Box); err != nil {
+		return nil, err
+	}
+	o, err := newCipherOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	return NewBoxDecrypter(recipientPrivateKey, senderPublicKey, o.kid), nil
+}
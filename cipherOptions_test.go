@@ -0,0 +1,165 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto"
+	mathrand "math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRSAWithOptions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	senderPrivateKey := GeneratePrivateKey(2048)
+	recipientPrivateKey := GeneratePrivateKey(2048)
+
+	encrypter, err := NewRSAEncrypt(&recipientPrivateKey.PublicKey,
+		WithHash(crypto.SHA256),
+		WithLabel([]byte("custom")),
+		WithKID("options"),
+		WithSigningKey(senderPrivateKey),
+	)
+	require.Nil(err)
+	assert.Equal("options", encrypter.GetKID())
+
+	decrypter, err := NewRSADecrypt(recipientPrivateKey,
+		WithHash(crypto.SHA256),
+		WithLabel([]byte("custom")),
+		WithKID("options"),
+		WithVerifyKey(&senderPrivateKey.PublicKey),
+	)
+	require.Nil(err)
+	testCryptoPair(t, encrypter, decrypter, true)
+
+	// the defaults match the positional constructors
+	encrypter, err = NewRSAEncrypt(&recipientPrivateKey.PublicKey)
+	require.Nil(err)
+	testCryptoPair(t, encrypter, NewRSADecrypter(DefaultRSAHash, recipientPrivateKey, nil, ""), true)
+
+	// a different label can't decrypt
+	decrypter, err = NewRSADecrypt(recipientPrivateKey, WithLabel([]byte("other")))
+	require.Nil(err)
+	crypt, nonce, err := encrypter.EncryptMessage([]byte("hello"))
+	require.Nil(err)
+	_, err = decrypter.DecryptMessage(crypt, nonce)
+	assert.NotNil(err)
+}
+
+func TestCipherOptionErrors(t *testing.T) {
+	recipientPrivateKey := GeneratePrivateKey(1024)
+
+	testData := []struct {
+		description string
+		load        func() error
+	}{
+		{"no public key", func() error {
+			_, err := NewRSAEncrypt(nil)
+			return err
+		}},
+		{"no private key", func() error {
+			_, err := NewRSADecrypt(nil)
+			return err
+		}},
+		{"unavailable hash", func() error {
+			_, err := NewRSAEncrypt(&recipientPrivateKey.PublicKey, WithHash(crypto.MD4))
+			return err
+		}},
+		{"nil signing key", func() error {
+			_, err := NewRSAEncrypt(&recipientPrivateKey.PublicKey, WithSigningKey(nil))
+			return err
+		}},
+		{"nil verify key", func() error {
+			_, err := NewRSADecrypt(recipientPrivateKey, WithVerifyKey(nil))
+			return err
+		}},
+		{"nil random", func() error {
+			_, err := NewRSAEncrypt(&recipientPrivateKey.PublicKey, WithRandom(nil))
+			return err
+		}},
+		{"box with bad option", func() error {
+			_, err := NewBoxEncrypt([32]byte{}, [32]byte{}, WithHash(crypto.MD4))
+			return err
+		}},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert.NotNil(t, tc.load())
+		})
+	}
+}
+
+func TestNewBoxWithOptions(t *testing.T) {
+	require := require.New(t)
+
+	senderPublicKey, senderPrivateKey, err := GenerateBoxKeyPair()
+	require.Nil(err)
+	recipientPublicKey, recipientPrivateKey, err := GenerateBoxKeyPair()
+	require.Nil(err)
+
+	encrypter, err := NewBoxEncrypt(*senderPrivateKey, *recipientPublicKey, WithKID("box"))
+	require.Nil(err)
+	require.Equal("box", encrypter.GetKID())
+
+	decrypter, err := NewBoxDecrypt(*recipientPrivateKey, *senderPublicKey, WithKID("box"))
+	require.Nil(err)
+	testCryptoPair(t, encrypter, decrypter, false)
+}
+
+func TestWithRandom(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	seeded := func() *mathrand.Rand {
+		return mathrand.New(mathrand.NewSource(73))
+	}
+	recipientPrivateKey := GeneratePrivateKey(2048)
+	encrypt := func(encrypter Encrypt, err error) []byte {
+		require.Nil(err)
+		crypt, _, err := encrypter.EncryptMessage([]byte("hello"))
+		require.Nil(err)
+		return crypt
+	}
+
+	first := encrypt(NewRSAEncrypt(&recipientPrivateKey.PublicKey, WithRandom(seeded())))
+	second := encrypt(NewRSAEncrypt(&recipientPrivateKey.PublicKey, WithRandom(seeded())))
+	assert.Equal(first, second)
+	decrypter, err := NewRSADecrypt(recipientPrivateKey, WithRandom(seeded()))
+	require.Nil(err)
+	decrypted, err := decrypter.DecryptMessage(first, nil)
+	require.Nil(err)
+	assert.Equal([]byte("hello"), decrypted)
+
+	first = encrypt(NewBoxEncrypt([32]byte{}, [32]byte{}, WithRandom(seeded())))
+	second = encrypt(NewBoxEncrypt([32]byte{}, [32]byte{}, WithRandom(seeded())))
+	assert.Equal(first, second)
+
+	config := boxConfig(t, "")
+	config.Random = seeded()
+	first = encrypt(config.LoadEncrypt())
+	config.Random = seeded()
+	second = encrypt(config.LoadEncrypt())
+	assert.Equal(first, second)
+	config.Random = nil
+	assert.NotEqual(first, encrypt(config.LoadEncrypt()))
+}
@@ -20,6 +20,7 @@ package voynicrypto
 import (
 	"crypto"
 	"crypto/rand"
+	"crypto/rsa"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -124,3 +125,34 @@ func TestBoxCipher(t *testing.T) {
 
 	testCryptoPair(t, encrypter, decrypter, false)
 }
+
+func TestRSAPrecomputesKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(t, err)
+
+	// keys built by hand, rather than generated or parsed, aren't
+	// precomputed, so crypto/rsa would precompute them for every message
+	bare := func() *rsa.PrivateKey {
+		return &rsa.PrivateKey{PublicKey: privateKey.PublicKey, D: privateKey.D, Primes: privateKey.Primes}
+	}
+
+	decrypterKey := bare()
+	decrypter := NewRSADecrypter(crypto.SHA256, decrypterKey, nil, "")
+	assert.NotNil(decrypterKey.Precomputed.Dp)
+
+	signingKey := bare()
+	encrypter, err := NewRSAEncrypt(&privateKey.PublicKey, WithHash(crypto.SHA256), WithSigningKey(signingKey))
+	require.Nil(t, err)
+	assert.NotNil(signingKey.Precomputed.Dp)
+
+	signerKey := bare()
+	NewRSAPSSSigner(crypto.SHA256, signerKey, "")
+	assert.NotNil(signerKey.Precomputed.Dp)
+
+	verifier, err := NewRSADecrypt(privateKey, WithHash(crypto.SHA256), WithVerifyKey(&signingKey.PublicKey))
+	require.Nil(t, err)
+	testCryptoPair(t, encrypter, verifier, true)
+	testCryptoPair(t, NewRSAEncrypter(crypto.SHA256, nil, &privateKey.PublicKey, ""), decrypter, true)
+}
@@ -0,0 +1,263 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Command voynicrypto generates keys, encrypts and decrypts messages, shows
+// what is in an envelope and checks configs, using the same Config files as
+// services that use the package.
+//
+//	voynicrypto keygen --type box --private private.pem --public public.pem
+//	voynicrypto encrypt --config encrypt.yaml < message > envelope
+//	voynicrypto decrypt --config decrypt.yaml < envelope
+//	voynicrypto inspect < envelope
+//	voynicrypto config-validate --config decrypt.yaml
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+	"github.com/xmidt-org/voynicrypto"
+)
+
+// binaryEncoding writes envelopes marshalled as binary instead of as text.
+const binaryEncoding = "binary"
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string, stdin io.Reader, stdout io.Writer) error
+}
+
+var commands = []command{
+	{"keygen", "generate a key pair", keygen},
+	{"encrypt", "encrypt stdin into an envelope", encrypt},
+	{"decrypt", "decrypt an envelope read from stdin", decrypt},
+	{"inspect", "show the algorithm, kid and nonce of an envelope read from stdin", inspect},
+	{"config-validate", "check a config for problems", configValidate},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: voynicrypto <command> [flags]")
+	fmt.Fprintln(w)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-16s %s\n", c.name, c.description)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run voynicrypto <command> --help for the flags of a command.")
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+	for _, c := range commands {
+		if c.name != args[0] {
+			continue
+		}
+		err := c.run(args[1:], stdin, stdout)
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", c.name, err)
+			return 1
+		}
+		return 0
+	}
+	if args[0] == "help" || args[0] == "--help" || args[0] == "-h" {
+		usage(stdout)
+		return 0
+	}
+	fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet("voynicrypto "+name, flag.ContinueOnError)
+}
+
+func keygen(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("keygen")
+	kind := fs.String("type", string(voynicrypto.BoxKeyPair), "type of key pair: rsa, box or ed25519")
+	privatePath := fs.String("private", "private.pem", "output path for the private key")
+	publicPath := fs.String("public", "public.pem", "output path for the public key, empty to skip it")
+	bits := fs.Int("bits", voynicrypto.DefaultGeneratedRSABits, "size of rsa keys")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := voynicrypto.GenerateKeyPairFiles(voynicrypto.KeyPairType(*kind), *privatePath, *publicPath, *bits); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "wrote %s\n", *privatePath)
+	if *publicPath != "" {
+		fmt.Fprintf(stdout, "wrote %s\n", *publicPath)
+	}
+	return nil
+}
+
+func loadConfig(path string) (voynicrypto.Config, error) {
+	if path == "" {
+		return voynicrypto.Config{}, errors.New("--config is required")
+	}
+	return voynicrypto.LoadConfigFromFile(path)
+}
+
+func encrypt(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("encrypt")
+	configPath := fs.String("config", "", "config file of the encrypter")
+	encoding := fs.String("encoding", string(voynicrypto.Base64URL), "encoding of the envelope: base64url, hex or binary")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	encrypter, err := config.LoadEncrypt()
+	if err != nil {
+		return err
+	}
+	message, err := io.ReadAll(stdin)
+	if err != nil {
+		return err
+	}
+
+	e, err := voynicrypto.SealEnvelope(encrypter, message)
+	if err != nil {
+		return err
+	}
+	if *encoding == binaryEncoding {
+		data, err := e.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		_, err = stdout.Write(data)
+		return err
+	}
+	text, err := e.Encode(voynicrypto.TransportEncoding(*encoding))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, text)
+	return err
+}
+
+// readEnvelope reads a binary envelope, or one in the encoding given.
+func readEnvelope(stdin io.Reader, encoding string) (*voynicrypto.Envelope, error) {
+	data, err := io.ReadAll(stdin)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := voynicrypto.EnvelopeVersionOf(data); err == nil || encoding == binaryEncoding {
+		var e voynicrypto.Envelope
+		if err := e.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		return &e, nil
+	}
+	return voynicrypto.ParseEnvelope(string(bytes.TrimSpace(data)), voynicrypto.TransportEncoding(encoding))
+}
+
+func decrypt(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("decrypt")
+	configPath := fs.String("config", "", "config file of the decrypter")
+	encoding := fs.String("encoding", string(voynicrypto.Base64URL), "encoding of text envelopes: base64url or hex")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	decrypter, err := config.LoadDecrypt()
+	if err != nil {
+		return err
+	}
+	e, err := readEnvelope(stdin, *encoding)
+	if err != nil {
+		return err
+	}
+
+	message, err := e.Open(decrypter)
+	if err != nil {
+		return err
+	}
+	_, err = stdout.Write(message)
+	return err
+}
+
+func inspect(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("inspect")
+	encoding := fs.String("encoding", string(voynicrypto.Base64URL), "encoding of text envelopes: base64url or hex")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	e, err := readEnvelope(stdin, *encoding)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "algorithm:   %s\n", e.Algorithm)
+	fmt.Fprintf(stdout, "kid:         %s\n", e.KID)
+	fmt.Fprintf(stdout, "nonce:       %x\n", e.Nonce)
+	if len(e.Signature) > 0 {
+		fmt.Fprintf(stdout, "signature:   %x\n", e.Signature)
+	}
+	if e.Compression != voynicrypto.NoCompression {
+		fmt.Fprintf(stdout, "compression: %s\n", e.Compression)
+	}
+	fmt.Fprintf(stdout, "cipher:      %d bytes\n", len(e.Cipher))
+	return nil
+}
+
+func configValidate(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("config-validate")
+	configPath := fs.String("config", "", "config file to check")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	err = config.Validate()
+	var problems voynicrypto.ValidationErrors
+	if errors.As(err, &problems) {
+		lines := make([]string, len(problems))
+		for i, problem := range problems {
+			lines[i] = "  " + problem.Error()
+		}
+		return fmt.Errorf("%d problems:\n%s", len(problems), strings.Join(lines, "\n"))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%s is valid\n", *configPath)
+	return nil
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
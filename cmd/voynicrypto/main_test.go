@@ -0,0 +1,101 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runCommand(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCommands(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	path := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+	for _, name := range []string{"sender", "recipient"} {
+		code, _, stderr := runCommand("", "keygen", "--type", "box",
+			"--private", path(name+"-private.pem"), "--public", path(name+"-public.pem"))
+		require.Equal(0, code, stderr)
+	}
+	code, _, _ := runCommand("", "keygen", "--type", "box", "--private", path("sender-private.pem"))
+	assert.Equal(1, code, "keys are never overwritten")
+
+	writeConfig := func(name, keys string) string {
+		data := fmt.Sprintf("type: box\nkid: test\nkeys:\n%s", keys)
+		require.Nil(ioutil.WriteFile(path(name), []byte(data), 0600))
+		return path(name)
+	}
+	encryptConfig := writeConfig("encrypt.yaml", fmt.Sprintf("  senderPrivateKey: %s\n  recipientPublicKey: %s\n",
+		path("sender-private.pem"), path("recipient-public.pem")))
+	decryptConfig := writeConfig("decrypt.yaml", fmt.Sprintf("  recipientPrivateKey: %s\n  senderPublicKey: %s\n",
+		path("recipient-private.pem"), path("sender-public.pem")))
+	badConfig := writeConfig("bad.yaml", fmt.Sprintf("  senderPrivateKey: %s\n", path("sender-private.pem")))
+
+	for _, encoding := range []string{"base64url", "hex", "binary"} {
+		code, envelope, stderr := runCommand("hello", "encrypt", "--config", encryptConfig, "--encoding", encoding)
+		require.Equal(0, code, stderr)
+
+		decoding := encoding
+		if encoding == "binary" {
+			decoding = "base64url"
+		}
+		code, stdout, stderr := runCommand(envelope, "inspect", "--encoding", decoding)
+		require.Equal(0, code, stderr)
+		assert.Contains(stdout, "algorithm:   box")
+		assert.Contains(stdout, "kid:         test")
+
+		code, stdout, stderr = runCommand(envelope, "decrypt", "--config", decryptConfig, "--encoding", decoding)
+		require.Equal(0, code, stderr)
+		assert.Equal("hello", stdout)
+	}
+
+	code, stdout, _ := runCommand("", "config-validate", "--config", decryptConfig)
+	assert.Equal(0, code)
+	assert.Contains(stdout, "is valid")
+	code, _, stderr := runCommand("", "config-validate", "--config", badConfig)
+	assert.Equal(1, code)
+	assert.Contains(stderr, "1 problems")
+
+	code, _, _ = runCommand("garbage", "inspect")
+	assert.Equal(1, code)
+	code, _, _ = runCommand("", "decrypt")
+	assert.Equal(1, code, "no config")
+	code, _, _ = runCommand("", "rot13")
+	assert.Equal(2, code)
+	code, _, _ = runCommand("")
+	assert.Equal(2, code)
+	code, stdout, _ = runCommand("", "help")
+	assert.Equal(0, code)
+	assert.Contains(stdout, "config-validate")
+}
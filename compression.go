@@ -0,0 +1,111 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Compression is how a message was compressed before it was encrypted.
+//
+// Compressing before encrypting leaks how well the message compresses
+// through the length of the ciphertext.  When a message mixes secrets with
+// data an attacker controls, like a token next to a user supplied field, the
+// attacker can learn the secret a byte at a time by watching the size change
+// (the CRIME and BREACH attacks).  Only compress messages where that can't
+// happen, and seal sensitive messages without compression.
+type Compression string
+
+const (
+	// NoCompression leaves the message as it is.
+	NoCompression Compression = ""
+
+	// Gzip compresses the message with gzip.
+	Gzip Compression = "gzip"
+)
+
+// MaxDecompressedSize is the largest message a compressed envelope can open
+// to, so a small envelope can't expand into an unbounded amount of memory.
+const MaxDecompressedSize = 64 * 1024 * 1024
+
+// SealOption configures how SealEnvelope and SealEnvelopeWithAD seal a
+// message.
+type SealOption func(*sealOptions)
+
+type sealOptions struct {
+	compression Compression
+}
+
+// WithCompression compresses the message before it's encrypted.  The
+// compression is recorded in the envelope and reversed when it's opened.  If
+// compressing doesn't make the message smaller it's sealed uncompressed.
+// Leave it out for messages that hold secrets; see Compression.
+func WithCompression(compression Compression) SealOption {
+	return func(o *sealOptions) {
+		o.compression = compression
+	}
+}
+
+// compress returns the compressed message and how it was compressed, or the
+// message itself if compressing doesn't help.
+func compress(compression Compression, message []byte) ([]byte, Compression, error) {
+	switch compression {
+	case NoCompression:
+		return message, NoCompression, nil
+	case Gzip:
+		var buffer bytes.Buffer
+		w := gzip.NewWriter(&buffer)
+		if _, err := w.Write(message); err != nil {
+			return nil, "", err
+		}
+		if err := w.Close(); err != nil {
+			return nil, "", err
+		}
+		if buffer.Len() >= len(message) {
+			return message, NoCompression, nil
+		}
+		return buffer.Bytes(), Gzip, nil
+	}
+	return nil, "", errors.New("unknown compression " + string(compression))
+}
+
+func decompress(compression Compression, data []byte) ([]byte, error) {
+	switch compression {
+	case NoCompression:
+		return data, nil
+	case Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress message: %w", err)
+		}
+		message, err := ioutil.ReadAll(io.LimitReader(r, MaxDecompressedSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress message: %w", err)
+		}
+		if len(message) > MaxDecompressedSize {
+			return nil, errors.New("decompressed message is too large")
+		}
+		return message, nil
+	}
+	return nil, errors.New("unknown compression " + string(compression))
+}
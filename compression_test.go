@@ -0,0 +1,102 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelopeCompression(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := loadBoxPair(t)
+	telemetry := []byte(strings.Repeat(`{"device":"mac:112233445566","event":"online"},`, 100))
+
+	envelope, err := SealEnvelope(encrypter, telemetry, WithCompression(Gzip))
+	require.Nil(err)
+	assert.Equal(Gzip, envelope.Compression)
+	assert.True(len(envelope.Cipher) < len(telemetry)/4)
+
+	data, err := envelope.MarshalBinary()
+	require.Nil(err)
+	version, err := EnvelopeVersionOf(data)
+	require.Nil(err)
+	assert.Equal(EnvelopeVersion2, version)
+	message, err := DecryptEnvelope(decrypter, data)
+	require.Nil(err)
+	assert.Equal(telemetry, message)
+
+	_, err = envelope.MarshalBinaryVersion(EnvelopeVersion1)
+	assert.NotNil(err, "version 1 can't record compression")
+
+	// compression is chosen per message
+	envelope, err = SealEnvelope(encrypter, telemetry)
+	require.Nil(err)
+	assert.Equal(NoCompression, envelope.Compression)
+	data, err = envelope.MarshalBinary()
+	require.Nil(err)
+	version, err = EnvelopeVersionOf(data)
+	require.Nil(err)
+	assert.Equal(EnvelopeVersion1, version)
+
+	// messages that don't shrink are left alone
+	envelope, err = SealEnvelope(encrypter, []byte("hi"), WithCompression(Gzip))
+	require.Nil(err)
+	assert.Equal(NoCompression, envelope.Compression)
+
+	envelope, err = SealEnvelopeWithAD(encrypter, telemetry, []byte("device"), WithCompression(Gzip))
+	require.Nil(err)
+	message, err = envelope.OpenWithAD(decrypter, []byte("device"))
+	require.Nil(err)
+	assert.Equal(telemetry, message)
+
+	envelope, err = SealEnvelope(encrypter, telemetry, WithCompression(Gzip))
+	require.Nil(err)
+	reencrypted, err := ReEncrypt(decrypter, encrypter, envelope)
+	require.Nil(err)
+	assert.Equal(Gzip, reencrypted.Compression)
+
+	envelope.Compression = "zstd"
+	_, err = envelope.Open(decrypter)
+	assert.NotNil(err)
+	_, err = SealEnvelope(encrypter, telemetry, WithCompression("zstd"))
+	assert.NotNil(err)
+}
+
+func TestDecompressLimit(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var buffer bytes.Buffer
+	w := gzip.NewWriter(&buffer)
+	_, err := w.Write(make([]byte, MaxDecompressedSize+1))
+	require.Nil(err)
+	require.Nil(w.Close())
+
+	_, err = decompress(Gzip, buffer.Bytes())
+	assert.NotNil(err)
+	_, err = decompress(Gzip, []byte("not gzip"))
+	assert.NotNil(err)
+}
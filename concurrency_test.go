@@ -0,0 +1,157 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// These tests are meant to be run with -race.
+
+const concurrentCalls = 16
+
+func rsaPair(t testing.TB) (Encrypt, Decrypt) {
+	require := require.New(t)
+
+	// the keys on disk are too big to be used this often
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(err)
+	publicKey := &privateKey.PublicKey
+	encrypter, err := NewRSAEncrypt(publicKey, WithSigningKey(privateKey))
+	require.Nil(err)
+	decrypter, err := NewRSADecrypt(privateKey, WithVerifyKey(publicKey))
+	require.Nil(err)
+	return encrypter, decrypter
+}
+
+func TestConcurrentCiphers(t *testing.T) {
+	boxEncrypter, boxDecrypter := loadBoxPair(t)
+	rsaEncrypter, rsaDecrypter := rsaPair(t)
+
+	testData := []struct {
+		description string
+		encrypter   Encrypt
+		decrypter   Decrypt
+	}{
+		{"noop", DefaultCipherEncrypter(), DefaultCipherDecrypter()},
+		{"box", boxEncrypter, boxDecrypter},
+		{"rsa", rsaEncrypter, rsaDecrypter},
+		{"fallback", boxEncrypter, &fallbackDecrypter{decrypters: []Decrypt{rsaDecrypter, boxDecrypter}}},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			var wg sync.WaitGroup
+			errs := make(chan error, concurrentCalls)
+			for i := 0; i < concurrentCalls; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					message := []byte("message " + strconv.Itoa(i))
+					cipher, nonce, err := tc.encrypter.EncryptMessage(message)
+					if err == nil {
+						var decrypted []byte
+						decrypted, err = tc.decrypter.DecryptMessage(cipher, nonce)
+						if err == nil && string(decrypted) != string(message) {
+							err = errors.New("got " + string(decrypted))
+						}
+					}
+					errs <- err
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				assert.Nil(t, err)
+			}
+		})
+	}
+}
+
+func TestConcurrentClose(t *testing.T) {
+	boxEncrypter, boxDecrypter := loadBoxPair(t)
+	rsaEncrypter, rsaDecrypter := rsaPair(t)
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	signer := NewEd25519Signer(privateKey, "")
+
+	calls := []struct {
+		description string
+		cipher      Identification
+		call        func() error
+	}{
+		{"box encrypt", boxEncrypter, func() error {
+			_, _, err := boxEncrypter.EncryptMessage([]byte("message"))
+			return err
+		}},
+		{"box decrypt", boxDecrypter, func() error {
+			_, err := boxDecrypter.DecryptMessage([]byte("cipher"), make([]byte, 24))
+			if errors.Is(err, ErrDecryptFailed) {
+				return nil
+			}
+			return err
+		}},
+		{"rsa encrypt", rsaEncrypter, func() error {
+			_, _, err := rsaEncrypter.EncryptMessage([]byte("message"))
+			return err
+		}},
+		{"rsa decrypt", rsaDecrypter, func() error {
+			_, err := rsaDecrypter.DecryptMessage([]byte("cipher"), nil)
+			if errors.Is(err, ErrDecryptFailed) {
+				return nil
+			}
+			return err
+		}},
+		{"ed25519 sign", signer, func() error {
+			_, err := signer.SignMessage([]byte("message"))
+			return err
+		}},
+	}
+
+	for _, tc := range calls {
+		t.Run(tc.description, func(t *testing.T) {
+			var wg sync.WaitGroup
+			errs := make(chan error, concurrentCalls)
+			for i := 0; i < concurrentCalls; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs <- tc.call()
+				}()
+			}
+			assert.Nil(t, CloseCipher(tc.cipher))
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					assert.Equal(t, errCipherClosed, err)
+				}
+			}
+			assert.Equal(t, errCipherClosed, tc.call())
+		})
+	}
+}
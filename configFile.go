@@ -0,0 +1,98 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultEnvPrefix is the prefix of the environment variables
+// LoadConfigFromFile applies.
+const DefaultEnvPrefix = "VOYNICRYPTO"
+
+// LoadConfigFromFile reads a single Config from a JSON, YAML or TOML file,
+// chosen by the file extension, and then applies the environment overrides
+// described by ApplyEnv using DefaultEnvPrefix.  For example:
+//
+//	type: rsa-sym
+//	kid: mykey
+//	params:
+//	  hash: SHA512
+//	keys:
+//	  publicKey: public.pem
+//
+// with VOYNICRYPTO_KEYS_PUBLIC_KEY=/etc/keys/public.pem set loads the public
+// key from /etc/keys/public.pem instead.
+func LoadConfigFromFile(path string) (Config, error) {
+	var config Config
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return config, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	if err := v.Unmarshal(&config); err != nil {
+		return config, fmt.Errorf("failed to decode config %s: %w", path, err)
+	}
+	config.normalize()
+	config.ApplyEnv(DefaultEnvPrefix)
+	return config, nil
+}
+
+// ApplyEnv overrides the config with environment variables that start with
+// the prefix:
+//
+//	<prefix>_TYPE          sets Type
+//	<prefix>_KID           sets KID
+//	<prefix>_KEYS_<key>    sets the path of a key, like <prefix>_KEYS_SENDER_PRIVATE_KEY
+//	<prefix>_PARAMS_<name> sets a param, like <prefix>_PARAMS_HASH
+//
+// Key names match regardless of case and underscores, and param names are
+// lowercased.
+func (config *Config) ApplyEnv(prefix string) {
+	prefix = strings.ToUpper(prefix) + "_"
+	for _, env := range os.Environ() {
+		i := strings.IndexByte(env, '=')
+		if i < 0 || !strings.HasPrefix(strings.ToUpper(env[:i]), prefix) {
+			continue
+		}
+		name, value := strings.ToUpper(env[len(prefix):i]), env[i+1:]
+
+		switch {
+		case name == "TYPE":
+			config.Type = canonicalAlgorithmType(value)
+		case name == "KID":
+			config.KID = value
+		case strings.HasPrefix(name, "KEYS_") && len(name) > len("KEYS_"):
+			if config.Keys == nil {
+				config.Keys = map[KeyType]string{}
+			}
+			keyType, _ := ParseKeyType(name[len("KEYS_"):])
+			config.Keys[keyType] = value
+		case strings.HasPrefix(name, "PARAMS_") && len(name) > len("PARAMS_"):
+			if config.Params == nil {
+				config.Params = map[string]string{}
+			}
+			config.Params[strings.ToLower(name[len("PARAMS_"):])] = value
+		}
+	}
+}
@@ -0,0 +1,88 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigFromFile(t *testing.T) {
+	dir, err := os.Getwd()
+	require.Nil(t, err)
+	publicPath := dir + string(os.PathSeparator) + "public.pem"
+	privatePath := dir + string(os.PathSeparator) + "private.pem"
+
+	testData := []struct {
+		name     string
+		contents string
+	}{
+		{"cipher.json", `{"type": "rsa-sym", "kid": "json", "params": {"hash": "SHA512"}, "keys": {"publicKey": "` + publicPath + `", "privateKey": "` + privatePath + `"}}`},
+		{"cipher.yaml", "type: RSA-Sym\nkid: yaml\nparams:\n  hash: SHA512\nkeys:\n  PublicKey: " + publicPath + "\n  privateKey: " + privatePath + "\n"},
+		{"cipher.toml", "type = \"rsa-sym\"\nkid = \"toml\"\n[params]\nhash = \"SHA512\"\n[keys]\npublicKey = \"" + publicPath + "\"\nprivateKey = \"" + privatePath + "\"\n"},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+
+			path := filepath.Join(t.TempDir(), tc.name)
+			require.Nil(ioutil.WriteFile(path, []byte(tc.contents), 0600))
+
+			config, err := LoadConfigFromFile(path)
+			require.Nil(err)
+			require.Equal(RSASymmetric, config.Type)
+			require.Equal(publicPath, config.Keys[PublicKey])
+			testOptions(t, config, true)
+		})
+	}
+
+	_, err = LoadConfigFromFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.NotNil(t, err)
+}
+
+func TestApplyEnv(t *testing.T) {
+	assert := assert.New(t)
+
+	env := map[string]string{
+		"VOYNICRYPTO_TEST_TYPE":                    "Box",
+		"VOYNICRYPTO_TEST_KID":                     "from-env",
+		"VOYNICRYPTO_TEST_KEYS_SENDER_PRIVATE_KEY": "sender.pem",
+		"VOYNICRYPTO_TEST_KEYS_RECIPIENTPUBLICKEY": "recipient.pem",
+		"VOYNICRYPTO_TEST_PARAMS_HASH":             "SHA512",
+		"VOYNICRYPTO_TEST_PARAMS_":                 "ignored",
+		"VOYNICRYPTO_TEST_OTHER":                   "ignored",
+	}
+	for name, value := range env {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+
+	config := Config{Type: None, Keys: map[KeyType]string{SenderPrivateKey: "old.pem"}}
+	config.ApplyEnv("voynicrypto_test")
+
+	assert.Equal(Box, config.Type)
+	assert.Equal("from-env", config.KID)
+	assert.Equal(map[KeyType]string{SenderPrivateKey: "sender.pem", RecipientPublicKey: "recipient.pem"}, config.Keys)
+	assert.Equal(map[string]string{"hash": "SHA512"}, config.Params)
+}
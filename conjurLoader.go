@@ -0,0 +1,225 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultConjurTokenTTL is how long a Conjur access token is reused.  Conjur
+// tokens expire after 8 minutes, so this leaves room for clock skew.
+const DefaultConjurTokenTTL = 5 * time.Minute
+
+// maxConjurResponseSize limits how much of a Conjur response is read.
+const maxConjurResponseSize = 1 << 20
+
+// ConjurLoader loads a key stored as a variable in CyberArk Conjur.
+//
+// It authenticates with either an API key (authn) or a JWT (authn-jwt).  The
+// credentials come from KeyLoaders so they can be read from an environment
+// variable, a file, or any other loader.
+type ConjurLoader struct {
+	// URL is the base URL of the Conjur appliance, like https://conjur.example.com.
+	URL string
+
+	// Account is the Conjur organization account.
+	Account string
+
+	// VariableID is the id of the variable holding the key, like prod/voynicrypto/private-key.
+	VariableID string
+
+	// Login is the host or user to authenticate as when using an API key,
+	// like host/prod/my-service.
+	Login string
+
+	// APIKey loads the API key for Login.
+	APIKey KeyLoader
+
+	// ServiceID is the id of the authn-jwt authenticator.  It must be set
+	// when authenticating with JWT.
+	ServiceID string
+
+	// JWT loads the JWT used with the authn-jwt authenticator.  When set, it
+	// is used instead of Login and APIKey.
+	JWT KeyLoader
+
+	// Client is the http client used to talk to Conjur.  If not supplied,
+	// http.DefaultClient is used instead.
+	Client *http.Client
+
+	// TokenTTL is how long an access token is reused.  If not supplied,
+	// DefaultConjurTokenTTL is used instead.
+	TokenTTL time.Duration
+
+	lock    sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// GetBytes returns the value of the variable.
+func (c *ConjurLoader) GetBytes() ([]byte, error) {
+	return c.GetBytesContext(context.Background())
+}
+
+// GetBytesContext returns the value of the variable, passing the context to
+// the http requests.
+func (c *ConjurLoader) GetBytesContext(ctx context.Context) ([]byte, error) {
+	if c.URL == "" || c.Account == "" || c.VariableID == "" {
+		return nil, errors.New("conjur url, account and variable id are required")
+	}
+
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate with conjur: %w", err)
+	}
+
+	request, err := http.NewRequest(http.MethodGet,
+		c.endpoint("secrets", c.Account, "variable", c.VariableID), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", `Token token="`+token+`"`)
+
+	data, err := c.do(ctx, request)
+	if err != nil {
+		if errors.Is(err, errConjurUnauthorized) {
+			// the token may have been revoked, get a new one next time
+			c.lock.Lock()
+			c.token = ""
+			c.lock.Unlock()
+		}
+		return nil, fmt.Errorf("failed to get conjur variable %s: %w", c.VariableID, err)
+	}
+	if len(data) == 0 {
+		return nil, errors.New("conjur variable " + c.VariableID + " is empty")
+	}
+	return data, nil
+}
+
+var errConjurUnauthorized = errors.New("unauthorized")
+
+// accessToken returns a base64 encoded access token, authenticating if the
+// cached token expired.
+func (c *ConjurLoader) accessToken(ctx context.Context) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.token != "" && time.Now().Before(c.expires) {
+		return c.token, nil
+	}
+
+	request, err := c.authenticateRequest(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := c.do(ctx, request)
+	if err != nil {
+		return "", err
+	}
+
+	ttl := c.TokenTTL
+	if ttl <= 0 {
+		ttl = DefaultConjurTokenTTL
+	}
+	c.token = base64.StdEncoding.EncodeToString(data)
+	c.expires = time.Now().Add(ttl)
+	return c.token, nil
+}
+
+func (c *ConjurLoader) authenticateRequest(ctx context.Context) (*http.Request, error) {
+	if c.JWT != nil {
+		if c.ServiceID == "" {
+			return nil, errors.New("conjur service id is required for jwt authentication")
+		}
+		jwt, err := GetKeyBytes(ctx, c.JWT)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load jwt: %w", err)
+		}
+		form := url.Values{"jwt": {strings.TrimSpace(string(jwt))}}
+		request, err := http.NewRequest(http.MethodPost,
+			c.endpoint("authn-jwt", c.ServiceID, c.Account, "authenticate"),
+			strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return request, nil
+	}
+
+	if c.Login == "" || c.APIKey == nil {
+		return nil, errors.New("conjur login and api key are required")
+	}
+	apiKey, err := GetKeyBytes(ctx, c.APIKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load api key: %w", err)
+	}
+	request, err := http.NewRequest(http.MethodPost,
+		c.endpoint("authn", c.Account, c.Login, "authenticate"),
+		bytes.NewReader(bytes.TrimSpace(apiKey)))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "text/plain")
+	return request, nil
+}
+
+func (c *ConjurLoader) endpoint(parts ...string) string {
+	escaped := make([]string, len(parts))
+	for i, part := range parts {
+		escaped[i] = url.PathEscape(part)
+	}
+	return strings.TrimRight(c.URL, "/") + "/" + strings.Join(escaped, "/")
+}
+
+func (c *ConjurLoader) do(ctx context.Context, request *http.Request) ([]byte, error) {
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	response, err := client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(response.Body, maxConjurResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case response.StatusCode == http.StatusUnauthorized:
+		return nil, errConjurUnauthorized
+	case response.StatusCode < 200 || response.StatusCode > 299:
+		return nil, fmt.Errorf("conjur responded with status %d", response.StatusCode)
+	}
+	return data, nil
+}
@@ -0,0 +1,145 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const conjurTestToken = `{"protected":"abc","payload":"def","signature":"ghi"}`
+
+func newConjurServer(t *testing.T, authentications *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch r.URL.EscapedPath() {
+		case "/authn/myorg/host%2Fprod%2Fservice/authenticate":
+			*authentications++
+			if r.Method != http.MethodPost || string(body) != "secret-api-key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(conjurTestToken))
+		case "/authn-jwt/k8s/myorg/authenticate":
+			*authentications++
+			form, _ := url.ParseQuery(string(body))
+			if r.Method != http.MethodPost || form.Get("jwt") != "my.jwt.token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(conjurTestToken))
+		case "/secrets/myorg/variable/prod%2Fkeys%2Fprivate":
+			expected := `Token token="` + base64.StdEncoding.EncodeToString([]byte(conjurTestToken)) + `"`
+			if r.Header.Get("Authorization") != expected {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte("the key"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestConjurLoaderAPIKey(t *testing.T) {
+	assert := assert.New(t)
+
+	var authentications int
+	server := newConjurServer(t, &authentications)
+	defer server.Close()
+
+	loader := &ConjurLoader{
+		URL:        server.URL + "/",
+		Account:    "myorg",
+		VariableID: "prod/keys/private",
+		Login:      "host/prod/service",
+		APIKey:     &BytesLoader{Data: []byte("secret-api-key\n")},
+		Client:     server.Client(),
+	}
+
+	data, err := loader.GetBytes()
+	assert.Nil(err)
+	assert.Equal([]byte("the key"), data)
+
+	// the token is reused
+	data, err = loader.GetBytes()
+	assert.Nil(err)
+	assert.Equal([]byte("the key"), data)
+	assert.Equal(1, authentications)
+
+	loader = &ConjurLoader{
+		URL:        server.URL,
+		Account:    "myorg",
+		VariableID: "prod/keys/private",
+		Login:      "host/prod/service",
+		APIKey:     &BytesLoader{Data: []byte("wrong-api-key")},
+		Client:     server.Client(),
+	}
+	_, err = loader.GetBytes()
+	assert.NotNil(err)
+}
+
+func TestConjurLoaderJWT(t *testing.T) {
+	assert := assert.New(t)
+
+	var authentications int
+	server := newConjurServer(t, &authentications)
+	defer server.Close()
+
+	loader := &ConjurLoader{
+		URL:        server.URL,
+		Account:    "myorg",
+		VariableID: "prod/keys/private",
+		ServiceID:  "k8s",
+		JWT:        &BytesLoader{Data: []byte("my.jwt.token")},
+		Client:     server.Client(),
+	}
+
+	data, err := loader.GetBytes()
+	assert.Nil(err)
+	assert.Equal([]byte("the key"), data)
+
+	loader.VariableID = "prod/keys/missing"
+	_, err = loader.GetBytes()
+	assert.NotNil(err)
+}
+
+func TestConjurLoaderMisconfigured(t *testing.T) {
+	testData := []struct {
+		description string
+		loader      *ConjurLoader
+	}{
+		{"no url", &ConjurLoader{Account: "myorg", VariableID: "key"}},
+		{"no credentials", &ConjurLoader{URL: "http://localhost", Account: "myorg", VariableID: "key"}},
+		{"jwt without service", &ConjurLoader{URL: "http://localhost", Account: "myorg", VariableID: "key", JWT: &BytesLoader{}}},
+		{"bad api key loader", &ConjurLoader{URL: "http://localhost", Account: "myorg", VariableID: "key", Login: "me", APIKey: errLoader{}}},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := tc.loader.GetBytes()
+			assert.NotNil(t, err)
+		})
+	}
+}
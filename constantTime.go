@@ -0,0 +1,36 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import "crypto/subtle"
+
+// secretEqual reports whether a and b are equal in time that only depends on
+// their lengths, so a mismatch doesn't reveal where it is.  Secrets, MACs and
+// chunk ids are compared with it.
+func secretEqual(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+// equalKID compares KIDs like secretEqual, where a cipher checks that an
+// envelope or message names its own KID.  A KID can name a tenant, and a
+// comparison that stops at the first difference lets a caller guess one a
+// byte at a time.  Finding a cipher by KID, as Ciphers and Router do, is a
+// map lookup and isn't constant time.
+func equalKID(a, b string) bool {
+	return secretEqual([]byte(a), []byte(b))
+}
@@ -0,0 +1,46 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretEqual(t *testing.T) {
+	testData := []struct {
+		a, b  string
+		equal bool
+	}{
+		{"", "", true},
+		{"kid-1", "kid-1", true},
+		{"kid-1", "kid-2", false},
+		{"kid-1", "xid-1", false},
+		{"kid-1", "kid-10", false},
+		{"", "kid", false},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.a+"/"+tc.b, func(t *testing.T) {
+			assert := assert.New(t)
+			assert.Equal(tc.equal, secretEqual([]byte(tc.a), []byte(tc.b)))
+			assert.Equal(tc.equal, equalKID(tc.a, tc.b))
+		})
+	}
+}
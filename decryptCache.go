@@ -0,0 +1,210 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// DefaultDecryptCacheEntries is the number of messages a decrypt cache holds
+// when DecryptCacheOptions.MaxEntries isn't set.
+const DefaultDecryptCacheEntries = 1024
+
+// DecryptCacheOptions configures CachedDecrypt.
+type DecryptCacheOptions struct {
+	// MaxEntries is the most messages kept.  If not supplied,
+	// DefaultDecryptCacheEntries is used instead.
+	MaxEntries int
+
+	// MaxBytes is the most plaintext bytes kept.  Zero means no limit.
+	// Messages larger than it are never cached.
+	MaxBytes int
+
+	// TTL is how long a message is kept after it's decrypted.  Zero means
+	// messages are only evicted to stay within the limits.
+	TTL time.Duration
+}
+
+// CachedDecrypt returns a Decrypt that remembers the plaintext of the
+// messages the decrypter opened, keyed by a hash of the cipher, nonce and
+// associated data, and returns it when the same message is decrypted again.
+// It's meant for read-heavy services that decrypt the same stored blobs over
+// and over.  The least recently used messages are evicted to stay within the
+// limits, and messages older than the TTL are decrypted again.  Failures
+// aren't cached.
+//
+// The cache keeps plaintext in memory for as long as it holds a message, so
+// only use it where that is acceptable.  CloseCipher wipes the cached
+// plaintext and closes the decrypter.
+func CachedDecrypt(decrypter Decrypt, options DecryptCacheOptions) Decrypt {
+	if options.MaxEntries <= 0 {
+		options.MaxEntries = DefaultDecryptCacheEntries
+	}
+	return &cachedDecrypter{
+		decrypter: decrypter,
+		options:   options,
+		entries:   map[[sha256.Size]byte]*list.Element{},
+		order:     list.New(),
+		now:       time.Now,
+	}
+}
+
+type cacheEntry struct {
+	key     [sha256.Size]byte
+	message []byte
+	expires time.Time
+}
+
+type cachedDecrypter struct {
+	decrypter Decrypt
+	options   DecryptCacheOptions
+	now       func() time.Time
+
+	lock    sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	order   *list.List
+	bytes   int
+}
+
+// cacheKey hashes each input prefixed with its length, so different splits
+// of the same bytes don't collide.
+func cacheKey(cipher []byte, nonce []byte, ad []byte) [sha256.Size]byte {
+	h := sha256.New()
+	for _, field := range [][]byte{cipher, nonce, ad} {
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(len(field))))
+		h.Write(field)
+	}
+	var key [sha256.Size]byte
+	h.Sum(key[:0])
+	return key
+}
+
+func (c *cachedDecrypter) get(key [sha256.Size]byte) ([]byte, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if c.options.TTL > 0 && !c.now().Before(entry.expires) {
+		c.remove(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return append([]byte{}, entry.message...), true
+}
+
+func (c *cachedDecrypter) put(key [sha256.Size]byte, message []byte) {
+	if c.options.MaxBytes > 0 && len(message) > c.options.MaxBytes {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	entry := &cacheEntry{key: key, message: append([]byte{}, message...)}
+	if c.options.TTL > 0 {
+		entry.expires = c.now().Add(c.options.TTL)
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	c.bytes += len(message)
+
+	for c.order.Len() > c.options.MaxEntries || (c.options.MaxBytes > 0 && c.bytes > c.options.MaxBytes) {
+		c.remove(c.order.Back())
+	}
+}
+
+// remove evicts an entry.  The lock must be held.
+func (c *cachedDecrypter) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= len(entry.message)
+	wipe(entry.message)
+}
+
+func (c *cachedDecrypter) decrypt(cipher []byte, nonce []byte, ad []byte, decrypt func() ([]byte, error)) ([]byte, error) {
+	key := cacheKey(cipher, nonce, ad)
+	if message, ok := c.get(key); ok {
+		return message, nil
+	}
+	message, err := decrypt()
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, message)
+	return message, nil
+}
+
+// GetAlgorithm returns the algorithm of the decrypter.
+func (c *cachedDecrypter) GetAlgorithm() AlgorithmType {
+	return c.decrypter.GetAlgorithm()
+}
+
+// GetKID returns the KID of the decrypter.
+func (c *cachedDecrypter) GetKID() string {
+	return c.decrypter.GetKID()
+}
+
+// DecryptMessage returns the cached message, or decrypts and caches it.
+func (c *cachedDecrypter) DecryptMessage(cipher []byte, nonce []byte) ([]byte, error) {
+	return c.decrypt(cipher, nonce, nil, func() ([]byte, error) {
+		return c.decrypter.DecryptMessage(cipher, nonce)
+	})
+}
+
+// DecryptMessageContext returns the cached message, or decrypts it with the
+// context and caches it.
+func (c *cachedDecrypter) DecryptMessageContext(ctx context.Context, cipher []byte, nonce []byte) ([]byte, error) {
+	return c.decrypt(cipher, nonce, nil, func() ([]byte, error) {
+		return DecryptMessageContext(ctx, c.decrypter, cipher, nonce)
+	})
+}
+
+// DecryptMessageWithAD returns the cached message, or decrypts it with the
+// associated data and caches it.
+func (c *cachedDecrypter) DecryptMessageWithAD(cipher []byte, nonce []byte, ad []byte) ([]byte, error) {
+	return c.decrypt(cipher, nonce, ad, func() ([]byte, error) {
+		return DecryptMessageWithAD(c.decrypter, cipher, nonce, ad)
+	})
+}
+
+// Metadata returns the metadata of the decrypter, if it has any.
+func (c *cachedDecrypter) Metadata() Metadata {
+	m, _ := GetMetadata(c.decrypter)
+	return m
+}
+
+// Close wipes the cache and closes the decrypter.
+func (c *cachedDecrypter) Close() error {
+	c.lock.Lock()
+	for c.order.Len() > 0 {
+		c.remove(c.order.Back())
+	}
+	c.lock.Unlock()
+	return CloseCipher(c.decrypter)
+}
@@ -0,0 +1,144 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingDecrypter counts the messages it decrypts.
+type countingDecrypter struct {
+	Decrypt
+	count int32
+}
+
+func (c *countingDecrypter) DecryptMessage(cipher []byte, nonce []byte) ([]byte, error) {
+	atomic.AddInt32(&c.count, 1)
+	return c.Decrypt.DecryptMessage(cipher, nonce)
+}
+
+func (c *countingDecrypter) DecryptMessageWithAD(cipher []byte, nonce []byte, ad []byte) ([]byte, error) {
+	atomic.AddInt32(&c.count, 1)
+	return DecryptMessageWithAD(c.Decrypt, cipher, nonce, ad)
+}
+
+func (c *countingDecrypter) decrypted() int {
+	return int(atomic.LoadInt32(&c.count))
+}
+
+func TestCachedDecrypt(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, aesDecrypter := aesGCMPair(t)
+	counter := &countingDecrypter{Decrypt: aesDecrypter}
+	decrypter := CachedDecrypt(counter, DecryptCacheOptions{})
+	assert.Equal(AESGCM, decrypter.GetAlgorithm())
+	assert.Equal("k1", decrypter.GetKID())
+
+	cipher, nonce, err := encrypter.EncryptMessage([]byte("device metadata"))
+	require.Nil(err)
+	for i := 0; i < 3; i++ {
+		message, err := decrypter.DecryptMessage(cipher, nonce)
+		require.Nil(err)
+		assert.Equal("device metadata", string(message))
+		message[0] = 'X'
+	}
+	message, err := DecryptMessageContext(context.Background(), decrypter, cipher, nonce)
+	require.Nil(err)
+	assert.Equal("device metadata", string(message), "callers get their own copy")
+	assert.Equal(1, counter.decrypted())
+
+	adCipher, adNonce, err := EncryptMessageWithAD(encrypter, []byte("bound"), []byte("ad"))
+	require.Nil(err)
+	_, err = DecryptMessageWithAD(decrypter, adCipher, adNonce, []byte("other"))
+	assert.True(errors.Is(err, ErrDecryptFailed))
+	_, err = DecryptMessageWithAD(decrypter, adCipher, adNonce, []byte("other"))
+	assert.True(errors.Is(err, ErrDecryptFailed))
+	assert.Equal(3, counter.decrypted(), "failures aren't cached")
+	message, err = DecryptMessageWithAD(decrypter, adCipher, adNonce, []byte("ad"))
+	require.Nil(err)
+	assert.Equal("bound", string(message))
+
+	decrypter = CachedDecrypt(aesDecrypter, DecryptCacheOptions{})
+	metadata, ok := GetMetadata(decrypter)
+	assert.True(ok)
+	assert.True(metadata.Authenticated)
+	_, err = decrypter.DecryptMessage(cipher, nonce)
+	require.Nil(err)
+
+	require.Nil(CloseCipher(decrypter))
+	_, err = decrypter.DecryptMessage(cipher, nonce)
+	assert.Equal(errCipherClosed, err, "closing wipes the cache")
+}
+
+func TestCachedDecryptLimits(t *testing.T) {
+	encrypter, aesDecrypter := aesGCMPair(t)
+	seal := func(message string) [2][]byte {
+		cipher, nonce, err := encrypter.EncryptMessage([]byte(message))
+		require.Nil(t, err)
+		return [2][]byte{cipher, nonce}
+	}
+	first, second, large := seal("first"), seal("second"), seal("a much larger message")
+
+	testData := []struct {
+		description string
+		options     DecryptCacheOptions
+		advance     time.Duration
+		decrypts    [][2][]byte
+		expected    int
+	}{
+		{"hits", DecryptCacheOptions{}, 0, [][2][]byte{first, second, first, second}, 2},
+		{"max entries", DecryptCacheOptions{MaxEntries: 1}, 0, [][2][]byte{first, second, first}, 3},
+		{"lru", DecryptCacheOptions{MaxEntries: 2}, 0, [][2][]byte{first, second, first, large, first, second}, 4},
+		{"max bytes", DecryptCacheOptions{MaxBytes: 10}, 0, [][2][]byte{first, second, first, second}, 4},
+		{"too large", DecryptCacheOptions{MaxBytes: 10}, 0, [][2][]byte{large, large}, 2},
+		{"ttl", DecryptCacheOptions{TTL: time.Minute}, time.Minute, [][2][]byte{first, first, second}, 3},
+		{"within ttl", DecryptCacheOptions{TTL: time.Minute}, time.Second, [][2][]byte{first, first, second, second}, 2},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			counter := &countingDecrypter{Decrypt: aesDecrypter}
+			decrypter := CachedDecrypt(counter, tc.options).(*cachedDecrypter)
+			now := time.Now()
+			decrypter.now = func() time.Time {
+				return now
+			}
+			for _, message := range tc.decrypts {
+				_, err := decrypter.DecryptMessage(message[0], message[1])
+				require.Nil(err)
+				now = now.Add(tc.advance)
+			}
+			assert.Equal(tc.expected, counter.decrypted())
+			if tc.options.MaxBytes > 0 {
+				assert.LessOrEqual(decrypter.bytes, tc.options.MaxBytes)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	curves = map[string]elliptic.Curve{
+		"P-224":      elliptic.P224(),
+		"P224":       elliptic.P224(),
+		"SECP224R1":  elliptic.P224(),
+		"P-256":      elliptic.P256(),
+		"P256":       elliptic.P256(),
+		"SECP256R1":  elliptic.P256(),
+		"PRIME256V1": elliptic.P256(),
+		"P-384":      elliptic.P384(),
+		"P384":       elliptic.P384(),
+		"SECP384R1":  elliptic.P384(),
+		"P-521":      elliptic.P521(),
+		"P521":       elliptic.P521(),
+		"SECP521R1":  elliptic.P521(),
+	}
+)
+
+// ParseCurve finds the elliptic curve for the name given, like P-256 or
+// secp384r1.
+func ParseCurve(name string) (elliptic.Curve, error) {
+	if curve, ok := curves[strings.ToUpper(name)]; ok {
+		return curve, nil
+	}
+	return nil, errors.New("curve " + name + " not found")
+}
+
+func checkCurve(actual, expected elliptic.Curve) error {
+	if expected == nil || actual == expected {
+		return nil
+	}
+	return wrongKeyType("key uses curve %s, expected %s", actual.Params().Name, expected.Params().Name)
+}
+
+// GetECPrivateKey uses a keyloader to load an EC private key from a SEC1
+// (EC PRIVATE KEY) or PKCS#8 (PRIVATE KEY) pem block.  If curve is not nil,
+// the key must use that curve.
+func GetECPrivateKey(loader KeyLoader, curve elliptic.Curve) (*ecdsa.PrivateKey, error) {
+	return GetECPrivateKeyContext(context.Background(), loader, curve)
+}
+
+// GetECPrivateKeyContext uses a keyloader to load an EC private key, passing
+// the context to the loader.
+func GetECPrivateKeyContext(ctx context.Context, loader KeyLoader, curve elliptic.Curve) (*ecdsa.PrivateKey, error) {
+	data, err := GetKeyBytes(ctx, loader)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := parseECPrivateKey(data, curve)
+	if err != nil {
+		return nil, keyError(loader, err)
+	}
+	return privateKey, nil
+}
+
+func parseECPrivateKey(data []byte, curve elliptic.Curve) (*ecdsa.PrivateKey, error) {
+	privatePem, err := decodePEMBlock(data, "EC PRIVATE KEY", "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	var privateKey *ecdsa.PrivateKey
+	if privatePem.Type == "EC PRIVATE KEY" {
+		if privateKey, err = x509.ParseECPrivateKey(privatePem.Bytes); err != nil {
+			return nil, fmt.Errorf("%w: x509.ParseECPrivateKey: %w", ErrInvalidKey, err)
+		}
+	} else {
+		parsedKey, err := x509.ParsePKCS8PrivateKey(privatePem.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: x509.ParsePKCS8PrivateKey: %w", ErrInvalidKey, err)
+		}
+		var ok bool
+		if privateKey, ok = parsedKey.(*ecdsa.PrivateKey); !ok {
+			return nil, wrongKeyType("pkcs8 key is a %T, not an EC key", parsedKey)
+		}
+	}
+
+	if err := checkCurve(privateKey.Curve, curve); err != nil {
+		return nil, err
+	}
+	return privateKey, nil
+}
+
+// GetECPublicKey uses a keyloader to load an EC public key from a PKIX
+// (PUBLIC KEY) pem block.  If curve is not nil, the key must use that curve.
+func GetECPublicKey(loader KeyLoader, curve elliptic.Curve) (*ecdsa.PublicKey, error) {
+	return GetECPublicKeyContext(context.Background(), loader, curve)
+}
+
+// GetECPublicKeyContext uses a keyloader to load an EC public key, passing
+// the context to the loader.
+func GetECPublicKeyContext(ctx context.Context, loader KeyLoader, curve elliptic.Curve) (*ecdsa.PublicKey, error) {
+	data, err := GetKeyBytes(ctx, loader)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := parseECPublicKey(data, curve)
+	if err != nil {
+		return nil, keyError(loader, err)
+	}
+	return publicKey, nil
+}
+
+func parseECPublicKey(data []byte, curve elliptic.Curve) (*ecdsa.PublicKey, error) {
+	publicPem, err := decodePEMBlock(data, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	parsedKey, err := x509.ParsePKIXPublicKey(publicPem.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: x509.ParsePKIXPublicKey: %w", ErrInvalidKey, err)
+	}
+	publicKey, ok := parsedKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, wrongKeyType("pkix key is a %T, not an EC key", parsedKey)
+	}
+
+	if err := checkCurve(publicKey.Curve, curve); err != nil {
+		return nil, err
+	}
+	return publicKey, nil
+}
@@ -0,0 +1,116 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCurve(t *testing.T) {
+	assert := assert.New(t)
+
+	curve, err := ParseCurve("p-256")
+	assert.Nil(err)
+	assert.Equal(elliptic.P256(), curve)
+
+	curve, err = ParseCurve("secp384r1")
+	assert.Nil(err)
+	assert.Equal(elliptic.P384(), curve)
+
+	_, err = ParseCurve("curve25519")
+	assert.NotNil(err)
+}
+
+func TestGetECKeys(t *testing.T) {
+	require := require.New(t)
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(err)
+
+	sec1, err := x509.MarshalECPrivateKey(privateKey)
+	require.Nil(err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.Nil(err)
+	pkix, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.Nil(err)
+
+	rsaPKCS8, err := x509.MarshalPKCS8PrivateKey(GeneratePrivateKey(1024))
+	require.Nil(err)
+
+	privateTests := []struct {
+		description string
+		data        []byte
+		curve       elliptic.Curve
+		expectedErr bool
+	}{
+		{"sec1", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}), elliptic.P256(), false},
+		{"pkcs8", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), nil, false},
+		{"wrong curve", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}), elliptic.P384(), true},
+		{"rsa pkcs8", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: rsaPKCS8}), nil, true},
+		{"wrong pem type", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: sec1}), nil, true},
+		{"not pem", []byte("nope"), nil, true},
+	}
+
+	for _, tc := range privateTests {
+		t.Run("private "+tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			key, err := GetECPrivateKey(&BytesLoader{Data: tc.data}, tc.curve)
+			if tc.expectedErr {
+				assert.NotNil(err)
+				return
+			}
+			assert.Nil(err)
+			assert.True(privateKey.Equal(key))
+		})
+	}
+
+	publicTests := []struct {
+		description string
+		data        []byte
+		curve       elliptic.Curve
+		expectedErr bool
+	}{
+		{"pkix", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix}), elliptic.P256(), false},
+		{"wrong curve", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix}), elliptic.P521(), true},
+		{"wrong pem type", pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: pkix}), nil, true},
+		{"not pem", []byte("nope"), nil, true},
+	}
+
+	for _, tc := range publicTests {
+		t.Run("public "+tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			key, err := GetECPublicKey(&BytesLoader{Data: tc.data}, tc.curve)
+			if tc.expectedErr {
+				assert.NotNil(err)
+				return
+			}
+			assert.Nil(err)
+			assert.True(privateKey.PublicKey.Equal(key))
+		})
+	}
+}
@@ -0,0 +1,189 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// GetEd25519PrivateKey uses a keyloader to load an ed25519 private key.
+//
+// The key may be a PKCS#8 pem block (PRIVATE KEY), an unencrypted OpenSSH
+// private key, or the 32 byte seed (or 64 byte private key) as raw bytes, hex
+// or base64.
+func GetEd25519PrivateKey(loader KeyLoader) (ed25519.PrivateKey, error) {
+	return GetEd25519PrivateKeyContext(context.Background(), loader)
+}
+
+// GetEd25519PrivateKeyContext uses a keyloader to load an ed25519 private
+// key, passing the context to the loader.
+func GetEd25519PrivateKeyContext(ctx context.Context, loader KeyLoader) (ed25519.PrivateKey, error) {
+	data, err := GetKeyBytes(ctx, loader)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseEd25519PrivateKey(data)
+	if err != nil {
+		return nil, keyError(loader, err)
+	}
+	return key, nil
+}
+
+// ParseEd25519PrivateKey parses an ed25519 private key in any of the formats
+// GetEd25519PrivateKey supports.
+func ParseEd25519PrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, invalidKey("empty ed25519 private key")
+	}
+
+	if bytes.HasPrefix(trimmed, []byte("-----BEGIN")) {
+		block, err := decodePEMBlock(trimmed, "PRIVATE KEY", "OPENSSH PRIVATE KEY")
+		if err != nil {
+			return nil, err
+		}
+
+		switch block.Type {
+		case "PRIVATE KEY":
+			parsedKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%w: x509.ParsePKCS8PrivateKey: %w", ErrInvalidKey, err)
+			}
+			if key, ok := parsedKey.(ed25519.PrivateKey); ok {
+				return key, nil
+			}
+			return nil, wrongKeyType("pkcs8 key is a %T, not an ed25519 key", parsedKey)
+		case "OPENSSH PRIVATE KEY":
+			parsedKey, err := ssh.ParseRawPrivateKey(trimmed)
+			if err != nil {
+				return nil, fmt.Errorf("%w: ssh.ParseRawPrivateKey: %w", ErrInvalidKey, err)
+			}
+			if key, ok := parsedKey.(*ed25519.PrivateKey); ok {
+				return *key, nil
+			}
+			return nil, wrongKeyType("openssh key is a %T, not an ed25519 key", parsedKey)
+		}
+	}
+
+	// raw keys are only considered when the data is not valid hex or base64,
+	// which random key bytes practically never are.
+	if decoded, ok := decodeTextKey(trimmed); ok {
+		if key, valid := ed25519PrivateKeyFromBytes(decoded); valid {
+			return key, nil
+		}
+		return nil, invalidKey("ed25519 private key must be %d or %d bytes, got %d",
+			ed25519.SeedSize, ed25519.PrivateKeySize, len(decoded))
+	}
+	if key, valid := ed25519PrivateKeyFromBytes(data); valid {
+		return key, nil
+	}
+	return nil, invalidKey("unrecognized ed25519 private key format (%d bytes)", len(data))
+}
+
+func ed25519PrivateKeyFromBytes(data []byte) (ed25519.PrivateKey, bool) {
+	switch len(data) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(data), true
+	case ed25519.PrivateKeySize:
+		// the last half of the key is the public key, make sure it matches the seed
+		key := ed25519.NewKeyFromSeed(data[:ed25519.SeedSize])
+		if secretEqual(key, data) {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// GetEd25519PublicKey uses a keyloader to load an ed25519 public key.
+//
+// The key may be a PKIX pem block (PUBLIC KEY), an OpenSSH authorized key
+// line (ssh-ed25519 AAAA...), or the 32 byte key as raw bytes, hex or base64.
+func GetEd25519PublicKey(loader KeyLoader) (ed25519.PublicKey, error) {
+	return GetEd25519PublicKeyContext(context.Background(), loader)
+}
+
+// GetEd25519PublicKeyContext uses a keyloader to load an ed25519 public key,
+// passing the context to the loader.
+func GetEd25519PublicKeyContext(ctx context.Context, loader KeyLoader) (ed25519.PublicKey, error) {
+	data, err := GetKeyBytes(ctx, loader)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseEd25519PublicKey(data)
+	if err != nil {
+		return nil, keyError(loader, err)
+	}
+	return key, nil
+}
+
+// ParseEd25519PublicKey parses an ed25519 public key in any of the formats
+// GetEd25519PublicKey supports.
+func ParseEd25519PublicKey(data []byte) (ed25519.PublicKey, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, invalidKey("empty ed25519 public key")
+	}
+
+	if bytes.HasPrefix(trimmed, []byte("-----BEGIN")) {
+		block, err := decodePEMBlock(trimmed, "PUBLIC KEY")
+		if err != nil {
+			return nil, err
+		}
+		parsedKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: x509.ParsePKIXPublicKey: %w", ErrInvalidKey, err)
+		}
+		if key, ok := parsedKey.(ed25519.PublicKey); ok {
+			return key, nil
+		}
+		return nil, wrongKeyType("pkix key is a %T, not an ed25519 key", parsedKey)
+	}
+
+	if bytes.HasPrefix(trimmed, []byte(ssh.KeyAlgoED25519+" ")) {
+		sshKey, _, _, _, err := ssh.ParseAuthorizedKey(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("%w: ssh.ParseAuthorizedKey: %w", ErrInvalidKey, err)
+		}
+		cryptoKey, ok := sshKey.(ssh.CryptoPublicKey)
+		if !ok {
+			return nil, errors.New("openssh key does not expose its public key")
+		}
+		if key, ok := cryptoKey.CryptoPublicKey().(ed25519.PublicKey); ok {
+			return key, nil
+		}
+		return nil, wrongKeyType("openssh key is not an ed25519 key")
+	}
+
+	if decoded, ok := decodeTextKey(trimmed); ok {
+		if len(decoded) != ed25519.PublicKeySize {
+			return nil, invalidKey("ed25519 public key must be %d bytes, got %d", ed25519.PublicKeySize, len(decoded))
+		}
+		return ed25519.PublicKey(decoded), nil
+	}
+	if len(data) == ed25519.PublicKeySize {
+		return ed25519.PublicKey(data), nil
+	}
+	return nil, invalidKey("unrecognized ed25519 public key format (%d bytes)", len(data))
+}
@@ -0,0 +1,125 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestGetEd25519PrivateKey(t *testing.T) {
+	require := require.New(t)
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(err)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.Nil(err)
+
+	openssh, err := ssh.MarshalPrivateKey(privateKey, "")
+	require.Nil(err)
+
+	rsaKey := GeneratePrivateKey(1024)
+	rsaPKCS8, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	require.Nil(err)
+
+	testData := []struct {
+		description string
+		data        []byte
+		expectedErr bool
+	}{
+		{"pkcs8", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), false},
+		{"openssh", pem.EncodeToMemory(openssh), false},
+		{"raw seed", privateKey.Seed(), false},
+		{"raw private key", privateKey, false},
+		{"hex seed", []byte(hex.EncodeToString(privateKey.Seed())), false},
+		{"base64 seed", []byte(base64.StdEncoding.EncodeToString(privateKey.Seed())), false},
+		{"empty", []byte{}, true},
+		{"rsa pkcs8", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: rsaPKCS8}), true},
+		{"wrong pem type", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: rsaPKCS8}), true},
+		{"short hex", []byte(hex.EncodeToString(privateKey.Seed()[:16])), true},
+		{"mismatched public half", append(append([]byte{}, privateKey.Seed()...), make([]byte, 32)...), true},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			key, err := GetEd25519PrivateKey(&BytesLoader{Data: tc.data})
+			if tc.expectedErr {
+				assert.NotNil(err)
+				return
+			}
+			assert.Nil(err)
+			assert.Equal(privateKey, key)
+			assert.Equal(publicKey, key.Public())
+		})
+	}
+}
+
+func TestGetEd25519PublicKey(t *testing.T) {
+	require := require.New(t)
+
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(err)
+
+	pkix, err := x509.MarshalPKIXPublicKey(publicKey)
+	require.Nil(err)
+
+	sshKey, err := ssh.NewPublicKey(publicKey)
+	require.Nil(err)
+
+	testData := []struct {
+		description string
+		data        []byte
+		expectedErr bool
+	}{
+		{"pkix", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix}), false},
+		{"openssh", ssh.MarshalAuthorizedKey(sshKey), false},
+		{"raw", publicKey, false},
+		{"hex", []byte(hex.EncodeToString(publicKey)), false},
+		{"base64", []byte(base64.URLEncoding.EncodeToString(publicKey)), false},
+		{"empty", []byte(" "), true},
+		{"wrong pem type", pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: pkix}), true},
+		{"short", []byte(hex.EncodeToString(publicKey[:8])), true},
+		{"bad openssh", []byte("ssh-ed25519 nope"), true},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			key, err := GetEd25519PublicKey(&BytesLoader{Data: tc.data})
+			if tc.expectedErr {
+				assert.NotNil(err)
+				return
+			}
+			assert.Nil(err)
+			assert.Equal(publicKey, key)
+		})
+	}
+}
@@ -0,0 +1,115 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// rsaEncryptThenSignMode is the first byte of the signature of an
+// encrypt-then-sign message, followed by the signature of the ciphertext.
+// A signature of the message is exactly the size of the key, so a signature
+// one byte longer is one of the ciphertext.  The mode versions the signature,
+// so data signed either way stays readable.
+const rsaEncryptThenSignMode = 1
+
+// rsaEncryptThenSignContext starts the digest of the ciphertext, so it can't
+// be mistaken for the digest of a message.
+var rsaEncryptThenSignContext = []byte("voynicrypto-rsa-encrypt-then-sign")
+
+// WithEncryptThenSign makes an RSA encrypter that signs messages sign the
+// ciphertext and label instead of the message.  The signature no longer
+// depends on the message, and decrypters verify it before decrypting.  Every
+// RSA decrypter can verify both kinds of signature.
+func WithEncryptThenSign() CipherOption {
+	return func(o *cipherOptions) error {
+		o.encryptThenSign = true
+		return nil
+	}
+}
+
+// ciphertextDigest returns the digest an encrypt-then-sign signature signs in
+// a pooled buffer.  Give it back with putDigest.
+func (c *rsaEncrypterDecrypter) ciphertextDigest(cipher []byte, label []byte) *[]byte {
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(len(label)))
+
+	hasher := getHash(c.hasher)
+	hasher.Write(rsaEncryptThenSignContext)
+	hasher.Write(size[:])
+	hasher.Write(label)
+	hasher.Write(cipher)
+	digest := digestPool.Get().(*[]byte)
+	*digest = hasher.Sum((*digest)[:0])
+	putHash(c.hasher, hasher)
+	return digest
+}
+
+// sign signs the digest with the sender's private key.
+func (c *rsaEncrypterDecrypter) sign(digest []byte) ([]byte, error) {
+	var (
+		signature []byte
+		err       error
+	)
+	if poolErr := c.pool.run(context.Background(), RSAPoolSign, c, func() {
+		signature, err = rsa.SignPSS(randomOrDefault(c.random), c.senderPrivateKey, c.hasher, digest, rsaPSSOptions)
+	}); poolErr != nil {
+		return nil, poolErr
+	}
+	return signature, err
+}
+
+// encryptedThenSigned reports whether the signature is of the ciphertext
+// rather than the message, failing if it's neither.
+func (c *rsaEncrypterDecrypter) encryptedThenSigned(signature []byte) (bool, error) {
+	size := c.senderPublicKey.Size()
+	if len(signature) != size+1 {
+		return false, checkSignatureSize(signature, size)
+	}
+	if signature[0] != rsaEncryptThenSignMode {
+		return false, fmt.Errorf("%w: unknown signature mode %d", ErrSignatureInvalid, signature[0])
+	}
+	return true, nil
+}
+
+// verifyCiphertext checks an encrypt-then-sign signature.
+func (c *rsaEncrypterDecrypter) verifyCiphertext(cipher []byte, signature []byte, label []byte) error {
+	digest := c.ciphertextDigest(cipher, label)
+	err := rsa.VerifyPSS(c.senderPublicKey, c.hasher, *digest, signature[1:], rsaPSSOptions)
+	putDigest(digest)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSignatureInvalid, err)
+	}
+	return nil
+}
+
+// encryptThenSignParam returns the "encryptThenSign" param of an RSA config.
+func (config *Config) encryptThenSignParam() (bool, error) {
+	if config.Params["encryptThenSign"] == "" {
+		return false, nil
+	}
+	encryptThenSign, err := strconv.ParseBool(config.Params["encryptThenSign"])
+	if err != nil {
+		return false, fmt.Errorf("invalid encryptThenSign param: %w", err)
+	}
+	return encryptThenSign, nil
+}
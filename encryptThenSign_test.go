@@ -0,0 +1,143 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRSAEncryptThenSign(t *testing.T) {
+	recipientPrivateKey, err := GenerateRSAKey(0)
+	require.Nil(t, err)
+	senderPrivateKey, err := GenerateRSAKey(0)
+	require.Nil(t, err)
+
+	encryptThenSign, err := NewRSAEncrypt(&recipientPrivateKey.PublicKey, WithSigningKey(senderPrivateKey), WithEncryptThenSign())
+	require.Nil(t, err)
+	signThenEncrypt, err := NewRSAEncrypt(&recipientPrivateKey.PublicKey, WithSigningKey(senderPrivateKey))
+	require.Nil(t, err)
+	hybrid, err := NewRSAEncrypt(&recipientPrivateKey.PublicKey, WithSigningKey(senderPrivateKey), WithEncryptThenSign(), WithHybrid())
+	require.Nil(t, err)
+	decrypter, err := NewRSADecrypt(recipientPrivateKey, WithVerifyKey(&senderPrivateKey.PublicKey))
+	require.Nil(t, err)
+
+	m, _ := GetMetadata(encryptThenSign)
+	assert.Equal(t, senderPrivateKey.Size()+1, m.NonceSize)
+	testCryptoPair(t, encryptThenSign, decrypter, true)
+
+	testData := []struct {
+		description string
+		encrypter   Encrypt
+		message     []byte
+		signedFirst bool
+	}{
+		{"encrypt then sign", encryptThenSign, []byte("message"), false},
+		{"hybrid", hybrid, make([]byte, 4096), false},
+		{"sign then encrypt is still readable", signThenEncrypt, []byte("message"), true},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			crypt, signature, err := tc.encrypter.EncryptMessage(tc.message)
+			require.Nil(err)
+			if tc.signedFirst {
+				assert.Len(signature, senderPrivateKey.Size())
+			} else {
+				assert.Len(signature, senderPrivateKey.Size()+1)
+				assert.Equal(byte(rsaEncryptThenSignMode), signature[0])
+			}
+
+			decrypted, err := decrypter.DecryptMessage(crypt, signature)
+			require.Nil(err)
+			assert.Equal(tc.message, decrypted)
+
+			// a tampered ciphertext fails the signature before it's decrypted
+			crypt[0] ^= 0xff
+			_, err = decrypter.DecryptMessage(crypt, signature)
+			if tc.signedFirst {
+				assert.True(errors.Is(err, ErrDecryptFailed), "%v", err)
+			} else {
+				assert.True(errors.Is(err, ErrSignatureInvalid), "%v", err)
+			}
+		})
+	}
+
+	t.Run("unknown mode", func(t *testing.T) {
+		crypt, signature, err := encryptThenSign.EncryptMessage([]byte("message"))
+		require.Nil(t, err)
+		signature[0] = 2
+		_, err = decrypter.DecryptMessage(crypt, signature)
+		assert.True(t, errors.Is(err, ErrSignatureInvalid), "%v", err)
+	})
+
+	t.Run("associated data", func(t *testing.T) {
+		crypt, signature, err := EncryptMessageWithAD(encryptThenSign, []byte("message"), []byte("device"))
+		require.Nil(t, err)
+		decrypted, err := DecryptMessageWithAD(decrypter, crypt, signature, []byte("device"))
+		require.Nil(t, err)
+		assert.Equal(t, []byte("message"), decrypted)
+		_, err = DecryptMessageWithAD(decrypter, crypt, signature, []byte("other"))
+		assert.True(t, errors.Is(err, ErrSignatureInvalid), "%v", err)
+	})
+}
+
+func TestRSAEncryptThenSignConfig(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	privateKey, err := GenerateRSAKey(0)
+	require.Nil(err)
+	privateLoader := &BytesLoader{Data: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})}
+	publicLoader := &BytesLoader{Data: pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&privateKey.PublicKey)})}
+	config := Config{
+		Type:   RSAAsymmetric,
+		Params: map[string]string{"hash": "SHA512", "encryptThenSign": "true"},
+		Loaders: map[KeyType]KeyLoader{
+			SenderPrivateKey:    privateLoader,
+			RecipientPublicKey:  publicLoader,
+			RecipientPrivateKey: privateLoader,
+			SenderPublicKey:     publicLoader,
+		},
+	}
+	require.Nil(config.Validate())
+	encrypter, err := config.LoadEncrypt()
+	require.Nil(err)
+	decrypter, err := config.LoadDecrypt()
+	require.Nil(err)
+
+	crypt, signature, err := encrypter.EncryptMessage([]byte("message"))
+	require.Nil(err)
+	assert.Len(signature, privateKey.Size()+1)
+	decrypted, err := decrypter.DecryptMessage(crypt, signature)
+	require.Nil(err)
+	assert.Equal([]byte("message"), decrypted)
+
+	config.Params["encryptThenSign"] = "sometimes"
+	assert.NotNil(config.Validate())
+	_, err = config.LoadEncrypt()
+	assert.NotNil(err)
+}
@@ -0,0 +1,239 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// NewDecryptFS returns an fs.FS of the plaintext of the files of fsys, which
+// were written by EncryptStream, EncryptFile or WriteEncryptedFS.  Each file
+// is named with the suffix in fsys, like "app.yaml.enc", and without it in
+// the returned FS, like "app.yaml"; files without the suffix are hidden.
+// The suffix may be empty.  Directories are passed through.
+//
+// A file is decrypted in full when it's opened, so the FS suits config trees
+// and embedded assets rather than large files, and the files can be seeked,
+// which lets the FS be served with http.FS.
+func NewDecryptFS(fsys fs.FS, decrypter Decrypt, suffix string) fs.FS {
+	return &decryptFS{fsys: fsys, decrypter: decrypter, suffix: suffix}
+}
+
+type decryptFS struct {
+	fsys      fs.FS
+	decrypter Decrypt
+	suffix    string
+}
+
+// Open opens a directory of the underlying FS, or decrypts a file.
+func (d *decryptFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if info, err := fs.Stat(d.fsys, name); err == nil && info.IsDir() {
+		file, err := d.fsys.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return &decryptDir{File: file, fs: d, name: name}, nil
+	}
+
+	file, err := d.fsys.Open(name + d.suffix)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = fs.ErrNotExist
+		}
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	plain, err := DecryptStream(d.decrypter, file)
+	if err == nil {
+		var data []byte
+		if data, err = io.ReadAll(plain); err == nil {
+			return &decryptedFile{
+				Reader: bytes.NewReader(data),
+				info:   renamedInfo{FileInfo: info, name: path.Base(name), size: int64(len(data))},
+			}, nil
+		}
+	}
+	return nil, &fs.PathError{Op: "decrypt", Path: name, Err: err}
+}
+
+// Stat decrypts the file to find its size.
+func (d *decryptFS) Stat(name string) (fs.FileInfo, error) {
+	file, err := d.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return file.Stat()
+}
+
+type decryptedFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (f *decryptedFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *decryptedFile) Close() error {
+	return nil
+}
+
+// renamedInfo is the FileInfo of a file with its suffix stripped and the
+// size of its plaintext.
+type renamedInfo struct {
+	fs.FileInfo
+	name string
+	size int64
+}
+
+func (i renamedInfo) Name() string {
+	return i.name
+}
+
+func (i renamedInfo) Size() int64 {
+	return i.size
+}
+
+// decryptDir lists a directory with the suffixes stripped.
+type decryptDir struct {
+	fs.File
+	fs      *decryptFS
+	name    string
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *decryptDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		dir, ok := d.File.(fs.ReadDirFile)
+		if !ok {
+			return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: errors.New("not a directory")}
+		}
+		entries, err := dir.ReadDir(-1)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			switch {
+			case entry.IsDir():
+				d.entries = append(d.entries, entry)
+			case strings.HasSuffix(entry.Name(), d.fs.suffix) && entry.Name() != d.fs.suffix:
+				d.entries = append(d.entries, &decryptEntry{
+					DirEntry: entry,
+					fs:       d.fs,
+					name:     strings.TrimSuffix(entry.Name(), d.fs.suffix),
+					dir:      d.name,
+				})
+			}
+		}
+		d.read = true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+type decryptEntry struct {
+	fs.DirEntry
+	fs   *decryptFS
+	name string
+	dir  string
+}
+
+func (e *decryptEntry) Name() string {
+	return e.name
+}
+
+// Info decrypts the file to find its size.
+func (e *decryptEntry) Info() (fs.FileInfo, error) {
+	return e.fs.Stat(path.Join(e.dir, e.name))
+}
+
+// WriteEncryptedFS encrypts every file of fsys into the directory dir with
+// EncryptStream, adding the suffix to their names, so the tree can be read
+// back with NewDecryptFS.  Each file is written atomically with the
+// permissions it has in fsys, and directories are created as needed.
+func WriteEncryptedFS(encrypter Encrypt, fsys fs.FS, dir string, suffix string) error {
+	return fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		if entry.IsDir() {
+			return os.MkdirAll(dst, 0755)
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		mode := info.Mode().Perm()
+		if mode == 0 {
+			mode = 0644
+		}
+
+		src, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		return writeFileAtomic(dst+suffix, mode, func(w io.Writer) error {
+			stream, err := EncryptStream(encrypter, w)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(stream, src); err != nil {
+				return err
+			}
+			return stream.Close()
+		})
+	})
+}
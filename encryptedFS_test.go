@@ -0,0 +1,87 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecryptFS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := loadBoxPair(t)
+	plain := fstest.MapFS{
+		"app.yaml":          {Data: []byte("kid: test\n"), Mode: 0600},
+		"certs/server.pem":  {Data: []byte("-----BEGIN CERTIFICATE-----\n")},
+		"certs/chain/a.pem": {Data: []byte("a")},
+		"empty":             {Data: []byte{}},
+	}
+
+	dir := t.TempDir()
+	require.Nil(WriteEncryptedFS(encrypter, plain, dir, ".enc"))
+	info, err := os.Stat(filepath.Join(dir, "app.yaml.enc"))
+	require.Nil(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+	data, err := ioutil.ReadFile(filepath.Join(dir, "app.yaml.enc"))
+	require.Nil(err)
+	assert.NotContains(string(data), "kid: test")
+
+	// a stray file without the suffix is hidden
+	require.Nil(ioutil.WriteFile(filepath.Join(dir, "README"), []byte("readme"), 0644))
+
+	fsys := NewDecryptFS(os.DirFS(dir), decrypter, ".enc")
+	require.Nil(fstest.TestFS(fsys, "app.yaml", "certs/server.pem", "certs/chain/a.pem", "empty"))
+
+	for name, file := range plain {
+		data, err := fs.ReadFile(fsys, name)
+		require.Nil(err, name)
+		assert.Equal(file.Data, data, name)
+	}
+
+	_, err = fs.ReadFile(fsys, "README")
+	assert.ErrorIs(err, fs.ErrNotExist)
+	_, err = fsys.Open("../app.yaml")
+	assert.ErrorIs(err, fs.ErrInvalid)
+
+	file, err := fsys.Open("app.yaml")
+	require.Nil(err)
+	seeker, ok := file.(io.Seeker)
+	require.True(ok, "files can be served by http.FS")
+	_, err = seeker.Seek(5, io.SeekStart)
+	require.Nil(err)
+	rest, err := io.ReadAll(file)
+	require.Nil(err)
+	assert.Equal("test\n", string(rest))
+	require.Nil(file.Close())
+
+	// a tampered file fails to open
+	data[len(data)-1] ^= 1
+	require.Nil(ioutil.WriteFile(filepath.Join(dir, "app.yaml.enc"), data, 0600))
+	_, err = fs.ReadFile(fsys, "app.yaml")
+	assert.NotNil(err)
+}
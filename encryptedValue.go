@@ -0,0 +1,211 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	valueLock      sync.RWMutex
+	valueEncrypter Encrypt
+	valueRouter    *Router
+
+	errNoValueCipher = errors.New("no cipher set with SetValueCiphers")
+)
+
+// SetValueCiphers sets the encrypter EncryptedString and EncryptedBytes seal
+// their values with when they are written to a database or marshalled, and
+// the router that finds the decrypter when they are read.  Either may be nil
+// for a process that only reads or only writes.
+func SetValueCiphers(encrypter Encrypt, router *Router) {
+	valueLock.Lock()
+	defer valueLock.Unlock()
+	valueEncrypter = encrypter
+	valueRouter = router
+}
+
+func getValueCiphers() (Encrypt, *Router) {
+	valueLock.RLock()
+	defer valueLock.RUnlock()
+	return valueEncrypter, valueRouter
+}
+
+// EncryptedString is a string that is encrypted whenever it leaves the
+// process: as a database value it's stored as the text form of an envelope,
+// and as JSON it's marshalled as one, using the ciphers set with
+// SetValueCiphers.  It's scanned and unmarshalled back to the plain string,
+// so a model field only needs its type changed to be protected.  NULL and
+// JSON null are read as an empty string.
+type EncryptedString string
+
+// EncryptedBytes is like EncryptedString for a []byte, stored as a marshalled
+// envelope.  NULL and JSON null are read as nil.
+type EncryptedBytes []byte
+
+// sealValue seals the plain value with the value encrypter.
+func sealValue(plain []byte) (*Envelope, error) {
+	encrypter, _ := getValueCiphers()
+	if encrypter == nil {
+		return nil, errNoValueCipher
+	}
+	return SealEnvelope(encrypter, plain)
+}
+
+// openValue parses and opens a stored value, which may be a marshalled
+// envelope or its text form.
+func openValue(data []byte) ([]byte, error) {
+	_, router := getValueCiphers()
+	if router == nil {
+		return nil, errNoValueCipher
+	}
+	var e Envelope
+	var err error
+	if _, versionErr := EnvelopeVersionOf(data); versionErr == nil {
+		err = e.UnmarshalBinary(data)
+	} else {
+		err = e.UnmarshalText(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return router.Open(&e)
+}
+
+// scanValue returns the stored bytes of a database value, or nil for NULL.
+func scanValue(src interface{}) ([]byte, error) {
+	switch value := src.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return value, nil
+	case string:
+		return []byte(value), nil
+	}
+	return nil, fmt.Errorf("can't decrypt a value from %T", src)
+}
+
+// Value seals the string and returns the text form of the envelope.
+func (s EncryptedString) Value() (driver.Value, error) {
+	e, err := sealValue([]byte(s))
+	if err != nil {
+		return nil, err
+	}
+	return e.String(), nil
+}
+
+// Scan opens the envelope read from the database.
+func (s *EncryptedString) Scan(src interface{}) error {
+	data, err := scanValue(src)
+	if err != nil || data == nil {
+		*s = ""
+		return err
+	}
+	plain, err := openValue(data)
+	if err != nil {
+		return err
+	}
+	*s = EncryptedString(plain)
+	return nil
+}
+
+// MarshalJSON seals the string and marshals the envelope.
+func (s EncryptedString) MarshalJSON() ([]byte, error) {
+	e, err := sealValue([]byte(s))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(e)
+}
+
+// UnmarshalJSON opens a marshalled envelope.
+func (s *EncryptedString) UnmarshalJSON(data []byte) error {
+	plain, err := unmarshalValueJSON(data)
+	if err != nil {
+		return err
+	}
+	*s = EncryptedString(plain)
+	return nil
+}
+
+// Value seals the bytes and returns the marshalled envelope.
+func (b EncryptedBytes) Value() (driver.Value, error) {
+	if b == nil {
+		return nil, nil
+	}
+	e, err := sealValue(b)
+	if err != nil {
+		return nil, err
+	}
+	return e.MarshalBinary()
+}
+
+// Scan opens the envelope read from the database.
+func (b *EncryptedBytes) Scan(src interface{}) error {
+	data, err := scanValue(src)
+	if err != nil || data == nil {
+		*b = nil
+		return err
+	}
+	plain, err := openValue(data)
+	if err != nil {
+		return err
+	}
+	*b = plain
+	return nil
+}
+
+// MarshalJSON seals the bytes and marshals the envelope.  nil is marshalled
+// as null.
+func (b EncryptedBytes) MarshalJSON() ([]byte, error) {
+	if b == nil {
+		return []byte("null"), nil
+	}
+	e, err := sealValue(b)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(e)
+}
+
+// UnmarshalJSON opens a marshalled envelope.
+func (b *EncryptedBytes) UnmarshalJSON(data []byte) error {
+	plain, err := unmarshalValueJSON(data)
+	if err != nil {
+		return err
+	}
+	*b = plain
+	return nil
+}
+
+// unmarshalValueJSON opens an envelope marshalled as a JSON string, returning
+// nil for null.
+func unmarshalValueJSON(data []byte) ([]byte, error) {
+	var text *string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return nil, err
+	}
+	if text == nil {
+		return nil, nil
+	}
+	return openValue([]byte(*text))
+}
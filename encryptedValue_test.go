@@ -0,0 +1,123 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ sql.Scanner      = (*EncryptedString)(nil)
+	_ driver.Valuer    = EncryptedString("")
+	_ json.Marshaler   = EncryptedBytes(nil)
+	_ json.Unmarshaler = (*EncryptedBytes)(nil)
+)
+
+func setValueCiphers(t *testing.T) {
+	encrypter, decrypter := aesGCMPair(t)
+	router := NewRouter(nil)
+	require.Nil(t, router.Register(decrypter))
+	SetValueCiphers(encrypter, router)
+	t.Cleanup(func() {
+		SetValueCiphers(nil, nil)
+	})
+}
+
+type account struct {
+	Email EncryptedString `json:"email"`
+	Token EncryptedBytes  `json:"token"`
+}
+
+func TestEncryptedValueSQL(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	setValueCiphers(t)
+
+	stored, err := EncryptedString("alice@example.com").Value()
+	require.Nil(err)
+	assert.IsType("", stored)
+	assert.NotContains(stored, "alice")
+
+	var s EncryptedString
+	require.Nil(s.Scan(stored))
+	assert.Equal(EncryptedString("alice@example.com"), s)
+	require.Nil(s.Scan([]byte(stored.(string))))
+	assert.Equal(EncryptedString("alice@example.com"), s)
+	require.Nil(s.Scan(nil))
+	assert.Equal(EncryptedString(""), s)
+	assert.NotNil(s.Scan(42))
+
+	stored, err = EncryptedBytes("secret").Value()
+	require.Nil(err)
+	assert.IsType([]byte{}, stored)
+
+	var b EncryptedBytes
+	require.Nil(b.Scan(stored))
+	assert.Equal(EncryptedBytes("secret"), b)
+
+	stored, err = EncryptedBytes(nil).Value()
+	assert.Nil(err)
+	assert.Nil(stored)
+	require.Nil(b.Scan(nil))
+	assert.Nil(b)
+}
+
+func TestEncryptedValueJSON(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+	setValueCiphers(t)
+
+	data, err := json.Marshal(account{Email: "alice@example.com", Token: EncryptedBytes("secret")})
+	require.Nil(err)
+	assert.NotContains(string(data), "alice")
+	assert.NotContains(string(data), "secret")
+
+	var decoded account
+	require.Nil(json.Unmarshal(data, &decoded))
+	assert.Equal(EncryptedString("alice@example.com"), decoded.Email)
+	assert.Equal(EncryptedBytes("secret"), decoded.Token)
+
+	data, err = json.Marshal(account{Email: "bob@example.com"})
+	require.Nil(err)
+	assert.Contains(string(data), `"token":null`)
+	decoded = account{}
+	require.Nil(json.Unmarshal(data, &decoded))
+	assert.Equal(EncryptedString("bob@example.com"), decoded.Email)
+	assert.Nil(decoded.Token)
+
+	assert.NotNil(json.Unmarshal([]byte(`{"email":"not an envelope"}`), &decoded))
+	assert.NotNil(json.Unmarshal([]byte(`{"email":42}`), &decoded))
+}
+
+func TestEncryptedValueNoCipher(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := EncryptedString("x").Value()
+	assert.Equal(errNoValueCipher, err)
+	_, err = json.Marshal(EncryptedBytes("x"))
+	assert.ErrorIs(err, errNoValueCipher)
+
+	var s EncryptedString
+	assert.Equal(errNoValueCipher, s.Scan("x"))
+}
@@ -0,0 +1,143 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// EndpointOptions configures NewEndpointMiddleware.
+type EndpointOptions struct {
+	// Router picks the decrypter of a request from its envelope.  It's
+	// required.
+	Router *Router
+
+	// Encrypter, if set, seals the responses in envelopes.
+	Encrypter Encrypt
+
+	// DecodeRequest, if set, turns the plain request into the request the
+	// endpoint expects.  By default the endpoint gets the plain []byte.
+	DecodeRequest func(ctx context.Context, plain []byte) (interface{}, error)
+
+	// EncodeResponse, if set, turns the response of the endpoint into the
+	// bytes to encrypt.  By default the response must be a []byte.
+	EncodeResponse func(ctx context.Context, response interface{}) ([]byte, error)
+
+	// Logger is the Logger used to report requests that couldn't be
+	// decrypted and responses that couldn't be encrypted.  If not supplied,
+	// DefaultLogger() is used instead.
+	Logger Logger
+}
+
+// NewEndpointMiddleware returns go-kit endpoint middleware that decrypts the
+// request, which must be an *Envelope, an Envelope, a marshalled envelope
+// as a []byte, or its text form as a string, with the decrypter the Router
+// finds for it.  When an Encrypter is given the response is returned as an
+// *Envelope.  A transport decodes the envelope and encodes the response
+// without knowing anything else about encryption.
+func NewEndpointMiddleware(options EndpointOptions) (endpoint.Middleware, error) {
+	if options.Router == nil {
+		return nil, errors.New("no router")
+	}
+	if options.Logger == nil {
+		options.Logger = DefaultLogger()
+	}
+
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			request, err := options.decryptRequest(ctx, request)
+			if err != nil {
+				logError(options.Logger, "failed to decrypt request", ErrorKey, err)
+				return nil, err
+			}
+
+			response, err := next(ctx, request)
+			if err != nil || options.Encrypter == nil {
+				return response, err
+			}
+
+			e, err := options.encryptResponse(ctx, response)
+			if err != nil {
+				logError(options.Logger, "failed to encrypt response", ErrorKey, err)
+				return nil, err
+			}
+			return e, nil
+		}
+	}, nil
+}
+
+// requestEnvelope returns the envelope of a request.
+func requestEnvelope(request interface{}) (*Envelope, error) {
+	switch r := request.(type) {
+	case *Envelope:
+		if r == nil {
+			return nil, errors.New("nil envelope request")
+		}
+		return r, nil
+	case Envelope:
+		return &r, nil
+	case []byte:
+		var e Envelope
+		if err := e.UnmarshalBinary(r); err != nil {
+			return nil, err
+		}
+		return &e, nil
+	case string:
+		var e Envelope
+		if err := e.UnmarshalText([]byte(r)); err != nil {
+			return nil, err
+		}
+		return &e, nil
+	}
+	return nil, fmt.Errorf("can't decrypt a request of type %T", request)
+}
+
+func (o *EndpointOptions) decryptRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	e, err := requestEnvelope(request)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := o.Router.Open(e)
+	if err != nil {
+		return nil, err
+	}
+	if o.DecodeRequest != nil {
+		return o.DecodeRequest(ctx, plain)
+	}
+	return plain, nil
+}
+
+func (o *EndpointOptions) encryptResponse(ctx context.Context, response interface{}) (*Envelope, error) {
+	var plain []byte
+	if o.EncodeResponse != nil {
+		var err error
+		if plain, err = o.EncodeResponse(ctx, response); err != nil {
+			return nil, err
+		}
+	} else {
+		var ok bool
+		if plain, ok = response.([]byte); !ok {
+			return nil, fmt.Errorf("can't encrypt a response of type %T", response)
+		}
+	}
+	return SealEnvelope(o.Encrypter, plain)
+}
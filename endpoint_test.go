@@ -0,0 +1,141 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpointMiddleware(t *testing.T) {
+	encrypter, decrypter := aesGCMPair(t)
+	router := NewRouter(nil)
+	require.Nil(t, router.Register(decrypter))
+
+	sealed, err := SealEnvelope(encrypter, []byte("hello"))
+	require.Nil(t, err)
+	data, err := sealed.MarshalBinary()
+	require.Nil(t, err)
+
+	echo := func(ctx context.Context, request interface{}) (interface{}, error) {
+		return request, nil
+	}
+
+	testData := []struct {
+		description string
+		request     interface{}
+		expectErr   bool
+	}{
+		{"pointer", sealed, false},
+		{"value", *sealed, false},
+		{"bytes", data, false},
+		{"text", sealed.String(), false},
+		{"nil envelope", (*Envelope)(nil), true},
+		{"garbage", []byte("garbage"), true},
+		{"wrong type", 42, true},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			middleware, err := NewEndpointMiddleware(EndpointOptions{Router: router, Encrypter: encrypter})
+			require.Nil(err)
+			response, err := middleware(echo)(context.Background(), tc.request)
+			if tc.expectErr {
+				assert.NotNil(err)
+				assert.Nil(response)
+				return
+			}
+			require.Nil(err)
+			e, ok := response.(*Envelope)
+			require.True(ok)
+			plain, err := router.Open(e)
+			require.Nil(err)
+			assert.Equal("hello", string(plain))
+		})
+	}
+}
+
+func TestEndpointMiddlewareCodec(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := aesGCMPair(t)
+	router := NewRouter(nil)
+	require.Nil(router.Register(decrypter))
+
+	type greeting struct {
+		Name string `json:"name"`
+	}
+	middleware, err := NewEndpointMiddleware(EndpointOptions{
+		Router: router,
+		DecodeRequest: func(ctx context.Context, plain []byte) (interface{}, error) {
+			var g greeting
+			return g, json.Unmarshal(plain, &g)
+		},
+	})
+	require.Nil(err)
+
+	sealed, err := SealEnvelope(encrypter, []byte(`{"name":"alice"}`))
+	require.Nil(err)
+	response, err := middleware(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return "hello " + request.(greeting).Name, nil
+	})(context.Background(), sealed)
+	require.Nil(err)
+	assert.Equal("hello alice", response, "responses aren't encrypted without an encrypter")
+
+	middleware, err = NewEndpointMiddleware(EndpointOptions{
+		Router:    router,
+		Encrypter: encrypter,
+		EncodeResponse: func(ctx context.Context, response interface{}) ([]byte, error) {
+			return json.Marshal(response)
+		},
+	})
+	require.Nil(err)
+	response, err = middleware(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return greeting{Name: "bob"}, nil
+	})(context.Background(), sealed)
+	require.Nil(err)
+	plain, err := router.Open(response.(*Envelope))
+	require.Nil(err)
+	assert.Equal(`{"name":"bob"}`, string(plain))
+
+	failure := errors.New("failure")
+	response, err = middleware(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return "partial", failure
+	})(context.Background(), sealed)
+	assert.Equal(failure, err)
+	assert.Equal("partial", response)
+
+	middleware, err = NewEndpointMiddleware(EndpointOptions{Router: router, Encrypter: encrypter})
+	require.Nil(err)
+	_, err = middleware(func(ctx context.Context, request interface{}) (interface{}, error) {
+		return 42, nil
+	})(context.Background(), sealed)
+	assert.NotNil(err)
+
+	_, err = NewEndpointMiddleware(EndpointOptions{})
+	assert.NotNil(err)
+}
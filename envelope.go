@@ -0,0 +1,218 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+var envelopeMagic = []byte("VCE")
+
+// Envelope is an encrypted message along with everything needed to decrypt
+// it: the algorithm and KID of the cipher, the nonce, and the signature when
+// the cipher signs messages.  It marshals to one compact binary or base64
+// form, so consumers don't each need their own framing.
+type Envelope struct {
+	Algorithm AlgorithmType
+	KID       string
+	Nonce     []byte
+	Signature []byte
+	Cipher    []byte
+
+	// Compression is how the message was compressed before it was
+	// encrypted.  Envelopes with compression are marshalled as
+	// EnvelopeVersion2 or later.
+	Compression Compression
+}
+
+// signs reports whether the second result of EncryptMessage is a signature
+// rather than a nonce for the algorithm.
+func signs(alg AlgorithmType) bool {
+	return alg == RSASymmetric || alg == RSAAsymmetric
+}
+
+// SealEnvelope encrypts the message into an Envelope.
+func SealEnvelope(encrypter Encrypt, message []byte, options ...SealOption) (*Envelope, error) {
+	return sealEnvelope(encrypter, message, options, func(message []byte) ([]byte, []byte, error) {
+		return encrypter.EncryptMessage(message)
+	})
+}
+
+// SealEnvelopeWithAD encrypts the message into an Envelope, binding the
+// associated data to it.  The associated data isn't stored in the envelope.
+func SealEnvelopeWithAD(encrypter Encrypt, message []byte, ad []byte, options ...SealOption) (*Envelope, error) {
+	return sealEnvelope(encrypter, message, options, func(message []byte) ([]byte, []byte, error) {
+		return EncryptMessageWithAD(encrypter, message, ad)
+	})
+}
+
+func sealEnvelope(encrypter Encrypt, message []byte, options []SealOption, encrypt func([]byte) ([]byte, []byte, error)) (*Envelope, error) {
+	var o sealOptions
+	for _, option := range options {
+		if option != nil {
+			option(&o)
+		}
+	}
+	message, compression, err := compress(o.compression, message)
+	if err != nil {
+		return nil, err
+	}
+	cipher, nonce, err := encrypt(message)
+	if err != nil {
+		return nil, err
+	}
+	e := &Envelope{
+		Algorithm:   encrypter.GetAlgorithm(),
+		KID:         encrypter.GetKID(),
+		Cipher:      cipher,
+		Compression: compression,
+	}
+	if len(nonce) == 0 {
+		nonce = nil
+	}
+	if signs(e.Algorithm) {
+		e.Signature = nonce
+	} else {
+		e.Nonce = nonce
+	}
+	return e, nil
+}
+
+// Open decrypts the envelope.  It fails if the envelope was sealed by a
+// different algorithm, or by a different KID when both sides have one.
+func (e *Envelope) Open(decrypter Decrypt) ([]byte, error) {
+	return e.open(decrypter, func(nonce []byte) ([]byte, error) {
+		return decrypter.DecryptMessage(e.Cipher, nonce)
+	})
+}
+
+// OpenWithAD decrypts an envelope sealed by SealEnvelopeWithAD, failing if
+// the associated data doesn't match.
+func (e *Envelope) OpenWithAD(decrypter Decrypt, ad []byte) ([]byte, error) {
+	return e.open(decrypter, func(nonce []byte) ([]byte, error) {
+		return DecryptMessageWithAD(decrypter, e.Cipher, nonce, ad)
+	})
+}
+
+func (e *Envelope) open(decrypter Decrypt, decrypt func(nonce []byte) ([]byte, error)) ([]byte, error) {
+	if alg := decrypter.GetAlgorithm(); alg != e.Algorithm {
+		return nil, fmt.Errorf("envelope algorithm %s does not match decrypter algorithm %s", e.Algorithm, alg)
+	}
+	if kid := decrypter.GetKID(); kid != "" && e.KID != "" && !equalKID(kid, e.KID) {
+		return nil, fmt.Errorf("envelope kid %s does not match decrypter kid %s", e.KID, kid)
+	}
+	nonce := e.Nonce
+	if signs(e.Algorithm) {
+		nonce = e.Signature
+	}
+	message, err := decrypt(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return decompress(e.Compression, message)
+}
+
+// DecryptEnvelope parses a marshalled Envelope and opens it.
+func DecryptEnvelope(decrypter Decrypt, data []byte) ([]byte, error) {
+	var e Envelope
+	if err := e.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return e.Open(decrypter)
+}
+
+// MarshalBinary encodes the envelope as a magic number and the version set
+// by SetEnvelopeVersion, followed by the body in that version's format.
+func (e *Envelope) MarshalBinary() ([]byte, error) {
+	version := EnvelopeVersion()
+	if e.Compression != NoCompression && version < EnvelopeVersion2 {
+		version = EnvelopeVersion2
+	}
+	return e.MarshalBinaryVersion(version)
+}
+
+// MarshalBinaryVersion encodes the envelope in the version given.
+func (e *Envelope) MarshalBinaryVersion(version byte) ([]byte, error) {
+	codec, err := getEnvelopeCodec(version)
+	if err != nil {
+		return nil, err
+	}
+	body, err := codec.Encode(e)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, len(envelopeMagic)+1+len(body))
+	data = append(append(append(data, envelopeMagic...), version), body...)
+	return data, nil
+}
+
+// UnmarshalBinary decodes an envelope of any registered version.
+func (e *Envelope) UnmarshalBinary(data []byte) error {
+	version, err := EnvelopeVersionOf(data)
+	if err != nil {
+		return err
+	}
+	codec, err := getEnvelopeCodec(version)
+	if err != nil {
+		return err
+	}
+	decoded, err := codec.Decode(data[len(envelopeMagic)+1:])
+	if err != nil {
+		return err
+	}
+	*e = decoded
+	return nil
+}
+
+// MarshalText encodes the envelope as unpadded URL safe base64, which is also
+// how it's marshalled into JSON.
+func (e *Envelope) MarshalText() ([]byte, error) {
+	data, err := e.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	text := make([]byte, base64.RawURLEncoding.EncodedLen(len(data)))
+	base64.RawURLEncoding.Encode(text, data)
+	return text, nil
+}
+
+// UnmarshalText decodes an envelope encoded by MarshalText.
+func (e *Envelope) UnmarshalText(text []byte) error {
+	data := make([]byte, base64.RawURLEncoding.DecodedLen(len(text)))
+	n, err := base64.RawURLEncoding.Decode(data, text)
+	if err != nil {
+		return fmt.Errorf("invalid envelope encoding: %w", err)
+	}
+	return e.UnmarshalBinary(data[:n])
+}
+
+// String returns the text form of the envelope.
+func (e *Envelope) String() string {
+	text, _ := e.MarshalText()
+	return string(text)
+}
+
+// copyField copies a field so the envelope doesn't keep the input alive, and
+// keeps empty fields nil.
+func copyField(field []byte) []byte {
+	if len(field) == 0 {
+		return nil
+	}
+	return append([]byte{}, field...)
+}
@@ -0,0 +1,119 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// compactAlgorithms are the one byte codes of the algorithms a compact
+// envelope can hold.  Codes are never reused.  They stay below 'V', the
+// first byte of a marshalled envelope, so the two forms can be told apart.
+var compactAlgorithms = map[AlgorithmType]byte{
+	None:          1,
+	Box:           2,
+	BoxEphemeral:  3,
+	RSASymmetric:  4,
+	RSAAsymmetric: 5,
+	AESGCM:        6,
+	Ratchet:       7,
+}
+
+// MarshalCompact encodes the envelope in the compact form, for transports
+// with small payload limits like MQTT on constrained devices.  The algorithm
+// is written as a one byte code instead of its name, there is no magic
+// number or version, and the cipher runs to the end, so the envelope adds
+// about three bytes plus the KID and nonce.  Only the built in algorithms
+// have codes, and compression can't be recorded.  UnmarshalCompact reads it.
+func (e *Envelope) MarshalCompact() ([]byte, error) {
+	code, ok := compactAlgorithms[e.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("algorithm %s has no compact envelope code", e.Algorithm)
+	}
+	if e.Compression != NoCompression {
+		return nil, errors.New("compact envelopes can't record compression")
+	}
+	nonce := e.Nonce
+	if signs(e.Algorithm) {
+		nonce = e.Signature
+	}
+
+	data := make([]byte, 0, 1+2*binary.MaxVarintLen64+len(e.KID)+len(nonce)+len(e.Cipher))
+	data = append(data, code)
+	data = binary.AppendUvarint(data, uint64(len(e.KID)))
+	data = append(data, e.KID...)
+	data = binary.AppendUvarint(data, uint64(len(nonce)))
+	data = append(data, nonce...)
+	return append(data, e.Cipher...), nil
+}
+
+// UnmarshalCompact decodes an envelope encoded by MarshalCompact.
+func (e *Envelope) UnmarshalCompact(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("compact envelope is empty")
+	}
+	var alg AlgorithmType
+	for candidate, code := range compactAlgorithms {
+		if code == data[0] {
+			alg = candidate
+		}
+	}
+	if alg == "" {
+		return fmt.Errorf("%w: compact envelope code %d", ErrUnknownAlgorithm, data[0])
+	}
+
+	kid, rest, err := compactField(data[1:])
+	if err != nil {
+		return err
+	}
+	nonce, rest, err := compactField(rest)
+	if err != nil {
+		return err
+	}
+
+	decoded := Envelope{
+		Algorithm: alg,
+		KID:       string(kid),
+		Cipher:    copyField(rest),
+	}
+	if signs(alg) {
+		decoded.Signature = copyField(nonce)
+	} else {
+		decoded.Nonce = copyField(nonce)
+	}
+	*e = decoded
+	return nil
+}
+
+// compactField reads one length prefixed field.
+func compactField(data []byte) ([]byte, []byte, error) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || size > uint64(len(data)-n) {
+		return nil, nil, errors.New("compact envelope is truncated")
+	}
+	return data[n : n+int(size)], data[n+int(size):], nil
+}
+
+// isCompactEnvelope reports whether the data looks like a compact envelope
+// rather than one written by MarshalBinary.
+func isCompactEnvelope(data []byte) bool {
+	_, err := EnvelopeVersionOf(data)
+	return len(data) > 0 && err != nil
+}
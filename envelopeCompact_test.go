@@ -0,0 +1,82 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelopeCompact(t *testing.T) {
+	testData := []struct {
+		description string
+		envelope    Envelope
+	}{
+		{"aead", Envelope{Algorithm: AESGCM, KID: "k1", Nonce: []byte("123456789012"), Cipher: []byte("cipher")}},
+		{"signature", Envelope{Algorithm: RSAAsymmetric, KID: "k2", Signature: []byte("signature"), Cipher: []byte("cipher")}},
+		{"no kid", Envelope{Algorithm: Box, Nonce: []byte("nonce"), Cipher: []byte("cipher")}},
+		{"empty", Envelope{Algorithm: None}},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			data, err := tc.envelope.MarshalCompact()
+			require.Nil(err)
+			assert.True(isCompactEnvelope(data))
+
+			binary, err := tc.envelope.MarshalBinary()
+			require.Nil(err)
+			assert.False(isCompactEnvelope(binary))
+			assert.Less(len(data), len(binary))
+
+			var decoded Envelope
+			require.Nil(decoded.UnmarshalCompact(data))
+			assert.Equal(tc.envelope, decoded)
+		})
+	}
+}
+
+func TestEnvelopeCompactErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := (&Envelope{Algorithm: "rot13"}).MarshalCompact()
+	assert.NotNil(err)
+	_, err = (&Envelope{Algorithm: Box, Compression: Gzip}).MarshalCompact()
+	assert.NotNil(err)
+
+	var e Envelope
+	assert.NotNil(e.UnmarshalCompact(nil))
+	assert.True(errors.Is(e.UnmarshalCompact([]byte{99, 0, 0}), ErrUnknownAlgorithm))
+	assert.NotNil(e.UnmarshalCompact([]byte{2, 5, 'k'}))
+	assert.NotNil(e.UnmarshalCompact([]byte{2, 0}))
+	assert.NotNil(e.UnmarshalCompact([]byte{2, 0, 9, 1}))
+
+	// every code is distinct and can't be mistaken for a marshalled envelope
+	codes := map[byte]bool{}
+	for _, code := range compactAlgorithms {
+		assert.False(codes[code])
+		assert.Less(code, envelopeMagic[0])
+		codes[code] = true
+	}
+}
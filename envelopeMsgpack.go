@@ -0,0 +1,362 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// MsgpackEnvelopeVersion is the version of the msgpack envelope written by
+// MarshalMsgpack.
+const MsgpackEnvelopeVersion = 1
+
+// The keys of the msgpack envelope map.
+const (
+	msgpackVersionKey     = "version"
+	msgpackAlgorithmKey   = "alg"
+	msgpackKIDKey         = "kid"
+	msgpackNonceKey       = "nonce"
+	msgpackSignatureKey   = "signature"
+	msgpackCipherKey      = "ciphertext"
+	msgpackCompressionKey = "compression"
+)
+
+var errMsgpackTruncated = errors.New("invalid envelope: msgpack is truncated")
+
+// MarshalMsgpack encodes the envelope as a msgpack map, with the nonce,
+// signature and cipher as bin so they needn't be base64 encoded inside a
+// pipeline that's msgpack throughout.  Empty fields are left out.  The method
+// is the Marshaler interface of github.com/vmihailenco/msgpack, so an
+// Envelope can be a field of a struct encoded with it.
+func (e *Envelope) MarshalMsgpack() ([]byte, error) {
+	type entry struct {
+		key    string
+		value  []byte
+		binary bool
+	}
+	entries := []entry{
+		{msgpackAlgorithmKey, []byte(e.Algorithm), false},
+		{msgpackKIDKey, []byte(e.KID), false},
+		{msgpackNonceKey, e.Nonce, true},
+		{msgpackSignatureKey, e.Signature, true},
+		{msgpackCipherKey, e.Cipher, true},
+		{msgpackCompressionKey, []byte(e.Compression), false},
+	}
+
+	count := 1
+	for _, entry := range entries {
+		if len(entry.value) > 0 {
+			count++
+		}
+	}
+
+	data := appendMsgpackMapHeader(nil, count)
+	data = appendMsgpackString(data, []byte(msgpackVersionKey))
+	data = append(data, MsgpackEnvelopeVersion)
+	for _, entry := range entries {
+		if len(entry.value) == 0 {
+			continue
+		}
+		data = appendMsgpackString(data, []byte(entry.key))
+		if entry.binary {
+			data = appendMsgpackBin(data, entry.value)
+		} else {
+			data = appendMsgpackString(data, entry.value)
+		}
+	}
+	return data, nil
+}
+
+// UnmarshalMsgpack decodes an envelope encoded by MarshalMsgpack.  Keys it
+// doesn't know are skipped, so the format can grow.
+func (e *Envelope) UnmarshalMsgpack(data []byte) error {
+	r := msgpackReader{data: data}
+	count, err := r.readMapHeader()
+	if err != nil {
+		return err
+	}
+
+	var (
+		decoded Envelope
+		version uint64
+	)
+	for i := 0; i < count; i++ {
+		key, err := r.readBytes()
+		if err != nil {
+			return err
+		}
+
+		var value []byte
+		switch string(key) {
+		case msgpackVersionKey:
+			version, err = r.readUint()
+		case msgpackAlgorithmKey, msgpackKIDKey, msgpackNonceKey, msgpackSignatureKey, msgpackCipherKey, msgpackCompressionKey:
+			value, err = r.readBytes()
+		default:
+			err = r.skip(0)
+		}
+		if err != nil {
+			return err
+		}
+
+		switch string(key) {
+		case msgpackAlgorithmKey:
+			decoded.Algorithm = AlgorithmType(value)
+		case msgpackKIDKey:
+			decoded.KID = string(value)
+		case msgpackNonceKey:
+			decoded.Nonce = copyField(value)
+		case msgpackSignatureKey:
+			decoded.Signature = copyField(value)
+		case msgpackCipherKey:
+			decoded.Cipher = copyField(value)
+		case msgpackCompressionKey:
+			decoded.Compression = Compression(value)
+		}
+	}
+	if len(r.data) > 0 {
+		return errors.New("invalid envelope: msgpack has trailing data")
+	}
+	if version != MsgpackEnvelopeVersion {
+		return fmt.Errorf("unsupported msgpack envelope version %d", version)
+	}
+	*e = decoded
+	return nil
+}
+
+func appendMsgpackMapHeader(data []byte, count int) []byte {
+	switch {
+	case count < 16:
+		return append(data, 0x80|byte(count))
+	case count < 1<<16:
+		return binary.BigEndian.AppendUint16(append(data, 0xde), uint16(count))
+	}
+	return binary.BigEndian.AppendUint32(append(data, 0xdf), uint32(count))
+}
+
+func appendMsgpackString(data []byte, value []byte) []byte {
+	switch size := len(value); {
+	case size < 32:
+		data = append(data, 0xa0|byte(size))
+	case size < 1<<8:
+		data = append(data, 0xd9, byte(size))
+	case size < 1<<16:
+		data = binary.BigEndian.AppendUint16(append(data, 0xda), uint16(size))
+	default:
+		data = binary.BigEndian.AppendUint32(append(data, 0xdb), uint32(size))
+	}
+	return append(data, value...)
+}
+
+func appendMsgpackBin(data []byte, value []byte) []byte {
+	switch size := len(value); {
+	case size < 1<<8:
+		data = append(data, 0xc4, byte(size))
+	case size < 1<<16:
+		data = binary.BigEndian.AppendUint16(append(data, 0xc5), uint16(size))
+	default:
+		data = binary.BigEndian.AppendUint32(append(data, 0xc6), uint32(size))
+	}
+	return append(data, value...)
+}
+
+// maxMsgpackDepth limits how deeply nested an unknown value being skipped
+// can be.
+const maxMsgpackDepth = 32
+
+// msgpackReader reads the subset of msgpack an envelope needs, and skips any
+// other value.
+type msgpackReader struct {
+	data []byte
+}
+
+func (r *msgpackReader) next(n int) ([]byte, error) {
+	if n < 0 || n > len(r.data) {
+		return nil, errMsgpackTruncated
+	}
+	value := r.data[:n]
+	r.data = r.data[n:]
+	return value, nil
+}
+
+func (r *msgpackReader) readByte() (byte, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// readSize reads a big endian length of 1, 2 or 4 bytes.
+func (r *msgpackReader) readSize(width int) (int, error) {
+	b, err := r.next(width)
+	if err != nil {
+		return 0, err
+	}
+	switch width {
+	case 1:
+		return int(b[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(b)), nil
+	}
+	return int(binary.BigEndian.Uint32(b)), nil
+}
+
+func (r *msgpackReader) readMapHeader() (int, error) {
+	b, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case b&0xf0 == 0x80:
+		return int(b & 0x0f), nil
+	case b == 0xde:
+		return r.readSize(2)
+	case b == 0xdf:
+		return r.readSize(4)
+	}
+	return 0, fmt.Errorf("invalid envelope: msgpack type 0x%02x is not a map", b)
+}
+
+// readBytes reads a str or bin.
+func (r *msgpackReader) readBytes() ([]byte, error) {
+	b, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	var size int
+	switch {
+	case b&0xe0 == 0xa0:
+		size = int(b & 0x1f)
+	case b == 0xd9 || b == 0xc4:
+		size, err = r.readSize(1)
+	case b == 0xda || b == 0xc5:
+		size, err = r.readSize(2)
+	case b == 0xdb || b == 0xc6:
+		size, err = r.readSize(4)
+	default:
+		return nil, fmt.Errorf("invalid envelope: msgpack type 0x%02x is not a str or bin", b)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.next(size)
+}
+
+// readUint reads a non-negative integer of any width.
+func (r *msgpackReader) readUint() (uint64, error) {
+	b, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+	var width int
+	switch b {
+	case 0xcc, 0xd0:
+		width = 1
+	case 0xcd, 0xd1:
+		width = 2
+	case 0xce, 0xd2:
+		width = 4
+	case 0xcf, 0xd3:
+		width = 8
+	default:
+		if b < 0x80 {
+			return uint64(b), nil
+		}
+		return 0, fmt.Errorf("invalid envelope: msgpack type 0x%02x is not an integer", b)
+	}
+	data, err := r.next(width)
+	if err != nil {
+		return 0, err
+	}
+	var value uint64
+	for _, d := range data {
+		value = value<<8 | uint64(d)
+	}
+	if b >= 0xd0 && data[0]&0x80 != 0 {
+		return 0, errors.New("invalid envelope: msgpack integer is negative")
+	}
+	return value, nil
+}
+
+// skip reads past a value of any type.
+func (r *msgpackReader) skip(depth int) error {
+	if depth > maxMsgpackDepth {
+		return errors.New("invalid envelope: msgpack is nested too deeply")
+	}
+	b, err := r.readByte()
+	if err != nil {
+		return err
+	}
+
+	var size, elements int
+	switch {
+	case b < 0x80 || b >= 0xe0 || b == 0xc0 || b == 0xc2 || b == 0xc3:
+		// fixint, nil and bool have no payload
+	case b&0xf0 == 0x80:
+		elements = 2 * int(b&0x0f)
+	case b&0xf0 == 0x90:
+		elements = int(b & 0x0f)
+	case b&0xe0 == 0xa0:
+		size = int(b & 0x1f)
+	case b == 0xc4 || b == 0xd9:
+		size, err = r.readSize(1)
+	case b == 0xc5 || b == 0xda:
+		size, err = r.readSize(2)
+	case b == 0xc6 || b == 0xdb:
+		size, err = r.readSize(4)
+	case b == 0xc7, b == 0xc8, b == 0xc9:
+		// ext: a size, then a type byte and the data
+		size, err = r.readSize(1 << (b - 0xc7))
+		size++
+	case b == 0xca:
+		size = 4
+	case b == 0xcb:
+		size = 8
+	case b >= 0xcc && b <= 0xd3:
+		size = 1 << ((b - 0xcc) % 4)
+	case b >= 0xd4 && b <= 0xd8:
+		size = 1 + 1<<(b-0xd4)
+	case b == 0xdc:
+		elements, err = r.readSize(2)
+	case b == 0xdd:
+		elements, err = r.readSize(4)
+	case b == 0xde:
+		elements, err = r.readSize(2)
+		elements *= 2
+	case b == 0xdf:
+		elements, err = r.readSize(4)
+		elements *= 2
+	default:
+		return fmt.Errorf("invalid envelope: unknown msgpack type 0x%02x", b)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := r.next(size); err != nil {
+		return err
+	}
+	for i := 0; i < elements; i++ {
+		if err := r.skip(depth + 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelopeMsgpack(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := aesGCMPair(t)
+	envelope, err := SealEnvelope(encrypter, bytes.Repeat([]byte("hello "), 100))
+	require.Nil(err)
+
+	data, err := envelope.MarshalMsgpack()
+	require.Nil(err)
+	text, err := envelope.MarshalText()
+	require.Nil(err)
+	assert.Less(len(data), len(text))
+
+	var decoded Envelope
+	require.Nil(decoded.UnmarshalMsgpack(data))
+	assert.Equal(*envelope, decoded)
+	message, err := decoded.Open(decrypter)
+	require.Nil(err)
+	assert.Equal(bytes.Repeat([]byte("hello "), 100), message)
+}
+
+func TestEnvelopeMsgpackFormat(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	data, err := (&Envelope{Algorithm: None, KID: "k", Cipher: []byte{1, 2}}).MarshalMsgpack()
+	require.Nil(err)
+	expected := []byte{0x84,
+		0xa7, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x01,
+		0xa3, 'a', 'l', 'g', 0xa4, 'n', 'o', 'n', 'e',
+		0xa3, 'k', 'i', 'd', 0xa1, 'k',
+		0xaa, 'c', 'i', 'p', 'h', 'e', 'r', 't', 'e', 'x', 't', 0xc4, 0x02, 0x01, 0x02,
+	}
+	assert.Equal(expected, data)
+
+	// what other encoders write: wider types, strings for bin and unknown keys
+	written := []byte{0xde, 0x00, 0x05,
+		0xa5, 'e', 'x', 't', 'r', 'a', 0x92, 0xcb, 0, 0, 0, 0, 0, 0, 0, 0, 0x81, 0xc0, 0xd6, 1, 0, 0, 0, 0,
+		0xd9, 0x03, 'a', 'l', 'g', 0xa4, 'n', 'o', 'n', 'e',
+		0xaa, 'c', 'i', 'p', 'h', 'e', 'r', 't', 'e', 'x', 't', 0xa2, 0x01, 0x02,
+		0xa7, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0xcd, 0x00, 0x01,
+		0xa4, 'n', 'e', 'x', 't', 0xc7, 0x01, 0x05, 0xff,
+	}
+	var decoded Envelope
+	require.Nil(decoded.UnmarshalMsgpack(written))
+	assert.Equal(Envelope{Algorithm: None, Cipher: []byte{1, 2}}, decoded)
+}
+
+func TestEnvelopeMsgpackInvalid(t *testing.T) {
+	valid, err := (&Envelope{Algorithm: None, Cipher: []byte("x")}).MarshalMsgpack()
+	require.Nil(t, err)
+
+	nested := []byte{0x81, 0xa1, 'x'}
+	for i := 0; i <= maxMsgpackDepth+1; i++ {
+		nested = append(nested, 0x91)
+	}
+	nested = append(nested, 0xc0)
+
+	testData := []struct {
+		description string
+		data        []byte
+	}{
+		{"empty", nil},
+		{"not a map", []byte{0x90}},
+		{"truncated", valid[:len(valid)-1]},
+		{"trailing data", append(append([]byte{}, valid...), 0xc0)},
+		{"no version", []byte{0x80}},
+		{"wrong version", []byte{0x81, 0xa7, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0x02}},
+		{"negative version", []byte{0x81, 0xa7, 'v', 'e', 'r', 's', 'i', 'o', 'n', 0xd0, 0xff}},
+		{"key not a string", []byte{0x81, 0x01, 0x01}},
+		{"field not bytes", []byte{0x81, 0xa3, 'k', 'i', 'd', 0x01}},
+		{"unknown type", []byte{0x81, 0xa1, 'x', 0xc1}},
+		{"nested too deeply", nested},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			var e Envelope
+			assert.NotNil(t, e.UnmarshalMsgpack(tc.data))
+		})
+	}
+}
@@ -0,0 +1,135 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ProtoEnvelopeVersion is the version of the envelope.proto schema written by
+// MarshalProto.
+const ProtoEnvelopeVersion = 1
+
+// The field numbers of envelope.proto.
+const (
+	protoVersionField     protowire.Number = 1
+	protoAlgorithmField   protowire.Number = 2
+	protoKIDField         protowire.Number = 3
+	protoNonceField       protowire.Number = 4
+	protoSignatureField   protowire.Number = 5
+	protoADField          protowire.Number = 6
+	protoCipherField      protowire.Number = 7
+	protoCompressionField protowire.Number = 8
+)
+
+// MarshalProto encodes the envelope as the Envelope message of
+// envelope.proto, so consumers in other languages can read it with code
+// generated from the schema.  ad is sent along as the aad field for receivers
+// that can't work it out themselves; it's authenticated by the cipher but not
+// encrypted, so leave it nil when it's sensitive or the receiver knows it.
+func (e *Envelope) MarshalProto(ad []byte) ([]byte, error) {
+	var data []byte
+	data = protowire.AppendTag(data, protoVersionField, protowire.VarintType)
+	data = protowire.AppendVarint(data, ProtoEnvelopeVersion)
+	data = appendProtoBytes(data, protoAlgorithmField, []byte(e.Algorithm))
+	data = appendProtoBytes(data, protoKIDField, []byte(e.KID))
+	data = appendProtoBytes(data, protoNonceField, e.Nonce)
+	data = appendProtoBytes(data, protoSignatureField, e.Signature)
+	data = appendProtoBytes(data, protoADField, ad)
+	data = appendProtoBytes(data, protoCipherField, e.Cipher)
+	data = appendProtoBytes(data, protoCompressionField, []byte(e.Compression))
+	return data, nil
+}
+
+// appendProtoBytes appends a string or bytes field, leaving it out when it's
+// empty as proto3 does.
+func appendProtoBytes(data []byte, number protowire.Number, value []byte) []byte {
+	if len(value) == 0 {
+		return data
+	}
+	data = protowire.AppendTag(data, number, protowire.BytesType)
+	return protowire.AppendBytes(data, value)
+}
+
+// UnmarshalProto decodes an Envelope message of envelope.proto, returning the
+// aad field.  Fields it doesn't know are skipped, so the schema can grow.
+func (e *Envelope) UnmarshalProto(data []byte) ([]byte, error) {
+	var (
+		decoded Envelope
+		ad      []byte
+		version uint64
+	)
+	for len(data) > 0 {
+		number, wireType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, invalidProtoEnvelope(n)
+		}
+		data = data[n:]
+
+		switch {
+		case number == protoVersionField && wireType == protowire.VarintType:
+			version, n = protowire.ConsumeVarint(data)
+		case number >= protoAlgorithmField && number <= protoCompressionField && wireType == protowire.BytesType:
+			var value []byte
+			value, n = protowire.ConsumeBytes(data)
+			if n >= 0 {
+				decoded.setProtoField(number, value, &ad)
+			}
+		case number >= protoVersionField && number <= protoCompressionField:
+			return nil, fmt.Errorf("invalid envelope: field %d has wire type %d", number, wireType)
+		default:
+			n = protowire.ConsumeFieldValue(number, wireType, data)
+		}
+		if n < 0 {
+			return nil, invalidProtoEnvelope(n)
+		}
+		data = data[n:]
+	}
+	if version != ProtoEnvelopeVersion {
+		return nil, fmt.Errorf("unsupported protobuf envelope version %d", version)
+	}
+	*e = decoded
+	return ad, nil
+}
+
+// setProtoField sets the string or bytes field of the number to a copy of
+// value.
+func (e *Envelope) setProtoField(number protowire.Number, value []byte, ad *[]byte) {
+	switch number {
+	case protoAlgorithmField:
+		e.Algorithm = AlgorithmType(value)
+	case protoKIDField:
+		e.KID = string(value)
+	case protoNonceField:
+		e.Nonce = copyField(value)
+	case protoSignatureField:
+		e.Signature = copyField(value)
+	case protoADField:
+		*ad = copyField(value)
+	case protoCipherField:
+		e.Cipher = copyField(value)
+	case protoCompressionField:
+		e.Compression = Compression(value)
+	}
+}
+
+func invalidProtoEnvelope(n int) error {
+	return fmt.Errorf("invalid envelope: %w", protowire.ParseError(n))
+}
@@ -0,0 +1,143 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// protoEnvelopeDescriptor describes the Envelope message of envelope.proto,
+// so the tests can check the encoding against the protobuf runtime without
+// generated code.
+func protoEnvelopeDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	field := func(name string, number int32, kind descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     kind.Enum(),
+		}
+	}
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("envelope.proto"),
+		Package: proto.String("voynicrypto.v1"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Envelope"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("version", 1, descriptorpb.FieldDescriptorProto_TYPE_UINT32),
+				field("alg", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("kid", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("nonce", 4, descriptorpb.FieldDescriptorProto_TYPE_BYTES),
+				field("signature", 5, descriptorpb.FieldDescriptorProto_TYPE_BYTES),
+				field("aad", 6, descriptorpb.FieldDescriptorProto_TYPE_BYTES),
+				field("ciphertext", 7, descriptorpb.FieldDescriptorProto_TYPE_BYTES),
+				field("compression", 8, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			},
+		}},
+	}, nil)
+	require.Nil(t, err)
+	return file.Messages().Get(0)
+}
+
+func TestEnvelopeProto(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := aesGCMPair(t)
+	ad := []byte("voynicrypto-test")
+	envelope, err := SealEnvelopeWithAD(encrypter, []byte("hello"), ad)
+	require.Nil(err)
+
+	data, err := envelope.MarshalProto(ad)
+	require.Nil(err)
+
+	// the protobuf runtime reads what was written
+	desc := protoEnvelopeDescriptor(t)
+	message := dynamicpb.NewMessage(desc)
+	require.Nil(proto.Unmarshal(data, message))
+	get := func(name string) protoreflect.Value {
+		return message.Get(desc.Fields().ByName(protoreflect.Name(name)))
+	}
+	assert.Equal(uint32(ProtoEnvelopeVersion), uint32(get("version").Uint()))
+	assert.Equal(string(AESGCM), get("alg").String())
+	assert.Equal("k1", get("kid").String())
+	assert.Equal(envelope.Nonce, get("nonce").Bytes())
+	assert.Equal(ad, get("aad").Bytes())
+	assert.Equal(envelope.Cipher, get("ciphertext").Bytes())
+
+	var decoded Envelope
+	decodedAD, err := decoded.UnmarshalProto(data)
+	require.Nil(err)
+	assert.Equal(ad, decodedAD)
+	assert.Equal(*envelope, decoded)
+	message2, err := decoded.OpenWithAD(decrypter, decodedAD)
+	require.Nil(err)
+	assert.Equal("hello", string(message2))
+
+	// and what the protobuf runtime writes can be read, unknown fields and all
+	message.Set(desc.Fields().ByName("compression"), protoreflect.ValueOfString(string(Gzip)))
+	written, err := proto.Marshal(message)
+	require.Nil(err)
+	written = protowire.AppendTag(written, 99, protowire.BytesType)
+	written = protowire.AppendString(written, "from the future")
+	_, err = decoded.UnmarshalProto(written)
+	require.Nil(err)
+	assert.Equal(Gzip, decoded.Compression)
+	assert.Equal(envelope.Cipher, decoded.Cipher)
+}
+
+func TestEnvelopeProtoInvalid(t *testing.T) {
+	valid, err := (&Envelope{Algorithm: None, Cipher: []byte("x")}).MarshalProto(nil)
+	require.Nil(t, err)
+
+	wrongVersion := protowire.AppendTag(nil, protoVersionField, protowire.VarintType)
+	wrongVersion = protowire.AppendVarint(wrongVersion, 2)
+
+	wrongType := protowire.AppendTag(append([]byte{}, valid...), protoKIDField, protowire.VarintType)
+	wrongType = protowire.AppendVarint(wrongType, 1)
+
+	testData := []struct {
+		description string
+		data        []byte
+	}{
+		{"empty", nil},
+		{"truncated", valid[:len(valid)-1]},
+		{"wrong version", wrongVersion},
+		{"wrong wire type", wrongType},
+		{"bad tag", []byte{0xff}},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			var e Envelope
+			_, err := e.UnmarshalProto(tc.data)
+			assert.NotNil(t, err)
+		})
+	}
+}
@@ -0,0 +1,184 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+const (
+	// EnvelopeVersion1 is the envelope format with the algorithm, KID,
+	// nonce, signature and cipher each prefixed with their length.
+	EnvelopeVersion1 byte = 1
+
+	// EnvelopeVersion2 adds the compression to EnvelopeVersion1.
+	EnvelopeVersion2 byte = 2
+)
+
+// EnvelopeCodec encodes and decodes the body of one version of the envelope
+// format, which is everything after the magic number and version.
+type EnvelopeCodec struct {
+	Encode func(e *Envelope) ([]byte, error)
+	Decode func(body []byte) (Envelope, error)
+}
+
+var (
+	envelopeLock   sync.RWMutex
+	envelopeWrite  = EnvelopeVersion1
+	envelopeCodecs = map[byte]EnvelopeCodec{
+		EnvelopeVersion1: {Encode: encodeEnvelopeV1, Decode: decodeEnvelopeV1},
+		EnvelopeVersion2: {Encode: encodeEnvelopeV2, Decode: decodeEnvelopeV2},
+	}
+)
+
+// RegisterEnvelopeVersion adds a version of the envelope format.  New
+// formats, like ones for new KDFs or padding, are rolled out by registering
+// them everywhere first, so every reader can decode them, and then calling
+// SetEnvelopeVersion on the writers.  A version can only be registered once.
+func RegisterEnvelopeVersion(version byte, codec EnvelopeCodec) error {
+	if codec.Encode == nil || codec.Decode == nil {
+		return errors.New("envelope codec needs both an encoder and a decoder")
+	}
+
+	envelopeLock.Lock()
+	defer envelopeLock.Unlock()
+
+	if _, ok := envelopeCodecs[version]; ok {
+		return errors.New("envelope version " + strconv.Itoa(int(version)) + " already registered")
+	}
+	envelopeCodecs[version] = codec
+	return nil
+}
+
+// SetEnvelopeVersion sets the version MarshalBinary writes.  Envelopes of
+// every registered version can always be read.
+func SetEnvelopeVersion(version byte) error {
+	envelopeLock.Lock()
+	defer envelopeLock.Unlock()
+
+	if _, ok := envelopeCodecs[version]; !ok {
+		return unsupportedEnvelopeVersion(version)
+	}
+	envelopeWrite = version
+	return nil
+}
+
+// EnvelopeVersion returns the version MarshalBinary writes.
+func EnvelopeVersion() byte {
+	envelopeLock.RLock()
+	defer envelopeLock.RUnlock()
+	return envelopeWrite
+}
+
+// EnvelopeVersionOf returns the version of a marshalled envelope, so stored
+// envelopes in an old format can be found and migrated.
+func EnvelopeVersionOf(data []byte) (byte, error) {
+	if !bytes.HasPrefix(data, envelopeMagic) || len(data) == len(envelopeMagic) {
+		return 0, errors.New("not an envelope")
+	}
+	return data[len(envelopeMagic)], nil
+}
+
+func getEnvelopeCodec(version byte) (EnvelopeCodec, error) {
+	envelopeLock.RLock()
+	defer envelopeLock.RUnlock()
+
+	codec, ok := envelopeCodecs[version]
+	if !ok {
+		return codec, unsupportedEnvelopeVersion(version)
+	}
+	return codec, nil
+}
+
+func unsupportedEnvelopeVersion(version byte) error {
+	return fmt.Errorf("unsupported envelope version %d", version)
+}
+
+func encodeEnvelopeV1(e *Envelope) ([]byte, error) {
+	if e.Compression != NoCompression {
+		return nil, errors.New("envelope version 1 can't record compression")
+	}
+	return encodeEnvelopeFields([]byte(e.Algorithm), []byte(e.KID), e.Nonce, e.Signature, e.Cipher), nil
+}
+
+func decodeEnvelopeV1(body []byte) (Envelope, error) {
+	fields, err := decodeEnvelopeFields(body, 5)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		Algorithm: AlgorithmType(fields[0]),
+		KID:       string(fields[1]),
+		Nonce:     copyField(fields[2]),
+		Signature: copyField(fields[3]),
+		Cipher:    copyField(fields[4]),
+	}, nil
+}
+
+func encodeEnvelopeV2(e *Envelope) ([]byte, error) {
+	return encodeEnvelopeFields([]byte(e.Algorithm), []byte(e.KID), e.Nonce, e.Signature, e.Cipher, []byte(e.Compression)), nil
+}
+
+func decodeEnvelopeV2(body []byte) (Envelope, error) {
+	fields, err := decodeEnvelopeFields(body, 6)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		Algorithm:   AlgorithmType(fields[0]),
+		KID:         string(fields[1]),
+		Nonce:       copyField(fields[2]),
+		Signature:   copyField(fields[3]),
+		Cipher:      copyField(fields[4]),
+		Compression: Compression(fields[5]),
+	}, nil
+}
+
+// encodeEnvelopeFields writes each field prefixed with its length.
+func encodeEnvelopeFields(fields ...[]byte) []byte {
+	var buffer bytes.Buffer
+	for _, field := range fields {
+		var size [binary.MaxVarintLen64]byte
+		buffer.Write(size[:binary.PutUvarint(size[:], uint64(len(field)))])
+		buffer.Write(field)
+	}
+	return buffer.Bytes()
+}
+
+// decodeEnvelopeFields reads count fields written by encodeEnvelopeFields.
+// The fields share the body's memory.
+func decodeEnvelopeFields(body []byte, count int) ([][]byte, error) {
+	fields := make([][]byte, count)
+	for i := range fields {
+		size, n := binary.Uvarint(body)
+		if n <= 0 || size > uint64(len(body)-n) {
+			return nil, errors.New("envelope is truncated")
+		}
+		fields[i] = body[n : n+int(size)]
+		body = body[n+int(size):]
+	}
+	if len(body) > 0 {
+		return nil, errors.New("envelope has trailing data")
+	}
+	return fields, nil
+}
@@ -0,0 +1,91 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelopeVersions(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// a made up format that stores the envelope as JSON
+	const jsonVersion = 200
+	require.Nil(RegisterEnvelopeVersion(jsonVersion, EnvelopeCodec{
+		Encode: func(e *Envelope) ([]byte, error) {
+			return json.Marshal(struct {
+				Algorithm AlgorithmType
+				KID       string
+				Nonce     []byte
+				Signature []byte
+				Cipher    []byte
+			}{e.Algorithm, e.KID, e.Nonce, e.Signature, e.Cipher})
+		},
+		Decode: func(body []byte) (Envelope, error) {
+			var e Envelope
+			err := json.Unmarshal(body, &struct {
+				Algorithm *AlgorithmType
+				KID       *string
+				Nonce     *[]byte
+				Signature *[]byte
+				Cipher    *[]byte
+			}{&e.Algorithm, &e.KID, &e.Nonce, &e.Signature, &e.Cipher})
+			return e, err
+		},
+	}))
+
+	encrypter, decrypter := loadBoxPair(t)
+	envelope, err := SealEnvelope(encrypter, []byte("hello"))
+	require.Nil(err)
+
+	old, err := envelope.MarshalBinary()
+	require.Nil(err)
+	version, err := EnvelopeVersionOf(old)
+	require.Nil(err)
+	assert.Equal(EnvelopeVersion1, version)
+
+	require.Nil(SetEnvelopeVersion(jsonVersion))
+	defer SetEnvelopeVersion(EnvelopeVersion1)
+	assert.Equal(byte(jsonVersion), EnvelopeVersion())
+	data, err := envelope.MarshalBinary()
+	require.Nil(err)
+	version, err = EnvelopeVersionOf(data)
+	require.Nil(err)
+	assert.Equal(byte(jsonVersion), version)
+
+	// both versions can be read
+	for _, d := range [][]byte{old, data} {
+		message, err := DecryptEnvelope(decrypter, d)
+		require.Nil(err)
+		assert.Equal([]byte("hello"), message)
+	}
+
+	assert.NotNil(RegisterEnvelopeVersion(jsonVersion, EnvelopeCodec{Encode: encodeEnvelopeV1, Decode: decodeEnvelopeV1}))
+	assert.NotNil(RegisterEnvelopeVersion(EnvelopeVersion1, EnvelopeCodec{Encode: encodeEnvelopeV1, Decode: decodeEnvelopeV1}))
+	assert.NotNil(RegisterEnvelopeVersion(201, EnvelopeCodec{Encode: encodeEnvelopeV1}))
+	assert.NotNil(SetEnvelopeVersion(201))
+	_, err = envelope.MarshalBinaryVersion(201)
+	assert.NotNil(err)
+	_, err = EnvelopeVersionOf([]byte("VCE"))
+	assert.NotNil(err)
+}
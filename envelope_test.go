@@ -0,0 +1,118 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope(t *testing.T) {
+	boxEncrypter, boxDecrypter := loadBoxPair(t)
+
+	privateKey := GeneratePrivateKey(2048)
+	signingKey := GeneratePrivateKey(2048)
+
+	testData := []struct {
+		description string
+		encrypter   Encrypt
+		decrypter   Decrypt
+		alg         AlgorithmType
+		signed      bool
+	}{
+		{"none", DefaultCipherEncrypter(), DefaultCipherDecrypter(), None, false},
+		{"box", boxEncrypter, boxDecrypter, Box, false},
+		{"rsa symmetric",
+			NewRSAEncrypter(DefaultRSAHash, nil, &privateKey.PublicKey, "sym"),
+			NewRSADecrypter(DefaultRSAHash, privateKey, nil, "sym"),
+			RSASymmetric, false},
+		{"rsa asymmetric",
+			NewRSAEncrypter(DefaultRSAHash, signingKey, &privateKey.PublicKey, "asy"),
+			NewRSADecrypter(DefaultRSAHash, privateKey, &signingKey.PublicKey, "asy"),
+			// signing RSA ciphers have always reported rsa-sym
+			RSASymmetric, true},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			envelope, err := SealEnvelope(tc.encrypter, []byte("hello"))
+			require.Nil(err)
+			assert.Equal(tc.alg, envelope.Algorithm)
+			assert.Equal(tc.encrypter.GetKID(), envelope.KID)
+			assert.Equal(tc.signed, len(envelope.Signature) > 0)
+
+			data, err := envelope.MarshalBinary()
+			require.Nil(err)
+			message, err := DecryptEnvelope(tc.decrypter, data)
+			require.Nil(err)
+			assert.Equal([]byte("hello"), message)
+
+			var decoded Envelope
+			require.Nil(decoded.UnmarshalText([]byte(envelope.String())))
+			assert.Equal(*envelope, decoded)
+
+			encoded, err := json.Marshal(struct{ Payload *Envelope }{envelope})
+			require.Nil(err)
+			var wrapper struct{ Payload *Envelope }
+			require.Nil(json.Unmarshal(encoded, &wrapper))
+			message, err = wrapper.Payload.Open(tc.decrypter)
+			require.Nil(err)
+			assert.Equal([]byte("hello"), message)
+		})
+	}
+}
+
+func TestEnvelopeErrors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := loadBoxPair(t)
+	envelope, err := SealEnvelope(encrypter, []byte("hello"))
+	require.Nil(err)
+	data, err := envelope.MarshalBinary()
+	require.Nil(err)
+
+	bad := [][]byte{
+		nil,
+		[]byte("VCE"),
+		[]byte("nope"),
+		append([]byte("VCE"), 2),
+		data[:len(data)-1],
+		append(append([]byte{}, data...), 0),
+	}
+	for _, b := range bad {
+		_, err := DecryptEnvelope(decrypter, b)
+		assert.NotNil(err, "%q", b)
+	}
+
+	var e Envelope
+	assert.NotNil(e.UnmarshalText([]byte("!!!")))
+
+	_, err = envelope.Open(DefaultCipherDecrypter())
+	assert.NotNil(err, "algorithm mismatch")
+
+	envelope.KID = "other"
+	_, err = envelope.Open(NewBoxDecrypter([32]byte{}, [32]byte{}, "kid"))
+	assert.NotNil(err, "kid mismatch")
+}
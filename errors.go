@@ -0,0 +1,97 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned, usually wrapped, by the ciphers, signers and key loaders.
+// Use errors.Is to check for them.
+var (
+	// ErrDecryptFailed means a message could not be decrypted, because it
+	// was tampered with or encrypted with a different key.
+	ErrDecryptFailed = errors.New("failed to decrypt message")
+
+	// ErrSignatureInvalid means a signature didn't match the message, or
+	// couldn't be a signature of the key at all.
+	ErrSignatureInvalid = errors.New("failed to validate signature")
+
+	// ErrInvalidNonce means a nonce is not the length the cipher requires, or
+	// is not one the cipher could have made.
+	ErrInvalidNonce = errors.New("invalid nonce")
+
+	// ErrWrongKeyType means a key was parsed but is not the kind of key that
+	// was asked for, like an RSA key where an EC key was expected.
+	ErrWrongKeyType = errors.New("wrong key type")
+
+	// ErrInvalidKey means key data couldn't be parsed, like a file with no
+	// pem block, a truncated key or data after the key.
+	ErrInvalidKey = errors.New("invalid key")
+
+	// ErrKeyMismatch means a public key configured along with its private
+	// key is not the public key of that private key.
+	ErrKeyMismatch = errors.New("keys do not match")
+
+	// ErrKeyNotFound means a key or the cipher for a KID doesn't exist.
+	ErrKeyNotFound = errors.New("key not found")
+
+	// ErrUnknownAlgorithm means an algorithm type is neither built in nor
+	// registered.
+	ErrUnknownAlgorithm = errors.New("unknown algorithm type")
+
+	// ErrSelfTestFailed means a known-answer test of SelfTest failed.
+	ErrSelfTestFailed = errors.New("self-test failed")
+
+	// ErrLimitExceeded means an operation was rejected because it waited
+	// too long for a limited cipher.
+	ErrLimitExceeded = errors.New("limit exceeded")
+)
+
+// wrongKeyType returns an ErrWrongKeyType with the reason appended.
+func wrongKeyType(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrWrongKeyType, fmt.Sprintf(format, args...))
+}
+
+// checkNonceSize returns an ErrInvalidNonce if the nonce isn't size bytes.
+func checkNonceSize(nonce []byte, size int) error {
+	if len(nonce) != size {
+		return fmt.Errorf("%w: nonce is %d bytes, expected %d", ErrInvalidNonce, len(nonce), size)
+	}
+	return nil
+}
+
+// checkSignatureSize returns an ErrSignatureInvalid if the signature isn't
+// size bytes.
+func checkSignatureSize(signature []byte, size int) error {
+	if len(signature) != size {
+		return fmt.Errorf("%w: signature is %d bytes, expected %d", ErrSignatureInvalid, len(signature), size)
+	}
+	return nil
+}
+
+// invalidKey returns an ErrInvalidKey with the reason appended.
+func invalidKey(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidKey, fmt.Sprintf(format, args...))
+}
+
+// keyNotFound returns an ErrKeyNotFound with the reason appended.
+func keyNotFound(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrKeyNotFound, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,169 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	encrypter, decrypter := loadBoxPair(t)
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	testData := []struct {
+		description string
+		run         func() error
+		expected    error
+	}{
+		{"tampered box message", func() error {
+			cipher, nonce, err := encrypter.EncryptMessage([]byte("message"))
+			require.Nil(t, err)
+			cipher[0] ^= 0xff
+			_, err = decrypter.DecryptMessage(cipher, nonce)
+			return err
+		}, ErrDecryptFailed},
+		{"associated data mismatch", func() error {
+			cipher, nonce, err := EncryptMessageWithAD(encrypter, []byte("message"), []byte("a"))
+			require.Nil(t, err)
+			_, err = DecryptMessageWithAD(decrypter, cipher, nonce, []byte("b"))
+			return err
+		}, ErrDecryptFailed},
+		{"bad signature", func() error {
+			signature, err := NewEd25519Signer(privateKey, "").SignMessage([]byte("message"))
+			require.Nil(t, err)
+			return NewEd25519Verifier(publicKey, "").VerifyMessage([]byte("massage"), signature)
+		}, ErrSignatureInvalid},
+		{"rsa key as ec key", func() error {
+			_, err := GetECPublicKey(&FileLoader{Path: "public.pem"}, nil)
+			return err
+		}, ErrWrongKeyType},
+		{"ec key on wrong curve", func() error {
+			_, err := GetECPublicKey(ecdsaKeyLoaders(t, elliptic.P256())[PublicKey], elliptic.P384())
+			return err
+		}, ErrWrongKeyType},
+		{"missing file", func() error {
+			_, err := (&FileLoader{Path: "missing.pem"}).GetBytes()
+			return err
+		}, ErrKeyNotFound},
+		{"unset environment variable", func() error {
+			_, err := (&EnvLoader{Name: "VOYNICRYPTO_TEST_UNSET"}).GetBytes()
+			return err
+		}, ErrKeyNotFound},
+		{"unknown kid", func() error {
+			_, err := NewRouter(nil).Route(Box, "unknown")
+			return err
+		}, ErrKeyNotFound},
+		{"missing keys", func() error {
+			_, err := (&Config{Type: Box}).LoadDecrypt()
+			return err
+		}, ErrKeyNotFound},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			err := tc.run()
+			assert.True(errors.Is(err, tc.expected), "%v", err)
+		})
+	}
+}
+
+func TestInvalidNonces(t *testing.T) {
+	_, boxDecrypter := loadBoxPair(t)
+	_, gcmDecrypter := aesGCMPair(t)
+	_, rsaDecrypter := rsaPair(t)
+	_, ratchetDecrypter := ratchetPair(t)
+	_, recipientPrivateKey, err := GenerateBoxKeyPair()
+	require.Nil(t, err)
+	ephemeralDecrypter, err := NewBoxEphemeralDecrypt(*recipientPrivateKey)
+	require.Nil(t, err)
+
+	testData := []struct {
+		description string
+		decrypter   Decrypt
+		size        int
+		expected    error
+	}{
+		{"box", boxDecrypter, 24, ErrInvalidNonce},
+		{"box ephemeral", ephemeralDecrypter, 24, ErrInvalidNonce},
+		{"aes-gcm", gcmDecrypter, aesGCMNonceSize, ErrInvalidNonce},
+		{"ratchet", ratchetDecrypter, aesGCMNonceSize, ErrInvalidNonce},
+		{"rsa signature", rsaDecrypter, 256, ErrSignatureInvalid},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			cipher := make([]byte, 64)
+			for _, nonce := range [][]byte{nil, make([]byte, tc.size-1), make([]byte, tc.size+1)} {
+				_, err := tc.decrypter.DecryptMessage(cipher, nonce)
+				assert.True(errors.Is(err, tc.expected), "%d byte nonce: %v", len(nonce), err)
+
+				_, err = DecryptMessageInPlace(tc.decrypter, append([]byte{}, cipher...), nonce)
+				assert.True(errors.Is(err, tc.expected), "%d byte nonce in place: %v", len(nonce), err)
+			}
+		})
+	}
+}
+
+func TestInvalidSignatures(t *testing.T) {
+	edPublicKey, edPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+	ecPrivateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	rsaPrivateKey, err := GenerateRSAKey(0)
+	require.Nil(t, err)
+
+	testData := []struct {
+		description string
+		signer      Sign
+		verifier    Verify
+	}{
+		{"ed25519", NewEd25519Signer(edPrivateKey, ""), NewEd25519Verifier(edPublicKey, "")},
+		{"ecdsa", NewECDSASigner(crypto.SHA256, ecPrivateKey, ""), NewECDSAVerifier(crypto.SHA256, &ecPrivateKey.PublicKey, "")},
+		{"rsa-pss", NewRSAPSSSigner(crypto.SHA256, rsaPrivateKey, ""), NewRSAPSSVerifier(crypto.SHA256, &rsaPrivateKey.PublicKey, "")},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			signature, err := tc.signer.SignMessage([]byte("message"))
+			require.Nil(err)
+			require.Nil(tc.verifier.VerifyMessage([]byte("message"), signature))
+
+			for _, bad := range [][]byte{nil, signature[:len(signature)-1], append(signature, 0)} {
+				err := tc.verifier.VerifyMessage([]byte("message"), bad)
+				assert.True(errors.Is(err, ErrSignatureInvalid), "%d byte signature: %v", len(bad), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// DefaultExecTimeout is how long an ExecLoader command may run when no
+// timeout is configured.
+const DefaultExecTimeout = 10 * time.Second
+
+// maxExecErrorOutput limits how much of stderr ends up in an error.
+const maxExecErrorOutput = 256
+
+// ExecLoader loads a key from the standard output of a command, such as
+// `pass show` or a secret broker's CLI.
+//
+// The command does not inherit the environment of this process.  Only Env
+// and the variables named in InheritEnv are visible to it.
+type ExecLoader struct {
+	// Command is the program to run.  It is looked up in the PATH of this
+	// process if it does not contain a path separator.
+	Command string
+
+	// Args are the arguments passed to the command.
+	Args []string
+
+	// Env holds extra environment variables for the command in key=value form.
+	Env []string
+
+	// InheritEnv names environment variables copied from this process, for
+	// example PATH or HOME.
+	InheritEnv []string
+
+	// Dir is the working directory of the command.  If not supplied, the
+	// working directory of this process is used.
+	Dir string
+
+	// Timeout limits how long the command may run.  If not supplied,
+	// DefaultExecTimeout is used instead.
+	Timeout time.Duration
+}
+
+// GetBytes runs the command and returns its output.
+func (e *ExecLoader) GetBytes() ([]byte, error) {
+	return e.GetBytesContext(context.Background())
+}
+
+// GetBytesContext runs the command and returns its output.  The command is
+// killed if the context is done before it finishes.
+func (e *ExecLoader) GetBytesContext(ctx context.Context) ([]byte, error) {
+	if e.Command == "" {
+		return nil, errors.New("no command")
+	}
+
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = DefaultExecTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// #nosec G204 -- running an operator configured command is the point
+	cmd := exec.CommandContext(ctx, e.Command, e.Args...)
+	cmd.Dir = e.Dir
+	cmd.Env = e.environment()
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		message := strings.TrimSpace(stderr.String())
+		if len(message) > maxExecErrorOutput {
+			message = message[:maxExecErrorOutput]
+		}
+		if message != "" {
+			return nil, fmt.Errorf("command %s failed: %s: %w", e.Command, message, err)
+		}
+		return nil, fmt.Errorf("command %s failed: %w", e.Command, err)
+	}
+
+	if stdout.Len() == 0 {
+		return nil, errors.New("command " + e.Command + " produced no output")
+	}
+	return stdout.Bytes(), nil
+}
+
+func (e *ExecLoader) environment() []string {
+	// a non-nil environment keeps exec from inheriting the whole process environment
+	env := make([]string, 0, len(e.InheritEnv)+len(e.Env))
+	for _, name := range e.InheritEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return append(env, e.Env...)
+}
@@ -0,0 +1,93 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecLoader(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	os.Setenv("VOYNICRYPTO_TEST_SECRET", "leaked")
+	defer os.Unsetenv("VOYNICRYPTO_TEST_SECRET")
+	os.Setenv("VOYNICRYPTO_TEST_INHERITED", "inherited")
+	defer os.Unsetenv("VOYNICRYPTO_TEST_INHERITED")
+
+	testData := []struct {
+		description string
+		loader      ExecLoader
+		expected    string
+		expectedErr bool
+	}{
+		{"output", ExecLoader{Command: "sh", Args: []string{"-c", "printf key"}}, "key", false},
+		{"isolated environment", ExecLoader{
+			Command: "sh",
+			Args:    []string{"-c", `printf "$VOYNICRYPTO_TEST_SECRET|$VOYNICRYPTO_TEST_INHERITED|$EXTRA"`},
+			Env:     []string{"EXTRA=extra"},
+			InheritEnv: []string{
+				"VOYNICRYPTO_TEST_INHERITED",
+				"VOYNICRYPTO_TEST_MISSING",
+			},
+		}, "|inherited|extra", false},
+		{"failure", ExecLoader{Command: "sh", Args: []string{"-c", "echo denied >&2; exit 3"}}, "", true},
+		{"no output", ExecLoader{Command: "sh", Args: []string{"-c", "true"}}, "", true},
+		{"no command", ExecLoader{}, "", true},
+		{"missing command", ExecLoader{Command: "/voynicrypto/does/not/exist"}, "", true},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			data, err := tc.loader.GetBytes()
+			if tc.expectedErr {
+				assert.NotNil(err)
+				return
+			}
+			assert.Nil(err)
+			assert.Equal(tc.expected, string(data))
+		})
+	}
+}
+
+func TestExecLoaderTimeout(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep is not available")
+	}
+	assert := assert.New(t)
+
+	loader := ExecLoader{
+		Command:    "sleep",
+		Args:       []string{"5"},
+		InheritEnv: []string{"PATH"},
+		Timeout:    50 * time.Millisecond,
+	}
+
+	start := time.Now()
+	_, err := loader.GetBytes()
+	assert.NotNil(err)
+	assert.True(time.Since(start) < 5*time.Second)
+}
@@ -0,0 +1,139 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// fallback returns the i-th fallback, sharing the logger, metrics and tracer
+// of the config when it has none of its own.
+func (config *Config) fallback(i int) *Config {
+	fallback := config.Fallbacks[i]
+	if fallback.Logger == nil {
+		fallback.Logger = config.Logger
+	}
+	if fallback.Metrics == nil {
+		fallback.Metrics = config.Metrics
+	}
+	if fallback.Tracer == nil {
+		fallback.Tracer = config.Tracer
+	}
+	if fallback.NonceSource == nil {
+		fallback.NonceSource = config.NonceSource
+	}
+	if fallback.Random == nil {
+		fallback.Random = config.Random
+	}
+	return &fallback
+}
+
+// loadFallbackEncrypt returns the encrypter of the first fallback that loads.
+func (config *Config) loadFallbackEncrypt(ctx context.Context, err error) (Encrypt, error) {
+	errs := []error{err}
+	for i := range config.Fallbacks {
+		encrypter, err := config.fallback(i).LoadEncryptContext(ctx)
+		if err == nil {
+			return encrypter, nil
+		}
+		errs = append(errs, fmt.Errorf("fallback[%d]: %w", i, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// loadFallbackDecrypt combines the decrypter of the config with the
+// decrypters of every fallback that loads.
+func (config *Config) loadFallbackDecrypt(ctx context.Context, decrypter Decrypt, err error) (Decrypt, error) {
+	var (
+		decrypters []Decrypt
+		errs       []error
+	)
+	if err == nil {
+		decrypters = append(decrypters, decrypter)
+	} else {
+		errs = append(errs, err)
+	}
+	for i := range config.Fallbacks {
+		decrypter, err := config.fallback(i).LoadDecryptContext(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("fallback[%d]: %w", i, err))
+			continue
+		}
+		decrypters = append(decrypters, decrypter)
+	}
+
+	switch len(decrypters) {
+	case 0:
+		return nil, errors.Join(errs...)
+	case 1:
+		return decrypters[0], nil
+	}
+	return &fallbackDecrypter{decrypters: decrypters}, nil
+}
+
+// fallbackDecrypter tries each decrypter in order until one succeeds.  A NOOP
+// decrypter always succeeds, so it only makes sense as the last one.
+type fallbackDecrypter struct {
+	decrypters []Decrypt
+}
+
+// GetAlgorithm returns the algorithm of the first decrypter.
+func (f *fallbackDecrypter) GetAlgorithm() AlgorithmType {
+	return f.decrypters[0].GetAlgorithm()
+}
+
+// GetKID returns the KID of the first decrypter.
+func (f *fallbackDecrypter) GetKID() string {
+	return f.decrypters[0].GetKID()
+}
+
+// DecryptMessage returns the message from the first decrypter that can
+// decrypt it.
+func (f *fallbackDecrypter) DecryptMessage(cipher []byte, nonce []byte) ([]byte, error) {
+	return f.DecryptMessageContext(context.Background(), cipher, nonce)
+}
+
+// DecryptMessageContext returns the message from the first decrypter that can
+// decrypt it, passing the context along to each.
+func (f *fallbackDecrypter) DecryptMessageContext(ctx context.Context, cipher []byte, nonce []byte) ([]byte, error) {
+	errs := make([]error, 0, len(f.decrypters))
+	for _, decrypter := range f.decrypters {
+		message, err := DecryptMessageContext(ctx, decrypter, cipher, nonce)
+		if err == nil {
+			return message, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// DecryptMessageWithAD returns the message from the first decrypter that can
+// decrypt it with the associated data.
+func (f *fallbackDecrypter) DecryptMessageWithAD(cipher []byte, nonce []byte, ad []byte) ([]byte, error) {
+	errs := make([]error, 0, len(f.decrypters))
+	for _, decrypter := range f.decrypters {
+		message, err := DecryptMessageWithAD(decrypter, cipher, nonce, ad)
+		if err == nil {
+			return message, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
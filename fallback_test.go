@@ -0,0 +1,117 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFallbacks(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := os.Getwd()
+	require.Nil(err)
+
+	rsaConfig := Config{
+		Type:   RSASymmetric,
+		KID:    "old",
+		Params: map[string]string{"hash": "SHA512"},
+		Keys: map[KeyType]string{
+			PublicKey:  filepath.Join(dir, "public.pem"),
+			PrivateKey: filepath.Join(dir, "private.pem"),
+		},
+	}
+	boxConfig := Config{
+		Type: Box,
+		KID:  "new",
+		Keys: map[KeyType]string{
+			SenderPrivateKey:    filepath.Join(dir, "sendBoxPrivate.pem"),
+			SenderPublicKey:     filepath.Join(dir, "sendBoxPublic.pem"),
+			RecipientPrivateKey: filepath.Join(dir, "boxPrivate.pem"),
+			RecipientPublicKey:  filepath.Join(dir, "boxPublic.pem"),
+		},
+	}
+
+	oldEncrypter, err := rsaConfig.LoadEncrypt()
+	require.Nil(err)
+	newEncrypter, err := boxConfig.LoadEncrypt()
+	require.Nil(err)
+
+	// a consumer that moved to box still reads messages from old producers
+	consumer := boxConfig
+	consumer.Logger = newTestLogger(t)
+	consumer.Fallbacks = []Config{rsaConfig}
+	require.Nil(consumer.Validate())
+
+	decrypter, err := consumer.LoadDecrypt()
+	require.Nil(err)
+	assert.Equal(Box, decrypter.GetAlgorithm())
+	assert.Equal("new", decrypter.GetKID())
+
+	for _, encrypter := range []Encrypt{oldEncrypter, newEncrypter} {
+		cipher, nonce, err := encrypter.EncryptMessage([]byte("hello"))
+		require.Nil(err)
+		message, err := decrypter.DecryptMessage(cipher, nonce)
+		assert.Nil(err)
+		assert.Equal([]byte("hello"), message)
+	}
+
+	_, err = decrypter.DecryptMessage([]byte("garbage"), []byte("garbage"))
+	assert.NotNil(err)
+
+	// a producer without the new keys yet keeps using the old ones
+	producer := boxConfig
+	producer.Keys = map[KeyType]string{
+		SenderPrivateKey:   filepath.Join(dir, "missing.pem"),
+		RecipientPublicKey: filepath.Join(dir, "boxPublic.pem"),
+	}
+	producer.Fallbacks = []Config{rsaConfig}
+
+	encrypter, err := producer.LoadEncrypt()
+	require.Nil(err)
+	assert.Equal("old", encrypter.GetKID())
+
+	// when nothing loads every error is reported
+	producer.Fallbacks = []Config{{Type: "rot13"}}
+	encrypter, err = producer.LoadEncrypt()
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "fallback[0]")
+	assert.Equal(None, encrypter.GetAlgorithm())
+
+	consumer.Keys = producer.Keys
+	consumer.Fallbacks = []Config{{Type: "rot13"}, {Type: "rot26"}}
+	_, err = consumer.LoadDecrypt()
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "fallback[1]")
+}
+
+func TestValidateFallbacks(t *testing.T) {
+	assert := assert.New(t)
+
+	config := Config{Type: None, Fallbacks: []Config{{Type: None}, {}}}
+	problems, ok := config.Validate().(ValidationErrors)
+	if assert.True(ok) && assert.Len(problems, 1) {
+		assert.Contains(problems[0].Error(), "fallback[1]")
+	}
+}
@@ -0,0 +1,261 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// FieldTag is the struct tag that marks the fields EncryptFields and
+// DecryptFields work on, as in:
+//
+//	type User struct {
+//		Name  string
+//		Email string `json:"email" voynicrypto:"encrypt"`
+//	}
+const FieldTag = "voynicrypto"
+
+// EncryptFields encrypts, in place, every field of the struct v points to that
+// is tagged `voynicrypto:"encrypt"`.  string fields are replaced by the text
+// form of the envelope, and []byte fields by the marshalled envelope, so the
+// rest of the document stays plaintext and can still be marshalled as JSON.
+// Nested structs, pointers, interfaces, slices, arrays and map values are
+// walked too; each is walked once, so cycles end and a field reached more
+// than one way is encrypted once.  Empty fields are left empty, and a tagged
+// field that can't be set is an error.  If any field fails, the fields
+// already changed are put back, leaving v as it was.
+//
+// The fields aren't bound to their names, so an encrypted value copied into
+// another tagged field decrypts there; use Tokenize where that matters.
+func EncryptFields(encrypter Encrypt, v interface{}) error {
+	if encrypter == nil {
+		return errors.New("no encrypter")
+	}
+	return walkFields(v, func(field reflect.Value) error {
+		switch field.Kind() {
+		case reflect.String:
+			e, err := SealEnvelope(encrypter, []byte(field.String()))
+			if err != nil {
+				return err
+			}
+			field.SetString(e.String())
+		default:
+			e, err := SealEnvelope(encrypter, field.Bytes())
+			if err != nil {
+				return err
+			}
+			data, err := e.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			field.SetBytes(data)
+		}
+		return nil
+	})
+}
+
+// DecryptFields reverses EncryptFields, opening each tagged field with the
+// decrypter the router finds for it.  As with EncryptFields, v is left as it
+// was if any field fails.
+func DecryptFields(router *Router, v interface{}) error {
+	if router == nil {
+		return errors.New("no router")
+	}
+	return walkFields(v, func(field reflect.Value) error {
+		var e Envelope
+		switch field.Kind() {
+		case reflect.String:
+			if err := e.UnmarshalText([]byte(field.String())); err != nil {
+				return err
+			}
+		default:
+			if err := e.UnmarshalBinary(field.Bytes()); err != nil {
+				return err
+			}
+		}
+		message, err := router.Open(&e)
+		if err != nil {
+			return err
+		}
+		if field.Kind() == reflect.String {
+			field.SetString(string(message))
+		} else {
+			field.SetBytes(message)
+		}
+		return nil
+	})
+}
+
+// walkFields calls f for every non-empty tagged field reachable from v, which
+// must be a pointer to a struct.  If f fails, every field changed so far is
+// restored.
+func walkFields(v interface{}, f func(reflect.Value) error) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("can't walk the fields of %T, a pointer to a struct is required", v)
+	}
+	w := fieldWalker{f: f, visited: make(map[visit]bool)}
+	if err := w.walk(value.Elem(), value.Elem().Type().Name()); err != nil {
+		for i := len(w.undo) - 1; i >= 0; i-- {
+			w.undo[i]()
+		}
+		return err
+	}
+	return nil
+}
+
+// visit identifies memory already walked.  The type is part of it because a
+// struct and its first field share an address.
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+type fieldWalker struct {
+	f       func(reflect.Value) error
+	visited map[visit]bool
+	undo    []func()
+}
+
+// seen reports whether ptr has been walked as a typ, marking it walked.
+func (w *fieldWalker) seen(ptr uintptr, typ reflect.Type) bool {
+	v := visit{ptr: ptr, typ: typ}
+	if w.visited[v] {
+		return true
+	}
+	w.visited[v] = true
+	return false
+}
+
+// save records the current value of field so that it can be restored.
+func (w *fieldWalker) save(field reflect.Value) {
+	old := reflect.New(field.Type()).Elem()
+	old.Set(field)
+	w.undo = append(w.undo, func() { field.Set(old) })
+}
+
+func (w *fieldWalker) walk(value reflect.Value, path string) error {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if value.IsNil() || w.seen(value.Pointer(), value.Type()) {
+			return nil
+		}
+		return w.walk(value.Elem(), path)
+	case reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		elem := value.Elem()
+		if (elem.Kind() != reflect.Struct && elem.Kind() != reflect.Array) || !value.CanSet() {
+			return w.walk(elem, path)
+		}
+		// structs and arrays held in an interface can't be set in place, so
+		// they are copied out and back
+		copied := reflect.New(elem.Type()).Elem()
+		copied.Set(elem)
+		if err := w.walk(copied, path); err != nil {
+			return err
+		}
+		w.save(value)
+		value.Set(copied)
+	case reflect.Slice, reflect.Array:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		if value.Kind() == reflect.Slice && (value.Len() == 0 || w.seen(value.Pointer(), value.Type())) {
+			return nil
+		}
+		for i := 0; i < value.Len(); i++ {
+			if err := w.walk(value.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if value.IsNil() || w.seen(value.Pointer(), value.Type()) {
+			return nil
+		}
+		// map values can't be set in place, so they are copied out and back
+		iter := value.MapRange()
+		for iter.Next() {
+			key, old := iter.Key(), iter.Value()
+			elem := reflect.New(old.Type()).Elem()
+			elem.Set(old)
+			if err := w.walk(elem, fmt.Sprintf("%s[%v]", path, key)); err != nil {
+				return err
+			}
+			value.SetMapIndex(key, elem)
+			w.undo = append(w.undo, func() { value.SetMapIndex(key, old) })
+		}
+	case reflect.Struct:
+		t := value.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if sf.PkgPath != "" && !sf.Anonymous {
+				continue
+			}
+			field := value.Field(i)
+			fieldPath := path + "." + sf.Name
+			if !fieldTagged(sf) {
+				if err := w.walk(field, fieldPath); err != nil {
+					return err
+				}
+				continue
+			}
+			if !isStringOrBytes(field) {
+				return fmt.Errorf("field %s is tagged for encryption but is a %s, not a string or []byte", fieldPath, field.Type())
+			}
+			if !field.CanSet() {
+				return fmt.Errorf("field %s is tagged for encryption but can't be set", fieldPath)
+			}
+			if field.Len() == 0 || w.seen(field.UnsafeAddr(), field.Type()) {
+				continue
+			}
+			w.save(field)
+			if err := w.f(field); err != nil {
+				return fmt.Errorf("field %s: %w", fieldPath, err)
+			}
+		}
+	}
+	return nil
+}
+
+func fieldTagged(sf reflect.StructField) bool {
+	tag, ok := sf.Tag.Lookup(FieldTag)
+	if !ok {
+		return false
+	}
+	for _, option := range strings.Split(tag, ",") {
+		if strings.TrimSpace(option) == "encrypt" {
+			return true
+		}
+	}
+	return false
+}
+
+func isStringOrBytes(field reflect.Value) bool {
+	switch field.Kind() {
+	case reflect.String:
+		return true
+	case reflect.Slice:
+		return field.Type().Elem().Kind() == reflect.Uint8
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testAddress struct {
+	Street string `json:"street" voynicrypto:"encrypt"`
+	City   string `json:"city"`
+}
+
+type testUser struct {
+	Name     string                 `json:"name"`
+	Email    string                 `json:"email" voynicrypto:"encrypt"`
+	SSN      []byte                 `json:"ssn" voynicrypto:"encrypt"`
+	Phone    string                 `json:"phone,omitempty" voynicrypto:"encrypt"`
+	Home     *testAddress           `json:"home"`
+	Previous []testAddress          `json:"previous"`
+	Labelled map[string]testAddress `json:"labelled"`
+	Nothing  *testAddress           `json:"nothing"`
+	ignored  string                 `voynicrypto:"encrypt"`
+}
+
+func TestFields(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	key := make([]byte, 32)
+	encrypter, err := NewAESGCMEncrypt(key, WithKID("k1"))
+	require.Nil(err)
+	decrypter, err := NewAESGCMDecrypt(key, WithKID("k1"))
+	require.Nil(err)
+	router := NewRouter(nil)
+	require.Nil(router.Register(decrypter))
+
+	newUser := func() testUser {
+		return testUser{
+			Name:     "alice",
+			Email:    "alice@example.com",
+			SSN:      []byte("123-45-6789"),
+			Home:     &testAddress{Street: "1 Main St", City: "Springfield"},
+			Previous: []testAddress{{Street: "2 Elm St", City: "Shelbyville"}},
+			Labelled: map[string]testAddress{"work": {Street: "3 Oak St", City: "Capital City"}},
+			ignored:  "private",
+		}
+	}
+	original, user := newUser(), newUser()
+
+	require.Nil(EncryptFields(encrypter, &user))
+	assert.Equal("alice", user.Name)
+	assert.Equal("Springfield", user.Home.City)
+	assert.Equal("", user.Phone)
+	assert.Equal("private", user.ignored)
+	assert.NotEqual(original.Email, user.Email)
+	assert.NotEqual(original.SSN, user.SSN)
+	assert.NotEqual(original.Home.Street, user.Home.Street)
+	assert.NotEqual(original.Previous[0].Street, user.Previous[0].Street)
+	assert.NotEqual(original.Labelled["work"].Street, user.Labelled["work"].Street)
+
+	data, err := json.Marshal(&user)
+	require.Nil(err)
+	assert.NotContains(string(data), "alice@example.com")
+	assert.Contains(string(data), "Springfield")
+
+	var decoded testUser
+	require.Nil(json.Unmarshal(data, &decoded))
+	require.Nil(DecryptFields(router, &decoded))
+	decoded.ignored = original.ignored
+	assert.Equal(original, decoded)
+
+	assert.NotNil(EncryptFields(encrypter, user))
+	assert.NotNil(EncryptFields(encrypter, (*testUser)(nil)))
+	assert.NotNil(EncryptFields(nil, &user))
+	assert.NotNil(DecryptFields(nil, &user))
+
+	bad := struct {
+		Count int `voynicrypto:"encrypt"`
+	}{1}
+	assert.NotNil(EncryptFields(encrypter, &bad))
+
+	garbage := testAddress{Street: "not an envelope"}
+	assert.NotNil(DecryptFields(router, &garbage))
+}
+
+type testNode struct {
+	Secret string `voynicrypto:"encrypt"`
+	Parent *testNode
+	Kids   []*testNode
+	Extra  interface{}
+}
+
+func TestFieldsCycles(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	key := make([]byte, 32)
+	encrypter, err := NewAESGCMEncrypt(key, WithKID("k1"))
+	require.Nil(err)
+	decrypter, err := NewAESGCMDecrypt(key, WithKID("k1"))
+	require.Nil(err)
+	router := NewRouter(nil)
+	require.Nil(router.Register(decrypter))
+
+	root := &testNode{Secret: "root"}
+	kid := &testNode{Secret: "kid", Parent: root}
+	root.Kids = []*testNode{kid, kid}
+	root.Extra = root.Kids
+
+	require.Nil(EncryptFields(encrypter, root))
+	assert.NotEqual("root", root.Secret)
+	assert.NotEqual("kid", kid.Secret)
+
+	require.Nil(DecryptFields(router, root))
+	assert.Equal("root", root.Secret)
+	assert.Equal("kid", kid.Secret)
+}
+
+func TestFieldsRestoredOnError(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	key := make([]byte, 32)
+	decrypter, err := NewAESGCMDecrypt(key, WithKID("k1"))
+	require.Nil(err)
+	router := NewRouter(nil)
+	require.Nil(router.Register(decrypter))
+
+	encrypter, err := NewAESGCMEncrypt(key, WithKID("k1"))
+	require.Nil(err)
+	valid := testAddress{Street: "1 Main St"}
+	require.Nil(EncryptFields(encrypter, &valid))
+
+	document := struct {
+		Email    string `voynicrypto:"encrypt"`
+		Home     *testAddress
+		Labelled map[string]testAddress
+		Broken   string `voynicrypto:"encrypt"`
+	}{
+		Email:    valid.Street,
+		Home:     &testAddress{Street: valid.Street},
+		Labelled: map[string]testAddress{"work": {Street: valid.Street}},
+		Broken:   "not an envelope",
+	}
+	assert.NotNil(DecryptFields(router, &document))
+	assert.Equal(valid.Street, document.Email)
+	assert.Equal(valid.Street, document.Home.Street)
+	assert.Equal(valid.Street, document.Labelled["work"].Street)
+	assert.Equal("not an envelope", document.Broken)
+
+	document.Broken = ""
+	require.Nil(DecryptFields(router, &document))
+	assert.Equal("1 Main St", document.Email)
+	assert.Equal("1 Main St", document.Home.Street)
+	assert.Equal("1 Main St", document.Labelled["work"].Street)
+}
+
+func TestFieldsInInterfaces(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	key := make([]byte, 32)
+	encrypter, err := NewAESGCMEncrypt(key, WithKID("k1"))
+	require.Nil(err)
+	decrypter, err := NewAESGCMDecrypt(key, WithKID("k1"))
+	require.Nil(err)
+	router := NewRouter(nil)
+	require.Nil(router.Register(decrypter))
+
+	document := struct {
+		Any    interface{}
+		Values map[string]interface{}
+	}{
+		Any:    testAddress{Street: "1 Main St"},
+		Values: map[string]interface{}{"home": testAddress{Street: "2 Elm St"}},
+	}
+
+	require.Nil(EncryptFields(encrypter, &document))
+	assert.NotEqual("1 Main St", document.Any.(testAddress).Street)
+	assert.NotEqual("2 Elm St", document.Values["home"].(testAddress).Street)
+
+	require.Nil(DecryptFields(router, &document))
+	assert.Equal("1 Main St", document.Any.(testAddress).Street)
+	assert.Equal("2 Elm St", document.Values["home"].(testAddress).Street)
+}
@@ -0,0 +1,167 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// fileOptions are the settings FileOptions change.
+type fileOptions struct {
+	progress func(done, total int64)
+	mode     os.FileMode
+}
+
+// FileOption configures EncryptFile and DecryptFile.
+type FileOption func(*fileOptions) error
+
+// WithProgress calls progress after each block of the source is read, with
+// the bytes read so far and the size of the source.
+func WithProgress(progress func(done, total int64)) FileOption {
+	return func(o *fileOptions) error {
+		if progress == nil {
+			return errors.New("no progress function")
+		}
+		o.progress = progress
+		return nil
+	}
+}
+
+// WithFileMode sets the permissions of the destination instead of copying
+// them from the source.
+func WithFileMode(mode os.FileMode) FileOption {
+	return func(o *fileOptions) error {
+		o.mode = mode.Perm()
+		return nil
+	}
+}
+
+// EncryptFile encrypts the file at src into dst with EncryptStream.  The
+// destination is written to a temporary file in the same directory and
+// renamed into place once it is complete, so readers never see a partial
+// file and an existing dst is only replaced on success.  dst gets the
+// permissions of src unless WithFileMode is given.
+func EncryptFile(encrypter Encrypt, src, dst string, options ...FileOption) error {
+	return copyFile(src, dst, options, func(w io.Writer, r io.Reader) error {
+		stream, err := EncryptStream(encrypter, w)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(stream, r); err != nil {
+			return err
+		}
+		return stream.Close()
+	})
+}
+
+// DecryptFile decrypts the file at src, written by EncryptFile or
+// EncryptStream, into dst in the same way.  A source that was tampered with
+// or cut short leaves dst untouched.
+func DecryptFile(decrypter Decrypt, src, dst string, options ...FileOption) error {
+	return copyFile(src, dst, options, func(w io.Writer, r io.Reader) error {
+		plain, err := DecryptStream(decrypter, r)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, plain)
+		return err
+	})
+}
+
+// copyFile runs transform from src to dst with writeFileAtomic.
+func copyFile(src, dst string, options []FileOption, transform func(io.Writer, io.Reader) error) error {
+	var o fileOptions
+	for _, option := range options {
+		if option == nil {
+			continue
+		}
+		if err := option(&o); err != nil {
+			return err
+		}
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	if o.mode == 0 {
+		o.mode = info.Mode().Perm()
+	}
+
+	var r io.Reader = in
+	if o.progress != nil {
+		r = &progressReader{r: in, total: info.Size(), progress: o.progress}
+	}
+	return writeFileAtomic(dst, o.mode, func(w io.Writer) error {
+		return transform(w, r)
+	})
+}
+
+// writeFileAtomic calls write with a temporary file in the directory of dst,
+// and renames it to dst if write succeeds.  The temporary file is removed if
+// anything fails.
+func writeFileAtomic(dst string, mode os.FileMode, write func(io.Writer) error) (err error) {
+	out, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(out.Name())
+		}
+	}()
+
+	if err = write(out); err != nil {
+		return err
+	}
+	if err = out.Chmod(mode); err != nil {
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), dst)
+}
+
+type progressReader struct {
+	r        io.Reader
+	done     int64
+	total    int64
+	progress func(done, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.done += int64(n)
+		p.progress(p.done, p.total)
+	}
+	return n, err
+}
@@ -0,0 +1,81 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := loadBoxPair(t)
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "backup.tar")
+	sealed := filepath.Join(dir, "backup.tar.enc")
+	opened := filepath.Join(dir, "restored.tar")
+
+	data := make([]byte, 3*StreamSegmentSize+17)
+	_, err := rand.Read(data)
+	require.Nil(err)
+	require.Nil(ioutil.WriteFile(plain, data, 0640))
+
+	var done, total int64
+	require.Nil(EncryptFile(encrypter, plain, sealed, WithProgress(func(d, t int64) {
+		done, total = d, t
+	})))
+	assert.Equal(int64(len(data)), done)
+	assert.Equal(int64(len(data)), total)
+	info, err := os.Stat(sealed)
+	require.Nil(err)
+	assert.Equal(os.FileMode(0640), info.Mode().Perm())
+
+	require.Nil(DecryptFile(decrypter, sealed, opened, WithFileMode(0600)))
+	restored, err := ioutil.ReadFile(opened)
+	require.Nil(err)
+	assert.True(bytes.Equal(data, restored))
+	info, err = os.Stat(opened)
+	require.Nil(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+
+	// a truncated source leaves the destination as it was
+	encrypted, err := ioutil.ReadFile(sealed)
+	require.Nil(err)
+	require.Nil(ioutil.WriteFile(sealed, encrypted[:len(encrypted)-10], 0640))
+	assert.NotNil(DecryptFile(decrypter, sealed, opened))
+	restored, err = ioutil.ReadFile(opened)
+	require.Nil(err)
+	assert.True(bytes.Equal(data, restored))
+
+	entries, err := ioutil.ReadDir(dir)
+	require.Nil(err)
+	assert.Len(entries, 3, "temporary files are removed")
+
+	assert.NotNil(EncryptFile(encrypter, filepath.Join(dir, "missing"), sealed))
+	assert.NotNil(EncryptFile(encrypter, plain, filepath.Join(dir, "missing", "out")))
+	assert.NotNil(EncryptFile(encrypter, plain, sealed, WithProgress(nil)))
+}
@@ -0,0 +1,146 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto"
+	"crypto/fips140"
+	"crypto/rsa"
+	"errors"
+	"sort"
+	"sync"
+)
+
+var (
+	fipsLock sync.RWMutex
+	fipsMode = fipsBuild || fips140.Enabled()
+
+	// fipsAlgorithms are the algorithms allowed in FIPS mode: AES-GCM,
+	// RSA-OAEP and RSA-PSS, and ECDSA.  Ed25519 and the X25519 based
+	// algorithms are left out.
+	fipsAlgorithms = map[AlgorithmType]bool{
+		RSASymmetric:  true,
+		RSAAsymmetric: true,
+		RSAPSS:        true,
+		ECDSA:         true,
+		AESGCM:        true,
+	}
+
+	// fipsHashes are the FIPS 180 SHA-2 hashes.
+	fipsHashes = map[crypto.Hash]bool{
+		crypto.SHA224:     true,
+		crypto.SHA256:     true,
+		crypto.SHA384:     true,
+		crypto.SHA512:     true,
+		crypto.SHA512_224: true,
+		crypto.SHA512_256: true,
+	}
+)
+
+// FIPSStatus describes whether FIPS mode is on and why.
+type FIPSStatus struct {
+	// Enabled is set when FIPS mode is on.
+	Enabled bool
+
+	// BuildTag is set when the binary was built with the fips build tag, in
+	// which case FIPS mode can't be turned off.
+	BuildTag bool
+
+	// GoFIPS140 is set when the Go FIPS 140 module is on, which turns FIPS
+	// mode on at startup.
+	GoFIPS140 bool
+
+	// Algorithms are the algorithms that can be loaded in FIPS mode.
+	Algorithms []AlgorithmType
+}
+
+// GetFIPSStatus reports whether FIPS mode is on.
+func GetFIPSStatus() FIPSStatus {
+	fipsLock.RLock()
+	defer fipsLock.RUnlock()
+
+	status := FIPSStatus{
+		Enabled:   fipsMode,
+		BuildTag:  fipsBuild,
+		GoFIPS140: fips140.Enabled(),
+	}
+	for alg := range fipsAlgorithms {
+		status.Algorithms = append(status.Algorithms, alg)
+	}
+	sort.Slice(status.Algorithms, func(i, j int) bool {
+		return status.Algorithms[i] < status.Algorithms[j]
+	})
+	return status
+}
+
+// FIPSMode reports whether FIPS mode is on.  In FIPS mode only the
+// algorithms built from FIPS 140 approved primitives can be loaded, RSA
+// must use a SHA-2 hash and keys of at least MinStrictRSABits, and
+// everything else fails to load.
+func FIPSMode() bool {
+	fipsLock.RLock()
+	defer fipsLock.RUnlock()
+	return fipsMode
+}
+
+// SetFIPSMode turns FIPS mode on or off.  It can't be turned off in a binary
+// built with the fips build tag.
+func SetFIPSMode(enabled bool) error {
+	if !enabled && fipsBuild {
+		return errors.New("fips mode can't be turned off in a fips build")
+	}
+	fipsLock.Lock()
+	defer fipsLock.Unlock()
+	fipsMode = enabled
+	return nil
+}
+
+// RegisterFIPSAlgorithm marks a registered algorithm as built only from FIPS
+// 140 approved primitives, like AES-GCM or ECDSA, so it can be loaded in
+// FIPS mode.
+func RegisterFIPSAlgorithm(alg AlgorithmType) error {
+	if alg == "" {
+		return errors.New("no algorithm type specified")
+	}
+	fipsLock.Lock()
+	defer fipsLock.Unlock()
+	fipsAlgorithms[alg] = true
+	return nil
+}
+
+// checkFIPSAlgorithm fails if FIPS mode is on and the algorithm isn't approved.
+func checkFIPSAlgorithm(alg AlgorithmType) error {
+	fipsLock.RLock()
+	defer fipsLock.RUnlock()
+	if fipsMode && !fipsAlgorithms[alg] {
+		return errors.New("algorithm " + string(alg) + " is not allowed in fips mode")
+	}
+	return nil
+}
+
+// checkFIPSRSA fails if FIPS mode is on and the hash or keys of an RSA cipher
+// aren't approved.  Nil keys are ignored.
+func checkFIPSRSA(hash crypto.Hash, privateKey *rsa.PrivateKey, publicKey *rsa.PublicKey) error {
+	if !FIPSMode() {
+		return nil
+	}
+	if !fipsHashes[hash] {
+		return errors.New("hash " + hash.String() + " is not allowed in fips mode")
+	}
+	return checkRSAKeySizes("fips", privateKey, publicKey)
+}
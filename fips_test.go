@@ -0,0 +1,99 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFIPSMode(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	if fipsBuild || GetFIPSStatus().GoFIPS140 {
+		t.Skip("fips mode is always on")
+	}
+
+	dir, err := os.Getwd()
+	require.Nil(err)
+
+	require.Nil(SetFIPSMode(true))
+	defer SetFIPSMode(false)
+
+	status := GetFIPSStatus()
+	assert.True(status.Enabled)
+	assert.False(status.BuildTag)
+	assert.Equal([]AlgorithmType{AESGCM, ECDSA, RSAAsymmetric, RSAPSS, RSASymmetric}, status.Algorithms)
+
+	// approved
+	testOptions(t, Config{
+		Type:   RSASymmetric,
+		Params: map[string]string{"hash": "SHA512"},
+		Keys: map[KeyType]string{
+			PublicKey:  dir + string(os.PathSeparator) + "public.pem",
+			PrivateKey: dir + string(os.PathSeparator) + "private.pem",
+		},
+	}, true)
+
+	// not approved
+	testData := []Config{
+		{Type: None},
+		{Type: Box, Keys: map[KeyType]string{
+			SenderPrivateKey:   dir + string(os.PathSeparator) + "sendBoxPrivate.pem",
+			RecipientPublicKey: dir + string(os.PathSeparator) + "boxPublic.pem",
+		}},
+		{Type: RSASymmetric, Params: map[string]string{"hash": "BLAKE2B512"}, Keys: map[KeyType]string{
+			PublicKey: dir + string(os.PathSeparator) + "public.pem",
+		}},
+	}
+	for _, config := range testData {
+		_, err := config.LoadEncrypt()
+		assert.NotNil(err, string(config.Type))
+		assert.NotNil(config.Validate(), string(config.Type))
+	}
+
+	_, err = NewBoxEncrypt([32]byte{}, [32]byte{})
+	assert.NotNil(err)
+	_, err = NewBoxEphemeralEncrypt([32]byte{})
+	assert.NotNil(err)
+	_, err = NewRatchetSession(make([]byte, RatchetKeySize))
+	assert.NotNil(err)
+	_, err = (&Config{Type: Ed25519Sign}).LoadSign()
+	assert.NotNil(err)
+	assert.NotNil((&Config{Type: Ed25519Sign}).Validate())
+	_, err = NewRSADecrypt(GeneratePrivateKey(1024), WithHash(crypto.SHA256))
+	assert.NotNil(err)
+	_, err = NewRSADecrypt(GeneratePrivateKey(2048), WithHash(crypto.SHA256))
+	assert.Nil(err)
+	assert.NotNil(checkFIPSRSA(crypto.SHA3_256, nil, nil), "sha-3")
+
+	// plugins can opt in
+	require.Nil(RegisterFIPSAlgorithm("test-fips"))
+	assert.Contains(GetFIPSStatus().Algorithms, AlgorithmType("test-fips"))
+	assert.NotNil(RegisterFIPSAlgorithm(""))
+
+	require.Nil(SetFIPSMode(false))
+	assert.False(FIPSMode())
+	_, err = (&Config{Type: None}).LoadEncrypt()
+	assert.Nil(err)
+}
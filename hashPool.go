@@ -0,0 +1,77 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto"
+	"hash"
+	"sync"
+)
+
+// hashPoolSize covers every crypto.Hash the standard library defines.
+const hashPoolSize = 32
+
+var (
+	// hashPools keeps the hashers of each crypto.Hash for reuse, so the RSA
+	// and signing paths don't allocate a hasher for every message.
+	hashPools [hashPoolSize]sync.Pool
+
+	// digestPool keeps buffers for message digests, which are never longer
+	// than 64 bytes.
+	digestPool = sync.Pool{
+		New: func() interface{} {
+			buffer := make([]byte, 0, 64)
+			return &buffer
+		},
+	}
+)
+
+// getHash returns a reset hasher of the hash.  Give it back with putHash
+// once nothing refers to it.
+func getHash(h crypto.Hash) hash.Hash {
+	if h < hashPoolSize {
+		if hasher, ok := hashPools[h].Get().(hash.Hash); ok {
+			hasher.Reset()
+			return hasher
+		}
+	}
+	return h.New()
+}
+
+// putHash makes the hasher available to getHash.
+func putHash(h crypto.Hash, hasher hash.Hash) {
+	if h < hashPoolSize {
+		hashPools[h].Put(hasher)
+	}
+}
+
+// hashMessage returns the digest of the message in a pooled buffer.  Give it
+// back with putDigest once nothing refers to it.
+func hashMessage(h crypto.Hash, message []byte) *[]byte {
+	hasher := getHash(h)
+	hasher.Write(message)
+	digest := digestPool.Get().(*[]byte)
+	*digest = hasher.Sum((*digest)[:0])
+	putHash(h, hasher)
+	return digest
+}
+
+// putDigest makes the digest buffer available to hashMessage.
+func putDigest(digest *[]byte) {
+	digestPool.Put(digest)
+}
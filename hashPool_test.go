@@ -0,0 +1,68 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/sha512"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashMessage(t *testing.T) {
+	assert := assert.New(t)
+
+	sum256 := sha256.Sum256([]byte("hello"))
+	sum512 := sha512.Sum512([]byte("hello"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				digest := hashMessage(crypto.SHA256, []byte("hello"))
+				assert.Equal(sum256[:], *digest)
+				putDigest(digest)
+
+				digest = hashMessage(crypto.SHA512, []byte("hello"))
+				assert.Equal(sum512[:], *digest)
+				putDigest(digest)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestGetHash(t *testing.T) {
+	assert := assert.New(t)
+
+	// a hasher given back dirty is reset before it's used again
+	hasher := getHash(crypto.SHA256)
+	hasher.Write([]byte("left over"))
+	putHash(crypto.SHA256, hasher)
+
+	hasher = getHash(crypto.SHA256)
+	hasher.Write([]byte("hello"))
+	sum := sha256.Sum256([]byte("hello"))
+	assert.Equal(sum[:], hasher.Sum(nil))
+	putHash(crypto.SHA256, hasher)
+}
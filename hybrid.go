@@ -0,0 +1,118 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// rsaHybridMode follows the wrapped key of a hybrid RSA message.  A message
+// encrypted with OAEP alone is exactly the size of the key, so anything
+// longer is a hybrid message.
+const rsaHybridMode = 1
+
+const (
+	rsaHybridKeySize   = 32
+	rsaHybridNonceSize = 12
+)
+
+// WithHybrid lets an RSA encrypter encrypt messages too long for OAEP.  Such
+// messages are encrypted with AES-256-GCM under a new data key, and the data
+// key is encrypted with OAEP.  Shorter messages are encrypted as before.
+// Every RSA decrypter can decrypt both.
+func WithHybrid() CipherOption {
+	return func(o *cipherOptions) error {
+		o.hybrid = true
+		return nil
+	}
+}
+
+// maxOAEPSize is the longest message OAEP can encrypt with the key.
+func (c *rsaEncrypterDecrypter) maxOAEPSize() int {
+	return c.recipientPublicKey.Size() - 2*c.hasher.Size() - 2
+}
+
+// sealHybrid encrypts the message under a new data key, and returns the
+// data key encrypted with OAEP, the mode, the nonce and the sealed message.
+// The label is bound to both.
+func (c *rsaEncrypterDecrypter) sealHybrid(message []byte, label []byte) ([]byte, error) {
+	random := randomOrDefault(c.random)
+	key := make([]byte, rsaHybridKeySize+rsaHybridNonceSize)
+	defer wipe(key)
+	if _, err := io.ReadFull(random, key); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	key, nonce := key[:rsaHybridKeySize], key[rsaHybridKeySize:]
+
+	hasher := getHash(c.hasher)
+	wrapped, err := rsa.EncryptOAEP(hasher, random, c.recipientPublicKey, key, label)
+	putHash(c.hasher, hasher)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(wrapped)+1+len(nonce)+len(message)+aead.Overhead())
+	out = append(append(append(out, wrapped...), rsaHybridMode), nonce...)
+	return aead.Seal(out, nonce, message, label), nil
+}
+
+// openHybrid decrypts a message made by sealHybrid.
+func (c *rsaEncrypterDecrypter) openHybrid(cipher []byte, label []byte) ([]byte, error) {
+	size := c.recipientPrivateKey.Size()
+	if len(cipher) < size+1+rsaHybridNonceSize || cipher[size] != rsaHybridMode {
+		return nil, fmt.Errorf("%w: unknown rsa message mode", ErrDecryptFailed)
+	}
+	hasher := getHash(c.hasher)
+	key, err := rsa.DecryptOAEP(hasher, randomOrDefault(c.random), c.recipientPrivateKey, cipher[:size], label)
+	putHash(c.hasher, hasher)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptFailed, err)
+	}
+	defer wipe(key)
+	if len(key) != rsaHybridKeySize {
+		return nil, fmt.Errorf("%w: invalid data key", ErrDecryptFailed)
+	}
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := cipher[size+1 : size+1+rsaHybridNonceSize]
+	message, err := aead.Open(nil, nonce, cipher[size+1+rsaHybridNonceSize:], label)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptFailed, err)
+	}
+	return message, nil
+}
+
+// hybridParam returns the "hybrid" param of an RSA config.
+func (config *Config) hybridParam() (bool, error) {
+	if config.Params["hybrid"] == "" {
+		return false, nil
+	}
+	hybrid, err := strconv.ParseBool(config.Params["hybrid"])
+	if err != nil {
+		return false, fmt.Errorf("invalid hybrid param: %w", err)
+	}
+	return hybrid, nil
+}
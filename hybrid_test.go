@@ -0,0 +1,125 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRSAHybrid(t *testing.T) {
+	recipientPrivateKey := GeneratePrivateKey(2048)
+	senderPrivateKey := GeneratePrivateKey(2048)
+	encrypter, err := NewRSAEncrypt(&recipientPrivateKey.PublicKey, WithHybrid(), WithSigningKey(senderPrivateKey))
+	require.Nil(t, err)
+	decrypter, err := NewRSADecrypt(recipientPrivateKey, WithVerifyKey(&senderPrivateKey.PublicKey))
+	require.Nil(t, err)
+	plain, err := NewRSAEncrypt(&recipientPrivateKey.PublicKey)
+	require.Nil(t, err)
+	m, _ := GetMetadata(encrypter)
+
+	testData := []struct {
+		description string
+		size        int
+		hybrid      bool
+	}{
+		{"empty", 0, false},
+		{"largest for oaep", 126, false},
+		{"one byte too long", 127, true},
+		{"large", 100 * 1024, true},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			message := bytes.Repeat([]byte{'x'}, tc.size)
+			crypt, nonce, err := encrypter.EncryptMessage(message)
+			require.Nil(err)
+			assert.Equal(tc.hybrid, len(crypt) > recipientPrivateKey.Size())
+			assert.True(len(crypt) <= m.CiphertextSize(tc.size))
+
+			decrypted, err := decrypter.DecryptMessage(crypt, nonce)
+			require.Nil(err)
+			assert.Equal(message, decrypted)
+
+			_, _, err = plain.EncryptMessage(message)
+			assert.Equal(tc.hybrid, err != nil, "only hybrid encrypters take long messages")
+
+			if tc.hybrid {
+				crypt[len(crypt)-1] ^= 0xff
+				_, err = decrypter.DecryptMessage(crypt, nonce)
+				assert.True(errors.Is(err, ErrDecryptFailed))
+				crypt[len(crypt)-1] ^= 0xff
+
+				crypt[recipientPrivateKey.Size()] = 2
+				_, err = decrypter.DecryptMessage(crypt, nonce)
+				assert.True(errors.Is(err, ErrDecryptFailed), "unknown mode")
+			}
+		})
+	}
+
+	// associated data is bound to the data key and the message
+	message := bytes.Repeat([]byte{'x'}, 1024)
+	crypt, nonce, err := EncryptMessageWithAD(encrypter, message, []byte("device"))
+	require.Nil(t, err)
+	decrypted, err := DecryptMessageWithAD(decrypter, crypt, nonce, []byte("device"))
+	require.Nil(t, err)
+	assert.Equal(t, message, decrypted)
+	_, err = DecryptMessageWithAD(decrypter, crypt, nonce, []byte("other"))
+	assert.NotNil(t, err)
+}
+
+func TestRSAHybridConfig(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	privateKey := GeneratePrivateKey(2048)
+	config := Config{
+		Type:   RSASymmetric,
+		Params: map[string]string{"hash": "SHA512", "hybrid": "true"},
+		Loaders: map[KeyType]KeyLoader{
+			PrivateKey: &BytesLoader{Data: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})},
+			PublicKey:  &BytesLoader{Data: pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&privateKey.PublicKey)})},
+		},
+	}
+	require.Nil(config.Validate())
+	encrypter, err := config.LoadEncrypt()
+	require.Nil(err)
+	decrypter, err := config.LoadDecrypt()
+	require.Nil(err)
+
+	message := bytes.Repeat([]byte{'x'}, 4096)
+	crypt, nonce, err := encrypter.EncryptMessage(message)
+	require.Nil(err)
+	decrypted, err := decrypter.DecryptMessage(crypt, nonce)
+	require.Nil(err)
+	assert.Equal(message, decrypted)
+
+	config.Params["hybrid"] = "maybe"
+	assert.NotNil(config.Validate())
+	_, err = config.LoadEncrypt()
+	assert.NotNil(err)
+}
@@ -0,0 +1,149 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"sync"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// InPlaceDecrypt is a Decrypt that can decrypt a message into the buffer
+// holding its ciphertext, so a memory constrained receiver needs one buffer
+// per message instead of two.  The AEAD ciphers, box, box-ephemeral and
+// aes-gcm, implement it.  nacl can't open a box over itself, so box and
+// box-ephemeral open into a pooled scratch buffer that is wiped once the
+// message is copied back, which costs no allocation once the pool is warm.
+type InPlaceDecrypt interface {
+	Decrypt
+
+	// DecryptMessageInPlace decrypts cipher over itself and returns the
+	// message, which is a prefix of cipher.  The rest of cipher, and all of
+	// it if decryption fails, may be overwritten.
+	DecryptMessageInPlace(cipher []byte, nonce []byte) (message []byte, err error)
+}
+
+// DecryptMessageInPlace decrypts the message into the buffer of cipher when
+// the decrypter is an InPlaceDecrypt, and into a new buffer otherwise.
+// Either way cipher must not be used afterwards, and the message must only be
+// used as long as cipher's buffer may be.
+func DecryptMessageInPlace(decrypter Decrypt, cipher []byte, nonce []byte) ([]byte, error) {
+	if d, ok := decrypter.(InPlaceDecrypt); ok {
+		return d.DecryptMessageInPlace(cipher, nonce)
+	}
+	return decrypter.DecryptMessage(cipher, nonce)
+}
+
+// DecryptMessageInPlace returns the cipher, which is the message.
+func (*NOOP) DecryptMessageInPlace(cipher []byte, nonce []byte) ([]byte, error) {
+	return cipher, nil
+}
+
+// DecryptMessageInPlace opens the box into the cipher.
+func (deBox *decryptBox) DecryptMessageInPlace(cipher []byte, nonce []byte) ([]byte, error) {
+	deBox.lock.RLock()
+	defer deBox.lock.RUnlock()
+	if deBox.sharedDecryptKey == nil {
+		return nil, errCipherClosed
+	}
+	var decryptNonce [24]byte
+	if err := checkNonceSize(nonce, len(decryptNonce)); err != nil {
+		return nil, err
+	}
+	copy(decryptNonce[:], nonce)
+	if len(cipher) < box.Overhead {
+		return nil, ErrDecryptFailed
+	}
+
+	scratch := getScratch(len(cipher))
+	defer putScratch(scratch)
+	decrypted, ok := box.OpenAfterPrecomputation((*scratch)[:0], cipher, &decryptNonce, deBox.sharedDecryptKey)
+	if !ok {
+		return nil, ErrDecryptFailed
+	}
+	return cipher[:copy(cipher, decrypted)], nil
+}
+
+// DecryptMessageInPlace opens the box following the sender's public key
+// into the cipher.
+func (d *decryptEphemeralBox) DecryptMessageInPlace(cipher []byte, nonce []byte) ([]byte, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	if d.closed {
+		return nil, errCipherClosed
+	}
+	var decryptNonce [24]byte
+	if err := checkNonceSize(nonce, len(decryptNonce)); err != nil {
+		return nil, err
+	}
+	copy(decryptNonce[:], nonce)
+	if len(cipher) < BoxKeySize+box.Overhead {
+		return nil, ErrDecryptFailed
+	}
+
+	var senderPublicKey [32]byte
+	copy(senderPublicKey[:], cipher)
+	scratch := getScratch(len(cipher))
+	defer putScratch(scratch)
+	decrypted, ok := box.Open((*scratch)[:0], cipher[BoxKeySize:], &decryptNonce, &senderPublicKey, &d.recipientPrivateKey)
+	if !ok {
+		return nil, ErrDecryptFailed
+	}
+	return cipher[:copy(cipher, decrypted)], nil
+}
+
+// DecryptMessageInPlace opens the message over the cipher.
+func (c *aesGCMCipher) DecryptMessageInPlace(cipher []byte, nonce []byte) ([]byte, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.aead == nil {
+		return nil, errCipherClosed
+	}
+	if err := checkNonceSize(nonce, aesGCMNonceSize); err != nil {
+		return nil, err
+	}
+	message, err := c.aead.Open(cipher[:0], nonce, cipher, nil)
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+	return message, nil
+}
+
+// scratchPool keeps the buffers boxes are opened into by
+// DecryptMessageInPlace.
+var scratchPool = sync.Pool{
+	New: func() interface{} {
+		return new([]byte)
+	},
+}
+
+// getScratch returns a buffer with room for size bytes.
+func getScratch(size int) *[]byte {
+	scratch := scratchPool.Get().(*[]byte)
+	if cap(*scratch) < size {
+		*scratch = make([]byte, size)
+	}
+	return scratch
+}
+
+// putScratch wipes the buffer, which held a message, and returns it to the
+// pool.
+func putScratch(scratch *[]byte) {
+	wipe((*scratch)[:cap(*scratch)])
+	scratchPool.Put(scratch)
+}
@@ -0,0 +1,146 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecryptMessageInPlace(t *testing.T) {
+	boxEncrypter, boxDecrypter := loadBoxPair(t)
+	aesEncrypter, aesDecrypter := aesGCMPair(t)
+	publicKey, privateKey, err := GenerateBoxKeyPair()
+	require.Nil(t, err)
+	ephemeralEncrypter, err := NewBoxEphemeralEncrypt(*publicKey)
+	require.Nil(t, err)
+	ephemeralDecrypter, err := NewBoxEphemeralDecrypt(*privateKey)
+	require.Nil(t, err)
+	rsaEncrypter, rsaDecrypter := rsaPair(t)
+
+	testData := []struct {
+		description string
+		encrypter   Encrypt
+		decrypter   Decrypt
+		inPlace     bool
+	}{
+		{"none", DefaultCipherEncrypter(), DefaultCipherDecrypter(), true},
+		{"box", boxEncrypter, boxDecrypter, true},
+		{"box-ephemeral", ephemeralEncrypter, ephemeralDecrypter, true},
+		{"aes-gcm", aesEncrypter, aesDecrypter, true},
+		{"rsa falls back", rsaEncrypter, rsaDecrypter, false},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			message := bytes.Repeat([]byte("message"), 5)
+			crypt, nonce, err := tc.encrypter.EncryptMessage(message)
+			require.Nil(err)
+
+			result, err := DecryptMessageInPlace(tc.decrypter, crypt, nonce)
+			require.Nil(err)
+			assert.Equal(message, result)
+			assert.Equal(tc.inPlace, &result[0] == &crypt[0], "the message is a prefix of the cipher")
+		})
+	}
+}
+
+func TestDecryptMessageInPlaceErrors(t *testing.T) {
+	boxEncrypter, boxDecrypter := loadBoxPair(t)
+	aesEncrypter, aesDecrypter := aesGCMPair(t)
+	publicKey, privateKey, err := GenerateBoxKeyPair()
+	require.Nil(t, err)
+	ephemeralEncrypter, err := NewBoxEphemeralEncrypt(*publicKey)
+	require.Nil(t, err)
+	ephemeralDecrypter, err := NewBoxEphemeralDecrypt(*privateKey)
+	require.Nil(t, err)
+
+	testData := []struct {
+		description string
+		encrypter   Encrypt
+		decrypter   Decrypt
+	}{
+		{"box", boxEncrypter, boxDecrypter},
+		{"box-ephemeral", ephemeralEncrypter, ephemeralDecrypter},
+		{"aes-gcm", aesEncrypter, aesDecrypter},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			crypt, nonce, err := tc.encrypter.EncryptMessage([]byte("message"))
+			require.Nil(err)
+
+			tampered := append([]byte{}, crypt...)
+			tampered[len(tampered)-1] ^= 1
+			_, err = DecryptMessageInPlace(tc.decrypter, tampered, nonce)
+			assert.Equal(ErrDecryptFailed, err)
+
+			_, err = DecryptMessageInPlace(tc.decrypter, crypt[:4], nonce)
+			assert.Equal(ErrDecryptFailed, err)
+
+			_, err = DecryptMessageInPlace(tc.decrypter, crypt, nonce[:4])
+			assert.NotNil(err)
+
+			require.Nil(CloseCipher(tc.decrypter))
+			_, err = DecryptMessageInPlace(tc.decrypter, crypt, nonce)
+			assert.Equal(errCipherClosed, err)
+		})
+	}
+}
+
+func TestDecryptMessageInPlaceAllocations(t *testing.T) {
+	boxEncrypter, boxDecrypter := loadBoxPair(t)
+	aesEncrypter, aesDecrypter := aesGCMPair(t)
+
+	testData := []struct {
+		description string
+		encrypter   Encrypt
+		decrypter   Decrypt
+	}{
+		{"box", boxEncrypter, boxDecrypter},
+		{"aes-gcm", aesEncrypter, aesDecrypter},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			message := bytes.Repeat([]byte("m"), 512)
+			crypt, nonce, err := tc.encrypter.EncryptMessage(message)
+			require.Nil(err)
+			buffer := make([]byte, len(crypt))
+
+			allocs := testing.AllocsPerRun(100, func() {
+				copy(buffer, crypt)
+				_, err := DecryptMessageInPlace(tc.decrypter, buffer, nonce)
+				require.Nil(err)
+			})
+			assert.Equal(float64(0), allocs)
+		})
+	}
+}
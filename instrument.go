@@ -0,0 +1,234 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+)
+
+// The error classes of failed operations, used as the reason label of
+// CipherMetrics.Failures.
+const (
+	// ReasonDecryptFailed is used when a message fails authentication.
+	ReasonDecryptFailed = "decrypt_failed"
+
+	// ReasonSignatureInvalid is used when a signature doesn't verify.
+	ReasonSignatureInvalid = "signature_invalid"
+
+	// ReasonWrongKeyType is used when the cipher has the wrong kind of key.
+	ReasonWrongKeyType = "wrong_key_type"
+
+	// ReasonKeyNotFound is used when no key was found for the KID.
+	ReasonKeyNotFound = "key_not_found"
+
+	// ReasonClosed is used when the cipher was closed.
+	ReasonClosed = "closed"
+
+	// ReasonLimited is used when a limited cipher rejected the operation.
+	ReasonLimited = "limited"
+
+	// ReasonOther is used for every other error.
+	ReasonOther = "other"
+)
+
+// CipherMetrics are the go-kit metrics InstrumentedEncrypt and
+// InstrumentedDecrypt record, labeled by operation, algorithm and kid.  To
+// expose them to Prometheus, create them with go-kit's metrics/prometheus
+// package, for example:
+//
+//	Operations: kitprometheus.NewCounterFrom(prometheus.CounterOpts{
+//		Name: "voynicrypto_operations_total",
+//	}, []string{voynicrypto.OperationLabel, voynicrypto.AlgorithmLabel, voynicrypto.KIDLabel}),
+//
+// Any of them may be nil.
+type CipherMetrics struct {
+	// Operations counts encryptions and decryptions.
+	Operations metrics.Counter
+
+	// Failures counts failed operations, labeled with a reason as well.
+	Failures metrics.Counter
+
+	// PayloadSize observes the size in bytes of each message encrypted and
+	// each cipher decrypted.
+	PayloadSize metrics.Histogram
+
+	// Duration observes how many seconds each operation took.
+	Duration metrics.Histogram
+}
+
+// errorReason classifies an error for the reason label.
+func errorReason(err error) string {
+	switch {
+	case errors.Is(err, ErrDecryptFailed):
+		return ReasonDecryptFailed
+	case errors.Is(err, ErrSignatureInvalid):
+		return ReasonSignatureInvalid
+	case errors.Is(err, ErrWrongKeyType):
+		return ReasonWrongKeyType
+	case errors.Is(err, ErrKeyNotFound):
+		return ReasonKeyNotFound
+	case errors.Is(err, errCipherClosed):
+		return ReasonClosed
+	case errors.Is(err, ErrLimitExceeded):
+		return ReasonLimited
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ReasonCanceled
+	}
+	return ReasonOther
+}
+
+// observe records an operation that started at start.
+func (m *CipherMetrics) observe(operation string, cipher Identification, size int, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	labels := []string{OperationLabel, operation, AlgorithmLabel, string(cipher.GetAlgorithm()), KIDLabel, cipher.GetKID()}
+
+	if m.Operations != nil {
+		m.Operations.With(labels...).Add(1)
+	}
+	if err != nil && m.Failures != nil {
+		m.Failures.With(append(labels, ReasonLabel, errorReason(err))...).Add(1)
+	}
+	if m.PayloadSize != nil {
+		m.PayloadSize.With(labels...).Observe(float64(size))
+	}
+	if m.Duration != nil {
+		m.Duration.With(labels...).Observe(time.Since(start).Seconds())
+	}
+}
+
+// InstrumentedEncrypt returns an Encrypt that records the metrics of every
+// message the encrypter encrypts.  Associated data, contexts, metadata and
+// CloseCipher are passed through.
+func InstrumentedEncrypt(encrypter Encrypt, m *CipherMetrics) Encrypt {
+	return &instrumentedEncrypter{encrypter: encrypter, metrics: m}
+}
+
+// InstrumentedDecrypt returns a Decrypt that records the metrics of every
+// message the decrypter decrypts.  Associated data, contexts, metadata and
+// CloseCipher are passed through.
+func InstrumentedDecrypt(decrypter Decrypt, m *CipherMetrics) Decrypt {
+	return &instrumentedDecrypter{decrypter: decrypter, metrics: m}
+}
+
+type instrumentedEncrypter struct {
+	encrypter Encrypt
+	metrics   *CipherMetrics
+}
+
+// GetAlgorithm returns the algorithm of the encrypter.
+func (e *instrumentedEncrypter) GetAlgorithm() AlgorithmType {
+	return e.encrypter.GetAlgorithm()
+}
+
+// GetKID returns the KID of the encrypter.
+func (e *instrumentedEncrypter) GetKID() string {
+	return e.encrypter.GetKID()
+}
+
+// EncryptMessage encrypts the message and records it.
+func (e *instrumentedEncrypter) EncryptMessage(message []byte) ([]byte, []byte, error) {
+	start := time.Now()
+	cipher, nonce, err := e.encrypter.EncryptMessage(message)
+	e.metrics.observe(encryptOperation, e.encrypter, len(message), start, err)
+	return cipher, nonce, err
+}
+
+// EncryptMessageContext encrypts the message with the context and records it.
+func (e *instrumentedEncrypter) EncryptMessageContext(ctx context.Context, message []byte) ([]byte, []byte, error) {
+	start := time.Now()
+	cipher, nonce, err := EncryptMessageContext(ctx, e.encrypter, message)
+	e.metrics.observe(encryptOperation, e.encrypter, len(message), start, err)
+	return cipher, nonce, err
+}
+
+// EncryptMessageWithAD encrypts the message with associated data and records
+// it.
+func (e *instrumentedEncrypter) EncryptMessageWithAD(message []byte, ad []byte) ([]byte, []byte, error) {
+	start := time.Now()
+	cipher, nonce, err := EncryptMessageWithAD(e.encrypter, message, ad)
+	e.metrics.observe(encryptOperation, e.encrypter, len(message), start, err)
+	return cipher, nonce, err
+}
+
+// Metadata returns the metadata of the encrypter, if it has any.
+func (e *instrumentedEncrypter) Metadata() Metadata {
+	m, _ := GetMetadata(e.encrypter)
+	return m
+}
+
+// Close closes the encrypter.
+func (e *instrumentedEncrypter) Close() error {
+	return CloseCipher(e.encrypter)
+}
+
+type instrumentedDecrypter struct {
+	decrypter Decrypt
+	metrics   *CipherMetrics
+}
+
+// GetAlgorithm returns the algorithm of the decrypter.
+func (d *instrumentedDecrypter) GetAlgorithm() AlgorithmType {
+	return d.decrypter.GetAlgorithm()
+}
+
+// GetKID returns the KID of the decrypter.
+func (d *instrumentedDecrypter) GetKID() string {
+	return d.decrypter.GetKID()
+}
+
+// DecryptMessage decrypts the message and records it.
+func (d *instrumentedDecrypter) DecryptMessage(cipher []byte, nonce []byte) ([]byte, error) {
+	start := time.Now()
+	message, err := d.decrypter.DecryptMessage(cipher, nonce)
+	d.metrics.observe(decryptOperation, d.decrypter, len(cipher), start, err)
+	return message, err
+}
+
+// DecryptMessageContext decrypts the message with the context and records it.
+func (d *instrumentedDecrypter) DecryptMessageContext(ctx context.Context, cipher []byte, nonce []byte) ([]byte, error) {
+	start := time.Now()
+	message, err := DecryptMessageContext(ctx, d.decrypter, cipher, nonce)
+	d.metrics.observe(decryptOperation, d.decrypter, len(cipher), start, err)
+	return message, err
+}
+
+// DecryptMessageWithAD decrypts the message with associated data and records
+// it.
+func (d *instrumentedDecrypter) DecryptMessageWithAD(cipher []byte, nonce []byte, ad []byte) ([]byte, error) {
+	start := time.Now()
+	message, err := DecryptMessageWithAD(d.decrypter, cipher, nonce, ad)
+	d.metrics.observe(decryptOperation, d.decrypter, len(cipher), start, err)
+	return message, err
+}
+
+// Metadata returns the metadata of the decrypter, if it has any.
+func (d *instrumentedDecrypter) Metadata() Metadata {
+	m, _ := GetMetadata(d.decrypter)
+	return m
+}
+
+// Close closes the decrypter.
+func (d *instrumentedDecrypter) Close() error {
+	return CloseCipher(d.decrypter)
+}
@@ -0,0 +1,128 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testHistogram struct {
+	*testMetric
+}
+
+func (h testHistogram) With(labelValues ...string) metrics.Histogram {
+	return testHistogram{h.testMetric.With(labelValues...).(*testMetric)}
+}
+
+func (h testHistogram) Observe(value float64) {
+	h.Add(value)
+}
+
+func TestErrorReason(t *testing.T) {
+	testData := []struct {
+		err    error
+		reason string
+	}{
+		{ErrDecryptFailed, ReasonDecryptFailed},
+		{ErrSignatureInvalid, ReasonSignatureInvalid},
+		{wrongKeyType("box key is %s", "rsa"), ReasonWrongKeyType},
+		{keyNotFound("kid %s", "a"), ReasonKeyNotFound},
+		{errCipherClosed, ReasonClosed},
+		{fmt.Errorf("%w: %w", ErrLimitExceeded, context.DeadlineExceeded), ReasonLimited},
+		{context.DeadlineExceeded, ReasonCanceled},
+		{errors.New("oops"), ReasonOther},
+	}
+	for _, tc := range testData {
+		assert.Equal(t, tc.reason, errorReason(tc.err), tc.err.Error())
+	}
+}
+
+func TestInstrumented(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	operations, failures := newTestMetric(), newTestMetric()
+	sizes, durations := newTestMetric(), newTestMetric()
+	m := &CipherMetrics{
+		Operations:  operations,
+		Failures:    failures,
+		PayloadSize: testHistogram{sizes},
+		Duration:    testHistogram{durations},
+	}
+
+	key := make([]byte, 32)
+	aesEncrypter, err := NewAESGCMEncrypt(key, WithKID("k1"))
+	require.Nil(err)
+	aesDecrypter, err := NewAESGCMDecrypt(key, WithKID("k1"))
+	require.Nil(err)
+	encrypter := InstrumentedEncrypt(aesEncrypter, m)
+	decrypter := InstrumentedDecrypt(aesDecrypter, m)
+	assert.Equal(AESGCM, encrypter.GetAlgorithm())
+	assert.Equal("k1", decrypter.GetKID())
+
+	cipher, nonce, err := encrypter.EncryptMessage([]byte("message"))
+	require.Nil(err)
+	_, err = decrypter.DecryptMessage(cipher, nonce)
+	require.Nil(err)
+
+	cipher, nonce, err = EncryptMessageWithAD(encrypter, []byte("message"), []byte("ad"))
+	require.Nil(err)
+	_, err = DecryptMessageWithAD(decrypter, cipher, nonce, []byte("other"))
+	assert.True(errors.Is(err, ErrDecryptFailed))
+
+	_, err = DecryptMessageContext(context.Background(), decrypter, cipher, nonce)
+	assert.NotNil(err)
+
+	encryptLabels := []string{OperationLabel, encryptOperation, AlgorithmLabel, string(AESGCM), KIDLabel, "k1"}
+	decryptLabels := []string{OperationLabel, decryptOperation, AlgorithmLabel, string(AESGCM), KIDLabel, "k1"}
+
+	value, _ := operations.get(encryptLabels...)
+	assert.Equal(2.0, value)
+	value, _ = operations.get(decryptLabels...)
+	assert.Equal(3.0, value)
+	value, _ = failures.get(append(decryptLabels, ReasonLabel, ReasonDecryptFailed)...)
+	assert.Equal(2.0, value)
+	_, ok := failures.get(append(encryptLabels, ReasonLabel, ReasonDecryptFailed)...)
+	assert.False(ok)
+	value, _ = sizes.get(encryptLabels...)
+	assert.Equal(float64(2*len("message")), value)
+	_, ok = durations.get(decryptLabels...)
+	assert.True(ok)
+
+	metadata, ok := GetMetadata(encrypter)
+	assert.True(ok)
+	assert.True(metadata.Authenticated)
+
+	require.Nil(CloseCipher(decrypter))
+	_, err = decrypter.DecryptMessage(cipher, nonce)
+	assert.Equal(errCipherClosed, err)
+	value, _ = failures.get(append(decryptLabels, ReasonLabel, ReasonClosed)...)
+	assert.Equal(1.0, value)
+
+	// nil metrics record nothing
+	encrypter = InstrumentedEncrypt(aesEncrypter, nil)
+	_, _, err = encrypter.EncryptMessage([]byte("message"))
+	assert.Nil(err)
+}
@@ -0,0 +1,97 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+// KafkaSerde encrypts the values of Kafka messages into envelopes when they
+// are produced and decrypts them when they are consumed.  It works on the
+// raw value bytes, so it needs no Kafka client: with segmentio/kafka-go set
+// Message.Value to the result of Serialize, and with sarama set
+// ProducerMessage.Value to the result of Encoder, which is a sarama.Encoder.
+// Consumed values go through Deserialize.  The topic is bound to each value
+// as associated data.  Null values are tombstones and are passed through, so
+// log compaction keeps working.
+type KafkaSerde struct {
+	// Encrypter encrypts produced values.
+	Encrypter Encrypt
+
+	// Router finds the decrypter of consumed values.
+	Router *Router
+
+	// SealOptions are used when sealing values, for example to compress
+	// them.
+	SealOptions []SealOption
+}
+
+// Serialize seals the value produced to the topic into a marshalled
+// envelope.
+func (s *KafkaSerde) Serialize(topic string, value []byte) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if s.Encrypter == nil {
+		return nil, errNoTransportCipher
+	}
+	e, err := SealEnvelopeWithAD(s.Encrypter, value, transportAD("kafka", topic), s.SealOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return e.MarshalBinary()
+}
+
+// Deserialize opens a value consumed from the topic.
+func (s *KafkaSerde) Deserialize(topic string, data []byte) ([]byte, error) {
+	if data == nil {
+		return nil, nil
+	}
+	if s.Router == nil {
+		return nil, errNoTransportCipher
+	}
+	var e Envelope
+	if err := e.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	decrypter, err := s.Router.Route(e.Algorithm, e.KID)
+	if err != nil {
+		return nil, err
+	}
+	return e.OpenWithAD(decrypter, transportAD("kafka", topic))
+}
+
+// Encoder seals the value produced to the topic as a sarama.Encoder.  The
+// value is sealed right away, and any error is returned by Encode.
+func (s *KafkaSerde) Encoder(topic string, value []byte) KafkaEncoder {
+	data, err := s.Serialize(topic, value)
+	return KafkaEncoder{data: data, err: err}
+}
+
+// KafkaEncoder is a sealed value that implements sarama.Encoder.
+type KafkaEncoder struct {
+	data []byte
+	err  error
+}
+
+// Encode returns the marshalled envelope, or why the value couldn't be
+// sealed.
+func (e KafkaEncoder) Encode() ([]byte, error) {
+	return e.data, e.err
+}
+
+// Length returns the size of the marshalled envelope.
+func (e KafkaEncoder) Length() int {
+	return len(e.data)
+}
@@ -0,0 +1,84 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// saramaEncoder is the sarama.Encoder interface.
+type saramaEncoder interface {
+	Encode() ([]byte, error)
+	Length() int
+}
+
+func TestKafkaSerde(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := loadBoxPair(t)
+	router := NewRouter(nil)
+	require.Nil(router.Register(decrypter))
+
+	producer := &KafkaSerde{Encrypter: encrypter, SealOptions: []SealOption{WithCompression(Gzip)}}
+	consumer := &KafkaSerde{Router: router}
+
+	data, err := producer.Serialize("events", []byte("hello"))
+	require.Nil(err)
+	assert.NotContains(string(data), "hello")
+	value, err := consumer.Deserialize("events", data)
+	require.Nil(err)
+	assert.Equal("hello", string(value))
+
+	// the value is bound to its topic
+	_, err = consumer.Deserialize("other", data)
+	assert.NotNil(err)
+
+	// tombstones stay null
+	data, err = producer.Serialize("events", nil)
+	require.Nil(err)
+	assert.Nil(data)
+	value, err = consumer.Deserialize("events", nil)
+	require.Nil(err)
+	assert.Nil(value)
+
+	var encoder saramaEncoder = producer.Encoder("events", []byte("hello"))
+	data, err = encoder.Encode()
+	require.Nil(err)
+	assert.Equal(len(data), encoder.Length())
+	value, err = consumer.Deserialize("events", data)
+	require.Nil(err)
+	assert.Equal("hello", string(value))
+
+	// the decrypter is picked by KID
+	_, err = (&KafkaSerde{Router: NewRouter(nil)}).Deserialize("events", data)
+	assert.NotNil(err)
+
+	_, err = consumer.Serialize("events", []byte("hello"))
+	assert.NotNil(err)
+	_, err = producer.Deserialize("events", data)
+	assert.NotNil(err)
+	_, err = consumer.Deserialize("events", []byte("garbage"))
+	assert.NotNil(err)
+
+	_, err = (&KafkaSerde{Encrypter: DefaultCipherEncrypter()}).Encoder("events", []byte("hello")).Encode()
+	assert.NotNil(err)
+}
@@ -0,0 +1,178 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// KeyAgreementCurve is the curve a KeyAgreement uses.  Both sides must use
+// the same one.
+type KeyAgreementCurve string
+
+const (
+	// X25519 is ECDH over Curve25519, the curve box uses.  It isn't allowed
+	// in FIPS mode.
+	X25519 KeyAgreementCurve = "x25519"
+
+	// P256 is ECDH over NIST P-256.
+	P256 KeyAgreementCurve = "p256"
+)
+
+// KeyAgreement is one side of an ECDH key exchange.  Each side sends the
+// other its PublicKey, and both derive the same key from their own private
+// key and the peer's public key, which can then be given to
+// NewAESGCMEncrypt and NewAESGCMDecrypt.  It is safe for concurrent use.
+type KeyAgreement interface {
+	// Curve returns the curve of the key.
+	Curve() KeyAgreementCurve
+
+	// PublicKey returns the public key to send to the peer, encoded as the
+	// curve's raw bytes: 32 bytes for X25519 and an uncompressed point for
+	// P256.
+	PublicKey() []byte
+
+	// SharedSecret returns the raw ECDH secret with the peer.  It is not
+	// uniformly random, so it should go through DeriveKey before being used
+	// as a key.
+	SharedSecret(peerPublicKey []byte) ([]byte, error)
+
+	// DeriveKey returns a key of size bytes derived from the shared secret
+	// with HKDF-SHA256.  The salt is optional; info binds the key to its
+	// purpose, so keys derived for different uses don't collide.
+	DeriveKey(peerPublicKey []byte, salt []byte, info []byte, size int) ([]byte, error)
+}
+
+// GenerateKeyAgreement creates a key agreement with a new random key.
+func GenerateKeyAgreement(curve KeyAgreementCurve) (KeyAgreement, error) {
+	c, err := ecdhCurve(curve)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := c.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s key: %w", string(curve), err)
+	}
+	return &ecdhKeyAgreement{curve: curve, privateKey: privateKey}, nil
+}
+
+// NewKeyAgreement creates a key agreement from a raw private key: 32 bytes
+// for both X25519 and P256.  A box private key can be used with X25519.
+func NewKeyAgreement(curve KeyAgreementCurve, privateKey []byte) (KeyAgreement, error) {
+	c, err := ecdhCurve(curve)
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, wrongKeyType("invalid %s private key: %v", string(curve), err)
+	}
+	return &ecdhKeyAgreement{curve: curve, privateKey: key}, nil
+}
+
+// DeriveKey derives a key of size bytes from a secret with HKDF-SHA256.
+func DeriveKey(secret []byte, salt []byte, info []byte, size int) ([]byte, error) {
+	if size <= 0 {
+		return nil, errors.New("invalid key size")
+	}
+	key := make([]byte, size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), key); err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	return key, nil
+}
+
+func ecdhCurve(curve KeyAgreementCurve) (ecdh.Curve, error) {
+	switch curve {
+	case X25519:
+		if FIPSMode() {
+			return nil, errors.New("curve x25519 is not allowed in fips mode")
+		}
+		return ecdh.X25519(), nil
+	case P256:
+		return ecdh.P256(), nil
+	}
+	return nil, errors.New("unknown key agreement curve " + string(curve))
+}
+
+type ecdhKeyAgreement struct {
+	curve      KeyAgreementCurve
+	privateKey *ecdh.PrivateKey
+	lock       sync.RWMutex
+}
+
+// Curve returns the curve of the key.
+func (k *ecdhKeyAgreement) Curve() KeyAgreementCurve {
+	return k.curve
+}
+
+// PublicKey returns the raw public key.
+func (k *ecdhKeyAgreement) PublicKey() []byte {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	if k.privateKey == nil {
+		return nil
+	}
+	return k.privateKey.PublicKey().Bytes()
+}
+
+// SharedSecret runs ECDH with the peer's public key.
+func (k *ecdhKeyAgreement) SharedSecret(peerPublicKey []byte) ([]byte, error) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	if k.privateKey == nil {
+		return nil, errCipherClosed
+	}
+	peer, err := k.privateKey.Curve().NewPublicKey(peerPublicKey)
+	if err != nil {
+		return nil, wrongKeyType("invalid %s public key: %v", string(k.curve), err)
+	}
+	secret, err := k.privateKey.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("key agreement failed: %w", err)
+	}
+	return secret, nil
+}
+
+// DeriveKey runs ECDH with the peer's public key and derives a key from the
+// secret with HKDF-SHA256.
+func (k *ecdhKeyAgreement) DeriveKey(peerPublicKey []byte, salt []byte, info []byte, size int) ([]byte, error) {
+	secret, err := k.SharedSecret(peerPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(secret)
+	return DeriveKey(secret, salt, info, size)
+}
+
+// Close drops the private key.  crypto/ecdh keeps the key bytes private, so
+// they can't be wiped, but the key agreement refuses to run after it.
+func (k *ecdhKeyAgreement) Close() error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.privateKey = nil
+	return nil
+}
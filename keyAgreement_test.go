@@ -0,0 +1,198 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyAgreement(t *testing.T) {
+	for _, curve := range []KeyAgreementCurve{X25519, P256} {
+		t.Run(string(curve), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			alice, err := GenerateKeyAgreement(curve)
+			require.Nil(err)
+			bob, err := GenerateKeyAgreement(curve)
+			require.Nil(err)
+			assert.Equal(curve, alice.Curve())
+
+			aliceSecret, err := alice.SharedSecret(bob.PublicKey())
+			require.Nil(err)
+			bobSecret, err := bob.SharedSecret(alice.PublicKey())
+			require.Nil(err)
+			assert.Equal(aliceSecret, bobSecret)
+
+			info := []byte("session")
+			aliceKey, err := alice.DeriveKey(bob.PublicKey(), nil, info, 32)
+			require.Nil(err)
+			bobKey, err := bob.DeriveKey(alice.PublicKey(), nil, info, 32)
+			require.Nil(err)
+			assert.Equal(aliceKey, bobKey)
+			assert.NotEqual(aliceSecret, aliceKey)
+
+			otherKey, err := bob.DeriveKey(alice.PublicKey(), nil, []byte("other"), 32)
+			require.Nil(err)
+			assert.NotEqual(aliceKey, otherKey)
+
+			encrypter, err := NewAESGCMEncrypt(aliceKey, WithKID("session"))
+			require.Nil(err)
+			decrypter, err := NewAESGCMDecrypt(bobKey)
+			require.Nil(err)
+			assert.Equal(AESGCM, encrypter.GetAlgorithm())
+			assert.Equal("session", encrypter.GetKID())
+			testCryptoPair(t, encrypter, decrypter, false)
+
+			_, err = alice.SharedSecret([]byte("not a key"))
+			assert.True(errors.Is(err, ErrWrongKeyType))
+
+			_, err = alice.DeriveKey(bob.PublicKey(), nil, info, 0)
+			assert.NotNil(err)
+		})
+	}
+}
+
+func TestKeyAgreementBoxKeys(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	publicKey, privateKey, err := GenerateBoxKeyPair()
+	require.Nil(err)
+
+	k, err := NewKeyAgreement(X25519, privateKey[:])
+	require.Nil(err)
+	assert.Equal(publicKey[:], k.PublicKey())
+
+	_, err = NewKeyAgreement(P256, []byte{1, 2, 3})
+	assert.True(errors.Is(err, ErrWrongKeyType))
+
+	_, err = GenerateKeyAgreement("p384")
+	assert.NotNil(err)
+
+	require.Nil(k.(*ecdhKeyAgreement).Close())
+	assert.Nil(k.PublicKey())
+	_, err = k.SharedSecret(publicKey[:])
+	assert.Equal(errCipherClosed, err)
+}
+
+func TestKeyAgreementFIPS(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	require.Nil(SetFIPSMode(true))
+	defer SetFIPSMode(false)
+
+	_, err := GenerateKeyAgreement(X25519)
+	assert.NotNil(err)
+
+	k, err := GenerateKeyAgreement(P256)
+	require.Nil(err)
+	key, err := k.DeriveKey(k.PublicKey(), []byte("salt"), nil, 16)
+	require.Nil(err)
+	_, err = NewAESGCMEncrypt(key)
+	assert.Nil(err)
+}
+
+func TestAESGCM(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	key := make([]byte, 32)
+	encrypter, err := NewAESGCMEncrypt(key)
+	require.Nil(err)
+	decrypter, err := NewAESGCMDecrypt(key)
+	require.Nil(err)
+
+	m, ok := GetMetadata(encrypter)
+	assert.True(ok)
+	assert.Equal(Metadata{NonceSize: 12, Overhead: 16, Authenticated: true}, m)
+
+	cipher, nonce, err := EncryptMessageWithAD(encrypter, []byte("message"), []byte("header"))
+	require.Nil(err)
+	assert.Len(cipher, m.CiphertextSize(len("message")))
+
+	message, err := DecryptMessageWithAD(decrypter, cipher, nonce, []byte("header"))
+	require.Nil(err)
+	assert.Equal("message", string(message))
+
+	_, err = DecryptMessageWithAD(decrypter, cipher, nonce, []byte("other"))
+	assert.True(errors.Is(err, ErrDecryptFailed))
+
+	cipher[0] ^= 1
+	_, err = decrypter.DecryptMessage(cipher, nonce)
+	assert.True(errors.Is(err, ErrDecryptFailed))
+
+	_, err = decrypter.DecryptMessage(cipher, nonce[1:])
+	assert.NotNil(err)
+
+	_, err = NewAESGCMEncrypt(make([]byte, 7))
+	assert.NotNil(err)
+
+	counter := NewCounterNonceSource(nil, 1)
+	encrypter, err = NewAESGCMEncrypt(key, WithNonceSource(counter))
+	require.Nil(err)
+	_, nonce, err = encrypter.EncryptMessage([]byte("message"))
+	require.Nil(err)
+	assert.Equal([]byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, nonce)
+
+	require.Nil(CloseCipher(decrypter))
+	_, err = decrypter.DecryptMessage(cipher, nonce)
+	assert.Equal(errCipherClosed, err)
+}
+
+func TestAESGCMDeterministic(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	key := make([]byte, 32)
+	encrypter, err := NewAESGCMEncrypt(key, WithDeterministicNonces())
+	require.Nil(err)
+	decrypter, err := NewAESGCMDecrypt(key)
+	require.Nil(err)
+
+	cipher, nonce, err := EncryptMessageWithAD(encrypter, []byte("message"), []byte("header"))
+	require.Nil(err)
+	again, againNonce, err := EncryptMessageWithAD(encrypter, []byte("message"), []byte("header"))
+	require.Nil(err)
+	assert.Equal(cipher, again)
+	assert.Equal(nonce, againNonce)
+
+	message, err := DecryptMessageWithAD(decrypter, cipher, nonce, []byte("header"))
+	require.Nil(err)
+	assert.Equal("message", string(message))
+
+	_, other, err := EncryptMessageWithAD(encrypter, []byte("other"), []byte("header"))
+	require.Nil(err)
+	assert.NotEqual(nonce, other)
+	_, other, err = EncryptMessageWithAD(encrypter, []byte("message"), []byte("other"))
+	require.Nil(err)
+	assert.NotEqual(nonce, other)
+
+	otherKey := make([]byte, 32)
+	otherKey[0] = 1
+	encrypter, err = NewAESGCMEncrypt(otherKey, WithDeterministicNonces())
+	require.Nil(err)
+	_, other, err = EncryptMessageWithAD(encrypter, []byte("message"), []byte("header"))
+	require.Nil(err)
+	assert.NotEqual(nonce, other)
+}
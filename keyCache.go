@@ -0,0 +1,157 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"crypto/rsa"
+	"math/big"
+	"sync"
+)
+
+// KeyCache keeps the keys an RSALoader or BoxLoader has read and parsed, so
+// loading ciphers again in a request path doesn't read and parse the key
+// files every time.  The keys are kept until Invalidate is called, which the
+// watching ciphers do before every reload, so rotated keys are picked up.
+// Errors aren't kept, so a key that failed to load is tried again next time.
+//
+// A KeyCache belongs to one loader and must not be shared between loaders
+// with different keys.  While it holds a private key that key stays in
+// memory, and every cipher loaded from it gets its own copy, so closing one
+// cipher doesn't wipe the keys of another.  It is safe for concurrent use.
+type KeyCache struct {
+	lock sync.Mutex
+	keys map[string]interface{}
+}
+
+// NewKeyCache returns an empty KeyCache.
+func NewKeyCache() *KeyCache {
+	return &KeyCache{keys: map[string]interface{}{}}
+}
+
+// Invalidate forgets every key, wiping the private keys, so the next load
+// reads them again.
+func (c *KeyCache) Invalidate() {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for name, key := range c.keys {
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			wipeRSAPrivateKey(key)
+		case *[BoxKeySize]byte:
+			wipe(key[:])
+		}
+		delete(c.keys, name)
+	}
+}
+
+// get returns the key kept under name, calling load and keeping its result
+// if there isn't one.  A nil cache always calls load.
+func (c *KeyCache) get(name string, load func() (interface{}, error)) (interface{}, error) {
+	if c == nil {
+		return load()
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if key, ok := c.keys[name]; ok {
+		return key, nil
+	}
+	key, err := load()
+	if err != nil {
+		return nil, err
+	}
+	if c.keys == nil {
+		c.keys = map[string]interface{}{}
+	}
+	c.keys[name] = key
+	return key, nil
+}
+
+// keyCacher is a loader with a KeyCache, which the watching ciphers
+// invalidate before reloading.
+type keyCacher interface {
+	keyCache() *KeyCache
+}
+
+// invalidateKeyCache invalidates the KeyCache of the loader, if it has one.
+func invalidateKeyCache(loader interface{}) {
+	if cacher, ok := loader.(keyCacher); ok {
+		cacher.keyCache().Invalidate()
+	}
+}
+
+// getCachedPrivateKey loads an RSA private key through the cache, returning
+// a copy the caller owns.
+func getCachedPrivateKey(ctx context.Context, cache *KeyCache, loader KeyLoader) (*rsa.PrivateKey, error) {
+	if cache == nil {
+		return GetPrivateKeyContext(ctx, loader)
+	}
+	key, err := cache.get("rsa private", func() (interface{}, error) {
+		return GetPrivateKeyContext(ctx, loader)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return copyRSAPrivateKey(key.(*rsa.PrivateKey)), nil
+}
+
+// getCachedPublicKey loads an RSA public key through the cache.  Public keys
+// aren't wiped, so they're shared.
+func getCachedPublicKey(ctx context.Context, cache *KeyCache, loader KeyLoader) (*rsa.PublicKey, error) {
+	key, err := cache.get("rsa public", func() (interface{}, error) {
+		return GetPublicKeyContext(ctx, loader)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key.(*rsa.PublicKey), nil
+}
+
+// copyRSAPrivateKey copies the parts of the key wipeRSAPrivateKey wipes.
+// The rest is never changed, so it's shared, keeping the precomputed values
+// crypto/rsa keeps for itself.
+func copyRSAPrivateKey(key *rsa.PrivateKey) *rsa.PrivateKey {
+	copyInt := func(x *big.Int) *big.Int {
+		if x == nil {
+			return nil
+		}
+		return new(big.Int).Set(x)
+	}
+
+	c := *key
+	c.D = copyInt(key.D)
+	c.Primes = make([]*big.Int, len(key.Primes))
+	for i, prime := range key.Primes {
+		c.Primes[i] = copyInt(prime)
+	}
+	c.Precomputed.Dp = copyInt(key.Precomputed.Dp)
+	c.Precomputed.Dq = copyInt(key.Precomputed.Dq)
+	c.Precomputed.Qinv = copyInt(key.Precomputed.Qinv)
+	c.Precomputed.CRTValues = make([]rsa.CRTValue, len(key.Precomputed.CRTValues))
+	for i, value := range key.Precomputed.CRTValues {
+		c.Precomputed.CRTValues[i] = rsa.CRTValue{
+			Exp:   copyInt(value.Exp),
+			Coeff: copyInt(value.Coeff),
+			R:     copyInt(value.R),
+		}
+	}
+	return &c
+}
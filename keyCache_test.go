@@ -0,0 +1,155 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// countingLoader counts how often its key is read.
+type countingLoader struct {
+	data  atomic.Value
+	reads int32
+}
+
+func newCountingLoader(data []byte) *countingLoader {
+	loader := new(countingLoader)
+	loader.data.Store(data)
+	return loader
+}
+
+func (c *countingLoader) GetBytes() ([]byte, error) {
+	atomic.AddInt32(&c.reads, 1)
+	return c.data.Load().([]byte), nil
+}
+
+func (c *countingLoader) count() int {
+	return int(atomic.LoadInt32(&c.reads))
+}
+
+func TestKeyCacheRSA(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(err)
+	private := newCountingLoader(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}))
+	public := newCountingLoader(pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&privateKey.PublicKey)}))
+
+	loader := &RSALoader{
+		Hash:       &BasicHashLoader{HashName: "SHA512"},
+		PrivateKey: private,
+		PublicKey:  public,
+		Cache:      NewKeyCache(),
+	}
+
+	encrypter, err := loader.LoadEncrypt()
+	require.Nil(err)
+	first, err := loader.LoadDecrypt()
+	require.Nil(err)
+	second, err := loader.LoadDecrypt()
+	require.Nil(err)
+	assert.Equal(1, private.count())
+	assert.Equal(1, public.count())
+
+	// each cipher owns a copy of the private key
+	require.Nil(CloseCipher(first))
+	testCryptoPair(t, encrypter, second, true)
+
+	loader.Cache.Invalidate()
+	_, err = loader.LoadDecrypt()
+	require.Nil(err)
+	assert.Equal(2, private.count())
+	testCryptoPair(t, encrypter, second, true)
+}
+
+func TestKeyCacheBox(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	senderPublicKey, senderPrivateKey, err := box.GenerateKey(rand.Reader)
+	require.Nil(err)
+	recipientPublicKey, recipientPrivateKey, err := box.GenerateKey(rand.Reader)
+	require.Nil(err)
+
+	private := newCountingLoader(EncodeBoxPrivateKeyPEM(*recipientPrivateKey))
+	public := newCountingLoader(EncodeBoxPublicKeyPEM(*senderPublicKey))
+	loader := &BoxLoader{PrivateKey: private, PublicKey: public, Cache: NewKeyCache()}
+
+	for i := 0; i < 3; i++ {
+		decrypter, err := loader.LoadDecrypt()
+		require.Nil(err)
+		testCryptoPair(t, NewBoxEncrypter(*senderPrivateKey, *recipientPublicKey, ""), decrypter, false)
+		require.Nil(CloseCipher(decrypter))
+	}
+	assert.Equal(1, private.count())
+	assert.Equal(1, public.count())
+
+	// errors aren't kept
+	private.data.Store([]byte("garbage"))
+	loader.Cache.Invalidate()
+	_, err = loader.LoadDecrypt()
+	assert.NotNil(err)
+	_, err = loader.LoadDecrypt()
+	assert.NotNil(err)
+	assert.Equal(3, private.count())
+
+	// without a cache every load reads the keys
+	loader = &BoxLoader{PrivateKey: private, PublicKey: public}
+	private.data.Store(EncodeBoxPrivateKeyPEM(*recipientPrivateKey))
+	for i := 0; i < 2; i++ {
+		_, err = loader.LoadDecrypt()
+		require.Nil(err)
+	}
+	assert.Equal(5, private.count())
+}
+
+func TestKeyCacheWatching(t *testing.T) {
+	require := require.New(t)
+
+	senderPublicKey, senderPrivateKey, err := box.GenerateKey(rand.Reader)
+	require.Nil(err)
+	recipientPublicKey, recipientPrivateKey, err := box.GenerateKey(rand.Reader)
+	require.Nil(err)
+
+	private := newCountingLoader(EncodeBoxPrivateKeyPEM(*recipientPrivateKey))
+	public := newCountingLoader(EncodeBoxPublicKeyPEM(*senderPublicKey))
+	loader := &BoxLoader{PrivateKey: private, PublicKey: public, Cache: NewKeyCache()}
+
+	decrypter, err := NewWatchingDecrypter(loader, []KeyLoader{private, public}, WatchOptions{Interval: time.Hour})
+	require.Nil(err)
+	defer decrypter.Close()
+	testCryptoPair(t, NewBoxEncrypter(*senderPrivateKey, *recipientPublicKey, ""), decrypter, false)
+
+	// a reload reads the rotated key rather than the cached one
+	rotatedPublicKey, rotatedPrivateKey, err := box.GenerateKey(rand.Reader)
+	require.Nil(err)
+	private.data.Store(EncodeBoxPrivateKeyPEM(*rotatedPrivateKey))
+	require.Nil(decrypter.Reload())
+	testCryptoPair(t, NewBoxEncrypter(*senderPrivateKey, *rotatedPublicKey, ""), decrypter, false)
+}
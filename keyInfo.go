@@ -0,0 +1,121 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+)
+
+// KeyInfo is implemented by the ciphers and signers that can report their
+// public key, so it can be published or checked against what a peer expects
+// without loading the PEM again.
+type KeyInfo interface {
+	// PublicKey returns the public key of the cipher: the recipient's key for
+	// an encrypter and the cipher's own key for a decrypter or signer.  RSA
+	// keys are *rsa.PublicKey, EC keys *ecdsa.PublicKey, ed25519 keys
+	// ed25519.PublicKey and box keys [BoxKeySize]byte.
+	PublicKey() crypto.PublicKey
+
+	// KeySize returns the size of the key in bits.
+	KeySize() int
+}
+
+// PublicKey returns the recipient's public key.
+func (c *rsaEncrypterDecrypter) PublicKey() crypto.PublicKey {
+	if c.recipientPublicKey != nil {
+		return c.recipientPublicKey
+	}
+	return &c.recipientPrivateKey.PublicKey
+}
+
+// KeySize returns the size of the RSA modulus.
+func (c *rsaEncrypterDecrypter) KeySize() int {
+	return c.PublicKey().(*rsa.PublicKey).N.BitLen()
+}
+
+// PublicKey returns the recipient's public key.
+func (enBox *encryptBox) PublicKey() crypto.PublicKey {
+	return enBox.recipientPublicKey
+}
+
+// KeySize returns 256.
+func (enBox *encryptBox) KeySize() int {
+	return BoxKeySize * 8
+}
+
+// PublicKey returns the recipient's public key.
+func (deBox *decryptBox) PublicKey() crypto.PublicKey {
+	return deBox.recipientPublicKey
+}
+
+// KeySize returns 256.
+func (deBox *decryptBox) KeySize() int {
+	return BoxKeySize * 8
+}
+
+// PublicKey returns the recipient's public key.
+func (e *encryptEphemeralBox) PublicKey() crypto.PublicKey {
+	return e.recipientPublicKey
+}
+
+// KeySize returns 256.
+func (e *encryptEphemeralBox) KeySize() int {
+	return BoxKeySize * 8
+}
+
+// PublicKey returns the recipient's public key.
+func (d *decryptEphemeralBox) PublicKey() crypto.PublicKey {
+	return d.recipientPublicKey
+}
+
+// KeySize returns 256.
+func (d *decryptEphemeralBox) KeySize() int {
+	return BoxKeySize * 8
+}
+
+// PublicKey returns the ed25519 public key.
+func (s *ed25519Signer) PublicKey() crypto.PublicKey {
+	return s.publicKey
+}
+
+// KeySize returns 256.
+func (s *ed25519Signer) KeySize() int {
+	return ed25519.PublicKeySize * 8
+}
+
+// PublicKey returns the RSA public key.
+func (s *rsaPSSSigner) PublicKey() crypto.PublicKey {
+	return s.publicKey
+}
+
+// KeySize returns the size of the RSA modulus.
+func (s *rsaPSSSigner) KeySize() int {
+	return s.publicKey.N.BitLen()
+}
+
+// PublicKey returns the EC public key.
+func (s *ecdsaSigner) PublicKey() crypto.PublicKey {
+	return s.publicKey
+}
+
+// KeySize returns the size of the curve.
+func (s *ecdsaSigner) KeySize() int {
+	return s.publicKey.Curve.Params().BitSize
+}
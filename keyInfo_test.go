@@ -0,0 +1,84 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyInfo(t *testing.T) {
+	require := require.New(t)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(err)
+	rsaEncrypter, err := NewRSAEncrypt(&rsaKey.PublicKey)
+	require.Nil(err)
+	rsaDecrypter, err := NewRSADecrypt(rsaKey)
+	require.Nil(err)
+
+	senderPublicKey, senderPrivateKey, err := GenerateBoxKeyPair()
+	require.Nil(err)
+	recipientPublicKey, recipientPrivateKey, err := GenerateBoxKeyPair()
+	require.Nil(err)
+
+	edPublicKey, edPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.Nil(err)
+
+	testData := []struct {
+		description string
+		cipher      Identification
+		publicKey   crypto.PublicKey
+		size        int
+	}{
+		{"rsa encrypter", rsaEncrypter, &rsaKey.PublicKey, 2048},
+		{"rsa decrypter", rsaDecrypter, &rsaKey.PublicKey, 2048},
+		{"box encrypter", NewBoxEncrypter(*senderPrivateKey, *recipientPublicKey, ""), *recipientPublicKey, 256},
+		{"box decrypter", NewBoxDecrypter(*recipientPrivateKey, *senderPublicKey, ""), *recipientPublicKey, 256},
+		{"ed25519 signer", NewEd25519Signer(edPrivateKey, ""), edPublicKey, 256},
+		{"ed25519 verifier", NewEd25519Verifier(edPublicKey, ""), edPublicKey, 256},
+		{"rsa-pss signer", NewRSAPSSSigner(crypto.SHA256, rsaKey, ""), &rsaKey.PublicKey, 2048},
+		{"ecdsa signer", NewECDSASigner(crypto.SHA384, ecKey, ""), &ecKey.PublicKey, 384},
+		{"ecdsa verifier", NewECDSAVerifier(crypto.SHA384, &ecKey.PublicKey, ""), &ecKey.PublicKey, 384},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			info, ok := tc.cipher.(KeyInfo)
+			if assert.True(ok) {
+				assert.Equal(tc.publicKey, info.PublicKey())
+				assert.Equal(tc.size, info.KeySize())
+			}
+		})
+	}
+
+	_, ok := DefaultCipherEncrypter().(KeyInfo)
+	require.False(ok, "noop has no key")
+}
@@ -0,0 +1,181 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"fmt"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// loadKeyPairs loads each key of the config's algorithm that is configured,
+// once, and checks the keys before any cipher is built: every key must parse
+// as the kind of key its slot holds, each public key configured with its
+// private key must belong to it, and for box the sender's private key and the
+// recipient's public key, and the other way round, must agree on a shared
+// key.  Misordered key files then fail when the config is loaded, rather
+// than on the first message.
+//
+// It returns a copy of the config whose key loaders return copies of the
+// loaded keys, so the factory doesn't run remote, exec or prompt loaders a
+// second time.  The copies are wiped by wipeLoadedKeys once the cipher is
+// built; the bytes the loaders returned are left alone, as loaders like
+// BytesLoader keep them.
+func (config *Config) loadKeyPairs(ctx context.Context) (_ *Config, err error) {
+	kind, pairs := keyPairs(config.Type)
+	if len(pairs) == 0 {
+		return config, nil
+	}
+
+	loaded := *config
+	loaded.loadedKeys = map[KeyType][]byte{}
+	defer func() {
+		if err != nil {
+			loaded.wipeLoadedKeys()
+		}
+	}()
+	keys := map[KeyType]interface{}{}
+	defer wipePairKeys(keys)
+	for _, pair := range pairs {
+		for i, keyType := range pair {
+			if !config.hasKey(keyType) {
+				continue
+			}
+			loader := config.keyLoader(keyType)
+			data, err := GetKeyBytes(ctx, loader)
+			if err != nil {
+				return nil, err
+			}
+			key, err := parsePairKey(kind, i == 0, data)
+			if err != nil {
+				return nil, keyError(loader, err)
+			}
+			loaded.loadedKeys[keyType] = append([]byte(nil), data...)
+			keys[keyType] = key
+		}
+	}
+
+	for _, pair := range pairs {
+		privateKey, publicKey := keys[pair[0]], keys[pair[1]]
+		if privateKey == nil || publicKey == nil {
+			continue
+		}
+		if !isPublicKeyOf(privateKey, publicKey) {
+			return nil, &KeyError{
+				KeyType: pair[1],
+				Err:     fmt.Errorf("%w: not the public key of %s", ErrKeyMismatch, pair[0]),
+			}
+		}
+	}
+
+	if kind == BoxKeyPair {
+		for _, pair := range [][2]KeyType{{SenderPrivateKey, RecipientPublicKey}, {RecipientPrivateKey, SenderPublicKey}} {
+			privateKey, publicKey := keys[pair[0]], keys[pair[1]]
+			if privateKey == nil || publicKey == nil {
+				continue
+			}
+			shared, err := curve25519.X25519(privateKey.(*[BoxKeySize]byte)[:], publicKey.(*[BoxKeySize]byte)[:])
+			if err != nil {
+				return nil, &KeyError{
+					KeyType: pair[1],
+					Err:     fmt.Errorf("%w: no shared key with %s: %w", ErrInvalidKey, pair[0], err),
+				}
+			}
+			wipe(shared)
+		}
+	}
+	return &loaded, nil
+}
+
+// parsePairKey parses the private or public key of a key pair of the kind.
+// RSA private keys are validated too.
+func parsePairKey(kind KeyPairType, private bool, data []byte) (interface{}, error) {
+	switch kind {
+	case RSAKeyPair:
+		if !private {
+			return parseRSAPublicKey(data)
+		}
+		privateKey, err := parseRSAPrivateKey(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := privateKey.Validate(); err != nil {
+			wipeRSAPrivateKey(privateKey)
+			return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+		}
+		return privateKey, nil
+	case BoxKeyPair:
+		parse := ParseBoxPublicKey
+		if private {
+			parse = ParseBoxPrivateKey
+		}
+		key, err := parse(data)
+		if err != nil {
+			return nil, err
+		}
+		return &key, nil
+	case Ed25519KeyPair:
+		if private {
+			return ParseEd25519PrivateKey(data)
+		}
+		return ParseEd25519PublicKey(data)
+	}
+	return nil, fmt.Errorf("unknown key pair type %s", kind)
+}
+
+// isPublicKeyOf reports whether publicKey is the public key of privateKey,
+// both parsed by parsePairKey.
+func isPublicKeyOf(privateKey, publicKey interface{}) bool {
+	switch privateKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return privateKey.PublicKey.Equal(publicKey)
+	case *[BoxKeySize]byte:
+		var derived [BoxKeySize]byte
+		curve25519.ScalarBaseMult(&derived, privateKey)
+		return secretEqual(derived[:], publicKey.(*[BoxKeySize]byte)[:])
+	case ed25519.PrivateKey:
+		return publicKey.(ed25519.PublicKey).Equal(privateKey.Public())
+	}
+	return false
+}
+
+// wipePairKeys wipes the private keys parsed by parsePairKey.  Box public
+// keys are wiped too, which does no harm.
+func wipePairKeys(keys map[KeyType]interface{}) {
+	for _, key := range keys {
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			wipeRSAPrivateKey(key)
+		case *[BoxKeySize]byte:
+			wipe(key[:])
+		case ed25519.PrivateKey:
+			wipe(key)
+		}
+	}
+}
+
+// wipeLoadedKeys wipes the keys loadKeyPairs loaded and forgets them.
+func (config *Config) wipeLoadedKeys() {
+	for _, data := range config.loadedKeys {
+		wipe(data)
+	}
+	config.loadedKeys = nil
+}
@@ -0,0 +1,213 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadKeyPairs(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+	for _, name := range []string{"ed", "other-ed"} {
+		require.Nil(t, GenerateKeyPairFiles(Ed25519KeyPair, path(name+"-private.pem"), path(name+"-public.pem"), 0))
+	}
+
+	privateKey, err := GenerateRSAKey(0)
+	require.Nil(t, err)
+	otherKey, err := GenerateRSAKey(0)
+	require.Nil(t, err)
+	privateLoader := &BytesLoader{Data: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})}
+	publicLoader := &BytesLoader{Data: pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&privateKey.PublicKey)})}
+	otherPublicLoader := &BytesLoader{Data: pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&otherKey.PublicKey)})}
+
+	testData := []struct {
+		description string
+		config      Config
+		keyType     KeyType
+		err         error
+	}{
+		{"rsa pair", Config{
+			Type:    RSASymmetric,
+			Params:  map[string]string{"hash": "SHA512"},
+			Loaders: map[KeyType]KeyLoader{PrivateKey: privateLoader, PublicKey: publicLoader},
+		}, "", nil},
+		{"rsa pair mismatch", Config{
+			Type:    RSASymmetric,
+			Params:  map[string]string{"hash": "SHA512"},
+			Loaders: map[KeyType]KeyLoader{PrivateKey: privateLoader, PublicKey: otherPublicLoader},
+		}, PublicKey, ErrKeyMismatch},
+		{"rsa asymmetric recipient mismatch", Config{
+			Type:   RSAAsymmetric,
+			Params: map[string]string{"hash": "SHA512"},
+			Loaders: map[KeyType]KeyLoader{
+				SenderPrivateKey:    privateLoader,
+				SenderPublicKey:     publicLoader,
+				RecipientPrivateKey: privateLoader,
+				RecipientPublicKey:  otherPublicLoader,
+			},
+		}, RecipientPublicKey, ErrKeyMismatch},
+		{"box pairs", Config{Type: Box, Keys: map[KeyType]string{
+			SenderPrivateKey:    "sendBoxPrivate.pem",
+			SenderPublicKey:     "sendBoxPublic.pem",
+			RecipientPrivateKey: "boxPrivate.pem",
+			RecipientPublicKey:  "boxPublic.pem",
+		}}, "", nil},
+		{"box public keys swapped", Config{Type: Box, Keys: map[KeyType]string{
+			SenderPrivateKey:    "sendBoxPrivate.pem",
+			SenderPublicKey:     "boxPublic.pem",
+			RecipientPrivateKey: "boxPrivate.pem",
+			RecipientPublicKey:  "sendBoxPublic.pem",
+		}}, SenderPublicKey, ErrKeyMismatch},
+		{"box without pairs", Config{Type: Box, Keys: map[KeyType]string{
+			SenderPrivateKey:   "sendBoxPrivate.pem",
+			RecipientPublicKey: "boxPublic.pem",
+		}}, "", nil},
+		{"box recipient public key misordered", Config{Type: Box, Keys: map[KeyType]string{
+			SenderPrivateKey:   "sendBoxPrivate.pem",
+			RecipientPublicKey: "boxPrivate.pem",
+		}}, RecipientPublicKey, ErrWrongKeyType},
+		{"box recipient public key low order", Config{
+			Type:    Box,
+			Keys:    map[KeyType]string{SenderPrivateKey: "sendBoxPrivate.pem"},
+			Loaders: map[KeyType]KeyLoader{RecipientPublicKey: &BytesLoader{Data: []byte(strings.Repeat("00", BoxKeySize))}},
+		}, RecipientPublicKey, ErrInvalidKey},
+		{"rsa asymmetric sender private key misordered", Config{
+			Type:   RSAAsymmetric,
+			Params: map[string]string{"hash": "SHA512"},
+			Loaders: map[KeyType]KeyLoader{
+				SenderPrivateKey:   publicLoader,
+				RecipientPublicKey: publicLoader,
+			},
+		}, SenderPrivateKey, ErrWrongKeyType},
+		{"ed25519 pair", Config{Type: Ed25519Sign, Keys: map[KeyType]string{
+			PrivateKey: path("ed-private.pem"),
+			PublicKey:  path("ed-public.pem"),
+		}}, "", nil},
+		{"ed25519 pair mismatch", Config{Type: Ed25519Sign, Keys: map[KeyType]string{
+			PrivateKey: path("ed-private.pem"),
+			PublicKey:  path("other-ed-public.pem"),
+		}}, PublicKey, ErrKeyMismatch},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			failures := newTestMetric()
+			tc.config.Metrics = &LoaderMetrics{LoadFailures: failures}
+			tc.config.KID = "pair"
+
+			_, err := tc.config.loadKeyPairs(context.Background())
+			if tc.keyType == "" {
+				assert.Nil(err)
+				return
+			}
+
+			var keyErr *KeyError
+			if assert.True(errors.As(err, &keyErr), "%v", err) {
+				assert.Equal(tc.keyType, keyErr.KeyType)
+			}
+			assert.True(errors.Is(err, tc.err), "%v", err)
+
+			if tc.config.Type == Ed25519Sign {
+				return
+			}
+			_, err = tc.config.LoadDecrypt()
+			assert.True(errors.Is(err, tc.err), "%v", err)
+			reason := ReasonLoad
+			if tc.err == ErrKeyMismatch {
+				reason = ReasonKeyMismatch
+			}
+			value, _ := failures.get("operation", "decrypt", "algorithm", string(tc.config.Type), "kid", "pair", "reason", reason)
+			assert.Equal(1.0, value)
+		})
+	}
+}
+
+func TestLoadKeyPairsMalformed(t *testing.T) {
+	config := Config{Type: Box, Keys: map[KeyType]string{
+		SenderPrivateKey: "sendBoxPrivate.pem",
+		SenderPublicKey:  "private.pem",
+	}}
+
+	_, err := config.loadKeyPairs(context.Background())
+	var keyErr *KeyError
+	if assert.True(t, errors.As(err, &keyErr), "%v", err) {
+		assert.Equal(t, SenderPublicKey, keyErr.KeyType)
+	}
+	assert.True(t, errors.Is(err, ErrWrongKeyType), "%v", err)
+}
+
+func TestLoadKeyPairsOnce(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	loaders := map[KeyType]*countingLoader{}
+	config := Config{Type: Box, Loaders: map[KeyType]KeyLoader{}}
+	for keyType, path := range map[KeyType]string{
+		SenderPrivateKey:    "sendBoxPrivate.pem",
+		SenderPublicKey:     "sendBoxPublic.pem",
+		RecipientPrivateKey: "boxPrivate.pem",
+		RecipientPublicKey:  "boxPublic.pem",
+	} {
+		data, err := (&FileLoader{Path: path}).GetBytes()
+		require.Nil(err)
+		loaders[keyType] = newCountingLoader(data)
+		config.Loaders[keyType] = loaders[keyType]
+	}
+
+	encrypter, err := config.LoadEncrypt()
+	require.Nil(err)
+	decrypter, err := config.LoadDecrypt()
+	require.Nil(err)
+	crypt, nonce, err := encrypter.EncryptMessage([]byte("hello"))
+	require.Nil(err)
+	message, err := decrypter.DecryptMessage(crypt, nonce)
+	require.Nil(err)
+	assert.Equal("hello", string(message))
+
+	for keyType, loader := range loaders {
+		assert.Equal(2, loader.count(), keyType)
+	}
+	assert.Nil(config.loadedKeys)
+
+	// the loaded copies are wiped, and the loaders' own bytes kept
+	loaded, err := config.loadKeyPairs(context.Background())
+	require.Nil(err)
+	data := loaded.loadedKeys[RecipientPrivateKey]
+	require.NotEmpty(data)
+	loaded.wipeLoadedKeys()
+	assert.Equal(make([]byte, len(data)), data)
+	assert.Nil(loaded.loadedKeys)
+	original, err := config.Loaders[RecipientPrivateKey].GetBytes()
+	require.Nil(err)
+	assert.Equal(len(data), len(original))
+	assert.NotEqual(data, original)
+}
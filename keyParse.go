@@ -0,0 +1,121 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"context"
+	"encoding/pem"
+	"errors"
+	"strings"
+)
+
+// KeyError is returned by the ciphers, signers and verifiers a Config loads
+// when one of its keys can't be read or parsed.  It names the key so the
+// entry of Config.Keys or Config.Loaders at fault can be found.
+type KeyError struct {
+	// KeyType is the key that failed.
+	KeyType KeyType
+
+	// Err is why it failed.
+	Err error
+}
+
+// Error names the key and says why it failed.
+func (e *KeyError) Error() string {
+	return "key " + string(e.KeyType) + ": " + e.Err.Error()
+}
+
+// Unwrap returns the reason the key failed.
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// configKeyLoader is the loader of a key of a Config.  It turns the errors
+// of the key into KeyErrors.
+type configKeyLoader struct {
+	keyType KeyType
+	loader  KeyLoader
+}
+
+// GetBytes returns the bytes of the key.
+func (l *configKeyLoader) GetBytes() ([]byte, error) {
+	return l.GetBytesContext(context.Background())
+}
+
+// GetBytesContext returns the bytes of the key, passing the context to the
+// loader.
+func (l *configKeyLoader) GetBytesContext(ctx context.Context) ([]byte, error) {
+	data, err := GetKeyBytes(ctx, l.loader)
+	if err != nil {
+		return nil, l.wrap(err)
+	}
+	return data, nil
+}
+
+func (l *configKeyLoader) wrap(err error) error {
+	var keyErr *KeyError
+	if errors.As(err, &keyErr) {
+		return err
+	}
+	return &KeyError{KeyType: l.keyType, Err: err}
+}
+
+// keyError makes err a KeyError if the loader is the loader of a key of a
+// Config.
+func keyError(loader KeyLoader, err error) error {
+	if l, ok := loader.(*configKeyLoader); ok && err != nil {
+		return l.wrap(err)
+	}
+	return err
+}
+
+// decodePEMBlock decodes the pem block of the key data, which must be one of
+// the types.  EC PARAMETERS blocks, which openssl writes in front of EC
+// keys, are skipped; anything else before or after the block is an error.
+func decodePEMBlock(data []byte, types ...string) (*pem.Block, error) {
+	rest := bytes.TrimSpace(data)
+	if len(rest) == 0 {
+		return nil, invalidKey("empty key")
+	}
+
+	var block *pem.Block
+	for {
+		if !bytes.HasPrefix(rest, []byte("-----BEGIN")) {
+			return nil, invalidKey("no pem block found")
+		}
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, invalidKey("failed to decode pem block")
+		}
+		rest = bytes.TrimSpace(rest)
+		if block.Type != "EC PARAMETERS" {
+			break
+		}
+	}
+	if len(rest) > 0 {
+		return nil, invalidKey("unexpected data after %s pem block", block.Type)
+	}
+
+	for _, t := range types {
+		if block.Type == t {
+			return block, nil
+		}
+	}
+	return nil, wrongKeyType("incorrect pem type %s, expected %s", block.Type, strings.Join(types, " or "))
+}
@@ -0,0 +1,192 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodePEMBlock(t *testing.T) {
+	key := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("key")})
+	params := pem.EncodeToMemory(&pem.Block{Type: "EC PARAMETERS", Bytes: []byte("params")})
+
+	testData := []struct {
+		description string
+		data        []byte
+		expectedErr error
+	}{
+		{"key", key, nil},
+		{"surrounding whitespace", append(append([]byte("\n  "), key...), "\n\n"...), nil},
+		{"ec parameters first", append(append([]byte{}, params...), key...), nil},
+		{"empty", []byte("  \n"), ErrInvalidKey},
+		{"not pem", []byte("not a key"), ErrInvalidKey},
+		{"truncated", key[:len(key)-10], ErrInvalidKey},
+		{"trailing data", append(append([]byte{}, key...), "garbage"...), ErrInvalidKey},
+		{"two keys", append(append([]byte{}, key...), key...), ErrInvalidKey},
+		{"only ec parameters", params, ErrInvalidKey},
+		{"wrong type", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("cert")}), ErrWrongKeyType},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			block, err := decodePEMBlock(tc.data, "PUBLIC KEY")
+			if tc.expectedErr != nil {
+				assert.True(errors.Is(err, tc.expectedErr), "%v", err)
+				assert.Nil(block)
+				return
+			}
+			if assert.Nil(err) {
+				assert.Equal([]byte("key"), block.Bytes)
+			}
+		})
+	}
+}
+
+func TestRSAKeyFormats(t *testing.T) {
+	privateKey, err := GenerateRSAKey(0)
+	require.Nil(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.Nil(t, err)
+	pkix, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.Nil(t, err)
+	ecLoaders := ecdsaKeyLoaders(t, elliptic.P256())
+
+	encode := func(pemType string, data []byte) KeyLoader {
+		return &BytesLoader{Data: pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: data})}
+	}
+
+	testData := []struct {
+		description string
+		loader      KeyLoader
+		private     bool
+		expectedErr error
+	}{
+		{"pkcs1 private", encode("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(privateKey)), true, nil},
+		{"pkcs8 private", encode("PRIVATE KEY", pkcs8), true, nil},
+		{"pkcs1 public", encode("RSA PUBLIC KEY", x509.MarshalPKCS1PublicKey(&privateKey.PublicKey)), false, nil},
+		{"pkix public", encode("PUBLIC KEY", pkix), false, nil},
+		{"not pem", &BytesLoader{Data: []byte("not a key")}, true, ErrInvalidKey},
+		{"empty", &BytesLoader{}, false, ErrInvalidKey},
+		{"corrupt pkcs1", encode("RSA PRIVATE KEY", []byte("corrupt")), true, ErrInvalidKey},
+		{"public as private", encode("RSA PUBLIC KEY", x509.MarshalPKCS1PublicKey(&privateKey.PublicKey)), true, ErrWrongKeyType},
+		{"ec private", ecLoaders[PrivateKey], true, ErrWrongKeyType},
+		{"ec public", ecLoaders[PublicKey], false, ErrWrongKeyType},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			if tc.private {
+				key, err := GetPrivateKey(tc.loader)
+				if tc.expectedErr == nil && assert.Nil(err) {
+					assert.Equal(privateKey.D, key.D)
+				}
+				if tc.expectedErr != nil {
+					assert.True(errors.Is(err, tc.expectedErr), "%v", err)
+				}
+				return
+			}
+
+			key, err := GetPublicKey(tc.loader)
+			if tc.expectedErr == nil && assert.Nil(err) {
+				assert.Equal(&privateKey.PublicKey, key)
+			}
+			if tc.expectedErr != nil {
+				assert.True(errors.Is(err, tc.expectedErr), "%v", err)
+			}
+		})
+	}
+}
+
+func TestConfigKeyErrors(t *testing.T) {
+	dir := t.TempDir()
+	garbage := filepath.Join(dir, "garbage.pem")
+	require.Nil(t, os.WriteFile(garbage, []byte("garbage"), 0600))
+
+	testData := []struct {
+		description string
+		config      Config
+		encrypt     bool
+		keyType     KeyType
+		expectedErr error
+	}{
+		{"rsa private key not pem", Config{
+			Type:   RSASymmetric,
+			Params: map[string]string{"hash": "SHA512"},
+			Keys:   map[KeyType]string{PrivateKey: garbage},
+		}, false, PrivateKey, ErrInvalidKey},
+		{"rsa public key missing", Config{
+			Type:   RSASymmetric,
+			Params: map[string]string{"hash": "SHA512"},
+			Keys:   map[KeyType]string{PublicKey: filepath.Join(dir, "missing.pem")},
+		}, true, PublicKey, ErrKeyNotFound},
+		{"box recipient key wrong type", Config{
+			Type: Box,
+			Keys: map[KeyType]string{
+				SenderPrivateKey:   "sendBoxPrivate.pem",
+				RecipientPublicKey: "public.pem",
+			},
+		}, true, RecipientPublicKey, ErrWrongKeyType},
+		{"box sender key from loader", Config{
+			Type: Box,
+			Keys: map[KeyType]string{RecipientPrivateKey: "boxPrivate.pem"},
+			Loaders: map[KeyType]KeyLoader{
+				SenderPublicKey: &BytesLoader{Data: []byte("short")},
+			},
+		}, false, SenderPublicKey, ErrInvalidKey},
+		{"ed25519 key not pem", Config{
+			Type: Ed25519Sign,
+			Keys: map[KeyType]string{PublicKey: garbage},
+		}, true, PublicKey, ErrInvalidKey},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var err error
+			switch {
+			case tc.config.Type == Ed25519Sign:
+				_, err = tc.config.LoadVerify()
+			case tc.encrypt:
+				_, err = tc.config.LoadEncrypt()
+			default:
+				_, err = tc.config.LoadDecrypt()
+			}
+
+			var keyErr *KeyError
+			if assert.True(errors.As(err, &keyErr), "%v", err) {
+				assert.Equal(tc.keyType, keyErr.KeyType)
+				assert.Contains(err.Error(), string(tc.keyType))
+			}
+			assert.True(errors.Is(err, tc.expectedErr), "%v", err)
+		})
+	}
+}
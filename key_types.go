@@ -17,6 +17,11 @@
 
 package voynicrypto
 
+import (
+	"fmt"
+	"strings"
+)
+
 // KeyType is an enum for how the key can be used.
 type KeyType string
 
@@ -29,14 +34,47 @@ const (
 	RecipientPublicKey  KeyType = "recipientPublicKey"
 )
 
-func hasBothEncryptKeys(data map[KeyType]string) bool {
-	_, privateOK := data[SenderPrivateKey]
-	_, publicOK := data[RecipientPublicKey]
-	return privateOK && publicOK
+var keyTypes = []KeyType{PublicKey, PrivateKey, SenderPrivateKey, SenderPublicKey, RecipientPrivateKey, RecipientPublicKey}
+
+// ParseKeyType returns the KeyType matching keyType regardless of case,
+// dashes and underscores, so senderPrivateKey, SenderPrivateKey and
+// sender_private_key are all the same key.
+func ParseKeyType(keyType string) (KeyType, bool) {
+	name := normalizeName(keyType)
+	for _, kt := range keyTypes {
+		if normalizeName(string(kt)) == name {
+			return kt, true
+		}
+	}
+	return KeyType(strings.TrimSpace(keyType)), false
+}
+
+// String returns the key type name, as used in configuration files.
+func (k KeyType) String() string {
+	return string(k)
+}
+
+// MarshalText returns the key type name.
+func (k KeyType) MarshalText() ([]byte, error) {
+	return []byte(k), nil
+}
+
+// UnmarshalText sets the key type using ParseKeyType.  Unknown key types are
+// kept as written so custom algorithms can use their own, but they must be
+// made of letters, digits, dashes, underscores and dots.
+func (k *KeyType) UnmarshalText(text []byte) error {
+	keyType, ok := ParseKeyType(string(text))
+	if !ok && !validName(string(keyType)) {
+		return fmt.Errorf("invalid key type %q", string(text))
+	}
+	*k = keyType
+	return nil
+}
+
+func hasBothEncryptKeys(config *Config) bool {
+	return config.hasKey(SenderPrivateKey) && config.hasKey(RecipientPublicKey)
 }
 
-func hasBothDecryptKeys(data map[KeyType]string) bool {
-	_, privateOK := data[RecipientPrivateKey]
-	_, publicOK := data[SenderPublicKey]
-	return privateOK && publicOK
+func hasBothDecryptKeys(config *Config) bool {
+	return config.hasKey(RecipientPrivateKey) && config.hasKey(SenderPublicKey)
 }
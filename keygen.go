@@ -0,0 +1,333 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// KeyPairType is the kind of key pair GenerateKeyPairFiles and
+// EnsureKeyPairFiles write.
+type KeyPairType string
+
+const (
+	// RSAKeyPair is written as PKCS#1 PEM, which GetPrivateKey and
+	// GetPublicKey read.
+	RSAKeyPair KeyPairType = "rsa"
+
+	// BoxKeyPair is written as box PEM, which ParseBoxPrivateKey and
+	// ParseBoxPublicKey read.
+	BoxKeyPair KeyPairType = "box"
+
+	// Ed25519KeyPair is written as PKCS#8 and PKIX PEM, which
+	// ParseEd25519PrivateKey and ParseEd25519PublicKey read.
+	Ed25519KeyPair KeyPairType = "ed25519"
+)
+
+// DefaultGeneratedRSABits is the size of generated RSA keys when none is given.
+const DefaultGeneratedRSABits = 2048
+
+// DefaultMinGeneratedRSABits is the smallest RSA key GenerateRSAKey makes
+// unless SetMinGeneratedRSABits changes it.
+const DefaultMinGeneratedRSABits = 2048
+
+var minGeneratedRSABits int32 = DefaultMinGeneratedRSABits
+
+// SetMinGeneratedRSABits sets the smallest RSA key GenerateRSAKey and the
+// key file generation make.  Zero or less restores
+// DefaultMinGeneratedRSABits.
+func SetMinGeneratedRSABits(bits int) {
+	if bits <= 0 {
+		bits = DefaultMinGeneratedRSABits
+	}
+	atomic.StoreInt32(&minGeneratedRSABits, int32(bits))
+}
+
+// MinGeneratedRSABits returns the smallest RSA key GenerateRSAKey makes.
+func MinGeneratedRSABits() int {
+	return int(atomic.LoadInt32(&minGeneratedRSABits))
+}
+
+// GenerateRSAKey generates an RSA private key of the size given.  If bits is
+// zero DefaultGeneratedRSABits is used.  Sizes below MinGeneratedRSABits are
+// refused.
+func GenerateRSAKey(bits int) (*rsa.PrivateKey, error) {
+	if bits == 0 {
+		bits = DefaultGeneratedRSABits
+	}
+	if min := MinGeneratedRSABits(); bits < min {
+		return nil, errors.New("rsa key of " + strconv.Itoa(bits) + " bits is too small, at least " +
+			strconv.Itoa(min) + " bits are required")
+	}
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate rsa key: %w", err)
+	}
+	return privateKey, nil
+}
+
+// GenerateBoxKey generates a box private key.  Its public key is returned too.
+func GenerateBoxKey() (privateKey, publicKey [BoxKeySize]byte, err error) {
+	public, private, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return privateKey, publicKey, fmt.Errorf("failed to generate box key: %w", err)
+	}
+	return *private, *public, nil
+}
+
+// GenerateEd25519Key generates an Ed25519 private key.
+func GenerateEd25519Key() (ed25519.PrivateKey, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ed25519 key: %w", err)
+	}
+	return privateKey, nil
+}
+
+// GenerateECKey generates an EC private key on the curve.  If curve is nil
+// P-256 is used.
+func GenerateECKey(curve elliptic.Curve) (*ecdsa.PrivateKey, error) {
+	if curve == nil {
+		curve = elliptic.P256()
+	}
+	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ec key: %w", err)
+	}
+	return privateKey, nil
+}
+
+// GenerateKeyPairFiles generates a new key pair and writes it to the paths.
+// The private key is only readable by the owner.  Existing files are never
+// overwritten.  bits is only used for RSA keys; if it's zero
+// DefaultGeneratedRSABits is used.
+func GenerateKeyPairFiles(kind KeyPairType, privatePath, publicPath string, bits int) error {
+	if privatePath == "" {
+		return errors.New("no private key path")
+	}
+
+	privateData, err := generatePrivateKeyPEM(kind, bits)
+	if err != nil {
+		return err
+	}
+	if err = writeNewFile(privatePath, privateData, 0600); err != nil {
+		return err
+	}
+	if publicPath == "" {
+		return nil
+	}
+	return writePublicKeyFile(kind, privateData, publicPath)
+}
+
+// EnsureKeyPairFiles bootstraps a key pair that isn't on disk yet.  When the
+// private key file doesn't exist a new pair is generated; when only the
+// public key file is missing it is written from the private key.  It returns
+// true if any file was written.  A public key without its private key is an
+// error, since a new private key would never match it.  Either path may be
+// empty if that half of the pair isn't wanted.
+func EnsureKeyPairFiles(kind KeyPairType, privatePath, publicPath string, bits int) (bool, error) {
+	if privatePath == "" {
+		return false, nil
+	}
+
+	privateExists, err := fileExists(privatePath)
+	if err != nil {
+		return false, err
+	}
+	publicExists := true
+	if publicPath != "" {
+		if publicExists, err = fileExists(publicPath); err != nil {
+			return false, err
+		}
+	}
+
+	switch {
+	case !privateExists && publicPath != "" && publicExists:
+		return false, errors.New("public key " + publicPath + " exists without private key " + privatePath)
+	case !privateExists:
+		return true, GenerateKeyPairFiles(kind, privatePath, publicPath, bits)
+	case !publicExists:
+		privateData, err := (&FileLoader{Path: privatePath}).GetBytes()
+		if err != nil {
+			return false, err
+		}
+		return true, writePublicKeyFile(kind, privateData, publicPath)
+	}
+	return false, nil
+}
+
+// keyPairs returns the private and public key of each pair the algorithm
+// uses.
+func keyPairs(alg AlgorithmType) (KeyPairType, [][2]KeyType) {
+	switch alg {
+	case RSASymmetric:
+		return RSAKeyPair, [][2]KeyType{{PrivateKey, PublicKey}}
+	case RSAAsymmetric:
+		return RSAKeyPair, [][2]KeyType{{SenderPrivateKey, SenderPublicKey}, {RecipientPrivateKey, RecipientPublicKey}}
+	case Box:
+		return BoxKeyPair, [][2]KeyType{{SenderPrivateKey, SenderPublicKey}, {RecipientPrivateKey, RecipientPublicKey}}
+	case BoxEphemeral:
+		return BoxKeyPair, [][2]KeyType{{RecipientPrivateKey, RecipientPublicKey}}
+	case RSAPSS:
+		return RSAKeyPair, [][2]KeyType{{PrivateKey, PublicKey}}
+	case Ed25519Sign:
+		return Ed25519KeyPair, [][2]KeyType{{PrivateKey, PublicKey}}
+	}
+	return "", nil
+}
+
+// generateMissingKeys runs EnsureKeyPairFiles for each key pair of the
+// config's algorithm.  Keys with a loader in Loaders are left alone.
+func (config *Config) generateMissingKeys() error {
+	kind, pairs := keyPairs(config.Type)
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	bits := 0
+	if config.Params["bits"] != "" {
+		var err error
+		if bits, err = strconv.Atoi(config.Params["bits"]); err != nil {
+			return fmt.Errorf("invalid bits param: %w", err)
+		}
+	}
+
+	path := func(keyType KeyType) string {
+		if config.Loaders[keyType] != nil {
+			return ""
+		}
+		return config.Keys[keyType]
+	}
+
+	for _, pair := range pairs {
+		generated, err := EnsureKeyPairFiles(kind, path(pair[0]), path(pair[1]), bits)
+		if err != nil {
+			return fmt.Errorf("failed to generate %s: %w", string(pair[0]), err)
+		}
+		if generated {
+			logWarn(config.Logger, "generated missing keys",
+				"private", path(pair[0]), "public", path(pair[1]))
+		}
+	}
+	return nil
+}
+
+func generatePrivateKeyPEM(kind KeyPairType, bits int) ([]byte, error) {
+	switch kind {
+	case RSAKeyPair:
+		privateKey, err := GenerateRSAKey(bits)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}), nil
+	case BoxKeyPair:
+		privateKey, _, err := GenerateBoxKey()
+		if err != nil {
+			return nil, err
+		}
+		return EncodeBoxPrivateKeyPEM(privateKey), nil
+	case Ed25519KeyPair:
+		privateKey, err := GenerateEd25519Key()
+		if err != nil {
+			return nil, err
+		}
+		data, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: data}), nil
+	}
+	return nil, errors.New("unknown key pair type " + string(kind))
+}
+
+// writePublicKeyFile writes the public half of the PEM encoded private key.
+func writePublicKeyFile(kind KeyPairType, privateData []byte, publicPath string) error {
+	var publicData []byte
+	switch kind {
+	case RSAKeyPair:
+		privateKey, err := GetPrivateKey(&BytesLoader{Data: privateData})
+		if err != nil {
+			return err
+		}
+		publicData = pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&privateKey.PublicKey)})
+	case BoxKeyPair:
+		privateKey, err := ParseBoxPrivateKey(privateData)
+		if err != nil {
+			return err
+		}
+		var publicKey [BoxKeySize]byte
+		curve25519.ScalarBaseMult(&publicKey, &privateKey)
+		publicData = EncodeBoxPublicKeyPEM(publicKey)
+	case Ed25519KeyPair:
+		privateKey, err := ParseEd25519PrivateKey(privateData)
+		if err != nil {
+			return err
+		}
+		data, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+		if err != nil {
+			return err
+		}
+		publicData = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: data})
+	default:
+		return errors.New("unknown key pair type " + string(kind))
+	}
+	return writeNewFile(publicPath, publicData, 0644)
+}
+
+// writeNewFile writes a file that must not already exist, creating its
+// directory if needed.
+func writeNewFile(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func fileExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
@@ -0,0 +1,225 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/elliptic"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnsureKeyPairFiles(t *testing.T) {
+	testData := []struct {
+		kind  KeyPairType
+		parse func(t *testing.T, private, public []byte)
+	}{
+		{RSAKeyPair, func(t *testing.T, private, public []byte) {
+			privateKey, err := GetPrivateKey(&BytesLoader{Data: private})
+			require.Nil(t, err)
+			publicKey, err := GetPublicKey(&BytesLoader{Data: public})
+			require.Nil(t, err)
+			assert.Equal(t, &privateKey.PublicKey, publicKey)
+		}},
+		{BoxKeyPair, func(t *testing.T, private, public []byte) {
+			_, err := ParseBoxPrivateKey(private)
+			require.Nil(t, err)
+			_, err = ParseBoxPublicKey(public)
+			require.Nil(t, err)
+		}},
+		{Ed25519KeyPair, func(t *testing.T, private, public []byte) {
+			privateKey, err := ParseEd25519PrivateKey(private)
+			require.Nil(t, err)
+			publicKey, err := ParseEd25519PublicKey(public)
+			require.Nil(t, err)
+			assert.Equal(t, privateKey.Public(), publicKey)
+		}},
+	}
+
+	SetMinGeneratedRSABits(1024)
+	defer SetMinGeneratedRSABits(0)
+
+	for _, tc := range testData {
+		t.Run(string(tc.kind), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			dir := t.TempDir()
+			privatePath := filepath.Join(dir, "keys", "private.pem")
+			publicPath := filepath.Join(dir, "keys", "public.pem")
+
+			generated, err := EnsureKeyPairFiles(tc.kind, privatePath, publicPath, 1024)
+			require.Nil(err)
+			assert.True(generated)
+
+			info, err := os.Stat(privatePath)
+			require.Nil(err)
+			assert.Equal(os.FileMode(0600), info.Mode().Perm())
+
+			private, err := os.ReadFile(privatePath)
+			require.Nil(err)
+			public, err := os.ReadFile(publicPath)
+			require.Nil(err)
+			tc.parse(t, private, public)
+
+			// nothing to do once the keys exist
+			generated, err = EnsureKeyPairFiles(tc.kind, privatePath, publicPath, 1024)
+			require.Nil(err)
+			assert.False(generated)
+
+			// a lost public key is rebuilt from the private key
+			require.Nil(os.Remove(publicPath))
+			generated, err = EnsureKeyPairFiles(tc.kind, privatePath, publicPath, 1024)
+			require.Nil(err)
+			assert.True(generated)
+			rebuilt, err := os.ReadFile(publicPath)
+			require.Nil(err)
+			assert.Equal(public, rebuilt)
+
+			// a public key without its private key can't be fixed
+			require.Nil(os.Remove(privatePath))
+			_, err = EnsureKeyPairFiles(tc.kind, privatePath, publicPath, 1024)
+			assert.NotNil(err)
+
+			// existing files are never overwritten
+			assert.NotNil(GenerateKeyPairFiles(tc.kind, publicPath, "", 1024))
+		})
+	}
+
+	_, err := EnsureKeyPairFiles("dsa", filepath.Join(t.TempDir(), "private.pem"), "", 0)
+	assert.NotNil(t, err)
+}
+
+func TestGenerateMissingKeys(t *testing.T) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	path := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+
+	testOptions(t, Config{
+		Type:                Box,
+		GenerateMissingKeys: true,
+		Keys: map[KeyType]string{
+			SenderPrivateKey:    path("sendBoxPrivate.pem"),
+			SenderPublicKey:     path("sendBoxPublic.pem"),
+			RecipientPrivateKey: path("boxPrivate.pem"),
+			RecipientPublicKey:  path("boxPublic.pem"),
+		},
+	}, false)
+
+	testOptions(t, Config{
+		Type:                RSASymmetric,
+		GenerateMissingKeys: true,
+		Params:              map[string]string{"hash": "SHA512", "bits": "2048"},
+		Keys: map[KeyType]string{
+			PrivateKey: path("private.pem"),
+			PublicKey:  path("public.pem"),
+		},
+	}, true)
+
+	// without the option nothing is generated
+	_, err := (&Config{
+		Type: RSASymmetric,
+		Keys: map[KeyType]string{PrivateKey: path("other.pem")},
+	}).LoadDecrypt()
+	require.NotNil(err)
+	_, err = os.Stat(path("other.pem"))
+	require.True(os.IsNotExist(err))
+
+	_, err = (&Config{
+		Type:                RSASymmetric,
+		GenerateMissingKeys: true,
+		Params:              map[string]string{"bits": "many"},
+		Keys:                map[KeyType]string{PrivateKey: path("other.pem")},
+	}).LoadDecrypt()
+	require.NotNil(err)
+}
+
+func TestGenerateRSAKey(t *testing.T) {
+	testData := []struct {
+		description string
+		bits        int
+		min         int
+		expectedErr bool
+	}{
+		{"default size", 0, 0, false},
+		{"too small", 1024, 0, true},
+		{"absurdly small", 64, 0, true},
+		{"lowered minimum", 1024, 1024, false},
+		{"raised minimum", 2048, 3072, true},
+	}
+
+	defer SetMinGeneratedRSABits(0)
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			SetMinGeneratedRSABits(tc.min)
+			privateKey, err := GenerateRSAKey(tc.bits)
+			if tc.expectedErr {
+				assert.NotNil(err)
+				assert.Nil(privateKey)
+				return
+			}
+			if assert.Nil(err) {
+				expected := tc.bits
+				if expected == 0 {
+					expected = DefaultGeneratedRSABits
+				}
+				assert.Equal(expected, privateKey.N.BitLen())
+			}
+		})
+	}
+
+	SetMinGeneratedRSABits(0)
+	assert.Equal(t, DefaultMinGeneratedRSABits, MinGeneratedRSABits())
+	assert.NotNil(t, GenerateKeyPairFiles(RSAKeyPair, filepath.Join(t.TempDir(), "private.pem"), "", 1024))
+}
+
+func TestGenerateKeys(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	privateKey, publicKey, err := GenerateBoxKey()
+	require.Nil(err)
+	assert.NotEqual([BoxKeySize]byte{}, privateKey)
+	encrypter := NewBoxEncrypter(privateKey, publicKey, "")
+	decrypter := NewBoxDecrypter(privateKey, publicKey, "")
+	cipher, nonce, err := encrypter.EncryptMessage([]byte("hello"))
+	require.Nil(err)
+	message, err := decrypter.DecryptMessage(cipher, nonce)
+	require.Nil(err)
+	assert.Equal([]byte("hello"), message)
+
+	edKey, err := GenerateEd25519Key()
+	require.Nil(err)
+	assert.Len(edKey, 64)
+
+	ecKey, err := GenerateECKey(nil)
+	require.Nil(err)
+	assert.Equal(elliptic.P256(), ecKey.Curve)
+
+	ecKey, err = GenerateECKey(elliptic.P384())
+	require.Nil(err)
+	assert.Equal(elliptic.P384(), ecKey.Curve)
+}
@@ -0,0 +1,143 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// KIDDerivation is how a KID is derived from a public key.
+type KIDDerivation string
+
+const (
+	// JWKThumbprintKID derives the KID from the RFC 7638 JWK thumbprint of
+	// the key.
+	JWKThumbprintKID KIDDerivation = "jwk"
+
+	// SPKIThumbprintKID derives the KID from the SHA-256 of the PKIX
+	// (SubjectPublicKeyInfo) encoding of the key.
+	SPKIThumbprintKID KIDDerivation = "spki"
+)
+
+// KIDFromPublicKey derives a KID from the public key.  The key may be any
+// key KeyInfo returns.  The KID is the unpadded base64url encoded thumbprint.
+func KIDFromPublicKey(derivation KIDDerivation, key crypto.PublicKey) (string, error) {
+	var (
+		thumbprint []byte
+		err        error
+	)
+	switch derivation {
+	case JWKThumbprintKID:
+		thumbprint, err = JWKThumbprint(key)
+	case SPKIThumbprintKID:
+		thumbprint, err = SPKIThumbprint(key)
+	default:
+		return "", errors.New("unknown kid derivation " + string(derivation))
+	}
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(thumbprint), nil
+}
+
+// JWKThumbprint returns the RFC 7638 SHA-256 thumbprint of the public key.
+// Box keys are treated as X25519 OKP keys (RFC 8037).
+func JWKThumbprint(key crypto.PublicKey) ([]byte, error) {
+	b64 := base64.RawURLEncoding.EncodeToString
+
+	// the members are required to be in lexicographic order, with no
+	// whitespace
+	var jwk string
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		jwk = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, b64(big.NewInt(int64(k.E)).Bytes()), b64(k.N.Bytes()))
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		jwk = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`,
+			k.Curve.Params().Name, b64(k.X.FillBytes(make([]byte, size))), b64(k.Y.FillBytes(make([]byte, size))))
+	case ed25519.PublicKey:
+		jwk = fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, b64(k))
+	case [BoxKeySize]byte:
+		jwk = fmt.Sprintf(`{"crv":"X25519","kty":"OKP","x":"%s"}`, b64(k[:]))
+	default:
+		return nil, wrongKeyType("can't make a jwk thumbprint of a %T", key)
+	}
+	sum := sha256.Sum256([]byte(jwk))
+	return sum[:], nil
+}
+
+// SPKIThumbprint returns the SHA-256 of the PKIX encoding of the public key.
+// Box keys are encoded as X25519 keys.
+func SPKIThumbprint(key crypto.PublicKey) ([]byte, error) {
+	if k, ok := key.([BoxKeySize]byte); ok {
+		x25519, err := ecdh.X25519().NewPublicKey(k[:])
+		if err != nil {
+			return nil, err
+		}
+		key = x25519
+	}
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, wrongKeyType("can't make a spki thumbprint: %s", err)
+	}
+	sum := sha256.Sum256(der)
+	return sum[:], nil
+}
+
+// kidSetter is implemented by the ciphers whose KID can be derived.
+type kidSetter interface {
+	setKID(kid string)
+}
+
+// deriveKID gives the cipher a KID derived from its public key when the
+// config asks for one and doesn't name a KID itself.
+func (config *Config) deriveKID(cipher Identification) error {
+	if config.KID != "" || config.DeriveKID == "" {
+		return nil
+	}
+	info, ok := cipher.(KeyInfo)
+	setter, settable := cipher.(kidSetter)
+	if !ok || !settable {
+		return errors.New("can't derive a kid for algorithm " + string(config.Type))
+	}
+	kid, err := KIDFromPublicKey(config.DeriveKID, info.PublicKey())
+	if err != nil {
+		return fmt.Errorf("failed to derive kid: %w", err)
+	}
+	setter.setKID(kid)
+	return nil
+}
+
+func (c *rsaEncrypterDecrypter) setKID(kid string) { c.kid = kid }
+func (enBox *encryptBox) setKID(kid string)        { enBox.kid = kid }
+func (deBox *decryptBox) setKID(kid string)        { deBox.kid = kid }
+func (e *encryptEphemeralBox) setKID(kid string)   { e.kid = kid }
+func (d *decryptEphemeralBox) setKID(kid string)   { d.kid = kid }
+func (s *ed25519Signer) setKID(kid string)         { s.kid = kid }
+func (s *rsaPSSSigner) setKID(kid string)          { s.kid = kid }
+func (s *ecdsaSigner) setKID(kid string)           { s.kid = kid }
@@ -0,0 +1,115 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWKThumbprint(t *testing.T) {
+	require := require.New(t)
+
+	// the examples from RFC 7638 section 3.1 and RFC 8037 appendix A.3
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	require.Nil(err)
+	x, err := base64.RawURLEncoding.DecodeString("11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")
+	require.Nil(err)
+
+	testData := []struct {
+		description string
+		key         crypto.PublicKey
+		expected    string
+	}{
+		{"rsa", &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"},
+		{"ed25519", ed25519.PublicKey(x), "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			kid, err := KIDFromPublicKey(JWKThumbprintKID, tc.key)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, kid)
+		})
+	}
+}
+
+func TestKIDFromPublicKey(t *testing.T) {
+	require := require.New(t)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(err)
+	edPublicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(err)
+	boxPublicKey, _, err := GenerateBoxKeyPair()
+	require.Nil(err)
+
+	keys := []crypto.PublicKey{&GeneratePrivateKey(1024).PublicKey, &ecKey.PublicKey, edPublicKey, *boxPublicKey}
+	for _, derivation := range []KIDDerivation{JWKThumbprintKID, SPKIThumbprintKID} {
+		for _, key := range keys {
+			kid, err := KIDFromPublicKey(derivation, key)
+			if assert.Nil(t, err, "%s %T", derivation, key) {
+				assert.Len(t, kid, 43)
+			}
+		}
+		_, err := KIDFromPublicKey(derivation, "not a key")
+		assert.ErrorIs(t, err, ErrWrongKeyType)
+	}
+	_, err = KIDFromPublicKey("md5", edPublicKey)
+	assert.NotNil(t, err)
+}
+
+func TestConfigDeriveKID(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	config := boxConfig(t, "")
+	config.DeriveKID = JWKThumbprintKID
+	require.Nil(config.Validate())
+	encrypter, err := config.LoadEncrypt()
+	require.Nil(err)
+	decrypter, err := config.LoadDecrypt()
+	require.Nil(err)
+	assert.Len(encrypter.GetKID(), 43)
+	assert.Equal(encrypter.GetKID(), decrypter.GetKID(), "both sides derive the kid from the recipient's key")
+
+	config.DeriveKID = SPKIThumbprintKID
+	encrypter, err = config.LoadEncrypt()
+	require.Nil(err)
+	assert.Len(encrypter.GetKID(), 43)
+	assert.NotEqual(decrypter.GetKID(), encrypter.GetKID())
+
+	config.KID = "named"
+	encrypter, err = config.LoadEncrypt()
+	require.Nil(err)
+	assert.Equal("named", encrypter.GetKID(), "a kid in the config wins")
+
+	_, err = (&Config{Type: None, DeriveKID: JWKThumbprintKID}).LoadEncrypt()
+	assert.NotNil(err, "noop has no key")
+	assert.NotNil((&Config{Type: None, DeriveKID: "md5"}).Validate())
+}
@@ -0,0 +1,194 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"golang.org/x/time/rate"
+)
+
+// LimitOptions configures LimitedDecrypt.
+type LimitOptions struct {
+	// MaxConcurrent is the most decryptions run at once.  Zero means no
+	// limit.
+	MaxConcurrent int
+
+	// RatePerSecond is how many decryptions start each second on average.
+	// Zero means no limit.
+	RatePerSecond float64
+
+	// Burst is how many decryptions can start at once when the rate allows.
+	// If not supplied, the rate rounded up is used instead.
+	Burst int
+
+	// QueueTimeout is how long a decryption waits for its turn before it's
+	// rejected with ErrLimitExceeded.  Zero means it waits as long as its
+	// context allows, which for the methods without a context is forever.
+	QueueTimeout time.Duration
+
+	// Metrics, if set, records the backpressure.
+	Metrics *LimitMetrics
+}
+
+// LimitMetrics are the go-kit metrics LimitedDecrypt records, labeled by
+// algorithm and kid.  Any of them may be nil.
+type LimitMetrics struct {
+	// Waiting is the number of decryptions waiting for their turn.
+	Waiting metrics.Gauge
+
+	// WaitDuration observes how many seconds each decryption waited.
+	WaitDuration metrics.Histogram
+
+	// Rejected counts decryptions that gave up waiting.
+	Rejected metrics.Counter
+}
+
+// LimitedDecrypt returns a Decrypt that bounds how many decryptions the
+// decrypter runs at once, with a semaphore, and how many it starts each
+// second, with a token bucket.  Calls over the limits wait their turn, and
+// fail with ErrLimitExceeded if the queue timeout or their context runs out
+// first.  It protects decrypters backed by a KMS or HSM from bursts of
+// traffic.
+func LimitedDecrypt(decrypter Decrypt, options LimitOptions) Decrypt {
+	d := &limitedDecrypter{decrypter: decrypter, options: options}
+	if options.MaxConcurrent > 0 {
+		d.slots = make(chan struct{}, options.MaxConcurrent)
+	}
+	if options.RatePerSecond > 0 {
+		burst := options.Burst
+		if burst <= 0 {
+			burst = int(math.Ceil(options.RatePerSecond))
+		}
+		d.limiter = rate.NewLimiter(rate.Limit(options.RatePerSecond), burst)
+	}
+	return d
+}
+
+type limitedDecrypter struct {
+	decrypter Decrypt
+	options   LimitOptions
+	slots     chan struct{}
+	limiter   *rate.Limiter
+}
+
+func (d *limitedDecrypter) labels() []string {
+	return []string{AlgorithmLabel, string(d.decrypter.GetAlgorithm()), KIDLabel, d.decrypter.GetKID()}
+}
+
+// acquire waits for a turn, returning the function that ends it.
+func (d *limitedDecrypter) acquire(ctx context.Context) (func(), error) {
+	if d.slots == nil && d.limiter == nil {
+		return func() {}, nil
+	}
+	if d.options.QueueTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.options.QueueTimeout)
+		defer cancel()
+	}
+
+	m := d.options.Metrics
+	if m != nil && m.Waiting != nil {
+		m.Waiting.With(d.labels()...).Add(1)
+		defer m.Waiting.With(d.labels()...).Add(-1)
+	}
+	start := time.Now()
+	err := d.wait(ctx)
+	if m != nil && m.WaitDuration != nil {
+		m.WaitDuration.With(d.labels()...).Observe(time.Since(start).Seconds())
+	}
+	if err != nil {
+		if m != nil && m.Rejected != nil {
+			m.Rejected.With(d.labels()...).Add(1)
+		}
+		return nil, fmt.Errorf("%w: %w", ErrLimitExceeded, err)
+	}
+
+	if d.slots == nil {
+		return func() {}, nil
+	}
+	return func() { <-d.slots }, nil
+}
+
+func (d *limitedDecrypter) wait(ctx context.Context) error {
+	if d.limiter != nil {
+		if err := d.limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if d.slots != nil {
+		select {
+		case d.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// GetAlgorithm returns the algorithm of the decrypter.
+func (d *limitedDecrypter) GetAlgorithm() AlgorithmType {
+	return d.decrypter.GetAlgorithm()
+}
+
+// GetKID returns the KID of the decrypter.
+func (d *limitedDecrypter) GetKID() string {
+	return d.decrypter.GetKID()
+}
+
+// DecryptMessage decrypts the message when its turn comes.
+func (d *limitedDecrypter) DecryptMessage(cipher []byte, nonce []byte) ([]byte, error) {
+	return d.DecryptMessageContext(context.Background(), cipher, nonce)
+}
+
+// DecryptMessageContext decrypts the message when its turn comes, giving up
+// when the context is done.
+func (d *limitedDecrypter) DecryptMessageContext(ctx context.Context, cipher []byte, nonce []byte) ([]byte, error) {
+	release, err := d.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return DecryptMessageContext(ctx, d.decrypter, cipher, nonce)
+}
+
+// DecryptMessageWithAD decrypts the message with associated data when its
+// turn comes.
+func (d *limitedDecrypter) DecryptMessageWithAD(cipher []byte, nonce []byte, ad []byte) ([]byte, error) {
+	release, err := d.acquire(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return DecryptMessageWithAD(d.decrypter, cipher, nonce, ad)
+}
+
+// Metadata returns the metadata of the decrypter, if it has any.
+func (d *limitedDecrypter) Metadata() Metadata {
+	m, _ := GetMetadata(d.decrypter)
+	return m
+}
+
+// Close closes the decrypter.
+func (d *limitedDecrypter) Close() error {
+	return CloseCipher(d.decrypter)
+}
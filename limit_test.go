@@ -0,0 +1,132 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingDecrypter holds every decryption until it's released.
+type blockingDecrypter struct {
+	Decrypt
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingDecrypter) DecryptMessage(cipher []byte, nonce []byte) ([]byte, error) {
+	b.started <- struct{}{}
+	<-b.release
+	return b.Decrypt.DecryptMessage(cipher, nonce)
+}
+
+func TestLimitedDecryptConcurrency(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, aesDecrypter := aesGCMPair(t)
+	cipher, nonce, err := encrypter.EncryptMessage([]byte("message"))
+	require.Nil(err)
+
+	waiting, rejected := newTestMetric(), newTestMetric()
+	blocking := &blockingDecrypter{Decrypt: aesDecrypter, started: make(chan struct{}, 4), release: make(chan struct{})}
+	decrypter := LimitedDecrypt(blocking, LimitOptions{
+		MaxConcurrent: 2,
+		QueueTimeout:  20 * time.Millisecond,
+		Metrics:       &LimitMetrics{Waiting: testGauge{waiting}, Rejected: rejected},
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			message, err := decrypter.DecryptMessage(cipher, nonce)
+			assert.Nil(err)
+			assert.Equal("message", string(message))
+		}()
+	}
+	<-blocking.started
+	<-blocking.started
+
+	_, err = decrypter.DecryptMessage(cipher, nonce)
+	assert.True(errors.Is(err, ErrLimitExceeded))
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(ReasonLimited, errorReason(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = DecryptMessageContext(ctx, decrypter, cipher, nonce)
+	assert.True(errors.Is(err, ErrLimitExceeded))
+
+	close(blocking.release)
+	wg.Wait()
+
+	labels := []string{AlgorithmLabel, string(AESGCM), KIDLabel, "k1"}
+	value, _ := rejected.get(labels...)
+	assert.Equal(2.0, value)
+	value, _ = waiting.get(labels...)
+	assert.Equal(0.0, value)
+
+	// slots are released after each decryption
+	for i := 0; i < 4; i++ {
+		_, err = decrypter.DecryptMessage(cipher, nonce)
+		require.Nil(err)
+	}
+}
+
+func TestLimitedDecryptRate(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, aesDecrypter := aesGCMPair(t)
+	cipher, nonce, err := EncryptMessageWithAD(encrypter, []byte("message"), []byte("ad"))
+	require.Nil(err)
+
+	decrypter := LimitedDecrypt(aesDecrypter, LimitOptions{
+		RatePerSecond: 1,
+		QueueTimeout:  10 * time.Millisecond,
+	})
+	message, err := DecryptMessageWithAD(decrypter, cipher, nonce, []byte("ad"))
+	require.Nil(err)
+	assert.Equal("message", string(message))
+	_, err = DecryptMessageWithAD(decrypter, cipher, nonce, []byte("ad"))
+	assert.True(errors.Is(err, ErrLimitExceeded))
+
+	decrypter = LimitedDecrypt(aesDecrypter, LimitOptions{RatePerSecond: 1000, Burst: 5})
+	for i := 0; i < 10; i++ {
+		_, err = DecryptMessageWithAD(decrypter, cipher, nonce, []byte("ad"))
+		require.Nil(err)
+	}
+
+	unlimited := LimitedDecrypt(aesDecrypter, LimitOptions{})
+	assert.Equal(AESGCM, unlimited.GetAlgorithm())
+	assert.Equal("k1", unlimited.GetKID())
+	metadata, ok := GetMetadata(unlimited)
+	assert.True(ok)
+	assert.True(metadata.Authenticated)
+	require.Nil(CloseCipher(unlimited))
+	_, err = DecryptMessageWithAD(unlimited, cipher, nonce, []byte("ad"))
+	assert.Equal(errCipherClosed, err)
+}
@@ -18,26 +18,31 @@
 package voynicrypto
 
 import (
+	"context"
 	"crypto"
 	"crypto/rsa"
 	"crypto/x509"
-	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
+	"sync"
 
-	"github.com/go-kit/kit/log"
-	"github.com/goph/emperror"
-	"github.com/pkg/errors"
-	"github.com/xmidt-org/webpa-common/logging"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
-	errIncorrectKeys = errors.New("incorrect keys provided")
+	errIncorrectKeys = fmt.Errorf("%w: incorrect keys provided", ErrKeyNotFound)
 )
 
 var (
+	hashLock      sync.RWMutex
 	hashFunctions = map[string]crypto.Hash{
 		"BLAKE2B512": crypto.BLAKE2b_512,
 		"SHA1":       crypto.SHA1,
+		"SHA256":     crypto.SHA256,
+		"SHA384":     crypto.SHA384,
 		"SHA512":     crypto.SHA512,
 		"MD5":        crypto.MD5,
 	}
@@ -45,9 +50,9 @@ var (
 
 // Config used load the Encrypt or Decrypt
 type Config struct {
-	// Logger is the go-kit Logger to use for server startup and error logging.  If not
-	// supplied, logging.DefaultLogger() is used instead.
-	Logger log.Logger `json:"-"`
+	// Logger is the Logger to use for server startup and error logging.  If not
+	// supplied, DefaultLogger() is used instead.
+	Logger Logger `json:"-"`
 
 	// Type is the algorithm type. Like none, box, rsa etc.
 	Type AlgorithmType `json:"type"`
@@ -55,12 +60,66 @@ type Config struct {
 	// KID is the key id of the cipher
 	KID string `json:"kid,omitempty"`
 
+	// DeriveKID derives the KID from the public key when KID is empty, so
+	// every service using the key agrees on it.
+	DeriveKID KIDDerivation `json:"deriveKID,omitempty"`
+
 	// Params to be provided to the algorithm type.
 	// For example providing a hash algorithm to rsa.
 	Params map[string]string `json:"params,omitempty"`
 
 	// Keys is a map of keys to path. aka senderPrivateKey : private.pem
 	Keys map[KeyType]string `json:"keys,omitempty"`
+
+	// Loaders overrides how a key is loaded.  When a KeyType is present here,
+	// its loader is used instead of reading the path in Keys.  For example a
+	// ChainLoader can try an environment variable before falling back to a file.
+	Loaders map[KeyType]KeyLoader `json:"-"`
+
+	// GenerateMissingKeys generates and saves a key pair when the files in
+	// Keys don't exist yet, so dev and test environments can bootstrap
+	// without a separate keygen step.  RSA keys are sized by the "bits"
+	// param.  It should not be used in production.
+	GenerateMissingKeys bool `json:"generateMissingKeys,omitempty"`
+
+	// Strict refuses weak hashes like MD5 and SHA1 and RSA keys smaller than
+	// MinStrictRSABits.  SetStrictMode turns it on for every config.
+	Strict bool `json:"strict,omitempty"`
+
+	// Passphrases are where to get the passphrase of each encrypted key in
+	// Keys.
+	Passphrases map[KeyType]PassphraseSource `json:"passphrases,omitempty"`
+
+	// Fallbacks are tried in order after this config.  LoadEncrypt uses the
+	// first config that loads, and LoadDecrypt returns a decrypter that tries
+	// every config that loads, so producers and consumers can move to a new
+	// algorithm or key at different times.
+	Fallbacks []Config `json:"fallbacks,omitempty"`
+
+	// Metrics records loads of this config.  If not supplied, nothing is
+	// recorded.
+	Metrics *LoaderMetrics `json:"-"`
+
+	// Tracer, if set, traces loads of this config in spans of the context
+	// given to LoadEncryptContext and LoadDecryptContext.
+	Tracer trace.Tracer `json:"-"`
+
+	// NonceSource is where AEAD encrypters like box get their nonces.  If not
+	// supplied, they are random.
+	NonceSource NonceSource `json:"-"`
+
+	// Random is the source of randomness for the ciphers and signers, in
+	// place of crypto/rand.  If not supplied, crypto/rand is used.
+	Random io.Reader `json:"-"`
+
+	// RSAPool, if set, runs the decryptions and signatures of the RSA
+	// ciphers and signers on its workers.
+	RSAPool *RSAPool `json:"-"`
+
+	// loadedKeys are the keys loadKeyPairs has already loaded, which
+	// keyLoader returns instead of loading them again.  They are only set on
+	// the copy of the config given to the factory, and wiped after.
+	loadedKeys map[KeyType][]byte
 }
 
 // KeyLoader gets the bytes for a key.
@@ -68,6 +127,28 @@ type KeyLoader interface {
 	GetBytes() ([]byte, error)
 }
 
+// ContextKeyLoader is a KeyLoader that honors cancellation and deadlines,
+// which matters for loaders that fetch keys from remote stores.
+type ContextKeyLoader interface {
+	KeyLoader
+	GetBytesContext(ctx context.Context) ([]byte, error)
+}
+
+// GetKeyBytes gets the bytes for a key using the context if the loader
+// supports it.
+func GetKeyBytes(ctx context.Context, loader KeyLoader) ([]byte, error) {
+	if loader == nil {
+		return nil, errors.New("no loader")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if ctxLoader, ok := loader.(ContextKeyLoader); ok {
+		return ctxLoader.GetBytesContext(ctx)
+	}
+	return loader.GetBytes()
+}
+
 // EncryptLoader loads an encrypter.
 type EncryptLoader interface {
 	LoadEncrypt() (Encrypt, error)
@@ -78,22 +159,200 @@ type DecryptLoader interface {
 	LoadDecrypt() (Decrypt, error)
 }
 
+// ContextEncryptLoader loads an encrypter, passing the context to the key loaders.
+type ContextEncryptLoader interface {
+	EncryptLoader
+	LoadEncryptContext(ctx context.Context) (Encrypt, error)
+}
+
+// ContextDecryptLoader loads a decrypter, passing the context to the key loaders.
+type ContextDecryptLoader interface {
+	DecryptLoader
+	LoadDecryptContext(ctx context.Context) (Decrypt, error)
+}
+
 // FileLoader loads a key from a file.
 type FileLoader struct {
 	Path string
 }
 
-// GetBytes returns the bytes found at the filepath.
+// GetBytes returns the bytes found at the filepath.  A missing file is an
+// ErrKeyNotFound.
 func (f *FileLoader) GetBytes() ([]byte, error) {
-	return ioutil.ReadFile(f.Path)
+	data, err := ioutil.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %w", ErrKeyNotFound, err)
+	}
+	return data, err
 }
 
+// GetBytesContext returns the bytes found at the filepath unless the context
+// is already done.
+func (f *FileLoader) GetBytesContext(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return f.GetBytes()
+}
+
+// CreateFileLoader returns a FileLoader for the path of the key type given.
 func CreateFileLoader(keys map[KeyType]string, keyType KeyType) KeyLoader {
 	return &FileLoader{
 		Path: keys[keyType],
 	}
 }
 
+// EnvLoader loads a key from an environment variable.
+type EnvLoader struct {
+	Name string
+}
+
+// GetBytes returns the value of the environment variable.
+func (e *EnvLoader) GetBytes() ([]byte, error) {
+	value, ok := os.LookupEnv(e.Name)
+	if !ok {
+		return nil, keyNotFound("environment variable %s not set", e.Name)
+	}
+	return []byte(value), nil
+}
+
+// ChainLoader tries each loader in order and returns the first key found.
+type ChainLoader struct {
+	Loaders []KeyLoader
+}
+
+// GetBytes returns the bytes from the first loader that succeeds with a
+// non-empty key.  If every loader fails, the last error is returned.
+func (c *ChainLoader) GetBytes() ([]byte, error) {
+	return c.GetBytesContext(context.Background())
+}
+
+// GetBytesContext is like GetBytes, but stops trying loaders once the
+// context is done.
+func (c *ChainLoader) GetBytesContext(ctx context.Context) ([]byte, error) {
+	err := errors.New("no loaders in chain")
+	for _, loader := range c.Loaders {
+		if loader == nil {
+			continue
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		data, loadErr := GetKeyBytes(ctx, loader)
+		if loadErr != nil {
+			err = loadErr
+			continue
+		}
+		if len(data) == 0 {
+			err = errors.New("empty key")
+			continue
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("failed to load key from chain: %w", err)
+}
+
+// DecryptingLoader is a KeyLoader for keys that are themselves stored
+// encrypted, for example under a master key.  The key is fetched with Loader
+// and decrypted with Decrypter before it is returned.
+type DecryptingLoader struct {
+	// Loader loads the encrypted key.
+	Loader KeyLoader
+
+	// Nonce loads the nonce the key was encrypted with.  It may be nil for
+	// algorithms that don't produce a nonce.
+	Nonce KeyLoader
+
+	// Decrypter decrypts the key.
+	Decrypter Decrypt
+
+	// Encoded is set when the encrypted key and nonce are stored as hex or
+	// base64 text rather than raw bytes.
+	Encoded bool
+}
+
+// GetBytes returns the decrypted key.
+func (d *DecryptingLoader) GetBytes() ([]byte, error) {
+	return d.GetBytesContext(context.Background())
+}
+
+// GetBytesContext returns the decrypted key, passing the context to the loaders.
+func (d *DecryptingLoader) GetBytesContext(ctx context.Context) ([]byte, error) {
+	if d.Decrypter == nil {
+		return nil, errors.New("no decrypter")
+	}
+
+	crypt, err := d.load(ctx, d.Loader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encrypted key: %w", err)
+	}
+
+	var nonce []byte
+	if d.Nonce != nil {
+		if nonce, err = d.load(ctx, d.Nonce); err != nil {
+			return nil, fmt.Errorf("failed to load encrypted key nonce: %w", err)
+		}
+	}
+
+	key, err := d.Decrypter.DecryptMessage(crypt, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key: %w", err)
+	}
+	return key, nil
+}
+
+func (d *DecryptingLoader) load(ctx context.Context, loader KeyLoader) ([]byte, error) {
+	data, err := GetKeyBytes(ctx, loader)
+	if err != nil || !d.Encoded {
+		return data, err
+	}
+	decoded, ok := decodeTextKey(data)
+	if !ok {
+		return nil, errors.New("data is not hex or base64")
+	}
+	return decoded, nil
+}
+
+// DefaultMaxReaderKeySize is the most a ReaderLoader reads when no
+// limit is configured.
+const DefaultMaxReaderKeySize = 1 << 20
+
+// ReaderLoader loads a key from an io.Reader, such as os.Stdin, so keys can
+// be piped in without touching disk.  The reader is only read once; later
+// calls return the same bytes.
+type ReaderLoader struct {
+	Reader io.Reader
+
+	// MaxSize limits how many bytes are read.  If not supplied,
+	// DefaultMaxReaderKeySize is used instead.
+	MaxSize int64
+
+	once sync.Once
+	data []byte
+	err  error
+}
+
+// GetBytes reads the key from the reader the first time it is called.
+func (r *ReaderLoader) GetBytes() ([]byte, error) {
+	r.once.Do(func() {
+		if r.Reader == nil {
+			r.err = errors.New("no reader")
+			return
+		}
+		maxSize := r.MaxSize
+		if maxSize <= 0 {
+			maxSize = DefaultMaxReaderKeySize
+		}
+
+		// read one extra byte to tell a key of exactly maxSize from one too large
+		r.data, r.err = ioutil.ReadAll(io.LimitReader(r.Reader, maxSize+1))
+		if r.err == nil && int64(len(r.data)) > maxSize {
+			r.data, r.err = nil, errors.New("key is larger than the maximum size")
+		}
+	})
+	return r.data, r.err
+}
+
 // BytesLoader implements the KeyLoader.
 type BytesLoader struct {
 	Data []byte
@@ -104,162 +363,246 @@ func (b *BytesLoader) GetBytes() ([]byte, error) {
 	return b.Data, nil
 }
 
-// GetPrivateKey uses a keyloader to load a private key.
-func GetPrivateKey(loader KeyLoader) (*rsa.PrivateKey, error) {
-	if loader == nil {
-		return nil, errors.New("no loader")
+// hasKey reports whether the key type is configured either as a path or a loader.
+func (config *Config) hasKey(keyType KeyType) bool {
+	if _, ok := config.Loaders[keyType]; ok {
+		return true
 	}
+	_, ok := config.Keys[keyType]
+	return ok
+}
+
+// keyLoader returns the loader for the key type, preferring keys already
+// loaded, then Loaders over Keys, and decrypting the key if it has a
+// passphrase.  Its errors, and the errors
+// parsing its key, are KeyErrors.
+func (config *Config) keyLoader(keyType KeyType) KeyLoader {
+	if data, ok := config.loadedKeys[keyType]; ok {
+		return &configKeyLoader{keyType: keyType, loader: &BytesLoader{Data: data}}
+	}
+	loader := config.sourceLoader(keyType)
+	if source, ok := config.Passphrases[keyType]; ok {
+		// env, file and prompt passphrases are read fresh for every load
+		loader = &PassphraseLoader{Loader: loader, Passphrase: source.loader(), LegacyPEM: source.LegacyPEM, wipePassphrase: true}
+	}
+	return &configKeyLoader{keyType: keyType, loader: loader}
+}
 
-	data, err := loader.GetBytes()
+// sourceLoader returns the loader of the key as stored, without decrypting it.
+func (config *Config) sourceLoader(keyType KeyType) KeyLoader {
+	if loader, ok := config.Loaders[keyType]; ok {
+		return loader
+	}
+	return CreateFileLoader(config.Keys, keyType)
+}
+
+// GetPrivateKey uses a keyloader to load a private key from a PKCS#1 (RSA
+// PRIVATE KEY) or PKCS#8 (PRIVATE KEY) pem block.  Each call returns a new key
+// owned by the caller, who should wipe it, for example by closing the cipher
+// it's given to, when done.  The bytes from the loader aren't wiped, as
+// loaders like BytesLoader keep them.
+func GetPrivateKey(loader KeyLoader) (*rsa.PrivateKey, error) {
+	return GetPrivateKeyContext(context.Background(), loader)
+}
+
+// GetPrivateKeyContext uses a keyloader to load a private key, passing the
+// context to the loader.
+func GetPrivateKeyContext(ctx context.Context, loader KeyLoader) (*rsa.PrivateKey, error) {
+	data, err := GetKeyBytes(ctx, loader)
 	if err != nil {
 		return nil, err
 	}
-	privPem, _ := pem.Decode(data)
-	if privPem.Type != "RSA PRIVATE KEY" {
-		return nil, errors.New("incorrect pem type: " + privPem.Type)
+	privateKey, err := parseRSAPrivateKey(data)
+	if err != nil {
+		return nil, keyError(loader, err)
 	}
+	return privateKey, nil
+}
 
-	var parsedKey interface{}
-	if parsedKey, err = x509.ParsePKCS1PrivateKey(privPem.Bytes); err != nil {
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	privPem, err := decodePEMBlock(data, "RSA PRIVATE KEY", "PRIVATE KEY")
+	if err != nil {
 		return nil, err
 	}
 
-	if privateKey, ok := parsedKey.(*rsa.PrivateKey); !ok {
-		return nil, errors.New("failed convert parsed key to private key")
-	} else {
+	if privPem.Type == "RSA PRIVATE KEY" {
+		privateKey, err := x509.ParsePKCS1PrivateKey(privPem.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: x509.ParsePKCS1PrivateKey: %w", ErrInvalidKey, err)
+		}
 		return privateKey, nil
 	}
+
+	parsedKey, err := x509.ParsePKCS8PrivateKey(privPem.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: x509.ParsePKCS8PrivateKey: %w", ErrInvalidKey, err)
+	}
+	privateKey, ok := parsedKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, wrongKeyType("pkcs8 key is a %T, not an RSA key", parsedKey)
+	}
+	return privateKey, nil
 }
 
-// GetPublicKey uses a keyloader to load a public key.
+// GetPublicKey uses a keyloader to load a public key from a PKCS#1 (RSA
+// PUBLIC KEY) or PKIX (PUBLIC KEY) pem block.
 func GetPublicKey(loader KeyLoader) (*rsa.PublicKey, error) {
-	if loader == nil {
-		return nil, errors.New("no loader")
-	}
+	return GetPublicKeyContext(context.Background(), loader)
+}
 
-	data, err := loader.GetBytes()
+// GetPublicKeyContext uses a keyloader to load a public key, passing the
+// context to the loader.
+func GetPublicKeyContext(ctx context.Context, loader KeyLoader) (*rsa.PublicKey, error) {
+	data, err := GetKeyBytes(ctx, loader)
 	if err != nil {
 		return nil, err
 	}
-	publicPem, _ := pem.Decode(data)
-	if publicPem.Type != "RSA PUBLIC KEY" {
-		return nil, errors.New("incorrect pem type: " + publicPem.Type)
+	publicKey, err := parseRSAPublicKey(data)
+	if err != nil {
+		return nil, keyError(loader, err)
 	}
+	return publicKey, nil
+}
 
-	var parsedKey interface{}
-	if parsedKey, err = x509.ParsePKCS1PublicKey(publicPem.Bytes); err != nil {
-		return nil, emperror.Wrap(err, "failed to load public key x509.ParsePKCS1PublicKey")
+func parseRSAPublicKey(data []byte) (*rsa.PublicKey, error) {
+	publicPem, err := decodePEMBlock(data, "RSA PUBLIC KEY", "PUBLIC KEY")
+	if err != nil {
+		return nil, err
 	}
 
-	if publicKey, ok := parsedKey.(*rsa.PublicKey); !ok {
-		return nil, errors.New("failed convert parsed key to public key")
-	} else {
+	if publicPem.Type == "RSA PUBLIC KEY" {
+		publicKey, err := x509.ParsePKCS1PublicKey(publicPem.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: x509.ParsePKCS1PublicKey: %w", ErrInvalidKey, err)
+		}
 		return publicKey, nil
 	}
+
+	parsedKey, err := x509.ParsePKIXPublicKey(publicPem.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: x509.ParsePKIXPublicKey: %w", ErrInvalidKey, err)
+	}
+	publicKey, ok := parsedKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, wrongKeyType("pkix key is a %T, not an RSA key", parsedKey)
+	}
+	return publicKey, nil
 }
 
 // LoadEncrypt uses the config to load an encrypter.
-//nolint:dupl // it's okay
 func (config *Config) LoadEncrypt() (Encrypt, error) {
-	var err error
+	return config.LoadEncryptContext(context.Background())
+}
+
+// LoadEncryptContext uses the config to load an encrypter, passing the
+// context to the key loaders.  The encrypter is built by the factory
+// registered for the config's Type.
+func (config *Config) LoadEncryptContext(ctx context.Context) (Encrypt, error) {
 	if config.Logger == nil {
-		config.Logger = logging.DefaultLogger()
+		config.Logger = DefaultLogger()
 	}
-	logging.Debug(config.Logger).Log(logging.MessageKey(), "new encrypter", "config", config)
+	logDebug(config.Logger, "new encrypter", "config", config)
 
-	switch config.Type {
-	case None:
-		return DefaultCipherEncrypter(), nil
-	case Box:
-		if !hasBothEncryptKeys(config.Keys) {
-			err = errIncorrectKeys
-			break
-		}
-		boxLoader := BoxLoader{
-			KID:        config.KID,
-			PrivateKey: CreateFileLoader(config.Keys, SenderPrivateKey),
-			PublicKey:  CreateFileLoader(config.Keys, RecipientPublicKey),
-		}
-		return boxLoader.LoadEncrypt()
-	case RSASymmetric:
-		if _, ok := config.Keys[PublicKey]; !ok {
-			err = errIncorrectKeys
-			break
-		}
-		rsaLoader := RSALoader{
-			KID:       config.KID,
-			Hash:      &BasicHashLoader{HashName: config.Params["hash"]},
-			PublicKey: CreateFileLoader(config.Keys, PublicKey),
-		}
-		return rsaLoader.LoadEncrypt()
-	case RSAAsymmetric:
-		if !hasBothEncryptKeys(config.Keys) {
-			err = errIncorrectKeys
-			break
-		}
-		rsaLoader := RSALoader{
-			KID:        config.KID,
-			Hash:       &BasicHashLoader{HashName: config.Params["hash"]},
-			PrivateKey: CreateFileLoader(config.Keys, SenderPrivateKey),
-			PublicKey:  CreateFileLoader(config.Keys, RecipientPublicKey),
+	ctx, span := startSpan(ctx, config.Tracer, loadEncryptSpan, config.Type, config.KID)
+	encrypter, reason, err := config.loadEncrypt(ctx)
+	config.Metrics.record(encryptOperation, config, reason, encrypter)
+	if err != nil && len(config.Fallbacks) > 0 {
+		encrypter, err = config.loadFallbackEncrypt(ctx, err)
+	}
+	endSpan(span, err)
+	if err != nil {
+		return DefaultCipherEncrypter(), err
+	}
+	return encrypter, nil
+}
+
+// loadEncrypt loads the encrypter, returning why it failed as a metrics
+// reason.
+func (config *Config) loadEncrypt(ctx context.Context) (Encrypt, string, error) {
+	if config.GenerateMissingKeys {
+		if err := config.generateMissingKeys(); err != nil {
+			return nil, ReasonGenerate, err
 		}
-		return rsaLoader.LoadEncrypt()
-	default:
-		err = errors.New("no algorithm type specified")
 	}
 
-	return DefaultCipherEncrypter(), emperror.Wrap(err, "failed to load custom algorithm")
+	if err := checkFIPSAlgorithm(config.Type); err != nil {
+		return nil, ReasonFIPS, err
+	}
+
+	factory, err := getEncrypterFactory(config.Type)
+	if err != nil {
+		return nil, ReasonUnknownAlgorithm, fmt.Errorf("failed to load custom algorithm: %w", err)
+	}
+	loaded, err := config.loadKeyPairs(ctx)
+	if err != nil {
+		return nil, failureReason(ctx, err), err
+	}
+	encrypter, err := factory(ctx, loaded)
+	loaded.wipeLoadedKeys()
+	if err != nil {
+		return nil, failureReason(ctx, err), fmt.Errorf("failed to load custom algorithm: %w", err)
+	}
+	if err := config.deriveKID(encrypter); err != nil {
+		return nil, ReasonLoad, err
+	}
+	return encrypter, "", nil
 }
 
 // LoadDecrypt uses the config to load a decrypter.
-//nolint:dupl // it's okay
 func (config *Config) LoadDecrypt() (Decrypt, error) {
-	var err error
+	return config.LoadDecryptContext(context.Background())
+}
+
+// LoadDecryptContext uses the config to load a decrypter, passing the
+// context to the key loaders.  The decrypter is built by the factory
+// registered for the config's Type.
+func (config *Config) LoadDecryptContext(ctx context.Context) (Decrypt, error) {
 	if config.Logger == nil {
-		config.Logger = logging.DefaultLogger()
+		config.Logger = DefaultLogger()
 	}
-	logging.Debug(config.Logger).Log(logging.MessageKey(), "new decrypter", "config", config)
+	logDebug(config.Logger, "new decrypter", "config", config)
 
-	switch config.Type {
-	case None:
-		return DefaultCipherDecrypter(), nil
-	case Box:
-		if !hasBothDecryptKeys(config.Keys) {
-			err = errIncorrectKeys
-			break
-		}
-		boxLoader := BoxLoader{
-			KID:        config.KID,
-			PrivateKey: CreateFileLoader(config.Keys, RecipientPrivateKey),
-			PublicKey:  CreateFileLoader(config.Keys, SenderPublicKey),
-		}
-		return boxLoader.LoadDecrypt()
-	case RSASymmetric:
-		if _, ok := config.Keys[PrivateKey]; !ok {
-			err = errIncorrectKeys
-			break
-		}
-		rsaLoader := RSALoader{
-			KID:        config.KID,
-			Hash:       &BasicHashLoader{HashName: config.Params["hash"]},
-			PrivateKey: CreateFileLoader(config.Keys, PrivateKey),
-		}
-		return rsaLoader.LoadDecrypt()
-	case RSAAsymmetric:
-		if !hasBothDecryptKeys(config.Keys) {
-			err = errIncorrectKeys
-			break
-		}
-		rsaLoader := RSALoader{
-			KID:        config.KID,
-			Hash:       &BasicHashLoader{HashName: config.Params["hash"]},
-			PrivateKey: CreateFileLoader(config.Keys, RecipientPrivateKey),
-			PublicKey:  CreateFileLoader(config.Keys, SenderPublicKey),
+	ctx, span := startSpan(ctx, config.Tracer, loadDecryptSpan, config.Type, config.KID)
+	decrypter, reason, err := config.loadDecrypt(ctx)
+	config.Metrics.record(decryptOperation, config, reason, decrypter)
+	if len(config.Fallbacks) > 0 {
+		decrypter, err = config.loadFallbackDecrypt(ctx, decrypter, err)
+	}
+	endSpan(span, err)
+	if err != nil {
+		return DefaultCipherDecrypter(), err
+	}
+	return decrypter, nil
+}
+
+// loadDecrypt loads the decrypter, returning why it failed as a metrics
+// reason.
+func (config *Config) loadDecrypt(ctx context.Context) (Decrypt, string, error) {
+	if config.GenerateMissingKeys {
+		if err := config.generateMissingKeys(); err != nil {
+			return nil, ReasonGenerate, err
 		}
-		return rsaLoader.LoadDecrypt()
-	default:
-		err = errors.New("no algorithm type specified")
 	}
 
-	return DefaultCipherDecrypter(), emperror.Wrap(err, "failed to load custom algorithm")
+	if err := checkFIPSAlgorithm(config.Type); err != nil {
+		return nil, ReasonFIPS, err
+	}
+
+	factory, err := getDecrypterFactory(config.Type)
+	if err != nil {
+		return nil, ReasonUnknownAlgorithm, fmt.Errorf("failed to load custom algorithm: %w", err)
+	}
+	loaded, err := config.loadKeyPairs(ctx)
+	if err != nil {
+		return nil, failureReason(ctx, err), err
+	}
+	decrypter, err := factory(ctx, loaded)
+	loaded.wipeLoadedKeys()
+	if err != nil {
+		return nil, failureReason(ctx, err), fmt.Errorf("failed to load custom algorithm: %w", err)
+	}
+	if err := config.deriveKID(decrypter); err != nil {
+		return nil, ReasonLoad, err
+	}
+	return decrypter, "", nil
 }
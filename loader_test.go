@@ -18,12 +18,17 @@
 package voynicrypto
 
 import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"errors"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"github.com/xmidt-org/webpa-common/logging"
 )
 
 func TestBasicCipherLoader(t *testing.T) {
@@ -80,7 +85,7 @@ func TestLoadOptions(t *testing.T) {
 	}{
 		{"noop", Config{Type: None}, false},
 		{"basic", Config{
-			Logger: logging.NewTestLogger(nil, t),
+			Logger: newTestLogger(t),
 			Type:   RSAAsymmetric,
 			Params: map[string]string{"hash": "SHA512"},
 			KID:    "neato",
@@ -92,7 +97,7 @@ func TestLoadOptions(t *testing.T) {
 			},
 		}, true},
 		{"box", Config{
-			Logger: logging.NewTestLogger(nil, t),
+			Logger: newTestLogger(t),
 			Type:   Box,
 			KID:    "coolio",
 			Keys: map[KeyType]string{
@@ -122,3 +127,228 @@ func testOptions(t *testing.T, c Config, errOnLarge bool) {
 
 	testCryptoPair(t, encrypter, decrypter, errOnLarge)
 }
+
+func TestChainLoader(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := os.Getwd()
+	require.Nil(err)
+
+	fileData, err := (&FileLoader{Path: dir + string(os.PathSeparator) + "public.pem"}).GetBytes()
+	require.Nil(err)
+
+	os.Setenv("VOYNICRYPTO_TEST_KEY", "from env")
+	defer os.Unsetenv("VOYNICRYPTO_TEST_KEY")
+
+	testData := []struct {
+		description string
+		loader      ChainLoader
+		expected    []byte
+		expectedErr bool
+	}{
+		{"empty", ChainLoader{}, nil, true},
+		{"env first", ChainLoader{Loaders: []KeyLoader{
+			&EnvLoader{Name: "VOYNICRYPTO_TEST_KEY"},
+			&FileLoader{Path: dir + string(os.PathSeparator) + "public.pem"},
+		}}, []byte("from env"), false},
+		{"fallback to file", ChainLoader{Loaders: []KeyLoader{
+			&EnvLoader{Name: "VOYNICRYPTO_MISSING_KEY"},
+			nil,
+			&BytesLoader{},
+			&FileLoader{Path: dir + string(os.PathSeparator) + "public.pem"},
+		}}, fileData, false},
+		{"all fail", ChainLoader{Loaders: []KeyLoader{
+			&EnvLoader{Name: "VOYNICRYPTO_MISSING_KEY"},
+			&FileLoader{Path: dir + string(os.PathSeparator) + "missing.pem"},
+		}}, nil, true},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			data, err := tc.loader.GetBytes()
+			if tc.expectedErr {
+				assert.NotNil(err)
+				return
+			}
+			assert.Nil(err)
+			assert.Equal(tc.expected, data)
+		})
+	}
+}
+
+func TestConfigLoaders(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := os.Getwd()
+	require.Nil(err)
+
+	privateKey, err := (&FileLoader{Path: dir + string(os.PathSeparator) + "private.pem"}).GetBytes()
+	require.Nil(err)
+
+	os.Setenv("VOYNICRYPTO_TEST_PRIVATE_KEY", string(privateKey))
+	defer os.Unsetenv("VOYNICRYPTO_TEST_PRIVATE_KEY")
+
+	testOptions(t, Config{
+		Type:   RSASymmetric,
+		Params: map[string]string{"hash": "SHA512"},
+		Keys: map[KeyType]string{
+			PublicKey:  dir + string(os.PathSeparator) + "public.pem",
+			PrivateKey: dir + string(os.PathSeparator) + "missing.pem",
+		},
+		Loaders: map[KeyType]KeyLoader{
+			PrivateKey: &ChainLoader{Loaders: []KeyLoader{
+				&EnvLoader{Name: "VOYNICRYPTO_TEST_PRIVATE_KEY"},
+				&FileLoader{Path: dir + string(os.PathSeparator) + "missing.pem"},
+			}},
+		},
+	}, true)
+}
+
+type blockingLoader struct{}
+
+func (blockingLoader) GetBytes() ([]byte, error) {
+	return nil, errors.New("should not be called without a context")
+}
+
+func (blockingLoader) GetBytesContext(ctx context.Context) ([]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestLoadContext(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := os.Getwd()
+	require.Nil(err)
+
+	config := Config{
+		Type:   RSASymmetric,
+		Params: map[string]string{"hash": "SHA512"},
+		Loaders: map[KeyType]KeyLoader{
+			PublicKey:  blockingLoader{},
+			PrivateKey: &ChainLoader{Loaders: []KeyLoader{blockingLoader{}}},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = config.LoadEncryptContext(ctx)
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+
+	_, err = config.LoadDecryptContext(ctx)
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = GetKeyBytes(canceled, &FileLoader{Path: dir + string(os.PathSeparator) + "public.pem"})
+	assert.Equal(context.Canceled, err)
+
+	data, err := GetKeyBytes(context.Background(), &BytesLoader{Data: []byte("key")})
+	assert.Nil(err)
+	assert.Equal([]byte("key"), data)
+}
+
+func TestDecryptingLoader(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := os.Getwd()
+	require.Nil(err)
+
+	privateKey, err := (&FileLoader{Path: dir + string(os.PathSeparator) + "private.pem"}).GetBytes()
+	require.Nil(err)
+
+	masterPublicKey, masterPrivateKey, err := GenerateBoxKeyPair()
+	require.Nil(err)
+	master := NewBoxEncrypter(*masterPrivateKey, *masterPublicKey, "master")
+	crypt, nonce, err := master.EncryptMessage(privateKey)
+	require.Nil(err)
+
+	loader := &DecryptingLoader{
+		Loader:    &BytesLoader{Data: []byte(base64.StdEncoding.EncodeToString(crypt))},
+		Nonce:     &BytesLoader{Data: []byte(base64.StdEncoding.EncodeToString(nonce))},
+		Decrypter: NewBoxDecrypter(*masterPrivateKey, *masterPublicKey, "master"),
+		Encoded:   true,
+	}
+
+	data, err := loader.GetBytes()
+	assert.Nil(err)
+	assert.Equal(privateKey, data)
+
+	testOptions(t, Config{
+		Type:   RSASymmetric,
+		Params: map[string]string{"hash": "SHA512"},
+		Keys: map[KeyType]string{
+			PublicKey: dir + string(os.PathSeparator) + "public.pem",
+		},
+		Loaders: map[KeyType]KeyLoader{
+			PrivateKey: loader,
+		},
+	}, true)
+
+	// the wrong master key must fail
+	_, otherPrivateKey, err := GenerateBoxKeyPair()
+	require.Nil(err)
+	loader.Decrypter = NewBoxDecrypter(*otherPrivateKey, *masterPublicKey, "master")
+	_, err = loader.GetBytes()
+	assert.NotNil(err)
+
+	_, err = (&DecryptingLoader{Loader: &BytesLoader{Data: crypt}}).GetBytes()
+	assert.NotNil(err)
+
+	_, err = (&DecryptingLoader{
+		Loader:    &BytesLoader{Data: []byte("not encoded!")},
+		Decrypter: DefaultCipherDecrypter(),
+		Encoded:   true,
+	}).GetBytes()
+	assert.NotNil(err)
+}
+
+func TestReaderLoader(t *testing.T) {
+	assert := assert.New(t)
+
+	loader := &ReaderLoader{Reader: strings.NewReader("key from a pipe")}
+	data, err := loader.GetBytes()
+	assert.Nil(err)
+	assert.Equal([]byte("key from a pipe"), data)
+
+	// the reader is drained, but the key is remembered
+	data, err = loader.GetBytes()
+	assert.Nil(err)
+	assert.Equal([]byte("key from a pipe"), data)
+
+	_, err = (&ReaderLoader{Reader: strings.NewReader("too large"), MaxSize: 3}).GetBytes()
+	assert.NotNil(err)
+
+	data, err = (&ReaderLoader{Reader: strings.NewReader("abc"), MaxSize: 3}).GetBytes()
+	assert.Nil(err)
+	assert.Equal([]byte("abc"), data)
+
+	_, err = (&ReaderLoader{}).GetBytes()
+	assert.NotNil(err)
+}
+
+func TestRegisterHashName(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	_, err := (&BasicHashLoader{HashName: "sha224"}).GetHash()
+	assert.NotNil(err)
+
+	require.Nil(RegisterHashName("sha224", crypto.SHA224))
+	h, err := (&BasicHashLoader{HashName: "SHA224"}).GetHash()
+	assert.Nil(err)
+	assert.Equal(crypto.SHA224, h)
+	assert.Equal(crypto.SHA224, GetHash("Sha224"))
+
+	// registering the same hash again is fine, changing it is not
+	assert.Nil(RegisterHashName("SHA224", crypto.SHA224))
+	assert.NotNil(RegisterHashName("SHA224", crypto.SHA256))
+	assert.NotNil(RegisterHashName("MD5", crypto.SHA224))
+
+	assert.NotNil(RegisterHashName("", crypto.SHA224))
+	assert.NotNil(RegisterHashName("MD4", crypto.MD4))
+}
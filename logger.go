@@ -0,0 +1,185 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// Logger is what the package logs to.  It has the Log method of a go-kit
+// log.Logger, so a go-kit logger can be used as it is, and NewSlogLogger and
+// NewZapLogger adapt the other common loggers.  Every line has a LevelKey and
+// a MessageKey.
+type Logger interface {
+	Log(keyvals ...interface{}) error
+}
+
+// LoggerFunc is a function that is a Logger.
+type LoggerFunc func(keyvals ...interface{}) error
+
+// Log calls the function.
+func (f LoggerFunc) Log(keyvals ...interface{}) error {
+	return f(keyvals...)
+}
+
+// The keys every line logged has, and the key of the error of a failure.
+const (
+	LevelKey   = "level"
+	MessageKey = "msg"
+	ErrorKey   = "error"
+)
+
+// The values of LevelKey.
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+var nopLogger = LoggerFunc(func(...interface{}) error { return nil })
+
+// DefaultLogger returns the Logger used when none is configured, which
+// discards everything.
+func DefaultLogger() Logger {
+	return nopLogger
+}
+
+func logAt(logger Logger, lvl string, message string, keyvals []interface{}) {
+	if logger == nil {
+		return
+	}
+	logger.Log(append([]interface{}{LevelKey, lvl, MessageKey, message}, keyvals...)...)
+}
+
+func logDebug(logger Logger, message string, keyvals ...interface{}) {
+	logAt(logger, LevelDebug, message, keyvals)
+}
+
+func logInfo(logger Logger, message string, keyvals ...interface{}) {
+	logAt(logger, LevelInfo, message, keyvals)
+}
+
+func logWarn(logger Logger, message string, keyvals ...interface{}) {
+	logAt(logger, LevelWarn, message, keyvals)
+}
+
+func logError(logger Logger, message string, keyvals ...interface{}) {
+	logAt(logger, LevelError, message, keyvals)
+}
+
+// splitLine takes the level and message out of the keyvals of a line.
+func splitLine(keyvals []interface{}) (lvl string, message string, rest []interface{}) {
+	rest = make([]interface{}, 0, len(keyvals))
+	for i := 0; i < len(keyvals); i += 2 {
+		var value interface{}
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		switch keyvals[i] {
+		case LevelKey:
+			lvl = fmt.Sprint(value)
+			continue
+		case MessageKey:
+			message = fmt.Sprint(value)
+			continue
+		}
+		rest = append(rest, keyvals[i], value)
+	}
+	return lvl, message, rest
+}
+
+// NewGoKitLogger returns a Logger that writes to a go-kit logger with the
+// level as a go-kit level value, so the logger can be filtered with
+// level.NewFilter.  A go-kit logger can also be used as a Logger directly,
+// with the level as a plain string.
+func NewGoKitLogger(logger log.Logger) Logger {
+	return LoggerFunc(func(keyvals ...interface{}) error {
+		converted := append([]interface{}{}, keyvals...)
+		for i := 0; i+1 < len(converted); i += 2 {
+			if converted[i] != LevelKey {
+				continue
+			}
+			converted[i] = level.Key()
+			switch converted[i+1] {
+			case LevelDebug:
+				converted[i+1] = level.DebugValue()
+			case LevelInfo:
+				converted[i+1] = level.InfoValue()
+			case LevelWarn:
+				converted[i+1] = level.WarnValue()
+			case LevelError:
+				converted[i+1] = level.ErrorValue()
+			}
+		}
+		return logger.Log(converted...)
+	})
+}
+
+// NewSlogLogger returns a Logger that writes to a log/slog logger, at the
+// slog level of each line.
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return LoggerFunc(func(keyvals ...interface{}) error {
+		lvl, message, rest := splitLine(keyvals)
+		slogLevel := slog.LevelInfo
+		switch lvl {
+		case LevelDebug:
+			slogLevel = slog.LevelDebug
+		case LevelWarn:
+			slogLevel = slog.LevelWarn
+		case LevelError:
+			slogLevel = slog.LevelError
+		}
+		logger.Log(context.Background(), slogLevel, message, rest...)
+		return nil
+	})
+}
+
+// ZapSugaredLogger is the part of a zap *zap.SugaredLogger that NewZapLogger
+// uses.
+type ZapSugaredLogger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// NewZapLogger returns a Logger that writes to a zap sugared logger, such as
+// the one returned by the Sugar method of a *zap.Logger, at the zap level of
+// each line.
+func NewZapLogger(logger ZapSugaredLogger) Logger {
+	return LoggerFunc(func(keyvals ...interface{}) error {
+		lvl, message, rest := splitLine(keyvals)
+		switch lvl {
+		case LevelDebug:
+			logger.Debugw(message, rest...)
+		case LevelWarn:
+			logger.Warnw(message, rest...)
+		case LevelError:
+			logger.Errorw(message, rest...)
+		default:
+			logger.Infow(message, rest...)
+		}
+		return nil
+	})
+}
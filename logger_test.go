@@ -0,0 +1,133 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestLogger returns a Logger that writes to the test log.
+func newTestLogger(t testing.TB) Logger {
+	return LoggerFunc(func(keyvals ...interface{}) error {
+		t.Log(keyvals...)
+		return nil
+	})
+}
+
+func TestLogLevels(t *testing.T) {
+	assert := assert.New(t)
+
+	var lines [][]interface{}
+	logger := LoggerFunc(func(keyvals ...interface{}) error {
+		lines = append(lines, keyvals)
+		return nil
+	})
+
+	logDebug(logger, "one", "k", 1)
+	logInfo(logger, "two")
+	logWarn(logger, "three")
+	logError(logger, "four", ErrorKey, "bad")
+	logError(nil, "ignored")
+	assert.Nil(DefaultLogger().Log("k", "v"))
+
+	assert.Equal([][]interface{}{
+		{LevelKey, LevelDebug, MessageKey, "one", "k", 1},
+		{LevelKey, LevelInfo, MessageKey, "two"},
+		{LevelKey, LevelWarn, MessageKey, "three"},
+		{LevelKey, LevelError, MessageKey, "four", ErrorKey, "bad"},
+	}, lines)
+}
+
+func TestGoKitLogger(t *testing.T) {
+	assert := assert.New(t)
+
+	// go-kit loggers are Loggers as they are
+	var buffer bytes.Buffer
+	logInfo(log.NewLogfmtLogger(&buffer), "plain", "k", "v")
+	assert.Equal("level=info msg=plain k=v\n", buffer.String())
+
+	// and the adapter makes their filters work
+	buffer.Reset()
+	logger := NewGoKitLogger(level.NewFilter(log.NewLogfmtLogger(&buffer), level.AllowWarn()))
+	logDebug(logger, "dropped")
+	logInfo(logger, "dropped")
+	logWarn(logger, "kept")
+	logError(logger, "kept too", ErrorKey, errors.New("bad"))
+	assert.Equal("level=warn msg=kept\nlevel=error msg=\"kept too\" error=bad\n", buffer.String())
+}
+
+func TestSlogLogger(t *testing.T) {
+	assert := assert.New(t)
+
+	var buffer bytes.Buffer
+	handler := slog.NewTextHandler(&buffer, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	logger := NewSlogLogger(slog.New(handler))
+
+	logDebug(logger, "dropped")
+	logInfo(logger, "reloaded", "kid", "k1")
+	logError(logger, "failed", ErrorKey, "bad")
+	assert.Equal("level=INFO msg=reloaded kid=k1\nlevel=ERROR msg=failed error=bad\n", buffer.String())
+}
+
+type testZapLogger struct {
+	lines []string
+}
+
+func (z *testZapLogger) log(lvl string, msg string, keysAndValues []interface{}) {
+	z.lines = append(z.lines, lvl+" "+msg+" "+slog.Group("", keysAndValues...).Value.String())
+}
+
+func (z *testZapLogger) Debugw(msg string, kv ...interface{}) { z.log("debug", msg, kv) }
+func (z *testZapLogger) Infow(msg string, kv ...interface{})  { z.log("info", msg, kv) }
+func (z *testZapLogger) Warnw(msg string, kv ...interface{})  { z.log("warn", msg, kv) }
+func (z *testZapLogger) Errorw(msg string, kv ...interface{}) { z.log("error", msg, kv) }
+
+func TestZapLogger(t *testing.T) {
+	assert := assert.New(t)
+
+	zap := &testZapLogger{}
+	logger := NewZapLogger(zap)
+	logDebug(logger, "one", "k", 1)
+	logInfo(logger, "two")
+	logWarn(logger, "three")
+	logError(logger, "four", ErrorKey, "bad")
+	logger.Log("no", "level")
+
+	assert.Equal([]string{
+		"debug one [k=1]",
+		"info two []",
+		"warn three []",
+		"error four [error=bad]",
+		"info  [no=level]",
+	}, zap.lines)
+}
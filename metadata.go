@@ -0,0 +1,123 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"golang.org/x/crypto/nacl/box"
+)
+
+// Metadata describes the sizes and guarantees of a cipher, so framing layers
+// and size estimates don't need to know each algorithm.
+type Metadata struct {
+	// NonceSize is the size of the nonce returned with each message.  RSA
+	// returns its signature there, if it signs.
+	NonceSize int
+
+	// Overhead is how much larger the ciphertext is than the message.  For
+	// ciphers with a MaxPlaintextSize the ciphertext is always
+	// MaxPlaintextSize+Overhead long.
+	Overhead int
+
+	// MaxPlaintextSize is the largest message that can be encrypted, or 0 if
+	// there is no limit.
+	MaxPlaintextSize int
+
+	// Authenticated reports whether the decrypter detects messages that were
+	// tampered with or not sent by the expected sender.
+	Authenticated bool
+}
+
+// CiphertextSize returns the size of the ciphertext of a message of the size
+// given.
+func (m Metadata) CiphertextSize(messageSize int) int {
+	if m.MaxPlaintextSize > 0 {
+		return m.MaxPlaintextSize + m.Overhead
+	}
+	return messageSize + m.Overhead
+}
+
+// Describe is implemented by the ciphers that report their Metadata.
+type Describe interface {
+	Metadata() Metadata
+}
+
+// GetMetadata returns the metadata of the cipher, if it reports it.
+func GetMetadata(cipher Identification) (Metadata, bool) {
+	if d, ok := cipher.(Describe); ok {
+		return d.Metadata(), true
+	}
+	return Metadata{}, false
+}
+
+// Metadata reports no nonce or overhead.
+func (*NOOP) Metadata() Metadata {
+	return Metadata{}
+}
+
+// Metadata reports the OAEP limits of the recipient's key, and a nonce the
+// size of the sender's key when messages are signed, one byte more for an
+// encrypt-then-sign encrypter.  A hybrid encrypter has
+// no limit, and its overhead is that of a hybrid message, which is the most
+// a message can grow.
+func (c *rsaEncrypterDecrypter) Metadata() Metadata {
+	size := c.KeySize() / 8
+	overhead := 2*c.hasher.Size() + 2
+	m := Metadata{
+		Overhead:         overhead,
+		MaxPlaintextSize: size - overhead,
+	}
+	if c.hybrid {
+		// the GCM tag is 16 bytes
+		m.Overhead = size + 1 + rsaHybridNonceSize + 16
+		m.MaxPlaintextSize = 0
+	}
+	switch {
+	case c.senderPrivateKey != nil && c.encryptThenSign:
+		m.NonceSize = c.senderPrivateKey.Size() + 1
+	case c.senderPrivateKey != nil:
+		m.NonceSize = c.senderPrivateKey.Size()
+	case c.senderPublicKey != nil:
+		m.NonceSize = c.senderPublicKey.Size()
+	}
+	m.Authenticated = m.NonceSize > 0
+	return m
+}
+
+func boxMetadata() Metadata {
+	return Metadata{
+		NonceSize:     24,
+		Overhead:      box.Overhead,
+		Authenticated: true,
+	}
+}
+
+// Metadata reports the nonce size and overhead of box.
+func (enBox *encryptBox) Metadata() Metadata {
+	return boxMetadata()
+}
+
+// Metadata reports the nonce size and overhead of box.
+func (deBox *decryptBox) Metadata() Metadata {
+	return boxMetadata()
+}
+
+// Metadata reports the metadata of the first decrypter, if it has any.
+func (f *fallbackDecrypter) Metadata() Metadata {
+	m, _ := GetMetadata(f.decrypters[0])
+	return m
+}
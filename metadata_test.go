@@ -0,0 +1,74 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadata(t *testing.T) {
+	boxEncrypter, boxDecrypter := loadBoxPair(t)
+	recipientPrivateKey := GeneratePrivateKey(2048)
+	senderPrivateKey := GeneratePrivateKey(1024)
+	rsaEncrypter, err := NewRSAEncrypt(&recipientPrivateKey.PublicKey, WithHash(crypto.SHA256))
+	require.Nil(t, err)
+	signingEncrypter, err := NewRSAEncrypt(&recipientPrivateKey.PublicKey, WithHash(crypto.SHA256), WithSigningKey(senderPrivateKey))
+	require.Nil(t, err)
+
+	testData := []struct {
+		description string
+		cipher      Encrypt
+		expected    Metadata
+	}{
+		{"noop", DefaultCipherEncrypter(), Metadata{}},
+		{"box", boxEncrypter, Metadata{NonceSize: 24, Overhead: 16, Authenticated: true}},
+		{"rsa", rsaEncrypter, Metadata{Overhead: 66, MaxPlaintextSize: 190}},
+		{"rsa signed", signingEncrypter, Metadata{NonceSize: 128, Overhead: 66, MaxPlaintextSize: 190, Authenticated: true}},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			m, ok := GetMetadata(tc.cipher)
+			require.True(ok)
+			assert.Equal(tc.expected, m)
+
+			message := make([]byte, 100)
+			crypt, nonce, err := tc.cipher.EncryptMessage(message)
+			require.Nil(err)
+			assert.Len(crypt, m.CiphertextSize(len(message)))
+			assert.Len(nonce, m.NonceSize)
+			if m.MaxPlaintextSize > 0 {
+				_, _, err = tc.cipher.EncryptMessage(make([]byte, m.MaxPlaintextSize+1))
+				assert.NotNil(err)
+			}
+		})
+	}
+
+	m, ok := GetMetadata(boxDecrypter)
+	assert.True(t, ok)
+	assert.Equal(t, 24, m.NonceSize)
+	_, ok = GetMetadata(&reverser{})
+	assert.False(t, ok)
+}
@@ -0,0 +1,161 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+)
+
+// The labels of the LoaderMetrics.
+const (
+	OperationLabel = "operation"
+	AlgorithmLabel = "algorithm"
+	KIDLabel       = "kid"
+	ReasonLabel    = "reason"
+	KeyLabel       = "key"
+)
+
+// The reasons a load fails, used as the reason label of
+// LoaderMetrics.LoadFailures.
+const (
+	// ReasonUnknownAlgorithm is used when no loader is registered for the type.
+	ReasonUnknownAlgorithm = "unknown_algorithm"
+
+	// ReasonMissingKeys is used when the keys the algorithm needs aren't configured.
+	ReasonMissingKeys = "missing_keys"
+
+	// ReasonFIPS is used when FIPS mode refuses the algorithm.
+	ReasonFIPS = "fips"
+
+	// ReasonGenerate is used when missing keys couldn't be generated.
+	ReasonGenerate = "generate"
+
+	// ReasonCanceled is used when the context was canceled or timed out.
+	ReasonCanceled = "canceled"
+
+	// ReasonKeyMismatch is used when a public key doesn't belong to the
+	// private key configured with it.
+	ReasonKeyMismatch = "key_mismatch"
+
+	// ReasonLoad is used when the keys couldn't be read or parsed, or the
+	// cipher refused them.
+	ReasonLoad = "load"
+)
+
+const (
+	encryptOperation = "encrypt"
+	decryptOperation = "decrypt"
+)
+
+// LoaderMetrics are the go-kit metrics Config.LoadEncrypt and
+// Config.LoadDecrypt record, so a service can tell when and why it fell back
+// to NOOP.  Any of them may be nil.
+type LoaderMetrics struct {
+	// LoadAttempts counts loads, labeled by operation, algorithm and kid.
+	LoadAttempts metrics.Counter
+
+	// LoadFailures counts failed loads, labeled by operation, algorithm, kid
+	// and reason.
+	LoadFailures metrics.Counter
+
+	// KeySize is the size in bits of the key of the loaded cipher, labeled by
+	// operation, algorithm and kid.
+	KeySize metrics.Gauge
+
+	// KeyAge is how many seconds ago each key file was modified, labeled by
+	// algorithm, kid and key.  Only keys read from files are recorded.
+	KeyAge metrics.Gauge
+}
+
+func failureReason(ctx context.Context, err error) string {
+	switch {
+	case errors.Is(err, errIncorrectKeys):
+		return ReasonMissingKeys
+	case errors.Is(err, ErrKeyMismatch):
+		return ReasonKeyMismatch
+	case ctx.Err() != nil:
+		return ReasonCanceled
+	}
+	return ReasonLoad
+}
+
+// record records a load.  An empty reason means it succeeded.
+func (m *LoaderMetrics) record(operation string, config *Config, reason string, cipher Identification) {
+	if m == nil {
+		return
+	}
+	labels := []string{OperationLabel, operation, AlgorithmLabel, string(config.Type), KIDLabel, config.KID}
+
+	if m.LoadAttempts != nil {
+		m.LoadAttempts.With(labels...).Add(1)
+	}
+	if reason != "" {
+		if m.LoadFailures != nil {
+			m.LoadFailures.With(append(labels, ReasonLabel, reason)...).Add(1)
+		}
+		return
+	}
+
+	if m.KeySize != nil {
+		if bits := keySize(cipher); bits > 0 {
+			m.KeySize.With(labels...).Set(float64(bits))
+		}
+	}
+	if m.KeyAge != nil {
+		age := func(keyType KeyType) {
+			loader, ok := config.sourceLoader(keyType).(*FileLoader)
+			if !ok {
+				return
+			}
+			if info, err := os.Stat(loader.Path); err == nil {
+				m.KeyAge.With(AlgorithmLabel, string(config.Type), KIDLabel, config.KID, KeyLabel, string(keyType)).
+					Set(time.Since(info.ModTime()).Seconds())
+			}
+		}
+		for keyType := range config.Keys {
+			age(keyType)
+		}
+		for keyType := range config.Loaders {
+			if _, ok := config.Keys[keyType]; !ok {
+				age(keyType)
+			}
+		}
+	}
+}
+
+// keySize returns the size in bits of the main key of a built in cipher, or
+// zero if it isn't known.
+func keySize(cipher Identification) int {
+	switch c := cipher.(type) {
+	case *rsaEncrypterDecrypter:
+		if c.recipientPublicKey != nil {
+			return c.recipientPublicKey.N.BitLen()
+		}
+		if c.recipientPrivateKey != nil {
+			return c.recipientPrivateKey.N.BitLen()
+		}
+	case *encryptBox, *decryptBox:
+		return BoxKeySize * 8
+	}
+	return 0
+}
@@ -0,0 +1,148 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testMetric records the value of every label combination.
+type testMetric struct {
+	lock   *sync.Mutex
+	values map[string]float64
+	labels []string
+}
+
+func newTestMetric() *testMetric {
+	return &testMetric{lock: new(sync.Mutex), values: map[string]float64{}}
+}
+
+func (m *testMetric) With(labelValues ...string) metrics.Counter {
+	return &testMetric{lock: m.lock, values: m.values, labels: append(append([]string{}, m.labels...), labelValues...)}
+}
+
+func (m *testMetric) key() string {
+	return strings.Join(m.labels, ",")
+}
+
+func (m *testMetric) Add(delta float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.values[m.key()] += delta
+}
+
+func (m *testMetric) Set(value float64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.values[m.key()] = value
+}
+
+func (m *testMetric) get(labelValues ...string) (float64, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	value, ok := m.values[strings.Join(labelValues, ",")]
+	return value, ok
+}
+
+type testGauge struct {
+	*testMetric
+}
+
+func (g testGauge) With(labelValues ...string) metrics.Gauge {
+	return testGauge{g.testMetric.With(labelValues...).(*testMetric)}
+}
+
+func TestLoaderMetrics(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := os.Getwd()
+	require.Nil(err)
+
+	attempts, failures := newTestMetric(), newTestMetric()
+	keySize, keyAge := testGauge{newTestMetric()}, testGauge{newTestMetric()}
+	loaderMetrics := &LoaderMetrics{
+		LoadAttempts: attempts,
+		LoadFailures: failures,
+		KeySize:      keySize,
+		KeyAge:       keyAge,
+	}
+
+	config := Config{
+		Type:    Box,
+		KID:     "metered",
+		Metrics: loaderMetrics,
+		Keys: map[KeyType]string{
+			SenderPrivateKey:   dir + string(os.PathSeparator) + "sendBoxPrivate.pem",
+			RecipientPublicKey: dir + string(os.PathSeparator) + "boxPublic.pem",
+		},
+	}
+	_, err = config.LoadEncrypt()
+	require.Nil(err)
+	_, err = config.LoadDecrypt()
+	require.NotNil(err)
+
+	value, _ := attempts.get("operation", "encrypt", "algorithm", "box", "kid", "metered")
+	assert.Equal(1.0, value)
+	value, _ = attempts.get("operation", "decrypt", "algorithm", "box", "kid", "metered")
+	assert.Equal(1.0, value)
+	value, _ = failures.get("operation", "decrypt", "algorithm", "box", "kid", "metered", "reason", ReasonMissingKeys)
+	assert.Equal(1.0, value)
+	value, _ = keySize.get("operation", "encrypt", "algorithm", "box", "kid", "metered")
+	assert.Equal(256.0, value)
+	value, ok := keyAge.get("algorithm", "box", "kid", "metered", "key", "senderPrivateKey")
+	assert.True(ok)
+	assert.True(value > 0)
+
+	_, err = (&Config{Type: "unknown", Metrics: loaderMetrics}).LoadEncrypt()
+	require.NotNil(err)
+	value, _ = failures.get("operation", "encrypt", "algorithm", "unknown", "kid", "", "reason", ReasonUnknownAlgorithm)
+	assert.Equal(1.0, value)
+
+	rsaConfig := Config{
+		Type:    RSASymmetric,
+		Params:  map[string]string{"hash": "SHA512"},
+		Metrics: loaderMetrics,
+		Loaders: map[KeyType]KeyLoader{PublicKey: &FileLoader{Path: dir + string(os.PathSeparator) + "public.pem"}},
+	}
+	_, err = rsaConfig.LoadEncrypt()
+	require.Nil(err)
+	value, _ = keySize.get("operation", "encrypt", "algorithm", "rsa-sym", "kid", "")
+	assert.True(value >= 2048)
+	_, ok = keyAge.get("algorithm", "rsa-sym", "kid", "", "key", "publicKey")
+	assert.True(ok)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = rsaConfig.LoadEncryptContext(canceled)
+	require.NotNil(err)
+	value, _ = failures.get("operation", "encrypt", "algorithm", "rsa-sym", "kid", "", "reason", ReasonCanceled)
+	assert.Equal(1.0, value)
+
+	// metrics are optional
+	_, err = (&Config{Type: None, Metrics: &LoaderMetrics{}}).LoadEncrypt()
+	assert.Nil(err)
+}
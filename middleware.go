@@ -0,0 +1,244 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// The headers that carry the algorithm, KID and nonce of an encrypted HTTP
+// body.  The body itself is the ciphertext.  For the RSA algorithms the
+// nonce header holds the signature, if there is one.
+const (
+	HeaderAlgorithm = "X-Voynicrypto-Algorithm"
+	HeaderKID       = "X-Voynicrypto-Kid"
+	HeaderNonce     = "X-Voynicrypto-Nonce"
+)
+
+// DefaultMaxHTTPBodySize is the largest encrypted request body the
+// middleware reads when HTTPOptions.MaxBodySize isn't set.
+const DefaultMaxHTTPBodySize = 10 << 20
+
+var errBodyTooLarge = errors.New("encrypted body too large")
+
+// HTTPOptions configures NewHTTPMiddleware.
+type HTTPOptions struct {
+	// Router picks the decrypter of a request from its algorithm and KID
+	// headers.  It's required.
+	Router *Router
+
+	// Encrypter, if set, encrypts the response bodies.  The response is
+	// buffered until the handler returns, so streaming responses and
+	// http.Hijacker aren't supported.
+	Encrypter Encrypt
+
+	// AllowPlaintext lets requests without an algorithm header through
+	// unchanged.  By default they are rejected.
+	AllowPlaintext bool
+
+	// MaxBodySize is the largest encrypted request body that is read.  If
+	// not supplied, DefaultMaxHTTPBodySize is used instead.
+	MaxBodySize int64
+
+	// OnError, if set, is called with why a request was rejected or a
+	// response couldn't be encrypted.  The client only gets the status code,
+	// so details of the failure aren't leaked.
+	OnError func(r *http.Request, err error)
+}
+
+// NewHTTPMiddleware returns middleware that decrypts request bodies with the
+// decrypter the Router finds for their algorithm and KID headers, and
+// encrypts response bodies when an Encrypter is given.  The handler sees the
+// plain body, without the encryption headers.  Requests that can't be
+// decrypted get a 400, and bodies over the size limit a 413.
+func NewHTTPMiddleware(options HTTPOptions) (func(http.Handler) http.Handler, error) {
+	if options.Router == nil {
+		return nil, errors.New("no router")
+	}
+	if options.MaxBodySize <= 0 {
+		options.MaxBodySize = DefaultMaxHTTPBodySize
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(HeaderAlgorithm) != "" {
+				status, err := options.decryptRequest(r)
+				if err != nil {
+					options.fail(w, r, status, err)
+					return
+				}
+			} else if !options.AllowPlaintext {
+				options.fail(w, r, http.StatusBadRequest, errors.New("request is not encrypted"))
+				return
+			}
+
+			if options.Encrypter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			buffered := &bufferedResponse{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(buffered, r)
+			if err := EncryptResponse(w, options.Encrypter, buffered.status, buffered.body.Bytes()); err != nil {
+				options.fail(w, r, http.StatusInternalServerError, err)
+			}
+		})
+	}, nil
+}
+
+// decryptRequest replaces the encrypted body of the request with the plain
+// one, returning the status to reply with if it can't.
+func (o *HTTPOptions) decryptRequest(r *http.Request) (int, error) {
+	alg := canonicalAlgorithmType(r.Header.Get(HeaderAlgorithm))
+	decrypter, err := o.Router.Route(alg, r.Header.Get(HeaderKID))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	nonce, err := base64.RawURLEncoding.DecodeString(r.Header.Get(HeaderNonce))
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid nonce header: %w", err)
+	}
+	cipher, err := io.ReadAll(io.LimitReader(r.Body, o.MaxBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if int64(len(cipher)) > o.MaxBodySize {
+		return http.StatusRequestEntityTooLarge, errBodyTooLarge
+	}
+
+	message, err := decrypter.DecryptMessage(cipher, nonce)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(message))
+	r.ContentLength = int64(len(message))
+	r.Header.Set("Content-Length", strconv.Itoa(len(message)))
+	r.Header.Del(HeaderAlgorithm)
+	r.Header.Del(HeaderKID)
+	r.Header.Del(HeaderNonce)
+	return 0, nil
+}
+
+func (o *HTTPOptions) fail(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if o.OnError != nil {
+		o.OnError(r, err)
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+// bufferedResponse holds the response of the handler so it can be encrypted
+// once it's complete.
+type bufferedResponse struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if !b.wroteHeader {
+		b.status = status
+		b.wroteHeader = true
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.wroteHeader = true
+	return b.body.Write(p)
+}
+
+// EncryptRequest encrypts the body of a request and sets the headers the
+// middleware needs to decrypt it.
+func EncryptRequest(r *http.Request, encrypter Encrypt) error {
+	var message []byte
+	if r.Body != nil {
+		var err error
+		if message, err = io.ReadAll(r.Body); err != nil {
+			return err
+		}
+		r.Body.Close()
+	}
+	cipher, nonce, err := encrypter.EncryptMessage(message)
+	if err != nil {
+		return err
+	}
+	setEncryptionHeaders(r.Header, encrypter, nonce)
+	r.Body = io.NopCloser(bytes.NewReader(cipher))
+	r.ContentLength = int64(len(cipher))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(cipher)), nil
+	}
+	return nil
+}
+
+// EncryptResponse encrypts the body and writes it with the status and the
+// headers DecryptResponse needs.
+func EncryptResponse(w http.ResponseWriter, encrypter Encrypt, status int, body []byte) error {
+	cipher, nonce, err := encrypter.EncryptMessage(body)
+	if err != nil {
+		return err
+	}
+	setEncryptionHeaders(w.Header(), encrypter, nonce)
+	w.Header().Set("Content-Length", strconv.Itoa(len(cipher)))
+	w.WriteHeader(status)
+	_, err = w.Write(cipher)
+	return err
+}
+
+// DecryptResponse reads and decrypts the body of an encrypted response.  It
+// fails if the response's algorithm or KID don't match the decrypter.  The
+// body is closed.
+func DecryptResponse(resp *http.Response, decrypter Decrypt) ([]byte, error) {
+	defer resp.Body.Close()
+	e := Envelope{
+		Algorithm: canonicalAlgorithmType(resp.Header.Get(HeaderAlgorithm)),
+		KID:       resp.Header.Get(HeaderKID),
+	}
+	if e.Algorithm == "" {
+		return nil, errors.New("response is not encrypted")
+	}
+	nonce, err := base64.RawURLEncoding.DecodeString(resp.Header.Get(HeaderNonce))
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce header: %w", err)
+	}
+	if signs(e.Algorithm) {
+		e.Signature = nonce
+	} else {
+		e.Nonce = nonce
+	}
+	if e.Cipher, err = io.ReadAll(resp.Body); err != nil {
+		return nil, err
+	}
+	return e.Open(decrypter)
+}
+
+func setEncryptionHeaders(header http.Header, encrypter Encrypt, nonce []byte) {
+	header.Set(HeaderAlgorithm, string(encrypter.GetAlgorithm()))
+	if kid := encrypter.GetKID(); kid != "" {
+		header.Set(HeaderKID, kid)
+	} else {
+		header.Del(HeaderKID)
+	}
+	header.Set(HeaderNonce, base64.RawURLEncoding.EncodeToString(nonce))
+}
@@ -0,0 +1,132 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoHandler replies with the request body in upper case.
+var echoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if r.Header.Get(HeaderAlgorithm) != "" {
+		w.WriteHeader(http.StatusTeapot)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(bytes.ToUpper(body))
+})
+
+func TestHTTPMiddleware(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := loadBoxPair(t)
+	router := NewRouter(nil)
+	require.Nil(router.Register(decrypter))
+
+	var failures []error
+	middleware, err := NewHTTPMiddleware(HTTPOptions{
+		Router:    router,
+		Encrypter: encrypter,
+		OnError:   func(r *http.Request, err error) { failures = append(failures, err) },
+	})
+	require.Nil(err)
+	server := httptest.NewServer(middleware(echoHandler))
+	defer server.Close()
+
+	request, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("hello"))
+	require.Nil(err)
+	require.Nil(EncryptRequest(request, encrypter))
+	response, err := http.DefaultClient.Do(request)
+	require.Nil(err)
+	assert.Equal(http.StatusAccepted, response.StatusCode)
+	assert.Equal(string(Box), response.Header.Get(HeaderAlgorithm))
+	body, err := DecryptResponse(response, decrypter)
+	require.Nil(err)
+	assert.Equal("HELLO", string(body))
+
+	// plain requests and tampered bodies are rejected
+	response, err = http.Post(server.URL, "text/plain", strings.NewReader("hello"))
+	require.Nil(err)
+	response.Body.Close()
+	assert.Equal(http.StatusBadRequest, response.StatusCode)
+
+	request, err = http.NewRequest(http.MethodPost, server.URL, strings.NewReader("hello"))
+	require.Nil(err)
+	require.Nil(EncryptRequest(request, encrypter))
+	cipher, _ := io.ReadAll(request.Body)
+	cipher[0] ^= 1
+	request.Body = io.NopCloser(bytes.NewReader(cipher))
+	response, err = http.DefaultClient.Do(request)
+	require.Nil(err)
+	response.Body.Close()
+	assert.Equal(http.StatusBadRequest, response.StatusCode)
+
+	request, err = http.NewRequest(http.MethodPost, server.URL, strings.NewReader("hello"))
+	require.Nil(err)
+	require.Nil(EncryptRequest(request, encrypter))
+	request.Header.Set(HeaderKID, "unknown")
+	response, err = http.DefaultClient.Do(request)
+	require.Nil(err)
+	response.Body.Close()
+	assert.Equal(http.StatusBadRequest, response.StatusCode)
+	assert.Len(failures, 3)
+
+	_, err = NewHTTPMiddleware(HTTPOptions{})
+	assert.NotNil(err)
+}
+
+func TestHTTPMiddlewarePlaintext(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := loadBoxPair(t)
+	router := NewRouter(nil)
+	require.Nil(router.Register(decrypter))
+
+	middleware, err := NewHTTPMiddleware(HTTPOptions{Router: router, AllowPlaintext: true, MaxBodySize: 64})
+	require.Nil(err)
+	handler := middleware(echoHandler)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello")))
+	assert.Equal(http.StatusAccepted, recorder.Code)
+	assert.Equal("HELLO", recorder.Body.String())
+
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("hello"))
+	require.Nil(EncryptRequest(request, encrypter))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(http.StatusAccepted, recorder.Code)
+	assert.Equal("HELLO", recorder.Body.String())
+
+	request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("a", 100)))
+	require.Nil(EncryptRequest(request, encrypter))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(http.StatusRequestEntityTooLarge, recorder.Code)
+}
@@ -0,0 +1,91 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+// MQTTMessage is the part of a paho mqtt.Message that MQTTCodec reads.
+type MQTTMessage interface {
+	Topic() string
+	Payload() []byte
+}
+
+// MQTTCodec encrypts the payloads of MQTT publishes into envelopes and
+// decrypts received messages.  It needs no MQTT client: with paho, publish
+// the result of Seal, and in the message handler pass the mqtt.Message to
+// OpenMessage.  The topic is bound to each payload as associated data.
+//
+// Compact seals payloads in the compact envelope form, which saves about six
+// bytes plus the length of the algorithm name, for constrained devices with
+// small payload limits.  Open reads either form.
+type MQTTCodec struct {
+	// Encrypter encrypts published payloads.
+	Encrypter Encrypt
+
+	// Router finds the decrypter of received payloads.
+	Router *Router
+
+	// Compact seals payloads in compact envelopes.
+	Compact bool
+
+	// SealOptions are used when sealing payloads.  Compression can't be used
+	// with compact envelopes.
+	SealOptions []SealOption
+}
+
+// Seal seals the payload published on the topic.
+func (c *MQTTCodec) Seal(topic string, payload []byte) ([]byte, error) {
+	if c.Encrypter == nil {
+		return nil, errNoTransportCipher
+	}
+	e, err := SealEnvelopeWithAD(c.Encrypter, payload, transportAD("mqtt", topic), c.SealOptions...)
+	if err != nil {
+		return nil, err
+	}
+	if c.Compact {
+		return e.MarshalCompact()
+	}
+	return e.MarshalBinary()
+}
+
+// Open opens a payload received on the topic, in either envelope form.
+func (c *MQTTCodec) Open(topic string, data []byte) ([]byte, error) {
+	if c.Router == nil {
+		return nil, errNoTransportCipher
+	}
+	var (
+		e   Envelope
+		err error
+	)
+	if isCompactEnvelope(data) {
+		err = e.UnmarshalCompact(data)
+	} else {
+		err = e.UnmarshalBinary(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	decrypter, err := c.Router.Route(e.Algorithm, e.KID)
+	if err != nil {
+		return nil, err
+	}
+	return e.OpenWithAD(decrypter, transportAD("mqtt", topic))
+}
+
+// OpenMessage opens the payload of a received message.
+func (c *MQTTCodec) OpenMessage(msg MQTTMessage) ([]byte, error) {
+	return c.Open(msg.Topic(), msg.Payload())
+}
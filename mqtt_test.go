@@ -0,0 +1,71 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testMQTTMessage is like a paho mqtt.Message.
+type testMQTTMessage struct {
+	topic   string
+	payload []byte
+}
+
+func (m testMQTTMessage) Topic() string   { return m.topic }
+func (m testMQTTMessage) Payload() []byte { return m.payload }
+
+func TestMQTTCodec(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := aesGCMPair(t)
+	router := NewRouter(nil)
+	require.Nil(router.Register(decrypter))
+
+	codec := &MQTTCodec{Encrypter: encrypter, Router: router}
+	full, err := codec.Seal("devices/112233445566/status", []byte("online"))
+	require.Nil(err)
+	codec.Compact = true
+	compact, err := codec.Seal("devices/112233445566/status", []byte("online"))
+	require.Nil(err)
+	assert.Less(len(compact), len(full))
+
+	for _, data := range [][]byte{full, compact} {
+		payload, err := codec.OpenMessage(testMQTTMessage{topic: "devices/112233445566/status", payload: data})
+		require.Nil(err)
+		assert.Equal("online", string(payload))
+
+		_, err = codec.Open("devices/665544332211/status", data)
+		assert.NotNil(err, "topic is bound")
+	}
+
+	_, err = codec.Open("devices/112233445566/status", []byte{})
+	assert.NotNil(err)
+	_, err = codec.Open("devices/112233445566/status", []byte("VCE"))
+	assert.NotNil(err)
+
+	empty := &MQTTCodec{}
+	_, err = empty.Seal("topic", []byte("online"))
+	assert.Equal(errNoTransportCipher, err)
+	_, err = empty.Open("topic", compact)
+	assert.Equal(errNoTransportCipher, err)
+}
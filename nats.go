@@ -0,0 +1,122 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import "fmt"
+
+// NATSEncoder is the shape of nats.Encoder, the codec of a NATS
+// EncodedConn.
+type NATSEncoder interface {
+	Encode(subject string, v interface{}) ([]byte, error)
+	Decode(subject string, data []byte, vPtr interface{}) error
+}
+
+// NATSCodec encrypts the payloads of NATS messages into envelopes when they
+// are published and decrypts them when they are received.  It implements
+// nats.Encoder without depending on the NATS client, so it can be registered
+// with nats.RegisterEncoder and used by an EncodedConn.  With a plain
+// connection, pass Msg.Data through Seal and Open instead.  The subject is
+// bound to each payload as associated data.
+type NATSCodec struct {
+	// Encrypter encrypts published payloads.
+	Encrypter Encrypt
+
+	// Router finds the decrypter of received payloads.
+	Router *Router
+
+	// Codec, if set, turns values into payloads before they are sealed and
+	// back after they are opened, for example the nats JSON encoder.  By
+	// default values must be []byte or string.
+	Codec NATSEncoder
+
+	// SealOptions are used when sealing payloads, for example to compress
+	// them.
+	SealOptions []SealOption
+}
+
+// Seal seals the payload published on the subject into a marshalled
+// envelope.
+func (c *NATSCodec) Seal(subject string, payload []byte) ([]byte, error) {
+	if c.Encrypter == nil {
+		return nil, errNoTransportCipher
+	}
+	e, err := SealEnvelopeWithAD(c.Encrypter, payload, transportAD("nats", subject), c.SealOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return e.MarshalBinary()
+}
+
+// Open opens a payload received on the subject.
+func (c *NATSCodec) Open(subject string, data []byte) ([]byte, error) {
+	if c.Router == nil {
+		return nil, errNoTransportCipher
+	}
+	var e Envelope
+	if err := e.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	decrypter, err := c.Router.Route(e.Algorithm, e.KID)
+	if err != nil {
+		return nil, err
+	}
+	return e.OpenWithAD(decrypter, transportAD("nats", subject))
+}
+
+// Encode turns the value into a payload and seals it.
+func (c *NATSCodec) Encode(subject string, v interface{}) ([]byte, error) {
+	var payload []byte
+	if c.Codec != nil {
+		var err error
+		if payload, err = c.Codec.Encode(subject, v); err != nil {
+			return nil, err
+		}
+	} else {
+		switch value := v.(type) {
+		case []byte:
+			payload = value
+		case string:
+			payload = []byte(value)
+		default:
+			return nil, fmt.Errorf("can't encode a %T without a codec", v)
+		}
+	}
+	return c.Seal(subject, payload)
+}
+
+// Decode opens the payload and stores it in vPtr.
+func (c *NATSCodec) Decode(subject string, data []byte, vPtr interface{}) error {
+	payload, err := c.Open(subject, data)
+	if err != nil {
+		return err
+	}
+	if c.Codec != nil {
+		return c.Codec.Decode(subject, payload, vPtr)
+	}
+	switch ptr := vPtr.(type) {
+	case *[]byte:
+		*ptr = payload
+	case *string:
+		*ptr = string(payload)
+	case *interface{}:
+		*ptr = payload
+	default:
+		return fmt.Errorf("can't decode into a %T without a codec", vPtr)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jsonNATSEncoder is like the nats JSON encoder.
+type jsonNATSEncoder struct{}
+
+func (jsonNATSEncoder) Encode(subject string, v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonNATSEncoder) Decode(subject string, data []byte, vPtr interface{}) error {
+	return json.Unmarshal(data, vPtr)
+}
+
+func TestNATSCodec(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := aesGCMPair(t)
+	router := NewRouter(nil)
+	require.Nil(router.Register(decrypter))
+	codec := &NATSCodec{Encrypter: encrypter, Router: router}
+
+	data, err := codec.Encode("events.device", []byte("online"))
+	require.Nil(err)
+	assert.NotContains(string(data), "online")
+
+	var payload []byte
+	require.Nil(codec.Decode("events.device", data, &payload))
+	assert.Equal("online", string(payload))
+	var text string
+	require.Nil(codec.Decode("events.device", data, &text))
+	assert.Equal("online", text)
+	var value interface{}
+	require.Nil(codec.Decode("events.device", data, &value))
+	assert.Equal([]byte("online"), value)
+
+	assert.NotNil(codec.Decode("events.other", data, &payload), "subject is bound")
+	assert.NotNil(codec.Decode("events.device", []byte("garbage"), &payload))
+	assert.NotNil(codec.Decode("events.device", data, new(int)))
+	_, err = codec.Encode("events.device", 42)
+	assert.NotNil(err)
+
+	data, err = codec.Encode("events.device", "online")
+	require.Nil(err)
+	opened, err := codec.Open("events.device", data)
+	require.Nil(err)
+	assert.Equal("online", string(opened))
+
+	type event struct {
+		ID    string `json:"id"`
+		Count int    `json:"count"`
+	}
+	codec.Codec = jsonNATSEncoder{}
+	data, err = codec.Encode("events.device", event{ID: "mac:112233445566", Count: 3})
+	require.Nil(err)
+	var received event
+	require.Nil(codec.Decode("events.device", data, &received))
+	assert.Equal(event{ID: "mac:112233445566", Count: 3}, received)
+
+	empty := &NATSCodec{}
+	_, err = empty.Seal("events.device", []byte("online"))
+	assert.Equal(errNoTransportCipher, err)
+	_, err = empty.Open("events.device", data)
+	assert.Equal(errNoTransportCipher, err)
+}
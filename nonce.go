@@ -0,0 +1,205 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// NonceSource fills in the nonces of an AEAD cipher like box.  A nonce must
+// never be used twice with the same key.
+type NonceSource interface {
+	// NextNonce fills nonce with the next nonce.
+	NextNonce(nonce []byte) error
+}
+
+// NonceSourceFunc is a function that is a NonceSource, so the caller can
+// supply the nonces, for example to replay recorded messages in a test.
+type NonceSourceFunc func(nonce []byte) error
+
+// NextNonce calls the function.
+func (f NonceSourceFunc) NextNonce(nonce []byte) error {
+	return f(nonce)
+}
+
+type randomNonceSource struct {
+	random io.Reader
+}
+
+// NewRandomNonceSource returns a NonceSource that reads nonces from random.
+// If random is nil, crypto/rand is used.  This is what the ciphers use when
+// no NonceSource is given.
+func NewRandomNonceSource(random io.Reader) NonceSource {
+	if random == nil {
+		random = rand.Reader
+	}
+	return randomNonceSource{random: random}
+}
+
+// NextNonce reads the nonce from the random source.
+func (s randomNonceSource) NextNonce(nonce []byte) error {
+	if _, err := io.ReadFull(s.random, nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return nil
+}
+
+var defaultNonceSource = NewRandomNonceSource(nil)
+
+// boxNonceSource returns the nonce source of a box encrypter: nonces if it's
+// set, otherwise random nonces from random.  nil means the default.
+func boxNonceSource(nonces NonceSource, random io.Reader) NonceSource {
+	if nonces == nil && random != nil {
+		return NewRandomNonceSource(random)
+	}
+	return nonces
+}
+
+var errNonceExhausted = errors.New("nonce counter exhausted")
+
+// CounterNonceSource makes nonces from a fixed prefix followed by a big
+// endian counter in the last 8 bytes, for devices without a good source of
+// randomness.  The counter must never be reset while the key is in use, so it
+// should be persisted, and two senders sharing a key need different prefixes.
+// It is safe for concurrent use.
+type CounterNonceSource struct {
+	prefix []byte
+
+	lock      sync.Mutex
+	next      uint64
+	exhausted bool
+}
+
+// NewCounterNonceSource returns a CounterNonceSource whose first nonce uses
+// the counter start.
+func NewCounterNonceSource(prefix []byte, start uint64) *CounterNonceSource {
+	return &CounterNonceSource{
+		prefix: append([]byte{}, prefix...),
+		next:   start,
+	}
+}
+
+// Next returns the counter the next nonce will use.
+func (s *CounterNonceSource) Next() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.next
+}
+
+// NextNonce writes the prefix and the counter, zero filling the bytes
+// between them, and advances the counter.  It fails once the counter wraps.
+func (s *CounterNonceSource) NextNonce(nonce []byte) error {
+	if len(nonce) < len(s.prefix)+8 {
+		return errors.New("nonce is too small for the prefix and counter")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.exhausted {
+		return errNonceExhausted
+	}
+	counter := s.next
+	s.next++
+	s.exhausted = s.next == 0
+
+	copy(nonce, s.prefix)
+	wipe(nonce[len(s.prefix) : len(nonce)-8])
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], counter)
+	return nil
+}
+
+// DefaultEntropyBufferSize is the size of the buffer of NewBufferedRandom
+// when none is given.
+const DefaultEntropyBufferSize = 4096
+
+// bufferedRandom hands out bytes read from a random source in blocks.
+type bufferedRandom struct {
+	random io.Reader
+
+	lock   sync.Mutex
+	buffer []byte
+	next   int
+}
+
+// NewBufferedRandom returns a reader that reads random, crypto/rand if it's
+// nil, size bytes at a time and hands the bytes out to later reads, so
+// encrypting many small messages costs one system call per block rather than
+// one per nonce.  If size isn't positive DefaultEntropyBufferSize is used.
+//
+// Every byte is returned exactly once, even to concurrent readers, and is
+// zeroed in the buffer once it's been copied out, so nonces are as unique as
+// with crypto/rand and unused bytes can't be read back later.  Reads at least
+// as large as the buffer go straight to random.  If random fails the rest of
+// the block is dropped and the error returned.  The unused bytes stay in
+// memory until they're handed out, so don't use it where that matters more
+// than the cost of reading crypto/rand.
+//
+// It is safe for concurrent use, and can be given to WithRandom or to
+// NewRandomNonceSource.
+func NewBufferedRandom(random io.Reader, size int) io.Reader {
+	if random == nil {
+		random = rand.Reader
+	}
+	if size <= 0 {
+		size = DefaultEntropyBufferSize
+	}
+	buffer := make([]byte, size)
+	return &bufferedRandom{
+		random: random,
+		buffer: buffer,
+		next:   size,
+	}
+}
+
+// NewBufferedNonceSource returns a NonceSource that reads nonces from
+// NewBufferedRandom(random, size).
+func NewBufferedNonceSource(random io.Reader, size int) NonceSource {
+	return NewRandomNonceSource(NewBufferedRandom(random, size))
+}
+
+// Read fills p from the buffer, refilling it from the random source when it
+// runs out.
+func (r *bufferedRandom) Read(p []byte) (int, error) {
+	if len(p) >= len(r.buffer) {
+		return io.ReadFull(r.random, p)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	read := 0
+	for read < len(p) {
+		if r.next == len(r.buffer) {
+			if _, err := io.ReadFull(r.random, r.buffer); err != nil {
+				wipe(r.buffer)
+				return read, err
+			}
+			r.next = 0
+		}
+		n := copy(p[read:], r.buffer[r.next:])
+		wipe(r.buffer[r.next : r.next+n])
+		r.next += n
+		read += n
+	}
+	return read, nil
+}
@@ -0,0 +1,210 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounterNonceSource(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	source := NewCounterNonceSource([]byte{0xaa, 0xbb}, 1)
+	nonce := bytes.Repeat([]byte{0xff}, 12)
+	require.Nil(source.NextNonce(nonce))
+	assert.Equal([]byte{0xaa, 0xbb, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}, nonce)
+	require.Nil(source.NextNonce(nonce))
+	assert.Equal([]byte{0xaa, 0xbb, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2}, nonce)
+	assert.Equal(uint64(3), source.Next())
+
+	assert.NotNil(source.NextNonce(make([]byte, 9)), "no room for the counter")
+
+	source = NewCounterNonceSource(nil, math.MaxUint64)
+	assert.Nil(source.NextNonce(nonce))
+	assert.Equal(errNonceExhausted, source.NextNonce(nonce))
+	assert.Equal(errNonceExhausted, source.NextNonce(nonce), "the counter doesn't wrap")
+}
+
+func TestRandomNonceSource(t *testing.T) {
+	assert := assert.New(t)
+
+	nonce := make([]byte, 4)
+	assert.Nil(NewRandomNonceSource(bytes.NewReader([]byte{1, 2, 3, 4})).NextNonce(nonce))
+	assert.Equal([]byte{1, 2, 3, 4}, nonce)
+	assert.NotNil(NewRandomNonceSource(bytes.NewReader(nil)).NextNonce(nonce))
+}
+
+func TestBoxNonceSource(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	config := boxConfig(t, "")
+	config.NonceSource = NewCounterNonceSource(nil, 0)
+	encrypter, err := config.LoadEncrypt()
+	require.Nil(err)
+	decrypter, err := config.LoadDecrypt()
+	require.Nil(err)
+
+	first, nonce, err := encrypter.EncryptMessage([]byte("message"))
+	require.Nil(err)
+	assert.Equal(make([]byte, 24), nonce)
+	second, nonce, err := encrypter.EncryptMessage([]byte("message"))
+	require.Nil(err)
+	assert.Equal(byte(1), nonce[23])
+	assert.NotEqual(first, second)
+	decrypted, err := decrypter.DecryptMessage(second, nonce)
+	require.Nil(err)
+	assert.Equal([]byte("message"), decrypted)
+
+	// a fixed source replays the same message
+	var private, public [BoxKeySize]byte
+	fixed := NonceSourceFunc(func(nonce []byte) error {
+		copy(nonce, "recorded nonce")
+		return nil
+	})
+	replay, err := NewBoxEncrypt(private, public, WithNonceSource(fixed))
+	require.Nil(err)
+	first, _, err = replay.EncryptMessage([]byte("message"))
+	require.Nil(err)
+	second, _, err = replay.EncryptMessage([]byte("message"))
+	require.Nil(err)
+	assert.Equal(first, second)
+
+	failing := errors.New("no nonces left")
+	encrypter, err = NewBoxEncrypt(private, public, WithNonceSource(NonceSourceFunc(func([]byte) error {
+		return failing
+	})))
+	require.Nil(err)
+	_, _, err = encrypter.EncryptMessage([]byte("message"))
+	assert.Equal(failing, err)
+
+	_, err = NewBoxEncrypt(private, public, WithNonceSource(nil))
+	assert.NotNil(err)
+}
+
+func TestBufferedRandom(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	entropy := make([]byte, 100)
+	for i := range entropy {
+		entropy[i] = byte(i)
+	}
+
+	// the bytes come out in the order they were read, each once
+	random := NewBufferedRandom(bytes.NewReader(entropy), 16)
+	var result []byte
+	for _, size := range []int{3, 10, 1, 15, 7} {
+		p := make([]byte, size)
+		n, err := random.Read(p)
+		require.Nil(err)
+		assert.Equal(size, n)
+		result = append(result, p...)
+	}
+	assert.Equal(entropy[:len(result)], result)
+
+	// the unused bytes are wiped once they're handed out
+	buffered := random.(*bufferedRandom)
+	assert.Equal(make([]byte, buffered.next), buffered.buffer[:buffered.next])
+	assert.Equal(entropy[len(result):48], buffered.buffer[buffered.next:])
+
+	// large reads skip the buffer
+	p := make([]byte, 20)
+	_, err := random.Read(p)
+	require.Nil(err)
+	assert.Equal(entropy[48:68], p)
+
+	// a short source fails rather than repeating bytes
+	random = NewBufferedRandom(bytes.NewReader(entropy[:20]), 16)
+	p = make([]byte, 10)
+	_, err = random.Read(p)
+	require.Nil(err)
+	n, err := random.Read(p)
+	assert.NotNil(err)
+	assert.Equal(6, n)
+	assert.Equal(entropy[10:16], p[:n])
+
+	nonce := make([]byte, 24)
+	assert.Nil(NewBufferedNonceSource(nil, 0).NextNonce(nonce))
+	assert.NotEqual(make([]byte, 24), nonce)
+}
+
+func TestBufferedRandomConcurrent(t *testing.T) {
+	assert := assert.New(t)
+
+	entropy := make([]byte, 8*100*24)
+	for i := 0; i < len(entropy); i += 2 {
+		entropy[i], entropy[i+1] = byte(i>>8), byte(i)
+	}
+	source := NewBufferedNonceSource(bytes.NewReader(entropy), 960)
+
+	// every nonce is a distinct part of the entropy
+	nonces := make([][]byte, 8*100)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				nonce := make([]byte, 24)
+				if assert.Nil(source.NextNonce(nonce)) {
+					nonces[g*100+i] = nonce
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	seen := map[string]bool{}
+	for _, nonce := range nonces {
+		seen[string(nonce)] = true
+	}
+	assert.Len(seen, len(nonces))
+}
+
+func BenchmarkNonceSource(b *testing.B) {
+	sources := []struct {
+		description string
+		source      NonceSource
+	}{
+		{"crypto/rand", NewRandomNonceSource(nil)},
+		{"buffered", NewBufferedNonceSource(nil, 0)},
+	}
+
+	for _, s := range sources {
+		b.Run(s.description, func(b *testing.B) {
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				nonce := make([]byte, 24)
+				for pb.Next() {
+					if err := s.source.NextNonce(nonce); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,229 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"crypto/cipher"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// EncryptChunksParallel is EncryptChunks using up to workers goroutines, for
+// messages large enough that encryption is worth spreading across cores.
+// The chunks are the same as EncryptChunks makes, in the same order, so
+// DecryptChunks reads them.  The encrypter must be safe for concurrent use,
+// as the ciphers of this package are.  If workers isn't positive
+// runtime.GOMAXPROCS(0) is used.  The options are those of EncryptChunks.
+func EncryptChunksParallel(encrypter Encrypt, message []byte, chunkSize int, workers int, options ...CipherOption) ([]Chunk, error) {
+	s, err := newChunkSealer(encrypter, message, chunkSize, options)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make([]Chunk, s.count)
+	errs := make([]error, s.count)
+	runBatch(context.Background(), s.count, workers, func(i int) {
+		chunks[i], errs[i] = s.seal(i)
+	})
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return chunks, nil
+}
+
+// EncryptStreamParallel is EncryptStream sealing segments on up to workers
+// goroutines while they are written out in order, so encrypting a large
+// archive isn't limited to one core.  The stream is the same as EncryptStream
+// writes and is read by DecryptStream.  At most about three segments per
+// worker are held in memory.  dst is only written from one goroutine at a
+// time, and errors writing it are returned from a later Write or from Close.
+// If workers isn't positive runtime.GOMAXPROCS(0) is used.  The options are
+// those of EncryptStream.
+func EncryptStreamParallel(encrypter Encrypt, dst io.Writer, workers int, options ...CipherOption) (io.WriteCloser, error) {
+	o, err := newCipherOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := startStream(encrypter, dst, o.random)
+	if err != nil {
+		return nil, err
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	w := &parallelStreamWriter{
+		dst:     dst,
+		aead:    aead,
+		buffer:  getSegment(),
+		jobs:    make(chan *segmentJob),
+		ordered: make(chan *segmentJob, 2*workers),
+		done:    make(chan struct{}),
+	}
+	w.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go w.seal()
+	}
+	go w.write()
+	return w, nil
+}
+
+// segmentJob is one segment of a parallel stream.  ready is closed once it's
+// sealed.
+type segmentJob struct {
+	counter uint64
+	final   bool
+	plain   *[]byte
+	sealed  []byte
+	ready   chan struct{}
+}
+
+type parallelStreamWriter struct {
+	dst     io.Writer
+	aead    cipher.AEAD
+	buffer  *[]byte
+	counter uint64
+	closed  bool
+
+	// jobs hands segments to the sealing workers, and ordered hands them to
+	// the writer in the order of the stream.
+	jobs    chan *segmentJob
+	ordered chan *segmentJob
+	workers sync.WaitGroup
+	done    chan struct{}
+
+	lock sync.Mutex
+	err  error
+}
+
+// segmentPool keeps the plaintext buffers of parallel stream segments.
+var segmentPool = sync.Pool{
+	New: func() interface{} {
+		segment := make([]byte, 0, StreamSegmentSize)
+		return &segment
+	},
+}
+
+// getSegment returns an empty segment buffer from the pool.
+func getSegment() *[]byte {
+	segment := segmentPool.Get().(*[]byte)
+	*segment = (*segment)[:0]
+	return segment
+}
+
+// putSegment wipes the buffer, which held plaintext, and returns it to the
+// pool.
+func putSegment(segment *[]byte) {
+	wipe((*segment)[:cap(*segment)])
+	segmentPool.Put(segment)
+}
+
+func (w *parallelStreamWriter) getErr() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.err
+}
+
+// Write buffers the data and hands every full segment to the workers.
+func (w *parallelStreamWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errStreamClosed
+	}
+	if err := w.getErr(); err != nil {
+		return 0, err
+	}
+	written := 0
+	for len(p) > 0 {
+		buffer := *w.buffer
+		n := copy(buffer[len(buffer):cap(buffer)], p)
+		*w.buffer = buffer[:len(buffer)+n]
+		p = p[n:]
+		written += n
+
+		// a full segment is only sealed once more data arrives, since the
+		// last segment has to be marked as final
+		if len(*w.buffer) == cap(*w.buffer) && len(p) > 0 {
+			w.submit(false)
+		}
+	}
+	return written, nil
+}
+
+// Close seals the final segment and waits for every segment to be written.
+// It doesn't close the destination.
+func (w *parallelStreamWriter) Close() error {
+	if w.closed {
+		return w.getErr()
+	}
+	w.closed = true
+	w.submit(true)
+	putSegment(w.buffer)
+	w.buffer = nil
+	close(w.jobs)
+	close(w.ordered)
+	w.workers.Wait()
+	<-w.done
+	return w.getErr()
+}
+
+// submit queues the buffered data as the next segment.  It blocks while too
+// many segments are waiting to be written.
+func (w *parallelStreamWriter) submit(final bool) {
+	job := &segmentJob{
+		counter: w.counter,
+		final:   final,
+		plain:   w.buffer,
+		ready:   make(chan struct{}),
+	}
+	w.counter++
+	w.buffer = getSegment()
+	w.ordered <- job
+	w.jobs <- job
+}
+
+// seal is a worker sealing segments.
+func (w *parallelStreamWriter) seal() {
+	defer w.workers.Done()
+	for job := range w.jobs {
+		job.sealed = w.aead.Seal(nil, streamNonce(job.counter, job.final), *job.plain, nil)
+		putSegment(job.plain)
+		job.plain = nil
+		close(job.ready)
+	}
+}
+
+// write writes the sealed segments in order.  After an error the rest are
+// dropped, but still waited for so the workers aren't blocked.
+func (w *parallelStreamWriter) write() {
+	defer close(w.done)
+	for job := range w.ordered {
+		<-job.ready
+		if w.getErr() != nil {
+			continue
+		}
+		if err := writeStreamSegment(w.dst, job.sealed); err != nil {
+			w.lock.Lock()
+			w.err = err
+			w.lock.Unlock()
+		}
+	}
+}
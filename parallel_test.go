@@ -0,0 +1,166 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptChunksParallel(t *testing.T) {
+	encrypter, decrypter := loadBoxPair(t)
+
+	testData := []struct {
+		description string
+		size        int
+		chunkSize   int
+		workers     int
+		chunks      int
+	}{
+		{"empty", 0, 10, 4, 1},
+		{"one worker", 95, 10, 1, 10},
+		{"more workers than chunks", 25, 10, 8, 3},
+		{"default workers", 1000, 10, 0, 100},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			message := make([]byte, tc.size)
+			_, err := rand.Read(message)
+			require.Nil(err)
+
+			chunks, err := EncryptChunksParallel(encrypter, message, tc.chunkSize, tc.workers)
+			require.Nil(err)
+			assert.Len(chunks, tc.chunks)
+
+			result, err := DecryptChunks(decrypter, chunks)
+			require.Nil(err)
+			assert.True(bytes.Equal(message, result))
+		})
+	}
+}
+
+func TestEncryptStreamParallel(t *testing.T) {
+	encrypter, decrypter := loadBoxPair(t)
+
+	testData := []struct {
+		description string
+		size        int
+		workers     int
+	}{
+		{"empty", 0, 4},
+		{"partial segment", 100, 4},
+		{"exact segment", StreamSegmentSize, 4},
+		{"one worker", 3*StreamSegmentSize + 7, 1},
+		{"many segments", 20*StreamSegmentSize + 1, 4},
+		{"default workers", 5 * StreamSegmentSize, 0},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			message := make([]byte, tc.size)
+			_, err := rand.Read(message)
+			require.Nil(err)
+
+			var buffer bytes.Buffer
+			writer, err := EncryptStreamParallel(encrypter, &buffer, tc.workers)
+			require.Nil(err)
+			// odd sized writes cross segment boundaries
+			for data := message; len(data) > 0; {
+				n := 1000
+				if n > len(data) {
+					n = len(data)
+				}
+				_, err = writer.Write(data[:n])
+				require.Nil(err)
+				data = data[n:]
+			}
+			require.Nil(writer.Close())
+			assert.Nil(writer.Close())
+			_, err = writer.Write([]byte("late"))
+			assert.NotNil(err)
+
+			// the layout is the same as the sequential stream
+			assert.Equal(len(encryptStream(t, encrypter, message)), buffer.Len())
+
+			reader, err := DecryptStream(decrypter, &buffer)
+			require.Nil(err)
+			result, err := ioutil.ReadAll(reader)
+			require.Nil(err)
+			assert.True(bytes.Equal(message, result))
+		})
+	}
+}
+
+// shortWriter fails once more than limit bytes are written.
+type shortWriter struct {
+	limit int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		return 0, io.ErrShortWrite
+	}
+	w.limit -= len(p)
+	return len(p), nil
+}
+
+func TestEncryptStreamParallelWriteError(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, _ := loadBoxPair(t)
+
+	_, err := EncryptStreamParallel(encrypter, failingWriter{}, 2)
+	assert.NotNil(err)
+
+	// enough for the header but not the first segment
+	writer, err := EncryptStreamParallel(encrypter, &shortWriter{limit: 1024}, 2)
+	require.Nil(err)
+
+	data := make([]byte, StreamSegmentSize)
+	for i := 0; i < 10; i++ {
+		if _, err = writer.Write(data); err != nil {
+			break
+		}
+	}
+	assert.Equal(io.ErrShortWrite, writer.Close())
+}
+
+func TestSegmentPoolWipes(t *testing.T) {
+	assert := assert.New(t)
+
+	segment := getSegment()
+	assert.Empty(*segment)
+	*segment = append(*segment, "plaintext"...)
+	plain := (*segment)[:len("plaintext")]
+	putSegment(segment)
+	assert.Equal(make([]byte, len(plain)), plain)
+}
@@ -0,0 +1,228 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// PassphraseSource is where the passphrase of an encrypted key comes from.
+// Exactly one of the fields should be set.
+type PassphraseSource struct {
+	// Env is the environment variable holding the passphrase.
+	Env string `json:"env,omitempty"`
+
+	// File is the path of a file holding the passphrase.  A trailing newline
+	// is ignored.
+	File string `json:"file,omitempty"`
+
+	// Prompt asks for the passphrase with PassphrasePrompt, showing this
+	// text.  It's asked each time the key is loaded, and the answer is wiped
+	// once the key is decrypted.
+	Prompt string `json:"prompt,omitempty"`
+
+	// LegacyPEM allows keys encrypted as legacy PEM blocks, see
+	// PassphraseLoader.LegacyPEM.
+	LegacyPEM bool `json:"legacyPEM,omitempty"`
+}
+
+// PassphrasePrompt asks the user for a passphrase.  The default writes the
+// prompt to stderr and reads the passphrase from stdin, without echo when
+// stdin is a terminal.  Otherwise it reads a single line, leaving whatever
+// follows it for the next prompt.
+var PassphrasePrompt = func(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		passphrase, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return passphrase, err
+	}
+	return readLine(os.Stdin)
+}
+
+// readLine reads a line, including its newline, one byte at a time, so
+// nothing past it is read from r.  The buffers outgrown are wiped.
+func readLine(r io.Reader) ([]byte, error) {
+	line := make([]byte, 0, 64)
+	var b [1]byte
+	for {
+		n, err := r.Read(b[:])
+		if n == 1 {
+			if len(line) == cap(line) {
+				grown := make([]byte, len(line), 2*cap(line))
+				copy(grown, line)
+				wipe(line)
+				line = grown
+			}
+			line = append(line, b[0])
+			if b[0] == '\n' {
+				return line, nil
+			}
+		}
+		if err == io.EOF && len(line) > 0 {
+			return line, nil
+		}
+		if err != nil {
+			wipe(line)
+			return nil, err
+		}
+	}
+}
+
+// promptLoader asks for a passphrase with PassphrasePrompt.
+type promptLoader struct {
+	prompt string
+}
+
+func (p *promptLoader) GetBytes() ([]byte, error) {
+	passphrase, err := PassphrasePrompt(p.prompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return passphrase, nil
+}
+
+func (s PassphraseSource) loader() KeyLoader {
+	switch {
+	case s.Env != "":
+		return &EnvLoader{Name: s.Env}
+	case s.File != "":
+		return &FileLoader{Path: s.File}
+	case s.Prompt != "":
+		return &promptLoader{prompt: s.Prompt}
+	}
+	return &BytesLoader{}
+}
+
+// PassphraseLoader decrypts a passphrase protected PEM key so the usual
+// parsers can read it.  Encrypted OpenSSH keys are supported, and legacy
+// encrypted PEM blocks (with a Proc-Type header) when LegacyPEM is set; keys
+// that aren't encrypted are returned as they are.
+type PassphraseLoader struct {
+	// Loader loads the encrypted key.
+	Loader KeyLoader
+
+	// Passphrase loads the passphrase.  The bytes it returns aren't wiped, as
+	// loaders like BytesLoader keep them.
+	Passphrase KeyLoader
+
+	// LegacyPEM allows legacy encrypted PEM blocks, which are decrypted with
+	// x509.DecryptPEMBlock.  That encryption is insecure: it isn't
+	// authenticated, so it is open to padding oracle attacks, and a wrong
+	// passphrase isn't always detected.  Keys should be re-encrypted as
+	// OpenSSH keys instead; this is only for keys that can't be yet.
+	LegacyPEM bool
+
+	// wipePassphrase is set when the passphrase loader returns bytes of its
+	// own, which are wiped after use.
+	wipePassphrase bool
+}
+
+// GetBytes returns the decrypted key as PEM.
+func (p *PassphraseLoader) GetBytes() ([]byte, error) {
+	return p.GetBytesContext(context.Background())
+}
+
+// GetBytesContext returns the decrypted key as PEM, passing the context to
+// the key and passphrase loaders.
+func (p *PassphraseLoader) GetBytesContext(ctx context.Context) ([]byte, error) {
+	data, err := GetKeyBytes(ctx, p.Loader)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return data, nil
+	}
+	encrypted := x509.IsEncryptedPEMBlock(block)
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		return nil, errors.New("encrypted PKCS#8 keys are not supported")
+	case block.Type == "OPENSSH PRIVATE KEY":
+		if _, err := ssh.ParseRawPrivateKey(data); err == nil {
+			return data, nil
+		} else if _, ok := err.(*ssh.PassphraseMissingError); !ok {
+			return nil, err
+		}
+	case !encrypted:
+		return data, nil
+	case !p.LegacyPEM:
+		return nil, errors.New("legacy encrypted PEM keys are insecure and need LegacyPEM; re-encrypt the key as an OpenSSH key")
+	}
+
+	if p.Passphrase == nil {
+		return nil, errors.New("no passphrase loader")
+	}
+	passphrase, err := GetKeyBytes(ctx, p.Passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load passphrase: %w", err)
+	}
+	if p.wipePassphrase {
+		defer wipe(passphrase)
+	}
+	passphrase = bytes.TrimRight(passphrase, "\r\n")
+	if len(passphrase) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+
+	if encrypted {
+		decrypted, err := x509.DecryptPEMBlock(block, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt key: %w", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: decrypted}), nil
+	}
+
+	key, err := ssh.ParseRawPrivateKeyWithPassphrase(data, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key: %w", err)
+	}
+	return encodePrivateKeyPEM(key)
+}
+
+// encodePrivateKeyPEM encodes a private key in the format the parsers of
+// this package expect.
+func encodePrivateKeyPEM(key interface{}) ([]byte, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}), nil
+	case *ed25519.PrivateKey:
+		return encodePrivateKeyPEM(*k)
+	case ed25519.PrivateKey, *ecdsa.PrivateKey:
+		data, err := x509.MarshalPKCS8PrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: data}), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", key)
+}
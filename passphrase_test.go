@@ -0,0 +1,195 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestPassphraseConfig(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := os.Getwd()
+	require.Nil(err)
+
+	privateKey, err := GetPrivateKey(&FileLoader{Path: dir + string(os.PathSeparator) + "private.pem"})
+	require.Nil(err)
+	block, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(privateKey),
+		[]byte("secret"), x509.PEMCipherAES256)
+	require.Nil(err)
+
+	tmp := t.TempDir()
+	encryptedPath := filepath.Join(tmp, "encrypted.pem")
+	require.Nil(ioutil.WriteFile(encryptedPath, pem.EncodeToMemory(block), 0600))
+	passphrasePath := filepath.Join(tmp, "passphrase")
+	require.Nil(ioutil.WriteFile(passphrasePath, []byte("secret\n"), 0600))
+
+	os.Setenv("VOYNICRYPTO_TEST_PASSPHRASE", "secret")
+	defer os.Unsetenv("VOYNICRYPTO_TEST_PASSPHRASE")
+
+	prompt := PassphrasePrompt
+	defer func() { PassphrasePrompt = prompt }()
+	var answers [][]byte
+	PassphrasePrompt = func(string) ([]byte, error) {
+		answers = append(answers, []byte("secret\n"))
+		return answers[len(answers)-1], nil
+	}
+
+	testData := []struct {
+		description string
+		source      PassphraseSource
+		expectedErr bool
+	}{
+		{"env", PassphraseSource{Env: "VOYNICRYPTO_TEST_PASSPHRASE", LegacyPEM: true}, false},
+		{"file", PassphraseSource{File: passphrasePath, LegacyPEM: true}, false},
+		{"prompt", PassphraseSource{Prompt: "passphrase for private.pem: ", LegacyPEM: true}, false},
+		{"prompt again", PassphraseSource{Prompt: "passphrase for private.pem: ", LegacyPEM: true}, false},
+		{"wrong", PassphraseSource{File: encryptedPath, LegacyPEM: true}, true},
+		{"none", PassphraseSource{LegacyPEM: true}, true},
+		{"legacy not allowed", PassphraseSource{File: passphrasePath}, true},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			config := Config{
+				Type:   RSASymmetric,
+				Params: map[string]string{"hash": "SHA512"},
+				Keys: map[KeyType]string{
+					PublicKey:  dir + string(os.PathSeparator) + "public.pem",
+					PrivateKey: encryptedPath,
+				},
+				Passphrases: map[KeyType]PassphraseSource{
+					PrivateKey: tc.source,
+				},
+			}
+			if tc.expectedErr {
+				_, err := config.LoadDecrypt()
+				assert.NotNil(t, err)
+				return
+			}
+			testOptions(t, config, true)
+		})
+	}
+
+	// every load asks again, and the answers are wiped once used
+	assert.NotEmpty(t, answers)
+	for _, answer := range answers {
+		assert.Equal(t, make([]byte, len(answer)), answer)
+	}
+}
+
+func TestPassphraseLoader(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(err)
+
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(privateKey, "", []byte("secret"))
+	require.Nil(err)
+	loader := &PassphraseLoader{
+		Loader:     &BytesLoader{Data: pem.EncodeToMemory(block)},
+		Passphrase: &BytesLoader{Data: []byte("secret")},
+	}
+	parsed, err := GetEd25519PrivateKey(loader)
+	require.Nil(err)
+	assert.Equal(privateKey, parsed)
+
+	loader.Passphrase = &BytesLoader{Data: []byte("wrong")}
+	_, err = loader.GetBytes()
+	assert.NotNil(err)
+
+	// keys that aren't encrypted pass through
+	block, err = ssh.MarshalPrivateKey(privateKey, "")
+	require.Nil(err)
+	plain := pem.EncodeToMemory(block)
+	data, err := (&PassphraseLoader{Loader: &BytesLoader{Data: plain}}).GetBytes()
+	assert.Nil(err)
+	assert.Equal(plain, data)
+
+	_, err = (&PassphraseLoader{Loader: &BytesLoader{Data: pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY"})}}).GetBytes()
+	assert.NotNil(err)
+}
+
+func TestPassphraseLoaderContext(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	block, err := x509.EncryptPEMBlock(rand.Reader, "RSA PRIVATE KEY", []byte("key"), []byte("secret"), x509.PEMCipherAES256)
+	require.Nil(err)
+
+	testData := []struct {
+		description string
+		loader      *PassphraseLoader
+	}{
+		{"key", &PassphraseLoader{Loader: blockingLoader{}}},
+		{"passphrase", &PassphraseLoader{
+			Loader:     &BytesLoader{Data: pem.EncodeToMemory(block)},
+			Passphrase: blockingLoader{},
+			LegacyPEM:  true,
+		}},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			_, err := GetKeyBytes(ctx, tc.loader)
+			assert.True(errors.Is(err, context.DeadlineExceeded))
+		})
+	}
+}
+
+func TestReadLine(t *testing.T) {
+	assert := assert.New(t)
+
+	input := strings.NewReader("secret\nnext")
+	line, err := readLine(input)
+	assert.Nil(err)
+	assert.Equal("secret\n", string(line))
+
+	// nothing past the line was read
+	line, err = readLine(input)
+	assert.Nil(err)
+	assert.Equal("next", string(line))
+
+	_, err = readLine(input)
+	assert.Equal(io.EOF, err)
+
+	long := strings.Repeat("x", 200) + "\n"
+	line, err = readLine(strings.NewReader(long))
+	assert.Nil(err)
+	assert.Equal(long, string(line))
+}
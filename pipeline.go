@@ -0,0 +1,108 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"runtime"
+)
+
+// pipelineJob is one message of a pipeline.  ready is closed once it's
+// decrypted.
+type pipelineJob struct {
+	message EncryptedMessage
+	result  DecryptResult
+	ready   chan struct{}
+}
+
+// DecryptPipeline decrypts the messages received from in on up to workers
+// goroutines and sends a result for each on the returned channel, in the
+// order they were received, so a stream processor can keep consuming while
+// slow messages are decrypted.  A failed message doesn't stop the others.
+// At most about three messages per worker are in flight, so a slow consumer
+// holds back the input rather than buffering it.
+//
+// The returned channel is closed once in is closed and every result is sent,
+// or once the context is done; after that no more messages are read from in
+// and results still in flight are dropped.  The caller must either receive
+// every result or cancel the context.  If workers isn't positive
+// runtime.GOMAXPROCS(0) is used.
+func DecryptPipeline(ctx context.Context, decrypter Decrypt, in <-chan EncryptedMessage, workers int) <-chan DecryptResult {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	var (
+		jobs    = make(chan *pipelineJob)
+		ordered = make(chan *pipelineJob, 2*workers)
+		out     = make(chan DecryptResult)
+	)
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			for job := range jobs {
+				if err := ctx.Err(); err != nil {
+					job.result.Err = err
+				} else {
+					job.result.Message, job.result.Err = DecryptMessageContext(ctx, decrypter, job.message.Cipher, job.message.Nonce)
+				}
+				close(job.ready)
+			}
+		}()
+	}
+
+	// jobs are queued in order before the workers get them, so the results
+	// can be sent in order however long each takes
+	go func() {
+		defer close(jobs)
+		defer close(ordered)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message, ok := <-in:
+				if !ok {
+					return
+				}
+				job := &pipelineJob{message: message, ready: make(chan struct{})}
+				select {
+				case ordered <- job:
+				case <-ctx.Done():
+					return
+				}
+				jobs <- job
+			}
+		}
+	}()
+
+	go func() {
+		defer close(out)
+		for job := range ordered {
+			<-job.ready
+			if ctx.Err() != nil {
+				continue
+			}
+			select {
+			case out <- job.result:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return out
+}
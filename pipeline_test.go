@@ -0,0 +1,109 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jitteryDecrypter takes a random time to decrypt each message, so they
+// finish out of order.
+type jitteryDecrypter struct {
+	Decrypt
+}
+
+func (j jitteryDecrypter) DecryptMessage(cipher []byte, nonce []byte) ([]byte, error) {
+	time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+	return j.Decrypt.DecryptMessage(cipher, nonce)
+}
+
+func TestDecryptPipeline(t *testing.T) {
+	encrypter, decrypter := aesGCMPair(t)
+
+	for _, workers := range []int{0, 1, 4, 32} {
+		t.Run(fmt.Sprintf("workers %d", workers), func(t *testing.T) {
+			assert := assert.New(t)
+
+			in := make(chan EncryptedMessage)
+			go func() {
+				defer close(in)
+				for i := 0; i < 200; i++ {
+					cipher, nonce, err := encrypter.EncryptMessage([]byte(fmt.Sprintf("message %d", i)))
+					assert.Nil(err)
+					if i == 7 {
+						// one bad message doesn't stop the others
+						cipher = []byte("corrupt")
+					}
+					in <- EncryptedMessage{Cipher: cipher, Nonce: nonce}
+				}
+			}()
+
+			i := 0
+			for result := range DecryptPipeline(context.Background(), jitteryDecrypter{decrypter}, in, workers) {
+				if i == 7 {
+					assert.Equal(ErrDecryptFailed, result.Err)
+				} else if assert.Nil(result.Err) {
+					assert.Equal(fmt.Sprintf("message %d", i), string(result.Message))
+				}
+				i++
+			}
+			assert.Equal(200, i)
+		})
+	}
+}
+
+func TestDecryptPipelineCanceled(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := aesGCMPair(t)
+	cipher, nonce, err := encrypter.EncryptMessage([]byte("message"))
+	require.Nil(err)
+
+	// the input is never closed
+	in := make(chan EncryptedMessage, 10)
+	for i := 0; i < 10; i++ {
+		in <- EncryptedMessage{Cipher: cipher, Nonce: nonce}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := DecryptPipeline(ctx, decrypter, in, 2)
+	result := <-out
+	assert.Nil(result.Err)
+	assert.Equal("message", string(result.Message))
+
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range out {
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		assert.Fail("the pipeline didn't stop")
+	}
+}
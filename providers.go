@@ -0,0 +1,102 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// The Provide functions are plain constructors for dependency injection.
+// They fail rather than falling back to NOOP, so a misconfigured service
+// doesn't start.  With wire:
+//
+//	wire.NewSet(voynicrypto.ProvideEncrypt, voynicrypto.ProvideDecrypt)
+//
+// The voynifx package puts them into an uber fx graph, so this package
+// doesn't depend on fx.
+
+// ProvideOptions reads Options from the cipher key of the viper instance.
+func ProvideOptions(v *viper.Viper) (Options, error) {
+	return FromViper(v)
+}
+
+// ProvideEncrypt validates the config and loads an encrypter from it.
+func ProvideEncrypt(config Config) (Encrypt, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid cipher config: %w", err)
+	}
+	encrypter, err := config.LoadEncrypt()
+	if err != nil {
+		return nil, err
+	}
+	return encrypter, nil
+}
+
+// ProvideDecrypt validates the config and loads a decrypter from it.
+func ProvideDecrypt(config Config) (Decrypt, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid cipher config: %w", err)
+	}
+	decrypter, err := config.LoadDecrypt()
+	if err != nil {
+		return nil, err
+	}
+	return decrypter, nil
+}
+
+// ProvideOptionsEncrypt loads the encrypter of the first config that loads,
+// like Options.GetEncrypter.
+func ProvideOptionsEncrypt(o Options) (Encrypt, error) {
+	if len(o) == 0 {
+		return nil, errors.New("no cipher configs")
+	}
+	encrypter, err := o.GetEncrypter(nil)
+	if err != nil {
+		return nil, err
+	}
+	return encrypter, nil
+}
+
+// ProvideCiphers validates the options and loads every decrypter, keyed by
+// algorithm and KID.
+func ProvideCiphers(o Options) (*Ciphers, error) {
+	if err := o.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid cipher config: %w", err)
+	}
+	ciphers, err := o.LoadCiphers()
+	if err != nil {
+		return nil, err
+	}
+	return &ciphers, nil
+}
+
+// ProvideRouter returns a Router with every decrypter of the ciphers
+// registered.
+func ProvideRouter(ciphers *Ciphers) (*Router, error) {
+	if ciphers == nil {
+		return nil, errors.New("no ciphers")
+	}
+	router := NewRouter(nil)
+	if err := router.AddCiphers(*ciphers); err != nil {
+		return nil, err
+	}
+	return router, nil
+}
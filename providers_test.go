@@ -0,0 +1,80 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviders(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	v := viper.New()
+	path, err := os.Getwd()
+	require.Nil(err)
+	v.AddConfigPath(path)
+	v.SetConfigName("boxRecipient")
+	require.Nil(v.ReadInConfig())
+
+	options, err := ProvideOptions(v)
+	require.Nil(err)
+
+	ciphers, err := ProvideCiphers(options)
+	require.Nil(err)
+	_, ok := ciphers.Get(Box, "test")
+	assert.True(ok)
+
+	router, err := ProvideRouter(ciphers)
+	require.Nil(err)
+	_, err = router.Route(Box, "test")
+	assert.Nil(err)
+
+	_, err = ProvideRouter(nil)
+	assert.NotNil(err)
+
+	decrypter, err := ProvideDecrypt(options[0])
+	require.Nil(err)
+	assert.NotNil(decrypter)
+
+	// unlike LoadEncrypt, there is no NOOP fallback
+	encrypter, err := ProvideEncrypt(Config{Type: Box})
+	assert.NotNil(err)
+	assert.Nil(encrypter)
+
+	_, err = ProvideDecrypt(Config{Type: Box, Keys: map[KeyType]string{
+		RecipientPrivateKey: path + string(os.PathSeparator) + "missing.pem",
+		SenderPublicKey:     path + string(os.PathSeparator) + "sendBoxPublic.pem",
+	}})
+	assert.NotNil(err)
+
+	encrypter, err = ProvideOptionsEncrypt(Options{{Type: None}})
+	assert.Nil(err)
+	assert.Equal(None, encrypter.GetAlgorithm())
+
+	_, err = ProvideOptionsEncrypt(nil)
+	assert.NotNil(err)
+
+	_, err = ProvideCiphers(Options{{Type: "unknown"}})
+	assert.NotNil(err)
+}
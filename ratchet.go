@@ -0,0 +1,349 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// RatchetKeySize is the size of the key a RatchetSession starts from.
+const RatchetKeySize = 32
+
+// MaxRatchetSkip is how many messages a receiving RatchetSession can skip
+// ahead, and how many keys of skipped messages it keeps so they can still
+// be read when they arrive late.
+const MaxRatchetSkip = 1000
+
+// ratchetStateVersion is the first byte of a marshalled RatchetSession.
+const ratchetStateVersion = 1
+
+var (
+	errRatchetSkip   = errors.New("too many skipped messages")
+	errRatchetReplay = errors.New("message already received")
+	errRatchetState  = errors.New("invalid ratchet session state")
+)
+
+// RatchetSession is a symmetric cipher whose key moves forward with every
+// message.  Each message is sealed with AES-GCM under its own key derived
+// from a chain key, and the chain key is then replaced by a hash of itself
+// and wiped, so a session that leaks can't read the messages before it.
+//
+// A session only goes one way: the sender and the receiver each start a
+// session from the same key, usually one from KeyAgreement.DeriveKey, and a
+// channel that goes both ways needs two keys.  The nonce of each message is
+// its number, which lets the receiver skip ahead over lost messages and
+// still read them if they arrive late, up to MaxRatchetSkip of them.
+// Messages can only be read once.
+//
+// The session state changes with every message, so a long lived channel
+// should save it with MarshalBinary and restore it with UnmarshalBinary.  It
+// is safe for concurrent use.
+type RatchetSession struct {
+	kid      string
+	chainKey []byte
+	counter  uint64
+	skipped  map[uint64][]byte
+	closed   bool
+	lock     sync.Mutex
+}
+
+// NewRatchetSession starts a session from a RatchetKeySize byte key.  Only
+// WithKID is used from the options.  The key is copied, and CloseCipher
+// wipes the session's keys.
+func NewRatchetSession(key []byte, options ...CipherOption) (*RatchetSession, error) {
+	if err := checkFIPSAlgorithm(Ratchet); err != nil {
+		return nil, err
+	}
+	if len(key) != RatchetKeySize {
+		return nil, fmt.Errorf("ratchet key must be %d bytes, got %d", RatchetKeySize, len(key))
+	}
+	o, err := newCipherOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	return &RatchetSession{
+		kid:      o.kid,
+		chainKey: append([]byte{}, key...),
+		skipped:  map[uint64][]byte{},
+	}, nil
+}
+
+// GetAlgorithm returns the algorithm type.
+func (s *RatchetSession) GetAlgorithm() AlgorithmType {
+	return Ratchet
+}
+
+// GetKID returns the KID.
+func (s *RatchetSession) GetKID() string {
+	return s.kid
+}
+
+// Counter returns the number of the next message the session expects to
+// send or receive.
+func (s *RatchetSession) Counter() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.counter
+}
+
+// ratchetStep derives the key of a message and the next chain key from a
+// chain key.
+func ratchetStep(chainKey []byte) (messageKey []byte, nextChainKey []byte) {
+	mac := hmac.New(sha256.New, chainKey)
+	mac.Write([]byte{1})
+	messageKey = mac.Sum(nil)
+
+	mac.Reset()
+	mac.Write([]byte{2})
+	return messageKey, mac.Sum(nil)
+}
+
+// ratchetNonce is the message number in the last 8 bytes of a GCM nonce.
+// Every message has its own key, so the nonce only has to tell the receiver
+// which key that is.
+func ratchetNonce(counter uint64) []byte {
+	nonce := make([]byte, aesGCMNonceSize)
+	binary.BigEndian.PutUint64(nonce[aesGCMNonceSize-8:], counter)
+	return nonce
+}
+
+func parseRatchetNonce(nonce []byte) (uint64, error) {
+	if err := checkNonceSize(nonce, aesGCMNonceSize); err != nil {
+		return 0, err
+	}
+	for _, b := range nonce[:aesGCMNonceSize-8] {
+		if b != 0 {
+			return 0, fmt.Errorf("%w: not a ratchet nonce", ErrInvalidNonce)
+		}
+	}
+	return binary.BigEndian.Uint64(nonce[aesGCMNonceSize-8:]), nil
+}
+
+// EncryptMessage seals the message under the next message key and moves the
+// session forward.
+func (s *RatchetSession) EncryptMessage(message []byte) ([]byte, []byte, error) {
+	return s.EncryptMessageWithAD(message, nil)
+}
+
+// EncryptMessageWithAD seals the message, authenticating ad along with it.
+func (s *RatchetSession) EncryptMessageWithAD(message []byte, ad []byte) ([]byte, []byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil, nil, errCipherClosed
+	}
+
+	messageKey, nextChainKey := ratchetStep(s.chainKey)
+	defer wipe(messageKey)
+	aead, err := newAESGCM(messageKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := ratchetNonce(s.counter)
+	sealed := aead.Seal(nil, nonce, message, ad)
+
+	wipe(s.chainKey)
+	s.chainKey = nextChainKey
+	s.counter++
+	return sealed, nonce, nil
+}
+
+// DecryptMessage opens the message with the key of its number.  The session
+// only moves forward if the message is authentic.
+func (s *RatchetSession) DecryptMessage(cipher []byte, nonce []byte) ([]byte, error) {
+	return s.DecryptMessageWithAD(cipher, nonce, nil)
+}
+
+// DecryptMessageWithAD opens the message, which must have been sealed with
+// the same ad.
+func (s *RatchetSession) DecryptMessageWithAD(cipher []byte, nonce []byte, ad []byte) ([]byte, error) {
+	counter, err := parseRatchetNonce(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil, errCipherClosed
+	}
+
+	if counter < s.counter {
+		messageKey, ok := s.skipped[counter]
+		if !ok {
+			return nil, fmt.Errorf("%w: %w", ErrDecryptFailed, errRatchetReplay)
+		}
+		message, err := openRatchet(messageKey, nonce, cipher, ad)
+		if err != nil {
+			return nil, err
+		}
+		wipe(messageKey)
+		delete(s.skipped, counter)
+		return message, nil
+	}
+	if counter-s.counter > MaxRatchetSkip {
+		return nil, fmt.Errorf("%w: %w", ErrDecryptFailed, errRatchetSkip)
+	}
+
+	// step forward on copies, and only keep them if the message is authentic
+	chainKey := append([]byte{}, s.chainKey...)
+	skipped := map[uint64][]byte{}
+	for next := s.counter; next < counter; next++ {
+		var nextChainKey []byte
+		skipped[next], nextChainKey = ratchetStep(chainKey)
+		wipe(chainKey)
+		chainKey = nextChainKey
+	}
+	messageKey, nextChainKey := ratchetStep(chainKey)
+	wipe(chainKey)
+	defer wipe(messageKey)
+
+	message, err := openRatchet(messageKey, nonce, cipher, ad)
+	if err != nil {
+		wipe(nextChainKey)
+		for _, key := range skipped {
+			wipe(key)
+		}
+		return nil, err
+	}
+
+	for next, key := range skipped {
+		s.skipped[next] = key
+	}
+	s.dropOldestSkipped()
+	wipe(s.chainKey)
+	s.chainKey = nextChainKey
+	s.counter = counter + 1
+	return message, nil
+}
+
+func openRatchet(messageKey []byte, nonce []byte, cipher []byte, ad []byte) ([]byte, error) {
+	aead, err := newAESGCM(messageKey)
+	if err != nil {
+		return nil, err
+	}
+	message, err := aead.Open(nil, nonce, cipher, ad)
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+	return message, nil
+}
+
+// dropOldestSkipped forgets the oldest skipped message keys beyond
+// MaxRatchetSkip.
+func (s *RatchetSession) dropOldestSkipped() {
+	if len(s.skipped) <= MaxRatchetSkip {
+		return
+	}
+	counters := s.skippedCounters()
+	for _, counter := range counters[:len(counters)-MaxRatchetSkip] {
+		wipe(s.skipped[counter])
+		delete(s.skipped, counter)
+	}
+}
+
+func (s *RatchetSession) skippedCounters() []uint64 {
+	counters := make([]uint64, 0, len(s.skipped))
+	for counter := range s.skipped {
+		counters = append(counters, counter)
+	}
+	sort.Slice(counters, func(i, j int) bool { return counters[i] < counters[j] })
+	return counters
+}
+
+// MarshalBinary encodes the session state: the chain key, the next message
+// number and the keys of skipped messages.  The state holds secret keys and
+// must be stored as carefully as the key the session started from.  The KID
+// isn't included.
+func (s *RatchetSession) MarshalBinary() ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil, errCipherClosed
+	}
+
+	data := make([]byte, 0, 1+8+RatchetKeySize+4+len(s.skipped)*(8+RatchetKeySize))
+	data = append(data, ratchetStateVersion)
+	data = binary.BigEndian.AppendUint64(data, s.counter)
+	data = append(data, s.chainKey...)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(s.skipped)))
+	for _, counter := range s.skippedCounters() {
+		data = binary.BigEndian.AppendUint64(data, counter)
+		data = append(data, s.skipped[counter]...)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary restores the session state from MarshalBinary, replacing
+// the current state.  The KID is kept.
+func (s *RatchetSession) UnmarshalBinary(data []byte) error {
+	const header = 1 + 8 + RatchetKeySize + 4
+	if len(data) < header || data[0] != ratchetStateVersion {
+		return errRatchetState
+	}
+	count := binary.BigEndian.Uint32(data[header-4:])
+	if count > MaxRatchetSkip || len(data) != header+int(count)*(8+RatchetKeySize) {
+		return errRatchetState
+	}
+
+	skipped := make(map[uint64][]byte, count)
+	for rest := data[header:]; len(rest) > 0; rest = rest[8+RatchetKeySize:] {
+		skipped[binary.BigEndian.Uint64(rest)] = append([]byte{}, rest[8:8+RatchetKeySize]...)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.wipeKeys()
+	s.counter = binary.BigEndian.Uint64(data[1:])
+	s.chainKey = append([]byte{}, data[1+8:1+8+RatchetKeySize]...)
+	s.skipped = skipped
+	s.closed = false
+	return nil
+}
+
+func (s *RatchetSession) wipeKeys() {
+	wipe(s.chainKey)
+	for counter, key := range s.skipped {
+		wipe(key)
+		delete(s.skipped, counter)
+	}
+}
+
+// Metadata reports the nonce size and tag of GCM.
+func (s *RatchetSession) Metadata() Metadata {
+	return Metadata{
+		NonceSize:     aesGCMNonceSize,
+		Overhead:      16, // the GCM tag
+		Authenticated: true,
+	}
+}
+
+// Close wipes the chain key and the keys of skipped messages.
+func (s *RatchetSession) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	s.wipeKeys()
+	return nil
+}
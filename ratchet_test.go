@@ -0,0 +1,135 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ratchetPair(t *testing.T) (*RatchetSession, *RatchetSession) {
+	key := make([]byte, RatchetKeySize)
+	key[0] = 1
+	sender, err := NewRatchetSession(key, WithKID("ratchet"))
+	require.Nil(t, err)
+	receiver, err := NewRatchetSession(key, WithKID("ratchet"))
+	require.Nil(t, err)
+	return sender, receiver
+}
+
+func TestRatchetSession(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	sender, receiver := ratchetPair(t)
+	assert.Equal(Ratchet, sender.GetAlgorithm())
+	assert.Equal("ratchet", receiver.GetKID())
+	testCryptoPair(t, sender, receiver, false)
+
+	// the same message is sealed under a new key every time
+	first, firstNonce, err := sender.EncryptMessage([]byte("message"))
+	require.Nil(err)
+	second, secondNonce, err := sender.EncryptMessage([]byte("message"))
+	require.Nil(err)
+	assert.NotEqual(first, second)
+
+	message, err := receiver.DecryptMessage(first, firstNonce)
+	require.Nil(err)
+	assert.Equal("message", string(message))
+
+	// messages can only be read once
+	_, err = receiver.DecryptMessage(first, firstNonce)
+	assert.True(errors.Is(err, ErrDecryptFailed))
+
+	// a forged message doesn't move the session forward
+	forged := append([]byte{}, second...)
+	forged[0] ^= 1
+	_, err = receiver.DecryptMessage(forged, secondNonce)
+	assert.True(errors.Is(err, ErrDecryptFailed))
+	message, err = receiver.DecryptMessage(second, secondNonce)
+	require.Nil(err)
+	assert.Equal("message", string(message))
+	assert.Equal(sender.Counter(), receiver.Counter())
+
+	_, err = receiver.DecryptMessage(second, secondNonce[1:])
+	assert.NotNil(err)
+}
+
+func TestRatchetSessionSkip(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	sender, receiver := ratchetPair(t)
+
+	ciphers := make([][]byte, 5)
+	nonces := make([][]byte, 5)
+	for i := range ciphers {
+		var err error
+		ciphers[i], nonces[i], err = EncryptMessageWithAD(sender, []byte{byte(i)}, []byte("header"))
+		require.Nil(err)
+	}
+
+	// out of order, with the skipped keys surviving a save and restore
+	message, err := DecryptMessageWithAD(receiver, ciphers[3], nonces[3], []byte("header"))
+	require.Nil(err)
+	assert.Equal([]byte{3}, message)
+
+	state, err := receiver.MarshalBinary()
+	require.Nil(err)
+	restored, err := NewRatchetSession(make([]byte, RatchetKeySize))
+	require.Nil(err)
+	require.Nil(restored.UnmarshalBinary(state))
+	assert.Equal(uint64(4), restored.Counter())
+
+	for _, i := range []int{0, 4, 2, 1} {
+		message, err := DecryptMessageWithAD(restored, ciphers[i], nonces[i], []byte("header"))
+		require.Nil(err)
+		assert.Equal([]byte{byte(i)}, message)
+	}
+	_, err = DecryptMessageWithAD(restored, ciphers[3], nonces[3], []byte("header"))
+	assert.True(errors.Is(err, ErrDecryptFailed))
+
+	// too far ahead
+	_, err = receiver.DecryptMessage(ciphers[0], ratchetNonce(MaxRatchetSkip+10))
+	assert.True(errors.Is(err, ErrDecryptFailed))
+
+	assert.NotNil(restored.UnmarshalBinary(state[:10]))
+	assert.NotNil(restored.UnmarshalBinary(append([]byte{9}, state[1:]...)))
+}
+
+func TestRatchetSessionClose(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	_, err := NewRatchetSession(make([]byte, 16))
+	assert.NotNil(err)
+
+	sender, _ := ratchetPair(t)
+	require.Nil(CloseCipher(sender))
+	_, _, err = sender.EncryptMessage([]byte("message"))
+	assert.Equal(errCipherClosed, err)
+	_, err = sender.MarshalBinary()
+	assert.Equal(errCipherClosed, err)
+
+	m, ok := GetMetadata(sender)
+	assert.True(ok)
+	assert.True(m.Authenticated)
+}
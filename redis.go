@@ -0,0 +1,140 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RedisCodec encrypts values stored in Redis into envelopes and decrypts the
+// values read back.  It needs no Redis client: seal the value before SET and
+// open it after GET, or use EncryptedRedis to do both.  The key is bound to
+// each value as associated data.
+type RedisCodec struct {
+	// Encrypter encrypts the values written.
+	Encrypter Encrypt
+
+	// Router finds the decrypter of the values read.
+	Router *Router
+
+	// SealOptions are used when sealing values.
+	SealOptions []SealOption
+}
+
+// Seal seals the value stored at the key.
+func (c *RedisCodec) Seal(key string, value []byte) ([]byte, error) {
+	if c.Encrypter == nil {
+		return nil, errNoTransportCipher
+	}
+	e, err := SealEnvelopeWithAD(c.Encrypter, value, transportAD("redis", key), c.SealOptions...)
+	if err != nil {
+		return nil, err
+	}
+	return e.MarshalBinary()
+}
+
+// Open opens a value read from the key.
+func (c *RedisCodec) Open(key string, value []byte) ([]byte, error) {
+	if c.Router == nil {
+		return nil, errNoTransportCipher
+	}
+	var e Envelope
+	if err := e.UnmarshalBinary(value); err != nil {
+		return nil, err
+	}
+	decrypter, err := c.Router.Route(e.Algorithm, e.KID)
+	if err != nil {
+		return nil, err
+	}
+	return e.OpenWithAD(decrypter, transportAD("redis", key))
+}
+
+// OpenValues opens the values read from the keys by an MGET, in the same
+// order.  The result of a missing key, which is nil, stays nil.  It fails if
+// any value can't be opened.
+func (c *RedisCodec) OpenValues(keys []string, values [][]byte) ([][]byte, error) {
+	if len(keys) != len(values) {
+		return nil, fmt.Errorf("%d values read for %d keys", len(values), len(keys))
+	}
+	opened := make([][]byte, len(values))
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		message, err := c.Open(keys[i], value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open value of %s: %w", keys[i], err)
+		}
+		opened[i] = message
+	}
+	return opened, nil
+}
+
+// RedisStore is the part of a Redis client EncryptedRedis wraps.  A few lines
+// adapt a go-redis client to it, for example Get can be
+//
+//	func (a adapter) Get(ctx context.Context, key string) ([]byte, error) {
+//		return a.client.Get(ctx, key).Bytes()
+//	}
+//
+// and MGet converts the string results, leaving missing keys nil.
+type RedisStore interface {
+	Set(ctx context.Context, key string, value []byte, expiration time.Duration) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	MGet(ctx context.Context, keys ...string) ([][]byte, error)
+}
+
+// EncryptedRedis is a RedisStore that encrypts values before they are set in
+// the store it wraps and decrypts them after they are read, so values cached
+// in a shared cluster are protected.  Errors of the store, like a missing key,
+// are returned as they are.
+type EncryptedRedis struct {
+	RedisCodec
+
+	// Store is the store of the encrypted values.
+	Store RedisStore
+}
+
+// Set seals the value and sets it at the key.
+func (r *EncryptedRedis) Set(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	sealed, err := r.Seal(key, value)
+	if err != nil {
+		return err
+	}
+	return r.Store.Set(ctx, key, sealed, expiration)
+}
+
+// Get reads the value at the key and opens it.
+func (r *EncryptedRedis) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := r.Store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return r.Open(key, value)
+}
+
+// MGet reads the values at the keys and opens them.  Missing keys are nil.
+func (r *EncryptedRedis) MGet(ctx context.Context, keys ...string) ([][]byte, error) {
+	values, err := r.Store.MGet(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+	return r.OpenValues(keys, values)
+}
@@ -0,0 +1,116 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ RedisStore = (*EncryptedRedis)(nil)
+
+var errRedisNil = errors.New("redis: nil")
+
+// mapRedis is a RedisStore backed by a map.
+type mapRedis map[string][]byte
+
+func (m mapRedis) Set(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	m[key] = value
+	return nil
+}
+
+func (m mapRedis) Get(ctx context.Context, key string) ([]byte, error) {
+	value, ok := m[key]
+	if !ok {
+		return nil, errRedisNil
+	}
+	return value, nil
+}
+
+func (m mapRedis) MGet(ctx context.Context, keys ...string) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = m[key]
+	}
+	return values, nil
+}
+
+func TestEncryptedRedis(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := aesGCMPair(t)
+	router := NewRouter(nil)
+	require.Nil(router.Register(decrypter))
+
+	ctx := context.Background()
+	store := mapRedis{}
+	redis := &EncryptedRedis{RedisCodec: RedisCodec{Encrypter: encrypter, Router: router}, Store: store}
+
+	require.Nil(redis.Set(ctx, "user:1:email", []byte("alice@example.com"), time.Minute))
+	require.Nil(redis.Set(ctx, "user:2:email", []byte("bob@example.com"), time.Minute))
+	assert.NotContains(string(store["user:1:email"]), "alice")
+
+	value, err := redis.Get(ctx, "user:1:email")
+	require.Nil(err)
+	assert.Equal("alice@example.com", string(value))
+
+	_, err = redis.Get(ctx, "user:3:email")
+	assert.Equal(errRedisNil, err)
+
+	values, err := redis.MGet(ctx, "user:2:email", "user:3:email", "user:1:email")
+	require.Nil(err)
+	assert.Equal([][]byte{[]byte("bob@example.com"), nil, []byte("alice@example.com")}, values)
+
+	// a value copied to another key can't be read
+	store["user:2:email"] = store["user:1:email"]
+	_, err = redis.Get(ctx, "user:2:email")
+	assert.NotNil(err)
+	_, err = redis.MGet(ctx, "user:1:email", "user:2:email")
+	assert.Contains(err.Error(), "user:2:email")
+
+	store["user:4:email"] = []byte("plain")
+	_, err = redis.Get(ctx, "user:4:email")
+	assert.NotNil(err)
+}
+
+func TestRedisCodecErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	var codec RedisCodec
+	_, err := codec.Seal("key", []byte("value"))
+	assert.Equal(errNoTransportCipher, err)
+	_, err = codec.Open("key", []byte("value"))
+	assert.Equal(errNoTransportCipher, err)
+
+	codec.Router = NewRouter(nil)
+	_, err = codec.OpenValues([]string{"a", "b"}, [][]byte{nil})
+	assert.NotNil(err)
+
+	encrypter, _ := aesGCMPair(t)
+	codec.Encrypter = encrypter
+	sealed, err := codec.Seal("key", []byte("value"))
+	assert.Nil(err)
+	_, err = codec.Open("key", sealed)
+	assert.ErrorIs(err, ErrKeyNotFound)
+}
@@ -0,0 +1,67 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ReEncrypt opens the envelope with the old key and seals the message with
+// the new one, for backfilling stored data after a key rotation.  The message
+// is compressed the same way it was before.
+func ReEncrypt(oldDecrypter Decrypt, newEncrypter Encrypt, e *Envelope) (*Envelope, error) {
+	message, err := e.Open(oldDecrypter)
+	if err != nil {
+		return nil, err
+	}
+	return SealEnvelope(newEncrypter, message, WithCompression(e.Compression))
+}
+
+// ReEncryptWithAD is ReEncrypt for envelopes sealed with associated data.  The
+// same associated data is bound to the new envelope.
+func ReEncryptWithAD(oldDecrypter Decrypt, newEncrypter Encrypt, e *Envelope, ad []byte) (*Envelope, error) {
+	message, err := e.OpenWithAD(oldDecrypter, ad)
+	if err != nil {
+		return nil, err
+	}
+	return SealEnvelopeWithAD(newEncrypter, message, ad, WithCompression(e.Compression))
+}
+
+// ReEncryptAll runs ReEncrypt on every envelope.  Envelopes that fail are
+// left nil in the result and don't stop the others; their errors are
+// returned joined, each naming the index of its envelope.
+func ReEncryptAll(oldDecrypter Decrypt, newEncrypter Encrypt, envelopes []*Envelope) ([]*Envelope, error) {
+	var (
+		results = make([]*Envelope, len(envelopes))
+		errs    []error
+	)
+	for i, e := range envelopes {
+		if e == nil {
+			errs = append(errs, fmt.Errorf("envelope[%d]: no envelope", i))
+			continue
+		}
+		result, err := ReEncrypt(oldDecrypter, newEncrypter, e)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("envelope[%d]: %w", i, err))
+			continue
+		}
+		results[i] = result
+	}
+	return results, errors.Join(errs...)
+}
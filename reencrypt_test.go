@@ -0,0 +1,93 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReEncrypt(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	oldEncrypter, oldDecrypter := loadBoxPair(t)
+	privateKey := GeneratePrivateKey(2048)
+	newEncrypter := NewRSAEncrypter(DefaultRSAHash, nil, &privateKey.PublicKey, "new")
+	newDecrypter := NewRSADecrypter(DefaultRSAHash, privateKey, nil, "new")
+
+	e, err := SealEnvelope(oldEncrypter, []byte("hello"))
+	require.Nil(err)
+	e, err = ReEncrypt(oldDecrypter, newEncrypter, e)
+	require.Nil(err)
+	assert.Equal(RSASymmetric, e.Algorithm)
+	assert.Equal("new", e.KID)
+	message, err := e.Open(newDecrypter)
+	require.Nil(err)
+	assert.Equal([]byte("hello"), message)
+
+	_, err = ReEncrypt(oldDecrypter, newEncrypter, e)
+	assert.NotNil(err, "already re-encrypted")
+
+	// associated data is carried over
+	ad := []byte("device")
+	e, err = SealEnvelopeWithAD(oldEncrypter, []byte("hello"), ad)
+	require.Nil(err)
+	_, err = ReEncryptWithAD(oldDecrypter, newEncrypter, e, []byte("other"))
+	assert.NotNil(err)
+	e, err = ReEncryptWithAD(oldDecrypter, newEncrypter, e, ad)
+	require.Nil(err)
+	_, err = e.Open(newDecrypter)
+	assert.NotNil(err, "associated data is required")
+	message, err = e.OpenWithAD(newDecrypter, ad)
+	require.Nil(err)
+	assert.Equal([]byte("hello"), message)
+}
+
+func TestReEncryptAll(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	oldEncrypter, oldDecrypter := loadBoxPair(t)
+	newEncrypter := DefaultCipherEncrypter()
+
+	good, err := SealEnvelope(oldEncrypter, []byte("good"))
+	require.Nil(err)
+	bad := &Envelope{Algorithm: Box, Cipher: []byte("bad")}
+
+	results, err := ReEncryptAll(oldDecrypter, newEncrypter, []*Envelope{good, bad, nil, good})
+	require.NotNil(err)
+	assert.Contains(err.Error(), "envelope[1]")
+	assert.Contains(err.Error(), "envelope[2]")
+	assert.NotContains(err.Error(), "envelope[0]")
+
+	require.Len(results, 4)
+	assert.Nil(results[1])
+	assert.Nil(results[2])
+	for _, i := range []int{0, 3} {
+		message, err := results[i].Open(DefaultCipherDecrypter())
+		require.Nil(err)
+		assert.Equal([]byte("good"), message)
+	}
+
+	results, err = ReEncryptAll(oldDecrypter, newEncrypter, nil)
+	assert.Nil(err)
+	assert.Empty(results)
+}
@@ -0,0 +1,270 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// EncrypterFactory builds an encrypter from a config.
+type EncrypterFactory func(ctx context.Context, config *Config) (Encrypt, error)
+
+// DecrypterFactory builds a decrypter from a config.
+type DecrypterFactory func(ctx context.Context, config *Config) (Decrypt, error)
+
+var (
+	registryLock       sync.RWMutex
+	encrypterFactories = map[AlgorithmType]EncrypterFactory{
+		None:          loadNoneEncrypt,
+		Box:           loadBoxEncrypt,
+		BoxEphemeral:  loadBoxEphemeralEncrypt,
+		RSASymmetric:  loadRSASymmetricEncrypt,
+		RSAAsymmetric: loadRSAAsymmetricEncrypt,
+	}
+	decrypterFactories = map[AlgorithmType]DecrypterFactory{
+		None:          loadNoneDecrypt,
+		Box:           loadBoxDecrypt,
+		BoxEphemeral:  loadBoxEphemeralDecrypt,
+		RSASymmetric:  loadRSASymmetricDecrypt,
+		RSAAsymmetric: loadRSAAsymmetricDecrypt,
+	}
+)
+
+// RegisterEncrypterLoader registers the factory Config.LoadEncrypt uses for
+// the algorithm, so packages can add their own ciphers.  An algorithm can only
+// be registered once.
+func RegisterEncrypterLoader(alg AlgorithmType, factory EncrypterFactory) error {
+	if alg == "" {
+		return errors.New("no algorithm type specified")
+	}
+	if factory == nil {
+		return errors.New("no factory")
+	}
+
+	if !validName(string(alg)) {
+		return errors.New("invalid algorithm type " + string(alg))
+	}
+
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if _, ok := encrypterFactories[alg]; ok {
+		return errors.New("encrypter for algorithm " + string(alg) + " already registered")
+	}
+	if existing, ok := findAlgorithm(alg); ok && existing != alg {
+		return errors.New("algorithm " + string(alg) + " clashes with " + string(existing))
+	}
+	encrypterFactories[alg] = factory
+	return nil
+}
+
+// RegisterDecrypterLoader registers the factory Config.LoadDecrypt uses for
+// the algorithm, so packages can add their own ciphers.  An algorithm can only
+// be registered once.
+func RegisterDecrypterLoader(alg AlgorithmType, factory DecrypterFactory) error {
+	if alg == "" {
+		return errors.New("no algorithm type specified")
+	}
+	if factory == nil {
+		return errors.New("no factory")
+	}
+
+	if !validName(string(alg)) {
+		return errors.New("invalid algorithm type " + string(alg))
+	}
+
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if _, ok := decrypterFactories[alg]; ok {
+		return errors.New("decrypter for algorithm " + string(alg) + " already registered")
+	}
+	if existing, ok := findAlgorithm(alg); ok && existing != alg {
+		return errors.New("algorithm " + string(alg) + " clashes with " + string(existing))
+	}
+	decrypterFactories[alg] = factory
+	return nil
+}
+
+func getEncrypterFactory(alg AlgorithmType) (EncrypterFactory, error) {
+	if alg == "" {
+		return nil, errors.New("no algorithm type specified")
+	}
+
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	if resolved, ok := findAlgorithm(alg); ok {
+		alg = resolved
+	}
+	if factory, ok := encrypterFactories[alg]; ok {
+		return factory, nil
+	}
+	return nil, fmt.Errorf("%w: no encrypter registered for algorithm %s", ErrUnknownAlgorithm, string(alg))
+}
+
+func getDecrypterFactory(alg AlgorithmType) (DecrypterFactory, error) {
+	if alg == "" {
+		return nil, errors.New("no algorithm type specified")
+	}
+
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	if resolved, ok := findAlgorithm(alg); ok {
+		alg = resolved
+	}
+	if factory, ok := decrypterFactories[alg]; ok {
+		return factory, nil
+	}
+	return nil, fmt.Errorf("%w: no decrypter registered for algorithm %s", ErrUnknownAlgorithm, string(alg))
+}
+
+// RegisteredAlgorithms returns the algorithms that have an encrypter or a
+// decrypter registered, including the built in ones, sorted by name.
+func RegisteredAlgorithms() []AlgorithmType {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	algs := []AlgorithmType{}
+	for alg := range encrypterFactories {
+		algs = append(algs, alg)
+	}
+	for alg := range decrypterFactories {
+		if _, ok := encrypterFactories[alg]; !ok {
+			algs = append(algs, alg)
+		}
+	}
+	sort.Slice(algs, func(i, j int) bool { return algs[i] < algs[j] })
+	return algs
+}
+
+func loadNoneEncrypt(context.Context, *Config) (Encrypt, error) {
+	return DefaultCipherEncrypter(), nil
+}
+
+func loadNoneDecrypt(context.Context, *Config) (Decrypt, error) {
+	return DefaultCipherDecrypter(), nil
+}
+
+func loadBoxEncrypt(ctx context.Context, config *Config) (Encrypt, error) {
+	if !hasBothEncryptKeys(config) {
+		return nil, errIncorrectKeys
+	}
+	boxLoader := BoxLoader{
+		KID:         config.KID,
+		PrivateKey:  config.keyLoader(SenderPrivateKey),
+		PublicKey:   config.keyLoader(RecipientPublicKey),
+		NonceSource: config.NonceSource,
+		Random:      config.Random,
+	}
+	return boxLoader.LoadEncryptContext(ctx)
+}
+
+func loadBoxDecrypt(ctx context.Context, config *Config) (Decrypt, error) {
+	if !hasBothDecryptKeys(config) {
+		return nil, errIncorrectKeys
+	}
+	boxLoader := BoxLoader{
+		KID:        config.KID,
+		PrivateKey: config.keyLoader(RecipientPrivateKey),
+		PublicKey:  config.keyLoader(SenderPublicKey),
+	}
+	return boxLoader.LoadDecryptContext(ctx)
+}
+
+func loadRSASymmetricEncrypt(ctx context.Context, config *Config) (Encrypt, error) {
+	if !config.hasKey(PublicKey) {
+		return nil, errIncorrectKeys
+	}
+	hybrid, err := config.hybridParam()
+	if err != nil {
+		return nil, err
+	}
+	rsaLoader := RSALoader{
+		KID:       config.KID,
+		Hash:      &BasicHashLoader{HashName: config.Params["hash"]},
+		PublicKey: config.keyLoader(PublicKey),
+		Strict:    config.Strict,
+		Random:    config.Random,
+		Pool:      config.RSAPool,
+		Hybrid:    hybrid,
+	}
+	return rsaLoader.LoadEncryptContext(ctx)
+}
+
+func loadRSASymmetricDecrypt(ctx context.Context, config *Config) (Decrypt, error) {
+	if !config.hasKey(PrivateKey) {
+		return nil, errIncorrectKeys
+	}
+	rsaLoader := RSALoader{
+		KID:        config.KID,
+		Hash:       &BasicHashLoader{HashName: config.Params["hash"]},
+		PrivateKey: config.keyLoader(PrivateKey),
+		Strict:     config.Strict,
+		Random:     config.Random,
+		Pool:       config.RSAPool,
+	}
+	return rsaLoader.LoadDecryptContext(ctx)
+}
+
+func loadRSAAsymmetricEncrypt(ctx context.Context, config *Config) (Encrypt, error) {
+	if !hasBothEncryptKeys(config) {
+		return nil, errIncorrectKeys
+	}
+	hybrid, err := config.hybridParam()
+	if err != nil {
+		return nil, err
+	}
+	encryptThenSign, err := config.encryptThenSignParam()
+	if err != nil {
+		return nil, err
+	}
+	rsaLoader := RSALoader{
+		KID:             config.KID,
+		Hash:            &BasicHashLoader{HashName: config.Params["hash"]},
+		PrivateKey:      config.keyLoader(SenderPrivateKey),
+		PublicKey:       config.keyLoader(RecipientPublicKey),
+		Strict:          config.Strict,
+		Random:          config.Random,
+		Pool:            config.RSAPool,
+		Hybrid:          hybrid,
+		EncryptThenSign: encryptThenSign,
+	}
+	return rsaLoader.LoadEncryptContext(ctx)
+}
+
+func loadRSAAsymmetricDecrypt(ctx context.Context, config *Config) (Decrypt, error) {
+	if !hasBothDecryptKeys(config) {
+		return nil, errIncorrectKeys
+	}
+	rsaLoader := RSALoader{
+		KID:        config.KID,
+		Hash:       &BasicHashLoader{HashName: config.Params["hash"]},
+		PrivateKey: config.keyLoader(RecipientPrivateKey),
+		PublicKey:  config.keyLoader(SenderPublicKey),
+		Strict:     config.Strict,
+		Random:     config.Random,
+		Pool:       config.RSAPool,
+	}
+	return rsaLoader.LoadDecryptContext(ctx)
+}
@@ -0,0 +1,146 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reverser is a toy cipher used to test the registry.
+type reverser struct {
+	kid string
+}
+
+func (r *reverser) GetAlgorithm() AlgorithmType {
+	return "test-reverse"
+}
+
+func (r *reverser) GetKID() string {
+	return r.kid
+}
+
+func (r *reverser) EncryptMessage(message []byte) ([]byte, []byte, error) {
+	return reverse(message), []byte{}, nil
+}
+
+func (r *reverser) DecryptMessage(cipher []byte, nonce []byte) ([]byte, error) {
+	return reverse(cipher), nil
+}
+
+func reverse(data []byte) []byte {
+	reversed := make([]byte, len(data))
+	for i, b := range data {
+		reversed[len(data)-1-i] = b
+	}
+	return reversed
+}
+
+func TestRegistry(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	const alg = AlgorithmType("test-reverse")
+
+	require.Nil(RegisterEncrypterLoader(alg, func(ctx context.Context, config *Config) (Encrypt, error) {
+		return &reverser{kid: config.KID}, nil
+	}))
+	require.Nil(RegisterDecrypterLoader(alg, func(ctx context.Context, config *Config) (Decrypt, error) {
+		return &reverser{kid: config.KID}, nil
+	}))
+
+	config := Config{Type: alg, KID: "backwards"}
+	encrypter, err := config.LoadEncrypt()
+	require.Nil(err)
+	assert.Equal(alg, encrypter.GetAlgorithm())
+	assert.Equal("backwards", encrypter.GetKID())
+
+	decrypter, err := config.LoadDecrypt()
+	require.Nil(err)
+	testCryptoPair(t, encrypter, decrypter, false)
+
+	// algorithms can only be registered once
+	assert.NotNil(RegisterEncrypterLoader(alg, func(context.Context, *Config) (Encrypt, error) { return nil, nil }))
+	assert.NotNil(RegisterDecrypterLoader(Box, func(context.Context, *Config) (Decrypt, error) { return nil, nil }))
+
+	assert.NotNil(RegisterEncrypterLoader("", func(context.Context, *Config) (Encrypt, error) { return nil, nil }))
+	assert.NotNil(RegisterDecrypterLoader("test-nil", nil))
+}
+
+func TestUnregisteredAlgorithm(t *testing.T) {
+	assert := assert.New(t)
+
+	config := Config{Type: "test-unknown"}
+	encrypter, err := config.LoadEncrypt()
+	assert.NotNil(err)
+	assert.Equal(None, encrypter.GetAlgorithm())
+
+	decrypter, err := config.LoadDecrypt()
+	assert.NotNil(err)
+	assert.Equal(None, decrypter.GetAlgorithm())
+
+	assert.True(errors.Is(err, ErrUnknownAlgorithm))
+
+	_, err = (&Config{}).LoadEncrypt()
+	assert.NotNil(err)
+}
+
+func TestUserDefinedAlgorithm(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// the config is decoded before its algorithm is registered
+	var config Config
+	require.Nil(json.Unmarshal([]byte(`{"type": "Acme_Proprietary", "kid": "acme"}`), &config))
+	assert.Equal(AlgorithmType("Acme_Proprietary"), config.Type)
+	assert.NotNil(config.Validate())
+
+	const alg = AlgorithmType("acme-proprietary")
+	require.Nil(RegisterEncrypterLoader(alg, func(ctx context.Context, config *Config) (Encrypt, error) {
+		return &reverser{kid: config.KID}, nil
+	}))
+	require.Nil(RegisterDecrypterLoader(alg, func(ctx context.Context, config *Config) (Decrypt, error) {
+		return &reverser{kid: config.KID}, nil
+	}))
+	assert.Contains(RegisteredAlgorithms(), alg)
+	assert.Contains(RegisteredAlgorithms(), Box)
+
+	assert.Nil(config.Validate())
+	encrypter, err := config.LoadEncrypt()
+	require.Nil(err)
+	assert.Equal("acme", encrypter.GetKID())
+	decrypter, err := config.LoadDecrypt()
+	require.Nil(err)
+	testCryptoPair(t, encrypter, decrypter, false)
+
+	parsed, err := ParseAlgorithm("ACME proprietary")
+	require.Nil(err)
+	assert.Equal(alg, parsed)
+
+	// names that differ only in case or punctuation can't both be registered
+	assert.NotNil(RegisterEncrypterLoader("ACME_PROPRIETARY", func(context.Context, *Config) (Encrypt, error) { return nil, nil }))
+	assert.NotNil(RegisterEncrypterLoader("RSA_SYM", func(context.Context, *Config) (Encrypt, error) { return nil, nil }))
+	assert.NotNil(RegisterEncrypterLoader("acme/other", func(context.Context, *Config) (Encrypt, error) { return nil, nil }))
+
+	assert.NotNil(json.Unmarshal([]byte(`{"type": "acme proprietary!"}`), &config))
+}
@@ -0,0 +1,416 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ConfigSource provides the current Config to a ConfigManager.
+type ConfigSource interface {
+	GetConfig(ctx context.Context) (Config, error)
+}
+
+// ConfigSourceFunc is a function that is a ConfigSource.
+type ConfigSourceFunc func(ctx context.Context) (Config, error)
+
+// GetConfig calls the function.
+func (f ConfigSourceFunc) GetConfig(ctx context.Context) (Config, error) {
+	return f(ctx)
+}
+
+// FileConfigSource reads a JSON encoded Config from a file.
+type FileConfigSource struct {
+	Path string
+}
+
+// GetConfig reads and decodes the file.
+func (f *FileConfigSource) GetConfig(ctx context.Context) (Config, error) {
+	var config Config
+	data, err := GetKeyBytes(ctx, &FileLoader{Path: f.Path})
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to decode config %s: %w", f.Path, err)
+	}
+	return config, nil
+}
+
+// ReloadEvent describes an attempt to reload the ciphers of a ConfigManager.
+type ReloadEvent struct {
+	// Time is when the reload happened.
+	Time time.Time
+
+	// Config is the config that was loaded.
+	Config Config
+
+	// EncryptErr is why the encrypter failed to load, if it did.
+	EncryptErr error
+
+	// DecryptErr is why the decrypter failed to load, if it did.
+	DecryptErr error
+
+	// SourceErr is why the config could not be read, if it couldn't.  When
+	// set, nothing was loaded.
+	SourceErr error
+}
+
+// Err returns every error of the event, or nil if the reload succeeded.
+func (e ReloadEvent) Err() error {
+	return errors.Join(e.SourceErr, e.EncryptErr, e.DecryptErr)
+}
+
+// ReloadOptions configures a ConfigManager.
+type ReloadOptions struct {
+	// Interval is the time between polls of the config source and keys.  If
+	// not supplied, DefaultWatchInterval is used instead.
+	Interval time.Duration
+
+	// Logger is the Logger used to report reloads, and given to the
+	// configs that don't have their own.  If not supplied,
+	// DefaultLogger() is used instead.
+	Logger Logger
+
+	// OnReload is called after every reload, whether it succeeded or not.
+	OnReload func(ReloadEvent)
+}
+
+var (
+	errNoEncrypterLoaded = errors.New("no encrypter loaded")
+	errNoDecrypterLoaded = errors.New("no decrypter loaded")
+)
+
+// ConfigManager keeps an encrypter and decrypter loaded from a ConfigSource.
+// It polls the source and the keys the config points to, and when either
+// changes it loads the ciphers again and swaps them in atomically behind the
+// handles returned by Encrypter and Decrypter, closing the ones they replace
+// once the calls using them return.  A cipher that fails to reload keeps the
+// previous one active.
+type ConfigManager struct {
+	source  ConfigSource
+	options ReloadOptions
+
+	lock        sync.Mutex
+	fingerprint []byte
+	encrypter   cipherSlot
+	decrypter   cipherSlot
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewConfigManager loads the ciphers from the source and starts watching it.
+// It fails if neither an encrypter nor a decrypter can be loaded.
+func NewConfigManager(source ConfigSource, options ReloadOptions) (*ConfigManager, error) {
+	if source == nil {
+		return nil, errors.New("no config source")
+	}
+	if options.Interval <= 0 {
+		options.Interval = DefaultWatchInterval
+	}
+	if options.Logger == nil {
+		options.Logger = DefaultLogger()
+	}
+
+	m := &ConfigManager{
+		source:  source,
+		options: options,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	if _, err := m.check(context.Background(), true); err != nil {
+		return nil, err
+	}
+	if m.encrypter.cipher == nil && m.decrypter.cipher == nil {
+		return nil, errors.New("neither an encrypter nor a decrypter could be loaded")
+	}
+
+	go m.run()
+	return m, nil
+}
+
+func (m *ConfigManager) run() {
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			if _, err := m.check(context.Background(), false); err != nil {
+				logError(m.options.Logger, "failed to reload config", ErrorKey, err)
+			}
+		}
+	}
+}
+
+// check reads the config and reloads the ciphers if the config or its keys
+// changed, or unconditionally if force is set.  It reports whether a reload
+// happened.
+func (m *ConfigManager) check(ctx context.Context, force bool) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	config, err := m.source.GetConfig(ctx)
+	if err != nil {
+		m.notify(ReloadEvent{Time: time.Now(), SourceErr: err})
+		return false, err
+	}
+	if config.Logger == nil {
+		config.Logger = m.options.Logger
+	}
+
+	fingerprint, err := configFingerprint(ctx, &config)
+	if err != nil {
+		// a key may be in the middle of being rewritten, try again next poll
+		return false, err
+	}
+	if !force && bytes.Equal(fingerprint, m.fingerprint) {
+		return false, nil
+	}
+	m.fingerprint = fingerprint
+
+	event := ReloadEvent{Time: time.Now(), Config: config}
+	encrypter, err := config.LoadEncryptContext(ctx)
+	if event.EncryptErr = err; err == nil {
+		m.encrypter.swap(encrypter)
+	}
+	decrypter, err := config.LoadDecryptContext(ctx)
+	if event.DecryptErr = err; err == nil {
+		m.decrypter.swap(decrypter)
+	}
+	m.notify(event)
+
+	if event.EncryptErr != nil && event.DecryptErr != nil {
+		return false, event.Err()
+	}
+	logInfo(m.options.Logger, "reloaded config",
+		"type", config.Type, "kid", config.KID)
+	return true, nil
+}
+
+func (m *ConfigManager) notify(event ReloadEvent) {
+	if m.options.OnReload != nil {
+		m.options.OnReload(event)
+	}
+}
+
+// configFingerprint hashes the config along with the bytes of every key so
+// a change to either is noticed.
+func configFingerprint(ctx context.Context, config *Config) ([]byte, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	writeFingerprint(h, data)
+	for _, key := range config.keyLoaders() {
+		data, err := GetKeyBytes(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		writeFingerprint(h, data)
+	}
+	return h.Sum(nil), nil
+}
+
+// Reload forces the config to be read and the ciphers to be loaded again,
+// regardless of whether anything changed.
+func (m *ConfigManager) Reload() error {
+	_, err := m.check(context.Background(), true)
+	return err
+}
+
+// Close stops watching the config.  The handles keep using the last loaded
+// ciphers.
+func (m *ConfigManager) Close() error {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
+	<-m.done
+	return nil
+}
+
+// Encrypter returns an Encrypt that always uses the most recently loaded
+// encrypter.
+func (m *ConfigManager) Encrypter() Encrypt {
+	return managedEncrypter{m}
+}
+
+// Decrypter returns a Decrypt that always uses the most recently loaded
+// decrypter.
+func (m *ConfigManager) Decrypter() Decrypt {
+	return managedDecrypter{m}
+}
+
+type managedEncrypter struct {
+	m *ConfigManager
+}
+
+// get returns the active encrypter, which isn't closed until release is
+// called.
+func (e managedEncrypter) get() (Encrypt, bool) {
+	encrypter, ok := e.m.encrypter.acquire().(Encrypt)
+	return encrypter, ok
+}
+
+func (e managedEncrypter) release() {
+	e.m.encrypter.release()
+}
+
+// GetAlgorithm returns the algorithm of the active encrypter.
+func (e managedEncrypter) GetAlgorithm() AlgorithmType {
+	defer e.release()
+	if encrypter, ok := e.get(); ok {
+		return encrypter.GetAlgorithm()
+	}
+	return ""
+}
+
+// GetKID returns the KID of the active encrypter.
+func (e managedEncrypter) GetKID() string {
+	defer e.release()
+	if encrypter, ok := e.get(); ok {
+		return encrypter.GetKID()
+	}
+	return ""
+}
+
+// EncryptMessage encrypts the message with the active encrypter.
+func (e managedEncrypter) EncryptMessage(message []byte) ([]byte, []byte, error) {
+	defer e.release()
+	if encrypter, ok := e.get(); ok {
+		return encrypter.EncryptMessage(message)
+	}
+	return nil, nil, errNoEncrypterLoaded
+}
+
+// EncryptMessageContext encrypts the message with the active encrypter,
+// passing the context along.
+func (e managedEncrypter) EncryptMessageContext(ctx context.Context, message []byte) ([]byte, []byte, error) {
+	defer e.release()
+	if encrypter, ok := e.get(); ok {
+		return EncryptMessageContext(ctx, encrypter, message)
+	}
+	return nil, nil, errNoEncrypterLoaded
+}
+
+type managedDecrypter struct {
+	m *ConfigManager
+}
+
+// get returns the active decrypter, which isn't closed until release is
+// called.
+func (d managedDecrypter) get() (Decrypt, bool) {
+	decrypter, ok := d.m.decrypter.acquire().(Decrypt)
+	return decrypter, ok
+}
+
+func (d managedDecrypter) release() {
+	d.m.decrypter.release()
+}
+
+// GetAlgorithm returns the algorithm of the active decrypter.
+func (d managedDecrypter) GetAlgorithm() AlgorithmType {
+	defer d.release()
+	if decrypter, ok := d.get(); ok {
+		return decrypter.GetAlgorithm()
+	}
+	return ""
+}
+
+// GetKID returns the KID of the active decrypter.
+func (d managedDecrypter) GetKID() string {
+	defer d.release()
+	if decrypter, ok := d.get(); ok {
+		return decrypter.GetKID()
+	}
+	return ""
+}
+
+// DecryptMessage decrypts the message with the active decrypter.
+func (d managedDecrypter) DecryptMessage(cipher []byte, nonce []byte) ([]byte, error) {
+	defer d.release()
+	if decrypter, ok := d.get(); ok {
+		return decrypter.DecryptMessage(cipher, nonce)
+	}
+	return nil, errNoDecrypterLoaded
+}
+
+// DecryptMessageContext decrypts the message with the active decrypter,
+// passing the context along.
+func (d managedDecrypter) DecryptMessageContext(ctx context.Context, cipher []byte, nonce []byte) ([]byte, error) {
+	defer d.release()
+	if decrypter, ok := d.get(); ok {
+		return DecryptMessageContext(ctx, decrypter, cipher, nonce)
+	}
+	return nil, errNoDecrypterLoaded
+}
+
+// EncryptMessageWithAD encrypts the message with associated data using the
+// active encrypter.
+func (e managedEncrypter) EncryptMessageWithAD(message []byte, ad []byte) ([]byte, []byte, error) {
+	defer e.release()
+	if encrypter, ok := e.get(); ok {
+		return EncryptMessageWithAD(encrypter, message, ad)
+	}
+	return nil, nil, errNoEncrypterLoaded
+}
+
+// DecryptMessageWithAD decrypts the message with associated data using the
+// active decrypter.
+func (d managedDecrypter) DecryptMessageWithAD(cipher []byte, nonce []byte, ad []byte) ([]byte, error) {
+	defer d.release()
+	if decrypter, ok := d.get(); ok {
+		return DecryptMessageWithAD(decrypter, cipher, nonce, ad)
+	}
+	return nil, errNoDecrypterLoaded
+}
+
+// Metadata returns the metadata of the active encrypter, if it has any.
+func (e managedEncrypter) Metadata() Metadata {
+	defer e.release()
+	if encrypter, ok := e.get(); ok {
+		m, _ := GetMetadata(encrypter)
+		return m
+	}
+	return Metadata{}
+}
+
+// Metadata returns the metadata of the active decrypter, if it has any.
+func (d managedDecrypter) Metadata() Metadata {
+	defer d.release()
+	if decrypter, ok := d.get(); ok {
+		m, _ := GetMetadata(decrypter)
+		return m
+	}
+	return Metadata{}
+}
@@ -0,0 +1,170 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigManager(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	senderPrivatePath := filepath.Join(dir, "sendPrivate.pem")
+	senderPublicPath := filepath.Join(dir, "sendPublic.pem")
+	recipientPrivatePath := filepath.Join(dir, "private.pem")
+	recipientPublicPath := filepath.Join(dir, "public.pem")
+	writeBoxKeys(t, senderPrivatePath, senderPublicPath)
+	writeBoxKeys(t, recipientPrivatePath, recipientPublicPath)
+
+	configPath := filepath.Join(dir, "cipher.json")
+	writeConfig := func(kid string) {
+		data, err := json.Marshal(Config{
+			Type: Box,
+			KID:  kid,
+			Keys: map[KeyType]string{
+				SenderPrivateKey:    senderPrivatePath,
+				SenderPublicKey:     senderPublicPath,
+				RecipientPrivateKey: recipientPrivatePath,
+				RecipientPublicKey:  recipientPublicPath,
+			},
+		})
+		require.Nil(err)
+		require.Nil(ioutil.WriteFile(configPath, data, 0600))
+	}
+	writeConfig("first")
+
+	var (
+		lock   sync.Mutex
+		events []ReloadEvent
+	)
+	manager, err := NewConfigManager(&FileConfigSource{Path: configPath}, ReloadOptions{
+		Interval: 10 * time.Millisecond,
+		Logger:   newTestLogger(t),
+		OnReload: func(event ReloadEvent) {
+			lock.Lock()
+			defer lock.Unlock()
+			events = append(events, event)
+		},
+	})
+	require.Nil(err)
+	defer manager.Close()
+
+	encrypter := manager.Encrypter()
+	decrypter := manager.Decrypter()
+	assert.Equal(Box, encrypter.GetAlgorithm())
+	assert.Equal("first", encrypter.GetKID())
+	testCryptoPair(t, encrypter, decrypter, false)
+
+	replaced := manager.decrypter.cipher.(Decrypt)
+	crypt, nonce, err := encrypter.EncryptMessage([]byte("hello"))
+	require.Nil(err)
+
+	writeConfig("second")
+	require.Eventually(func() bool {
+		return encrypter.GetKID() == "second" && decrypter.GetKID() == "second"
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err = replaced.DecryptMessage(crypt, nonce)
+	assert.Equal(errCipherClosed, err, "the replaced decrypter is closed")
+
+	// rotated keys are picked up too
+	writeBoxKeys(t, recipientPrivatePath, recipientPublicPath)
+	require.Eventually(func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(events) >= 3
+	}, 5*time.Second, 10*time.Millisecond)
+	testCryptoPair(t, encrypter, decrypter, false)
+
+	// a broken config keeps the last good ciphers
+	require.Nil(ioutil.WriteFile(configPath, []byte("{not json"), 0600))
+	assert.NotNil(manager.Reload())
+	assert.Equal("second", encrypter.GetKID())
+	testCryptoPair(t, encrypter, decrypter, false)
+
+	lock.Lock()
+	last := events[len(events)-1]
+	lock.Unlock()
+	assert.NotNil(last.SourceErr)
+	assert.NotNil(last.Err())
+}
+
+func TestConfigManagerOneSide(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir := t.TempDir()
+	writeBoxKeys(t, filepath.Join(dir, "sendPrivate.pem"), filepath.Join(dir, "sendPublic.pem"))
+	writeBoxKeys(t, filepath.Join(dir, "private.pem"), filepath.Join(dir, "public.pem"))
+
+	var event ReloadEvent
+	manager, err := NewConfigManager(ConfigSourceFunc(func(context.Context) (Config, error) {
+		return Config{
+			Type: Box,
+			Keys: map[KeyType]string{
+				SenderPrivateKey:   filepath.Join(dir, "sendPrivate.pem"),
+				RecipientPublicKey: filepath.Join(dir, "public.pem"),
+			},
+		}, nil
+	}), ReloadOptions{
+		Interval: time.Hour,
+		OnReload: func(e ReloadEvent) { event = e },
+	})
+	require.Nil(err)
+	defer manager.Close()
+
+	assert.Nil(event.EncryptErr)
+	assert.NotNil(event.DecryptErr)
+
+	_, _, err = manager.Encrypter().EncryptMessage([]byte("hello"))
+	assert.Nil(err)
+	_, err = manager.Decrypter().DecryptMessage([]byte("hello"), nil)
+	assert.Equal(errNoDecrypterLoaded, err)
+	assert.Equal(AlgorithmType(""), manager.Decrypter().GetAlgorithm())
+}
+
+func TestConfigManagerErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewConfigManager(nil, ReloadOptions{})
+	assert.NotNil(err)
+
+	_, err = NewConfigManager(ConfigSourceFunc(func(context.Context) (Config, error) {
+		return Config{}, errors.New("unavailable")
+	}), ReloadOptions{})
+	assert.NotNil(err)
+
+	_, err = NewConfigManager(ConfigSourceFunc(func(context.Context) (Config, error) {
+		return Config{Type: Box}, nil
+	}), ReloadOptions{})
+	assert.NotNil(err)
+
+	_, err = NewConfigManager(&FileConfigSource{Path: filepath.Join(t.TempDir(), "missing.json")}, ReloadOptions{})
+	assert.NotNil(err)
+}
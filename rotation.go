@@ -0,0 +1,248 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultGracePeriod is how long a RotationManager keeps decrypting with a
+// rotated out key when no grace period is given.
+const DefaultGracePeriod = 24 * time.Hour
+
+// RotationEvent describes a key being rotated in or retired.
+type RotationEvent struct {
+	// Time is when the rotation or retirement happened.
+	Time time.Time
+
+	// Algorithm and KID identify the key the event is about: the new key for
+	// a rotation, the old key for a retirement.
+	Algorithm AlgorithmType
+	KID       string
+
+	// PreviousKID is the KID that was active before a rotation.
+	PreviousKID string
+}
+
+// RotationOptions configures a RotationManager.
+type RotationOptions struct {
+	// GracePeriod is how long envelopes sealed with a rotated out key can
+	// still be opened.  If not supplied, DefaultGracePeriod is used instead.
+	GracePeriod time.Duration
+
+	// OnRotate is called after a new key becomes active.
+	OnRotate func(RotationEvent)
+
+	// OnRetire is called after an old key stops being used to decrypt.
+	OnRetire func(RotationEvent)
+
+	// Now returns the current time.  If not supplied, time.Now is used.
+	Now func() time.Time
+}
+
+// retiringKey is a rotated out key that can still decrypt until expires.
+// decrypter is nil when the key had none.
+type retiringKey struct {
+	alg       AlgorithmType
+	kid       string
+	decrypter Decrypt
+	expires   time.Time
+}
+
+// RotationManager holds the encrypter of the active key and the decrypters of
+// the keys it replaced.  Envelopes are sealed with the active key and tagged
+// with its KID; older keys keep opening envelopes for a grace period after
+// they are rotated out, then are retired.  Replaced encrypters and retired
+// decrypters are closed to wipe their keys.  It's safe for concurrent use.
+type RotationManager struct {
+	options RotationOptions
+	router  *Router
+
+	lock      sync.RWMutex
+	encrypter Encrypt
+	decrypter Decrypt
+	retiring  []retiringKey
+}
+
+// NewRotationManager returns a RotationManager with the key of the config
+// active.
+func NewRotationManager(config Config, options RotationOptions) (*RotationManager, error) {
+	if options.GracePeriod <= 0 {
+		options.GracePeriod = DefaultGracePeriod
+	}
+	if options.Now == nil {
+		options.Now = time.Now
+	}
+	m := &RotationManager{
+		options: options,
+		router:  NewRouter(nil),
+	}
+	if err := m.Rotate(config); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Rotate makes the key of the config active.  The config needs a KID that
+// isn't in use, so envelopes can be routed to the right key.  The decrypter
+// of the config is loaded too if it can be, so a producer that only has the
+// public half of a key can still rotate.  The previous key keeps decrypting
+// until the grace period ends.
+func (m *RotationManager) Rotate(config Config) error {
+	if config.KID == "" {
+		return errors.New("rotated keys need a kid")
+	}
+	encrypter, err := config.LoadEncrypt()
+	if err != nil {
+		return err
+	}
+	decrypter, decryptErr := config.LoadDecrypt()
+	if decryptErr != nil {
+		decrypter = nil
+	}
+
+	m.lock.Lock()
+	now := m.options.Now()
+	retired, closing := m.retire(now)
+	replaced := m.encrypter
+	event, err := m.activate(now, encrypter, decrypter)
+	m.lock.Unlock()
+
+	if err != nil {
+		closing = append(closing, encrypter, decrypter)
+	} else if replaced != nil {
+		closing = append(closing, replaced)
+	}
+	closeCiphers(closing)
+
+	m.notify(m.options.OnRetire, retired)
+	if err != nil {
+		return err
+	}
+	m.notify(m.options.OnRotate, []RotationEvent{event})
+	return nil
+}
+
+// activate makes the encrypter active and registers the decrypter if there is
+// one, moving the previous key into its grace period.  The lock must be held.
+func (m *RotationManager) activate(now time.Time, encrypter Encrypt, decrypter Decrypt) (RotationEvent, error) {
+	alg, kid := encrypter.GetAlgorithm(), encrypter.GetKID()
+	if _, err := m.router.Route(alg, kid); err == nil || (m.encrypter != nil && equalKID(m.encrypter.GetKID(), kid)) {
+		return RotationEvent{}, errors.New("kid " + kid + " is already in use")
+	}
+	if decrypter != nil {
+		if err := m.router.Register(decrypter); err != nil {
+			return RotationEvent{}, err
+		}
+	}
+
+	event := RotationEvent{Time: now, Algorithm: alg, KID: kid}
+	if m.encrypter != nil {
+		event.PreviousKID = m.encrypter.GetKID()
+		m.retiring = append(m.retiring, retiringKey{
+			alg:       m.encrypter.GetAlgorithm(),
+			kid:       m.encrypter.GetKID(),
+			decrypter: m.decrypter,
+			expires:   now.Add(m.options.GracePeriod),
+		})
+	}
+	m.encrypter = encrypter
+	m.decrypter = decrypter
+	return event, nil
+}
+
+// retire unregisters the keys whose grace period is over and returns their
+// decrypters for closing once the lock is released.  The lock must be held.
+func (m *RotationManager) retire(now time.Time) ([]RotationEvent, []Identification) {
+	var (
+		events  []RotationEvent
+		closing []Identification
+		kept    = m.retiring[:0]
+	)
+	for _, key := range m.retiring {
+		if now.Before(key.expires) {
+			kept = append(kept, key)
+			continue
+		}
+		m.router.Unregister(key.alg, key.kid)
+		events = append(events, RotationEvent{Time: now, Algorithm: key.alg, KID: key.kid})
+		if key.decrypter != nil {
+			closing = append(closing, key.decrypter)
+		}
+	}
+	m.retiring = kept
+	return events, closing
+}
+
+// closeCiphers closes the ciphers, skipping nil ones.  Calls still running on
+// them finish first.
+func closeCiphers(ciphers []Identification) {
+	for _, cipher := range ciphers {
+		if cipher != nil {
+			CloseCipher(cipher)
+		}
+	}
+}
+
+// RetireExpired retires the keys whose grace period is over and returns how
+// many were retired.  Seal, Open and Rotate also retire expired keys, so
+// calling it is only needed to retire keys on a schedule.
+func (m *RotationManager) RetireExpired() int {
+	m.lock.Lock()
+	retired, closing := m.retire(m.options.Now())
+	m.lock.Unlock()
+
+	closeCiphers(closing)
+	m.notify(m.options.OnRetire, retired)
+	return len(retired)
+}
+
+func (m *RotationManager) notify(callback func(RotationEvent), events []RotationEvent) {
+	if callback == nil {
+		return
+	}
+	for _, event := range events {
+		callback(event)
+	}
+}
+
+// Encrypter returns the encrypter of the active key.  It's closed once a
+// later Rotate replaces it.
+func (m *RotationManager) Encrypter() Encrypt {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.encrypter
+}
+
+// Seal encrypts the message with the active key into an envelope tagged with
+// its KID.
+func (m *RotationManager) Seal(message []byte) (*Envelope, error) {
+	m.RetireExpired()
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return SealEnvelope(m.encrypter, message)
+}
+
+// Open decrypts an envelope sealed with the active key or a key still in its
+// grace period.
+func (m *RotationManager) Open(e *Envelope) ([]byte, error) {
+	m.RetireExpired()
+	return m.router.Open(e)
+}
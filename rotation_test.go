@@ -0,0 +1,133 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func boxConfig(t *testing.T, kid string) Config {
+	dir, err := os.Getwd()
+	require.Nil(t, err)
+	return Config{
+		Type: Box,
+		KID:  kid,
+		Keys: map[KeyType]string{
+			SenderPrivateKey:    filepath.Join(dir, "sendBoxPrivate.pem"),
+			SenderPublicKey:     filepath.Join(dir, "sendBoxPublic.pem"),
+			RecipientPrivateKey: filepath.Join(dir, "boxPrivate.pem"),
+			RecipientPublicKey:  filepath.Join(dir, "boxPublic.pem"),
+		},
+	}
+}
+
+func TestRotationManager(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var (
+		now     = time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+		rotated []RotationEvent
+		retired []RotationEvent
+	)
+	manager, err := NewRotationManager(boxConfig(t, "2019-06"), RotationOptions{
+		GracePeriod: time.Hour,
+		OnRotate:    func(e RotationEvent) { rotated = append(rotated, e) },
+		OnRetire:    func(e RotationEvent) { retired = append(retired, e) },
+		Now:         func() time.Time { return now },
+	})
+	require.Nil(err)
+	require.Len(rotated, 1)
+	assert.Equal("2019-06", rotated[0].KID)
+	assert.Equal("", rotated[0].PreviousKID)
+
+	old, err := manager.Seal([]byte("old"))
+	require.Nil(err)
+	assert.Equal("2019-06", old.KID)
+	replaced := manager.Encrypter()
+	retiring, err := manager.router.Route(Box, "2019-06")
+	require.Nil(err)
+
+	require.Nil(manager.Rotate(boxConfig(t, "2019-07")))
+	require.Len(rotated, 2)
+	assert.Equal(RotationEvent{Time: now, Algorithm: Box, KID: "2019-07", PreviousKID: "2019-06"}, rotated[1])
+	assert.Equal("2019-07", manager.Encrypter().GetKID())
+	_, _, err = replaced.EncryptMessage([]byte("old"))
+	assert.Equal(errCipherClosed, err, "the replaced encrypter is closed")
+
+	current, err := manager.Seal([]byte("new"))
+	require.Nil(err)
+	assert.Equal("2019-07", current.KID)
+
+	// both keys work during the grace period
+	now = now.Add(59 * time.Minute)
+	message, err := manager.Open(old)
+	require.Nil(err)
+	assert.Equal([]byte("old"), message)
+	message, err = manager.Open(current)
+	require.Nil(err)
+	assert.Equal([]byte("new"), message)
+	assert.Empty(retired)
+
+	// then the old key is retired
+	now = now.Add(time.Minute)
+	assert.Equal(1, manager.RetireExpired())
+	require.Len(retired, 1)
+	assert.Equal(RotationEvent{Time: now, Algorithm: Box, KID: "2019-06"}, retired[0])
+	_, err = manager.Open(old)
+	assert.NotNil(err)
+	_, err = retiring.DecryptMessage(old.Cipher, old.Nonce)
+	assert.Equal(errCipherClosed, err, "the retired decrypter is closed")
+	_, err = manager.Open(current)
+	assert.Nil(err)
+	assert.Equal(0, manager.RetireExpired())
+}
+
+func TestRotationManagerErrors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	_, err := NewRotationManager(boxConfig(t, ""), RotationOptions{})
+	assert.NotNil(err, "no kid")
+
+	_, err = NewRotationManager(Config{Type: "rot13", KID: "a"}, RotationOptions{})
+	assert.NotNil(err, "unknown algorithm")
+
+	manager, err := NewRotationManager(boxConfig(t, "a"), RotationOptions{})
+	require.Nil(err)
+	require.Nil(manager.Rotate(boxConfig(t, "b")))
+
+	assert.NotNil(manager.Rotate(boxConfig(t, "b")), "active kid")
+	assert.NotNil(manager.Rotate(boxConfig(t, "a")), "kid in its grace period")
+	assert.Equal("b", manager.Encrypter().GetKID())
+
+	// a producer without the private keys can still rotate
+	producer := boxConfig(t, "c")
+	delete(producer.Keys, RecipientPrivateKey)
+	require.Nil(manager.Rotate(producer))
+	envelope, err := manager.Seal([]byte("hello"))
+	require.Nil(err)
+	_, err = manager.Open(envelope)
+	assert.NotNil(err)
+}
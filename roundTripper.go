@@ -0,0 +1,88 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// EncryptingTransport is an http.RoundTripper that encrypts the body of every
+// request it sends with EncryptRequest, so the payload stays end to end
+// encrypted through proxies that terminate TLS.  Requests without a body are
+// sent with an encrypted empty body, as the middleware expects.  The request
+// passed in is never changed.
+type EncryptingTransport struct {
+	// Encrypter encrypts the request bodies.  It's required.
+	Encrypter Encrypt
+
+	// Decrypter, if set, decrypts responses that have the encryption
+	// headers, so the caller reads the plain body.  Responses without them,
+	// like errors from a proxy, are returned as they are.
+	Decrypter Decrypt
+
+	// Base sends the encrypted requests.  If not supplied,
+	// http.DefaultTransport is used instead.
+	Base http.RoundTripper
+}
+
+// RoundTrip encrypts the request, sends it and decrypts the response.
+func (t *EncryptingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.Encrypter == nil {
+		closeRequestBody(r)
+		return nil, errors.New("no encrypter")
+	}
+
+	encrypted := r.Clone(r.Context())
+	if err := EncryptRequest(encrypted, t.Encrypter); err != nil {
+		closeRequestBody(r)
+		return nil, err
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(encrypted)
+	if err != nil || t.Decrypter == nil || resp.Header.Get(HeaderAlgorithm) == "" {
+		return resp, err
+	}
+
+	message, err := DecryptResponse(resp, t.Decrypter)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(message))
+	resp.ContentLength = int64(len(message))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(message)))
+	resp.Header.Del(HeaderAlgorithm)
+	resp.Header.Del(HeaderKID)
+	resp.Header.Del(HeaderNonce)
+	return resp, nil
+}
+
+// closeRequestBody closes the body of a request that won't be sent, as a
+// RoundTripper must.
+func closeRequestBody(r *http.Request) {
+	if r.Body != nil {
+		r.Body.Close()
+	}
+}
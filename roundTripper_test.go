@@ -0,0 +1,85 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptingTransport(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := loadBoxPair(t)
+	router := NewRouter(nil)
+	require.Nil(router.Register(decrypter))
+
+	middleware, err := NewHTTPMiddleware(HTTPOptions{Router: router, Encrypter: encrypter})
+	require.Nil(err)
+
+	// the proxy sees only ciphertext
+	var seen []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		seen = append(seen, string(body))
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+		middleware(echoHandler).ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &EncryptingTransport{Encrypter: encrypter, Decrypter: decrypter}}
+	request, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("hello"))
+	require.Nil(err)
+	response, err := client.Do(request)
+	require.Nil(err)
+	body, err := io.ReadAll(response.Body)
+	require.Nil(err)
+	response.Body.Close()
+	assert.Equal(http.StatusAccepted, response.StatusCode)
+	assert.Equal("HELLO", string(body))
+	assert.Empty(response.Header.Get(HeaderAlgorithm))
+	assert.Empty(request.Header.Get(HeaderAlgorithm))
+	require.Len(seen, 1)
+	assert.NotContains(seen[0], "hello")
+
+	// requests without a body are encrypted too
+	response, err = client.Get(server.URL)
+	require.Nil(err)
+	response.Body.Close()
+	assert.Equal(http.StatusAccepted, response.StatusCode)
+
+	// without a decrypter the response is left encrypted
+	client = &http.Client{Transport: &EncryptingTransport{Encrypter: encrypter}}
+	response, err = client.Post(server.URL, "text/plain", strings.NewReader("hello"))
+	require.Nil(err)
+	assert.Equal(string(Box), response.Header.Get(HeaderAlgorithm))
+	body, err = DecryptResponse(response, decrypter)
+	require.Nil(err)
+	assert.Equal("HELLO", string(body))
+
+	client = &http.Client{Transport: &EncryptingTransport{}}
+	_, err = client.Get(server.URL)
+	assert.NotNil(err)
+}
@@ -0,0 +1,135 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// UnknownKIDFunc is called by a Router for an envelope with no registered
+// decrypter.  It can load the decrypter, for example by fetching the key of a
+// new tenant, or return an error to reject the envelope.  A decrypter it
+// returns is registered for later envelopes.
+type UnknownKIDFunc func(alg AlgorithmType, kid string) (Decrypt, error)
+
+// Router dispatches envelopes to the decrypter registered for their algorithm
+// and KID.  It's safe for concurrent use.
+type Router struct {
+	lock      sync.RWMutex
+	ciphers   Ciphers
+	onUnknown UnknownKIDFunc
+}
+
+// NewRouter returns an empty Router.  onUnknown may be nil, in which case
+// envelopes with no registered decrypter are rejected.
+func NewRouter(onUnknown UnknownKIDFunc) *Router {
+	return &Router{
+		ciphers:   Ciphers{Options: map[AlgorithmType]map[string]Decrypt{}},
+		onUnknown: onUnknown,
+	}
+}
+
+// Register adds the decrypter under its algorithm and KID.  It fails if one is
+// already registered for them.
+func (r *Router) Register(decrypter Decrypt) error {
+	if decrypter == nil {
+		return errors.New("no decrypter")
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.ciphers.Add(decrypter.GetAlgorithm(), decrypter.GetKID(), decrypter)
+}
+
+// AddCiphers registers every decrypter of the ciphers, such as those returned
+// by Options.LoadCiphers.  As with Register, each is registered under the
+// algorithm it reports, which is the one its envelopes carry, rather than
+// the config type it is kept under.
+func (r *Router) AddCiphers(c Ciphers) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, kids := range c.Options {
+		for kid, decrypter := range kids {
+			alg := decrypter.GetAlgorithm()
+			if err := r.ciphers.Add(alg, kid, decrypter); err != nil {
+				return fmt.Errorf("%s/%s: %w", alg, kid, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Unregister removes the decrypter for the algorithm and KID, if there is one.
+func (r *Router) Unregister(alg AlgorithmType, kid string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.ciphers.Options[alg], kid)
+}
+
+// Route returns the decrypter for the algorithm and KID, asking the
+// UnknownKIDFunc when none is registered.
+func (r *Router) Route(alg AlgorithmType, kid string) (Decrypt, error) {
+	r.lock.RLock()
+	decrypter, ok := r.ciphers.Get(alg, kid)
+	r.lock.RUnlock()
+	if ok {
+		return decrypter, nil
+	}
+	if r.onUnknown == nil {
+		return nil, keyNotFound("no decrypter for algorithm %s and kid %s", alg, kid)
+	}
+
+	decrypter, err := r.onUnknown(alg, kid)
+	if err != nil {
+		return nil, err
+	}
+	if decrypter == nil {
+		return nil, keyNotFound("no decrypter for algorithm %s and kid %s", alg, kid)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if existing, ok := r.ciphers.Get(alg, kid); ok {
+		// another caller loaded it first
+		return existing, nil
+	}
+	if err := r.ciphers.Add(alg, kid, decrypter); err != nil {
+		return nil, err
+	}
+	return decrypter, nil
+}
+
+// Open decrypts the envelope with the decrypter routed to by its algorithm
+// and KID.
+func (r *Router) Open(e *Envelope) ([]byte, error) {
+	decrypter, err := r.Route(e.Algorithm, e.KID)
+	if err != nil {
+		return nil, err
+	}
+	return e.Open(decrypter)
+}
+
+// DecryptEnvelope parses a marshalled Envelope and opens it.
+func (r *Router) DecryptEnvelope(data []byte) ([]byte, error) {
+	var e Envelope
+	if err := e.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return r.Open(&e)
+}
@@ -0,0 +1,148 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/rsa"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tenantA := GeneratePrivateKey(2048)
+	tenantB := GeneratePrivateKey(2048)
+
+	router := NewRouter(nil)
+	require.Nil(router.Register(NewRSADecrypter(DefaultRSAHash, tenantA, nil, "a")))
+	require.Nil(router.AddCiphers(Ciphers{Options: map[AlgorithmType]map[string]Decrypt{
+		RSASymmetric: {"b": NewRSADecrypter(DefaultRSAHash, tenantB, nil, "b")},
+	}}))
+	assert.NotNil(router.Register(NewRSADecrypter(DefaultRSAHash, tenantA, nil, "a")), "duplicate")
+	assert.NotNil(router.Register(nil))
+
+	for kid, key := range map[string]*rsa.PrivateKey{"a": tenantA, "b": tenantB} {
+		envelope, err := SealEnvelope(NewRSAEncrypter(DefaultRSAHash, nil, &key.PublicKey, kid), []byte("hello "+kid))
+		require.Nil(err)
+		data, err := envelope.MarshalBinary()
+		require.Nil(err)
+
+		message, err := router.DecryptEnvelope(data)
+		require.Nil(err)
+		assert.Equal([]byte("hello "+kid), message)
+	}
+
+	envelope, err := SealEnvelope(NewRSAEncrypter(DefaultRSAHash, nil, &tenantA.PublicKey, "c"), []byte("hello"))
+	require.Nil(err)
+	_, err = router.Open(envelope)
+	assert.NotNil(err, "unknown kid")
+
+	router.Unregister(RSASymmetric, "a")
+	_, err = router.Route(RSASymmetric, "a")
+	assert.NotNil(err)
+
+	_, err = router.DecryptEnvelope([]byte("garbage"))
+	assert.NotNil(err)
+}
+
+func TestRouterLoadCiphers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	config := Config{
+		Type:   RSAAsymmetric,
+		KID:    "k1",
+		Params: map[string]string{"hash": "SHA512"},
+		Keys: map[KeyType]string{
+			SenderPrivateKey:    "private.pem",
+			SenderPublicKey:     "public.pem",
+			RecipientPrivateKey: "private.pem",
+			RecipientPublicKey:  "public.pem",
+		},
+	}
+	ciphers, err := Options{config}.LoadCiphers()
+	require.Nil(err)
+
+	router := NewRouter(nil)
+	require.Nil(router.AddCiphers(ciphers))
+
+	encrypter, err := config.LoadEncrypt()
+	require.Nil(err)
+	envelope, err := SealEnvelope(encrypter, []byte("hello"))
+	require.Nil(err)
+	message, err := router.Open(envelope)
+	require.Nil(err)
+	assert.Equal([]byte("hello"), message)
+}
+
+func TestRouterUnknownKID(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	key := GeneratePrivateKey(2048)
+	var (
+		lock  sync.Mutex
+		calls int
+	)
+	router := NewRouter(func(alg AlgorithmType, kid string) (Decrypt, error) {
+		lock.Lock()
+		calls++
+		lock.Unlock()
+		switch kid {
+		case "new-tenant":
+			return NewRSADecrypter(DefaultRSAHash, key, nil, kid), nil
+		case "nil":
+			return nil, nil
+		}
+		return nil, errors.New("tenant " + kid + " is not allowed")
+	})
+
+	envelope, err := SealEnvelope(NewRSAEncrypter(DefaultRSAHash, nil, &key.PublicKey, "new-tenant"), []byte("hello"))
+	require.Nil(err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			message, err := router.Open(envelope)
+			assert.Nil(err)
+			assert.Equal([]byte("hello"), message)
+		}()
+	}
+	wg.Wait()
+
+	// once loaded, the decrypter is registered
+	lock.Lock()
+	loaded := calls
+	lock.Unlock()
+	_, err = router.Open(envelope)
+	assert.Nil(err)
+	assert.Equal(loaded, calls)
+
+	_, err = router.Route(RSASymmetric, "banned")
+	assert.EqualError(err, "tenant banned is not allowed")
+	_, err = router.Route(RSASymmetric, "nil")
+	assert.NotNil(err)
+}
@@ -18,19 +18,54 @@
 package voynicrypto
 
 import (
+	"context"
 	"crypto"
 	"errors"
+	"io"
 	"strings"
 )
 
 // GetHash finds a matching Hash for the string given.
 func GetHash(hashType string) crypto.Hash {
-	if elem, ok := hashFunctions[strings.ToUpper(hashType)]; ok {
+	if elem, ok := lookupHash(hashType); ok {
 		return elem
 	}
 	return crypto.BLAKE2b_512
 }
 
+// RegisterHashName adds a hash name that BasicHashLoader and the hash param
+// of a Config accept, like RegisterHashName("SHA256", crypto.SHA256).  Names
+// are not case sensitive.  The hash must be linked into the binary, and a name
+// that is already registered can't be changed.
+func RegisterHashName(name string, h crypto.Hash) error {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name == "" {
+		return errors.New("no hash name")
+	}
+	if !h.Available() {
+		return errors.New("hash " + name + " is not linked in binary")
+	}
+
+	hashLock.Lock()
+	defer hashLock.Unlock()
+
+	if existing, ok := hashFunctions[name]; ok {
+		if existing == h {
+			return nil
+		}
+		return errors.New("hashname " + name + " already registered")
+	}
+	hashFunctions[name] = h
+	return nil
+}
+
+func lookupHash(name string) (crypto.Hash, bool) {
+	hashLock.RLock()
+	defer hashLock.RUnlock()
+	h, ok := hashFunctions[strings.ToUpper(name)]
+	return h, ok
+}
+
 // HashLoader can get a hash.
 type HashLoader interface {
 	GetHash() (crypto.Hash, error)
@@ -44,7 +79,7 @@ type BasicHashLoader struct {
 // GetHash return the given hash from hashFunctions if not found it will return an error.
 //   0 is an invalid hash
 func (b *BasicHashLoader) GetHash() (crypto.Hash, error) {
-	if elem, ok := hashFunctions[strings.ToUpper(b.HashName)]; ok {
+	if elem, ok := lookupHash(b.HashName); ok {
 		if elem.Available() {
 			return elem, nil
 		}
@@ -59,37 +94,105 @@ type RSALoader struct {
 	Hash       HashLoader
 	PrivateKey KeyLoader
 	PublicKey  KeyLoader
+
+	// Strict refuses weak hashes and small keys, like SetStrictMode does for
+	// the whole package.
+	Strict bool
+
+	// Random is the source of randomness for padding and signatures.  If not
+	// supplied, crypto/rand is used.
+	Random io.Reader
+
+	// Hybrid lets the encrypter encrypt messages too long for OAEP, like
+	// WithHybrid does.
+	Hybrid bool
+
+	// EncryptThenSign makes the encrypter sign the ciphertext instead of the
+	// message, like WithEncryptThenSign does.
+	EncryptThenSign bool
+
+	// Cache keeps the keys once they're parsed.  If not supplied, they're
+	// read and parsed on every load.
+	Cache *KeyCache
+
+	// Pool, if set, runs the decryptions and signatures of the ciphers on
+	// its workers.
+	Pool *RSAPool
+}
+
+func (loader *RSALoader) keyCache() *KeyCache {
+	return loader.Cache
+}
+
+func (loader *RSALoader) strict() bool {
+	return loader.Strict || StrictMode()
 }
 
 // LoadEncrypt loads the RSA encrypter.
 func (loader *RSALoader) LoadEncrypt() (Encrypt, error) {
+	return loader.LoadEncryptContext(context.Background())
+}
+
+// LoadEncryptContext loads the RSA encrypter, passing the context to the key loaders.
+func (loader *RSALoader) LoadEncryptContext(ctx context.Context) (Encrypt, error) {
 	hashFunc, err := loader.Hash.GetHash()
 	if err != nil {
 		return nil, err
 	}
 
-	publicKey, err := GetPublicKey(loader.PublicKey)
+	publicKey, err := getCachedPublicKey(ctx, loader.Cache, loader.PublicKey)
 	if err != nil {
 		return nil, err
 	}
-	privateKey, _ := GetPrivateKey(loader.PrivateKey)
+	privateKey, _ := getCachedPrivateKey(ctx, loader.Cache, loader.PrivateKey)
 
-	return NewRSAEncrypter(hashFunc, privateKey, publicKey, loader.KID), nil
+	if loader.strict() {
+		if err := checkStrictRSA(hashFunc, privateKey, publicKey); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkFIPSRSA(hashFunc, privateKey, publicKey); err != nil {
+		return nil, err
+	}
+
+	encrypter := NewRSAEncrypter(hashFunc, privateKey, publicKey, loader.KID)
+	encrypter.(*rsaEncrypterDecrypter).random = loader.Random
+	encrypter.(*rsaEncrypterDecrypter).hybrid = loader.Hybrid
+	encrypter.(*rsaEncrypterDecrypter).encryptThenSign = loader.EncryptThenSign
+	encrypter.(*rsaEncrypterDecrypter).pool = loader.Pool
+	return encrypter, nil
 }
 
 // LoadDecrypt loads the RSA decrypter.
 func (loader *RSALoader) LoadDecrypt() (Decrypt, error) {
+	return loader.LoadDecryptContext(context.Background())
+}
+
+// LoadDecryptContext loads the RSA decrypter, passing the context to the key loaders.
+func (loader *RSALoader) LoadDecryptContext(ctx context.Context) (Decrypt, error) {
 	hashFunc, err := loader.Hash.GetHash()
 	if err != nil {
 		return nil, err
 	}
 
-	privateKey, err := GetPrivateKey(loader.PrivateKey)
+	privateKey, err := getCachedPrivateKey(ctx, loader.Cache, loader.PrivateKey)
 	if err != nil {
 		return nil, err
 	}
 
-	publicKey, _ := GetPublicKey(loader.PublicKey)
+	publicKey, _ := getCachedPublicKey(ctx, loader.Cache, loader.PublicKey)
+
+	if loader.strict() {
+		if err := checkStrictRSA(hashFunc, privateKey, publicKey); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkFIPSRSA(hashFunc, privateKey, publicKey); err != nil {
+		return nil, err
+	}
 
-	return NewRSADecrypter(hashFunc, privateKey, publicKey, loader.KID), nil
+	decrypter := NewRSADecrypter(hashFunc, privateKey, publicKey, loader.KID)
+	decrypter.(*rsaEncrypterDecrypter).random = loader.Random
+	decrypter.(*rsaEncrypterDecrypter).pool = loader.Pool
+	return decrypter, nil
 }
@@ -0,0 +1,243 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+)
+
+// The operations of RSAPoolMetrics, used as their operation label.
+const (
+	RSAPoolDecrypt = "decrypt"
+	RSAPoolSign    = "sign"
+)
+
+// DefaultRSAPoolQueuePerWorker is how many operations may wait for each
+// worker of an RSAPool when no queue size is given.
+const DefaultRSAPoolQueuePerWorker = 16
+
+var errRSAPoolClosed = errors.New("rsa pool closed")
+
+// RSAPoolOptions configures an RSAPool.
+type RSAPoolOptions struct {
+	// Workers is how many RSA private key operations run at once.  If not
+	// supplied, half of runtime.GOMAXPROCS(0), but at least one, is used.
+	Workers int
+
+	// QueueSize is how many operations may wait for a worker.  Operations
+	// beyond it are rejected with ErrLimitExceeded straight away.  If not
+	// supplied, DefaultRSAPoolQueuePerWorker per worker is used.
+	QueueSize int
+
+	// QueueTimeout is how long an operation waits for a worker before it's
+	// rejected with ErrLimitExceeded.  Zero means it waits as long as its
+	// context allows, which for the methods without a context is forever.
+	QueueTimeout time.Duration
+
+	// Metrics, if set, records the queue.
+	Metrics *RSAPoolMetrics
+}
+
+// RSAPoolMetrics are the go-kit metrics an RSAPool records, labeled by
+// operation, algorithm and kid.  Any of them may be nil.
+type RSAPoolMetrics struct {
+	// Queued is the number of operations waiting for a worker.
+	Queued metrics.Gauge
+
+	// WaitDuration observes how many seconds each operation waited.
+	WaitDuration metrics.Histogram
+
+	// Rejected counts operations that were rejected or gave up waiting.
+	Rejected metrics.Counter
+}
+
+// The states of an rsaTask.
+const (
+	rsaTaskQueued int32 = iota
+	rsaTaskRunning
+	rsaTaskAbandoned
+)
+
+// rsaTask is an operation waiting for a worker.
+type rsaTask struct {
+	run    func()
+	state  int32
+	queued time.Time
+	labels []string
+	done   chan struct{}
+}
+
+// RSAPool runs the RSA private key operations, decryption and signing, of
+// the ciphers and signers given it on a bounded set of workers, so a burst
+// of large RSA operations can't take every CPU from the rest of the service.
+// One pool is meant to be shared by every RSA cipher of a process.  Give it
+// to ciphers with WithRSAPool, RSALoader.Pool or Config.RSAPool.  Encryption
+// and verification only use the public key, which is cheap, so they don't
+// go through the pool.
+type RSAPool struct {
+	options RSAPoolOptions
+	tasks   chan *rsaTask
+
+	// lock keeps Close from stopping the workers while a task is queued.
+	lock    sync.RWMutex
+	closed  bool
+	workers sync.WaitGroup
+}
+
+// NewRSAPool starts the workers of a pool.  Close stops them.
+func NewRSAPool(options RSAPoolOptions) *RSAPool {
+	if options.Workers <= 0 {
+		options.Workers = runtime.GOMAXPROCS(0) / 2
+		if options.Workers < 1 {
+			options.Workers = 1
+		}
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = DefaultRSAPoolQueuePerWorker * options.Workers
+	}
+
+	p := &RSAPool{
+		options: options,
+		tasks:   make(chan *rsaTask, options.QueueSize),
+	}
+	p.workers.Add(options.Workers)
+	for i := 0; i < options.Workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *RSAPool) work() {
+	defer p.workers.Done()
+	for task := range p.tasks {
+		if !atomic.CompareAndSwapInt32(&task.state, rsaTaskQueued, rsaTaskRunning) {
+			// its caller gave up waiting
+			continue
+		}
+		p.dequeued(task)
+		task.run()
+		close(task.done)
+	}
+}
+
+// dequeued records that the task is no longer waiting.
+func (p *RSAPool) dequeued(task *rsaTask) {
+	m := p.options.Metrics
+	if m == nil {
+		return
+	}
+	if m.Queued != nil {
+		m.Queued.With(task.labels...).Add(-1)
+	}
+	if m.WaitDuration != nil {
+		m.WaitDuration.With(task.labels...).Observe(time.Since(task.queued).Seconds())
+	}
+}
+
+func (p *RSAPool) reject(labels []string, err error) error {
+	if m := p.options.Metrics; m != nil && m.Rejected != nil {
+		m.Rejected.With(labels...).Add(1)
+	}
+	return fmt.Errorf("%w: %w", ErrLimitExceeded, err)
+}
+
+// run calls f on a worker and waits for it to return.  If the queue is full,
+// or the queue timeout or the context runs out before a worker is free, f
+// isn't called and ErrLimitExceeded is returned.  A nil pool calls f
+// directly.
+func (p *RSAPool) run(ctx context.Context, operation string, cipher Identification, f func()) error {
+	if p == nil {
+		f()
+		return nil
+	}
+
+	task := &rsaTask{
+		run:    f,
+		queued: time.Now(),
+		labels: []string{OperationLabel, operation, AlgorithmLabel, string(cipher.GetAlgorithm()), KIDLabel, cipher.GetKID()},
+		done:   make(chan struct{}),
+	}
+	if err := p.enqueue(task); err != nil {
+		return err
+	}
+
+	if p.options.QueueTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.options.QueueTimeout)
+		defer cancel()
+	}
+	select {
+	case <-task.done:
+		return nil
+	case <-ctx.Done():
+		if atomic.CompareAndSwapInt32(&task.state, rsaTaskQueued, rsaTaskAbandoned) {
+			if m := p.options.Metrics; m != nil && m.Queued != nil {
+				m.Queued.With(task.labels...).Add(-1)
+			}
+			return p.reject(task.labels, ctx.Err())
+		}
+		// a worker already has it, and f may be writing the caller's results
+		<-task.done
+		return nil
+	}
+}
+
+func (p *RSAPool) enqueue(task *rsaTask) error {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	if p.closed {
+		return errRSAPoolClosed
+	}
+
+	if m := p.options.Metrics; m != nil && m.Queued != nil {
+		m.Queued.With(task.labels...).Add(1)
+	}
+	select {
+	case p.tasks <- task:
+		return nil
+	default:
+	}
+	if m := p.options.Metrics; m != nil && m.Queued != nil {
+		m.Queued.With(task.labels...).Add(-1)
+	}
+	return p.reject(task.labels, errors.New("rsa pool queue is full"))
+}
+
+// Close stops the workers once the operations already queued are done.
+// Ciphers using the pool fail afterwards.
+func (p *RSAPool) Close() error {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.tasks)
+	p.lock.Unlock()
+
+	p.workers.Wait()
+	return nil
+}
@@ -0,0 +1,177 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRSAPoolBoundsConcurrency(t *testing.T) {
+	assert := assert.New(t)
+
+	pool := NewRSAPool(RSAPoolOptions{Workers: 2})
+	defer pool.Close()
+	cipher, _ := aesGCMPair(t)
+
+	var running, most int32
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := pool.run(context.Background(), RSAPoolDecrypt, cipher, func() {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&most)
+					if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&running, -1)
+			})
+			assert.Nil(err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(int32(2), atomic.LoadInt32(&most))
+}
+
+func TestRSAPoolQueue(t *testing.T) {
+	assert := assert.New(t)
+
+	queued, rejected := testGauge{newTestMetric()}, newTestMetric()
+	waited := testHistogram{newTestMetric()}
+	pool := NewRSAPool(RSAPoolOptions{
+		Workers:      1,
+		QueueSize:    1,
+		QueueTimeout: 50 * time.Millisecond,
+		Metrics:      &RSAPoolMetrics{Queued: queued, WaitDuration: waited, Rejected: rejected},
+	})
+	cipher, _ := aesGCMPair(t)
+
+	// the only worker is held while one more operation waits in the queue
+	started, release := make(chan struct{}), make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		assert.Nil(pool.run(context.Background(), RSAPoolDecrypt, cipher, func() {
+			close(started)
+			<-release
+		}))
+	}()
+	<-started
+	go func() {
+		defer wg.Done()
+		assert.Nil(pool.run(context.Background(), RSAPoolDecrypt, cipher, func() {}))
+	}()
+	labels := []string{OperationLabel, RSAPoolDecrypt, AlgorithmLabel, string(AESGCM), KIDLabel, "k1"}
+	require.Eventually(t, func() bool {
+		value, _ := queued.get(labels...)
+		return value == 1
+	}, time.Second, time.Millisecond)
+
+	// a full queue rejects straight away
+	err := pool.run(context.Background(), RSAPoolDecrypt, cipher, func() {
+		assert.Fail("a rejected operation ran")
+	})
+	assert.True(errors.Is(err, ErrLimitExceeded))
+
+	close(release)
+	wg.Wait()
+
+	// an operation that waits too long is rejected and never runs
+	started, release = make(chan struct{}), make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.Nil(pool.run(context.Background(), RSAPoolSign, cipher, func() {
+			close(started)
+			<-release
+		}))
+	}()
+	<-started
+	err = pool.run(context.Background(), RSAPoolSign, cipher, func() {
+		assert.Fail("an abandoned operation ran")
+	})
+	assert.True(errors.Is(err, ErrLimitExceeded))
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+	close(release)
+	wg.Wait()
+
+	value, _ := rejected.get(labels...)
+	assert.Equal(1.0, value)
+	signLabels := []string{OperationLabel, RSAPoolSign, AlgorithmLabel, string(AESGCM), KIDLabel, "k1"}
+	value, _ = rejected.get(signLabels...)
+	assert.Equal(1.0, value)
+	value, _ = queued.get(labels...)
+	assert.Equal(0.0, value)
+	value, _ = queued.get(signLabels...)
+	assert.Equal(0.0, value)
+	_, ok := waited.get(labels...)
+	assert.True(ok)
+
+	assert.Nil(pool.Close())
+	assert.Nil(pool.Close())
+	assert.Equal(errRSAPoolClosed, pool.run(context.Background(), RSAPoolSign, cipher, func() {}))
+}
+
+func TestRSAPoolCiphers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	pool := NewRSAPool(RSAPoolOptions{Workers: 1})
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.Nil(err)
+
+	encrypter, err := NewRSAEncrypt(&privateKey.PublicKey, WithSigningKey(privateKey), WithRSAPool(pool))
+	require.Nil(err)
+	decrypter, err := NewRSADecrypt(privateKey, WithVerifyKey(&privateKey.PublicKey), WithRSAPool(pool))
+	require.Nil(err)
+	testCryptoPair(t, encrypter, decrypter, true)
+
+	signer := &rsaPSSSigner{hasher: crypto.SHA256, privateKey: privateKey, publicKey: &privateKey.PublicKey, pool: pool}
+	signature, err := signer.SignMessage([]byte("message"))
+	require.Nil(err)
+	assert.Nil(signer.VerifyMessage([]byte("message"), signature))
+
+	_, err = NewRSAEncrypt(&privateKey.PublicKey, WithRSAPool(nil))
+	assert.NotNil(err)
+
+	// a closed pool fails the private key operations, but not the others
+	crypt, _, err := NewRSAEncrypter(DefaultRSAHash, nil, &privateKey.PublicKey, "").EncryptMessage([]byte("message"))
+	require.Nil(err)
+	require.Nil(pool.Close())
+	_, err = decrypter.DecryptMessage(crypt, make([]byte, privateKey.Size()))
+	assert.Equal(errRSAPoolClosed, err)
+	_, err = signer.SignMessage([]byte("message"))
+	assert.Equal(errRSAPoolClosed, err)
+	assert.Nil(signer.VerifyMessage([]byte("message"), signature))
+}
@@ -0,0 +1,192 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// AWSCurrent is the version stage of the active version of a secret.
+	AWSCurrent = "AWSCURRENT"
+
+	// AWSPrevious is the version stage of the version of a secret that was
+	// active before the last rotation.
+	AWSPrevious = "AWSPREVIOUS"
+
+	// AWSPending is the version stage of a secret in the middle of rotation.
+	AWSPending = "AWSPENDING"
+)
+
+// SecretValue is a version of a secret stored in AWS Secrets Manager.
+type SecretValue struct {
+	// VersionID identifies the version of the secret.
+	VersionID string
+
+	// SecretString is the secret when it was stored as text.
+	SecretString string
+
+	// SecretBinary is the secret when it was stored as binary.
+	SecretBinary []byte
+}
+
+// SecretsManagerClient fetches secrets from AWS Secrets Manager.  It keeps
+// this package free of the AWS SDK; the SDK client can be adapted with
+// SecretsManagerFunc:
+//
+//	voynicrypto.SecretsManagerFunc(func(ctx context.Context, id, stage string) (*voynicrypto.SecretValue, error) {
+//		out, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+//			SecretId:     aws.String(id),
+//			VersionStage: aws.String(stage),
+//		})
+//		if err != nil {
+//			return nil, err
+//		}
+//		return &voynicrypto.SecretValue{
+//			VersionID:    aws.ToString(out.VersionId),
+//			SecretString: aws.ToString(out.SecretString),
+//			SecretBinary: out.SecretBinary,
+//		}, nil
+//	})
+type SecretsManagerClient interface {
+	GetSecretValue(ctx context.Context, secretID, versionStage string) (*SecretValue, error)
+}
+
+// SecretsManagerFunc is a function that implements SecretsManagerClient.
+type SecretsManagerFunc func(ctx context.Context, secretID, versionStage string) (*SecretValue, error)
+
+// GetSecretValue calls the function.
+func (f SecretsManagerFunc) GetSecretValue(ctx context.Context, secretID, versionStage string) (*SecretValue, error) {
+	return f(ctx, secretID, versionStage)
+}
+
+// SecretsManagerLoader loads a key stored as a secret in AWS Secrets Manager.
+type SecretsManagerLoader struct {
+	// Client fetches the secret.
+	Client SecretsManagerClient
+
+	// SecretID is the name or ARN of the secret.
+	SecretID string
+
+	// VersionStage selects the version of the secret.  If not supplied,
+	// AWSCurrent is used instead.
+	VersionStage string
+
+	// JSONKey is set when the secret is a JSON object holding the key as one
+	// of its string fields, which is how the Secrets Manager console stores
+	// key/value secrets.
+	JSONKey string
+
+	// RefreshInterval is how long a fetched secret is reused before it is
+	// fetched again.  If not supplied, the secret is fetched on every call.
+	RefreshInterval time.Duration
+
+	// OnRotate is called when a fetch returns a different version of the
+	// secret than the previous fetch.
+	OnRotate func(oldVersionID, newVersionID string)
+
+	lock      sync.Mutex
+	cached    []byte
+	versionID string
+	fetched   time.Time
+	now       func() time.Time
+}
+
+// GetBytes returns the secret.
+func (s *SecretsManagerLoader) GetBytes() ([]byte, error) {
+	return s.GetBytesContext(context.Background())
+}
+
+// GetBytesContext returns the secret, passing the context to the client.
+func (s *SecretsManagerLoader) GetBytesContext(ctx context.Context) ([]byte, error) {
+	if s.Client == nil {
+		return nil, errors.New("no secrets manager client")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+
+	if s.cached != nil && s.RefreshInterval > 0 && now().Sub(s.fetched) < s.RefreshInterval {
+		return s.cached, nil
+	}
+
+	stage := s.VersionStage
+	if stage == "" {
+		stage = AWSCurrent
+	}
+
+	value, err := s.Client.GetSecretValue(ctx, s.SecretID, stage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s: %w", s.SecretID, err)
+	}
+	if value == nil {
+		return nil, errors.New("secret " + s.SecretID + " has no value")
+	}
+
+	data, err := s.secretBytes(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.versionID != "" && s.versionID != value.VersionID && s.OnRotate != nil {
+		s.OnRotate(s.versionID, value.VersionID)
+	}
+	s.versionID = value.VersionID
+	s.cached = data
+	s.fetched = now()
+	return data, nil
+}
+
+func (s *SecretsManagerLoader) secretBytes(value *SecretValue) ([]byte, error) {
+	if len(value.SecretBinary) > 0 {
+		return value.SecretBinary, nil
+	}
+	if value.SecretString == "" {
+		return nil, errors.New("secret " + s.SecretID + " is empty")
+	}
+	if s.JSONKey == "" {
+		return []byte(value.SecretString), nil
+	}
+
+	var fields map[string]string
+	if err := json.Unmarshal([]byte(value.SecretString), &fields); err != nil {
+		return nil, fmt.Errorf("secret %s is not a JSON object: %w", s.SecretID, err)
+	}
+	field, ok := fields[s.JSONKey]
+	if !ok {
+		return nil, keyNotFound("secret %s has no field %s", s.SecretID, s.JSONKey)
+	}
+	return []byte(field), nil
+}
+
+// VersionID returns the version of the secret that was last fetched.
+func (s *SecretsManagerLoader) VersionID() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.versionID
+}
@@ -0,0 +1,127 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretsManagerLoader(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		calls   int
+		stages  []string
+		version = "v1"
+		secret  = "first"
+	)
+	client := SecretsManagerFunc(func(ctx context.Context, id, stage string) (*SecretValue, error) {
+		calls++
+		stages = append(stages, stage)
+		if id != "my-key" {
+			return nil, errors.New("not found")
+		}
+		return &SecretValue{VersionID: version, SecretString: secret}, nil
+	})
+
+	now := time.Now()
+	var rotations []string
+	loader := &SecretsManagerLoader{
+		Client:          client,
+		SecretID:        "my-key",
+		RefreshInterval: time.Minute,
+		OnRotate: func(oldVersionID, newVersionID string) {
+			rotations = append(rotations, oldVersionID+"->"+newVersionID)
+		},
+		now: func() time.Time { return now },
+	}
+
+	data, err := loader.GetBytes()
+	assert.Nil(err)
+	assert.Equal([]byte("first"), data)
+	assert.Equal("v1", loader.VersionID())
+	assert.Equal([]string{AWSCurrent}, stages)
+
+	// cached until the refresh interval passes
+	version, secret = "v2", "second"
+	data, err = loader.GetBytes()
+	assert.Nil(err)
+	assert.Equal([]byte("first"), data)
+	assert.Equal(1, calls)
+
+	now = now.Add(2 * time.Minute)
+	data, err = loader.GetBytes()
+	assert.Nil(err)
+	assert.Equal([]byte("second"), data)
+	assert.Equal("v2", loader.VersionID())
+	assert.Equal([]string{"v1->v2"}, rotations)
+
+	_, err = (&SecretsManagerLoader{Client: client, SecretID: "missing"}).GetBytes()
+	assert.NotNil(err)
+
+	_, err = (&SecretsManagerLoader{SecretID: "my-key"}).GetBytes()
+	assert.NotNil(err)
+}
+
+func TestSecretsManagerLoaderValues(t *testing.T) {
+	testData := []struct {
+		description string
+		value       *SecretValue
+		jsonKey     string
+		expected    []byte
+		expectedErr bool
+	}{
+		{"binary", &SecretValue{SecretBinary: []byte{1, 2, 3}}, "", []byte{1, 2, 3}, false},
+		{"json field", &SecretValue{SecretString: `{"privateKey":"pem"}`}, "privateKey", []byte("pem"), false},
+		{"missing json field", &SecretValue{SecretString: `{"publicKey":"pem"}`}, "privateKey", nil, true},
+		{"not json", &SecretValue{SecretString: "pem"}, "privateKey", nil, true},
+		{"empty", &SecretValue{}, "", nil, true},
+		{"nil", nil, "", nil, true},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			var stage string
+			loader := &SecretsManagerLoader{
+				Client: SecretsManagerFunc(func(ctx context.Context, id, versionStage string) (*SecretValue, error) {
+					stage = versionStage
+					return tc.value, nil
+				}),
+				SecretID:     "key",
+				VersionStage: AWSPrevious,
+				JSONKey:      tc.jsonKey,
+			}
+
+			data, err := loader.GetBytes()
+			assert.Equal(AWSPrevious, stage)
+			if tc.expectedErr {
+				assert.NotNil(err)
+				return
+			}
+			assert.Nil(err)
+			assert.Equal(tc.expected, data)
+		})
+	}
+}
@@ -0,0 +1,398 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// SelfTestResult is the outcome of the known-answer test of one algorithm.
+type SelfTestResult struct {
+	Algorithm AlgorithmType
+
+	// Err is why the test failed, or nil if it passed.
+	Err error
+}
+
+// Passed reports whether the test passed.
+func (r SelfTestResult) Passed() bool {
+	return r.Err == nil
+}
+
+var (
+	selfTestLock sync.RWMutex
+	selfTests    = map[AlgorithmType]func() error{
+		Box:           selfTestBox,
+		BoxEphemeral:  selfTestBoxEphemeral,
+		RSASymmetric:  selfTestRSASymmetric,
+		RSAAsymmetric: selfTestRSAAsymmetric,
+		RSAPSS:        selfTestRSAPSS,
+		ECDSA:         selfTestECDSA,
+		Ed25519Sign:   selfTestEd25519,
+		AESGCM:        selfTestAESGCM,
+		Ratchet:       selfTestRatchet,
+	}
+)
+
+// RegisterSelfTest adds the known-answer test of an algorithm, so SelfTest
+// covers the ciphers packages add.  An algorithm can only have one test.
+func RegisterSelfTest(alg AlgorithmType, test func() error) error {
+	if alg == "" {
+		return errors.New("no algorithm type specified")
+	}
+	if test == nil {
+		return errors.New("no self-test")
+	}
+
+	selfTestLock.Lock()
+	defer selfTestLock.Unlock()
+
+	if _, ok := selfTests[alg]; ok {
+		return errors.New("self-test for algorithm " + string(alg) + " already registered")
+	}
+	selfTests[alg] = test
+	return nil
+}
+
+// SelfTest runs the known-answer tests of the algorithms, which check each
+// one against fixed vectors through the same code the ciphers use, so a
+// broken build of a crypto dependency is caught at startup.  With no
+// algorithms every test is run, except the ones of algorithms FIPS mode
+// refuses when it's on.  It returns the result of each test, ordered by
+// algorithm, and an ErrSelfTestFailed joining every failure.
+func SelfTest(algorithms ...AlgorithmType) ([]SelfTestResult, error) {
+	selfTestLock.RLock()
+	tests := make(map[AlgorithmType]func() error, len(selfTests))
+	for alg, test := range selfTests {
+		tests[alg] = test
+	}
+	selfTestLock.RUnlock()
+
+	if len(algorithms) == 0 {
+		for alg := range tests {
+			if checkFIPSAlgorithm(alg) == nil {
+				algorithms = append(algorithms, alg)
+			}
+		}
+		sort.Slice(algorithms, func(i, j int) bool { return algorithms[i] < algorithms[j] })
+	}
+
+	results := make([]SelfTestResult, len(algorithms))
+	var errs []error
+	for i, alg := range algorithms {
+		results[i].Algorithm = alg
+		test, ok := tests[alg]
+		if !ok {
+			results[i].Err = fmt.Errorf("%w: no self-test for algorithm %s", ErrSelfTestFailed, alg)
+		} else if err := runSelfTest(test); err != nil {
+			results[i].Err = fmt.Errorf("%w: %s: %w", ErrSelfTestFailed, alg, err)
+		}
+		if results[i].Err != nil {
+			errs = append(errs, results[i].Err)
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// runSelfTest runs the test, turning a panic into an error.
+func runSelfTest(test func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return test()
+}
+
+// knownAnswer encrypts the message, checking the ciphertext against the
+// expected one, and decrypts it again.
+func knownAnswer(encrypter Encrypt, decrypter Decrypt, message []byte, expected string) error {
+	cipher, nonce, err := encrypter.EncryptMessage(message)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(cipher) != expected {
+		return errors.New("wrong ciphertext")
+	}
+	return knownDecrypt(decrypter, cipher, nonce, message)
+}
+
+// knownDecrypt decrypts the ciphertext, checking the message.
+func knownDecrypt(decrypter Decrypt, cipher []byte, nonce []byte, message []byte) error {
+	decrypted, err := decrypter.DecryptMessage(cipher, nonce)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(decrypted, message) {
+		return errors.New("wrong message")
+	}
+	return nil
+}
+
+// fixedNonces fills every nonce with the nonce given.
+func fixedNonces(nonce []byte) NonceSource {
+	return NonceSourceFunc(func(n []byte) error {
+		copy(n, nonce)
+		return nil
+	})
+}
+
+func mustDecodeHex(s string) []byte {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func decodeKey(s string) (key [BoxKeySize]byte) {
+	copy(key[:], mustDecodeHex(s))
+	return key
+}
+
+var selfTestMessage = []byte("voynicrypto known answer")
+
+// The curve25519 keys of RFC 7748 section 6.1.
+const (
+	kat25519AlicePrivate = "77076d0a7318a57d3c16c17251b26645df4c2f87ebc0992ab177fba51db92c2a"
+	kat25519AlicePublic  = "8520f0098930a754748b7ddcb43ef75a0dbf3a0d26381af4eba4a98eaa9b4e6a"
+	kat25519BobPrivate   = "5dab087e624a8a4b79e17f8b83800ee66f3bb1292618b6fd1c2f8b27ff88e0eb"
+	kat25519BobPublic    = "de9edb7d7b7dc1b4d35b61c2ece435373f8343c85b78674dadfc7e146f882b4f"
+	katBoxNonce          = "69696ee955b62b73cd62bda875fc73d68219e0036b7a0b37"
+	katBoxCipher         = "d4e2f73c5e6ff1082576ca7b7366613646f11d341d8a92df7df62c8cb27915c2743b8ae329583802"
+)
+
+func selfTestBox() error {
+	alicePrivate, bobPrivate := decodeKey(kat25519AlicePrivate), decodeKey(kat25519BobPrivate)
+	alicePublic, bobPublic := decodeKey(kat25519AlicePublic), decodeKey(kat25519BobPublic)
+	var derived [BoxKeySize]byte
+	curve25519.ScalarBaseMult(&derived, &alicePrivate)
+	if derived != alicePublic {
+		return errors.New("wrong curve25519 public key")
+	}
+
+	encrypter, err := NewBoxEncrypt(alicePrivate, bobPublic, WithNonceSource(fixedNonces(mustDecodeHex(katBoxNonce))))
+	if err != nil {
+		return err
+	}
+	decrypter, err := NewBoxDecrypt(bobPrivate, alicePublic)
+	if err != nil {
+		return err
+	}
+	return knownAnswer(encrypter, decrypter, selfTestMessage, katBoxCipher)
+}
+
+// selfTestBoxEphemeral uses Alice's key as the ephemeral key, so the cipher
+// is her public key followed by the box of selfTestBox.
+func selfTestBoxEphemeral() error {
+	encrypter, err := NewBoxEphemeralEncrypt(decodeKey(kat25519BobPublic),
+		WithRandom(bytes.NewReader(mustDecodeHex(kat25519AlicePrivate))),
+		WithNonceSource(fixedNonces(mustDecodeHex(katBoxNonce))))
+	if err != nil {
+		return err
+	}
+	decrypter, err := NewBoxEphemeralDecrypt(decodeKey(kat25519BobPrivate))
+	if err != nil {
+		return err
+	}
+	return knownAnswer(encrypter, decrypter, selfTestMessage, kat25519AlicePublic+katBoxCipher)
+}
+
+// The RSA key is built from its primes, and the OAEP ciphertexts and PSS
+// signatures are randomized, so they're decrypted and verified rather than
+// made again.
+const (
+	katRSAPrime1 = "cc1f2e00e7abb5d2aeed94422253692e0fa63d15e1e789ac94fbd2bd4a513d7f" +
+		"431b999efe9e40b9c36136a2585383a7afc24f9f50c7e3dcfce8e7be15a68fd2" +
+		"82d08eec3b489d94b33b1c2345fc9cd6f5289b2d9a3b9221665ebbb68782ce9a" +
+		"284c073c5a8ef67c2eee93459d3bc904f2ac40665704e41ad7490522060c6e17"
+	katRSAPrime2 = "f28a49cf7ac85557ab589d3deec6f5a2fbdd05723cf596d1b7e7da45cea08db0" +
+		"3f4a370a940da50e9cfc533c8264117302d1608cf33a3bf029bf71afef40a8d4" +
+		"54dede2c5452b1f28ec9b9f6a7e4638091c21e35d965896bcbdbf4e9f4b6b1eb" +
+		"a086e4b7cc10da2fc9ba88eecd366fbd36ff1f269a020298a665a26f2992d70f"
+	katRSAOAEPCipher = "70c4dc2ca3ab39dd0a79b572ab934173ad214faaeb00164b50e7651eba1d1dde" +
+		"5603ea5cc1703fec836480bfabc4031b6f458e4752cb09c20adbc48af4c03df9" +
+		"d9d3b6e7a28591d962e7b51a0bb58b5f0d1d356e2a344ad9ca61271fbcef5159" +
+		"f9ef15922f970fa551c30519e670703469961fc9804710836450cf9c390f7c8f" +
+		"45915c8f457ef4f3f7b88d1b676a626a6819a2c1139a313d15b810ff7da757fb" +
+		"6b88d2496f7f634a08c1b6901e8fa99924a645c2fd4c64b5cf66d1024ccafa9f" +
+		"07e91d24ab261cbde7b942b87c585b06da3ac517b64d965942dd0d9c024570cf" +
+		"7db6628d8f2b9e0148e689625718cf77da4620c7c1d6a0231b7f53aa9166da10"
+	katRSAAsymCipher = "55716355ea7ed48944ffcbb81213e9c0f62b4ed292da9faf047227dd80cce169" +
+		"1eb16866ac735b4ae12d522b9379d81532a6de61591811ee3b06ee2681e674b5" +
+		"0d9b3fc343f3ef48070a5fd8049f52ed52da40eb81166d7cff580e1c6265b64e" +
+		"f65cb3fb8afa25ecde5641e96435f798697056015bf640e30e6d4c12f262ae98" +
+		"3ccc5ac5bdb1a46079fcfdb2067cf07c94a3c47554157cb84e5ce2e5f2da96c4" +
+		"f18459324abae4de3b22bf1d8cf0df5b4197e9ceeb5e225208d0d23b0a003187" +
+		"bfb25531e2fc89c8bf22adec409c7d08e7a4ec33389b0f39ffb4b9ba4c1cec98" +
+		"e0e026c7e7caac63404b76854ccd5a96b407b7e3fcf8a0f99a655b41a82bf662"
+	katRSAAsymSign = "884aa564efbe332365e6e82a60e2617916c9830f96fd228ef266eeb656a74401" +
+		"cd349da578eec59241f2f6beca165edc6608aa5fae949abf8a161d2093f46138" +
+		"97f2faba2e7309663ab577a463745f6c2af79bdca0c961806a82a7fd5f3e4a51" +
+		"8a750a8f0fa7e24fecc062d1dad6ee8e698435327aae8deecf760d1e2499064d" +
+		"20a8c6a4d7db004c41cfdf2ebdd406c61b55a465bf617f6b7f9b5b074f11d5b2" +
+		"179726d2d4fa3739a6da55b874863478653823e51771e7293b9852729f939b8d" +
+		"6f603b6b908851a4164dc6251540a587765171cb5a9f73e2cc73bf4927987532" +
+		"6f1b58d56700461b8ea244a303f7a9b96565e486a1e3265a9f2825c61488380b"
+	katRSAPSSSignature = "55f543671a2b3ea47fb9a320e4709f89307097c84ad3d2a32640395285254f04" +
+		"7174892b35c56f34602e874bcbfa4830dbaa65580b42eb4c5e3b3bda1a9b16d6" +
+		"35cf00557e2684308731ba6edab0b793f12c17cebceb8bfa37faa50803924b79" +
+		"8eafc39c8b93f17a6c3a09e20f7ca5fbe0ac42a54f7b51cb86b3b38427da2e4b" +
+		"915f70778ba5ada144629c0cf961f8472ea8145ea393ddadfa10a32ded8113b3" +
+		"0f1a238faeeb5e7dbb5b02327c03c8c8f342e7b626c1c3b2cb9a5c608e404550" +
+		"7965c9c265330dc5f032e8e0849b12dbaccca31fba080620fad998231eab21fe" +
+		"984b6a14a3b3ebe840d581cf8a0cac14c2cbfd0cbccae8a3915d7bce60bb4990"
+)
+
+func selfTestRSAKey() (*rsa.PrivateKey, error) {
+	p := new(big.Int).SetBytes(mustDecodeHex(katRSAPrime1))
+	q := new(big.Int).SetBytes(mustDecodeHex(katRSAPrime2))
+	one := big.NewInt(1)
+	phi := new(big.Int).Mul(new(big.Int).Sub(p, one), new(big.Int).Sub(q, one))
+	key := &rsa.PrivateKey{
+		PublicKey: rsa.PublicKey{N: new(big.Int).Mul(p, q), E: 65537},
+		Primes:    []*big.Int{p, q},
+	}
+	key.D = new(big.Int).ModInverse(big.NewInt(int64(key.E)), phi)
+	if err := key.Validate(); err != nil {
+		return nil, err
+	}
+	key.Precompute()
+	return key, nil
+}
+
+func selfTestRSASymmetric() error {
+	key, err := selfTestRSAKey()
+	if err != nil {
+		return err
+	}
+	decrypter, err := NewRSADecrypt(key, WithHash(crypto.SHA256))
+	if err != nil {
+		return err
+	}
+	return knownDecrypt(decrypter, mustDecodeHex(katRSAOAEPCipher), nil, selfTestMessage)
+}
+
+func selfTestRSAAsymmetric() error {
+	key, err := selfTestRSAKey()
+	if err != nil {
+		return err
+	}
+	decrypter, err := NewRSADecrypt(key, WithHash(crypto.SHA256), WithVerifyKey(&key.PublicKey))
+	if err != nil {
+		return err
+	}
+	return knownDecrypt(decrypter, mustDecodeHex(katRSAAsymCipher), mustDecodeHex(katRSAAsymSign), selfTestMessage)
+}
+
+func selfTestRSAPSS() error {
+	key, err := selfTestRSAKey()
+	if err != nil {
+		return err
+	}
+	return NewRSAPSSVerifier(crypto.SHA256, &key.PublicKey, "").VerifyMessage(selfTestMessage, mustDecodeHex(katRSAPSSSignature))
+}
+
+const (
+	katECDSAPrivate   = "0c7d3906b74d5ee66cbc1176ade8a5ce454da185ed241ed17bfb7e9ec7c1680e"
+	katECDSASignature = "3046022100e95582eacc45222fd0d6f6565d002cb88ab4b3dcb2055ef8c4cdb7" +
+		"19d67a28840221008517097787c7a4b08da67b2f03f7c83d56949aee09eb14a6" +
+		"bc54e0b5e9f87c3a"
+)
+
+func selfTestECDSA() error {
+	key, err := ecdh.P256().NewPrivateKey(mustDecodeHex(katECDSAPrivate))
+	if err != nil {
+		return err
+	}
+	// the uncompressed point, 0x04 || X || Y
+	point := key.PublicKey().Bytes()
+	publicKey := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(point[1:33]),
+		Y:     new(big.Int).SetBytes(point[33:]),
+	}
+	return NewECDSAVerifier(crypto.SHA256, publicKey, "").VerifyMessage(selfTestMessage, mustDecodeHex(katECDSASignature))
+}
+
+// Test 1 of RFC 8032 section 7.1.
+const (
+	katEd25519Seed      = "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60"
+	katEd25519Public    = "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a"
+	katEd25519Signature = "e5564300c360ac729086e2cc806e828a84877f1eb8e5d974d873e065224901555fb8821590a33bacc61e39701cf9b46bd25bf5f0595bbe24655141438e7a100b"
+)
+
+func selfTestEd25519() error {
+	privateKey := ed25519.NewKeyFromSeed(mustDecodeHex(katEd25519Seed))
+	if !bytes.Equal(privateKey.Public().(ed25519.PublicKey), mustDecodeHex(katEd25519Public)) {
+		return errors.New("wrong ed25519 public key")
+	}
+	signature, err := NewEd25519Signer(privateKey, "").SignMessage(nil)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(signature) != katEd25519Signature {
+		return errors.New("wrong signature")
+	}
+	return NewEd25519Verifier(ed25519.PublicKey(mustDecodeHex(katEd25519Public)), "").VerifyMessage(nil, signature)
+}
+
+// Test case 14 of the GCM specification: a zero key, nonce and block.
+const katAESGCMCipher = "cea7403d4d606b6e074ec5d3baf39d18d0d1c8a799996bf0265b98b5d48ab919"
+
+func selfTestAESGCM() error {
+	key := make([]byte, 32)
+	encrypter, err := NewAESGCMEncrypt(key, WithNonceSource(fixedNonces(make([]byte, aesGCMNonceSize))))
+	if err != nil {
+		return err
+	}
+	decrypter, err := NewAESGCMDecrypt(key)
+	if err != nil {
+		return err
+	}
+	return knownAnswer(encrypter, decrypter, make([]byte, 16), katAESGCMCipher)
+}
+
+const katRatchetCipher = "996de962a5be14ec2ff756887f764de27943fa0c3010418dd7882370bd870311ef48af923657c2e8"
+
+func selfTestRatchet() error {
+	key := bytes.Repeat([]byte{0x73}, RatchetKeySize)
+	sender, err := NewRatchetSession(key)
+	if err != nil {
+		return err
+	}
+	receiver, err := NewRatchetSession(key)
+	if err != nil {
+		return err
+	}
+	return knownAnswer(sender, receiver, selfTestMessage, katRatchetCipher)
+}
@@ -0,0 +1,93 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfTest(t *testing.T) {
+	assert := assert.New(t)
+
+	results, err := SelfTest()
+	assert.Nil(err)
+	assert.NotEmpty(results)
+	for _, result := range results {
+		assert.True(result.Passed(), "%s: %v", result.Algorithm, result.Err)
+	}
+
+	results, err = SelfTest(AESGCM, Ed25519Sign)
+	assert.Nil(err)
+	assert.Equal([]SelfTestResult{{Algorithm: AESGCM}, {Algorithm: Ed25519Sign}}, results)
+
+	results, err = SelfTest("rot13")
+	assert.True(errors.Is(err, ErrSelfTestFailed))
+	if assert.Len(results, 1) {
+		assert.False(results[0].Passed())
+	}
+}
+
+func TestSelfTestFIPSMode(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	if fipsBuild || GetFIPSStatus().GoFIPS140 {
+		t.Skip("fips mode is always on")
+	}
+
+	require.Nil(SetFIPSMode(true))
+	defer SetFIPSMode(false)
+
+	results, err := SelfTest()
+	assert.Nil(err)
+	for _, result := range results {
+		assert.Nil(checkFIPSAlgorithm(result.Algorithm), string(result.Algorithm))
+	}
+}
+
+func TestRegisterSelfTest(t *testing.T) {
+	assert := assert.New(t)
+
+	failure := errors.New("wrong answer")
+	assert.Nil(RegisterSelfTest("test-self-test-fails", func() error { return failure }))
+	assert.Nil(RegisterSelfTest("test-self-test-panics", func() error { panic("boom") }))
+	defer func() {
+		selfTestLock.Lock()
+		delete(selfTests, "test-self-test-fails")
+		delete(selfTests, "test-self-test-panics")
+		selfTestLock.Unlock()
+	}()
+
+	assert.NotNil(RegisterSelfTest("", func() error { return nil }))
+	assert.NotNil(RegisterSelfTest("test-self-test-nil", nil))
+	assert.NotNil(RegisterSelfTest("test-self-test-fails", func() error { return nil }))
+	assert.NotNil(RegisterSelfTest(AESGCM, func() error { return nil }))
+
+	results, err := SelfTest("test-self-test-fails", AESGCM, "test-self-test-panics")
+	assert.True(errors.Is(err, ErrSelfTestFailed))
+	assert.True(errors.Is(err, failure))
+	if assert.Len(results, 3) {
+		assert.True(errors.Is(results[0].Err, failure))
+		assert.True(results[1].Passed())
+		assert.Contains(results[2].Err.Error(), "boom")
+	}
+}
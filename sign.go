@@ -0,0 +1,461 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// DefaultSignHash is the hash used by the rsa-pss and ecdsa signers when the
+// config has no hash param.
+const DefaultSignHash = crypto.SHA256
+
+// Sign represents the ability to sign messages.
+type Sign interface {
+	Identification
+
+	// SignMessage returns the signature of the message.
+	SignMessage(message []byte) (signature []byte, err error)
+}
+
+// Verify represents the ability to verify signatures.
+type Verify interface {
+	Identification
+
+	// VerifyMessage returns an error if the signature isn't valid for the
+	// message.
+	VerifyMessage(message []byte, signature []byte) error
+}
+
+// SignLoader loads a signer.
+type SignLoader interface {
+	LoadSign() (Sign, error)
+}
+
+// VerifyLoader loads a verifier.
+type VerifyLoader interface {
+	LoadVerify() (Verify, error)
+}
+
+// ContextSignLoader loads a signer, passing the context to the key loaders.
+type ContextSignLoader interface {
+	SignLoader
+	LoadSignContext(ctx context.Context) (Sign, error)
+}
+
+// ContextVerifyLoader loads a verifier, passing the context to the key
+// loaders.
+type ContextVerifyLoader interface {
+	VerifyLoader
+	LoadVerifyContext(ctx context.Context) (Verify, error)
+}
+
+var errNotSigningAlgorithm = errors.New("algorithm is not a signing algorithm")
+
+// isSigningAlgorithm reports whether the algorithm signs rather than
+// encrypts.
+func isSigningAlgorithm(alg AlgorithmType) bool {
+	switch alg {
+	case Ed25519Sign, RSAPSS, ECDSA:
+		return true
+	}
+	return false
+}
+
+// LoadSign loads the signer of a signing config from its private key.
+func (config *Config) LoadSign() (Sign, error) {
+	return config.LoadSignContext(context.Background())
+}
+
+// LoadSignContext loads the signer, passing the context to the key loaders.
+func (config *Config) LoadSignContext(ctx context.Context) (Sign, error) {
+	signer, err := config.loadSign(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.deriveKID(signer); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+func (config *Config) loadSign(ctx context.Context) (Sign, error) {
+	if !isSigningAlgorithm(config.Type) {
+		return nil, errNotSigningAlgorithm
+	}
+	if config.Logger == nil {
+		config.Logger = DefaultLogger()
+	}
+	logDebug(config.Logger, "new signer", "config", config)
+
+	if config.GenerateMissingKeys {
+		if err := config.generateMissingKeys(); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkFIPSAlgorithm(config.Type); err != nil {
+		return nil, err
+	}
+	if !config.hasKey(PrivateKey) {
+		return nil, errIncorrectKeys
+	}
+	loader := config.keyLoader(PrivateKey)
+
+	switch config.Type {
+	case Ed25519Sign:
+		privateKey, err := GetEd25519PrivateKeyContext(ctx, loader)
+		if err != nil {
+			return nil, err
+		}
+		return NewEd25519Signer(privateKey, config.KID), nil
+	case RSAPSS:
+		hash, err := config.signHash()
+		if err != nil {
+			return nil, err
+		}
+		privateKey, err := GetPrivateKeyContext(ctx, loader)
+		if err != nil {
+			return nil, err
+		}
+		if err := config.checkRSAPSS(hash, privateKey, nil); err != nil {
+			return nil, err
+		}
+		return &rsaPSSSigner{kid: config.KID, hasher: hash, privateKey: privateKey, publicKey: &privateKey.PublicKey, random: config.Random, pool: config.RSAPool}, nil
+	default:
+		hash, curve, err := config.ecdsaParams()
+		if err != nil {
+			return nil, err
+		}
+		privateKey, err := GetECPrivateKeyContext(ctx, loader, curve)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsaSigner{kid: config.KID, hasher: hash, privateKey: privateKey, publicKey: &privateKey.PublicKey, random: config.Random}, nil
+	}
+}
+
+// LoadVerify loads the verifier of a signing config from its public key.
+func (config *Config) LoadVerify() (Verify, error) {
+	return config.LoadVerifyContext(context.Background())
+}
+
+// LoadVerifyContext loads the verifier, passing the context to the key
+// loaders.
+func (config *Config) LoadVerifyContext(ctx context.Context) (Verify, error) {
+	verifier, err := config.loadVerify(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.deriveKID(verifier); err != nil {
+		return nil, err
+	}
+	return verifier, nil
+}
+
+func (config *Config) loadVerify(ctx context.Context) (Verify, error) {
+	if !isSigningAlgorithm(config.Type) {
+		return nil, errNotSigningAlgorithm
+	}
+	if config.Logger == nil {
+		config.Logger = DefaultLogger()
+	}
+	logDebug(config.Logger, "new verifier", "config", config)
+
+	if config.GenerateMissingKeys {
+		if err := config.generateMissingKeys(); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkFIPSAlgorithm(config.Type); err != nil {
+		return nil, err
+	}
+	if !config.hasKey(PublicKey) {
+		return nil, errIncorrectKeys
+	}
+	loader := config.keyLoader(PublicKey)
+
+	switch config.Type {
+	case Ed25519Sign:
+		publicKey, err := GetEd25519PublicKeyContext(ctx, loader)
+		if err != nil {
+			return nil, err
+		}
+		return NewEd25519Verifier(publicKey, config.KID), nil
+	case RSAPSS:
+		hash, err := config.signHash()
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := GetPublicKeyContext(ctx, loader)
+		if err != nil {
+			return nil, err
+		}
+		if err := config.checkRSAPSS(hash, nil, publicKey); err != nil {
+			return nil, err
+		}
+		return NewRSAPSSVerifier(hash, publicKey, config.KID), nil
+	default:
+		hash, curve, err := config.ecdsaParams()
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := GetECPublicKeyContext(ctx, loader, curve)
+		if err != nil {
+			return nil, err
+		}
+		return NewECDSAVerifier(hash, publicKey, config.KID), nil
+	}
+}
+
+// signHash returns the hash param, or DefaultSignHash if there isn't one.
+func (config *Config) signHash() (crypto.Hash, error) {
+	hash := DefaultSignHash
+	if config.Params["hash"] != "" {
+		var err error
+		if hash, err = (&BasicHashLoader{HashName: config.Params["hash"]}).GetHash(); err != nil {
+			return 0, err
+		}
+	}
+	if config.Strict || StrictMode() {
+		if err := checkStrictHash(hash); err != nil {
+			return 0, err
+		}
+	}
+	if err := checkFIPSRSA(hash, nil, nil); err != nil {
+		return 0, err
+	}
+	return hash, nil
+}
+
+func (config *Config) checkRSAPSS(hash crypto.Hash, privateKey *rsa.PrivateKey, publicKey *rsa.PublicKey) error {
+	if config.Strict || StrictMode() {
+		if err := checkStrictRSA(hash, privateKey, publicKey); err != nil {
+			return err
+		}
+	}
+	return checkFIPSRSA(hash, privateKey, publicKey)
+}
+
+// ecdsaParams returns the hash and the optional curve params.
+func (config *Config) ecdsaParams() (crypto.Hash, elliptic.Curve, error) {
+	hash, err := config.signHash()
+	if err != nil {
+		return 0, nil, err
+	}
+	var curve elliptic.Curve
+	if config.Params["curve"] != "" {
+		if curve, err = ParseCurve(config.Params["curve"]); err != nil {
+			return 0, nil, err
+		}
+	}
+	return hash, curve, nil
+}
+
+type ed25519Signer struct {
+	kid        string
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+	lock       sync.RWMutex
+	closed     bool
+}
+
+// NewEd25519Signer returns a signer using the ed25519 private key.
+func NewEd25519Signer(privateKey ed25519.PrivateKey, kid string) Sign {
+	return &ed25519Signer{kid: kid, privateKey: privateKey, publicKey: privateKey.Public().(ed25519.PublicKey)}
+}
+
+// NewEd25519Verifier returns a verifier using the ed25519 public key.
+func NewEd25519Verifier(publicKey ed25519.PublicKey, kid string) Verify {
+	return &ed25519Signer{kid: kid, publicKey: publicKey}
+}
+
+// GetAlgorithm returns Ed25519Sign.
+func (s *ed25519Signer) GetAlgorithm() AlgorithmType {
+	return Ed25519Sign
+}
+
+// GetKID returns the KID.
+func (s *ed25519Signer) GetKID() string {
+	return s.kid
+}
+
+// SignMessage signs the message with ed25519.
+func (s *ed25519Signer) SignMessage(message []byte) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return nil, errCipherClosed
+	}
+	return ed25519.Sign(s.privateKey, message), nil
+}
+
+// VerifyMessage verifies the ed25519 signature.
+func (s *ed25519Signer) VerifyMessage(message []byte, signature []byte) error {
+	if err := checkSignatureSize(signature, ed25519.SignatureSize); err != nil {
+		return err
+	}
+	if !ed25519.Verify(s.publicKey, message, signature) {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
+
+type rsaPSSSigner struct {
+	kid        string
+	hasher     crypto.Hash
+	privateKey *rsa.PrivateKey
+	publicKey  *rsa.PublicKey
+	random     io.Reader
+	pool       *RSAPool
+	lock       sync.RWMutex
+	closed     bool
+}
+
+// rsaPSSSignOptions and rsaPSSVerifyOptions are the options of RSA-PSS
+// signatures, which are shared rather than made for every message.
+var (
+	rsaPSSSignOptions   = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+	rsaPSSVerifyOptions = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}
+)
+
+// NewRSAPSSSigner returns a signer using RSA-PSS.
+func NewRSAPSSSigner(hash crypto.Hash, privateKey *rsa.PrivateKey, kid string) Sign {
+	precomputeRSAKey(privateKey)
+	return &rsaPSSSigner{kid: kid, hasher: hash, privateKey: privateKey, publicKey: &privateKey.PublicKey}
+}
+
+// NewRSAPSSVerifier returns a verifier using RSA-PSS.
+func NewRSAPSSVerifier(hash crypto.Hash, publicKey *rsa.PublicKey, kid string) Verify {
+	return &rsaPSSSigner{kid: kid, hasher: hash, publicKey: publicKey}
+}
+
+// GetAlgorithm returns RSAPSS.
+func (s *rsaPSSSigner) GetAlgorithm() AlgorithmType {
+	return RSAPSS
+}
+
+// GetKID returns the KID.
+func (s *rsaPSSSigner) GetKID() string {
+	return s.kid
+}
+
+// SignMessage signs the message with RSA-PSS.
+func (s *rsaPSSSigner) SignMessage(message []byte) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return nil, errCipherClosed
+	}
+	hashed := hashMessage(s.hasher, message)
+	defer putDigest(hashed)
+	var (
+		signature []byte
+		err       error
+	)
+	if poolErr := s.pool.run(context.Background(), RSAPoolSign, s, func() {
+		signature, err = rsa.SignPSS(randomOrDefault(s.random), s.privateKey, s.hasher, *hashed, rsaPSSSignOptions)
+	}); poolErr != nil {
+		return nil, poolErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+	return signature, nil
+}
+
+// VerifyMessage verifies the RSA-PSS signature.
+func (s *rsaPSSSigner) VerifyMessage(message []byte, signature []byte) error {
+	if err := checkSignatureSize(signature, s.publicKey.Size()); err != nil {
+		return err
+	}
+	hashed := hashMessage(s.hasher, message)
+	defer putDigest(hashed)
+	if err := rsa.VerifyPSS(s.publicKey, s.hasher, *hashed, signature, rsaPSSVerifyOptions); err != nil {
+		return fmt.Errorf("%w: %w", ErrSignatureInvalid, err)
+	}
+	return nil
+}
+
+type ecdsaSigner struct {
+	kid        string
+	hasher     crypto.Hash
+	privateKey *ecdsa.PrivateKey
+	publicKey  *ecdsa.PublicKey
+	random     io.Reader
+	lock       sync.RWMutex
+	closed     bool
+}
+
+// NewECDSASigner returns a signer using ECDSA.  Signatures are ASN.1 encoded.
+func NewECDSASigner(hash crypto.Hash, privateKey *ecdsa.PrivateKey, kid string) Sign {
+	return &ecdsaSigner{kid: kid, hasher: hash, privateKey: privateKey, publicKey: &privateKey.PublicKey}
+}
+
+// NewECDSAVerifier returns a verifier using ECDSA.
+func NewECDSAVerifier(hash crypto.Hash, publicKey *ecdsa.PublicKey, kid string) Verify {
+	return &ecdsaSigner{kid: kid, hasher: hash, publicKey: publicKey}
+}
+
+// GetAlgorithm returns ECDSA.
+func (s *ecdsaSigner) GetAlgorithm() AlgorithmType {
+	return ECDSA
+}
+
+// GetKID returns the KID.
+func (s *ecdsaSigner) GetKID() string {
+	return s.kid
+}
+
+// SignMessage signs the message with ECDSA.
+func (s *ecdsaSigner) SignMessage(message []byte) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return nil, errCipherClosed
+	}
+	hashed := hashMessage(s.hasher, message)
+	defer putDigest(hashed)
+	signature, err := ecdsa.SignASN1(randomOrDefault(s.random), s.privateKey, *hashed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+	return signature, nil
+}
+
+// VerifyMessage verifies the ECDSA signature.
+func (s *ecdsaSigner) VerifyMessage(message []byte, signature []byte) error {
+	// ASN.1 signatures vary in length, but are never empty
+	if len(signature) == 0 {
+		return fmt.Errorf("%w: empty signature", ErrSignatureInvalid)
+	}
+	hashed := hashMessage(s.hasher, message)
+	defer putDigest(hashed)
+	if !ecdsa.VerifyASN1(s.publicKey, *hashed, signature) {
+		return ErrSignatureInvalid
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ecdsaKeyLoaders(t *testing.T, curve elliptic.Curve) map[KeyType]KeyLoader {
+	require := require.New(t)
+
+	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+	require.Nil(err)
+	privateData, err := x509.MarshalECPrivateKey(privateKey)
+	require.Nil(err)
+	publicData, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.Nil(err)
+
+	return map[KeyType]KeyLoader{
+		PrivateKey: &BytesLoader{Data: pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privateData})},
+		PublicKey:  &BytesLoader{Data: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicData})},
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	dir := t.TempDir()
+	keys := func(name string) map[KeyType]string {
+		return map[KeyType]string{
+			PrivateKey: filepath.Join(dir, name+"-private.pem"),
+			PublicKey:  filepath.Join(dir, name+"-public.pem"),
+		}
+	}
+
+	testData := []struct {
+		description string
+		config      Config
+	}{
+		{"ed25519", Config{Type: Ed25519Sign, KID: "ed", Keys: keys("ed25519"), GenerateMissingKeys: true}},
+		{"rsa-pss", Config{Type: RSAPSS, KID: "pss", Keys: keys("rsa"), GenerateMissingKeys: true}},
+		{"rsa-pss sha512", Config{Type: RSAPSS, Params: map[string]string{"hash": "SHA512"}, Keys: keys("rsa")}},
+		{"ecdsa", Config{Type: ECDSA, KID: "ec", Loaders: ecdsaKeyLoaders(t, elliptic.P256())}},
+		{"ecdsa p384", Config{Type: ECDSA, Params: map[string]string{"hash": "SHA384", "curve": "P-384"},
+			Loaders: ecdsaKeyLoaders(t, elliptic.P384())}},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			signer, err := tc.config.LoadSign()
+			require.Nil(err)
+			verifier, err := tc.config.LoadVerify()
+			require.Nil(err)
+			require.Nil(tc.config.Validate())
+
+			assert.Equal(tc.config.Type, signer.GetAlgorithm())
+			assert.Equal(tc.config.Type, verifier.GetAlgorithm())
+			assert.Equal(tc.config.KID, signer.GetKID())
+
+			signature, err := signer.SignMessage([]byte("hello"))
+			require.Nil(err)
+			assert.Nil(verifier.VerifyMessage([]byte("hello"), signature))
+			assert.NotNil(verifier.VerifyMessage([]byte("jello"), signature))
+			signature[0] ^= 1
+			assert.NotNil(verifier.VerifyMessage([]byte("hello"), signature))
+		})
+	}
+}
+
+func TestSignConfigErrors(t *testing.T) {
+	testData := []struct {
+		description string
+		config      Config
+	}{
+		{"encryption algorithm", Config{Type: Box}},
+		{"no keys", Config{Type: Ed25519Sign}},
+		{"bad hash", Config{Type: RSAPSS, Params: map[string]string{"hash": "nope"}, Loaders: map[KeyType]KeyLoader{
+			PrivateKey: &BytesLoader{}, PublicKey: &BytesLoader{},
+		}}},
+		{"wrong curve", Config{Type: ECDSA, Params: map[string]string{"curve": "P-521"}, Loaders: ecdsaKeyLoaders(t, elliptic.P256())}},
+		{"bad curve", Config{Type: ECDSA, Params: map[string]string{"curve": "P-1"}, Loaders: ecdsaKeyLoaders(t, elliptic.P256())}},
+		{"wrong key", Config{Type: Ed25519Sign, Loaders: ecdsaKeyLoaders(t, elliptic.P256())}},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			_, err := tc.config.LoadSign()
+			assert.NotNil(err)
+			_, err = tc.config.LoadVerify()
+			assert.NotNil(err)
+		})
+	}
+
+	_, err := (&Config{Type: RSAPSS}).LoadEncrypt()
+	assert.NotNil(t, err, "signing algorithms don't encrypt")
+
+	assert.Equal(t, ECDSA, ParseAlgorithmType("ECDSA"))
+	var alg AlgorithmType
+	assert.Nil(t, alg.UnmarshalText([]byte("RSA_PSS")))
+	assert.Equal(t, RSAPSS, alg)
+}
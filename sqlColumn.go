@@ -0,0 +1,145 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+// Column encrypts the values of a database column for database/sql.  Pass
+// Value(plain) as the argument of an INSERT or UPDATE, and Scan(&plain) to
+// rows.Scan to decrypt what is read.  Each value is stored as a marshalled
+// Envelope, so rows written with old keys can still be read as long as the
+// Router knows their KID.  NULL stays NULL.
+//
+// The column name is bound to every value as associated data, so a value
+// copied into another column can't be decrypted, and the encrypter must
+// support associated data.
+//
+// Encrypted values are random, so the column can't be searched.  To look rows
+// up by equality either store a BlindIndex of the value in another column, or
+// make the column deterministic with an AES-GCM encrypter built with
+// WithDeterministicNonces: then Value(plain) of a value is the same every
+// time and can be used in a WHERE clause, which reveals which rows are equal.
+type Column struct {
+	// Name is the name of the column, usually qualified by its table.
+	Name string
+
+	// Encrypter encrypts the values written.
+	Encrypter Encrypt
+
+	// Router finds the decrypter of the values read.
+	Router *Router
+
+	// Encoding, if set, stores the values as text in the encoding given,
+	// for columns that can't hold bytes.
+	Encoding TransportEncoding
+}
+
+var errNoColumnCipher = errors.New("no cipher configured for column")
+
+func (c *Column) ad() []byte {
+	return []byte("voynicrypto-column:" + c.Name)
+}
+
+// Value returns the driver value to write for the plain value: the sealed
+// envelope, or NULL if plain is nil.
+func (c *Column) Value(plain []byte) driver.Valuer {
+	return columnValue{column: c, plain: plain}
+}
+
+type columnValue struct {
+	column *Column
+	plain  []byte
+}
+
+// Value seals the value.
+func (v columnValue) Value() (driver.Value, error) {
+	if v.plain == nil {
+		return nil, nil
+	}
+	c := v.column
+	if c.Encrypter == nil {
+		return nil, errNoColumnCipher
+	}
+	e, err := SealEnvelopeWithAD(c.Encrypter, v.plain, c.ad())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt column %s: %w", c.Name, err)
+	}
+	if c.Encoding != "" {
+		return e.Encode(c.Encoding)
+	}
+	return e.MarshalBinary()
+}
+
+// Scan returns a sql.Scanner that decrypts the value read into dst.  NULL is
+// read as nil.
+func (c *Column) Scan(dst *[]byte) sql.Scanner {
+	return columnScanner{column: c, dst: dst}
+}
+
+type columnScanner struct {
+	column *Column
+	dst    *[]byte
+}
+
+// Scan opens the envelope read from the database.
+func (s columnScanner) Scan(src interface{}) error {
+	c := s.column
+	var e *Envelope
+	switch value := src.(type) {
+	case nil:
+		*s.dst = nil
+		return nil
+	case []byte:
+		if c.Encoding != "" {
+			return s.Scan(string(value))
+		}
+		e = new(Envelope)
+		if err := e.UnmarshalBinary(value); err != nil {
+			return fmt.Errorf("invalid value in column %s: %w", c.Name, err)
+		}
+	case string:
+		if c.Encoding == "" {
+			return s.Scan([]byte(value))
+		}
+		var err error
+		if e, err = ParseEnvelope(value, c.Encoding); err != nil {
+			return fmt.Errorf("invalid value in column %s: %w", c.Name, err)
+		}
+	default:
+		return fmt.Errorf("can't decrypt column %s from %T", c.Name, src)
+	}
+
+	if c.Router == nil {
+		return errNoColumnCipher
+	}
+	decrypter, err := c.Router.Route(e.Algorithm, e.KID)
+	if err != nil {
+		return err
+	}
+	plain, err := e.OpenWithAD(decrypter, c.ad())
+	if err != nil {
+		return fmt.Errorf("failed to decrypt column %s: %w", c.Name, err)
+	}
+	*s.dst = plain
+	return nil
+}
@@ -0,0 +1,91 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Column must work with database/sql.
+var _ sql.Scanner = columnScanner{}
+var _ driver.Valuer = columnValue{}
+
+func TestColumn(t *testing.T) {
+	key := make([]byte, 32)
+	encrypter, err := NewAESGCMEncrypt(key, WithKID("k1"), WithDeterministicNonces())
+	require.Nil(t, err)
+	decrypter, err := NewAESGCMDecrypt(key, WithKID("k1"))
+	require.Nil(t, err)
+	router := NewRouter(nil)
+	require.Nil(t, router.Register(decrypter))
+
+	testData := []struct {
+		description string
+		encoding    TransportEncoding
+	}{
+		{"bytes", ""},
+		{"text", Base64URL},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			column := &Column{Name: "users.email", Encrypter: encrypter, Router: router, Encoding: tc.encoding}
+			stored, err := column.Value([]byte("alice@example.com")).Value()
+			require.Nil(err)
+			if tc.encoding != "" {
+				assert.IsType("", stored)
+			} else {
+				assert.IsType([]byte{}, stored)
+			}
+
+			again, err := column.Value([]byte("alice@example.com")).Value()
+			require.Nil(err)
+			assert.Equal(stored, again, "deterministic values can be looked up")
+
+			var plain []byte
+			require.Nil(column.Scan(&plain).Scan(stored))
+			assert.Equal("alice@example.com", string(plain))
+
+			stored, err = column.Value(nil).Value()
+			require.Nil(err)
+			assert.Nil(stored)
+			require.Nil(column.Scan(&plain).Scan(nil))
+			assert.Nil(plain)
+
+			stored, err = column.Value([]byte("bob@example.com")).Value()
+			require.Nil(err)
+			other := &Column{Name: "users.name", Router: router, Encoding: tc.encoding}
+			assert.NotNil(other.Scan(&plain).Scan(stored), "wrong column")
+			assert.NotNil(column.Scan(&plain).Scan(42))
+			assert.NotNil(column.Scan(&plain).Scan("garbage"))
+		})
+	}
+
+	var plain []byte
+	_, err = (&Column{Name: "empty"}).Value([]byte("x")).Value()
+	assert.NotNil(t, err)
+	assert.NotNil(t, (&Column{Name: "empty"}).Scan(&plain).Scan([]byte{}))
+}
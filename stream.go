@@ -0,0 +1,382 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// StreamSegmentSize is the amount of plaintext sealed in each segment of a
+// stream.
+const StreamSegmentSize = 64 * 1024
+
+const (
+	streamKeySize   = 32
+	streamNonceSize = 12
+	streamMaxHeader = 64 * 1024
+)
+
+var (
+	streamMagic = []byte("VCS1")
+
+	errStreamClosed    = errors.New("stream closed")
+	errStreamTruncated = errors.New("stream truncated")
+	errStreamTrailing  = errors.New("data after the final stream segment")
+)
+
+// EncryptStream returns a writer that encrypts everything written to it into
+// dst.  Each stream gets a random data key which is encrypted with the
+// encrypter and written at the start of dst.  The plaintext is then sealed
+// with AES-256-GCM in segments of StreamSegmentSize, so memory use doesn't
+// depend on the size of the payload.  The writer must be closed to write the
+// final segment; until then the stream can't be decrypted.  The data key is
+// read from the source set with WithRandom, or crypto/rand, and is wiped as
+// soon as the segment cipher is made from it.
+func EncryptStream(encrypter Encrypt, dst io.Writer, options ...CipherOption) (io.WriteCloser, error) {
+	o, err := newCipherOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := startStream(encrypter, dst, o.random)
+	if err != nil {
+		return nil, err
+	}
+	return &streamWriter{
+		dst:    dst,
+		aead:   aead,
+		buffer: make([]byte, 0, StreamSegmentSize),
+	}, nil
+}
+
+// startStream generates the data key of a stream and writes the header with
+// the encrypted key to dst, returning the AEAD of the segments.  The key is
+// read from random, or crypto/rand if it's nil.
+func startStream(encrypter Encrypt, dst io.Writer, random io.Reader) (cipher.AEAD, error) {
+	key := make([]byte, streamKeySize)
+	defer wipe(key)
+	if _, err := io.ReadFull(randomOrDefault(random), key); err != nil {
+		return nil, fmt.Errorf("failed to generate stream key: %w", err)
+	}
+	wrappedKey, nonce, err := encrypter.EncryptMessage(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt stream key: %w", err)
+	}
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var header bytes.Buffer
+	header.Write(streamMagic)
+	writeStreamField(&header, wrappedKey)
+	writeStreamField(&header, nonce)
+	if _, err := dst.Write(header.Bytes()); err != nil {
+		return nil, err
+	}
+	return aead, nil
+}
+
+// DecryptStream reads the header written by EncryptStream from src, decrypts
+// the data key with the decrypter, and returns a reader of the plaintext.  A
+// stream that was tampered with, cut short or followed by more data fails
+// with an error rather than ending early.
+func DecryptStream(decrypter Decrypt, src io.Reader) (io.Reader, error) {
+	magic := make([]byte, len(streamMagic))
+	if _, err := io.ReadFull(src, magic); err != nil {
+		return nil, fmt.Errorf("failed to read stream header: %w", err)
+	}
+	if !bytes.Equal(magic, streamMagic) {
+		return nil, errors.New("not an encrypted stream")
+	}
+	wrappedKey, err := readStreamField(src)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := readStreamField(src)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := decrypter.DecryptMessage(wrappedKey, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt stream key: %w", err)
+	}
+	defer wipe(key)
+	if len(key) != streamKeySize {
+		return nil, errors.New("invalid stream key")
+	}
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &streamReader{
+		src:  src,
+		aead: aead,
+	}, nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// streamNonce is the segment counter followed by a flag marking the final
+// segment, so segments can't be reordered, dropped or the stream truncated.
+// The key is never reused across streams so the nonce needs no random part.
+func streamNonce(counter uint64, final bool) []byte {
+	nonce := make([]byte, streamNonceSize)
+	binary.BigEndian.PutUint64(nonce, counter)
+	if final {
+		nonce[streamNonceSize-1] = 1
+	}
+	return nonce
+}
+
+func writeStreamField(buffer *bytes.Buffer, field []byte) {
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(field)))
+	buffer.Write(size[:])
+	buffer.Write(field)
+}
+
+func readStreamField(src io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(src, size[:]); err != nil {
+		return nil, fmt.Errorf("failed to read stream header: %w", err)
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > streamMaxHeader {
+		return nil, errors.New("stream header too large")
+	}
+	field := make([]byte, n)
+	if _, err := io.ReadFull(src, field); err != nil {
+		return nil, fmt.Errorf("failed to read stream header: %w", err)
+	}
+	return field, nil
+}
+
+type streamWriter struct {
+	dst     io.Writer
+	aead    cipher.AEAD
+	buffer  []byte
+	counter uint64
+	closed  bool
+}
+
+// Write buffers the data and seals every full segment.
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errStreamClosed
+	}
+	written := 0
+	for len(p) > 0 {
+		n := copy(w.buffer[len(w.buffer):cap(w.buffer)], p)
+		w.buffer = w.buffer[:len(w.buffer)+n]
+		p = p[n:]
+		written += n
+
+		// a full segment is only sealed once more data arrives, since the
+		// last segment has to be marked as final
+		if len(w.buffer) == cap(w.buffer) && len(p) > 0 {
+			if err := w.seal(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close seals the final segment and drops the segment cipher.  It doesn't
+// close the destination.
+func (w *streamWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := w.seal(true)
+	w.aead = nil
+	return err
+}
+
+// seal writes the buffered data as a segment prefixed with its size.
+func (w *streamWriter) seal(final bool) error {
+	segment := w.aead.Seal(nil, streamNonce(w.counter, final), w.buffer, nil)
+	w.counter++
+	w.buffer = w.buffer[:0]
+	return writeStreamSegment(w.dst, segment)
+}
+
+// writeStreamSegment writes a sealed segment prefixed with its size.
+func writeStreamSegment(dst io.Writer, segment []byte) error {
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(segment)))
+	if _, err := dst.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := dst.Write(segment)
+	return err
+}
+
+type streamReader struct {
+	src     io.Reader
+	aead    cipher.AEAD
+	segment []byte
+	counter uint64
+	final   bool
+	err     error
+}
+
+// Read returns plaintext, opening segments as they are needed.
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.segment) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.final {
+			return 0, io.EOF
+		}
+		r.err = r.open()
+	}
+	n := copy(p, r.segment)
+	r.segment = r.segment[n:]
+	return n, nil
+}
+
+// open reads and authenticates the next segment.  Whether it's the final
+// segment is learned by which nonce opens it, and the final segment is only
+// returned once src is known to end with it.
+func (r *streamReader) open() error {
+	var size [4]byte
+	if _, err := io.ReadFull(r.src, size[:]); err != nil {
+		if err == io.EOF {
+			return errStreamTruncated
+		}
+		return err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > StreamSegmentSize+uint32(r.aead.Overhead()) {
+		return errors.New("stream segment too large")
+	}
+	sealed := make([]byte, n)
+	if _, err := io.ReadFull(r.src, sealed); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errStreamTruncated
+		}
+		return err
+	}
+
+	segment, err := r.aead.Open(nil, streamNonce(r.counter, false), sealed, nil)
+	if err != nil {
+		segment, err = r.aead.Open(nil, streamNonce(r.counter, true), sealed, nil)
+		if err != nil {
+			return fmt.Errorf("%w: stream segment", ErrDecryptFailed)
+		}
+		if err := expectEOF(r.src); err != nil {
+			return err
+		}
+		r.final = true
+	}
+	r.counter++
+	r.segment = segment
+	return nil
+}
+
+// expectEOF fails unless src has nothing left to read.
+func expectEOF(src io.Reader) error {
+	var extra [1]byte
+	n, err := io.ReadFull(src, extra[:])
+	if n > 0 {
+		return errStreamTrailing
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// NewEncryptWriter returns a writer that encrypts into w with EncryptStream.
+// The stream is started on the first Write or Close, and any error starting it
+// is returned from there, so the writer can be dropped into an io pipeline
+// like gzip or tar.  It must be closed to finish the stream; closing it
+// doesn't close w.  The options are passed to EncryptStream.
+func NewEncryptWriter(w io.Writer, encrypter Encrypt, options ...CipherOption) io.WriteCloser {
+	return &encryptWriter{dst: w, encrypter: encrypter, options: options}
+}
+
+// NewDecryptReader returns a reader of the plaintext of a stream written by
+// EncryptStream or NewEncryptWriter.  The stream header is read on the first
+// Read, and any error reading it is returned from there.
+func NewDecryptReader(r io.Reader, decrypter Decrypt) io.Reader {
+	return &decryptReader{src: r, decrypter: decrypter}
+}
+
+type encryptWriter struct {
+	dst       io.Writer
+	encrypter Encrypt
+	options   []CipherOption
+	stream    io.WriteCloser
+	err       error
+}
+
+func (w *encryptWriter) start() error {
+	if w.stream == nil && w.err == nil {
+		w.stream, w.err = EncryptStream(w.encrypter, w.dst, w.options...)
+	}
+	return w.err
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	if err := w.start(); err != nil {
+		return 0, err
+	}
+	return w.stream.Write(p)
+}
+
+func (w *encryptWriter) Close() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+	return w.stream.Close()
+}
+
+type decryptReader struct {
+	src       io.Reader
+	decrypter Decrypt
+	stream    io.Reader
+	err       error
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	if r.stream == nil && r.err == nil {
+		r.stream, r.err = DecryptStream(r.decrypter, r.src)
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	return r.stream.Read(p)
+}
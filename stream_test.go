@@ -0,0 +1,275 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/nacl/box"
+)
+
+func loadBoxPair(t testing.TB) (Encrypt, Decrypt) {
+	require := require.New(t)
+
+	dir, err := os.Getwd()
+	require.Nil(err)
+	config := Config{
+		Type: Box,
+		Keys: map[KeyType]string{
+			SenderPrivateKey:    filepath.Join(dir, "sendBoxPrivate.pem"),
+			SenderPublicKey:     filepath.Join(dir, "sendBoxPublic.pem"),
+			RecipientPrivateKey: filepath.Join(dir, "boxPrivate.pem"),
+			RecipientPublicKey:  filepath.Join(dir, "boxPublic.pem"),
+		},
+	}
+	encrypter, err := config.LoadEncrypt()
+	require.Nil(err)
+	decrypter, err := config.LoadDecrypt()
+	require.Nil(err)
+	return encrypter, decrypter
+}
+
+func encryptStream(t *testing.T, encrypter Encrypt, message []byte) []byte {
+	require := require.New(t)
+
+	var buffer bytes.Buffer
+	writer, err := EncryptStream(encrypter, &buffer)
+	require.Nil(err)
+	// odd sized writes cross segment boundaries
+	for data := message; len(data) > 0; {
+		n := 1000
+		if n > len(data) {
+			n = len(data)
+		}
+		_, err = writer.Write(data[:n])
+		require.Nil(err)
+		data = data[n:]
+	}
+	require.Nil(writer.Close())
+	return buffer.Bytes()
+}
+
+func TestStream(t *testing.T) {
+	encrypter, decrypter := loadBoxPair(t)
+
+	testData := []struct {
+		description string
+		size        int
+	}{
+		{"empty", 0},
+		{"small", 1},
+		{"one segment", StreamSegmentSize},
+		{"one segment and a byte", StreamSegmentSize + 1},
+		{"several segments", 3*StreamSegmentSize + 5},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			message := make([]byte, tc.size)
+			_, err := rand.Read(message)
+			require.Nil(err)
+
+			stream := encryptStream(t, encrypter, message)
+			if tc.size > 16 {
+				assert.False(bytes.Contains(stream, message))
+			}
+
+			reader, err := DecryptStream(decrypter, bytes.NewReader(stream))
+			require.Nil(err)
+			result, err := ioutil.ReadAll(reader)
+			require.Nil(err)
+			assert.Equal(message, result)
+		})
+	}
+}
+
+func TestStreamRSA(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	privateKey := GeneratePrivateKey(2048)
+	encrypter, err := NewRSAEncrypt(&privateKey.PublicKey)
+	require.Nil(err)
+	decrypter, err := NewRSADecrypt(privateKey)
+	require.Nil(err)
+
+	stream := encryptStream(t, encrypter, []byte("hello"))
+	reader, err := DecryptStream(decrypter, bytes.NewReader(stream))
+	require.Nil(err)
+	result, err := ioutil.ReadAll(reader)
+	require.Nil(err)
+	assert.Equal([]byte("hello"), result)
+}
+
+func TestStreamTampered(t *testing.T) {
+	encrypter, decrypter := loadBoxPair(t)
+	message := bytes.Repeat([]byte("a"), 2*StreamSegmentSize+10)
+	stream := encryptStream(t, encrypter, message)
+
+	// the header is the magic, the wrapped key and the nonce
+	header := len(streamMagic) + 4 + 32 + box.Overhead + 4 + 24
+	segment := 4 + StreamSegmentSize + 16
+
+	testData := []struct {
+		description string
+		stream      []byte
+	}{
+		{"truncated in a segment", stream[:len(stream)-5]},
+		{"missing final segment", stream[:header+2*segment]},
+		{"missing middle segment", append(append([]byte{}, stream[:header+segment]...), stream[header+2*segment:]...)},
+		{"data after final segment", append(append([]byte{}, stream...), 0)},
+		{"final segment repeated", append(append([]byte{}, stream...), stream[header+2*segment:]...)},
+		{"flipped bit", func() []byte {
+			tampered := append([]byte{}, stream...)
+			tampered[header+10] ^= 1
+			return tampered
+		}()},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			reader, err := DecryptStream(decrypter, bytes.NewReader(tc.stream))
+			require.Nil(err)
+			_, err = ioutil.ReadAll(reader)
+			assert.NotNil(err)
+		})
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, _ := loadBoxPair(t)
+	stream := encryptStream(t, encrypter, []byte("hello"))
+
+	_, err := DecryptStream(DefaultCipherDecrypter(), bytes.NewReader([]byte("nope")))
+	assert.NotNil(err)
+
+	_, err = DecryptStream(DefaultCipherDecrypter(), bytes.NewReader(stream))
+	assert.NotNil(err, "the wrapped key should not be usable as is")
+
+	writer, err := EncryptStream(DefaultCipherEncrypter(), ioutil.Discard)
+	require.Nil(err)
+	require.Nil(writer.Close())
+	_, err = writer.Write([]byte("late"))
+	assert.Equal(errStreamClosed, err)
+
+	_, err = EncryptStream(DefaultCipherEncrypter(), failingWriter{})
+	assert.NotNil(err)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestEncryptWriterDecryptReader(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := loadBoxPair(t)
+	message := bytes.Repeat([]byte("compress me "), 20000)
+
+	// encrypt the output of gzip, and gunzip the output of decryption
+	var buffer bytes.Buffer
+	writer := NewEncryptWriter(&buffer, encrypter)
+	zipper := gzip.NewWriter(writer)
+	_, err := zipper.Write(message)
+	require.Nil(err)
+	require.Nil(zipper.Close())
+	require.Nil(writer.Close())
+	assert.True(buffer.Len() < len(message))
+
+	unzipper, err := gzip.NewReader(NewDecryptReader(&buffer, decrypter))
+	require.Nil(err)
+	result, err := ioutil.ReadAll(unzipper)
+	require.Nil(err)
+	assert.True(bytes.Equal(message, result))
+
+	// errors starting the stream surface on first use
+	writer = NewEncryptWriter(failingWriter{}, encrypter)
+	_, err = writer.Write([]byte("hello"))
+	assert.NotNil(err)
+	assert.NotNil(writer.Close())
+
+	_, err = NewDecryptReader(bytes.NewReader([]byte("nope")), decrypter).Read(make([]byte, 10))
+	assert.NotNil(err)
+}
+
+func TestStreamRandom(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, streamKeySize)
+
+	testData := []struct {
+		description string
+		encrypt     func(dst io.Writer, options ...CipherOption) (io.WriteCloser, error)
+	}{
+		{"stream", func(dst io.Writer, options ...CipherOption) (io.WriteCloser, error) {
+			return EncryptStream(DefaultCipherEncrypter(), dst, options...)
+		}},
+		{"parallel", func(dst io.Writer, options ...CipherOption) (io.WriteCloser, error) {
+			return EncryptStreamParallel(DefaultCipherEncrypter(), dst, 2, options...)
+		}},
+		{"writer", func(dst io.Writer, options ...CipherOption) (io.WriteCloser, error) {
+			writer := NewEncryptWriter(dst, DefaultCipherEncrypter(), options...)
+			_, err := writer.Write(nil)
+			return writer, err
+		}},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			// the none cipher leaves the data key as it is in the header
+			var buffer bytes.Buffer
+			writer, err := tc.encrypt(&buffer, WithRandom(bytes.NewReader(key)))
+			require.Nil(err)
+			_, err = writer.Write([]byte("hello"))
+			require.Nil(err)
+			require.Nil(writer.Close())
+			assert.True(bytes.Contains(buffer.Bytes(), key))
+
+			reader, err := DecryptStream(DefaultCipherDecrypter(), &buffer)
+			require.Nil(err)
+			message, err := ioutil.ReadAll(reader)
+			assert.Nil(err)
+			assert.Equal("hello", string(message))
+
+			_, err = tc.encrypt(ioutil.Discard, WithRandom(bytes.NewReader(nil)))
+			assert.NotNil(err)
+		})
+	}
+}
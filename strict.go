@@ -0,0 +1,91 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"strconv"
+	"sync/atomic"
+)
+
+// MinStrictRSABits is the smallest RSA key allowed in strict mode.
+const MinStrictRSABits = 2048
+
+var strictMode int32
+
+// SetStrictMode turns strict mode on or off for every cipher loaded after the
+// call.  In strict mode weak hashes like MD5 and SHA1 and RSA keys smaller
+// than MinStrictRSABits are refused.  Config.Strict turns it on for a single
+// config.
+func SetStrictMode(strict bool) {
+	var value int32
+	if strict {
+		value = 1
+	}
+	atomic.StoreInt32(&strictMode, value)
+}
+
+// StrictMode reports whether strict mode is on for the whole package.
+func StrictMode() bool {
+	return atomic.LoadInt32(&strictMode) == 1
+}
+
+// weakHashes are the hashes strict mode refuses.
+var weakHashes = map[crypto.Hash]bool{
+	crypto.MD4:     true,
+	crypto.MD5:     true,
+	crypto.SHA1:    true,
+	crypto.MD5SHA1: true,
+}
+
+func checkStrictHash(hash crypto.Hash) error {
+	if weakHashes[hash] {
+		return errors.New("hash " + hash.String() + " is not allowed in strict mode")
+	}
+	return nil
+}
+
+// checkRSAKeySizes fails if either key is smaller than MinStrictRSABits,
+// naming the mode that requires it.  Nil keys are ignored.
+func checkRSAKeySizes(mode string, privateKey *rsa.PrivateKey, publicKey *rsa.PublicKey) error {
+	keys := []*rsa.PublicKey{publicKey}
+	if privateKey != nil {
+		keys = append(keys, &privateKey.PublicKey)
+	}
+	for _, key := range keys {
+		if key == nil {
+			continue
+		}
+		if bits := key.N.BitLen(); bits < MinStrictRSABits {
+			return errors.New("rsa key of " + strconv.Itoa(bits) + " bits is not allowed in " + mode +
+				" mode, at least " + strconv.Itoa(MinStrictRSABits) + " bits are required")
+		}
+	}
+	return nil
+}
+
+// checkStrictRSA checks the hash and keys of an RSA cipher.  Nil keys are
+// ignored.
+func checkStrictRSA(hash crypto.Hash, privateKey *rsa.PrivateKey, publicKey *rsa.PublicKey) error {
+	if err := checkStrictHash(hash); err != nil {
+		return err
+	}
+	return checkRSAKeySizes("strict", privateKey, publicKey)
+}
@@ -0,0 +1,117 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrictConfig(t *testing.T) {
+	require := require.New(t)
+
+	dir, err := os.Getwd()
+	require.Nil(err)
+
+	smallKey := GeneratePrivateKey(1024)
+	smallPrivate := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(smallKey)})
+	smallPublic := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&smallKey.PublicKey)})
+
+	testData := []struct {
+		description string
+		hash        string
+		private     KeyLoader
+		public      KeyLoader
+		strict      bool
+		expectedErr bool
+	}{
+		{"md5 allowed", "MD5", nil, nil, false, false},
+		{"md5 refused", "MD5", nil, nil, true, true},
+		{"sha1 refused", "SHA1", nil, nil, true, true},
+		{"sha512 allowed", "SHA512", nil, nil, true, false},
+		{"small key allowed", "SHA512", &BytesLoader{Data: smallPrivate}, &BytesLoader{Data: smallPublic}, false, false},
+		{"small key refused", "SHA512", &BytesLoader{Data: smallPrivate}, &BytesLoader{Data: smallPublic}, true, true},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			config := Config{
+				Type:   RSASymmetric,
+				Strict: tc.strict,
+				Params: map[string]string{"hash": tc.hash},
+				Keys: map[KeyType]string{
+					PublicKey:  dir + string(os.PathSeparator) + "public.pem",
+					PrivateKey: dir + string(os.PathSeparator) + "private.pem",
+				},
+				Loaders: map[KeyType]KeyLoader{},
+			}
+			if tc.private != nil {
+				config.Loaders[PrivateKey] = tc.private
+				config.Loaders[PublicKey] = tc.public
+			}
+
+			_, encryptErr := config.LoadEncrypt()
+			_, decryptErr := config.LoadDecrypt()
+			if tc.expectedErr {
+				assert.NotNil(encryptErr)
+				assert.NotNil(decryptErr)
+				return
+			}
+			assert.Nil(encryptErr)
+			assert.Nil(decryptErr)
+		})
+	}
+}
+
+func TestStrictMode(t *testing.T) {
+	assert := assert.New(t)
+
+	SetStrictMode(true)
+	defer SetStrictMode(false)
+	assert.True(StrictMode())
+
+	smallKey := GeneratePrivateKey(1024)
+	_, err := NewRSAEncrypt(&smallKey.PublicKey)
+	assert.NotNil(err)
+	_, err = NewRSADecrypt(smallKey)
+	assert.NotNil(err)
+
+	key := GeneratePrivateKey(2048)
+	_, err = NewRSAEncrypt(&key.PublicKey, WithHash(crypto.SHA1))
+	assert.NotNil(err)
+	_, err = NewRSADecrypt(key)
+	assert.Nil(err)
+
+	assert.NotNil((&Config{Type: RSASymmetric, Params: map[string]string{"hash": "MD5"}, Keys: map[KeyType]string{
+		PublicKey: "public.pem",
+	}}).Validate())
+
+	SetStrictMode(false)
+	assert.False(StrictMode())
+	assert.Nil((&Config{Type: RSASymmetric, Params: map[string]string{"hash": "MD5"}, Keys: map[KeyType]string{
+		PublicKey: "public.pem",
+	}}).Validate())
+}
@@ -0,0 +1,101 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// TokenPrefix starts every token, so tokens can be told apart from the
+// values they replace.
+const TokenPrefix = "vct_"
+
+var errNotToken = errors.New("not a token")
+
+// Tokenize replaces a sensitive value, like a card number, with a token
+// that only the holders of the matching decrypter can turn back into the
+// value with Detokenize.  The token is TokenPrefix followed by a base64url
+// envelope, so it names the algorithm and KID it needs.  The field, the
+// algorithm and the KID are bound to the ciphertext as associated data, so a
+// token can't be relabelled or used in place of another field's; the
+// encrypter must support associated data, which rules out None.
+func Tokenize(encrypter Encrypt, field string, value []byte) (string, error) {
+	ad := tokenAD(field, encrypter.GetAlgorithm(), encrypter.GetKID())
+	e, err := SealEnvelopeWithAD(encrypter, value, ad)
+	if err != nil {
+		return "", err
+	}
+	encoded, err := e.Encode(Base64URL)
+	if err != nil {
+		return "", err
+	}
+	return TokenPrefix + encoded, nil
+}
+
+// Detokenize recovers the value of a token made by Tokenize for the same
+// field.
+func Detokenize(decrypter Decrypt, field string, token string) ([]byte, error) {
+	e, err := ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	return e.OpenWithAD(decrypter, tokenAD(field, e.Algorithm, e.KID))
+}
+
+// Detokenize recovers the value of a token with the decrypter routed to by
+// the token's algorithm and KID.
+func (r *Router) Detokenize(field string, token string) ([]byte, error) {
+	e, err := ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	decrypter, err := r.Route(e.Algorithm, e.KID)
+	if err != nil {
+		return nil, err
+	}
+	return e.OpenWithAD(decrypter, tokenAD(field, e.Algorithm, e.KID))
+}
+
+// IsToken reports whether the string looks like a token, without checking
+// that it can be detokenized.
+func IsToken(s string) bool {
+	_, err := ParseToken(s)
+	return err == nil
+}
+
+// ParseToken returns the envelope of a token, so its algorithm and KID can
+// be used to pick the decrypter.
+func ParseToken(token string) (*Envelope, error) {
+	if !strings.HasPrefix(token, TokenPrefix) {
+		return nil, errNotToken
+	}
+	return ParseEnvelope(token[len(TokenPrefix):], Base64URL)
+}
+
+// tokenAD is the associated data of a token.  Each part is length prefixed
+// so different fields, algorithms and KIDs never run together.
+func tokenAD(field string, alg AlgorithmType, kid string) []byte {
+	ad := []byte("voynicrypto-token")
+	for _, part := range []string{field, string(alg), kid} {
+		ad = binary.BigEndian.AppendUint32(ad, uint32(len(part)))
+		ad = append(ad, part...)
+	}
+	return ad
+}
@@ -0,0 +1,108 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenize(t *testing.T) {
+	boxEncrypter, boxDecrypter := loadBoxPair(t)
+	rsaEncrypter, rsaDecrypter := rsaPair(t)
+
+	testData := []struct {
+		description string
+		encrypter   Encrypt
+		decrypter   Decrypt
+	}{
+		{"box", boxEncrypter, boxDecrypter},
+		{"rsa", rsaEncrypter, rsaDecrypter},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			token, err := Tokenize(tc.encrypter, "card", []byte("4111111111111111"))
+			require.Nil(err)
+			assert.True(strings.HasPrefix(token, TokenPrefix))
+			assert.True(IsToken(token))
+			assert.NotContains(token, "4111111111111111")
+
+			value, err := Detokenize(tc.decrypter, "card", token)
+			require.Nil(err)
+			assert.Equal("4111111111111111", string(value))
+
+			// a token only works for its own field
+			_, err = Detokenize(tc.decrypter, "ssn", token)
+			assert.NotNil(err)
+
+			e, err := ParseToken(token)
+			require.Nil(err)
+			assert.Equal(tc.encrypter.GetAlgorithm(), e.Algorithm)
+			assert.Equal(tc.encrypter.GetKID(), e.KID)
+
+			router := NewRouter(nil)
+			require.Nil(router.Register(tc.decrypter))
+			value, err = router.Detokenize("card", token)
+			require.Nil(err)
+			assert.Equal("4111111111111111", string(value))
+		})
+	}
+}
+
+func TestTokenKIDBinding(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	key := make([]byte, 32)
+	encrypter, err := NewAESGCMEncrypt(key, WithKID("issuer"))
+	require.Nil(err)
+	token, err := Tokenize(encrypter, "card", []byte("4111111111111111"))
+	require.Nil(err)
+
+	// relabelling the token with another KID breaks it, even for a
+	// decrypter that ignores KIDs
+	e, err := ParseToken(token)
+	require.Nil(err)
+	e.KID = "other"
+	relabelled, err := e.Encode(Base64URL)
+	require.Nil(err)
+	decrypter, err := NewAESGCMDecrypt(key)
+	require.Nil(err)
+	_, err = Detokenize(decrypter, "card", TokenPrefix+relabelled)
+	assert.True(errors.Is(err, ErrDecryptFailed))
+
+	_, err = Detokenize(decrypter, "card", token)
+	assert.Nil(err)
+
+	// tokens must be encrypted
+	_, err = Tokenize(DefaultCipherEncrypter(), "card", []byte("4111111111111111"))
+	assert.NotNil(err)
+
+	assert.False(IsToken("4111111111111111"))
+	assert.False(IsToken(TokenPrefix + "!!!"))
+	_, err = Detokenize(decrypter, "card", "4111111111111111")
+	assert.NotNil(err)
+}
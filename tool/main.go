@@ -18,13 +18,12 @@
 package main
 
 import (
-	"crypto/rand"
-	"encoding/pem"
 	"fmt"
-	flag "github.com/spf13/pflag"
-	"golang.org/x/crypto/nacl/box"
 	"io/ioutil"
 	"os"
+
+	flag "github.com/spf13/pflag"
+	"github.com/xmidt-org/voynicrypto"
 )
 
 var (
@@ -40,25 +39,14 @@ func init() {
 func createBoxFiles(args []string) int {
 	flag.Parse()
 
-	publicKey, privateKey, err := box.GenerateKey(rand.Reader)
+	publicKey, privateKey, err := voynicrypto.GenerateBoxKeyPair()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to generate random key %s\n", err.Error())
 		return 1
 	}
 
-	privateData := pem.EncodeToMemory(
-		&pem.Block{
-			Type:  "BOX PRIVATE KEY",
-			Bytes: privateKey[:],
-		},
-	)
-
-	publicData := pem.EncodeToMemory(
-		&pem.Block{
-			Type:  "BOX PUBLIC KEY",
-			Bytes: publicKey[:],
-		},
-	)
+	privateData := voynicrypto.EncodeBoxPrivateKeyPEM(*privateKey)
+	publicData := voynicrypto.EncodeBoxPublicKeyPEM(*publicKey)
 
 	err = ioutil.WriteFile(privatePath, privateData, 0400)
 	if err != nil {
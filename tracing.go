@@ -0,0 +1,198 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the tracer TracedEncrypt and TracedDecrypt get
+// from the global TracerProvider when they aren't given one.
+const TracerName = "github.com/xmidt-org/voynicrypto"
+
+// The attributes of the spans of traced ciphers and loads.
+const (
+	AttributeAlgorithm   = attribute.Key("voynicrypto.algorithm")
+	AttributeKID         = attribute.Key("voynicrypto.kid")
+	AttributePayloadSize = attribute.Key("voynicrypto.payload_size")
+	AttributeReason      = attribute.Key("voynicrypto.reason")
+)
+
+// The names of the spans.
+const (
+	encryptSpan     = "voynicrypto.Encrypt"
+	decryptSpan     = "voynicrypto.Decrypt"
+	loadEncryptSpan = "voynicrypto.LoadEncrypt"
+	loadDecryptSpan = "voynicrypto.LoadDecrypt"
+)
+
+// startSpan starts a span labeled with the algorithm and KID.  With no
+// tracer the span does nothing.
+func startSpan(ctx context.Context, tracer trace.Tracer, name string, alg AlgorithmType, kid string) (context.Context, trace.Span) {
+	if tracer == nil {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	return tracer.Start(ctx, name, trace.WithAttributes(
+		AttributeAlgorithm.String(string(alg)),
+		AttributeKID.String(kid),
+	))
+}
+
+// endSpan ends the span, recording the error if there is one.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(AttributeReason.String(errorReason(err)))
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TracedEncrypt returns an Encrypt that wraps every message the encrypter
+// encrypts in an OpenTelemetry span.  EncryptMessageContext makes the span a
+// child of the span in the context and passes its context on to the
+// encrypter; the other methods start a new trace.  If tracer is nil the
+// global TracerProvider's TracerName tracer is used.
+func TracedEncrypt(encrypter Encrypt, tracer trace.Tracer) Encrypt {
+	if tracer == nil {
+		tracer = otel.Tracer(TracerName)
+	}
+	return &tracedEncrypter{encrypter: encrypter, tracer: tracer}
+}
+
+// TracedDecrypt returns a Decrypt that wraps every message the decrypter
+// decrypts in an OpenTelemetry span, like TracedEncrypt.
+func TracedDecrypt(decrypter Decrypt, tracer trace.Tracer) Decrypt {
+	if tracer == nil {
+		tracer = otel.Tracer(TracerName)
+	}
+	return &tracedDecrypter{decrypter: decrypter, tracer: tracer}
+}
+
+type tracedEncrypter struct {
+	encrypter Encrypt
+	tracer    trace.Tracer
+}
+
+func (e *tracedEncrypter) start(ctx context.Context, message []byte) (context.Context, trace.Span) {
+	ctx, span := startSpan(ctx, e.tracer, encryptSpan, e.encrypter.GetAlgorithm(), e.encrypter.GetKID())
+	span.SetAttributes(AttributePayloadSize.Int(len(message)))
+	return ctx, span
+}
+
+// GetAlgorithm returns the algorithm of the encrypter.
+func (e *tracedEncrypter) GetAlgorithm() AlgorithmType {
+	return e.encrypter.GetAlgorithm()
+}
+
+// GetKID returns the KID of the encrypter.
+func (e *tracedEncrypter) GetKID() string {
+	return e.encrypter.GetKID()
+}
+
+// EncryptMessage encrypts the message in a new trace.
+func (e *tracedEncrypter) EncryptMessage(message []byte) ([]byte, []byte, error) {
+	return e.EncryptMessageContext(context.Background(), message)
+}
+
+// EncryptMessageContext encrypts the message in a span of the context.
+func (e *tracedEncrypter) EncryptMessageContext(ctx context.Context, message []byte) ([]byte, []byte, error) {
+	ctx, span := e.start(ctx, message)
+	cipher, nonce, err := EncryptMessageContext(ctx, e.encrypter, message)
+	endSpan(span, err)
+	return cipher, nonce, err
+}
+
+// EncryptMessageWithAD encrypts the message with associated data in a new
+// trace.
+func (e *tracedEncrypter) EncryptMessageWithAD(message []byte, ad []byte) ([]byte, []byte, error) {
+	_, span := e.start(context.Background(), message)
+	cipher, nonce, err := EncryptMessageWithAD(e.encrypter, message, ad)
+	endSpan(span, err)
+	return cipher, nonce, err
+}
+
+// Metadata returns the metadata of the encrypter, if it has any.
+func (e *tracedEncrypter) Metadata() Metadata {
+	m, _ := GetMetadata(e.encrypter)
+	return m
+}
+
+// Close closes the encrypter.
+func (e *tracedEncrypter) Close() error {
+	return CloseCipher(e.encrypter)
+}
+
+type tracedDecrypter struct {
+	decrypter Decrypt
+	tracer    trace.Tracer
+}
+
+func (d *tracedDecrypter) start(ctx context.Context, cipher []byte) (context.Context, trace.Span) {
+	ctx, span := startSpan(ctx, d.tracer, decryptSpan, d.decrypter.GetAlgorithm(), d.decrypter.GetKID())
+	span.SetAttributes(AttributePayloadSize.Int(len(cipher)))
+	return ctx, span
+}
+
+// GetAlgorithm returns the algorithm of the decrypter.
+func (d *tracedDecrypter) GetAlgorithm() AlgorithmType {
+	return d.decrypter.GetAlgorithm()
+}
+
+// GetKID returns the KID of the decrypter.
+func (d *tracedDecrypter) GetKID() string {
+	return d.decrypter.GetKID()
+}
+
+// DecryptMessage decrypts the message in a new trace.
+func (d *tracedDecrypter) DecryptMessage(cipher []byte, nonce []byte) ([]byte, error) {
+	return d.DecryptMessageContext(context.Background(), cipher, nonce)
+}
+
+// DecryptMessageContext decrypts the message in a span of the context.
+func (d *tracedDecrypter) DecryptMessageContext(ctx context.Context, cipher []byte, nonce []byte) ([]byte, error) {
+	ctx, span := d.start(ctx, cipher)
+	message, err := DecryptMessageContext(ctx, d.decrypter, cipher, nonce)
+	endSpan(span, err)
+	return message, err
+}
+
+// DecryptMessageWithAD decrypts the message with associated data in a new
+// trace.
+func (d *tracedDecrypter) DecryptMessageWithAD(cipher []byte, nonce []byte, ad []byte) ([]byte, error) {
+	_, span := d.start(context.Background(), cipher)
+	message, err := DecryptMessageWithAD(d.decrypter, cipher, nonce, ad)
+	endSpan(span, err)
+	return message, err
+}
+
+// Metadata returns the metadata of the decrypter, if it has any.
+func (d *tracedDecrypter) Metadata() Metadata {
+	m, _ := GetMetadata(d.decrypter)
+	return m
+}
+
+// Close closes the decrypter.
+func (d *tracedDecrypter) Close() error {
+	return CloseCipher(d.decrypter)
+}
@@ -0,0 +1,168 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// testSpan records what is set on it.
+type testSpan struct {
+	trace.Span
+	name       string
+	parent     *testSpan
+	attributes map[attribute.Key]attribute.Value
+	status     codes.Code
+	err        error
+	ended      bool
+}
+
+func (s *testSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, a := range kv {
+		s.attributes[a.Key] = a.Value
+	}
+}
+
+func (s *testSpan) RecordError(err error, options ...trace.EventOption) {
+	s.err = err
+}
+
+func (s *testSpan) SetStatus(code codes.Code, description string) {
+	s.status = code
+}
+
+func (s *testSpan) End(options ...trace.SpanEndOption) {
+	s.ended = true
+}
+
+type testTracer struct {
+	trace.Tracer
+	lock  sync.Mutex
+	spans []*testSpan
+}
+
+type testSpanKey struct{}
+
+func (t *testTracer) Start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	parent, _ := ctx.Value(testSpanKey{}).(*testSpan)
+	span := &testSpan{
+		Span:       trace.SpanFromContext(context.Background()),
+		name:       name,
+		parent:     parent,
+		attributes: map[attribute.Key]attribute.Value{},
+	}
+	config := trace.NewSpanStartConfig(options...)
+	span.SetAttributes(config.Attributes()...)
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, testSpanKey{}, span), span
+}
+
+func (t *testTracer) last() *testSpan {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.spans[len(t.spans)-1]
+}
+
+func TestTraced(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tracer := new(testTracer)
+	key := make([]byte, 32)
+	aesEncrypter, err := NewAESGCMEncrypt(key, WithKID("k1"))
+	require.Nil(err)
+	aesDecrypter, err := NewAESGCMDecrypt(key, WithKID("k1"))
+	require.Nil(err)
+	encrypter := TracedEncrypt(aesEncrypter, tracer)
+	decrypter := TracedDecrypt(aesDecrypter, tracer)
+	assert.Equal(AESGCM, encrypter.GetAlgorithm())
+	assert.Equal("k1", decrypter.GetKID())
+
+	ctx, parent := tracer.Start(context.Background(), "request")
+	cipher, nonce, err := EncryptMessageContext(ctx, encrypter, []byte("message"))
+	require.Nil(err)
+	span := tracer.last()
+	assert.Equal(encryptSpan, span.name)
+	assert.Equal(parent, span.parent)
+	assert.True(span.ended)
+	assert.Equal(string(AESGCM), span.attributes[AttributeAlgorithm].AsString())
+	assert.Equal("k1", span.attributes[AttributeKID].AsString())
+	assert.Equal(int64(len("message")), span.attributes[AttributePayloadSize].AsInt64())
+	assert.Equal(codes.Unset, span.status)
+
+	_, err = decrypter.DecryptMessage(cipher, nonce)
+	require.Nil(err)
+	span = tracer.last()
+	assert.Equal(decryptSpan, span.name)
+	assert.Nil(span.parent)
+	assert.Equal(int64(len(cipher)), span.attributes[AttributePayloadSize].AsInt64())
+
+	_, err = DecryptMessageWithAD(decrypter, cipher, nonce, []byte("ad"))
+	assert.True(errors.Is(err, ErrDecryptFailed))
+	span = tracer.last()
+	assert.Equal(codes.Error, span.status)
+	assert.Equal(err, span.err)
+	assert.Equal(ReasonDecryptFailed, span.attributes[AttributeReason].AsString())
+
+	metadata, ok := GetMetadata(decrypter)
+	assert.True(ok)
+	assert.True(metadata.Authenticated)
+	require.Nil(CloseCipher(encrypter))
+	_, _, err = encrypter.EncryptMessage([]byte("message"))
+	assert.Equal(errCipherClosed, err)
+
+	// without a tracer the global, by default noop, one is used
+	_, _, err = TracedEncrypt(&NOOP{}, nil).EncryptMessage([]byte("message"))
+	assert.Nil(err)
+}
+
+func TestTracedLoad(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	tracer := new(testTracer)
+	ctx, parent := tracer.Start(context.Background(), "startup")
+
+	config := Config{Type: None, KID: "none", Tracer: tracer}
+	_, err := config.LoadEncryptContext(ctx)
+	require.Nil(err)
+	span := tracer.last()
+	assert.Equal(loadEncryptSpan, span.name)
+	assert.Equal(parent, span.parent)
+	assert.Equal(string(None), span.attributes[AttributeAlgorithm].AsString())
+	assert.Equal("none", span.attributes[AttributeKID].AsString())
+	assert.True(span.ended)
+
+	config = Config{Type: "rot13", Tracer: tracer}
+	_, err = config.LoadDecryptContext(ctx)
+	assert.NotNil(err)
+	span = tracer.last()
+	assert.Equal(loadDecryptSpan, span.name)
+	assert.Equal(codes.Error, span.status)
+}
@@ -0,0 +1,96 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// TransportEncoding is how an envelope is written as a string for HTTP
+// headers, query strings and other text transports.
+type TransportEncoding string
+
+const (
+	// Base64URL is unpadded URL safe base64, the same as MarshalText.
+	Base64URL TransportEncoding = "base64url"
+
+	// Hex is lowercase hex.
+	Hex TransportEncoding = "hex"
+)
+
+// Encode returns the marshalled envelope, including its algorithm, KID and
+// nonce, as a string in the encoding given.
+func (e *Envelope) Encode(encoding TransportEncoding) (string, error) {
+	data, err := e.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	switch encoding {
+	case Base64URL:
+		return base64.RawURLEncoding.EncodeToString(data), nil
+	case Hex:
+		return hex.EncodeToString(data), nil
+	}
+	return "", errors.New("unknown transport encoding " + string(encoding))
+}
+
+// ParseEnvelope decodes an envelope written by Encode.
+func ParseEnvelope(s string, encoding TransportEncoding) (*Envelope, error) {
+	var (
+		data []byte
+		err  error
+	)
+	switch encoding {
+	case Base64URL:
+		data, err = base64.RawURLEncoding.DecodeString(s)
+	case Hex:
+		data, err = hex.DecodeString(s)
+	default:
+		return nil, errors.New("unknown transport encoding " + string(encoding))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s envelope: %w", encoding, err)
+	}
+
+	var e Envelope
+	if err := e.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// EncryptToString seals the message in an envelope and encodes it.
+func EncryptToString(encrypter Encrypt, message []byte, encoding TransportEncoding, options ...SealOption) (string, error) {
+	e, err := SealEnvelope(encrypter, message, options...)
+	if err != nil {
+		return "", err
+	}
+	return e.Encode(encoding)
+}
+
+// DecryptString parses an envelope written by EncryptToString and opens it.
+func DecryptString(decrypter Decrypt, s string, encoding TransportEncoding) ([]byte, error) {
+	e, err := ParseEnvelope(s, encoding)
+	if err != nil {
+		return nil, err
+	}
+	return e.Open(decrypter)
+}
@@ -0,0 +1,67 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportEncoding(t *testing.T) {
+	encrypter, decrypter := loadBoxPair(t)
+
+	for _, encoding := range []TransportEncoding{Base64URL, Hex} {
+		t.Run(string(encoding), func(t *testing.T) {
+			assert := assert.New(t)
+			require := require.New(t)
+
+			s, err := EncryptToString(encrypter, []byte("hello"), encoding)
+			require.Nil(err)
+			assert.Equal(s, url.QueryEscape(s), "safe in a query string")
+
+			message, err := DecryptString(decrypter, s, encoding)
+			require.Nil(err)
+			assert.Equal([]byte("hello"), message)
+
+			e, err := ParseEnvelope(s, encoding)
+			require.Nil(err)
+			assert.Equal(Box, e.Algorithm)
+			assert.Equal(encrypter.GetKID(), e.KID)
+			assert.Len(e.Nonce, 24)
+
+			_, err = DecryptString(decrypter, s[:len(s)-2], encoding)
+			assert.NotNil(err)
+			_, err = ParseEnvelope("!"+s, encoding)
+			assert.NotNil(err)
+		})
+	}
+
+	s, err := EncryptToString(encrypter, []byte("hello"), Hex)
+	require.Nil(t, err)
+	_, err = DecryptString(decrypter, strings.ToUpper(s), Hex)
+	assert.Nil(t, err, "hex is case insensitive")
+
+	_, err = EncryptToString(encrypter, []byte("hello"), "base32")
+	assert.NotNil(t, err)
+	_, err = ParseEnvelope(s, "base32")
+	assert.NotNil(t, err)
+}
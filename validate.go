@@ -0,0 +1,209 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ValidationErrors is every problem found while validating configuration.
+type ValidationErrors []error
+
+// Error lists all of the problems.
+func (v ValidationErrors) Error() string {
+	messages := make([]string, len(v))
+	for i, err := range v {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap returns the individual problems so errors.Is and errors.As can find them.
+func (v ValidationErrors) Unwrap() []error {
+	return v
+}
+
+// algorithmKeys lists the keys each built in algorithm needs to encrypt and
+// to decrypt, or to sign and to verify.
+var algorithmKeys = map[AlgorithmType]struct {
+	encrypt []KeyType
+	decrypt []KeyType
+}{
+	None:          {},
+	Box:           {encrypt: []KeyType{SenderPrivateKey, RecipientPublicKey}, decrypt: []KeyType{RecipientPrivateKey, SenderPublicKey}},
+	BoxEphemeral:  {encrypt: []KeyType{RecipientPublicKey}, decrypt: []KeyType{RecipientPrivateKey}},
+	RSASymmetric:  {encrypt: []KeyType{PublicKey}, decrypt: []KeyType{PrivateKey}},
+	RSAAsymmetric: {encrypt: []KeyType{SenderPrivateKey, RecipientPublicKey}, decrypt: []KeyType{RecipientPrivateKey, SenderPublicKey}},
+	Ed25519Sign:   {encrypt: []KeyType{PrivateKey}, decrypt: []KeyType{PublicKey}},
+	RSAPSS:        {encrypt: []KeyType{PrivateKey}, decrypt: []KeyType{PublicKey}},
+	ECDSA:         {encrypt: []KeyType{PrivateKey}, decrypt: []KeyType{PublicKey}},
+}
+
+// Validate checks that the config is consistent before anything is loaded:
+// the algorithm is known, the keys it needs to either encrypt or decrypt are
+// present, no keys meant for another algorithm are configured, and the
+// params are valid.  Fallbacks are checked the same way.  All of the
+// problems found are returned as ValidationErrors.
+func (config *Config) Validate() error {
+	problems := config.validate()
+	for i := range config.Fallbacks {
+		for _, problem := range config.Fallbacks[i].validate() {
+			problems = append(problems, fmt.Errorf("fallback[%d]: %w", i, problem))
+		}
+	}
+	return problems.orNil()
+}
+
+func (config *Config) validate() ValidationErrors {
+	var problems ValidationErrors
+
+	if config.Type == "" {
+		return append(problems, errors.New("no algorithm type specified"))
+	}
+
+	if err := checkFIPSAlgorithm(config.Type); err != nil {
+		problems = append(problems, err)
+	}
+
+	switch config.DeriveKID {
+	case "", JWKThumbprintKID, SPKIThumbprintKID:
+	default:
+		problems = append(problems, fmt.Errorf("unknown kid derivation %s", config.DeriveKID))
+	}
+
+	keys, builtin := algorithmKeys[config.Type]
+	if !builtin {
+		// custom algorithms validate their own keys when they are loaded
+		if _, err := getEncrypterFactory(config.Type); err != nil {
+			if _, err := getDecrypterFactory(config.Type); err != nil {
+				problems = append(problems, fmt.Errorf("algorithm type %s not registered", config.Type))
+			}
+		}
+		return problems
+	}
+
+	allowed := map[KeyType]bool{}
+	for _, keyType := range append(append([]KeyType{}, keys.encrypt...), keys.decrypt...) {
+		allowed[keyType] = true
+	}
+	for keyType, path := range config.Keys {
+		if !allowed[keyType] {
+			problems = append(problems, fmt.Errorf("key %s is not used by algorithm %s", keyType, config.Type))
+			continue
+		}
+		if path == "" && config.Loaders[keyType] == nil {
+			problems = append(problems, fmt.Errorf("key %s has no path", keyType))
+		}
+	}
+	for keyType := range config.Loaders {
+		if !allowed[keyType] {
+			problems = append(problems, fmt.Errorf("key loader %s is not used by algorithm %s", keyType, config.Type))
+		}
+	}
+
+	if len(keys.encrypt) > 0 {
+		missingEncrypt := config.missingKeys(keys.encrypt)
+		missingDecrypt := config.missingKeys(keys.decrypt)
+		if len(missingEncrypt) > 0 && len(missingDecrypt) > 0 {
+			encrypt, decrypt := "encrypt", "decrypt"
+			if isSigningAlgorithm(config.Type) {
+				encrypt, decrypt = "sign", "verify"
+			}
+			problems = append(problems, fmt.Errorf("algorithm %s needs keys %s to %s or %s to %s",
+				config.Type, joinKeyTypes(missingEncrypt), encrypt, joinKeyTypes(missingDecrypt), decrypt))
+		}
+	}
+
+	if config.Type == RSASymmetric || config.Type == RSAAsymmetric {
+		hash, err := (&BasicHashLoader{HashName: config.Params["hash"]}).GetHash()
+		if err == nil && (config.Strict || StrictMode()) {
+			err = checkStrictHash(hash)
+		}
+		if err == nil {
+			err = checkFIPSRSA(hash, nil, nil)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Errorf("invalid hash param: %s", err))
+		}
+		if _, err := config.hybridParam(); err != nil {
+			problems = append(problems, err)
+		}
+		if _, err := config.encryptThenSignParam(); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	switch config.Type {
+	case RSAPSS:
+		if _, err := config.signHash(); err != nil {
+			problems = append(problems, fmt.Errorf("invalid hash param: %s", err))
+		}
+	case ECDSA:
+		if _, _, err := config.ecdsaParams(); err != nil {
+			problems = append(problems, fmt.Errorf("invalid params: %s", err))
+		}
+	}
+
+	return problems
+}
+
+func (v ValidationErrors) orNil() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
+
+func (config *Config) missingKeys(keyTypes []KeyType) []KeyType {
+	var missing []KeyType
+	for _, keyType := range keyTypes {
+		if !config.hasKey(keyType) {
+			missing = append(missing, keyType)
+		}
+	}
+	return missing
+}
+
+func joinKeyTypes(keyTypes []KeyType) string {
+	names := make([]string, len(keyTypes))
+	for i, keyType := range keyTypes {
+		names[i] = string(keyType)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Validate validates every config, prefixing each problem with the index of
+// the config it belongs to.
+func (o Options) Validate() error {
+	var problems ValidationErrors
+	for i := range o {
+		if err := o[i].Validate(); err != nil {
+			var configProblems ValidationErrors
+			if errors.As(err, &configProblems) {
+				for _, problem := range configProblems {
+					problems = append(problems, fmt.Errorf("cipher[%d]: %w", i, problem))
+				}
+				continue
+			}
+			problems = append(problems, fmt.Errorf("cipher[%d]: %w", i, err))
+		}
+	}
+	return problems.orNil()
+}
@@ -0,0 +1,100 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigValidate(t *testing.T) {
+	testData := []struct {
+		description string
+		config      Config
+		problems    int
+	}{
+		{"none", Config{Type: None}, 0},
+		{"no type", Config{}, 1},
+		{"unknown type", Config{Type: "rot13"}, 1},
+		{"box encrypt only", Config{Type: Box, Keys: map[KeyType]string{
+			SenderPrivateKey:   "sender.pem",
+			RecipientPublicKey: "recipient.pem",
+		}}, 0},
+		{"box missing keys", Config{Type: Box, Keys: map[KeyType]string{
+			SenderPrivateKey: "sender.pem",
+		}}, 1},
+		{"box with rsa key", Config{Type: Box, Keys: map[KeyType]string{
+			RecipientPrivateKey: "recipient.pem",
+			SenderPublicKey:     "sender.pem",
+			PublicKey:           "public.pem",
+		}}, 1},
+		{"rsa decrypt only", Config{Type: RSASymmetric, Params: map[string]string{"hash": "SHA512"}, Keys: map[KeyType]string{
+			PrivateKey: "private.pem",
+		}}, 0},
+		{"rsa loader instead of path", Config{Type: RSASymmetric, Params: map[string]string{"hash": "SHA512"},
+			Loaders: map[KeyType]KeyLoader{PublicKey: &BytesLoader{}},
+		}, 0},
+		{"rsa everything wrong", Config{Type: RSASymmetric, Params: map[string]string{"hash": "SHA3"}, Keys: map[KeyType]string{
+			PrivateKey:       "",
+			SenderPrivateKey: "sender.pem",
+		}}, 3},
+		{"rsa no hash", Config{Type: RSAAsymmetric, Keys: map[KeyType]string{
+			SenderPrivateKey:   "sender.pem",
+			RecipientPublicKey: "recipient.pem",
+		}}, 1},
+		{"custom algorithm", Config{Type: "test-validate"}, 0},
+	}
+
+	RegisterEncrypterLoader("test-validate", func(ctx context.Context, config *Config) (Encrypt, error) {
+		return &reverser{kid: config.KID}, nil
+	})
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			assert := assert.New(t)
+
+			err := tc.config.Validate()
+			if tc.problems == 0 {
+				assert.Nil(err)
+				return
+			}
+
+			var problems ValidationErrors
+			if assert.True(errors.As(err, &problems)) {
+				assert.Len(problems, tc.problems, err.Error())
+			}
+		})
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(Options{{Type: None}}.Validate())
+
+	err := Options{{Type: None}, {}, {Type: Box}}.Validate()
+	var problems ValidationErrors
+	if assert.True(errors.As(err, &problems)) {
+		assert.Len(problems, 2)
+		assert.Contains(problems[0].Error(), "cipher[1]")
+		assert.Contains(problems[1].Error(), "cipher[2]")
+	}
+}
@@ -1,8 +1,10 @@
 package voynicrypto
 
 import (
-	"github.com/go-kit/kit/log"
-	"github.com/goph/emperror"
+	"context"
+	"errors"
+	"fmt"
+
 	"github.com/spf13/viper"
 )
 
@@ -28,7 +30,7 @@ type Ciphers struct {
 }
 
 // GetEncrypter takes options and creates an encrypter out of it.
-func (o Options) GetEncrypter(logger log.Logger) (Encrypt, error) {
+func (o Options) GetEncrypter(logger Logger) (Encrypt, error) {
 	var lastErr error
 	for _, elem := range o {
 		if encrypter, err := elem.LoadEncrypt(); err == nil {
@@ -37,27 +39,90 @@ func (o Options) GetEncrypter(logger log.Logger) (Encrypt, error) {
 			lastErr = err
 		}
 	}
-	return DefaultCipherEncrypter(), emperror.Wrap(lastErr, "failed to load encrypt options")
+	if lastErr == nil {
+		return DefaultCipherEncrypter(), nil
+	}
+	return DefaultCipherEncrypter(), fmt.Errorf("failed to load encrypt options: %w", lastErr)
 }
 
 // PopulateCiphers takes options and a logger and creates ciphers from them.
-func PopulateCiphers(o Options, logger log.Logger) Ciphers {
+// Configs that fail to load are logged and skipped; use Options.LoadCiphers
+// to get the errors instead.  When configs repeat an algorithm and KID, the
+// last one loaded is kept.
+func PopulateCiphers(o Options, logger Logger) Ciphers {
+	c, err := o.loadCiphers(context.Background(), logger, true)
+	if err != nil && logger != nil {
+		logError(logger, "failed to load some ciphers", ErrorKey, err)
+	}
+	return c
+}
+
+// LoadCiphers loads the decrypter of every config, keyed by algorithm and
+// KID, so messages encrypted with any of the keys can be decrypted.  Configs
+// that fail to load, or repeat an algorithm and KID already loaded, are left
+// out and reported in the returned error along with their index.
+func (o Options) LoadCiphers() (Ciphers, error) {
+	return o.LoadCiphersContext(context.Background())
+}
+
+// LoadCiphersContext is LoadCiphers, passing the context to the key loaders.
+func (o Options) LoadCiphersContext(ctx context.Context) (Ciphers, error) {
+	return o.loadCiphers(ctx, nil, false)
+}
+
+// loadCiphers loads the decrypter of every config.  A config repeating an
+// algorithm and KID replaces the earlier one if lastWins is set, and is an
+// error otherwise.
+func (o Options) loadCiphers(ctx context.Context, logger Logger, lastWins bool) (Ciphers, error) {
 	c := Ciphers{
 		Options: map[AlgorithmType]map[string]Decrypt{},
 	}
-	for _, elem := range o {
-		elem.Logger = logger
-		if decrypter, err := elem.LoadDecrypt(); err == nil {
-			if _, ok := c.Options[elem.Type]; !ok {
-				c.Options[elem.Type] = map[string]Decrypt{}
-			}
-			c.Options[elem.Type][elem.KID] = decrypter
+	var errs []error
+	for i, elem := range o {
+		if logger != nil {
+			elem.Logger = logger
+		}
+		decrypter, err := elem.LoadDecryptContext(ctx)
+		if err == nil && lastWins {
+			c.set(elem.Type, elem.KID, decrypter)
+		} else if err == nil {
+			err = c.Add(elem.Type, elem.KID, decrypter)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cipher[%d] %s/%s: %w", i, elem.Type, elem.KID, err))
 		}
 	}
-	return c
+	return c, errors.Join(errs...)
+}
+
+// Add adds a decrypter for an algorithm and KID.  Each algorithm and KID
+// pair can only be added once.
+func (c *Ciphers) Add(alg AlgorithmType, KID string, decrypter Decrypt) error {
+	if decrypter == nil {
+		return errors.New("no decrypter")
+	}
+	if _, ok := c.Options[alg][KID]; ok {
+		return errors.New("decrypter already added")
+	}
+	c.set(alg, KID, decrypter)
+	return nil
 }
 
-// Get returns a decrypter given an algorithm and KID.
+// set adds the decrypter, replacing any already added for the algorithm and
+// KID.
+func (c *Ciphers) set(alg AlgorithmType, KID string, decrypter Decrypt) {
+	if c.Options == nil {
+		c.Options = map[AlgorithmType]map[string]Decrypt{}
+	}
+	if _, ok := c.Options[alg]; !ok {
+		c.Options[alg] = map[string]Decrypt{}
+	}
+	c.Options[alg][KID] = decrypter
+}
+
+// Get returns a decrypter given an algorithm and KID.  The lookup is an
+// ordinary map lookup and isn't constant time; only secrets and MACs are
+// compared in constant time.
 func (c *Ciphers) Get(alg AlgorithmType, KID string) (Decrypt, bool) {
 	if d, ok := c.Options[alg][KID]; ok {
 		return d, ok
@@ -65,9 +130,53 @@ func (c *Ciphers) Get(alg AlgorithmType, KID string) (Decrypt, bool) {
 	return nil, false
 }
 
+// Len returns the number of decrypters.
+func (c *Ciphers) Len() int {
+	var n int
+	for _, kids := range c.Options {
+		n += len(kids)
+	}
+	return n
+}
+
+// DecryptMessage decrypts a message with the decrypter for the algorithm and
+// KID it was encrypted with.
+func (c *Ciphers) DecryptMessage(alg AlgorithmType, KID string, cipher []byte, nonce []byte) ([]byte, error) {
+	decrypter, ok := c.Get(alg, KID)
+	if !ok {
+		return nil, keyNotFound("no decrypter for algorithm %s and kid %s", alg, KID)
+	}
+	return decrypter.DecryptMessage(cipher, nonce)
+}
+
 // FromViper produces an Options from a (possibly nil) Viper instance.
 // cipher key is expected
 func FromViper(v *viper.Viper) (o Options, err error) {
 	err = v.UnmarshalKey(CipherKey, &o)
+	for i := range o {
+		o[i].normalize()
+	}
 	return
 }
+
+// normalize fixes up the algorithm and key types, which viper decodes without
+// calling UnmarshalText and may have lowercased.
+func (config *Config) normalize() {
+	config.Type = canonicalAlgorithmType(string(config.Type))
+	if len(config.Keys) > 0 {
+		keys := make(map[KeyType]string, len(config.Keys))
+		for keyType, path := range config.Keys {
+			keyType, _ = ParseKeyType(string(keyType))
+			keys[keyType] = path
+		}
+		config.Keys = keys
+	}
+	if len(config.Passphrases) > 0 {
+		passphrases := make(map[KeyType]PassphraseSource, len(config.Passphrases))
+		for keyType, source := range config.Passphrases {
+			keyType, _ = ParseKeyType(string(keyType))
+			passphrases[keyType] = source
+		}
+		config.Passphrases = passphrases
+	}
+}
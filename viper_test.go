@@ -1,14 +1,15 @@
 package voynicrypto
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"github.com/xmidt-org/webpa-common/logging"
 )
 
 func TestViper(t *testing.T) {
@@ -27,7 +28,7 @@ func TestViper(t *testing.T) {
 	options, err := FromViper(v)
 	assert.Nil(err)
 
-	encrypter, err := options.GetEncrypter(logging.NewTestLogger(nil, t))
+	encrypter, err := options.GetEncrypter(newTestLogger(t))
 	assert.Nil(err)
 	assert.NotNil(encrypter)
 
@@ -54,7 +55,7 @@ func TestNOOPViper(t *testing.T) {
 	options, err := FromViper(v)
 	require.Nil(err)
 
-	encrypter, err := options.GetEncrypter(logging.NewTestLogger(nil, t))
+	encrypter, err := options.GetEncrypter(newTestLogger(t))
 	require.Nil(err)
 	require.NotNil(encrypter)
 
@@ -79,7 +80,7 @@ func TestBoxBothSides(t *testing.T) {
 	options, err := FromViper(vSend)
 	assert.Nil(err)
 
-	encrypter, err := options.GetEncrypter(logging.NewTestLogger(nil, t))
+	encrypter, err := options.GetEncrypter(newTestLogger(t))
 	assert.Nil(err)
 
 	vRec := viper.New()
@@ -93,7 +94,7 @@ func TestBoxBothSides(t *testing.T) {
 	options, err = FromViper(vRec)
 	assert.Nil(err)
 
-	decrypters := PopulateCiphers(options, logging.NewTestLogger(nil, t))
+	decrypters := PopulateCiphers(options, newTestLogger(t))
 
 	assert.Nil(err)
 
@@ -126,7 +127,7 @@ func TestGetDecrypterErr(t *testing.T) {
 	options, err := FromViper(vSend)
 	assert.Nil(err)
 
-	decrypters := PopulateCiphers(options, logging.NewTestLogger(nil, t))
+	decrypters := PopulateCiphers(options, newTestLogger(t))
 	fmt.Printf("%#v\n", decrypters)
 
 	decrypter, ok := decrypters.Get(Box, "test")
@@ -146,3 +147,161 @@ func TestGetDecrypterErr(t *testing.T) {
 	assert.False(ok)
 	assert.Nil(decrypter)
 }
+
+func TestFromViperTolerant(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	require.Nil(v.ReadConfig(strings.NewReader(`
+cipher:
+- type: RSA-Sym
+  kid: upper
+  params:
+    hash: SHA512
+  keys:
+    PublicKey: public.pem
+    private_key: private.pem
+- type: BOX
+  kid: box
+  keys:
+    senderPrivateKey: sendBoxPrivate.pem
+    RECIPIENTPUBLICKEY: boxPublic.pem
+`)))
+
+	options, err := FromViper(v)
+	require.Nil(err)
+	require.Len(options, 2)
+
+	assert.Equal(RSASymmetric, options[0].Type)
+	assert.Equal(map[KeyType]string{PublicKey: "public.pem", PrivateKey: "private.pem"}, options[0].Keys)
+	assert.Equal(Box, options[1].Type)
+	assert.Equal(map[KeyType]string{SenderPrivateKey: "sendBoxPrivate.pem", RecipientPublicKey: "boxPublic.pem"}, options[1].Keys)
+	assert.Nil(options.Validate())
+}
+
+func TestConfigText(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var config Config
+	require.Nil(json.Unmarshal([]byte(`{"type": "Rsa-Asy", "keys": {"SenderPrivateKey": "a.pem", "recipient-public-key": "b.pem", "custom": "c.pem"}}`), &config))
+	assert.Equal(RSAAsymmetric, config.Type)
+	assert.Equal(map[KeyType]string{SenderPrivateKey: "a.pem", RecipientPublicKey: "b.pem", KeyType("custom"): "c.pem"}, config.Keys)
+
+	data, err := json.Marshal(Config{Type: Box, Keys: map[KeyType]string{SenderPublicKey: "a.pem"}})
+	require.Nil(err)
+	assert.Contains(string(data), `"type":"box"`)
+	assert.Contains(string(data), `"senderPublicKey":"a.pem"`)
+
+	assert.Equal(RSAAsymmetric, ParseAlgorithmType(" RSA_ASY "))
+	assert.Equal(None, ParseAlgorithmType("unknown"))
+
+	keyType, ok := ParseKeyType("Recipient_Private_Key")
+	assert.True(ok)
+	assert.Equal(RecipientPrivateKey, keyType)
+
+	_, ok = ParseKeyType("nope")
+	assert.False(ok)
+}
+
+func TestLoadCiphers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := os.Getwd()
+	require.Nil(err)
+
+	options := Options{
+		{Type: None, KID: "none"},
+		{Type: RSASymmetric, KID: "old", Params: map[string]string{"hash": "SHA512"}, Keys: map[KeyType]string{
+			PrivateKey: dir + string(os.PathSeparator) + "private.pem",
+		}},
+		{Type: Box, KID: "new", Keys: map[KeyType]string{
+			RecipientPrivateKey: dir + string(os.PathSeparator) + "boxPrivate.pem",
+			SenderPublicKey:     dir + string(os.PathSeparator) + "sendBoxPublic.pem",
+		}},
+		{Type: Box, KID: "missing", Keys: map[KeyType]string{
+			RecipientPrivateKey: dir + string(os.PathSeparator) + "missing.pem",
+			SenderPublicKey:     dir + string(os.PathSeparator) + "sendBoxPublic.pem",
+		}},
+		{Type: None, KID: "none"},
+	}
+
+	ciphers, err := options.LoadCiphers()
+	require.NotNil(err)
+	assert.Contains(err.Error(), "cipher[3] box/missing")
+	assert.Contains(err.Error(), "cipher[4] none/none")
+	assert.Equal(3, ciphers.Len())
+
+	encrypter, err := (&Config{Type: Box, KID: "new", Keys: map[KeyType]string{
+		SenderPrivateKey:   dir + string(os.PathSeparator) + "sendBoxPrivate.pem",
+		RecipientPublicKey: dir + string(os.PathSeparator) + "boxPublic.pem",
+	}}).LoadEncrypt()
+	require.Nil(err)
+
+	msg := []byte("hello")
+	data, nonce, err := encrypter.EncryptMessage(msg)
+	require.Nil(err)
+
+	decoded, err := ciphers.DecryptMessage(encrypter.GetAlgorithm(), encrypter.GetKID(), data, nonce)
+	assert.Nil(err)
+	assert.Equal(msg, decoded)
+
+	_, err = ciphers.DecryptMessage(Box, "missing", data, nonce)
+	assert.NotNil(err)
+
+	_, ok := ciphers.Get(RSASymmetric, "old")
+	assert.True(ok)
+
+	var empty Ciphers
+	assert.Nil(empty.Add(None, "none", DefaultCipherDecrypter()))
+	assert.NotNil(empty.Add(None, "none", DefaultCipherDecrypter()))
+	assert.NotNil(empty.Add(Box, "nil", nil))
+	assert.Equal(1, empty.Len())
+}
+
+func TestPopulateCiphersLastWins(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := os.Getwd()
+	require.Nil(err)
+	key := func(name string) string {
+		return dir + string(os.PathSeparator) + name
+	}
+
+	options := Options{
+		{Type: Box, KID: "dup", Keys: map[KeyType]string{
+			RecipientPrivateKey: key("sendBoxPrivate.pem"),
+			SenderPublicKey:     key("sendBoxPublic.pem"),
+		}},
+		{Type: Box, KID: "dup", Keys: map[KeyType]string{
+			RecipientPrivateKey: key("boxPrivate.pem"),
+			SenderPublicKey:     key("sendBoxPublic.pem"),
+		}},
+	}
+
+	encrypter, err := (&Config{Type: Box, KID: "dup", Keys: map[KeyType]string{
+		SenderPrivateKey:   key("sendBoxPrivate.pem"),
+		RecipientPublicKey: key("boxPublic.pem"),
+	}}).LoadEncrypt()
+	require.Nil(err)
+	data, nonce, err := encrypter.EncryptMessage([]byte("hello"))
+	require.Nil(err)
+
+	// the last config is kept, as it always has been
+	ciphers := PopulateCiphers(options, newTestLogger(t))
+	assert.Equal(1, ciphers.Len())
+	decoded, err := ciphers.DecryptMessage(Box, "dup", data, nonce)
+	assert.Nil(err)
+	assert.Equal("hello", string(decoded))
+
+	// while LoadCiphers keeps the first and reports the second
+	ciphers, err = options.LoadCiphers()
+	assert.NotNil(err)
+	assert.Equal(1, ciphers.Len())
+	_, err = ciphers.DecryptMessage(Box, "dup", data, nonce)
+	assert.NotNil(err)
+}
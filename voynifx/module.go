@@ -0,0 +1,66 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package voynifx wires the voynicrypto providers into an uber fx graph.  It
+// is kept apart from voynicrypto so that services not using fx don't depend
+// on it.
+//
+// A service reading its cipher configs from viper supplies the
+// *viper.Viper and uses Module:
+//
+//	fx.New(
+//		fx.Supply(v), // the *viper.Viper holding the cipher key
+//		voynifx.Module,
+//		fx.Invoke(func(encrypter voynicrypto.Encrypt, router *voynicrypto.Router) {}),
+//	)
+//
+// A service with a single voynicrypto.Config supplies it and uses
+// ConfigModule instead:
+//
+//	fx.New(
+//		fx.Supply(config),
+//		voynifx.ConfigModule,
+//		fx.Invoke(func(encrypter voynicrypto.Encrypt, decrypter voynicrypto.Decrypt) {}),
+//	)
+package voynifx
+
+import (
+	"github.com/xmidt-org/voynicrypto"
+	"go.uber.org/fx"
+)
+
+// Module provides the voynicrypto.Options read from the *viper.Viper in the
+// graph, the voynicrypto.Encrypt of the first of them that loads, the
+// *voynicrypto.Ciphers of all of them and a *voynicrypto.Router routing to
+// those ciphers.
+var Module = fx.Module("voynicrypto",
+	fx.Provide(
+		voynicrypto.ProvideOptions,
+		voynicrypto.ProvideOptionsEncrypt,
+		voynicrypto.ProvideCiphers,
+		voynicrypto.ProvideRouter,
+	),
+)
+
+// ConfigModule provides the voynicrypto.Encrypt and voynicrypto.Decrypt of
+// the voynicrypto.Config in the graph.
+var ConfigModule = fx.Module("voynicrypto-config",
+	fx.Provide(
+		voynicrypto.ProvideEncrypt,
+		voynicrypto.ProvideDecrypt,
+	),
+)
@@ -0,0 +1,92 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynifx
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/voynicrypto"
+	"go.uber.org/fx"
+)
+
+func TestModule(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	v := viper.New()
+	v.Set("cipher", []map[string]interface{}{
+		{
+			"type": "box",
+			"kid":  "test",
+			"keys": map[string]string{
+				"senderPublicKey":     "../sendBoxPublic.pem",
+				"recipientPrivateKey": "../boxPrivate.pem",
+			},
+		},
+		{"type": "none", "kid": "none"},
+	})
+
+	var (
+		encrypter voynicrypto.Encrypt
+		ciphers   *voynicrypto.Ciphers
+		router    *voynicrypto.Router
+	)
+	app := fx.New(
+		fx.NopLogger,
+		fx.Supply(v),
+		Module,
+		fx.Populate(&encrypter, &ciphers, &router),
+	)
+	require.Nil(app.Err())
+	assert.NotNil(encrypter)
+	_, ok := ciphers.Get(voynicrypto.Box, "test")
+	assert.True(ok)
+	_, err := router.Route(voynicrypto.Box, "test")
+	assert.Nil(err)
+}
+
+func TestConfigModule(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var (
+		encrypter voynicrypto.Encrypt
+		decrypter voynicrypto.Decrypt
+	)
+	app := fx.New(
+		fx.NopLogger,
+		fx.Supply(voynicrypto.Config{Type: voynicrypto.None}),
+		ConfigModule,
+		fx.Populate(&encrypter, &decrypter),
+	)
+	require.Nil(app.Err())
+	assert.Equal(voynicrypto.None, encrypter.GetAlgorithm())
+	assert.Equal(voynicrypto.None, decrypter.GetAlgorithm())
+
+	// a bad config stops the app from starting
+	app = fx.New(
+		fx.NopLogger,
+		fx.Supply(voynicrypto.Config{Type: voynicrypto.Box}),
+		ConfigModule,
+		fx.Populate(&encrypter),
+	)
+	assert.NotNil(app.Err())
+}
@@ -0,0 +1,263 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package voynigrpc provides gRPC interceptors that encrypt chosen bytes
+// fields of the messages of a call, so the payload stays encrypted end to end
+// through proxies and load balancers that terminate TLS.
+//
+// Each encrypted field holds a marshalled voynicrypto.Envelope, so it carries
+// its own algorithm, KID and nonce and every message can be decrypted on its
+// own.  The algorithm and KID of the sender are also sent as gRPC metadata.
+package voynigrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/xmidt-org/voynicrypto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// The metadata keys that carry the algorithm and KID of the sender.
+const (
+	MetadataAlgorithm = "x-voynicrypto-algorithm"
+	MetadataKID       = "x-voynicrypto-kid"
+)
+
+// Options configures the interceptors.
+type Options struct {
+	// Encrypter encrypts the fields of outgoing messages: requests on the
+	// client and responses on the server.  If not supplied, they are sent
+	// as they are.
+	Encrypter voynicrypto.Encrypt
+
+	// Router finds the decrypter of the fields of incoming messages.  If not
+	// supplied, they are left as they are.
+	Router *voynicrypto.Router
+
+	// Fields are the names of the bytes fields to encrypt.  Messages without
+	// a field of that name are left alone, so one list can cover every
+	// method of a service.  Empty fields aren't encrypted.
+	Fields []string
+}
+
+var errNotProto = errors.New("message is not a protobuf message")
+
+// encrypt returns a copy of the message with its fields encrypted, leaving
+// the caller's message alone.
+func (o Options) encrypt(m interface{}) (interface{}, error) {
+	if o.Encrypter == nil || len(o.Fields) == 0 {
+		return m, nil
+	}
+	message, ok := m.(proto.Message)
+	if !ok {
+		return nil, errNotProto
+	}
+	message = proto.Clone(message)
+	err := o.eachField(message, func(r protoreflect.Message, fd protoreflect.FieldDescriptor, value []byte) error {
+		e, err := voynicrypto.SealEnvelope(o.Encrypter, value)
+		if err != nil {
+			return err
+		}
+		data, err := e.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		r.Set(fd, protoreflect.ValueOfBytes(data))
+		return nil
+	})
+	return message, err
+}
+
+// decrypt decrypts the fields of the message in place.
+func (o Options) decrypt(m interface{}) error {
+	if o.Router == nil || len(o.Fields) == 0 {
+		return nil
+	}
+	message, ok := m.(proto.Message)
+	if !ok {
+		return errNotProto
+	}
+	return o.eachField(message, func(r protoreflect.Message, fd protoreflect.FieldDescriptor, value []byte) error {
+		var e voynicrypto.Envelope
+		if err := e.UnmarshalBinary(value); err != nil {
+			return fmt.Errorf("field %s: %w", fd.Name(), err)
+		}
+		decrypted, err := o.Router.Open(&e)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", fd.Name(), err)
+		}
+		r.Set(fd, protoreflect.ValueOfBytes(decrypted))
+		return nil
+	})
+}
+
+// eachField calls f with every non-empty field of the message named in
+// Fields.
+func (o Options) eachField(message proto.Message, f func(protoreflect.Message, protoreflect.FieldDescriptor, []byte) error) error {
+	r := message.ProtoReflect()
+	for _, name := range o.Fields {
+		fd := r.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			continue
+		}
+		if fd.Kind() != protoreflect.BytesKind || fd.Cardinality() == protoreflect.Repeated {
+			return fmt.Errorf("field %s is not a bytes field", name)
+		}
+		value := r.Get(fd).Bytes()
+		if len(value) == 0 {
+			continue
+		}
+		if err := f(r, fd, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// metadata returns the algorithm and KID of the encrypter as metadata.
+func (o Options) metadata() metadata.MD {
+	if o.Encrypter == nil {
+		return nil
+	}
+	return metadata.Pairs(MetadataAlgorithm, string(o.Encrypter.GetAlgorithm()), MetadataKID, o.Encrypter.GetKID())
+}
+
+// UnaryClientInterceptor encrypts the fields of requests and decrypts the
+// fields of responses.
+func UnaryClientInterceptor(o Options) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		encrypted, err := o.encrypt(req)
+		if err != nil {
+			return err
+		}
+		if md := o.metadata(); md != nil {
+			ctx = metadata.NewOutgoingContext(ctx, metadata.Join(outgoing(ctx), md))
+		}
+		if err := invoker(ctx, method, encrypted, reply, cc, opts...); err != nil {
+			return err
+		}
+		return o.decrypt(reply)
+	}
+}
+
+// StreamClientInterceptor encrypts the fields of every message sent on a
+// stream and decrypts the fields of every message received.
+func StreamClientInterceptor(o Options) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if md := o.metadata(); md != nil {
+			ctx = metadata.NewOutgoingContext(ctx, metadata.Join(outgoing(ctx), md))
+		}
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &clientStream{ClientStream: stream, options: o}, nil
+	}
+}
+
+func outgoing(ctx context.Context) metadata.MD {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	return md
+}
+
+type clientStream struct {
+	grpc.ClientStream
+	options Options
+}
+
+func (s *clientStream) SendMsg(m interface{}) error {
+	encrypted, err := s.options.encrypt(m)
+	if err != nil {
+		return err
+	}
+	return s.ClientStream.SendMsg(encrypted)
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	if err := s.ClientStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.options.decrypt(m)
+}
+
+// UnaryServerInterceptor decrypts the fields of requests and encrypts the
+// fields of responses.  Requests that can't be decrypted fail with
+// codes.InvalidArgument.
+func UnaryServerInterceptor(o Options) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := o.decrypt(req); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "failed to decrypt request")
+		}
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		encrypted, err := o.encrypt(resp)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to encrypt response")
+		}
+		if md := o.metadata(); md != nil {
+			if err := grpc.SetHeader(ctx, md); err != nil {
+				return nil, err
+			}
+		}
+		return encrypted, nil
+	}
+}
+
+// StreamServerInterceptor decrypts the fields of every message received on
+// a stream and encrypts the fields of every message sent.
+func StreamServerInterceptor(o Options) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if md := o.metadata(); md != nil {
+			if err := ss.SetHeader(md); err != nil {
+				return err
+			}
+		}
+		return handler(srv, &serverStream{ServerStream: ss, options: o})
+	}
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	options Options
+}
+
+func (s *serverStream) SendMsg(m interface{}) error {
+	encrypted, err := s.options.encrypt(m)
+	if err != nil {
+		return status.Error(codes.Internal, "failed to encrypt response")
+	}
+	return s.ServerStream.SendMsg(encrypted)
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if err := s.options.decrypt(m); err != nil {
+		return status.Error(codes.InvalidArgument, "failed to decrypt request")
+	}
+	return nil
+}
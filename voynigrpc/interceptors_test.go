@@ -0,0 +1,176 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynigrpc
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xmidt-org/voynicrypto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// upper is a service that replies with its requests in upper case, written
+// out by hand so the test needs no generated code.
+var upper = grpc.ServiceDesc{
+	ServiceName: "test.Upper",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Upper",
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := new(wrapperspb.BytesValue)
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				md, _ := metadata.FromIncomingContext(ctx)
+				if len(md.Get(MetadataKID)) == 0 {
+					return nil, status.Error(codes.FailedPrecondition, "no kid")
+				}
+				return wrapperspb.Bytes(bytes.ToUpper(req.(*wrapperspb.BytesValue).Value)), nil
+			}
+			return interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: "/test.Upper/Upper"}, handler)
+		},
+	}},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "UpperStream",
+		ServerStreams: true,
+		ClientStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			for {
+				req := new(wrapperspb.BytesValue)
+				if err := stream.RecvMsg(req); err != nil {
+					return nil
+				}
+				if err := stream.SendMsg(wrapperspb.Bytes(bytes.ToUpper(req.Value))); err != nil {
+					return err
+				}
+			}
+		},
+	}},
+}
+
+func testCiphers(t *testing.T, kid string) (voynicrypto.Encrypt, *voynicrypto.Router) {
+	key := bytes.Repeat([]byte(kid), 32)[:32]
+	encrypter, err := voynicrypto.NewAESGCMEncrypt(key, voynicrypto.WithKID(kid))
+	require.Nil(t, err)
+	decrypter, err := voynicrypto.NewAESGCMDecrypt(key, voynicrypto.WithKID(kid))
+	require.Nil(t, err)
+	router := voynicrypto.NewRouter(nil)
+	require.Nil(t, router.Register(decrypter))
+	return encrypter, router
+}
+
+func TestInterceptors(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, router := testCiphers(t, "k")
+	options := Options{Encrypter: encrypter, Router: router, Fields: []string{"value"}}
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(options)),
+		grpc.StreamInterceptor(StreamServerInterceptor(options)),
+	)
+	server.RegisterService(&upper, struct{}{})
+	go server.Serve(listener)
+	defer server.Stop()
+
+	// the recorder runs after the interceptor, so it sees what is sent
+	var sent [][]byte
+	recorder := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		sent = append(sent, req.(*wrapperspb.BytesValue).Value)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(UnaryClientInterceptor(options), recorder),
+		grpc.WithStreamInterceptor(StreamClientInterceptor(options)),
+	)
+	require.Nil(err)
+	defer conn.Close()
+
+	req := wrapperspb.Bytes([]byte("hello"))
+	reply := new(wrapperspb.BytesValue)
+	var header metadata.MD
+	require.Nil(conn.Invoke(context.Background(), "/test.Upper/Upper", req, reply, grpc.Header(&header)))
+	assert.Equal("HELLO", string(reply.Value))
+	assert.Equal("hello", string(req.Value))
+	assert.Equal([]string{"k"}, header.Get(MetadataKID))
+	require.Len(sent, 1)
+	assert.NotContains(string(sent[0]), "hello")
+
+	stream, err := conn.NewStream(context.Background(), &upper.Streams[0], "/test.Upper/UpperStream")
+	require.Nil(err)
+	for _, message := range []string{"one", "two"} {
+		require.Nil(stream.SendMsg(wrapperspb.Bytes([]byte(message))))
+		reply := new(wrapperspb.BytesValue)
+		require.Nil(stream.RecvMsg(reply))
+		assert.Equal(string(bytes.ToUpper([]byte(message))), string(reply.Value))
+	}
+	require.Nil(stream.CloseSend())
+
+	// a server with another key can't read the requests
+	_, otherRouter := testCiphers(t, "o")
+	interceptor := UnaryServerInterceptor(Options{Router: otherRouter, Fields: []string{"value"}})
+	encrypted, err := options.encrypt(req)
+	require.Nil(err)
+	_, err = interceptor(context.Background(), encrypted, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return req, nil
+	})
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+}
+
+func TestOptionsFields(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, router := testCiphers(t, "k")
+
+	// messages without the field, and empty fields, are left alone
+	options := Options{Encrypter: encrypter, Router: router, Fields: []string{"payload", "value"}}
+	encrypted, err := options.encrypt(wrapperspb.Bytes(nil))
+	require.Nil(err)
+	assert.Empty(encrypted.(*wrapperspb.BytesValue).Value)
+
+	// fields that aren't bytes can't be encrypted
+	options.Fields = []string{"value"}
+	_, err = options.encrypt(wrapperspb.String("hello"))
+	assert.NotNil(err)
+
+	_, err = options.encrypt("hello")
+	assert.NotNil(err)
+
+	// without an encrypter or router nothing changes
+	message, err := Options{Fields: []string{"value"}}.encrypt(wrapperspb.Bytes([]byte("hello")))
+	require.Nil(err)
+	assert.Equal("hello", string(message.(*wrapperspb.BytesValue).Value))
+	assert.Nil(Options{Fields: []string{"value"}}.decrypt(message))
+}
@@ -0,0 +1,376 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultWatchInterval is how often the watching ciphers poll their keys when
+// no interval is configured.
+const DefaultWatchInterval = 30 * time.Second
+
+var (
+	errNoKeysToWatch = errors.New("no keys to watch")
+)
+
+// WatchOptions configures how the watching ciphers poll for key changes.
+type WatchOptions struct {
+	// Interval is the time between polls of the key loaders.  If not
+	// supplied, DefaultWatchInterval is used instead.
+	Interval time.Duration
+
+	// Logger is the Logger used to report reloads.  If not
+	// supplied, DefaultLogger() is used instead.
+	Logger Logger
+}
+
+// keyWatcher polls a set of KeyLoaders and calls reload whenever the combined
+// contents of the keys change.
+type keyWatcher struct {
+	keys     []KeyLoader
+	interval time.Duration
+	logger   Logger
+	reload   func() error
+
+	lock        sync.Mutex
+	fingerprint []byte
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newKeyWatcher(keys []KeyLoader, options WatchOptions, reload func() error) (*keyWatcher, error) {
+	if len(keys) == 0 {
+		return nil, errNoKeysToWatch
+	}
+	if options.Interval <= 0 {
+		options.Interval = DefaultWatchInterval
+	}
+	if options.Logger == nil {
+		options.Logger = DefaultLogger()
+	}
+
+	w := &keyWatcher{
+		keys:     keys,
+		interval: options.Interval,
+		logger:   options.Logger,
+		reload:   reload,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	fingerprint, err := w.currentFingerprint()
+	if err != nil {
+		return nil, err
+	}
+	if err := reload(); err != nil {
+		return nil, err
+	}
+	w.fingerprint = fingerprint
+
+	go w.run()
+	return w, nil
+}
+
+// currentFingerprint hashes the bytes of every key so changes in any of them
+// can be detected without holding on to the key material.
+func (w *keyWatcher) currentFingerprint() ([]byte, error) {
+	h := sha256.New()
+	for _, key := range w.keys {
+		if key == nil {
+			continue
+		}
+		data, err := key.GetBytes()
+		if err != nil {
+			return nil, err
+		}
+		writeFingerprint(h, data)
+	}
+	return h.Sum(nil), nil
+}
+
+// writeFingerprint adds length prefixed data to a fingerprint.
+func writeFingerprint(h hash.Hash, data []byte) {
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(len(data)))
+	h.Write(size[:])
+	h.Write(data)
+}
+
+func (w *keyWatcher) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			if _, err := w.check(false); err != nil {
+				logError(w.logger, "failed to reload keys", ErrorKey, err)
+			}
+		}
+	}
+}
+
+// check reloads the cipher if the keys changed since the last check, or
+// unconditionally if force is set.  It reports whether a reload happened.
+func (w *keyWatcher) check(force bool) (bool, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	fingerprint, err := w.currentFingerprint()
+	if err != nil {
+		// the key may be in the middle of being rewritten, try again next poll
+		return false, err
+	}
+	if !force && bytes.Equal(fingerprint, w.fingerprint) {
+		return false, nil
+	}
+
+	// remember the fingerprint even if the reload fails so a bad key is only
+	// reported once rather than on every poll.
+	w.fingerprint = fingerprint
+	if err := w.reload(); err != nil {
+		return false, err
+	}
+	logInfo(w.logger, "reloaded keys")
+	return true, nil
+}
+
+func (w *keyWatcher) close() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+}
+
+// cipherSlot holds the active cipher of a reloading cipher.  Calls hold its
+// read lock while they use the cipher, so once swap has the lock the cipher
+// it replaces is no longer in use, and it's closed to wipe its keys.
+type cipherSlot struct {
+	lock   sync.RWMutex
+	cipher Identification
+}
+
+// swap makes cipher the active one and closes the one it replaces.
+func (s *cipherSlot) swap(cipher Identification) {
+	s.lock.Lock()
+	old := s.cipher
+	s.cipher = cipher
+	s.lock.Unlock()
+	if old != nil && old != cipher {
+		CloseCipher(old)
+	}
+}
+
+// acquire returns the active cipher, which isn't closed until release is
+// called.
+func (s *cipherSlot) acquire() Identification {
+	s.lock.RLock()
+	return s.cipher
+}
+
+func (s *cipherSlot) release() {
+	s.lock.RUnlock()
+}
+
+// WatchingEncrypter is an Encrypt that reloads itself whenever the underlying
+// keys change, so key rotation does not require a process restart.
+type WatchingEncrypter struct {
+	loader  EncryptLoader
+	current cipherSlot
+	watcher *keyWatcher
+}
+
+// NewWatchingEncrypter loads an encrypter and starts watching the keys
+// given.  When the contents of any key change, the loader is run again and the
+// new encrypter is swapped in atomically and the previous one closed once
+// the calls using it return.  If reloading fails, the previous encrypter
+// stays active.
+func NewWatchingEncrypter(loader EncryptLoader, keys []KeyLoader, options WatchOptions) (*WatchingEncrypter, error) {
+	if loader == nil {
+		return nil, errors.New("no loader")
+	}
+	e := &WatchingEncrypter{
+		loader: loader,
+	}
+	watcher, err := newKeyWatcher(keys, options, e.load)
+	if err != nil {
+		return nil, err
+	}
+	e.watcher = watcher
+	return e, nil
+}
+
+func (e *WatchingEncrypter) load() error {
+	invalidateKeyCache(e.loader)
+	encrypter, err := e.loader.LoadEncrypt()
+	if err != nil {
+		return err
+	}
+	e.current.swap(encrypter)
+	return nil
+}
+
+// GetAlgorithm returns the algorithm of the active encrypter.
+func (e *WatchingEncrypter) GetAlgorithm() AlgorithmType {
+	defer e.current.release()
+	return e.current.acquire().GetAlgorithm()
+}
+
+// GetKID returns the KID of the active encrypter.
+func (e *WatchingEncrypter) GetKID() string {
+	defer e.current.release()
+	return e.current.acquire().GetKID()
+}
+
+// EncryptMessage encrypts the message with the active encrypter.
+func (e *WatchingEncrypter) EncryptMessage(message []byte) ([]byte, []byte, error) {
+	defer e.current.release()
+	return e.current.acquire().(Encrypt).EncryptMessage(message)
+}
+
+// Reload forces the keys to be loaded again, regardless of whether they changed.
+func (e *WatchingEncrypter) Reload() error {
+	_, err := e.watcher.check(true)
+	return err
+}
+
+// Close stops watching the keys.  The last loaded encrypter remains usable.
+func (e *WatchingEncrypter) Close() error {
+	e.watcher.close()
+	return nil
+}
+
+// WatchingDecrypter is a Decrypt that reloads itself whenever the underlying
+// keys change, so key rotation does not require a process restart.
+type WatchingDecrypter struct {
+	loader  DecryptLoader
+	current cipherSlot
+	watcher *keyWatcher
+}
+
+// NewWatchingDecrypter loads a decrypter and starts watching the keys
+// given.  When the contents of any key change, the loader is run again and the
+// new decrypter is swapped in atomically and the previous one closed once
+// the calls using it return.  If reloading fails, the previous decrypter
+// stays active.
+func NewWatchingDecrypter(loader DecryptLoader, keys []KeyLoader, options WatchOptions) (*WatchingDecrypter, error) {
+	if loader == nil {
+		return nil, errors.New("no loader")
+	}
+	d := &WatchingDecrypter{
+		loader: loader,
+	}
+	watcher, err := newKeyWatcher(keys, options, d.load)
+	if err != nil {
+		return nil, err
+	}
+	d.watcher = watcher
+	return d, nil
+}
+
+func (d *WatchingDecrypter) load() error {
+	invalidateKeyCache(d.loader)
+	decrypter, err := d.loader.LoadDecrypt()
+	if err != nil {
+		return err
+	}
+	d.current.swap(decrypter)
+	return nil
+}
+
+// GetAlgorithm returns the algorithm of the active decrypter.
+func (d *WatchingDecrypter) GetAlgorithm() AlgorithmType {
+	defer d.current.release()
+	return d.current.acquire().GetAlgorithm()
+}
+
+// GetKID returns the KID of the active decrypter.
+func (d *WatchingDecrypter) GetKID() string {
+	defer d.current.release()
+	return d.current.acquire().GetKID()
+}
+
+// DecryptMessage decrypts the message with the active decrypter.
+func (d *WatchingDecrypter) DecryptMessage(cipher []byte, nonce []byte) ([]byte, error) {
+	defer d.current.release()
+	return d.current.acquire().(Decrypt).DecryptMessage(cipher, nonce)
+}
+
+// Reload forces the keys to be loaded again, regardless of whether they changed.
+func (d *WatchingDecrypter) Reload() error {
+	_, err := d.watcher.check(true)
+	return err
+}
+
+// Close stops watching the keys.  The last loaded decrypter remains usable.
+func (d *WatchingDecrypter) Close() error {
+	d.watcher.close()
+	return nil
+}
+
+// keyLoaders returns the loader for every key configured, ordered by key type.
+func (config *Config) keyLoaders() []KeyLoader {
+	keyTypes := make([]string, 0, len(config.Keys)+len(config.Loaders))
+	for keyType := range config.Keys {
+		if _, ok := config.Loaders[keyType]; !ok {
+			keyTypes = append(keyTypes, string(keyType))
+		}
+	}
+	for keyType := range config.Loaders {
+		keyTypes = append(keyTypes, string(keyType))
+	}
+	sort.Strings(keyTypes)
+
+	loaders := make([]KeyLoader, len(keyTypes))
+	for i, keyType := range keyTypes {
+		loaders[i] = config.sourceLoader(KeyType(keyType))
+	}
+	return loaders
+}
+
+// WatchEncrypt loads an encrypter from the config that reloads itself whenever
+// any of the configured keys change.
+func (config *Config) WatchEncrypt(options WatchOptions) (*WatchingEncrypter, error) {
+	if options.Logger == nil {
+		options.Logger = config.Logger
+	}
+	return NewWatchingEncrypter(config, config.keyLoaders(), options)
+}
+
+// WatchDecrypt loads a decrypter from the config that reloads itself whenever
+// any of the configured keys change.
+func (config *Config) WatchDecrypt(options WatchOptions) (*WatchingDecrypter, error) {
+	if options.Logger == nil {
+		options.Logger = config.Logger
+	}
+	return NewWatchingDecrypter(config, config.keyLoaders(), options)
+}
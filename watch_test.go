@@ -0,0 +1,175 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/rand"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/nacl/box"
+)
+
+func writeBoxKeys(t *testing.T, privatePath, publicPath string) (*[32]byte, *[32]byte) {
+	require := require.New(t)
+
+	publicKey, privateKey, err := box.GenerateKey(rand.Reader)
+	require.Nil(err)
+
+	require.Nil(ioutil.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "BOX PRIVATE KEY", Bytes: privateKey[:]}), 0600))
+	require.Nil(ioutil.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "BOX PUBLIC KEY", Bytes: publicKey[:]}), 0600))
+	return publicKey, privateKey
+}
+
+func TestWatchingEncrypter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "voynicrypto")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	senderPrivatePath := filepath.Join(dir, "sendPrivate.pem")
+	senderPublicPath := filepath.Join(dir, "sendPublic.pem")
+	recipientPrivatePath := filepath.Join(dir, "private.pem")
+	recipientPublicPath := filepath.Join(dir, "public.pem")
+
+	senderPublicKey, _ := writeBoxKeys(t, senderPrivatePath, senderPublicPath)
+	_, recipientPrivateKey := writeBoxKeys(t, recipientPrivatePath, recipientPublicPath)
+
+	config := Config{
+		Logger: newTestLogger(t),
+		Type:   Box,
+		KID:    "watched",
+		Keys: map[KeyType]string{
+			SenderPrivateKey:   senderPrivatePath,
+			RecipientPublicKey: recipientPublicPath,
+		},
+	}
+
+	encrypter, err := config.WatchEncrypt(WatchOptions{Interval: 10 * time.Millisecond})
+	require.Nil(err)
+	defer encrypter.Close()
+
+	assert.Equal(Box, encrypter.GetAlgorithm())
+	assert.Equal("watched", encrypter.GetKID())
+
+	decrypter := NewBoxDecrypter(*recipientPrivateKey, *senderPublicKey, "watched")
+	testCryptoPair(t, encrypter, decrypter, false)
+
+	replaced := encrypter.current.cipher.(Encrypt)
+
+	// rotate the recipient keys out from under the encrypter
+	_, rotatedPrivateKey := writeBoxKeys(t, recipientPrivatePath, recipientPublicPath)
+	rotated := NewBoxDecrypter(*rotatedPrivateKey, *senderPublicKey, "watched")
+
+	require.Eventually(func() bool {
+		crypt, nonce, err := encrypter.EncryptMessage([]byte("hello"))
+		if err != nil {
+			return false
+		}
+		_, err = rotated.DecryptMessage(crypt, nonce)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, _, err = replaced.EncryptMessage([]byte("hello"))
+	assert.Equal(errCipherClosed, err, "the replaced encrypter is closed")
+}
+
+func TestWatchingDecrypterKeepsLastGoodKeys(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "voynicrypto")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	senderPrivatePath := filepath.Join(dir, "sendPrivate.pem")
+	senderPublicPath := filepath.Join(dir, "sendPublic.pem")
+	recipientPrivatePath := filepath.Join(dir, "private.pem")
+	recipientPublicPath := filepath.Join(dir, "public.pem")
+
+	_, senderPrivateKey := writeBoxKeys(t, senderPrivatePath, senderPublicPath)
+	recipientPublicKey, _ := writeBoxKeys(t, recipientPrivatePath, recipientPublicPath)
+
+	config := Config{
+		Type: Box,
+		Keys: map[KeyType]string{
+			SenderPublicKey:     senderPublicPath,
+			RecipientPrivateKey: recipientPrivatePath,
+		},
+	}
+
+	decrypter, err := config.WatchDecrypt(WatchOptions{Interval: time.Hour})
+	require.Nil(err)
+	defer decrypter.Close()
+
+	encrypter := NewBoxEncrypter(*senderPrivateKey, *recipientPublicKey, "")
+	testCryptoPair(t, encrypter, decrypter, false)
+
+	// a corrupt key must not replace the working decrypter
+	require.Nil(ioutil.WriteFile(recipientPrivatePath, pem.EncodeToMemory(&pem.Block{Type: "GARBAGE", Bytes: []byte("nope")}), 0600))
+	assert.NotNil(decrypter.Reload())
+	testCryptoPair(t, encrypter, decrypter, false)
+}
+
+func TestWatchingNoKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewWatchingEncrypter(&Config{Type: None}, nil, WatchOptions{})
+	assert.Equal(errNoKeysToWatch, err)
+
+	_, err = NewWatchingDecrypter(nil, nil, WatchOptions{})
+	assert.NotNil(err)
+}
+
+func TestConfigKeyLoadersOrdered(t *testing.T) {
+	assert := assert.New(t)
+
+	config := &Config{
+		Keys: map[KeyType]string{
+			SenderPrivateKey:    "sender.pem",
+			RecipientPublicKey:  "recipient.pem",
+			RecipientPrivateKey: "recipient-private.pem",
+		},
+		Loaders: map[KeyType]KeyLoader{
+			SenderPublicKey:     &BytesLoader{Data: []byte(SenderPublicKey)},
+			RecipientPrivateKey: &BytesLoader{Data: []byte(RecipientPrivateKey)},
+			PublicKey:           &BytesLoader{Data: []byte(PublicKey)},
+		},
+	}
+	expected := []KeyLoader{
+		config.Loaders[PublicKey],
+		config.Loaders[RecipientPrivateKey],
+		CreateFileLoader(config.Keys, RecipientPublicKey),
+		CreateFileLoader(config.Keys, SenderPrivateKey),
+		config.Loaders[SenderPublicKey],
+	}
+
+	// map iteration is random, so the fingerprint would change between polls
+	// if the order did
+	for i := 0; i < 20; i++ {
+		assert.Equal(expected, config.keyLoaders())
+	}
+}
@@ -0,0 +1,116 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+// The websocket data message types, which are the same as those of
+// gorilla/websocket.
+const (
+	WebSocketTextMessage   = 1
+	WebSocketBinaryMessage = 2
+)
+
+// WebSocketConn is the part of a gorilla *websocket.Conn that
+// EncryptedWebSocket uses.
+type WebSocketConn interface {
+	ReadMessage() (messageType int, data []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+}
+
+// EncryptedWebSocket encrypts the messages written to a websocket connection
+// and decrypts the ones read from it, so their contents are protected from
+// an edge that terminates TLS.  It's a WebSocketConn itself, so it can be
+// used in place of the connection by code that reads and writes whole
+// messages; the NextReader and NextWriter methods of gorilla aren't covered.
+// Like the connection it supports one concurrent reader and one concurrent
+// writer.
+//
+// Text messages are sent as the text form of an envelope, so they are still
+// valid text frames, and binary messages as the marshalled envelope.  Other
+// message types, such as the control messages, are passed through as they
+// are.  The Channel is bound to each message as associated data.  Setting it
+// to something only both ends of the connection know, like the device ID,
+// keeps messages from being replayed onto another device's connection.
+type EncryptedWebSocket struct {
+	// Conn is the connection, usually a gorilla *websocket.Conn.
+	Conn WebSocketConn
+
+	// Encrypter encrypts the messages written.
+	Encrypter Encrypt
+
+	// Router finds the decrypter of the messages read.
+	Router *Router
+
+	// Channel is bound to every message as associated data.
+	Channel string
+
+	// SealOptions are used when sealing messages.
+	SealOptions []SealOption
+}
+
+// WriteMessage seals a text or binary message and writes it.
+func (w *EncryptedWebSocket) WriteMessage(messageType int, data []byte) error {
+	if messageType != WebSocketTextMessage && messageType != WebSocketBinaryMessage {
+		return w.Conn.WriteMessage(messageType, data)
+	}
+	if w.Encrypter == nil {
+		return errNoTransportCipher
+	}
+	e, err := SealEnvelopeWithAD(w.Encrypter, data, transportAD("websocket", w.Channel), w.SealOptions...)
+	if err != nil {
+		return err
+	}
+	if messageType == WebSocketTextMessage {
+		data, err = e.MarshalText()
+	} else {
+		data, err = e.MarshalBinary()
+	}
+	if err != nil {
+		return err
+	}
+	return w.Conn.WriteMessage(messageType, data)
+}
+
+// ReadMessage reads a message and opens it if it's a text or binary message.
+func (w *EncryptedWebSocket) ReadMessage() (int, []byte, error) {
+	messageType, data, err := w.Conn.ReadMessage()
+	if err != nil || (messageType != WebSocketTextMessage && messageType != WebSocketBinaryMessage) {
+		return messageType, data, err
+	}
+	if w.Router == nil {
+		return messageType, nil, errNoTransportCipher
+	}
+
+	var e Envelope
+	if messageType == WebSocketTextMessage {
+		err = e.UnmarshalText(data)
+	} else {
+		err = e.UnmarshalBinary(data)
+	}
+	if err != nil {
+		return messageType, nil, err
+	}
+	decrypter, err := w.Router.Route(e.Algorithm, e.KID)
+	if err != nil {
+		return messageType, nil, err
+	}
+	message, err := e.OpenWithAD(decrypter, transportAD("websocket", w.Channel))
+	if err != nil {
+		return messageType, nil, err
+	}
+	return messageType, message, nil
+}
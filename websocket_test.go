@@ -0,0 +1,132 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"errors"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ WebSocketConn = (*EncryptedWebSocket)(nil)
+
+type webSocketMessage struct {
+	messageType int
+	data        []byte
+}
+
+// pipeWebSocket is a connection that reads back what was written to it.
+type pipeWebSocket struct {
+	messages []webSocketMessage
+}
+
+func (p *pipeWebSocket) WriteMessage(messageType int, data []byte) error {
+	p.messages = append(p.messages, webSocketMessage{messageType, data})
+	return nil
+}
+
+func (p *pipeWebSocket) ReadMessage() (int, []byte, error) {
+	if len(p.messages) == 0 {
+		return 0, nil, errors.New("closed")
+	}
+	m := p.messages[0]
+	p.messages = p.messages[1:]
+	return m.messageType, m.data, nil
+}
+
+func TestEncryptedWebSocket(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := aesGCMPair(t)
+	router := NewRouter(nil)
+	require.Nil(router.Register(decrypter))
+
+	pipe := &pipeWebSocket{}
+	conn := &EncryptedWebSocket{Conn: pipe, Encrypter: encrypter, Router: router, Channel: "device-1"}
+
+	require.Nil(conn.WriteMessage(WebSocketTextMessage, []byte(`{"hello":"world"}`)))
+	require.Nil(conn.WriteMessage(WebSocketBinaryMessage, []byte{0, 1, 2}))
+	require.Nil(conn.WriteMessage(9, []byte("ping")))
+
+	require.Len(pipe.messages, 3)
+	assert.True(utf8.Valid(pipe.messages[0].data))
+	assert.NotContains(string(pipe.messages[0].data), "hello")
+	assert.Equal([]byte("ping"), pipe.messages[2].data)
+
+	messageType, data, err := conn.ReadMessage()
+	require.Nil(err)
+	assert.Equal(WebSocketTextMessage, messageType)
+	assert.Equal(`{"hello":"world"}`, string(data))
+
+	messageType, data, err = conn.ReadMessage()
+	require.Nil(err)
+	assert.Equal(WebSocketBinaryMessage, messageType)
+	assert.Equal([]byte{0, 1, 2}, data)
+
+	messageType, data, err = conn.ReadMessage()
+	require.Nil(err)
+	assert.Equal(9, messageType)
+	assert.Equal([]byte("ping"), data)
+
+	_, _, err = conn.ReadMessage()
+	assert.NotNil(err)
+}
+
+func TestEncryptedWebSocketRejected(t *testing.T) {
+	encrypter, decrypter := aesGCMPair(t)
+	router := NewRouter(nil)
+	require.Nil(t, router.Register(decrypter))
+
+	sealed := func(channel string) []byte {
+		pipe := &pipeWebSocket{}
+		conn := &EncryptedWebSocket{Conn: pipe, Encrypter: encrypter, Channel: channel}
+		require.Nil(t, conn.WriteMessage(WebSocketBinaryMessage, []byte("hello")))
+		return pipe.messages[0].data
+	}
+
+	testData := []struct {
+		description string
+		message     webSocketMessage
+		router      *Router
+	}{
+		{"another channel", webSocketMessage{WebSocketBinaryMessage, sealed("device-2")}, router},
+		{"not an envelope", webSocketMessage{WebSocketTextMessage, []byte("hello")}, router},
+		{"unknown kid", webSocketMessage{WebSocketBinaryMessage, sealed("device-1")}, NewRouter(nil)},
+		{"no router", webSocketMessage{WebSocketBinaryMessage, sealed("device-1")}, nil},
+	}
+
+	for _, tc := range testData {
+		t.Run(tc.description, func(t *testing.T) {
+			conn := &EncryptedWebSocket{
+				Conn:    &pipeWebSocket{messages: []webSocketMessage{tc.message}},
+				Router:  tc.router,
+				Channel: "device-1",
+			}
+			_, data, err := conn.ReadMessage()
+			assert.NotNil(t, err)
+			assert.Nil(t, data)
+		})
+	}
+
+	conn := &EncryptedWebSocket{Conn: &pipeWebSocket{}}
+	assert.Equal(t, errNoTransportCipher, conn.WriteMessage(WebSocketTextMessage, []byte("hello")))
+}
@@ -0,0 +1,134 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// The WRP metadata keys that carry the algorithm, KID and nonce of an
+// encrypted WRP payload, as Codex reads them.  The nonce is unpadded URL safe
+// base64.  For the RSA algorithms the nonce key holds the signature, if there
+// is one.
+const (
+	WRPAlgorithmKey = "alg"
+	WRPKIDKey       = "kid"
+	WRPNonceKey     = "nonce"
+)
+
+var errWRPNotEncrypted = errors.New("wrp payload is not encrypted")
+
+// EncryptWRPPayload encrypts the payload of a WRP message and returns the
+// new payload along with a copy of the metadata stamped with the algorithm,
+// KID and nonce.  The metadata passed in isn't changed.  With a wrp.Message:
+//
+//	msg.Payload, msg.Metadata, err = voynicrypto.EncryptWRPPayload(encrypter, msg.Payload, msg.Metadata)
+func EncryptWRPPayload(encrypter Encrypt, payload []byte, metadata map[string]string) ([]byte, map[string]string, error) {
+	if encrypter == nil {
+		return nil, nil, errors.New("no encrypter")
+	}
+	cipher, nonce, err := encrypter.EncryptMessage(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stamped := make(map[string]string, len(metadata)+3)
+	for k, v := range metadata {
+		stamped[k] = v
+	}
+	stamped[WRPAlgorithmKey] = string(encrypter.GetAlgorithm())
+	if kid := encrypter.GetKID(); kid != "" {
+		stamped[WRPKIDKey] = kid
+	} else {
+		delete(stamped, WRPKIDKey)
+	}
+	stamped[WRPNonceKey] = base64.RawURLEncoding.EncodeToString(nonce)
+	return cipher, stamped, nil
+}
+
+// IsWRPPayloadEncrypted reports whether the metadata of a WRP message says
+// its payload is encrypted.
+func IsWRPPayloadEncrypted(metadata map[string]string) bool {
+	return metadata[WRPAlgorithmKey] != ""
+}
+
+// DecryptWRPPayload reverses EncryptWRPPayload, returning the plain payload
+// and a copy of the metadata without the encryption keys.  It fails if the
+// payload isn't encrypted or the algorithm or KID don't match the decrypter.
+func DecryptWRPPayload(decrypter Decrypt, payload []byte, metadata map[string]string) ([]byte, map[string]string, error) {
+	if decrypter == nil {
+		return nil, nil, errors.New("no decrypter")
+	}
+	e, err := wrpEnvelope(payload, metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+	return openWRPPayload(e, decrypter, metadata)
+}
+
+// DecryptWRPPayload is DecryptWRPPayload with the decrypter routed from the
+// algorithm and KID in the metadata.
+func (r *Router) DecryptWRPPayload(payload []byte, metadata map[string]string) ([]byte, map[string]string, error) {
+	e, err := wrpEnvelope(payload, metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+	decrypter, err := r.Route(e.Algorithm, e.KID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return openWRPPayload(e, decrypter, metadata)
+}
+
+func wrpEnvelope(payload []byte, metadata map[string]string) (*Envelope, error) {
+	if !IsWRPPayloadEncrypted(metadata) {
+		return nil, errWRPNotEncrypted
+	}
+	e := &Envelope{
+		Algorithm: canonicalAlgorithmType(metadata[WRPAlgorithmKey]),
+		KID:       metadata[WRPKIDKey],
+		Cipher:    payload,
+	}
+	nonce, err := base64.RawURLEncoding.DecodeString(metadata[WRPNonceKey])
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrp nonce: %w", err)
+	}
+	if signs(e.Algorithm) {
+		e.Signature = nonce
+	} else {
+		e.Nonce = nonce
+	}
+	return e, nil
+}
+
+func openWRPPayload(e *Envelope, decrypter Decrypt, metadata map[string]string) ([]byte, map[string]string, error) {
+	payload, err := e.Open(decrypter)
+	if err != nil {
+		return nil, nil, err
+	}
+	stripped := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		stripped[k] = v
+	}
+	delete(stripped, WRPAlgorithmKey)
+	delete(stripped, WRPKIDKey)
+	delete(stripped, WRPNonceKey)
+	return payload, stripped, nil
+}
@@ -0,0 +1,70 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWRPPayload(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := loadBoxPair(t)
+	router := NewRouter(nil)
+	require.Nil(router.Register(decrypter))
+
+	metadata := map[string]string{"/hw-model": "abc"}
+	payload, stamped, err := EncryptWRPPayload(encrypter, []byte("payload"), metadata)
+	require.Nil(err)
+	assert.Equal(map[string]string{"/hw-model": "abc"}, metadata, "metadata is copied")
+	assert.Equal(string(Box), stamped[WRPAlgorithmKey])
+	assert.Equal(encrypter.GetKID(), stamped[WRPKIDKey])
+	assert.NotEmpty(stamped[WRPNonceKey])
+	assert.True(IsWRPPayloadEncrypted(stamped))
+	assert.False(IsWRPPayloadEncrypted(metadata))
+
+	plain, stripped, err := DecryptWRPPayload(decrypter, payload, stamped)
+	require.Nil(err)
+	assert.Equal("payload", string(plain))
+	assert.Equal(metadata, stripped)
+
+	plain, stripped, err = router.DecryptWRPPayload(payload, stamped)
+	require.Nil(err)
+	assert.Equal("payload", string(plain))
+	assert.Equal(metadata, stripped)
+
+	_, _, err = DecryptWRPPayload(decrypter, []byte("payload"), metadata)
+	assert.Equal(errWRPNotEncrypted, err)
+
+	stamped[WRPNonceKey] = "!"
+	_, _, err = DecryptWRPPayload(decrypter, payload, stamped)
+	assert.NotNil(err)
+
+	stamped[WRPKIDKey] = "other"
+	_, _, err = router.DecryptWRPPayload(payload, stamped)
+	assert.NotNil(err)
+
+	_, _, err = EncryptWRPPayload(nil, []byte("payload"), nil)
+	assert.NotNil(err)
+	_, _, err = DecryptWRPPayload(nil, payload, stamped)
+	assert.NotNil(err)
+}
@@ -0,0 +1,161 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/rsa"
+	"errors"
+	"io"
+	"math/big"
+)
+
+var errCipherClosed = errors.New("cipher closed")
+
+// CloseCipher closes the cipher if it holds key material that can be wiped,
+// which every cipher built by this package does.  A cipher owns the keys it
+// was built from: closing it wipes them, so keys shared with another cipher
+// must not be used after either is closed.  Close waits for calls in
+// progress to finish, and calls after it fail.
+//
+// Wiping is best effort.  The garbage collector may have copied the keys, and
+// crypto/rsa keeps its own precomputed copy, so a closed cipher also refuses
+// to run at all.
+func CloseCipher(cipher Identification) error {
+	if closer, ok := cipher.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Close does nothing, as NOOP has no keys.
+func (*NOOP) Close() error {
+	return nil
+}
+
+// Close wipes the private keys.  The public keys are left alone.
+func (c *rsaEncrypterDecrypter) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.closed = true
+	// the keys are wiped but kept, as GetAlgorithm looks at them
+	wipeRSAPrivateKey(c.recipientPrivateKey)
+	wipeRSAPrivateKey(c.senderPrivateKey)
+	return nil
+}
+
+// Close wipes the private key and the precomputed shared key.
+func (enBox *encryptBox) Close() error {
+	enBox.lock.Lock()
+	defer enBox.lock.Unlock()
+	wipe(enBox.senderPrivateKey[:])
+	if enBox.sharedEncryptKey != nil {
+		wipe(enBox.sharedEncryptKey[:])
+		enBox.sharedEncryptKey = nil
+	}
+	return nil
+}
+
+// Close wipes the private key and the precomputed shared key.
+func (deBox *decryptBox) Close() error {
+	deBox.lock.Lock()
+	defer deBox.lock.Unlock()
+	wipe(deBox.recipientPrivateKey[:])
+	if deBox.sharedDecryptKey != nil {
+		wipe(deBox.sharedDecryptKey[:])
+		deBox.sharedDecryptKey = nil
+	}
+	return nil
+}
+
+// Close wipes the private key.
+func (s *ed25519Signer) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	wipe(s.privateKey)
+	s.privateKey = nil
+	return nil
+}
+
+// Close wipes the private key.
+func (s *rsaPSSSigner) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	wipeRSAPrivateKey(s.privateKey)
+	s.privateKey = nil
+	return nil
+}
+
+// Close wipes the private key.
+func (s *ecdsaSigner) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = true
+	if s.privateKey != nil {
+		wipeInt(s.privateKey.D)
+	}
+	s.privateKey = nil
+	return nil
+}
+
+// Close closes every decrypter.
+func (f *fallbackDecrypter) Close() error {
+	errs := make([]error, 0, len(f.decrypters))
+	for _, decrypter := range f.decrypters {
+		errs = append(errs, CloseCipher(decrypter))
+	}
+	return errors.Join(errs...)
+}
+
+// wipe zeroes a buffer that held secrets.
+func wipe(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+}
+
+// wipeInt zeroes the words of a big.Int before resetting it.
+func wipeInt(x *big.Int) {
+	if x == nil {
+		return
+	}
+	words := x.Bits()
+	for i := range words {
+		words[i] = 0
+	}
+	x.SetInt64(0)
+}
+
+func wipeRSAPrivateKey(key *rsa.PrivateKey) {
+	if key == nil {
+		return
+	}
+	wipeInt(key.D)
+	for _, prime := range key.Primes {
+		wipeInt(prime)
+	}
+	wipeInt(key.Precomputed.Dp)
+	wipeInt(key.Precomputed.Dq)
+	wipeInt(key.Precomputed.Qinv)
+	for _, value := range key.Precomputed.CRTValues {
+		wipeInt(value.Exp)
+		wipeInt(value.Coeff)
+		wipeInt(value.R)
+	}
+}
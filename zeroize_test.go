@@ -0,0 +1,87 @@
+/**
+ * Copyright 2019 Comcast Cable Communications Management, LLC
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package voynicrypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloseCipher(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	encrypter, decrypter := loadBoxPair(t)
+	cipher, nonce, err := encrypter.EncryptMessage([]byte("hello"))
+	require.Nil(err)
+
+	require.Nil(CloseCipher(encrypter))
+	require.Nil(CloseCipher(decrypter))
+	assert.Equal([32]byte{}, encrypter.(*encryptBox).senderPrivateKey)
+	assert.Equal([32]byte{}, decrypter.(*decryptBox).recipientPrivateKey)
+
+	_, _, err = encrypter.EncryptMessage([]byte("hello"))
+	assert.Equal(errCipherClosed, err)
+	_, err = decrypter.DecryptMessage(cipher, nonce)
+	assert.Equal(errCipherClosed, err)
+	assert.Nil(CloseCipher(decrypter), "closing twice is fine")
+
+	privateKey := GeneratePrivateKey(2048)
+	rsaDecrypter := NewRSADecrypter(DefaultRSAHash, privateKey, nil, "")
+	require.Nil(CloseCipher(rsaDecrypter))
+	assert.Zero(privateKey.D.Sign())
+	for _, prime := range privateKey.Primes {
+		assert.Zero(prime.Sign())
+	}
+	_, err = rsaDecrypter.DecryptMessage([]byte("cipher"), nil)
+	assert.Equal(errCipherClosed, err)
+
+	assert.Nil(CloseCipher(DefaultCipherDecrypter()))
+	assert.Nil(CloseCipher(&reverser{}), "ciphers without Close are left alone")
+}
+
+func TestCloseSigners(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(err)
+	rsaKey := GeneratePrivateKey(2048)
+
+	signers := []Sign{
+		NewEd25519Signer(edKey, ""),
+		NewECDSASigner(DefaultSignHash, ecKey, ""),
+		NewRSAPSSSigner(DefaultSignHash, rsaKey, ""),
+	}
+	for _, signer := range signers {
+		require.Nil(CloseCipher(signer))
+		_, err := signer.SignMessage([]byte("hello"))
+		assert.Equal(errCipherClosed, err)
+	}
+	assert.Equal(make(ed25519.PrivateKey, ed25519.PrivateKeySize), edKey)
+	assert.Zero(ecKey.D.Sign())
+	assert.Zero(rsaKey.D.Sign())
+}